@@ -13,13 +13,27 @@ type Node interface {
 type Ast struct {
     Decls []Decl // only declaring/defining variables/functions allowed in global scope
     NoMainArg bool
+    Tests bool  // compiled with "gamma test" (the test runner is the entry point)
+}
+
+// function called by _start
+func (ast *Ast) Entry() string {
+    if ast.Tests {
+        return "_test_main"
+    }
+
+    return "main"
 }
 
 func (ast *Ast) ShowAst() {
+    fmt.Print(ast.String());
+}
+
+func (ast *Ast) String() string {
     res := ""
     for _, node := range ast.Decls {
         res += node.Readable(0)
     }
 
-    fmt.Print(res);
+    return res
 }
@@ -1,7 +1,6 @@
 package ast
 
 import (
-    "os"
     "fmt"
     "strings"
     "gamma/types"
@@ -283,9 +282,7 @@ func (d *Import) Readable(indent int) string {
 }
 
 func (o *BadDecl) Readable(indent int) string {
-    fmt.Fprintln(os.Stderr, "[ERROR] bad declaration")
-    os.Exit(1)
-    return ""
+    panic("(internal) bad declaration")
 }
 
 
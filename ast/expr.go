@@ -6,7 +6,6 @@ import (
 	"gamma/token"
 	"gamma/types"
 	"gamma/types/addr"
-	"os"
 	"strings"
 )
 
@@ -341,9 +340,7 @@ func (o *Cast) Readable(indent int) string {
 }
 
 func (o *BadExpr) Readable(indent int) string {
-    fmt.Fprintln(os.Stderr, "[ERROR] bad expression")
-    os.Exit(1)
-    return ""
+    panic("(internal) bad expression")
 }
 
 func (e *Indexed) Flatten() Expr {
@@ -386,8 +383,7 @@ func (f *Field) ToOffset() int64 {
     case types.StructType:
         offset = f.StructType.GetOffset(f.FieldName.Str)
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] cannot get field offset of type %v\n", f.Obj.GetType())
-        os.Exit(1)
+        panic(fmt.Sprintf("(internal) cannot get field offset of type %v", f.Obj.GetType()))
     }
 
     if obj,ok := f.Obj.(*Field); ok {
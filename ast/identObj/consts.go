@@ -1,8 +1,6 @@
 package identObj
 
 import (
-    "os"
-    "fmt"
     "gamma/token"
     "gamma/types"
     "gamma/types/addr"
@@ -43,7 +41,5 @@ func (c *Const) ResolveType(t types.Type) {
 }
 
 func (c *Const) Addr() addr.Addr {
-    fmt.Fprintln(os.Stderr, "[ERROR] Cannot get the addr of a const (consts are not allocated anywhere)")
-    os.Exit(1)
-    return addr.Addr{}
+    panic("(internal) Cannot get the addr of a const (consts are not allocated anywhere)")
 }
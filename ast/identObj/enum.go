@@ -1,8 +1,6 @@
 package identObj
 
 import (
-    "os"
-    "fmt"
     "gamma/token"
     "gamma/types"
     "gamma/types/addr"
@@ -28,9 +26,7 @@ func (e *Enum) GetPos() token.Pos {
 }
 
 func (e *Enum) Addr() addr.Addr {
-    fmt.Fprintln(os.Stderr, "[ERROR] Cannot get the addr of an enum type definition (not allocated anywhere)")
-    os.Exit(1)
-    return addr.Addr{}
+    panic("(internal) Cannot get the addr of an enum type definition (not allocated anywhere)")
 }
 
 func (e *Enum) GetType() types.Type {
@@ -45,11 +41,11 @@ func (e *Enum) IsGeneric() bool {
     return e.generic != nil
 }
 
-func (e *Enum) SetElems(idType types.Type, elemNames []string, elemTypes []types.Type) {
+func (e *Enum) SetElems(ts *types.State, idType types.Type, elemNames []string, elemTypes []types.Type) {
     if e.IsGeneric() {
-        e.typ = types.CreateEnumType(e.name, idType, elemNames, elemTypes, e.generic.Typ.Name)
+        e.typ = ts.CreateEnumType(e.name, idType, elemNames, elemTypes, e.generic.Typ.Name)
     } else {
-        e.typ = types.CreateEnumType(e.name, idType, elemNames, elemTypes, "")
+        e.typ = ts.CreateEnumType(e.name, idType, elemNames, elemTypes, "")
     }
 }
 
@@ -18,10 +18,8 @@ type Func struct {
     isConst bool
 }
 
-var curFunc *Func = nil
-
-func GetCurFunc() *Func {
-    return curFunc
+func (state *State) GetCurFunc() *Func {
+    return state.curFunc
 }
 
 func CreateFunc(name token.Token, isConst bool, fnSrc types.Type, generic *Generic) Func {
@@ -32,8 +30,8 @@ func CreateFunc(name token.Token, isConst bool, fnSrc types.Type, generic *Gener
     return Func{ name: name.Str, decPos: name.Pos, isConst: isConst, FnSrc: fnSrc, typ: types.CreateFuncType(name.Str, types.GenericType{}) }
 }
 
-func CreateUnresolvedFunc(name string) Func {
-    return Func{ typ: types.CreateUnresolvedFuncType() }
+func (state *State) CreateUnresolvedFunc(name string) Func {
+    return Func{ typ: state.types.CreateUnresolvedFuncType() }
 }
 
 func (f *Func) GetArgs() []types.Type {
@@ -1,11 +1,9 @@
 package identObj
 
 import (
-	"fmt"
 	"gamma/token"
 	"gamma/types"
 	"gamma/types/addr"
-	"os"
 )
 
 type Generic struct {
@@ -31,9 +29,7 @@ func (g *Generic) GetType() types.Type {
 }
 
 func (g *Generic) Addr() addr.Addr {
-    fmt.Fprintln(os.Stderr, "[ERROR] (internal) Cannot get the addr of Generic (Generic are not allocated anywhere)")
-    os.Exit(1)
-    return addr.Addr{}
+    panic("(internal) Cannot get the addr of Generic (Generic are not allocated anywhere)")
 }
 
 func AddTypeToGeneric(generic *Generic, typ types.Type) {
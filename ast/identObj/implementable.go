@@ -41,14 +41,14 @@ func (impls *Implementations) create(idx uint64) *Implementable {
     return createImplementable(*impls, idx)
 }
 
-func GetImplementable(t types.Type, createIfMissing bool) *Implementable {
+func (state *State) GetImplementable(t types.Type, createIfMissing bool) *Implementable {
     implId := t.GetImplID()
 
     var impl *Implementable = nil
     if createIfMissing {
-        impl = globalScope.implObj.create(implId)
+        impl = state.globalScope.implObj.create(implId)
     } else {
-        impl = globalScope.implObj.get(implId)
+        impl = state.globalScope.implObj.get(implId)
         if impl == nil { return nil }
     }
 
@@ -78,7 +78,7 @@ func GetImplementable(t types.Type, createIfMissing bool) *Implementable {
         implId = t.BaseType.GetImplID()
 
     case types.InferType:
-        return GetImplementable(t.DefaultType, createIfMissing) 
+        return state.GetImplementable(t.DefaultType, createIfMissing) 
 
     default:
         return impl
@@ -136,34 +136,62 @@ func (s *Implementable) GetFuncNames() []string {
     return funcs
 }
 
-func HasFunc(t types.Type, name string) bool {
+func (state *State) HasFunc(t types.Type, name string) bool {
     if t == nil { return false }
 
     switch t := t.(type) {
     case *types.GenericType:
-        return HasFunc(t.Guard, name)
+        return state.HasFunc(t.Guard, name)
     case types.GenericType:
-        return HasFunc(t.Guard, name)
+        return state.HasFunc(t.Guard, name)
     case types.InterfaceType:
         return t.GetFunc(name) != nil
     }
 
-    implObj := GetImplementable(t, false)
+    implObj := state.GetImplementable(t, false)
     return implObj != nil && implObj.GetFunc(name) != nil
 }
 
-func HasInterface(t types.Type, name string) bool {
+// names of the functions which can be called on t (of every impl, for "did you mean")
+func (state *State) FuncNames(t types.Type) []string {
+    if t == nil { return nil }
+
+    switch t := t.(type) {
+    case *types.GenericType:
+        return state.FuncNames(t.Guard)
+    case types.GenericType:
+        return state.FuncNames(t.Guard)
+    case types.InterfaceType:
+        if i,ok := state.Get(t.Name).(*Interface); ok {
+            return i.GetFuncNames()
+        }
+        return nil
+    }
+
+    implObj := state.GetImplementable(t, false)
+    if implObj == nil { return nil }
+
+    var names []string
+    for _,i := range implObj.impls {
+        for name := range i.scope.identObjs {
+            names = append(names, name)
+        }
+    }
+    return names
+}
+
+func (state *State) HasInterface(t types.Type, name string) bool {
     if t == nil { return false }
 
     switch t := t.(type) {
     case *types.GenericType:
-        return HasInterface(t.Guard, name) 
+        return state.HasInterface(t.Guard, name) 
     case types.GenericType:
-        return HasInterface(t.Guard, name) 
+        return state.HasInterface(t.Guard, name) 
     case types.InterfaceType:
         return t.Name == name
     }
 
-    implObj := GetImplementable(t, false)
+    implObj := state.GetImplementable(t, false)
     return implObj != nil && implObj.HasInterface(name)
 }
@@ -1,7 +1,6 @@
 package identObj
 
 import (
-    "os"
     "fmt"
     "reflect"
     "gamma/token"
@@ -18,10 +17,17 @@ type Interface struct {
     funcs []Func
 }
 
-var CurSelfType types.Type = nil
+// type of the interface/impl currently parsed (nil outside of them)
+func (state *State) GetCurSelfType() types.Type {
+    return state.curSelfType
+}
+
+func (state *State) SetCurSelfType(t types.Type) {
+    state.curSelfType = t
+}
 
-func CreateInterface(name token.Token, generic *Generic) Interface {
-    interfaceType := types.CreateInterfaceType(name.Str)
+func (state *State) CreateInterface(name token.Token, generic *Generic) Interface {
+    interfaceType := state.types.CreateInterfaceType(name.Str)
     if generic != nil {
         interfaceType.Generic = generic.Typ
     }
@@ -40,10 +46,15 @@ func (i *Interface) GetPos() token.Pos {
     return i.decPos
 }
 
+// secondary position for errors about the interface (like "does not implement")
+func (state *State) NoteInterfaceDecl(name string) {
+    if i,ok := state.Get(name).(*Interface); ok && i.decPos.File != "" {
+        state.diag.NoteAt("interface declared here", i.decPos.At())
+    }
+}
+
 func (i *Interface) Addr() addr.Addr {
-    fmt.Fprintln(os.Stderr, "[ERROR] (internal) Cannot get the addr of an interface definition")
-    os.Exit(1)
-    return addr.Addr{}
+    panic("(internal) Cannot get the addr of an interface definition")
 }
 
 func (i *Interface) GetFunc(name string) *Func {
@@ -112,18 +123,18 @@ type Impl struct {
     scope *Scope
 }
 
-func CreateImpl(decPos token.Pos, interfaceType *types.InterfaceType, dstType types.Type, generic *Generic) Impl {
+func (state *State) CreateImpl(decPos token.Pos, interfaceType *types.InterfaceType, dstType types.Type, generic *Generic) Impl {
     if interfaceType != nil {
-        interface_,ok := Get(interfaceType.Name).(*Interface)
+        interface_,ok := state.Get(interfaceType.Name).(*Interface)
         if !ok {
-            fmt.Fprintf(os.Stderr, "[ERROR] (internal) interface %v is not defined correct\n", interfaceType)
-            fmt.Fprintln(os.Stderr, "\t" + decPos.At())
-            os.Exit(1)
+            state.diag.Errorf("(internal) interface %v is not defined correct", interfaceType)
+            state.diag.At(decPos.At())
+            state.diag.Exit()
         }
-        return Impl{ decPos: decPos, interface_: interface_, interfaceType: interfaceType, dstType: dstType, scope: curScope, generic: generic }
+        return Impl{ decPos: decPos, interface_: interface_, interfaceType: interfaceType, dstType: dstType, scope: state.curScope, generic: generic }
     }
 
-    return Impl{ decPos: decPos, interfaceType: interfaceType, dstType: dstType, scope: curScope, generic: generic }
+    return Impl{ decPos: decPos, interfaceType: interfaceType, dstType: dstType, scope: state.curScope, generic: generic }
 }
 
 func createImplFromGeneric(src types.Type, impl *Impl) Impl {
@@ -249,9 +260,7 @@ func (i *Impl) GetFunc(name string) *Func {
         if f,ok := obj.(*Func); ok {
             return f
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] (internal) the scope of Impl should only contain funcs but got %v\n", reflect.TypeOf(f))
-            fmt.Fprintln(os.Stderr, "\t" + i.decPos.At())
-            os.Exit(1)
+            panic(fmt.Sprintf("(internal) the scope of Impl should only contain funcs but got %v", reflect.TypeOf(f)))
         }
     }
 
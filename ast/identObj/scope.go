@@ -7,7 +7,6 @@ import (
 	"gamma/token"
 	"gamma/types"
 	"gamma/types/addr"
-	"os"
 )
 
 type Scope struct {
@@ -26,10 +25,6 @@ type ReservedSpace struct {
     typ types.Type
 }
 
-var globalScope = Scope{ identObjs: make(map[string]IdentObj), implObj: make(Implementations, 50), children: make([]Scope, 0, 50) }
-var curScope = &globalScope
-var stackSize uint = 0
-
 func (s *Scope) ArgsSize() uint {
     size := uint(0)
 
@@ -61,8 +56,7 @@ func (s *Scope) getInnerSize() uint {
 
 func (s *Scope) GetInnerSize() uint {
     if len(s.children) != 1 {
-        fmt.Fprintf(os.Stderr, "[ERROR] (internal) expected scope of function to have 1 child scope, but got %d\n", len(s.children))
-        os.Exit(1)
+        panic(fmt.Sprintf("(internal) expected scope of function to have 1 child scope, but got %d", len(s.children)))
     }
 
     size := s.children[0].getInnerSize()
@@ -71,27 +65,43 @@ func (s *Scope) GetInnerSize() uint {
     return (size + 15) & ^uint(15)
 }
 
-func InGlobalScope() bool {
-    return curScope.parent == nil
+func (state *State) InGlobalScope() bool {
+    return state.curScope.parent == nil
 }
 
-func StartScope() {
-    scope := Scope{ parent: curScope, identObjs: make(map[string]IdentObj), children: make([]Scope, 0) }
-    curScope.children = append(curScope.children, scope)
-    curScope = &curScope.children[len(curScope.children)-1]
+func (state *State) StartScope() {
+    scope := Scope{ parent: state.curScope, identObjs: make(map[string]IdentObj), children: make([]Scope, 0) }
+    state.curScope.children = append(state.curScope.children, scope)
+    state.curScope = &state.curScope.children[len(state.curScope.children)-1]
 }
 
-func EndScope() {
-    if !InGlobalScope() {
-        curScope = curScope.parent
+func (state *State) EndScope() {
+    if !state.InGlobalScope() {
+        state.curScope = state.curScope.parent
     }
 }
 
-func Get(name string) IdentObj {
-    scope := curScope
+// every identObj of the compilation (global scope first, then the inner scopes in order of declaration)
+func (state *State) Walk(f func(obj IdentObj, global bool)) {
+    walkScope(&state.globalScope, f)
+}
+
+func walkScope(s *Scope, f func(obj IdentObj, global bool)) {
+    for _,obj := range s.identObjs {
+        f(obj, s.parent == nil)
+    }
+
+    for i := range s.children {
+        walkScope(&s.children[i], f)
+    }
+}
+
+func (state *State) Get(name string) IdentObj {
+    scope := state.curScope
 
     for scope != nil {
         if f,ok := scope.identObjs[name]; ok {
+            state.used[f] = true
             return f
         }
 
@@ -101,25 +111,62 @@ func Get(name string) IdentObj {
     return nil
 }
 
-func GetFnFromFnSrc(fnSrc types.Type, fnName string) *Func {
+// true if obj was referenced by its name (every reference is looked up with Get)
+func (state *State) IsUsed(obj IdentObj) bool {
+    return state.used[obj]
+}
+
+// names visible in the current scope for which keep returns true (all with nil), for "did you mean"
+func (state *State) VisibleNames(keep func(obj IdentObj) bool) []string {
+    var names []string
+    for scope := state.curScope; scope != nil; scope = scope.parent {
+        for name,obj := range scope.identObjs {
+            if keep == nil || keep(obj) {
+                names = append(names, name)
+            }
+        }
+    }
+
+    return names
+}
+
+func IsFunc(obj IdentObj) bool {
+    _,ok := obj.(*Func)
+    return ok
+}
+
+func IsEnum(obj IdentObj) bool {
+    _,ok := obj.(*Enum)
+    return ok
+}
+
+func IsType(obj IdentObj) bool {
+    switch obj.(type) {
+    case *Struct, *Enum, *Interface, *Generic:
+        return true
+    }
+    return false
+}
+
+func (state *State) GetFnFromFnSrc(fnSrc types.Type, fnName string) *Func {
     switch src := fnSrc.(type) {
     case types.InterfaceType:
-        if obj,ok := Get(src.String()).(*Interface); ok {
+        if obj,ok := state.Get(src.String()).(*Interface); ok {
             return obj.GetFunc(fnName)
         }
 
     default:
-        if obj := GetImplementable(src, false); obj != nil {
+        if obj := state.GetImplementable(src, false); obj != nil {
             if f := obj.GetFunc(fnName); f != nil {
                 return f
             }
         }
 
-        if obj := GetImplementable(types.GenericType{}, false); obj != nil {
+        if obj := state.GetImplementable(types.GenericType{}, false); obj != nil {
             if i := obj.GetImplByFnName(fnName); i != nil {
                 impl := createImplFromGeneric(src, i)
 
-                obj := GetImplementable(src, true)
+                obj := state.GetImplementable(src, true)
                 obj.AddImpl(impl)
 
                 return obj.GetFunc(fnName)
@@ -130,16 +177,20 @@ func GetFnFromFnSrc(fnSrc types.Type, fnName string) *Func {
     return nil
 }
 
-func GetStackSize() uint {
-    return stackSize
+func (state *State) GetStackSize() uint {
+    return state.stackSize
+}
+
+func (state *State) IncStackSize(t types.Type) {
+    state.stackSize += t.Size()
 }
 
-func IncStackSize(t types.Type) {
-    stackSize += t.Size()
+func (state *State) SetStackSize(size uint) {
+    state.stackSize = size
 }
 
-func ResetStackSize() {
-    stackSize = 0
+func (state *State) ResetStackSize() {
+    state.stackSize = 0
 }
 
 func (scope *Scope) nameTaken(name string) bool {
@@ -151,28 +202,31 @@ func (scope *Scope) nameTaken(name string) bool {
 }
 
 
-func (scope *Scope) checkName(name token.Token) {
-    if name.Str[0] == '_' {
-        fmt.Fprintln(os.Stderr, "[ERROR] names starting with \"_\" are reserved for the compiler")
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+func (state *State) checkName(scope *Scope, name token.Token) {
+    if name.Str[0] == '_' && !state.allowReserved {
+        state.diag.Error("names starting with \"_\" are reserved for the compiler")
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
 
     if scope.nameTaken(name.Str) {
-        fmt.Fprintf(os.Stderr, "[ERROR] name \"%s\" is already taken in this scope\n", name.Str)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("name \"%s\" is already taken in this scope", name.Str)
+        state.diag.At(name.At())
+        if pos := scope.identObjs[name.Str].GetPos(); pos.File != "" {
+            state.diag.NoteAt("first defined here", pos.At())
+        }
+        state.diag.Exit()
     }
 }
 
-func AddBuildIn(name string, argtype types.Type, retType types.Type) {
+func (state *State) AddBuildIn(name string, argtype types.Type, retType types.Type) {
     f := CreateFunc(token.Token{ Str: name }, false, nil, nil)  
     f.SetRetType(retType)
     f.SetArgs([]types.Type{ argtype })
-    globalScope.identObjs[name] = &f
+    state.globalScope.identObjs[name] = &f
 }
 
-func AddGenBuildIn(name string, genericName string, argtype types.Type, retType types.Type) {
+func (state *State) AddGenBuildIn(name string, genericName string, argtype types.Type, retType types.Type) {
     gen := Generic{ Typ: types.CreateGeneric(genericName, types.InterfaceType{}) }
 
     f := CreateFunc(token.Token{ Str: name }, false, nil, &gen)
@@ -180,138 +234,170 @@ func AddGenBuildIn(name string, genericName string, argtype types.Type, retType
     if argtype != nil {
         f.SetArgs([]types.Type{ argtype })
     }
-    globalScope.identObjs[name] = &f
+    state.globalScope.identObjs[name] = &f
 }
 
+// generic build-in func with two args of the generic type which returns the generic type
+func (state *State) AddGenArithBuildIn(name string, genericName string) {
+    gen := Generic{ Typ: types.CreateGeneric(genericName, types.InterfaceType{}) }
+
+    f := CreateFunc(token.Token{ Str: name }, false, nil, &gen)
+    f.SetRetType(gen.Typ)
+    f.SetArgs([]types.Type{ gen.Typ, gen.Typ })
+    state.globalScope.identObjs[name] = &f
+}
 
-func DecVar(name token.Token, t types.Type) vars.Var {
-    if name.Type == token.UndScr && !InGlobalScope() {
-        return createUnnamedVar(t)
+
+func (state *State) DecVar(name token.Token, t types.Type) vars.Var {
+    if name.Type == token.UndScr && !state.InGlobalScope() {
+        return state.createUnnamedVar(t)
     }
 
-    curScope.checkName(name)
+    state.checkName(state.curScope, name)
 
-    if InGlobalScope() {
+    if state.InGlobalScope() {
         v := vars.CreateGlobalVar(name, t)
-        curScope.identObjs[name.Str] = &v
+        state.curScope.identObjs[name.Str] = &v
         return &v
     } else {
         v := vars.CreateLocal(name, t)
-        curScope.identObjs[name.Str] = &v
-        reuseSpace(&v)
+        state.curScope.identObjs[name.Str] = &v
+        state.reuseSpace(&v)
         return &v
     }
 }
 
-func DecConst(name token.Token, t types.Type, val constVal.ConstVal) *Const {
-    curScope.checkName(name)
+func (state *State) DecConst(name token.Token, t types.Type, val constVal.ConstVal) *Const {
+    state.checkName(state.curScope, name)
 
     c := CreateConst(name, t, val)
-    curScope.identObjs[name.Str] = &c
+    state.curScope.identObjs[name.Str] = &c
     return &c
 }
 
-func DecFunc(name token.Token, isConst bool, fnSrc types.Type, generic *Generic) *Func {
-    curScope.parent.checkName(name)
+func (state *State) DecFunc(name token.Token, isConst bool, fnSrc types.Type, generic *Generic) *Func {
+    state.checkName(state.curScope.parent, name)
 
     f := CreateFunc(name, isConst, fnSrc, generic)
-    f.Scope = curScope
+    f.Scope = state.curScope
 
-    curScope.parent.identObjs[name.Str] = &f
-    curFunc = &f
+    state.curScope.parent.identObjs[name.Str] = &f
+    state.curFunc = &f
 
-    return curFunc
+    return state.curFunc
 }
 
-func DecInterface(name token.Token, generic *Generic) *Interface {
-    curScope.parent.checkName(name)
+func (state *State) DecInterface(name token.Token, generic *Generic) *Interface {
+    state.checkName(state.curScope.parent, name)
 
-    I := CreateInterface(name, generic)
-    I.scope = curScope
+    I := state.CreateInterface(name, generic)
+    I.scope = state.curScope
 
-    curScope.parent.identObjs[name.Str] = &I
+    state.curScope.parent.identObjs[name.Str] = &I
 
     return &I
 }
 
-func DecStruct(name token.Token, generic *Generic) *Struct {
-    curScope.checkName(name)
+func (state *State) DecStruct(name token.Token, generic *Generic) *Struct {
+    state.checkName(state.curScope, name)
 
     s := CreateStruct(name, generic)
-    curScope.parent.identObjs[name.Str] = &s
+    state.curScope.parent.identObjs[name.Str] = &s
     return &s
 }
 
-func DecEnum(name token.Token, generic *Generic) *Enum {
-    curScope.checkName(name)
+func (state *State) DecEnum(name token.Token, generic *Generic) *Enum {
+    state.checkName(state.curScope, name)
 
     e := CreateEnum(name, generic)
-    curScope.parent.identObjs[name.Str] = &e
+    state.curScope.parent.identObjs[name.Str] = &e
     return &e
 }
 
-func DecGeneric(name token.Token, guardType types.InterfaceType) *Generic {
-    curScope.checkName(name)
+func (state *State) DecGeneric(name token.Token, guardType types.InterfaceType) *Generic {
+    state.checkName(state.curScope, name)
 
     g := CreateGeneric(name, guardType)
-    curScope.identObjs[name.Str] = &g
+    state.curScope.identObjs[name.Str] = &g
     return &g
 }
 
-func ReserveSpace(t types.Type) *addr.Addr {
+func (state *State) ReserveSpace(t types.Type) *addr.Addr {
     if types.IsBigStruct(t) {
-        if curScope.lastReserved != nil && !curScope.lastReserved.used {
-            if curScope.lastReserved.typ.Size() < t.Size() {
-                curScope.lastReserved = &ReservedSpace{ used: false, typ: t }
-                curScope.reservedSpace += t.Size() - curScope.lastReserved.typ.Size()
+        if state.curScope.lastReserved != nil && !state.curScope.lastReserved.used {
+            if state.curScope.lastReserved.typ.Size() < t.Size() {
+                state.curScope.lastReserved = &ReservedSpace{ used: false, typ: t }
+                state.curScope.reservedSpace += t.Size() - state.curScope.lastReserved.typ.Size()
             }
 
-            return &curScope.lastReserved.address
+            return &state.curScope.lastReserved.address
         }
 
-        curScope.lastReserved = &ReservedSpace{ used: false, typ: t }
-        curScope.reservedSpace += t.Size()
-        return &curScope.lastReserved.address
+        state.curScope.lastReserved = &ReservedSpace{ used: false, typ: t }
+        state.curScope.reservedSpace += t.Size()
+        return &state.curScope.lastReserved.address
     }
 
     return nil
 }
 
-func AllocReservedSpaceIfNeeded(t types.Type, reservedSpace *addr.Addr) {
+func (state *State) AllocReservedSpaceIfNeeded(t types.Type, reservedSpace *addr.Addr) {
     if reservedSpace.BaseAddr == "" {
-        IncStackSize(t)
-        *reservedSpace = addr.Addr{ BaseAddr: "rbp", Offset: -int64(stackSize) }
+        state.IncStackSize(t)
+        *reservedSpace = addr.Addr{ BaseAddr: "rbp", Offset: -int64(state.stackSize) }
     }
 }
 
-func reuseSpace(v vars.Var) {
-    if curScope.lastReserved == nil {
+func (state *State) reuseSpace(v vars.Var) {
+    if state.curScope.lastReserved == nil {
         return
     }
 
-    if types.Equal(v.GetType(), curScope.lastReserved.typ) {
-        curScope.reservedSpace -= v.GetType().Size()
-        curScope.lastReserved.used = true
-        curScope.lastReserved.address = v.Addr()
+    if types.Equal(v.GetType(), state.curScope.lastReserved.typ) {
+        state.curScope.reservedSpace -= v.GetType().Size()
+        state.curScope.lastReserved.used = true
+        state.curScope.lastReserved.address = v.Addr()
     }
 }
 
-func createUnnamedVar(t types.Type) vars.Var {
+func (state *State) createUnnamedVar(t types.Type) vars.Var {
     if types.IsBigStruct(t) {
-        name := fmt.Sprintf("_%d", curScope.unnamedVars)
-        curScope.unnamedVars += 1
+        name := fmt.Sprintf("_%d", state.curScope.unnamedVars)
+        state.curScope.unnamedVars += 1
 
         v := vars.CreateLocal(token.Token{ Str: name }, t)
-        curScope.identObjs[name] = &v
+        state.curScope.identObjs[name] = &v
         return &v
     } else {
         name := "_"
         v := vars.CreateLocal(token.Token{ Str: name }, t)
 
-        if obj,ok := curScope.identObjs[name]; !ok || obj.GetType().Size() < t.Size() {
-            curScope.identObjs[name] = &v
+        if obj,ok := state.curScope.identObjs[name]; !ok || obj.GetType().Size() < t.Size() {
+            state.curScope.identObjs[name] = &v
         }
 
         return &v
     }
 }
+
+// calls f for every identObj of a local scope whose name is declared in a scope around it too
+func (state *State) WalkShadowed(f func(obj IdentObj, shadowed IdentObj)) {
+    walkShadowed(&state.globalScope, f)
+}
+
+func walkShadowed(s *Scope, f func(obj IdentObj, shadowed IdentObj)) {
+    if s.parent != nil {
+        for name,obj := range s.identObjs {
+            for outer := s.parent; outer != nil; outer = outer.parent {
+                if shadowed,ok := outer.identObjs[name]; ok {
+                    f(obj, shadowed)
+                    break
+                }
+            }
+        }
+    }
+
+    for i := range s.children {
+        walkShadowed(&s.children[i], f)
+    }
+}
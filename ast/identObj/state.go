@@ -0,0 +1,31 @@
+package identObj
+
+import (
+    "gamma/types"
+    "gamma/diag"
+)
+
+// all scopes of one compilation (see gamma/compiler)
+type State struct {
+    globalScope Scope
+    curScope *Scope
+    stackSize uint
+    curFunc *Func
+    curSelfType types.Type
+    allowReserved bool      // declaring names starting with "_" (buildin.gma, test runner)
+    used map[IdentObj]bool  // looked up by name at least once (see Get)
+
+    diag *diag.State
+    types *types.State
+}
+
+func NewState(diag *diag.State, types *types.State) *State {
+    s := &State{ globalScope: Scope{ identObjs: make(map[string]IdentObj), implObj: make(Implementations, 50), children: make([]Scope, 0, 50) }, used: make(map[IdentObj]bool), diag: diag, types: types }
+    s.curScope = &s.globalScope
+    return s
+}
+
+// names starting with "_" are only allowed in the code generated/provided by the compiler
+func (state *State) AllowReserved(allow bool) {
+    state.allowReserved = allow
+}
@@ -1,8 +1,6 @@
 package identObj
 
 import (
-    "os"
-    "fmt"
     "gamma/token"
     "gamma/types"
     "gamma/types/addr"
@@ -28,9 +26,7 @@ func (s *Struct) GetPos() token.Pos {
 }
 
 func (s *Struct) Addr() addr.Addr {
-    fmt.Fprintln(os.Stderr, "[ERROR] Cannot get the addr of a struct type definition (not allocated anywhere)")
-    os.Exit(1)
-    return addr.Addr{}
+    panic("(internal) Cannot get the addr of a struct type definition (not allocated anywhere)")
 }
 
 func (s *Struct) resolveRecursiveField_(t types.PtrType) types.Type {
@@ -55,11 +51,11 @@ func (s *Struct) resolveRecursiveField() {
     }
 }
 
-func (s *Struct) SetFields(fieldNames []string, fieldTypes []types.Type) {
+func (s *Struct) SetFields(ts *types.State, fieldNames []string, fieldTypes []types.Type) {
     if s.IsGeneric() {
-        s.typ = types.CreateStructType(s.name, fieldTypes, fieldNames, s.generic.Typ.Name)
+        s.typ = ts.CreateStructType(s.name, fieldTypes, fieldNames, s.generic.Typ.Name)
     } else {
-        s.typ = types.CreateStructType(s.name, fieldTypes, fieldNames, "")
+        s.typ = ts.CreateStructType(s.name, fieldTypes, fieldNames, "")
     }
 
     s.resolveRecursiveField()
@@ -30,6 +30,11 @@ func (v *GlobalVar) GetPos() token.Pos {
     return v.decPos
 }
 
+// globals are always mutable
+func (v *GlobalVar) IsMut() bool {
+    return true
+}
+
 func (v *GlobalVar) GetType() types.Type {
     return v.typ
 }
@@ -12,6 +12,7 @@ type LocalVar struct {
     name string
     typ types.Type
     addr addr.Addr
+    mut bool        // declared with mut (see check/mut.go)
 }
 
 func CreateLocal(name token.Token, t types.Type) LocalVar {
@@ -34,6 +35,14 @@ func (v *LocalVar) GetType() types.Type {
     return v.typ
 }
 
+func (v *LocalVar) IsMut() bool {
+    return v.mut
+}
+
+func (v *LocalVar) SetMut() {
+    v.mut = true
+}
+
 func (v *LocalVar) Addr() addr.Addr {
     return v.addr
 }
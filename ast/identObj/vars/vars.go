@@ -12,6 +12,7 @@ type Var interface {
     GetName() string
     GetPos() token.Pos
     String() string
+    IsMut() bool
     ResolveType(t types.Type)
     SetAddr(addr addr.Addr)
 }
@@ -1,8 +1,6 @@
 package ast
 
 import (
-    "os"
-    "fmt"
     "strings"
     "gamma/token"
     "gamma/ast/identObj"
@@ -221,9 +219,7 @@ func (o *DeclStmt) Readable(indent int) string {
 }
 
 func (o *BadStmt) Readable(indent int) string {
-    fmt.Fprintln(os.Stderr, "[ERROR] bad statement")
-    os.Exit(1)
-    return ""
+    panic("(internal) bad statement")
 }
 
 
@@ -0,0 +1,192 @@
+package ast
+
+import (
+    "gamma/token"
+    "gamma/types"
+)
+
+// calls f for n and (if f returns true) for the nodes in n (depth first in source order)
+func Inspect(n Node, f func(Node) bool) {
+    if n == nil || !f(n) {
+        return
+    }
+
+    switch n := n.(type) {
+    case *DefVar:
+        inspectExpr(n.Value, f)
+    case *DefConst:
+        inspectExpr(n.Value, f)
+    case *DefFn:
+        for i := range n.FnHead.Args {
+            Inspect(&n.FnHead.Args[i], f)
+        }
+        Inspect(&n.Block, f)
+    case *DefStruct:
+        for i := range n.Fields {
+            Inspect(&n.Fields[i], f)
+        }
+    case *Impl:
+        for i := range n.FnDefs {
+            Inspect(&n.FnDefs[i], f)
+        }
+    case *Import:
+        for _,d := range n.Decls {
+            Inspect(d, f)
+        }
+
+    case *DeclStmt:
+        Inspect(n.Decl, f)
+    case *ExprStmt:
+        inspectExpr(n.Expr, f)
+    case *Assign:
+        inspectExpr(n.Dest, f)
+        inspectExpr(n.Value, f)
+    case *Block:
+        for _,s := range n.Stmts {
+            Inspect(s, f)
+        }
+    case *If:
+        inspectIf(n, f)
+    case *Elif:
+        inspectIf((*If)(n), f)
+    case *Else:
+        Inspect(&n.Block, f)
+    case *Switch:
+        for i := range n.Cases {
+            Inspect(&n.Cases[i], f)
+        }
+    case *Case:
+        inspectExpr(n.Cond, f)
+        Inspect(n.Stmt, f)
+    case *While:
+        if n.Def != nil {
+            Inspect(n.Def, f)
+        }
+        inspectExpr(n.Cond, f)
+        Inspect(&n.Block, f)
+    case *For:
+        Inspect(&n.Def, f)
+        inspectExpr(n.Limit, f)
+        inspectExpr(n.Step, f)
+        Inspect(&n.Block, f)
+    case *Ret:
+        inspectExpr(n.RetExpr, f)
+
+    case *FnCall:
+        Inspect(&n.Ident, f)
+        for _,v := range n.Values {
+            inspectExpr(v, f)
+        }
+    case *ArrayLit:
+        for _,v := range n.Values {
+            inspectExpr(v, f)
+        }
+    case *VectorLit:
+        inspectExpr(n.Cap, f)
+        inspectExpr(n.Len, f)
+    case *StructLit:
+        for i := range n.Fields {
+            Inspect(&n.Fields[i], f)
+        }
+    case *FieldLit:
+        inspectExpr(n.Value, f)
+    case *EnumLit:
+        if n.Content != nil {
+            Inspect(n.Content, f)
+        }
+    case *Unwrap:
+        inspectExpr(n.SrcExpr, f)
+    case *Indexed:
+        inspectExpr(n.ArrExpr, f)
+        inspectExpr(n.Index, f)
+    case *Field:
+        inspectExpr(n.Obj, f)
+    case *Unary:
+        inspectExpr(n.Operand, f)
+    case *Binary:
+        inspectExpr(n.OperandL, f)
+        inspectExpr(n.OperandR, f)
+    case *Paren:
+        inspectExpr(n.Expr, f)
+    case *XSwitch:
+        for i := range n.Cases {
+            Inspect(&n.Cases[i], f)
+        }
+    case *XCase:
+        inspectExpr(n.Cond, f)
+        inspectExpr(n.Expr, f)
+    case *Cast:
+        inspectExpr(n.Expr, f)
+    }
+}
+
+// Expr fields can be nil
+func inspectExpr(e Expr, f func(Node) bool) {
+    if e != nil {
+        Inspect(e, f)
+    }
+}
+
+func inspectIf(n *If, f func(Node) bool) {
+    inspectExpr(n.Cond, f)
+    Inspect(&n.Block, f)
+    if n.Elif != nil {
+        Inspect(n.Elif, f)
+    }
+    if n.Else != nil {
+        Inspect(n.Else, f)
+    }
+}
+
+// the expressions whose values become (part of) the value of e
+// (like the fields of a struct lit or the cases of an xswitch)
+func ValueParts(e Expr) []Expr {
+    switch e := e.(type) {
+    case *Paren:
+        return ValueParts(e.Expr)
+    case *Cast:
+        return ValueParts(e.Expr)
+    case *StructLit:
+        var res []Expr
+        for _,f := range e.Fields {
+            res = append(res, ValueParts(f.Value)...)
+        }
+        return res
+    case *EnumLit:
+        if e.Content != nil {
+            return ValueParts(e.Content)
+        }
+        return nil
+    case *XSwitch:
+        var res []Expr
+        for _,c := range e.Cases {
+            res = append(res, ValueParts(c.Expr)...)
+        }
+        return res
+    case *Binary:
+        // pointer arithmetic
+        if _,ok := e.Type.(types.PtrType); ok {
+            return append(ValueParts(e.OperandL), ValueParts(e.OperandR)...)
+        }
+    }
+
+    return []Expr{ e }
+}
+
+// the compares of a case condition ("1, 2: ..." becomes "base == 1 || base == 2")
+// nil if one part is not a binary expr
+func FlattenOr(cond Expr) []*Binary {
+    b,ok := cond.(*Binary)
+    if !ok {
+        return nil
+    }
+    if b.Operator.Type != token.Or {
+        return []*Binary{ b }
+    }
+
+    l, r := FlattenOr(b.OperandL), FlattenOr(b.OperandR)
+    if l == nil || r == nil {
+        return nil
+    }
+    return append(l, r...)
+}
@@ -1,12 +1,16 @@
 package buildin
 
 import (
+    _ "embed"
     "fmt"
     "bufio"
     "gamma/types"
-    "gamma/ast/identObj"
 )
 
+// used if buildin.gma cannot be found next to the import dir
+//go:embed buildin.gma
+var Src string
+
 const SYS_WRITE = 1
 const SYS_MMAP  = 9
 const SYS_EXIT  = 60
@@ -19,45 +23,81 @@ const PROT_WRITE    = 2
 const MAP_ANONYMOUS = 0x20
 const MAP_PRIVATE   = 2
 
+var ArithBuildIns []string = []string{
+    "wrapping_add", "wrapping_sub", "wrapping_mul", "saturating_add", "saturating_sub",
+}
+
+func IsArith(name string) bool {
+    for _,n := range ArithBuildIns {
+        if n == name {
+            return true
+        }
+    }
+
+    return false
+}
 
-func Declare() {
+func (state *State) Declare() {
     // build-in funcs
-    identObj.AddBuildIn("print", types.StrType{}, nil)
-    identObj.AddBuildIn("println", types.StrType{}, nil)
-    identObj.AddBuildIn("eprint", types.StrType{}, nil)
-    identObj.AddBuildIn("eprintln", types.StrType{}, nil)
+    state.identObj.AddBuildIn("print", types.StrType{}, nil)
+    state.identObj.AddBuildIn("println", types.StrType{}, nil)
+    state.identObj.AddBuildIn("eprint", types.StrType{}, nil)
+    state.identObj.AddBuildIn("eprintln", types.StrType{}, nil)
 
-    identObj.AddBuildIn("exit", types.CreateInt(types.I32_Size), nil)
+    state.identObj.AddBuildIn("exit", types.CreateInt(types.I32_Size), nil)
+    state.identObj.AddBuildIn("assert", types.BoolType{}, nil)    // replaced by _assert (buildin.gma) in the parser
 
-    identObj.AddBuildIn("itos", types.CreateInt(types.I64_Size), types.StrType{})
-    identObj.AddBuildIn("utos", types.CreateUint(types.U64_Size), types.StrType{})
-    identObj.AddBuildIn("btos", types.BoolType{}, types.StrType{})
-    identObj.AddBuildIn("ctos", types.CharType{}, types.StrType{})
-    identObj.AddBuildIn("from_cstr", types.PtrType{ BaseType: types.CharType{} }, types.StrType{})
+    state.identObj.AddBuildIn("itos", types.CreateInt(types.I64_Size), types.StrType{})
+    state.identObj.AddBuildIn("utos", types.CreateUint(types.U64_Size), types.StrType{})
+    state.identObj.AddBuildIn("btos", types.BoolType{}, types.StrType{})
+    state.identObj.AddBuildIn("ctos", types.CharType{}, types.StrType{})
+    state.identObj.AddBuildIn("from_cstr", types.PtrType{ BaseType: types.CharType{} }, types.StrType{})
 
-    identObj.AddBuildIn("fmt", nil, types.StrType{})
-    identObj.AddGenBuildIn("sizeof", "T", nil, types.CreateUint(types.Ptr_Size))
+    state.identObj.AddBuildIn("fmt", nil, types.StrType{})
+    state.identObj.AddGenBuildIn("sizeof", "T", nil, types.CreateUint(types.Ptr_Size))
+
+    // arithmetic without overflow checks (see -check-overflow)
+    for _,name := range ArithBuildIns {
+        state.identObj.AddGenArithBuildIn(name, "T")
+    }
 
     // basic inline assembly
-    identObj.AddBuildIn("_asm", types.StrType{}, nil)
-    identObj.AddBuildIn("_syscall", types.CreateInt(types.I64_Size), types.CreateInt(types.I64_Size))
+    state.identObj.AddBuildIn("_asm", types.StrType{}, nil)
+    state.identObj.AddBuildIn("_syscall", types.CreateInt(types.I64_Size), types.CreateInt(types.I64_Size))
 }
 
-func Define(file *bufio.Writer) {
-    definePrint(file)
-    definePrintln(file)
-    defineEprint(file)
-    defineEprintln(file)
-
-    defineStrCmp(file)
-    defineStrConcat(file)
-
-    defineFromCStr(file)
-    defineItoS(file)
-    defineBtoS(file)
-    defineCtoS(file)
+// asm build-ins calling other build-ins (malloc is always generated)
+var Deps map[string][]string = map[string][]string{
+    "println": { "print" },
+    "eprintln": { "eprint" },
+    "itos": { "utos" },     // jumps to utos for positive values
+}
 
-    defineExit(file)
+// only the build-ins for which used returns true
+func (state *State) Define(file *bufio.Writer, used func(name string) bool) {
+    defines := []struct{ name string; define func(*bufio.Writer) }{
+        { "print", definePrint },
+        { "println", definePrintln },
+        { "eprint", defineEprint },
+        { "eprintln", defineEprintln },
+
+        { "_str_cmp", defineStrCmp },
+        { "_str_concat", defineStrConcat },
+
+        { "from_cstr", defineFromCStr },
+        { "utos", defineUtoS },
+        { "itos", defineItoS },
+        { "btos", state.defineBtoS },
+        { "ctos", defineCtoS },
+
+        { "exit", defineExit },
+    }
+
+    for _,d := range defines {
+        if used(d.name) {
+            d.define(file)
+        }
+    }
     file.WriteString("\n")
 }
 
@@ -131,7 +171,10 @@ func defineCtoS(asm *bufio.Writer) {
 }
 
 // TODO malloc and copy
-func defineBtoS(asm *bufio.Writer) {
+func (state *State) defineBtoS(asm *bufio.Writer) {
+    state.nasm.AddRodata("_true: db \"true\"")
+    state.nasm.AddRodata("_false: db \"false\"")
+
     asm.WriteString(
 `btos:
     test edi, edi
@@ -146,8 +189,8 @@ func defineBtoS(asm *bufio.Writer) {
 `)
 }
 
-func defineItoS(asm *bufio.Writer) {
- // max 64bit -> 20 digits max + sign -> 21 char string max
+func defineUtoS(asm *bufio.Writer) {
+ // max 64bit -> 20 digits max (21 bytes like itos)
     asm.WriteString(
 `utos:
     mov rbx, rdi
@@ -169,7 +212,13 @@ func defineItoS(asm *bufio.Writer) {
     sub rdx, rbx
     mov rax, rbx
     ret
-itos:
+`)
+}
+
+func defineItoS(asm *bufio.Writer) {
+ // max 64bit -> 20 digits max + sign -> 21 char string max
+    asm.WriteString(
+`itos:
     test rdi, rdi
     jge utos
     mov rbx, rdi
@@ -0,0 +1,16 @@
+package buildin
+
+import (
+    "gamma/ast/identObj"
+    "gamma/gen/asm/x86_64/nasm"
+)
+
+// the states used to declare and define the build-ins (see gamma/compiler)
+type State struct {
+    identObj *identObj.State
+    nasm *nasm.State
+}
+
+func NewState(identObj *identObj.State, nasm *nasm.State) *State {
+    return &State{ identObj: identObj, nasm: nasm }
+}
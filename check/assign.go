@@ -0,0 +1,295 @@
+package check
+
+import (
+    "strings"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+)
+
+/*
+definite assignment of vars declared without a value ("x i32") or with an empty struct lit ("p := P{}"):
+  * every read of the var (or of one of its fields) needs an assignment before it on every path
+  * if/elif/else and switch: assigned after it if assigned in every branch which does not end (ret, break, ...)
+  * loops: the body can run zero times (assignments in it do not count after the loop)
+  * taking the address ("&x") counts as an assignment (the var can be set through the pointer)
+*/
+
+type assignKey struct {
+    obj identObj.IdentObj
+    path string     // "" for the var, "x" or "x.y" for (nested) fields
+}
+
+type assignState struct {
+    assigned map[assignKey]bool
+    dead bool       // ended with ret, break, continue, through or exit (unreachable)
+}
+
+func (state *State) checkAssigned(d *ast.DefFn) {
+    state.tracked = make(map[identObj.IdentObj]token.Pos)
+    defer func() { state.tracked = nil }()
+
+    state.assignStmt(&d.Block, &assignState{ assigned: make(map[assignKey]bool) })
+}
+
+func (s *assignState) copy() *assignState {
+    res := &assignState{ assigned: make(map[assignKey]bool, len(s.assigned)), dead: s.dead }
+    for k := range s.assigned {
+        res.assigned[k] = true
+    }
+    return res
+}
+
+// assigned after a or b (a can be nil)
+func mergeAssigned(a *assignState, b *assignState) *assignState {
+    if a == nil || a.dead {
+        return b
+    }
+    if b.dead {
+        return a
+    }
+
+    res := &assignState{ assigned: make(map[assignKey]bool) }
+    for k := range a.assigned {
+        if b.assigned[k] {
+            res.assigned[k] = true
+        }
+    }
+    return res
+}
+
+func (state *State) assignStmt(s ast.Stmt, st *assignState) {
+    switch s := s.(type) {
+    case *ast.Block:
+        for _,s := range s.Stmts {
+            if st.dead {
+                break
+            }
+            state.assignStmt(s, st)
+        }
+
+    case *ast.DeclStmt:
+        switch d := s.Decl.(type) {
+        case *ast.DecVar:
+            state.tracked[d.V] = d.V.GetPos()
+        case *ast.DefVar:
+            state.assignExpr(d.Value, st)
+            if lit,ok := d.Value.(*ast.StructLit); ok && len(lit.Fields) == 0 && len(lit.StructType.Types) > 0 {
+                state.tracked[d.V] = d.V.GetPos()
+            }
+        case *ast.DefConst:
+            state.assignExpr(d.Value, st)
+        }
+
+    case *ast.ExprStmt:
+        state.assignExpr(s.Expr, st)
+        if f,ok := s.Expr.(*ast.FnCall); ok && f.Ident.Name == "exit" {
+            st.dead = true
+        }
+
+    case *ast.Assign:
+        state.assignExpr(s.Value, st)
+        state.assignDest(s.Dest, st)
+
+    case *ast.If:
+        state.assignIf(s, st)
+
+    case *ast.Switch:
+        pre := st.copy()
+        var res *assignState
+        hasDefault := false
+        for _,c := range s.Cases {
+            if c.Cond == nil {
+                hasDefault = true
+            }
+            state.assignExpr(c.Cond, pre)
+
+            // a case after through can be entered directly too (starts with pre)
+            caseSt := pre.copy()
+            state.assignStmt(c.Stmt, caseSt)
+            res = mergeAssigned(res, caseSt)
+        }
+        if !hasDefault {
+            res = mergeAssigned(res, pre)
+        }
+        *st = *res
+
+    case *ast.While:
+        if s.Def != nil {
+            state.assignExpr(s.Def.Value, st)
+        }
+        state.assignExpr(s.Cond, st)
+        state.assignStmt(&s.Block, st.copy())
+
+    case *ast.For:
+        state.assignExpr(s.Def.Value, st)
+        state.assignExpr(s.Limit, st)
+        state.assignExpr(s.Step, st)
+        state.assignStmt(&s.Block, st.copy())
+
+    case *ast.Ret:
+        state.assignExpr(s.RetExpr, st)
+        st.dead = true
+
+    case *ast.Break, *ast.Continue, *ast.Through:
+        st.dead = true
+    }
+}
+
+func (state *State) assignIf(s *ast.If, st *assignState) {
+    state.assignExpr(s.Cond, st)
+
+    thenSt := st.copy()
+    state.assignStmt(&s.Block, thenSt)
+
+    elseSt := st.copy()
+    switch {
+    case s.Elif != nil:
+        state.assignIf((*ast.If)(s.Elif), elseSt)
+    case s.Else != nil:
+        state.assignStmt(&s.Else.Block, elseSt)
+    }
+
+    *st = *mergeAssigned(thenSt, elseSt)
+}
+
+func (state *State) assignDest(dest ast.Expr, st *assignState) {
+    switch d := dest.(type) {
+    case *ast.Ident:
+        if _,ok := state.tracked[d.Obj]; ok {
+            st.assigned[assignKey{ d.Obj, "" }] = true
+            return
+        }
+    case *ast.Field:
+        if obj, path, ok := state.fieldPath(d); ok {
+            st.assigned[assignKey{ obj, path }] = true
+            return
+        }
+    }
+
+    // indexed, deref, field of a pointer, ...
+    state.assignExpr(dest, st)
+}
+
+// reads in e (nil is allowed)
+func (state *State) assignExpr(e ast.Expr, st *assignState) {
+    if e == nil || st.dead {
+        return
+    }
+
+    ast.Inspect(e, func(n ast.Node) bool {
+        switch n := n.(type) {
+        case *ast.Ident:
+            if _,ok := state.tracked[n.Obj]; ok {
+                state.requireAssigned(n.Obj, "", n.Obj.GetType(), n.At(), st)
+            }
+            return false
+
+        case *ast.Field:
+            if obj, path, ok := state.fieldPath(n); ok {
+                state.requireAssigned(obj, path, n.GetType(), n.At(), st)
+                return false
+            }
+
+        case *ast.Unary:
+            if n.Operator.Type != token.Amp {
+                return true
+            }
+            switch o := n.Operand.(type) {
+            case *ast.Ident:
+                if _,ok := state.tracked[o.Obj]; ok {
+                    st.assigned[assignKey{ o.Obj, "" }] = true
+                    return false
+                }
+            case *ast.Field:
+                if obj, path, ok := state.fieldPath(o); ok {
+                    st.assigned[assignKey{ obj, path }] = true
+                    return false
+                }
+            }
+        }
+
+        return true
+    })
+}
+
+// field (of a field ...) of a tracked var (not through a pointer)
+func (state *State) fieldPath(e *ast.Field) (obj identObj.IdentObj, path string, ok bool) {
+    if _,isPtr := e.Obj.GetType().(types.PtrType); isPtr {
+        return nil, "", false
+    }
+
+    switch o := e.Obj.(type) {
+    case *ast.Ident:
+        if _,ok := state.tracked[o.Obj]; ok {
+            return o.Obj, e.FieldName.Str, true
+        }
+    case *ast.Field:
+        if obj, path, ok := state.fieldPath(o); ok {
+            return obj, path + "." + e.FieldName.Str, true
+        }
+    }
+
+    return nil, "", false
+}
+
+func isAssigned(obj identObj.IdentObj, path string, t types.Type, st *assignState) bool {
+    if st.assigned[assignKey{ obj, "" }] {
+        return true
+    }
+    for i,c := range path {
+        if c == '.' && st.assigned[assignKey{ obj, path[:i] }] {
+            return true
+        }
+    }
+    if path != "" && st.assigned[assignKey{ obj, path }] {
+        return true
+    }
+
+    // every field assigned
+    if s,ok := t.(types.StructType); ok && len(s.Types) > 0 {
+        return len(missingFields(obj, path, s, st)) == 0
+    }
+
+    return false
+}
+
+func missingFields(obj identObj.IdentObj, path string, t types.StructType, st *assignState) (missing []string) {
+    for i,f := range t.GetFields() {
+        if path != "" {
+            f = path + "." + f
+        }
+        if !isAssigned(obj, f, t.Types[i], st) {
+            missing = append(missing, f)
+        }
+    }
+
+    return
+}
+
+func (state *State) requireAssigned(obj identObj.IdentObj, path string, t types.Type, at string, st *assignState) {
+    if isAssigned(obj, path, t, st) {
+        return
+    }
+
+    name := obj.GetName()
+    if path != "" {
+        name += "." + path
+    }
+
+    var missing []string
+    if s,ok := t.(types.StructType); ok && len(s.Types) > 0 {
+        missing = missingFields(obj, path, s, st)
+    }
+
+    if len(missing) > 0 && len(missing) < len(t.(types.StructType).Types) {
+        state.diag.Errorf("%s is used before all of its fields are assigned", name)
+        state.diag.Linef("missing: %s.%s", obj.GetName(), strings.Join(missing, ", " + obj.GetName() + "."))
+    } else {
+        state.diag.Errorf("%s is used before it is assigned", name)
+    }
+    state.diag.At(at)
+    state.diag.NoteAt("declared here", state.tracked[obj].At())
+    state.diag.Exit()
+}
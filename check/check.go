@@ -5,10 +5,10 @@ import (
     "gamma/ast"
 )
 
-func TypeCheck(Ast ast.Ast) {
-    fmt.Println("[INFO] typechecking...")
+func (state *State) TypeCheck(Ast ast.Ast) {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] typechecking...")
 
     for _,d := range Ast.Decls {
-        typeCheckDecl(d)
+        state.typeCheckDecl(d)
     }
 }
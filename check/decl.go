@@ -1,101 +1,105 @@
 package check
 
 import (
-	"fmt"
 	"gamma/ast"
 	"gamma/ast/identObj"
 	"gamma/types"
-	"os"
 	"reflect"
 )
 
-func typeCheckDecl(d ast.Decl) {
+func (state *State) typeCheckDecl(d ast.Decl) {
     switch d := d.(type) {
     case *ast.DefVar:
-        typeCheckDefVar(d)
+        state.typeCheckDefVar(d)
 
     case *ast.DefConst:
-        typeCheckDefConst(d)
+        state.typeCheckDefConst(d)
 
     case *ast.Import:
-        typeCheckImport(d)
+        state.typeCheckImport(d)
 
     case *ast.DefFn:
-        typeCheckDefFn(d)
+        state.typeCheckDefFn(d)
 
     case *ast.Impl:
-        typeCheckImpl(d)
+        state.typeCheckImpl(d)
 
     case *ast.DefEnum:
-        typeCheckDefEnum(d)
+        state.typeCheckDefEnum(d)
 
     case *ast.DefStruct:
-        typeCheckDefStruct(d)
+        state.typeCheckDefStruct(d)
+
+    case *ast.DecVar:
+        state.checkMutDecVar(d)
 
     case *ast.DefInterface:
         // nothing to do
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] typeCheckDecl for %v is not implemente yet\n", reflect.TypeOf(d))
-        os.Exit(1)
+        state.diag.Errorf("typeCheckDecl for %v is not implemente yet", reflect.TypeOf(d))
+        state.diag.Exit()
     }
 }
 
-func typeCheckDefVar(d *ast.DefVar) {
+func (state *State) typeCheckDefVar(d *ast.DefVar) {
     t1 := d.V.GetType()
     t2 := d.Value.GetType()
 
-    if !checkTypeExpr(t1, d.Value) {
-        fmt.Fprintf(os.Stderr, "[ERROR] cannot define \"%s\" (type: %v) with type %v\n", d.V.GetName(), t1, t2)
-        fmt.Fprintln(os.Stderr, "\t" + d.At())
-        os.Exit(1)
+    if !state.checkTypeExpr(t1, d.Value) {
+        state.diag.Errorf("cannot define \"%s\" (type: %v) with type %v", d.V.GetName(), t1, t2)
+        state.diag.At(d.At())
+        state.diag.Exit()
     }
 
-    typeCheckExpr(d.Value)
+    state.typeCheckExpr(d.Value)
 }
 
-func typeCheckDefConst(d *ast.DefConst) {
-    typeCheckExpr(d.Value)
+func (state *State) typeCheckDefConst(d *ast.DefConst) {
+    state.typeCheckExpr(d.Value)
 
     t2 := d.Value.GetType()
-    if !checkTypeExpr(d.Type, d.Value) {
-        fmt.Fprintf(os.Stderr, "[ERROR] cannot define \"%s\" (type: %v) with type %v\n", d.C.GetName(), d.Type, t2)
-        fmt.Fprintln(os.Stderr, "\t" + d.At())
-        os.Exit(1)
+    if !state.checkTypeExpr(d.Type, d.Value) {
+        state.diag.Errorf("cannot define \"%s\" (type: %v) with type %v", d.C.GetName(), d.Type, t2)
+        state.diag.At(d.At())
+        state.diag.Exit()
     }
 }
 
-func typeCheckImport(d *ast.Import) {
+func (state *State) typeCheckImport(d *ast.Import) {
     for _,d := range d.Decls {
-        typeCheckDecl(d)
+        state.typeCheckDecl(d)
     }
 }
 
-func typeCheckDefFn(d *ast.DefFn) {
+func (state *State) typeCheckDefFn(d *ast.DefFn) {
     if d.FnHead.RetType != nil && !hasRet(&d.Block) {
-        fmt.Fprintln(os.Stderr, "[ERROR] missing return")
-        fmt.Fprintln(os.Stderr, "\t" + d.At())
-        os.Exit(1)
+        state.diag.Error("missing return")
+        state.diag.At(d.At())
+        state.diag.Exit()
     }
 
     if d.FnHead.IsConst && d.FnHead.RetType == nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] a const func returning nothing has no purpose")
-        fmt.Fprintln(os.Stderr, "\t" + d.At())
-        os.Exit(1)
+        state.diag.Error("a const func returning nothing has no purpose")
+        state.diag.At(d.At())
+        state.diag.Exit()
     }
 
     for _,s := range d.Block.Stmts {
-        typeCheckStmt(s)
+        state.typeCheckStmt(s)
     }
+
+    state.checkAssigned(d)
+    state.checkEscapes(d)
 }
 
-func typeCheckImplNoInterface(d *ast.Impl) {
+func (state *State) typeCheckImplNoInterface(d *ast.Impl) {
     for _,f := range d.FnDefs {
-        typeCheckDefFn(&f)
+        state.typeCheckDefFn(&f)
     }
 }
 
-func typeCheckInterfaceImplemented(d *ast.Impl) {
+func (state *State) typeCheckInterfaceImplemented(d *ast.Impl) {
     err := false
 
     if d.Impl.GetInterfaceType().Generic.Name != "" {
@@ -105,14 +109,14 @@ func typeCheckInterfaceImplemented(d *ast.Impl) {
     for _,expected := range d.Impl.GetInterfaceFuncs() {
         found := false
         for _,f := range d.FnDefs {
-            typeCheckDefFn(&f)
+            state.typeCheckDefFn(&f)
             if f.FnHead.Name.Str == expected.Name {
-                if !compatible(expected, f.FnHead.F.GetType()) {
-                    fmt.Fprintln(os.Stderr, "[ERROR] different function signatures in interface and impl")
-                    fmt.Fprintln(os.Stderr, "\texpected: " + expected.String())
-                    fmt.Fprintln(os.Stderr, "\tgot:      " + f.FnHead.F.String())
-                    fmt.Fprintln(os.Stderr, "\tinterface: " + d.Impl.GetInterfaceFuncPos(expected.Name).At())
-                    fmt.Fprintln(os.Stderr, "\timpl:      " + f.At())
+                if !state.compatible(expected, f.FnHead.F.GetType()) {
+                    state.diag.Error("different function signatures in interface and impl")
+                    state.diag.Line("expected: " + expected.String())
+                    state.diag.Line("got:      " + f.FnHead.F.String())
+                    state.diag.At(f.At())
+                    state.diag.NoteAt("interface function declared here", d.Impl.GetInterfaceFuncPos(expected.Name).At())
                     err = true
                 }
 
@@ -122,92 +126,92 @@ func typeCheckInterfaceImplemented(d *ast.Impl) {
         }
 
         if !found {
-            fmt.Fprintln(os.Stderr, "[ERROR] missing function definition in impl")
-            fmt.Fprintln(os.Stderr, "\texpected: " + expected.String())
-            fmt.Fprintln(os.Stderr, "\tinterface: " + d.Impl.GetInterfaceFuncPos(expected.Name).At())
-            fmt.Fprintln(os.Stderr, "\timpl:      " + d.At())
+            state.diag.Error("missing function definition in impl")
+            state.diag.Line("expected: " + expected.String())
+            state.diag.At(d.At())
+            state.diag.NoteAt("interface function declared here", d.Impl.GetInterfaceFuncPos(expected.Name).At())
             err = true
         }
     }
 
     if len(d.Impl.GetInterfaceFuncs()) < len(d.FnDefs) {
-        fmt.Fprintf(os.Stderr, "[ERROR] too many functions are defined in impl (expected %d got %d)\n", 
+        state.diag.Errorf("too many functions are defined in impl (expected %d got %d)", 
             len(d.Impl.GetInterfaceFuncs()), len(d.FnDefs))
         for _,f := range d.FnDefs {
             found := false
             for _,expected := range d.Impl.GetInterfaceFuncs() {
                 if f.FnHead.Name.Str == expected.Name {
-                    if compatible(expected, f.FnHead.F.GetType()) {
+                    if state.compatible(expected, f.FnHead.F.GetType()) {
                         found = true
                         break
                     }
                 }
             }
 
-            if !found { fmt.Fprintln(os.Stderr, "\tgot: " + f.FnHead.F.String()) }
+            if !found { state.diag.Line("got: " + f.FnHead.F.String()) }
         }
-        fmt.Fprintln(os.Stderr, "\tinterface: " + d.Impl.GetInterfacePos().At())
-        fmt.Fprintln(os.Stderr, "\timpl:      " + d.At())
-        os.Exit(1)
+        state.diag.At(d.At())
+        state.diag.NoteAt("interface declared here", d.Impl.GetInterfacePos().At())
+        state.diag.Exit()
     }
 
-    if err { os.Exit(1) }
+    if err { state.diag.Exit() }
 }
 
-func typeCheckImpl(d *ast.Impl) {
+func (state *State) typeCheckImpl(d *ast.Impl) {
     if d.Impl.HasInterface() {
-        typeCheckInterfaceImplemented(d)
+        state.typeCheckInterfaceImplemented(d)
     } else {
-        typeCheckImplNoInterface(d)
+        state.typeCheckImplNoInterface(d)
     }
 }
 
-func typeCheckDefEnum(d *ast.DefEnum) {
+func (state *State) typeCheckDefEnum(d *ast.DefEnum) {
     switch d.IdType.GetKind() {
     case types.Bool:
         if len(d.Elems) > 2 {
-            fmt.Fprintf(os.Stderr, "[ERROR] too many elements for enum with id type %s (got %d)\n", d.IdType, len(d.Elems))
-            fmt.Fprintln(os.Stderr, "\t" + d.At())
-            os.Exit(1)
+            state.diag.Errorf("too many elements for enum with id type %s (got %d)", d.IdType, len(d.Elems))
+            state.diag.At(d.At())
+            state.diag.Exit()
         }
     case types.Uint, types.Char:
         if uint(len(d.Elems)) >> (d.IdType.Size()*8) > 0 {
-            fmt.Fprintf(os.Stderr, "[ERROR] too many elements for enum with id type %s (got %d)\n", d.IdType, len(d.Elems))
-            fmt.Fprintln(os.Stderr, "\t" + d.At())
-            os.Exit(1)
+            state.diag.Errorf("too many elements for enum with id type %s (got %d)", d.IdType, len(d.Elems))
+            state.diag.At(d.At())
+            state.diag.Exit()
         }
     case types.Int:
         if uint(len(d.Elems)) >> ((d.IdType.Size()-1)*8) > 0 {
-            fmt.Fprintf(os.Stderr, "[ERROR] too many elements for enum with id type %s (got %d)\n", d.IdType, len(d.Elems))
-            fmt.Fprintln(os.Stderr, "\t" + d.At())
-            os.Exit(1)
+            state.diag.Errorf("too many elements for enum with id type %s (got %d)", d.IdType, len(d.Elems))
+            state.diag.At(d.At())
+            state.diag.Exit()
         }
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] expected uint, int, char or bool as enum id type (got %s)\n", d.IdType)
-        fmt.Fprintln(os.Stderr, "\t" + d.At())
-        os.Exit(1)
+        state.diag.Errorf("expected uint, int, char or bool as enum id type (got %s)", d.IdType)
+        state.diag.At(d.At())
+        state.diag.Exit()
     }
 }
 
-func typeCheckDefStruct(d *ast.DefStruct) {
+func (state *State) typeCheckDefStruct(d *ast.DefStruct) {
     for _,f := range d.Fields {
         if s,ok := f.Type.(types.StructType); ok && s.Name == d.Name.Str {
-            fmt.Fprintf(os.Stderr, "[ERROR] infinitely growing recursive struct (use *%s instead)\n", s.Name)
-            fmt.Fprintln(os.Stderr, "\t" + f.TypePos.At())
-            os.Exit(1)
+            state.diag.Errorf("infinitely growing recursive struct (use *%s instead)", s.Name)
+            state.diag.At(f.TypePos.At())
+            state.diag.Exit()
         }
     }
 }
 
-func printFuncs(interfaceFuncs []identObj.Func, implFuncs []ast.DefFn) {
-    fmt.Fprintln(os.Stderr, "\tinterface:")
+func (state *State) printFuncs(interfaceFuncs []identObj.Func, implFuncs []ast.DefFn) {
+    state.diag.Line("interface:")
     for _,f := range interfaceFuncs {
-        fmt.Fprintln(os.Stderr, "\t\t" + f.String())
+        state.diag.Line(f.String())
     }
-    fmt.Fprintln(os.Stderr, "\timpl:")
+    state.diag.Line("impl:")
     for _,f := range implFuncs {
-        fmt.Fprintln(os.Stderr, "\t\t" + f.FnHead.F.String())
+        state.diag.Line(f.FnHead.F.String())
     }
 }
 
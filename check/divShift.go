@@ -0,0 +1,45 @@
+package check
+
+import (
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+)
+
+/*
+const operands which are always wrong:
+  * divisor of / and % is 0
+  * shift amount of << and >> is negative or >= the bit width of the shifted int
+(divisions by a runtime 0 are checked in debug builds, see gen.genDivisorCheck)
+*/
+
+func (state *State) checkDivShift(e *ast.Binary) {
+    switch e.Operator.Type {
+    case token.Div, token.Mod:
+        if v, ok := exactInt(state.cmpTime.ConstEval(e.OperandR)); ok && v.Sign() == 0 {
+            what := "division"
+            if e.Operator.Type == token.Mod {
+                what = "remainder"
+            }
+            state.diag.Errorf("%s by zero", what)
+            state.diag.At(e.OperandR.At())
+            state.diag.NoteAt("operator here", e.Operator.At())
+            state.diag.Exit()
+        }
+
+    case token.Shl, token.Shr:
+        t := types.ResolveGeneric(e.OperandL.GetType())
+        if t == nil || (t.GetKind() != types.Int && t.GetKind() != types.Uint) {
+            return
+        }
+
+        if v, ok := exactInt(state.cmpTime.ConstEval(e.OperandR)); ok {
+            bits := int64(t.Size() * 8)
+            if !v.IsInt64() || v.Int64() < 0 || v.Int64() >= bits {
+                state.diag.Errorf("shift amount %s is out of range for %v (expected 0 to %d)", v, t, bits-1)
+                state.diag.At(e.OperandR.At())
+                state.diag.Exit()
+            }
+        }
+    }
+}
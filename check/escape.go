@@ -0,0 +1,169 @@
+package check
+
+import (
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/ast/identObj/vars"
+)
+
+/*
+escape analysis (pointers into the stack frame of a function after it returned):
+  * &local (or &local.field) which is returned (directly, in a struct/enum lit or through other vars)
+  * &local which is stored in a global var
+vars holding such pointers are tracked in order of the statements (not per path)
+*/
+
+type escapeSrc struct {
+    addr *ast.Unary
+    local identObj.IdentObj
+    path string     // "&x -> p -> s.ptr"
+}
+
+func (state *State) checkEscapes(d *ast.DefFn) {
+    state.pointsTo = make(map[identObj.IdentObj][]escapeSrc)
+    defer func() { state.pointsTo = nil }()
+
+    ast.Inspect(&d.Block, func(n ast.Node) bool {
+        switch n := n.(type) {
+        case *ast.DefVar:
+            for _,src := range state.escapeSrcs(n.Value) {
+                state.addPointsTo(n.V, n.V.GetName(), src)
+            }
+
+        case *ast.Assign:
+            srcs := state.escapeSrcs(n.Value)
+            if len(srcs) == 0 {
+                break
+            }
+
+            root, dest := destRoot(n.Dest)
+            switch root.(type) {
+            case *vars.GlobalVar:
+                state.escapeErr(srcs[0], "stored in global " + dest, dest, n.Dest.At())
+            case *vars.LocalVar:
+                for _,src := range srcs {
+                    state.addPointsTo(root, dest, src)
+                }
+            }
+
+        case *ast.Ret:
+            if srcs := state.escapeSrcs(n.RetExpr); len(srcs) > 0 {
+                state.escapeErr(srcs[0], "returned", "ret", n.At())
+            }
+        }
+
+        return true
+    })
+}
+
+func (state *State) addPointsTo(v identObj.IdentObj, dest string, src escapeSrc) {
+    for _,s := range state.pointsTo[v] {
+        if s.addr == src.addr {
+            return
+        }
+    }
+
+    src.path += " -> " + dest
+    state.pointsTo[v] = append(state.pointsTo[v], src)
+}
+
+// addresses of locals in the value of e (e can be nil)
+func (state *State) escapeSrcs(e ast.Expr) (res []escapeSrc) {
+    if e == nil {
+        return nil
+    }
+
+    for _,part := range ast.ValueParts(e) {
+        switch part := part.(type) {
+        case *ast.Unary:
+            if part.Operator.Type != token.Amp {
+                break
+            }
+            if local, name, ok := localAddr(part.Operand); ok {
+                res = append(res, escapeSrc{ addr: part, local: local, path: "&" + name })
+            }
+
+        case *ast.Ident, *ast.Field:
+            if !holdsPtr(part.GetType()) {
+                break
+            }
+            if root, name := destRoot(part); root != nil {
+                for _,src := range state.pointsTo[root] {
+                    if name != root.GetName() {
+                        src.path += " -> " + name
+                    }
+                    res = append(res, src)
+                }
+            }
+        }
+    }
+
+    return
+}
+
+// a local var (or one of its fields) is stored in the stack frame
+func localAddr(e ast.Expr) (local identObj.IdentObj, name string, ok bool) {
+    switch e := e.(type) {
+    case *ast.Ident:
+        if _,ok := e.Obj.(*vars.LocalVar); ok {
+            return e.Obj, e.Name, true
+        }
+    case *ast.Field:
+        if _,isPtr := e.Obj.GetType().(types.PtrType); !isPtr {
+            if local, name, ok := localAddr(e.Obj); ok {
+                return local, name + "." + e.FieldName.Str, true
+            }
+        }
+    case *ast.Paren:
+        return localAddr(e.Expr)
+    }
+
+    return nil, "", false
+}
+
+// the var in which dest is stored (nil for derefs, indexed, ...)
+func destRoot(dest ast.Expr) (root identObj.IdentObj, name string) {
+    switch d := dest.(type) {
+    case *ast.Ident:
+        return d.Obj, d.Name
+    case *ast.Field:
+        if root, name := destRoot(d.Obj); root != nil {
+            return root, name + "." + d.FieldName.Str
+        }
+    case *ast.Paren:
+        return destRoot(d.Expr)
+    }
+
+    return nil, ""
+}
+
+func holdsPtr(t types.Type) bool {
+    switch t := t.(type) {
+    case types.PtrType, types.GenericType:
+        return true
+    case types.StructType:
+        for _,t := range t.Types {
+            if holdsPtr(t) {
+                return true
+            }
+        }
+    case types.EnumType:
+        for _,elem := range t.GetElems() {
+            if holdsPtr(t.GetType(elem)) {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+func (state *State) escapeErr(src escapeSrc, how string, dest string, at string) {
+    state.diag.Errorf("pointer to local %s outlives its function (%s)", src.local.GetName(), how)
+    state.diag.At(src.addr.At())
+    state.diag.Linef("path: %s -> %s", src.path, dest)
+    state.diag.NoteAt("escapes here", at)
+    state.diag.Exit()
+}
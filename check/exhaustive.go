@@ -0,0 +1,118 @@
+package check
+
+import (
+    "fmt"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/cmpTime/constVal"
+)
+
+/*
+switches/xswitches on the value of an enum or a bool (x == { ... }):
+  * without a default case every element has to be covered
+(unwrap switches are checked by exhaustedUnwraps, duplicate cases are warnings (see warn.checkDuplicateCases))
+*/
+
+// compared base expr and the values of every case (nil for the default case)
+// ok is false if one of the cases is not "base == value"
+func caseValues(conds []ast.Expr) (base ast.Expr, values [][]ast.Expr, ok bool) {
+    values = make([][]ast.Expr, 0, len(conds))
+
+    for _,c := range conds {
+        if c == nil {
+            values = append(values, nil)
+            continue
+        }
+
+        var vs []ast.Expr
+        for _,b := range ast.FlattenOr(c) {
+            if b.Operator.Type != token.Eql || (base != nil && b.OperandL != base) {
+                return nil, nil, false
+            }
+            base = b.OperandL
+            vs = append(vs, b.OperandR)
+        }
+        if vs == nil {
+            return nil, nil, false
+        }
+        values = append(values, vs)
+    }
+
+    return base, values, base != nil
+}
+
+// name of the enum element/bool (ok is false for everything which is not const)
+func (state *State) caseValueName(t types.Type, v ast.Expr) (name string, ok bool) {
+    switch t := t.(type) {
+    case types.EnumType:
+        if e,isLit := v.(*ast.EnumLit); isLit && e.Content == nil && e.Type.Name == t.Name {
+            return e.ElemName.Str, true
+        }
+    case types.BoolType:
+        if b,isBool := state.cmpTime.ConstEval(v).(*constVal.BoolConst); isBool {
+            return fmt.Sprint(bool(*b)), true
+        }
+    }
+
+    return "", false
+}
+
+// checked is false if the switch is not on the value of an enum/bool
+func (state *State) exhaustedValues(conds []ast.Expr, end string) (checked bool) {
+    base, values, ok := caseValues(conds)
+    if !ok {
+        return false
+    }
+
+    var expectedElems []string
+    t := types.ResolveGeneric(base.GetType())
+    switch t := t.(type) {
+    case types.EnumType:
+        expectedElems = t.GetElems()
+    case types.BoolType:
+        expectedElems = []string{ "true", "false" }
+    default:
+        return false
+    }
+
+    usedElems := make(map[string]bool, len(expectedElems))
+    hasDefault := false
+    for _,vs := range values {
+        if vs == nil {
+            hasDefault = true
+            continue
+        }
+
+        for _,v := range vs {
+            name, ok := state.caseValueName(t, v)
+            if !ok {
+                return false
+            }
+
+            usedElems[name] = true
+        }
+    }
+
+    if !hasDefault {
+        state.notExhausted(expectedElems, usedElems, end)
+    }
+    return true
+}
+
+func (state *State) notExhausted(expectedElems []string, usedElems map[string]bool, end string) {
+    missing := make([]string, 0, len(expectedElems))
+    for _,elem := range expectedElems {
+        if !usedElems[elem] {
+            missing = append(missing, elem)
+        }
+    }
+
+    if len(missing) > 0 {
+        state.diag.Error("cases are not exhausted")
+        state.diag.Linef("expected: %v", expectedElems)
+        state.diag.Linef("missing: %v", missing)
+        state.diag.At(end)
+        state.diag.Exit()
+    }
+}
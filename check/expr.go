@@ -1,208 +1,223 @@
 package check
 
 import (
-    "os"
     "fmt"
     "reflect"
     "gamma/token"
     "gamma/types"
-    "gamma/cmpTime"
     "gamma/ast"
-    "gamma/ast/identObj"
+    "gamma/buildin"
 )
 
-func typeCheckExpr(e ast.Expr) {
+func (state *State) typeCheckExpr(e ast.Expr) {
     switch e := e.(type) {
     case *ast.ArrayLit:
-        typeCheckArrayLit(e)
+        state.typeCheckArrayLit(e)
     case *ast.VectorLit:
-        typeCheckVecLit(e)
+        state.typeCheckVecLit(e)
     case *ast.StructLit:
-        typeCheckStructLit(e)
+        state.typeCheckStructLit(e)
 
     case *ast.Indexed:
-        typeCheckIndexed(e)
+        state.typeCheckIndexed(e)
     case *ast.Field:
-        typeCheckField(e)
+        state.typeCheckField(e)
 
     case *ast.EnumLit:
-        typeCheckEnumLit(e)
+        state.typeCheckEnumLit(e)
     case *ast.Unwrap:
-        typeCheckUnwrap(e)
+        state.typeCheckUnwrap(e)
 
     case *ast.Unary:
-        typeCheckUnary(e)
+        state.typeCheckUnary(e)
     case *ast.Binary:
-        typeCheckBinary(e)
+        state.typeCheckBinary(e)
     case *ast.Paren:
-        typeCheckExpr(e.Expr)
+        state.typeCheckExpr(e.Expr)
 
     case *ast.XSwitch:
-        typeCheckXSwitch(e)
+        state.typeCheckXSwitch(e)
 
     case *ast.FnCall:
         if e.Ident.Name == "fmt" {
-            typeCheckFmtCall(e)
+            state.typeCheckFmtCall(e)
         } else {
-            typeCheckFnCall(e)
+            state.typeCheckFnCall(e)
         }
 
     case *ast.Ident:
-        typeCheckIdent(e)
+        state.typeCheckIdent(e)
 
     case *ast.Cast:
-        typeCheckCast(e)
+        state.typeCheckCast(e)
 
-    case *ast.IntLit, *ast.CharLit, *ast.BoolLit, *ast.PtrLit, *ast.StrLit:
+    case *ast.IntLit:
+        state.checkIntLit(e)
+
+    case *ast.CharLit, *ast.BoolLit, *ast.PtrLit, *ast.StrLit:
         // nothing to check
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] typeCheckExpr for %v is not implement yet\n", reflect.TypeOf(e))
-        os.Exit(1)
+        state.diag.Errorf("typeCheckExpr for %v is not implement yet", reflect.TypeOf(e))
+        state.diag.Exit()
     }
 }
 
 
-func checkTypeExpr(destType types.Type, e ast.Expr) bool {
-    typeCheckExpr(e)
-    return compatible(destType, e.GetType())
+func (state *State) checkTypeExpr(destType types.Type, e ast.Expr) bool {
+    state.typeCheckExpr(e)
+    return state.compatible(destType, e.GetType())
 }
 
-func typeCheckIdent(e *ast.Ident) {
+func (state *State) typeCheckIdent(e *ast.Ident) {
     if e.Obj == nil && e.Name == "_" {
-        fmt.Fprintf(os.Stderr, "[ERROR] %v is not defined\n", e.Name)
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("%v is not defined", e.Name)
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 }
 
-func typeCheckIndexed(e *ast.Indexed) {
-    typeCheckExpr(e.ArrExpr)
+func (state *State) typeCheckIndexed(e *ast.Indexed) {
+    state.typeCheckExpr(e.ArrExpr)
 
     switch t := e.ArrType.(type) {
     case types.ArrType:
         switch e.Index.GetType().GetKind() {
         case types.Uint, types.Int:
-            if c,ok := cmpTime.ConstEvalUint(e.Index); ok {
+            if c,ok := state.cmpTime.ConstEvalUint(e.Index); ok {
                 if c >= t.Len || c < 0 {
-                    fmt.Fprintf(os.Stderr, "[ERROR] index %d is out of bounds [%d]\n", c, t.Len)
-                    fmt.Fprintf(os.Stderr, "\tarray type: %v\n", e.ArrType)
-                    fmt.Fprintln(os.Stderr, "\t" + e.Index.At())
-                    os.Exit(1)
+                    state.diag.Errorf("index %d is out of bounds [%d]", c, t.Len)
+                    state.diag.Linef("array type: %v", e.ArrType)
+                    state.diag.At(e.Index.At())
+                    state.diag.Exit()
                 }
             }
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] expected an int/uint as index but got %v\n", e.Index.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + e.Index.At())
-            os.Exit(1)
+            state.diag.Errorf("expected an int/uint as index but got %v", e.Index.GetType())
+            state.diag.At(e.Index.At())
+            state.diag.Exit()
         }
     case types.VecType:
         switch e.Index.GetType().GetKind() {
         case types.Uint, types.Int:
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] expected an int/uint as index but got %v\n", e.Index.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + e.Index.At())
-            os.Exit(1)
+            state.diag.Errorf("expected an int/uint as index but got %v", e.Index.GetType())
+            state.diag.At(e.Index.At())
+            state.diag.Exit()
         }
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] you cannot index %v", t)
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("you cannot index %v", t)
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 }
 
-func typeCheckField(e *ast.Field) {
-    typeCheckExpr(e.Obj)
+func (state *State) typeCheckField(e *ast.Field) {
+    state.typeCheckExpr(e.Obj)
 
     switch e.Obj.GetType().GetKind() {
     case types.Arr:
         if e.FieldName.Str != "len" {
-            fmt.Fprintf(os.Stderr, "[ERROR] array has no field \"%s\" (only len)\n", e.FieldName.Str)
-            fmt.Fprintln(os.Stderr, "\t" + e.FieldName.At())
-            os.Exit(1)
+            state.diag.Errorf("array has no field \"%s\" (only len)", e.FieldName.Str)
+            state.diag.At(e.FieldName.At())
+            state.diag.Exit()
         }
     case types.Vec:
         if e.FieldName.Str != "len" && e.FieldName.Str != "cap" {
-            fmt.Fprintf(os.Stderr, "[ERROR] vec has no field \"%s\" (only len and cap)\n", e.FieldName.Str)
-            fmt.Fprintln(os.Stderr, "\t" + e.FieldName.At())
-            os.Exit(1)
+            state.diag.Errorf("vec has no field \"%s\" (only len and cap)", e.FieldName.Str)
+            state.diag.At(e.FieldName.At())
+            state.diag.Exit()
         }
     case types.Str:
         if e.FieldName.Str != "len" {
-            fmt.Fprintf(os.Stderr, "[ERROR] str has no field \"%s\" (only len)\n", e.FieldName.Str)
-            fmt.Fprintln(os.Stderr, "\t" + e.FieldName.At())
-            os.Exit(1)
+            state.diag.Errorf("str has no field \"%s\" (only len)", e.FieldName.Str)
+            state.diag.At(e.FieldName.At())
+            state.diag.Exit()
         }
     default:
         if e.StructType.GetFieldNum(e.FieldName.Str) == -1 {
-            fmt.Fprintf(os.Stderr, "[ERROR] struct %s has no %s field\n", e.StructType.Name, e.FieldName.Str)
-            fmt.Fprintf(os.Stderr, "\tfields: %v\n", e.StructType.GetFields())
-            fmt.Fprintln(os.Stderr, "\t" + e.At())
-            os.Exit(1)
+            state.diag.Errorf("struct %s has no %s field", e.StructType.Name, e.FieldName.Str)
+            state.diag.Linef("fields: %v", e.StructType.GetFields())
+            state.diag.Suggest(e.FieldName.Str, append(e.StructType.GetFields(), state.identObj.FuncNames(e.StructType)...))
+            state.diag.At(e.At())
+            state.diag.Exit()
         }
     }
 }
 
-func typeCheckEnumLit(e *ast.EnumLit) {
+func (state *State) typeCheckEnumLit(e *ast.EnumLit) {
     if !e.Type.HasElem(e.ElemName.Str) {
-        fmt.Fprintf(os.Stderr, "[ERROR] enum %v has no %s field\n", e.Type, e.ElemName.Str)
-        fmt.Fprintf(os.Stderr, "\telems: %v\n", e.Type.GetElems())
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("enum %v has no %s field", e.Type, e.ElemName.Str)
+        state.diag.Linef("elems: %v", e.Type.GetElems())
+        state.diag.Suggest(e.ElemName.Str, e.Type.GetElems())
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 
     if e.ContentType == nil {
         if e.Content != nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] enum %s.%s did not expect any content\n", e.Type.Name, e.ElemName.Str)
-            fmt.Fprintln(os.Stderr, "\t" + e.Content.At())
-            os.Exit(1)
+            state.diag.Errorf("enum %s.%s did not expect any content", e.Type.Name, e.ElemName.Str)
+            state.diag.At(e.Content.At())
+            state.diag.Exit()
         }
     } else {
          if e.Content == nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] missing enum content for %s.%s (expects type %s)\n", e.Type.Name, e.ElemName.Str, e.ContentType)
-            fmt.Fprintln(os.Stderr, "\t" + e.ElemName.At())
-            os.Exit(1)
+            state.diag.Errorf("missing enum content for %s.%s (expects type %s)", e.Type.Name, e.ElemName.Str, e.ContentType)
+            state.diag.At(e.ElemName.At())
+            state.diag.Exit()
         }
 
-        if !checkTypeExpr(e.ContentType, e.Content) {
-            fmt.Fprintf(os.Stderr, "[ERROR] enum %s.%s expected content of type %s but got %s\n", e.Type.Name, e.ElemName.Str, e.ContentType, e.Content.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + e.ElemName.At())
-            os.Exit(1)
+        if !state.checkTypeExpr(e.ContentType, e.Content) {
+            state.diag.Errorf("enum %s.%s expected content of type %s but got %s", e.Type.Name, e.ElemName.Str, e.ContentType, e.Content.GetType())
+            state.diag.At(e.ElemName.At())
+            state.diag.Exit()
         }
     }
 }
 
-func typeCheckUnwrap(e *ast.Unwrap) {
+// pointers are never null (Opt<*T> is a nullable pointer with None stored as 0)
+func (state *State) checkNullPtr(e *ast.Cast) {
+    if c := state.cmpTime.ConstEval(e.Expr); c != nil && c.GetVal() == "0" {
+        state.diag.Errorf("pointers cannot be null (cast of 0 into %v)", e.DestType)
+        state.diag.At(e.Expr.At())
+        state.diag.NoteAt(fmt.Sprintf("use Opt<%v> for a pointer which can be null", e.DestType), "")
+        state.diag.NoteAt("only const values are checked (a cast of an int which is 0 at runtime is not)", "")
+        state.diag.Exit()
+    }
+}
+
+func (state *State) typeCheckUnwrap(e *ast.Unwrap) {
     if !e.EnumType.HasElem(e.ElemName.Str) {
-        fmt.Fprintf(os.Stderr, "[ERROR] enum %s has not element named %s\n", e.EnumType, e.ElemName.Str)
-        fmt.Fprintf(os.Stderr, "\telems: %v\n", e.EnumType.GetElems())
-        fmt.Fprintln(os.Stderr, "\t" + e.ElemName.At())
-        os.Exit(1)
+        state.diag.Errorf("enum %s has not element named %s", e.EnumType, e.ElemName.Str)
+        state.diag.Linef("elems: %v", e.EnumType.GetElems())
+        state.diag.Suggest(e.ElemName.Str, e.EnumType.GetElems())
+        state.diag.At(e.ElemName.At())
+        state.diag.Exit()
     }
 
-    if !compatible(e.SrcExpr.GetType(), e.EnumType) {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected enum %s but got %s\n", e.SrcExpr.GetType(), e.EnumType)
-        fmt.Fprintln(os.Stderr, "\t" + e.ElemName.At())
-        os.Exit(1)
+    if !state.compatible(e.SrcExpr.GetType(), e.EnumType) {
+        state.diag.Errorf("expected enum %s but got %s", e.SrcExpr.GetType(), e.EnumType)
+        state.diag.At(e.ElemName.At())
+        state.diag.Exit()
     }
 
     t := e.EnumType.GetType(e.ElemName.Str)
     if t != nil {
         if !e.UnusedObj && e.Obj == nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] missing identifier (enum %s.%s expects an identifier for type %s)\n", e.EnumType, e.ElemName.Str, t)
-            fmt.Fprintln(os.Stderr, "\t" + e.ElemName.At())
-            os.Exit(1)
+            state.diag.Errorf("missing identifier (enum %s.%s expects an identifier for type %s)", e.EnumType, e.ElemName.Str, t)
+            state.diag.At(e.ElemName.At())
+            state.diag.Exit()
         }
     } else {
         if e.Obj != nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] enum %s.%s has no type but got identifier %s\n", e.EnumType, e.ElemName.Str, e.Obj.GetName())
-            fmt.Fprintln(os.Stderr, "\t" + e.Obj.GetPos().At())
-            os.Exit(1)
+            state.diag.Errorf("enum %s.%s has no type but got identifier %s", e.EnumType, e.ElemName.Str, e.Obj.GetName())
+            state.diag.At(e.Obj.GetPos().At())
+            state.diag.Exit()
         }
     }
 }
 
-func typeCheckUnary(e *ast.Unary) {
+func (state *State) typeCheckUnary(e *ast.Unary) {
     switch e.Operator.Type {
     case token.Mul:
         // already handled in getTypeUnary
@@ -211,177 +226,209 @@ func typeCheckUnary(e *ast.Unary) {
         switch e.Operand.(type) {
         case *ast.Ident, *ast.Field:
         default:
-            fmt.Fprintln(os.Stderr, "[ERROR] expected an ident or field after \"&\"")
-            fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-            os.Exit(1)
+            state.diag.Error("expected an ident or field after \"&\"")
+            state.diag.At(e.Operator.At())
+            state.diag.Exit()
         }
+        state.checkMutAddr(e)
 
     case token.Minus:
         t := e.Operand.GetType()
-        if !compatible(types.CreateInt(types.Ptr_Size), t) {
+        if !state.compatible(types.CreateInt(types.Ptr_Size), t) {
             // TODO print actual flexable type
-            fmt.Fprintf(os.Stderr, "[ERROR] expected an int after - unary op but got %v\n", t)
-            fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-            os.Exit(1)
+            state.diag.Errorf("expected an int after - unary op but got %v", t)
+            state.diag.At(e.Operator.At())
+            state.diag.Exit()
         }
 
     case token.Plus, token.BitNot:
         if t := e.Operand.GetType(); t.GetKind() != types.Int && t.GetKind() != types.Uint {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected an int/uint after %s unary op but got %v\n", t, e.Operator.Str)
-            fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-            os.Exit(1)
+            state.diag.Errorf("expected an int/uint after %s unary op but got %v", t, e.Operator.Str)
+            state.diag.At(e.Operator.At())
+            state.diag.Exit()
         }
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unexpected unary op %v\n", e.Operator)
-        fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-        os.Exit(1)
+        state.diag.Errorf("unexpected unary op %v", e.Operator)
+        state.diag.At(e.Operator.At())
+        state.diag.Exit()
     }
 
-    typeCheckExpr(e.Operand)
+    // the literal of -128 is checked with the - (see checkOverflowUnary)
+    if _,ok := e.Operand.(*ast.IntLit); !ok || e.Operator.Type != token.Minus {
+        state.typeCheckExpr(e.Operand)
+    }
+    state.checkOverflowUnary(e)
 }
 
-func typeCheckArrayLit(o *ast.ArrayLit) {
+func (state *State) typeCheckArrayLit(o *ast.ArrayLit) {
     for _,v := range o.Values {
-        if !checkTypeExpr(o.Type.BaseType, v) {
-            fmt.Fprintf(os.Stderr, "[ERROR] all values in the ArrayLit should be of type %v but got a value of %v\n", o.Type.BaseType, v.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + v.At())
-            os.Exit(1)
+        if !state.checkTypeExpr(o.Type.BaseType, v) {
+            state.diag.Errorf("all values in the ArrayLit should be of type %v but got a value of %v", o.Type.BaseType, v.GetType())
+            state.diag.At(v.At())
+            state.diag.Exit()
         }
 
-        typeCheckExpr(v)
+        state.typeCheckExpr(v)
+    }
+
+    if len(o.Values) == 0 && o.Type.Len > 0 && nonNullPtr(o.Type.BaseType) != nil {
+        state.diag.Errorf("elements of %v cannot be filled with defaults (pointers cannot be null)", o.Type)
+        state.diag.At(o.At())
+        state.diag.NoteAt(fmt.Sprintf("set every element or use Opt<%v> for pointers which can be null", nonNullPtr(o.Type.BaseType)), "")
+        state.diag.Exit()
     }
 
     if uint64(len(o.Values)) != 0 && uint64(len(o.Values)) != o.Type.Len {
         if uint64(len(o.Values)) > o.Type.Len {
-            fmt.Fprintf(os.Stderr, "[ERROR] too big array literal (expected len %d, but got %d)\n", o.Type.Len, len(o.Values))
+            state.diag.Errorf("too big array literal (expected len %d, but got %d)", o.Type.Len, len(o.Values))
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] too small array literal (expected len %d, but got %d)\n", o.Type.Len, len(o.Values))
+            state.diag.Errorf("too small array literal (expected len %d, but got %d)", o.Type.Len, len(o.Values))
+        }
+        state.diag.Linef("array type: %v", o.Type)
+        state.diag.At(o.At())
+        state.diag.Exit()
+    }
+}
+
+// the *T in a zero filled t (nil if there is none, None of Opt<*T> is 0 and fine)
+func nonNullPtr(t types.Type) types.Type {
+    switch t := t.(type) {
+    case types.PtrType:
+        return t
+    case types.ArrType:
+        return nonNullPtr(t.BaseType)
+    case types.StructType:
+        for _,t := range t.Types {
+            if p := nonNullPtr(t); p != nil {
+                return p
+            }
         }
-        fmt.Fprintf(os.Stderr, "\tarray type: %v\n", o.Type)
-        fmt.Fprintln(os.Stderr, "\t" + o.At())
-        os.Exit(1)
     }
+
+    return nil
 }
 
-func typeCheckVecLit(e *ast.VectorLit) {
+func (state *State) typeCheckVecLit(e *ast.VectorLit) {
     if e.Cap != nil {
-        if !checkTypeExpr(types.CreateUint(types.U64_Size), e.Cap) {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected an u64 as cap for the vector but got %v\n", e.Cap.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + e.Cap.At())
-            os.Exit(1)
+        if !state.checkTypeExpr(types.CreateUint(types.U64_Size), e.Cap) {
+            state.diag.Errorf("expected an u64 as cap for the vector but got %v", e.Cap.GetType())
+            state.diag.At(e.Cap.At())
+            state.diag.Exit()
         }
     }
 
     if e.Len != nil {
-        if !checkTypeExpr(types.CreateUint(types.U64_Size), e.Len) {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected an u64 as len for the vector but got %v\n", e.Len.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + e.Len.At())
-            os.Exit(1)
+        if !state.checkTypeExpr(types.CreateUint(types.U64_Size), e.Len) {
+            state.diag.Errorf("expected an u64 as len for the vector but got %v", e.Len.GetType())
+            state.diag.At(e.Len.At())
+            state.diag.Exit()
         }
     }
 }
 
-func typeCheckStructLit(o *ast.StructLit) {
+func (state *State) typeCheckStructLit(o *ast.StructLit) {
     for i,f := range o.Fields {
-        if !checkTypeExpr(o.StructType.Types[i], f.Value) {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a %v as field %d of struct %s but got %v\n",
+        if !state.checkTypeExpr(o.StructType.Types[i], f.Value) {
+            state.diag.Errorf("expected a %v as field %d of struct %s but got %v",
                 o.StructType.Types[i], i, o.StructType.Name, f.GetType())
-            fmt.Fprintf(os.Stderr, "\texpected: %v\n", o.StructType.Types)
-            fmt.Fprintf(os.Stderr, "\tgot:      %v\n", fieldsToTypes(o.Fields))
-            fmt.Fprintln(os.Stderr, "\t" + f.End())
-            os.Exit(1)
+            state.diag.Linef("expected: %v", o.StructType.Types)
+            state.diag.Linef("got:      %v", fieldsToTypes(o.Fields))
+            state.diag.At(f.End())
+            state.diag.Exit()
         }
     }
 }
 
-func typeCheckBinary(e *ast.Binary) {
+func (state *State) typeCheckBinary(e *ast.Binary) {
     t1 := e.OperandL.GetType()
     t2 := e.OperandR.GetType()
 
     if e.Operator.Type == token.And || e.Operator.Type == token.Or {
         if t1.GetKind() != types.Bool || t2.GetKind() != types.Bool {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected 2 bools for logic op \"%s\" but got %v and %v\n", e.Operator.Str, t1, t2)
-            fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-            os.Exit(1)
+            state.diag.Errorf("expected 2 bools for logic op \"%s\" but got %v and %v", e.Operator.Str, t1, t2)
+            state.diag.At(e.Operator.At())
+            state.diag.Exit()
         }
 
     } else {
         // allow ptr + u64 / u64 + ptr / ptr - u64
         if e.Type.GetKind() == types.Ptr {
             if e.Operator.Type != token.Plus && e.Operator.Type != token.Minus {
-                fmt.Fprintln(os.Stderr, "[ERROR] you can only add or subtract a pointer with an u64")
-                fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-                os.Exit(1)
+                state.diag.Error("you can only add or subtract a pointer with an u64")
+                state.diag.At(e.Operator.At())
+                state.diag.Exit()
             }
 
             if t2.GetKind() == types.Ptr && e.Operator.Type == token.Minus {
-                fmt.Fprintln(os.Stderr, "[ERROR] you can only subtract a pointer with an u64 (not the other way around)")
-                fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-                os.Exit(1)
+                state.diag.Error("you can only subtract a pointer with an u64 (not the other way around)")
+                state.diag.At(e.Operator.At())
+                state.diag.Exit()
             }
         }
 
-        if !compatibleBinaryOp(t1, t2) {
-            fmt.Fprintf(os.Stderr, "[ERROR] binary operation %s has two incompatible types (left: %v right: %v)\n",
+        if !state.compatibleBinaryOp(t1, t2) {
+            state.diag.Errorf("binary operation %s has two incompatible types (left: %v right: %v)",
                 e.Operator.Str, t1, t2)
-            fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-            os.Exit(1)
+            state.diag.At(e.Operator.At())
+            state.diag.Exit()
         }
     }
 
-    typeCheckExpr(e.OperandL)
-    typeCheckExpr(e.OperandR)
+    state.typeCheckExpr(e.OperandL)
+    state.typeCheckExpr(e.OperandR)
+    state.checkDivShift(e)
+    state.checkOverflowBinary(e)
 }
 
-func typeCheckXCase(s *ast.XCase) {
+func (state *State) typeCheckXCase(s *ast.XCase) {
     if s.Cond != nil {
         if t := s.Cond.GetType(); t.GetKind() != types.Bool {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a condition of type bool but got \"%v\"\n", t)
-            fmt.Fprintln(os.Stderr, "\t" + s.ColonPos.At())
-            os.Exit(1)
+            state.diag.Errorf("expected a condition of type bool but got \"%v\"", t)
+            state.diag.At(s.ColonPos.At())
+            state.diag.Exit()
         }
-        typeCheckExpr(s.Cond)
+        state.typeCheckExpr(s.Cond)
     }
 
-    typeCheckExpr(s.Expr)
+    state.typeCheckExpr(s.Expr)
 }
 
-func typeCheckXSwitch(o *ast.XSwitch) {
+func (state *State) typeCheckXSwitch(o *ast.XSwitch) {
     if len(o.Cases) <= 0 {
-        fmt.Fprintln(os.Stderr, "[ERROR] empty XSwitch")
-        fmt.Fprintln(os.Stderr, "\t" + o.At())
-        os.Exit(1)
+        state.diag.Error("empty XSwitch")
+        state.diag.At(o.At())
+        state.diag.Exit()
     }
 
     for _,c := range o.Cases {
         t := c.Expr.GetType()
-        if !compatible(o.Type, t) {
-            fmt.Fprintln(os.Stderr, "[ERROR] expected every case body to return the same type but got:")
+        if !state.compatible(o.Type, t) {
+            state.diag.Error("expected every case body to return the same type but got:")
             for i,c := range o.Cases {
-                fmt.Fprintf(os.Stderr, "\tcase%d: %v\n", i, c.Expr.GetType())
+                state.diag.Linef("case%d: %v", i, c.Expr.GetType())
             }
-            fmt.Fprintln(os.Stderr, "\t" + o.At())
-            os.Exit(1)
+            state.diag.At(o.At())
+            state.diag.Exit()
         }
     }
 
     for _,c := range o.Cases {
-        typeCheckXCase(&c)
+        state.typeCheckXCase(&c)
     }
 
-    exhaustedXCases(o)
+    state.exhaustedXCases(o)
 
     for i,c := range o.Cases {
         if c.Cond == nil && i != len(o.Cases)-1 {
             i = len(o.Cases)-1 - i
             if i == 1 {
-                fmt.Fprintln(os.Stderr, "[ERROR] one case after the default case (unreachable code)")
+                state.diag.Error("one case after the default case (unreachable code)")
             } else {
-                fmt.Fprintf(os.Stderr, "[ERROR] %d cases after the default case (unreachable code)\n", i)
+                state.diag.Errorf("%d cases after the default case (unreachable code)", i)
             }
-            fmt.Fprintln(os.Stderr, "\t" + c.ColonPos.At())
-            os.Exit(1)
+            state.diag.At(c.ColonPos.At())
+            state.diag.Exit()
         }
     }
 }
@@ -398,17 +445,25 @@ func xcasesToUnwraps(e *ast.XSwitch) (unwraps []*ast.Unwrap, lastPost string) {
     return unwraps, e.Cases[len(e.Cases)-1].At()
 }
 
-func exhaustedXCases(e *ast.XSwitch) {
+func xcasesConds(e *ast.XSwitch) []ast.Expr {
+    conds := make([]ast.Expr, 0, len(e.Cases))
+    for _,c := range e.Cases {
+        conds = append(conds, c.Cond)
+    }
+    return conds
+}
+
+func (state *State) exhaustedXCases(e *ast.XSwitch) {
     if _,ok := e.Cases[0].Cond.(*ast.Unwrap); ok {
-        exhaustedUnwraps(xcasesToUnwraps(e))
-    } else if e.Cases[len(e.Cases)-1].Cond != nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] every xswitch requires a default case")
-        fmt.Fprintln(os.Stderr, "\t" + e.End())
-        os.Exit(1)
+        state.exhaustedUnwraps(xcasesToUnwraps(e))
+    } else if !state.exhaustedValues(xcasesConds(e), e.BraceRPos.At()) && e.Cases[len(e.Cases)-1].Cond != nil {
+        state.diag.Error("every xswitch requires a default case")
+        state.diag.At(e.End())
+        state.diag.Exit()
     }
 }
 
-func exhaustedUnwraps(unwraps []*ast.Unwrap, lastPost string) {
+func (state *State) exhaustedUnwraps(unwraps []*ast.Unwrap, lastPost string) {
     expectedElems := unwraps[0].EnumType.GetElems()
     usedElems := make(map[string]bool, len(expectedElems))
 
@@ -419,126 +474,142 @@ func exhaustedUnwraps(unwraps []*ast.Unwrap, lastPost string) {
     for _,u := range unwraps {
         if u == nil {
             if len(unwraps) > len(expectedElems) {
-                fmt.Fprintln(os.Stderr, "[ERROR] redundant default case")
-                fmt.Fprintln(os.Stderr, "\t" + lastPost)
-                os.Exit(1)
+                state.diag.Error("redundant default case")
+                state.diag.At(lastPost)
+                state.diag.Exit()
             }
             return
         }
 
         if used := usedElems[u.ElemName.Str]; used {
-            fmt.Fprintf(os.Stderr, "[ERROR] duplicate enum field %s.%s\n", u.EnumType, u.ElemName.Str)
-            fmt.Fprintln(os.Stderr, "\t" + u.ElemName.At())
-            os.Exit(1)
+            state.diag.Errorf("duplicate enum field %s.%s", u.EnumType, u.ElemName.Str)
+            state.diag.At(u.ElemName.At())
+            state.diag.Exit()
         }
 
         usedElems[u.ElemName.Str] = true
     }
 
-    if len(unwraps) < len(expectedElems) {
-        missing := make([]string, 0, len(expectedElems))
-        for elem,used := range usedElems {
-            if !used {
-                missing = append(missing, elem)
-            }
-        }
-
-        fmt.Fprintln(os.Stderr, "[ERROR] cases are not exhausted")
-        fmt.Fprintf(os.Stderr, "\texpected: %v\n", expectedElems)
-        fmt.Fprintf(os.Stderr, "\tmissing: %v\n", missing)
-        fmt.Fprintln(os.Stderr, "\t" + unwraps[len(unwraps)-1].End())
-        os.Exit(1)
-    }
+    state.notExhausted(expectedElems, usedElems, unwraps[len(unwraps)-1].End())
 }
 
-func typeCheckFnCall(o *ast.FnCall) {
+func (state *State) typeCheckFnCall(o *ast.FnCall) {
     if o.F.IsGeneric() {
         if o.InsetType == nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] function %s is generic but got no generic typ passed\n", o.F.GetName())
-            fmt.Fprintln(os.Stderr, "\t" + o.At())
-            os.Exit(1)
+            state.diag.Errorf("function %s is generic but got no generic typ passed", o.F.GetName())
+            state.diag.At(o.At())
+            state.diag.Exit()
         }
 
         if guard,ok := o.F.Generic.Typ.Guard.(types.InterfaceType); ok && guard.Name != "" {
-            if !identObj.HasInterface(o.InsetType, guard.Name) {
-                fmt.Fprintf(os.Stderr, "[ERROR] insetType \"%v\" does not implement interface \"%v\" required by generic guard\n", o.InsetType, guard)
-                fmt.Fprintln(os.Stderr, "\t" + o.At())
-                os.Exit(1)
+            if !state.identObj.HasInterface(o.InsetType, guard.Name) {
+                state.diag.Errorf("insetType \"%v\" does not implement interface \"%v\" required by generic guard", o.InsetType, guard)
+                state.diag.At(o.At())
+                state.identObj.NoteInterfaceDecl(guard.Name)
+                state.diag.Exit()
             }
         }
     }
 
+    if buildin.IsArith(o.Ident.Name) {
+        if t := types.ResolveGeneric(o.InsetType); t == nil || (t.GetKind() != types.Int && t.GetKind() != types.Uint) {
+            state.diag.Errorf("%s expects two ints/uints of the same type but got %v", o.Ident.Name, o.InsetType)
+            state.diag.At(o.At())
+            state.diag.Exit()
+        }
+    }
+
     if len(o.F.GetArgs()) != len(o.Values) {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected %d args for function \"%s\" but got %d\n", len(o.F.GetArgs()), o.F.GetName(), len(o.Values))
-        fmt.Fprintf(os.Stderr, "\texpected: %v\n", o.F.GetArgs())
-        fmt.Fprintf(os.Stderr, "\tgot:      %v\n", valuesToTypes(o.Values))
-        fmt.Fprintln(os.Stderr, "\t" + o.At())
-        os.Exit(1)
+        state.diag.Errorf("expected %d args for function \"%s\" but got %d", len(o.F.GetArgs()), o.F.GetName(), len(o.Values))
+        state.diag.Linef("expected: %v", o.F.GetArgs())
+        state.diag.Linef("got:      %v", valuesToTypes(o.Values))
+        state.diag.At(o.At())
+        state.diag.Exit()
     }
 
     for i, t1 := range o.F.GetArgs() {
-        if !checkTypeExpr(t1, o.Values[i]) {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected %v as arg %d but got %v for function \"%s\"\n", t1, i, o.Values[i].GetType(), o.F.GetName())
-            fmt.Fprintf(os.Stderr, "\texpected: %v\n", o.F.GetArgs())
-            fmt.Fprintf(os.Stderr, "\tgot:      %v\n", valuesToTypes(o.Values))
-            fmt.Fprintln(os.Stderr, "\t" + o.At())
-            os.Exit(1)
+        if !state.checkTypeExpr(t1, o.Values[i]) {
+            state.diag.Errorf("expected %v as arg %d but got %v for function \"%s\"", t1, i, o.Values[i].GetType(), o.F.GetName())
+            state.diag.Linef("expected: %v", o.F.GetArgs())
+            state.diag.Linef("got:      %v", valuesToTypes(o.Values))
+            state.diag.At(o.At())
+            state.diag.Exit()
         }
     }
 
     if o.FnSrc != nil {
-        if !identObj.HasFunc(o.FnSrc, o.Ident.Name) {
-            fmt.Fprintf(os.Stderr, "[ERROR] %s does not implement function %s\n", o.FnSrc, o.Ident.Name)
-            fmt.Fprintln(os.Stderr, "\t" + o.At())
-            os.Exit(1)
+        if !state.identObj.HasFunc(o.FnSrc, o.Ident.Name) {
+            state.diag.Errorf("%s does not implement function %s", o.FnSrc, o.Ident.Name)
+            state.diag.Suggest(o.Ident.Name, state.identObj.FuncNames(o.FnSrc))
+            state.diag.At(o.At())
+            if interfaceType,ok := o.FnSrc.(types.InterfaceType); ok {
+                state.identObj.NoteInterfaceDecl(interfaceType.Name)
+            }
+            state.diag.Exit()
         }
 
         if o.F.GetSrcObj() != nil {
             if interfaceType,ok := o.FnSrc.(types.InterfaceType); ok {
-                if !identObj.HasInterface(o.F.GetSrcObj(), interfaceType.Name) {
-                    fmt.Fprintf(os.Stderr, "[ERROR] %s does not implement %s\n", o.F.GetSrcObj(), o.FnSrc)
-                    fmt.Fprintln(os.Stderr, "\t" + o.At())
-                    os.Exit(1)
+                if !state.identObj.HasInterface(o.F.GetSrcObj(), interfaceType.Name) {
+                    state.diag.Errorf("%s does not implement %s", o.F.GetSrcObj(), o.FnSrc)
+                    state.diag.At(o.At())
+                    state.identObj.NoteInterfaceDecl(interfaceType.Name)
+                    state.diag.Exit()
                 }
             }
         }
     }
 }
 
-func typeCheckFmtCall(o *ast.FnCall) {
+func (state *State) typeCheckFmtCall(o *ast.FnCall) {
     for _,a := range o.Values {
-        typeCheckExpr(a)
+        state.typeCheckExpr(a)
     }
 
     if len(o.Values) < 2 {
         if len(o.Values) == 1 {
-            fmt.Fprintln(os.Stderr, "[ERROR] fmt got no arguments to format (only format string)")
-            fmt.Fprintln(os.Stderr, "\t" + o.ParenRPos.At())
-            os.Exit(1)
+            state.diag.Error("fmt got no arguments to format (only format string)")
+            state.diag.At(o.ParenRPos.At())
+            state.diag.Exit()
         } else {
-            fmt.Fprintln(os.Stderr, "[ERROR] fmt got no arguments (missing format string and args to format)")
-            fmt.Fprintln(os.Stderr, "\t" + o.ParenLPos.At())
-            os.Exit(1)
+            state.diag.Error("fmt got no arguments (missing format string and args to format)")
+            state.diag.At(o.ParenLPos.At())
+            state.diag.Exit()
         }
     }
 
     if fmtStr,ok := o.Values[0].(*ast.StrLit); ok {
         if len(fmtStr.Val.Str) < 4 {
-            fmt.Fprintf(os.Stderr, "[ERROR] %v is not a valid format string (missing {})\n", fmtStr.Val)
-            fmt.Fprintln(os.Stderr, "\t" + fmtStr.At())
-            os.Exit(1)
+            state.diag.Errorf("%v is not a valid format string (missing {})", fmtStr.Val)
+            state.diag.At(fmtStr.At())
+            state.diag.Exit()
         }
     } else {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected string literal as format string but got %s (%s)\n", fmtStr.Val, reflect.TypeOf(fmtStr))
-        fmt.Fprintln(os.Stderr, "\t" + fmtStr.At())
-        os.Exit(1)
+        state.diag.Errorf("expected string literal as format string but got %s (%s)", fmtStr.Val, reflect.TypeOf(fmtStr))
+        state.diag.At(fmtStr.At())
+        state.diag.Exit()
     }
 
     for _,v := range o.Values[1:] {
-        if !identObj.HasInterface(v.GetType(), "String") {
-            fmt.Fprintf(os.Stderr, "[ERROR] %s does not implement String\n", v.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + o.At())
-            os.Exit(1)
+        if v.GetType() == nil {
+            if call,ok := v.(*ast.FnCall); ok {
+                name := call.Ident.Name
+                if call.FnSrc != nil {
+                    name = fmt.Sprintf("%v.%s", call.FnSrc, name)
+                }
+                state.diag.Errorf("%s returns nothing (void) and cannot be formatted", name)
+            } else {
+                state.diag.Error("void value cannot be formatted")
+            }
+            state.diag.At(v.At())
+            state.diag.Exit()
+        }
+
+        if !state.identObj.HasInterface(v.GetType(), "String") {
+            state.diag.Errorf("%s does not implement String", v.GetType())
+            state.diag.At(o.At())
+            state.identObj.NoteInterfaceDecl("String")
+            state.diag.Exit()
         }
     }
 }
@@ -559,7 +630,7 @@ func fieldsToTypes(fields []ast.FieldLit) (res []types.Type) {
     return res
 }
 
-func typeCheckCast(e *ast.Cast) {
+func (state *State) typeCheckCast(e *ast.Cast) {
     t := e.Expr.GetType()
 
     switch e.DestType.GetKind() {
@@ -567,25 +638,30 @@ func typeCheckCast(e *ast.Cast) {
         switch t.GetKind() {
         case types.Ptr:
             if e.DestType.GetKind() != types.Uint || e.DestType.Size() != types.Ptr_Size {
-                fmt.Fprintf(os.Stderr, "[ERROR] you can cast a pointer only into an u64 (got %v)\n", t)
-                fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-                os.Exit(1)
+                state.diag.Errorf("you can cast a pointer only into an u64 (got %v)", t)
+                state.diag.At(e.Expr.At())
+                state.diag.Exit()
             }
 
         case types.Enum:
             t := t.(types.EnumType)
-            if !compatible(e.DestType, t.IdType) {
-                fmt.Fprintf(os.Stderr, "[ERROR] id type of enum %s is %s (cannot cast into %v)\n", t.Name, t.IdType, e.DestType)
-                fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-                os.Exit(1)
+            if t.IsNiche() {
+                state.diag.Errorf("enum %v has no id (it is stored as the pointer, use an unwrap instead)", t)
+                state.diag.At(e.Expr.At())
+                state.diag.Exit()
+            }
+            if !state.compatible(e.DestType, t.IdType) {
+                state.diag.Errorf("id type of enum %s is %s (cannot cast into %v)", t.Name, t.IdType, e.DestType)
+                state.diag.At(e.Expr.At())
+                state.diag.Exit()
             }
 
         case types.Bool, types.Uint, types.Int, types.Char:
 
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] cannot cast %v into %v\n", t, e.DestType)
-            fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-            os.Exit(1)
+            state.diag.Errorf("cannot cast %v into %v", t, e.DestType)
+            state.diag.At(e.Expr.At())
+            state.diag.Exit()
         }
 
 
@@ -595,9 +671,9 @@ func typeCheckCast(e *ast.Cast) {
             dstType := e.DestType.(types.PtrType).BaseType
 
             if dstType.GetKind() != types.Char {
-                fmt.Fprintf(os.Stderr, "[ERROR] you can only cast a string into *char (got %v)\n", t)
-                fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-                os.Exit(1)
+                state.diag.Errorf("you can only cast a string into *char (got %v)", t)
+                state.diag.At(e.Expr.At())
+                state.diag.Exit()
             }
 
         case types.Arr:
@@ -605,9 +681,9 @@ func typeCheckCast(e *ast.Cast) {
             srcTyp := t.(types.ArrType).BaseType
 
             if dstTyp.GetKind() != srcTyp.GetKind() {
-                fmt.Fprintf(os.Stderr, "[ERROR] you can only cast an array into a pointer with the same baseType (got %v)\n", t)
-                fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-                os.Exit(1)
+                state.diag.Errorf("you can only cast an array into a pointer with the same baseType (got %v)", t)
+                state.diag.At(e.Expr.At())
+                state.diag.Exit()
             }
 
         case types.Vec:
@@ -615,43 +691,48 @@ func typeCheckCast(e *ast.Cast) {
             srcTyp := t.(types.VecType).BaseType
 
             if dstTyp.GetKind() != srcTyp.GetKind() {
-                fmt.Fprintf(os.Stderr, "[ERROR] you can only cast a vector into a pointer with the same baseType (got %v)\n", t)
-                fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-                os.Exit(1)
+                state.diag.Errorf("you can only cast a vector into a pointer with the same baseType (got %v)", t)
+                state.diag.At(e.Expr.At())
+                state.diag.Exit()
             }
 
         case types.Int, types.Uint:
-            if !compatible(types.CreateUint(types.Ptr_Size), t) {
-                fmt.Fprintf(os.Stderr, "[ERROR] you can only cast an u64 into a pointer (got %v)\n", t)
-                fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-                os.Exit(1)
+            if !state.compatible(types.CreateUint(types.Ptr_Size), t) {
+                state.diag.Errorf("you can only cast an u64 into a pointer (got %v)", t)
+                state.diag.At(e.Expr.At())
+                state.diag.Exit()
             }
 
+            state.checkNullPtr(e)
+
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] cannot cast %v into %v\n", t, e.DestType)
-            fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-            os.Exit(1)
+            state.diag.Errorf("cannot cast %v into %v", t, e.DestType)
+            state.diag.At(e.Expr.At())
+            state.diag.Exit()
         }
 
     case types.Arr:
         if t.GetKind() != types.Ptr {
-            fmt.Fprintf(os.Stderr, "[ERROR] you can only cast a pointer into an array (got %v)\n", t)
-            fmt.Fprintln(os.Stderr, "\t" + e.Expr.At())
-            os.Exit(1)
+            state.diag.Errorf("you can only cast a pointer into an array (got %v)", t)
+            state.diag.At(e.Expr.At())
+            state.diag.Exit()
         }
 
     case types.Struct:
-        fmt.Fprintf(os.Stderr, "[ERROR] casting to a struct (%v) is not allowed\n", e.DestType)
-        fmt.Fprintln(os.Stderr, "\t" + e.AsPos.At())
-        os.Exit(1)
+        state.diag.Errorf("casting to a struct (%v) is not allowed", e.DestType)
+        state.diag.At(e.AsPos.At())
+        state.diag.Exit()
     case types.Enum:
-        fmt.Fprintf(os.Stderr, "[ERROR] casting to an enum (%v) is not allowed\n", e.DestType)
-        fmt.Fprintln(os.Stderr, "\t" + e.AsPos.At())
-        os.Exit(1)
+        state.diag.Errorf("casting to an enum (%v) is not allowed", e.DestType)
+        state.diag.At(e.AsPos.At())
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] typeCheckCast for %v is not implement yet\n", e.DestType)
-        os.Exit(1)
+        state.diag.Errorf("typeCheckCast for %v is not implement yet", e.DestType)
+        state.diag.Exit()
     }
 
-    typeCheckExpr(e.Expr)
+    // "300 as u8" truncates on purpose (see warn truncating-cast)
+    if _,ok := e.Expr.(*ast.IntLit); !ok {
+        state.typeCheckExpr(e.Expr)
+    }
 }
@@ -0,0 +1,101 @@
+package check
+
+import (
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj/vars"
+)
+
+/*
+immutable locals (gamma -edition=2):
+  * locals, args and self can only be assigned (=, +=, ...) if they are declared with mut
+  * fields of an immutable var are immutable too (fields through a pointer are not)
+  * taking the address (&x, x.f() with *self) needs mut too (the var could be set through the pointer)
+  * locals declared without a value are assigned later so they have to be mut
+in edition 1 every local is mutable (mut is allowed but changes nothing)
+*/
+
+const (
+    Edition1 uint = 1
+    Edition2 uint = 2
+)
+
+func (state *State) SetEdition(e uint) {
+    state.edition = e
+}
+
+// the local var which is changed by writing to e (nil if e is not x, x.y, (x), ... of a local var)
+func mutatedVar(e ast.Expr) *vars.LocalVar {
+    switch e := e.(type) {
+    case *ast.Ident:
+        if v,ok := e.Obj.(*vars.LocalVar); ok {
+            return v
+        }
+    case *ast.Paren:
+        return mutatedVar(e.Expr)
+    case *ast.Field:
+        if _,isPtr := types.ResolveGeneric(e.Obj.GetType()).(types.PtrType); !isPtr {
+            return mutatedVar(e.Obj)
+        }
+    }
+
+    return nil
+}
+
+func (state *State) checkMutAssign(s *ast.Assign) {
+    if state.edition < Edition2 {
+        return
+    }
+
+    if v := mutatedVar(s.Dest); v != nil && !v.IsMut() {
+        state.diag.Errorf("cannot assign to %s (%s is not mut)", destName(s.Dest), v.GetName())
+        state.diag.At(s.Pos.At())
+        state.diag.NoteAt("declare it with mut", v.GetPos().At())
+        state.diag.Exit()
+    }
+}
+
+func (state *State) checkMutAddr(e *ast.Unary) {
+    if state.edition < Edition2 {
+        return
+    }
+
+    if v := mutatedVar(e.Operand); v != nil && !v.IsMut() {
+        state.diag.Errorf("cannot take the address of %s (%s is not mut)", destName(e.Operand), v.GetName())
+        // x.f() passes &x as *self (the & has no position)
+        if e.Operator.Pos.Line == 0 {
+            state.diag.At(e.Operand.At())
+            state.diag.NoteAt("the call passes it as *self", "")
+        } else {
+            state.diag.At(e.Operator.At())
+        }
+        state.diag.NoteAt("declare it with mut", v.GetPos().At())
+        state.diag.Exit()
+    }
+}
+
+func (state *State) checkMutDecVar(d *ast.DecVar) {
+    if state.edition < Edition2 {
+        return
+    }
+
+    if v,ok := d.V.(*vars.LocalVar); ok && !v.IsMut() {
+        state.diag.Errorf("%s is declared without a value and has to be mut (it is assigned later)", v.GetName())
+        state.diag.At(v.GetPos().At())
+        state.diag.Exit()
+    }
+}
+
+// x, x.y, ... for errors
+func destName(e ast.Expr) string {
+    switch e := e.(type) {
+    case *ast.Ident:
+        return e.Name
+    case *ast.Paren:
+        return destName(e.Expr)
+    case *ast.Field:
+        return destName(e.Obj) + "." + e.FieldName.Str
+    }
+
+    return "it"
+}
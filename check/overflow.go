@@ -0,0 +1,137 @@
+package check
+
+import (
+    "fmt"
+    "math/big"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/cmpTime/constVal"
+)
+
+/*
+const expressions which overflow their type (+, -, *, / and unary -):
+  * the exact result is computed from the folded operands (the operands are checked first)
+  * int literals have to fit into their type (the literal after a unary - is checked with the -)
+  * wrapping_add, saturating_add, ... are used for intentional cases (/ only overflows with MIN / -1)
+*/
+
+func (state *State) checkOverflowBinary(e *ast.Binary) {
+    switch e.Operator.Type {
+    case token.Plus, token.Minus, token.Mul, token.Div:
+    default:
+        return
+    }
+
+    l, okL := exactInt(state.cmpTime.ConstEval(e.OperandL))
+    r, okR := exactInt(state.cmpTime.ConstEval(e.OperandR))
+    if !okL || !okR || (e.Operator.Type == token.Div && r.Sign() == 0) {
+        return
+    }
+
+    var res big.Int
+    switch e.Operator.Type {
+    case token.Plus:
+        res.Add(l, r)
+    case token.Minus:
+        res.Sub(l, r)
+    case token.Mul:
+        res.Mul(l, r)
+    case token.Div:
+        res.Quo(l, r)
+    }
+
+    state.checkFits(&res, e.GetType(), e.Operator)
+}
+
+func (state *State) checkOverflowUnary(e *ast.Unary) {
+    if e.Operator.Type != token.Minus {
+        return
+    }
+
+    var v *big.Int
+    if lit,ok := e.Operand.(*ast.IntLit); ok {
+        // -128 is an i8 even though 128 is not
+        v = new(big.Int).SetUint64(lit.Repr)
+    } else if c,ok := exactInt(state.cmpTime.ConstEval(e.Operand)); ok {
+        v = c
+    } else {
+        return
+    }
+
+    var res big.Int
+    res.Neg(v)
+    state.checkFits(&res, e.GetType(), e.Operator)
+}
+
+func (state *State) checkIntLit(e *ast.IntLit) {
+    v := new(big.Int).SetUint64(e.Repr)
+    if min, max, ok := intRange(e.GetType()); ok && v.Cmp(max) > 0 {
+        state.diag.Errorf("int literal %s overflows %v", e.Val.Str, e.GetType())
+        state.diag.At(e.At())
+        state.diag.Linef("range: %s to %s", min, max)
+        state.diag.Exit()
+    }
+}
+
+func exactInt(c constVal.ConstVal) (*big.Int, bool) {
+    switch c := c.(type) {
+    case *constVal.IntConst:
+        return big.NewInt(int64(*c)), true
+    case *constVal.UintConst:
+        return new(big.Int).SetUint64(uint64(*c)), true
+    }
+
+    return nil, false
+}
+
+// range of an int/uint type (ok is false for other types)
+func intRange(t types.Type) (min *big.Int, max *big.Int, ok bool) {
+    if t == nil {
+        return nil, nil, false
+    }
+
+    bits := t.Size() * 8
+    switch t.GetKind() {
+    case types.Int:
+        max = new(big.Int).Lsh(big.NewInt(1), bits-1)
+        min = new(big.Int).Neg(max)
+        max.Sub(max, big.NewInt(1))
+    case types.Uint:
+        max = new(big.Int).Lsh(big.NewInt(1), bits)
+        max.Sub(max, big.NewInt(1))
+        min = big.NewInt(0)
+    default:
+        return nil, nil, false
+    }
+
+    return min, max, true
+}
+
+func (state *State) checkFits(v *big.Int, t types.Type, op token.Token) {
+    min, max, ok := intRange(t)
+    if !ok || (v.Cmp(min) >= 0 && v.Cmp(max) <= 0) {
+        return
+    }
+
+    state.diag.Errorf("constant expression overflows %v (result %s)", t, v)
+    state.diag.At(op.At())
+    state.diag.Linef("range: %s to %s", min, max)
+    if op.Type == token.Div {
+        state.diag.NoteAt("MIN / -1 is the only division which overflows", "")
+    } else {
+        state.diag.NoteAt(fmt.Sprintf("use %s if the overflow is intended", intendedFns(op)), "")
+    }
+    state.diag.Exit()
+}
+
+func intendedFns(op token.Token) string {
+    switch op.Type {
+
+    case token.Mul:
+        return "wrapping_mul"
+    case token.Minus:
+        return "wrapping_sub or saturating_sub"
+    }
+    return "wrapping_add or saturating_add"
+}
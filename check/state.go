@@ -0,0 +1,26 @@
+package check
+
+import (
+    "gamma/ast/identObj"
+    "gamma/token"
+    "gamma/cmpTime"
+    "gamma/diag"
+)
+
+// options and the function being checked of one compilation (see gamma/compiler)
+type State struct {
+    edition uint
+
+    // declaration of the tracked vars in the current function
+    tracked map[identObj.IdentObj]token.Pos
+    // vars which hold addresses of locals (in the current function)
+    pointsTo map[identObj.IdentObj][]escapeSrc
+
+    identObj *identObj.State
+    cmpTime *cmpTime.State
+    diag *diag.State
+}
+
+func NewState(identObj *identObj.State, cmpTime *cmpTime.State, diag *diag.State) *State {
+    return &State{ edition: Edition1, identObj: identObj, cmpTime: cmpTime, diag: diag }
+}
@@ -1,118 +1,124 @@
 package check
 
 import (
-    "os"
-    "fmt"
     "reflect"
     "gamma/ast"
     "gamma/types"
 )
 
-func typeCheckStmt(s ast.Stmt) {
+func (state *State) typeCheckStmt(s ast.Stmt) {
     switch s := s.(type) {
     case *ast.Assign:
-        typeCheckAssign(s)
+        state.typeCheckAssign(s)
     case *ast.Block:
-        typeCheckBlock(s)
+        state.typeCheckBlock(s)
 
     case *ast.If:
-        typeCheckIf(s)
+        state.typeCheckIf(s)
     case *ast.Else:
-        typeCheckElse(s)
+        state.typeCheckElse(s)
     case *ast.Elif:
-        typeCheckElif(s)
+        state.typeCheckElif(s)
 
     case *ast.Switch:
-        typeCheckSwitch(s)
+        state.typeCheckSwitch(s)
     case *ast.Case:
-        typeCheckCase(s)
+        state.typeCheckCase(s)
 
     case *ast.For:
-        typeCheckFor(s)
+        state.typeCheckFor(s)
     case *ast.While:
-        typeCheckWhile(s)
+        state.typeCheckWhile(s)
 
     case *ast.Ret:
-        typeCheckRet(s)
+        state.typeCheckRet(s)
 
     case *ast.DeclStmt:
-        typeCheckDecl(s.Decl)
+        state.typeCheckDecl(s.Decl)
     case *ast.ExprStmt:
-        if s.Expr.GetType() != nil {
-            fmt.Fprintln(os.Stderr, "[ERROR] unused expr (explictly ignore with \"_ := \")")
-            fmt.Fprintln(os.Stderr, "\t" + s.At())
-            os.Exit(1)
+        // discarded results of calls are warnings (warn.UnusedResult)
+        if _,isCall := s.Expr.(*ast.FnCall); !isCall && s.Expr.GetType() != nil {
+            state.diag.Error("unused expr (explictly ignore with \"_ := \")")
+            state.diag.At(s.At())
+            state.diag.Exit()
         }
-        typeCheckExpr(s.Expr)
+        state.typeCheckExpr(s.Expr)
 
     case *ast.Through, *ast.Break, *ast.Continue:
         // nothing to check
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] typeCheckStmt for %v is not implemente yet\n", reflect.TypeOf(s))
-        os.Exit(1)
+        state.diag.Errorf("typeCheckStmt for %v is not implemente yet", reflect.TypeOf(s))
+        state.diag.Exit()
     }
 }
 
-func typeCheckAssign(s *ast.Assign) {
-    typeCheckExpr(s.Dest)
+func (state *State) typeCheckAssign(s *ast.Assign) {
+    state.typeCheckExpr(s.Dest)
+    state.checkMutAssign(s)
 
     t1 := s.Dest.GetType()
     t2 := s.Value.GetType()
 
-    if !checkTypeExpr(t1, s.Value) {
-        fmt.Fprintf(os.Stderr, "[ERROR] cannot assign %v with %v\n", t1, t2)
-        fmt.Fprintln(os.Stderr, "\t" + s.Pos.At())
-        os.Exit(1)
+    if !state.checkTypeExpr(t1, s.Value) {
+        state.diag.Errorf("cannot assign %v with %v", t1, t2)
+        state.diag.At(s.Pos.At())
+        state.diag.Exit()
     }
 }
 
-func typeCheckBlock(s *ast.Block) {
+func (state *State) typeCheckBlock(s *ast.Block) {
     for _,s := range s.Stmts {
-        typeCheckStmt(s)
+        state.typeCheckStmt(s)
     }
 }
 
-func typeCheckIf(s *ast.If) {
+func (state *State) typeCheckIf(s *ast.If) {
     if t := s.Cond.GetType(); t.GetKind() != types.Bool {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected an bool as if condition but got %v\n", t)
-        fmt.Fprintln(os.Stderr, "\t" + s.Pos.At())
-        os.Exit(1)
+        state.diag.Errorf("expected an bool as if condition but got %v", t)
+        state.diag.At(s.Pos.At())
+        state.diag.Exit()
     }
 
-    typeCheckExpr(s.Cond)
-    typeCheckBlock(&s.Block)
+    state.typeCheckExpr(s.Cond)
+    state.typeCheckBlock(&s.Block)
 }
 
-func typeCheckElse(s *ast.Else) {
-    typeCheckBlock(&s.Block)
+func (state *State) typeCheckElse(s *ast.Else) {
+    state.typeCheckBlock(&s.Block)
 }
 
-func typeCheckElif(s *ast.Elif) {
-    typeCheckStmt((*ast.If)(s))
+func (state *State) typeCheckElif(s *ast.Elif) {
+    state.typeCheckStmt((*ast.If)(s))
 }
 
-func typeCheckSwitch(s *ast.Switch) {
+func (state *State) typeCheckSwitch(s *ast.Switch) {
     for i,c := range s.Cases {
         // is default case last
         if c.Cond == nil && i != len(s.Cases)-1 {
             i = len(s.Cases)-1 - i
             if i == 1 {
-                fmt.Fprintln(os.Stderr, "[ERROR] one case after the default case (unreachable code)")
+                state.diag.Error("one case after the default case (unreachable code)")
             } else {
-                fmt.Fprintf(os.Stderr, "[ERROR] %d cases after the default case (unreachable code)\n", i)
+                state.diag.Errorf("%d cases after the default case (unreachable code)", i)
             }
-            fmt.Fprintln(os.Stderr, "\t" + c.ColonPos.At())
-            os.Exit(1)
+            state.diag.At(c.ColonPos.At())
+            state.diag.Exit()
         }
     }
 
     for _,c := range s.Cases {
-        typeCheckCase(&c)
+        state.typeCheckCase(&c)
     }
 
     if _,ok := s.Cases[0].Cond.(*ast.Unwrap); ok {
-        exhaustedUnwraps(casesToUnwraps(s))
+        state.exhaustedUnwraps(casesToUnwraps(s))
+    } else {
+        conds := make([]ast.Expr, 0, len(s.Cases))
+        for _,c := range s.Cases {
+            conds = append(conds, c.Cond)
+        }
+        state.exhaustedValues(conds, s.BraceRPos.At())
     }
 }
 
@@ -128,63 +134,63 @@ func casesToUnwraps(s *ast.Switch) (unwraps []*ast.Unwrap, end string) {
     return unwraps, s.Cases[len(s.Cases)-1].At()
 }
 
-func typeCheckFor(s *ast.For) {
+func (state *State) typeCheckFor(s *ast.For) {
     t := s.Def.Type
 
     if s.Limit != nil {
-        if !checkTypeExpr(t, s.Limit) {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected %v as for iterator limit type but got %v\n", t, s.Limit.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + s.ForPos.At())
-            os.Exit(1)
+        if !state.checkTypeExpr(t, s.Limit) {
+            state.diag.Errorf("expected %v as for iterator limit type but got %v", t, s.Limit.GetType())
+            state.diag.At(s.ForPos.At())
+            state.diag.Exit()
         }
     }
 
-    if !checkTypeExpr(t, s.Step) {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected %v as for iterator step type but got %v\n", t, s.Step.GetType())
-        fmt.Fprintln(os.Stderr, "\t" + s.ForPos.At())
-        os.Exit(1)
+    if !state.checkTypeExpr(t, s.Step) {
+        state.diag.Errorf("expected %v as for iterator step type but got %v", t, s.Step.GetType())
+        state.diag.At(s.ForPos.At())
+        state.diag.Exit()
     }
 
-    typeCheckBlock(&s.Block)
+    state.typeCheckBlock(&s.Block)
 }
 
-func typeCheckWhile(s *ast.While) {
+func (state *State) typeCheckWhile(s *ast.While) {
     if t := s.Cond.GetType(); t.GetKind() != types.Bool {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected an bool as while condition but got %v\n", t)
-        fmt.Fprintln(os.Stderr, "\t" + s.WhilePos.At())
-        os.Exit(1)
+        state.diag.Errorf("expected an bool as while condition but got %v", t)
+        state.diag.At(s.WhilePos.At())
+        state.diag.Exit()
     }
 
-    typeCheckBlock(&s.Block)
+    state.typeCheckBlock(&s.Block)
 }
 
-func typeCheckRet(s *ast.Ret) {
+func (state *State) typeCheckRet(s *ast.Ret) {
     t := s.F.GetRetType()
 
     if t == nil {
         if s.RetExpr != nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected nothing to return but got %v\n", s.RetExpr.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + s.At())
-            os.Exit(1)
+            state.diag.Errorf("expected nothing to return but got %v", s.RetExpr.GetType())
+            state.diag.At(s.At())
+            state.diag.Exit()
         }
     } else {
-        if !checkTypeExpr(t, s.RetExpr) {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected to return %v but got %v\n", t, s.RetExpr.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + s.At())
-            os.Exit(1)
+        if !state.checkTypeExpr(t, s.RetExpr) {
+            state.diag.Errorf("expected to return %v but got %v", t, s.RetExpr.GetType())
+            state.diag.At(s.At())
+            state.diag.Exit()
         }
     }
 }
 
-func typeCheckCase(s *ast.Case) {
+func (state *State) typeCheckCase(s *ast.Case) {
     if s.Cond != nil {
-        typeCheckExpr(s.Cond)
+        state.typeCheckExpr(s.Cond)
         if t := s.Cond.GetType(); t.GetKind() != types.Bool {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a condition of type bool but got \"%v\"\n", t)
-            fmt.Fprintln(os.Stderr, "\t" + s.ColonPos.At())
-            os.Exit(1)
+            state.diag.Errorf("expected a condition of type bool but got \"%v\"", t)
+            state.diag.At(s.ColonPos.At())
+            state.diag.Exit()
         }
     }
 
-    typeCheckStmt(s.Stmt)
+    state.typeCheckStmt(s.Stmt)
 }
@@ -2,24 +2,23 @@ package check
 
 import (
 	"gamma/ast"
-	"gamma/ast/identObj"
 	"gamma/types"
 )
 
-func TypeCheckNode(n ast.Node) {
+func (state *State) TypeCheckNode(n ast.Node) {
     switch n := n.(type) {
     case ast.Expr:
-        typeCheckExpr(n)
+        state.typeCheckExpr(n)
 
     case ast.Stmt:
-        typeCheckStmt(n)
+        state.typeCheckStmt(n)
 
     case ast.Decl:
-        typeCheckDecl(n)
+        state.typeCheckDecl(n)
     }
 }
 
-func compatibleBinaryOp(t1 types.Type, t2 types.Type) bool {
+func (state *State) compatibleBinaryOp(t1 types.Type, t2 types.Type) bool {
     switch t := t1.(type) {
     case types.IntType:
         if t2,ok := t2.(types.IntType); ok {
@@ -38,18 +37,18 @@ func compatibleBinaryOp(t1 types.Type, t2 types.Type) bool {
         if _,ok := t2.(types.PtrType); ok {
             return true
         }
-        return compatible(types.CreateUint(types.Ptr_Size), t2)
+        return state.compatible(types.CreateUint(types.Ptr_Size), t2)
 
     default:
-        return compatible(t1, t2)
+        return state.compatible(t1, t2)
     }
 
     return false
 }
 
-func compatible(destType types.Type, srcType types.Type) bool {
+func (state *State) compatible(destType types.Type, srcType types.Type) bool {
     interfacesEqFunc := func(destType types.Type, srcType types.Type)bool {
-        return identObj.HasInterface(srcType, destType.String())
+        return state.identObj.HasInterface(srcType, destType.String())
     }
 
     return types.EqualCustom(destType, srcType, interfacesEqFunc)
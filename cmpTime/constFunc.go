@@ -1,45 +1,41 @@
 package cmpTime
 
 import (
-    "os"
-    "fmt"
     "gamma/ast"
     "gamma/token"
     "gamma/cmpTime/constVal"
 )
 
-var funcs map[string]constFunc = make(map[string]constFunc)
-
 type constFunc struct {
     fn ast.DefFn
     // TODO save result (depending on args)
 }
 
-func (c constFunc) eval(args []constVal.ConstVal) constVal.ConstVal {
+func (state *State) evalConstFunc(c constFunc, args []constVal.ConstVal) constVal.ConstVal {
     framesize := c.fn.FnHead.F.Scope.ArgsSize() + c.fn.FnHead.F.Scope.GetInnerSize()
-    startScope(framesize)
-    defer endScope()
+    state.startScope(framesize)
+    defer state.endScope()
 
     for i,a := range c.fn.FnHead.Args {
-        defVar(a.V.GetName(), a.V.Addr(), a.V.GetType(), a.TypePos, args[i])
+        state.defVar(a.V.GetName(), a.V.Addr(), a.V.GetType(), a.TypePos, args[i])
     }
 
-    return evalBlock(&c.fn.Block)
+    return state.evalBlock(&c.fn.Block)
 }
 
-func AddConstFunc(fn ast.DefFn) {
-    funcs[fn.FnHead.F.GetName()] = constFunc{ fn: fn }
+func (state *State) AddConstFunc(fn ast.DefFn) {
+    state.funcs[fn.FnHead.F.GetName()] = constFunc{ fn: fn }
 }
 
-func EvalFunc(name string, pos token.Pos, args []constVal.ConstVal) constVal.ConstVal {
-    if f,ok := funcs[name]; ok {
-        return f.eval(args)
+func (state *State) EvalFunc(name string, pos token.Pos, args []constVal.ConstVal) constVal.ConstVal {
+    if f,ok := state.funcs[name]; ok {
+        return state.evalConstFunc(f, args)
     }
 
-    if inConstEnv() {
-        fmt.Fprintf(os.Stderr, "[ERROR] %s is not a const func\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+    if state.inConstEnv() {
+        state.diag.Errorf("%s is not a const func", name)
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
     return nil
@@ -1,7 +1,6 @@
 package constVal
 
 import (
-    "os"
     "fmt"
     "gamma/types"
     "gamma/types/addr"
@@ -60,6 +59,10 @@ func (c *ArrConst)    GetVal() string { return fmt.Sprintf("_arr%d", c.Idx) }
 func (c *PtrConst)    GetVal() string { return c.Addr.String() }
 func (c *EnumConst)   GetVal() string { 
     if c.Elem == nil {
+        // niche enums store 0 instead of the id
+        if c.Type.IsNiche() {
+            return "0"
+        }
         return fmt.Sprint(c.Id)
     } else {
         return c.Elem.GetVal()
@@ -67,7 +70,5 @@ func (c *EnumConst)   GetVal() string {
 }
 
 func (c *StructConst) GetVal() string {
-    fmt.Fprintln(os.Stderr, "[ERROR] (internal) StructConst.GetVal() got called")
-    os.Exit(1)
-    return ""
+    panic("(internal) StructConst.GetVal() got called")
 }
@@ -1,37 +1,38 @@
 package cmpTime
 
 import (
-    "os"
-    "fmt"
     "reflect"
     "gamma/ast"
 )
 
-func evalDecl(d ast.Decl) {
+func (state *State) evalDecl(d ast.Decl) {
     switch d := d.(type) {
     case *ast.DefVar:
-        if val := ConstEval(d.Value); val != nil {
-            defVar(d.V.GetName(), d.V.Addr(), d.V.GetType(), d.V.GetPos(), val)
+        if val := state.ConstEval(d.Value); val != nil {
+            state.defVar(d.V.GetName(), d.V.Addr(), d.V.GetType(), d.V.GetPos(), val)
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a const value to define %v\n", d.V.GetName())
-            fmt.Fprintln(os.Stderr, "\t" + d.At())
-            os.Exit(1)
+            state.diag.Errorf("expected a const value to define %v", d.V.GetName())
+            state.diag.At(d.At())
+            state.diag.Exit()
         }
 
+    case *ast.DecVar:
+        state.decVar(d.V.GetName(), d.V.Addr(), d.V.GetType(), d.V.GetPos())
+
     case *ast.DefConst:
-        if val := ConstEval(d.Value); val != nil {
-            defConst(d.C.GetName(), d.C.GetPos(), val)
+        if val := state.ConstEval(d.Value); val != nil {
+            state.defConst(d.C.GetName(), d.C.GetPos(), val)
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a const value to define %v\n", d.C.GetName())
-            fmt.Fprintln(os.Stderr, "\t" + d.At())
-            os.Exit(1)
+            state.diag.Errorf("expected a const value to define %v", d.C.GetName())
+            state.diag.At(d.At())
+            state.diag.Exit()
         }
 
     case *ast.BadDecl:
-        fmt.Fprintln(os.Stderr, "[ERROR] bad declaration")
-        os.Exit(1)
+        state.diag.Error("bad declaration")
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] evalDecl for %v is not implemente yet\n", reflect.TypeOf(d))
-        os.Exit(1)
+        state.diag.Errorf("evalDecl for %v is not implemente yet", reflect.TypeOf(d))
+        state.diag.Exit()
     }
 }
@@ -1,21 +1,21 @@
 package cmpTime
 
 import (
-    "os"
-    "fmt"
     "reflect"
+    "strings"
+    "math/big"
     "gamma/token"
     "gamma/types"
     "gamma/types/addr"
-    "gamma/gen/asm/x86_64"
     "gamma/cmpTime/constVal"
     "gamma/ast"
     "gamma/ast/identObj"
     "gamma/ast/identObj/vars"
+    "gamma/buildin"
 )
 
-func ConstEvalInt(e ast.Expr) (int64, bool) {
-    if c := ConstEval(e); c != nil {
+func (state *State) ConstEvalInt(e ast.Expr) (int64, bool) {
+    if c := state.ConstEval(e); c != nil {
         switch c := c.(type) {
         case *constVal.IntConst:
             return int64(*c), true
@@ -27,8 +27,8 @@ func ConstEvalInt(e ast.Expr) (int64, bool) {
     return 0, false
 }
 
-func ConstEvalUint(e ast.Expr) (uint64, bool) {
-    if c := ConstEval(e); c != nil {
+func (state *State) ConstEvalUint(e ast.Expr) (uint64, bool) {
+    if c := state.ConstEval(e); c != nil {
         switch c := c.(type) {
         case *constVal.IntConst:
             if int64(*c) >= 0 {
@@ -42,15 +42,15 @@ func ConstEvalUint(e ast.Expr) (uint64, bool) {
     return 0, false
 }
 
-func ConstEvalArrWithNils(e ast.Expr) constVal.ConstVal {
-    return constEval(e, true)
+func (state *State) ConstEvalArrWithNils(e ast.Expr) constVal.ConstVal {
+    return state.constEval(e, true)
 }
 
-func ConstEval(e ast.Expr) constVal.ConstVal {
-    return constEval(e, false)
+func (state *State) ConstEval(e ast.Expr) constVal.ConstVal {
+    return state.constEval(e, false)
 }
 
-func constEval(e ast.Expr, arrWithNils bool) constVal.ConstVal {
+func (state *State) constEval(e ast.Expr, arrWithNils bool) constVal.ConstVal {
     switch e := e.(type) {
     case *ast.IntLit:
         if e.Type.GetKind() == types.Int {
@@ -72,11 +72,11 @@ func constEval(e ast.Expr, arrWithNils bool) constVal.ConstVal {
         elems := make([]constVal.ConstVal, 0, len(e.Values))
         if arrWithNils {
             for _,v := range e.Values {
-                elems = append(elems, ConstEvalArrWithNils(v)) 
+                elems = append(elems, state.ConstEvalArrWithNils(v)) 
             }
         } else {
             for _,v := range e.Values {
-                c := ConstEval(v)
+                c := state.ConstEval(v)
                 if c == nil {
                     return nil
                 }
@@ -88,48 +88,52 @@ func constEval(e ast.Expr, arrWithNils bool) constVal.ConstVal {
     case *ast.VectorLit:
         return nil
     case *ast.StructLit:
-        return ConstEvalStructLit(e)
+        return state.ConstEvalStructLit(e)
     case *ast.FieldLit:
-        return ConstEval(e.Value)
+        return state.ConstEval(e.Value)
 
     case *ast.Indexed:
-        return ConstEvalIndexed(e)
+        return state.ConstEvalIndexed(e)
     case *ast.Field:
-        return ConstEvalField(e)
+        return state.ConstEvalField(e)
 
     case *ast.EnumLit:
         var elem constVal.ConstVal = nil
         if e.Content != nil {
-            elem = ConstEval(e.Content.Expr)
+            elem = state.ConstEval(e.Content.Expr)
             if elem == nil { return nil }
         }
         return &constVal.EnumConst{ Id: e.Type.GetElemID(e.ElemName.Str), Type: e.Type, ElemType: e.Type.GetType(e.ElemName.Str), Elem: elem } 
 
     case *ast.Unwrap:
-        return ConstEvalUnwrap(e)
+        return state.ConstEvalUnwrap(e)
 
     case *ast.Ident:
-        return ConstEvalIdent(e)
+        return state.ConstEvalIdent(e)
 
     case *ast.FnCall:
-        if e.Ident.Name == "sizeof" {
+        switch e.Ident.Name {
+        case "sizeof":
             return ConstEvalSizeof(e)
-        } else {
-            return ConstEvalFnCall(e)
+        default:
+            if buildin.IsArith(e.Ident.Name) {
+                return state.ConstEvalArithBuildIn(e)
+            }
+            return state.ConstEvalFnCall(e)
         }
 
     case *ast.Unary:
-        return ConstEvalUnary(e)
+        return state.ConstEvalUnary(e)
     case *ast.Binary:
-        return ConstEvalBinary(e)
+        return state.ConstEvalBinary(e)
     case *ast.Paren:
-        return ConstEvalParen(e)
+        return state.ConstEvalParen(e)
 
     case *ast.XSwitch:
-        return ConstEvalXSwitch(e)
+        return state.ConstEvalXSwitch(e)
 
     case *ast.Cast:
-        c := ConstEval(e.Expr)
+        c := state.ConstEval(e.Expr)
         if i,ok := c.(*constVal.IntConst); ok && e.DestType.GetKind() == types.Uint {
             switch e.DestType.Size() {
             case 1:
@@ -149,24 +153,24 @@ func constEval(e ast.Expr, arrWithNils bool) constVal.ConstVal {
         return c
 
     case *ast.BadExpr:
-        fmt.Fprintln(os.Stderr, "[ERROR] bad expression")
-        os.Exit(1)
+        state.diag.Error("bad expression")
+        state.diag.Exit()
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] ConstEval for %v is not implemente yet\n", reflect.TypeOf(e))
-        os.Exit(1)
+        state.diag.Errorf("ConstEval for %v is not implemente yet", reflect.TypeOf(e))
+        state.diag.Exit()
     }
 
     return nil
 }
 
-func ConstEvalUnwrap(e *ast.Unwrap) constVal.ConstVal {
-    if c,ok := ConstEval(e.SrcExpr).(*constVal.EnumConst); ok {
-        if inConstEnv() {
+func (state *State) ConstEvalUnwrap(e *ast.Unwrap) constVal.ConstVal {
+    if c,ok := state.ConstEval(e.SrcExpr).(*constVal.EnumConst); ok {
+        if state.inConstEnv() {
             if v,ok := e.Obj.(*vars.LocalVar); ok {
-                v.SetOffset(identObj.GetStackSize(), false)
-                identObj.IncStackSize(v.GetType())
-                defVar(e.Obj.GetName(), e.Obj.Addr(), e.Obj.GetType(), e.Obj.GetPos(), c.Elem)
+                v.SetOffset(state.identObj.GetStackSize(), false)
+                state.identObj.IncStackSize(v.GetType())
+                state.defVar(e.Obj.GetName(), e.Obj.Addr(), e.Obj.GetType(), e.Obj.GetPos(), c.Elem)
             }
         }
 
@@ -177,28 +181,28 @@ func ConstEvalUnwrap(e *ast.Unwrap) constVal.ConstVal {
     return nil
 }
 
-func ConstEvalIdent(e *ast.Ident) constVal.ConstVal {
+func (state *State) ConstEvalIdent(e *ast.Ident) constVal.ConstVal {
     if c,ok := e.Obj.(*identObj.Const); ok {
         return c.GetVal()
     }
 
-    if inConstEnv() {
-        if val := getVal(e.Name, e.Pos); val != nil {
+    if state.inConstEnv() {
+        if val := state.getVal(e.Name, e.Pos); val != nil {
             return val
         }
 
-        fmt.Fprintf(os.Stderr, "[ERROR] %s is not declared\n", e.Name)
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("%s is not declared", e.Name)
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 
     return nil
 }
 
-func ConstEvalIndexed(e *ast.Indexed) constVal.ConstVal {
+func (state *State) ConstEvalIndexed(e *ast.Indexed) constVal.ConstVal {
     idxExpr := e.Flatten()
-    if idx,ok := ConstEvalUint(idxExpr); ok {
-        if arr,ok := ConstEval(e.ArrExpr).(*constVal.ArrConst); ok {
+    if idx,ok := state.ConstEvalUint(idxExpr); ok {
+        if arr,ok := state.ConstEval(e.ArrExpr).(*constVal.ArrConst); ok {
             return arr.Elems[idx]
         }
     }
@@ -206,11 +210,11 @@ func ConstEvalIndexed(e *ast.Indexed) constVal.ConstVal {
     return nil
 }
 
-func ConstEvalStructLit(e *ast.StructLit) constVal.ConstVal {
+func (state *State) ConstEvalStructLit(e *ast.StructLit) constVal.ConstVal {
     res := make([]constVal.ConstVal, len(e.Fields))
 
     for i,v := range e.Fields {
-        c := ConstEval(v.Value)
+        c := state.ConstEval(v.Value)
         if c == nil {
             return nil
         }
@@ -220,25 +224,29 @@ func ConstEvalStructLit(e *ast.StructLit) constVal.ConstVal {
     return &constVal.StructConst{ Type: e.StructType, Fields: res }
 }
 
-func ConstEvalField(e *ast.Field) constVal.ConstVal {
+func (state *State) ConstEvalField(e *ast.Field) constVal.ConstVal {
     if t,ok := e.Obj.GetType().(types.ArrType); ok {
         l := t.Len
         return (*constVal.UintConst)(&l)
     } else {
-        if c := ConstEval(e.Obj); c != nil {
+        if c := state.ConstEval(e.Obj); c != nil {
             if strct,ok := c.(*constVal.StructConst); ok {
                 if i := e.StructType.GetFieldNum(e.FieldName.Str); i != -1 {
+                    // S{} has no field values (zero initialized)
+                    if i >= len(strct.Fields) {
+                        return nil
+                    }
                     return strct.Fields[i]
                 } else {
-                    fmt.Fprintf(os.Stderr, "[ERROR] struct %s has no %s field\n", e.StructType.Name, e.FieldName)
-                    fmt.Fprintf(os.Stderr, "\tfields: %v\n", e.StructType.GetFields())
-                    fmt.Fprintln(os.Stderr, "\t" + e.At())
-                    os.Exit(1)
+                    state.diag.Errorf("struct %s has no %s field", e.StructType.Name, e.FieldName)
+                    state.diag.Linef("fields: %v", e.StructType.GetFields())
+                    state.diag.At(e.At())
+                    state.diag.Exit()
                 }
             } else {
-                fmt.Fprintf(os.Stderr, "[ERROR] expected a *constVal.StructConst but got %v\n", reflect.TypeOf(c))
-                fmt.Fprintln(os.Stderr, "\t" + e.At())
-                os.Exit(1)
+                state.diag.Errorf("expected a *constVal.StructConst but got %v", reflect.TypeOf(c))
+                state.diag.At(e.At())
+                state.diag.Exit()
             }
         }
     }
@@ -246,8 +254,8 @@ func ConstEvalField(e *ast.Field) constVal.ConstVal {
     return nil
 }
 
-func ConstEvalUnary(e *ast.Unary) constVal.ConstVal {
-    val := ConstEval(e.Operand)
+func (state *State) ConstEvalUnary(e *ast.Unary) constVal.ConstVal {
+    val := state.ConstEval(e.Operand)
 
     switch e.Operator.Type {
     case token.Minus:
@@ -274,16 +282,16 @@ func ConstEvalUnary(e *ast.Unary) constVal.ConstVal {
         return val
 
     case token.Mul:
-        if inConstEnv() {
+        if state.inConstEnv() {
             if t,ok := e.Operand.GetType().(types.PtrType); ok {
-                if ptr,ok := ConstEval(e.Operand).(*constVal.PtrConst); ok {
-                    return getValAddr(ptr.Addr, t.BaseType)
+                if ptr,ok := state.ConstEval(e.Operand).(*constVal.PtrConst); ok {
+                    return state.getValAddr(ptr.Addr, t.BaseType)
                 }
             }
 
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a pointer type to dereference but got %v\n", e.Operand.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + e.At())
-            os.Exit(1)
+            state.diag.Errorf("expected a pointer type to dereference but got %v", e.Operand.GetType())
+            state.diag.At(e.At())
+            state.diag.Exit()
         }
         return nil
 
@@ -292,7 +300,7 @@ func ConstEvalUnary(e *ast.Unary) constVal.ConstVal {
 
         switch op := e.Operand.(type) {
         case *ast.Field:
-            ptrConst.Addr, ptrConst.Local = fieldAddr(op, int64(op.ToOffset()))
+            ptrConst.Addr, ptrConst.Local = state.fieldAddr(op, int64(op.ToOffset()))
             if ptrConst.Addr.BaseAddr == "" {
                 return nil
             }
@@ -304,8 +312,8 @@ func ConstEvalUnary(e *ast.Unary) constVal.ConstVal {
             _,ptrConst.Local = v.(*vars.LocalVar)
             ptrConst.Addr = v.Addr()
         } else {
-            fmt.Fprintln(os.Stderr, "[ERROR] expected identObj to be a var (in constEval.go Unary &)")
-            os.Exit(1)
+            state.diag.Error("expected identObj to be a var (in constEval.go Unary &)")
+            state.diag.Exit()
         }
 
         default:
@@ -318,35 +326,35 @@ func ConstEvalUnary(e *ast.Unary) constVal.ConstVal {
     return nil
 }
 
-func fieldAddr(field *ast.Field, offset int64) (a addr.Addr, isLocal bool) {
+func (state *State) fieldAddr(field *ast.Field, offset int64) (a addr.Addr, isLocal bool) {
     switch obj := field.Obj.(type) {
     case *ast.Field:
-        return fieldAddr(obj, offset)
+        return state.fieldAddr(obj, offset)
 
     case *ast.Ident:
         if v,ok := obj.Obj.(vars.Var); ok {
             _,isLocal := v.(*vars.LocalVar)
             return v.Addr().Offseted(offset), isLocal 
         } else {
-            fmt.Fprintln(os.Stderr, "[ERROR] expected identObj to be a var (in constEval.go Unary &)")
-            os.Exit(1)
+            state.diag.Error("expected identObj to be a var (in constEval.go Unary &)")
+            state.diag.Exit()
         }
     }
 
     return addr.Addr{}, false
 }
 
-func ConstEvalFnCall(e *ast.FnCall) constVal.ConstVal {
+func (state *State) ConstEvalFnCall(e *ast.FnCall) constVal.ConstVal {
     args := make([]constVal.ConstVal, len(e.Values))
     for i,val := range e.Values {
-        if c := ConstEval(val); c != nil {
+        if c := state.ConstEval(val); c != nil {
             args[i] = c
         } else {
             return nil
         }
     }
 
-    return EvalFunc(e.F.GetName(), e.Ident.Pos, args)
+    return state.EvalFunc(e.F.GetName(), e.Ident.Pos, args)
 }
 
 func ConstEvalSizeof(e *ast.FnCall) constVal.ConstVal {
@@ -354,20 +362,100 @@ func ConstEvalSizeof(e *ast.FnCall) constVal.ConstVal {
     return &c
 }
 
-func ConstEvalParen(e *ast.Paren) constVal.ConstVal {
-    return ConstEval(e.Expr)
+// wrapping_add(a, b), saturating_sub(a, b), ...
+func (state *State) ConstEvalArithBuildIn(e *ast.FnCall) constVal.ConstVal {
+    t := types.ResolveGeneric(e.GetType())
+    if t == nil || (t.GetKind() != types.Int && t.GetKind() != types.Uint) {
+        return nil
+    }
+    signed := t.GetKind() == types.Int
+
+    l, okL := bigInt(state.ConstEval(e.Values[0]), t.Size(), signed)
+    r, okR := bigInt(state.ConstEval(e.Values[1]), t.Size(), signed)
+    if !okL || !okR {
+        return nil
+    }
+
+    res := new(big.Int)
+    switch {
+    case strings.HasSuffix(e.Ident.Name, "_add"):
+        res.Add(l, r)
+    case strings.HasSuffix(e.Ident.Name, "_sub"):
+        res.Sub(l, r)
+    default:
+        res.Mul(l, r)
+    }
+
+    bits := t.Size() * 8
+    min, max := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), bits)
+    if signed {
+        min.Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+        max.Lsh(big.NewInt(1), bits-1)
+    }
+    max.Sub(max, big.NewInt(1))
+
+    if strings.HasPrefix(e.Ident.Name, "saturating_") {
+        if res.Cmp(min) < 0 {
+            res = min
+        } else if res.Cmp(max) > 0 {
+            res = max
+        }
+    }
+
+    // wrapping: the low bits (as two's complement)
+    mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+    v := new(big.Int).And(res, mask).Uint64()
+    if signed {
+        if bits < 64 && v & (uint64(1) << (bits-1)) != 0 {
+            v |= ^uint64(0) << bits
+        }
+        c := constVal.IntConst(int64(v))
+        return &c
+    }
+    c := constVal.UintConst(v)
+    return &c
+}
+
+// the value of c in a register of the size (sign extended if signed)
+func bigInt(c constVal.ConstVal, size uint, signed bool) (*big.Int, bool) {
+    var v uint64
+    switch c := c.(type) {
+    case *constVal.IntConst:
+        v = uint64(*c)
+    case *constVal.UintConst:
+        v = uint64(*c)
+    default:
+        return nil, false
+    }
+
+    bits := size * 8
+    if bits < 64 {
+        v &= (uint64(1) << bits) - 1
+        if signed && v & (uint64(1) << (bits-1)) != 0 {
+            v |= ^uint64(0) << bits
+        }
+    }
+
+    if signed {
+        return big.NewInt(int64(v)), true
+    }
+    return new(big.Int).SetUint64(v), true
+}
+
+func (state *State) ConstEvalParen(e *ast.Paren) constVal.ConstVal {
+    return state.ConstEval(e.Expr)
 }
 
-func ConstEvalXSwitch(e *ast.XSwitch) constVal.ConstVal {
+func (state *State) ConstEvalXSwitch(e *ast.XSwitch) constVal.ConstVal {
     for _,c := range e.Cases {
         if c.Cond == nil {
-            return ConstEval(c.Expr)
+            return state.ConstEval(c.Expr)
         }
 
-        v := ConstEval(c.Cond)
+        v := state.ConstEval(c.Cond)
 
         if b,ok := v.(*constVal.BoolConst); ok && bool(*b) {
-            return ConstEval(c.Expr)
+            return state.ConstEval(c.Expr)
         } else if v == nil {
             return nil
         }
@@ -376,9 +464,9 @@ func ConstEvalXSwitch(e *ast.XSwitch) constVal.ConstVal {
     return nil
 }
 
-func ConstEvalBinary(e *ast.Binary) constVal.ConstVal {
-    l := ConstEval(e.OperandL)
-    r := ConstEval(e.OperandR)
+func (state *State) ConstEvalBinary(e *ast.Binary) constVal.ConstVal {
+    l := state.ConstEval(e.OperandL)
+    r := state.ConstEval(e.OperandR)
 
     if l != nil && r != nil {
         switch l := l.(type) {
@@ -402,10 +490,10 @@ func ConstEvalBinary(e *ast.Binary) constVal.ConstVal {
         case *constVal.UintConst:
             switch r := r.(type) {
             case *constVal.UintConst:
-                return asm.BinaryOpEvalUints(e.Operator, uint64(*l), uint64(*r))
+                return state.asm.BinaryOpEvalUints(e.Operator, uint64(*l), uint64(*r))
 
             case *constVal.IntConst:
-                return asm.BinaryOpEvalUints(e.Operator, uint64(*l), uint64(*r))
+                return state.asm.BinaryOpEvalUints(e.Operator, uint64(*l), uint64(*r))
 
             case *constVal.PtrConst:
                 c := *r
@@ -420,10 +508,10 @@ func ConstEvalBinary(e *ast.Binary) constVal.ConstVal {
         case *constVal.IntConst:
             switch r := r.(type) {
             case *constVal.IntConst:
-                return asm.BinaryOpEvalInts(e.Operator, int64(*l), int64(*r))
+                return state.asm.BinaryOpEvalInts(e.Operator, int64(*l), int64(*r))
 
             case *constVal.UintConst:
-                return asm.BinaryOpEvalUints(e.Operator, uint64(*l), uint64(*r))
+                return state.asm.BinaryOpEvalUints(e.Operator, uint64(*l), uint64(*r))
 
             case *constVal.PtrConst:
                 c := *r
@@ -437,11 +525,11 @@ func ConstEvalBinary(e *ast.Binary) constVal.ConstVal {
 
         case *constVal.BoolConst:
             if r, ok := r.(*constVal.BoolConst); ok {
-                return asm.BinaryOpEvalBools(e.Operator, bool(*l), bool(*r))
+                return state.asm.BinaryOpEvalBools(e.Operator, bool(*l), bool(*r))
             }
         case *constVal.StrConst:
             if r, ok := r.(*constVal.StrConst); ok {
-                return asm.BinaryOpEvalStrs(e.Operator, uint64(*l), uint64(*r))
+                return state.asm.BinaryOpEvalStrs(e.Operator, uint64(*l), uint64(*r))
             }
         }
     }
@@ -1,23 +1,19 @@
 package cmpTime
 
 import (
-    "os"
-    "fmt"
     "unsafe"
     "reflect"
     "encoding/binary"
     "gamma/token"
     "gamma/types"
     "gamma/types/addr"
-    "gamma/types/array"
     "gamma/cmpTime/constVal"
 )
 
-var curScope *scope = nil
-
 type scope struct {
     consts map[string]constVal.ConstVal
     vars map[string]varInfo
+    decls map[string]token.Pos
     stack []byte
     parent *scope
 }
@@ -27,50 +23,60 @@ type varInfo struct {
     typ types.Type
 }
 
-func startScope(framesize uint) {
-    curScope = &scope{ parent: curScope, consts: make(map[string]constVal.ConstVal), vars: make(map[string]varInfo), stack: make([]uint8, framesize) }
+func (state *State) startScope(framesize uint) {
+    state.curScope = &scope{ parent: state.curScope, consts: make(map[string]constVal.ConstVal), vars: make(map[string]varInfo), decls: make(map[string]token.Pos), stack: make([]uint8, framesize) }
 }
 
-func endScope() {
-    curScope = curScope.parent
+func (state *State) endScope() {
+    state.curScope = state.curScope.parent
 }
 
-func inConstEnv() bool {
-    return curScope != nil
+func (state *State) inConstEnv() bool {
+    return state.curScope != nil
 }
 
-func checkNameTaken(name string, pos token.Pos) {
-    if _,ok := curScope.consts[name]; ok {
-        fmt.Fprintf(os.Stderr, "[ERROR] %s is already declared in this scope\n", name)
-        fmt.Fprintln(os.Stderr, "\t", pos.At())
-        os.Exit(1)
-    }
-    if _,ok := curScope.vars[name]; ok {
-        fmt.Fprintf(os.Stderr, "[ERROR] %s is already declared in this scope\n", name)
-        fmt.Fprintln(os.Stderr, "\t", pos.At())
-        os.Exit(1)
+func (state *State) checkNameTaken(name string, pos token.Pos) {
+    _,isConst := state.curScope.consts[name]
+    _,isVar := state.curScope.vars[name]
+
+    if isConst || isVar {
+        state.diag.Errorf("%s is already declared in this scope", name)
+        state.diag.At(pos.At())
+        if first := state.curScope.decls[name]; first.File != "" {
+            state.diag.NoteAt("first defined here", first.At())
+        }
+        state.diag.Exit()
     }
+
+    state.curScope.decls[name] = pos
+}
+
+func (state *State) defVar(name string, addr addr.Addr, t types.Type, pos token.Pos, val constVal.ConstVal) {
+    state.checkNameTaken(name, pos)
+
+    idx := state.getStackIdx(addr, t)
+    state.curScope.vars[name] = varInfo{ stackIdx: idx, typ: t }
+    state.writeStack(idx, t, val)
 }
 
-func defVar(name string, addr addr.Addr, t types.Type, pos token.Pos, val constVal.ConstVal) {
-    checkNameTaken(name, pos)
+// like defVar without a value (assigned before it is read, see check/assign.go)
+func (state *State) decVar(name string, addr addr.Addr, t types.Type, pos token.Pos) {
+    state.checkNameTaken(name, pos)
 
-    idx := getStackIdx(addr, t)
-    curScope.vars[name] = varInfo{ stackIdx: idx, typ: t }
-    writeStack(idx, t, val)
+    state.curScope.vars[name] = varInfo{ stackIdx: state.getStackIdx(addr, t), typ: t }
 }
 
-func defConst(name string, pos token.Pos, val constVal.ConstVal) {
-    checkNameTaken(name, pos)
+func (state *State) defConst(name string, pos token.Pos, val constVal.ConstVal) {
+    state.checkNameTaken(name, pos)
 
-    curScope.consts[name] = val
+    state.curScope.consts[name] = val
 }
 
-func setVar(name string, t types.Type, pos token.Pos, val constVal.ConstVal) {
-    cur := curScope
+func (state *State) setVar(name string, t types.Type, pos token.Pos, val constVal.ConstVal) {
+    cur := state.curScope
     for cur != nil {
         if v,ok := cur.vars[name]; ok {
-            writeStack(v.stackIdx, t, val)
+            state.writeStack(v.stackIdx, t, val)
             return
         } else {
             cur = cur.parent
@@ -78,20 +84,20 @@ func setVar(name string, t types.Type, pos token.Pos, val constVal.ConstVal) {
     }
 
     // TODO: better error message (check if ident of global or non const local var)
-    fmt.Fprintf(os.Stderr, "[ERROR] %s is not declared\n", name)
-    fmt.Fprintln(os.Stderr, "\t", pos.At())
-    os.Exit(1)
+    state.diag.Errorf("%s is not declared", name)
+    state.diag.At(pos.At())
+    state.diag.Exit()
 }
 
-func setVarAddr(addr addr.Addr, t types.Type, val constVal.ConstVal) {
-    writeStack(getStackIdx(addr, t), t, val)
+func (state *State) setVarAddr(addr addr.Addr, t types.Type, val constVal.ConstVal) {
+    state.writeStack(state.getStackIdx(addr, t), t, val)
 }
 
-func setVarField(name string, offset uint, t types.Type, pos token.Pos, val constVal.ConstVal) {
-    cur := curScope
+func (state *State) setVarField(name string, offset uint, t types.Type, pos token.Pos, val constVal.ConstVal) {
+    cur := state.curScope
     for cur != nil {
         if v,ok := cur.vars[name]; ok {
-            writeStack(v.stackIdx + offset, t, val)
+            state.writeStack(v.stackIdx + offset, t, val)
             return
         } else {
             cur = cur.parent
@@ -99,18 +105,18 @@ func setVarField(name string, offset uint, t types.Type, pos token.Pos, val cons
     }
 
     // TODO: better error message (check if ident of global or non const local var)
-    fmt.Fprintf(os.Stderr, "[ERROR] %s is not declared\n", name)
-    fmt.Fprintln(os.Stderr, "\t", pos.At())
-    os.Exit(1)
+    state.diag.Errorf("%s is not declared", name)
+    state.diag.At(pos.At())
+    state.diag.Exit()
 }
 
-func getVal(name string, pos token.Pos) constVal.ConstVal {
-    cur := curScope
+func (state *State) getVal(name string, pos token.Pos) constVal.ConstVal {
+    cur := state.curScope
     for cur != nil {
         if c,ok := cur.consts[name]; ok {
             return c
         } else if c,ok := cur.vars[name]; ok {
-            return readStack(c.stackIdx, c.typ)
+            return state.readStack(c.stackIdx, c.typ)
         } else {
             cur = cur.parent
         }
@@ -119,33 +125,33 @@ func getVal(name string, pos token.Pos) constVal.ConstVal {
     return nil
 }
 
-func getValAddr(addr addr.Addr, t types.Type) constVal.ConstVal {
-    return readStack(getStackIdx(addr, t), t)
+func (state *State) getValAddr(addr addr.Addr, t types.Type) constVal.ConstVal {
+    return state.readStack(state.getStackIdx(addr, t), t)
 }
 
-func getStackIdx(addr addr.Addr, t types.Type) uint {
-    if idx := -addr.Offset - int64(t.Size()); idx >= 0 && idx < int64(len(curScope.stack)) {
+func (state *State) getStackIdx(addr addr.Addr, t types.Type) uint {
+    if idx := -addr.Offset - int64(t.Size()); idx >= 0 && idx < int64(len(state.curScope.stack)) {
         return uint(idx)
     } else {
-        fmt.Fprintf(os.Stderr, "[ERROR] %s (of type %v) is outside of the stack (size: %d)\n", addr, t, len(curScope.stack))
-        os.Exit(1)
+        state.diag.Errorf("%s (of type %v) is outside of the stack (size: %d)", addr, t, len(state.curScope.stack))
+        state.diag.Exit()
         return 0
     }
 }
 
-func readStack(idx uint, t types.Type) constVal.ConstVal {
+func (state *State) readStack(idx uint, t types.Type) constVal.ConstVal {
     switch t := t.(type) {
     case types.IntType:
         var c int64
         switch t.Size() {
         case 1:
-            c = int64(int8(curScope.stack[idx]))     // to sign extend
+            c = int64(int8(state.curScope.stack[idx]))     // to sign extend
         case 2:
-            c = int64(int16(getByteOrder().Uint16(curScope.stack[idx:])))
+            c = int64(int16(getByteOrder().Uint16(state.curScope.stack[idx:])))
         case 4:
-            c = int64(int32(getByteOrder().Uint32(curScope.stack[idx:])))
+            c = int64(int32(getByteOrder().Uint32(state.curScope.stack[idx:])))
         default:
-            c = int64(getByteOrder().Uint64(curScope.stack[idx:]))
+            c = int64(getByteOrder().Uint64(state.curScope.stack[idx:]))
         }
         return (*constVal.IntConst)(&c)
 
@@ -153,18 +159,18 @@ func readStack(idx uint, t types.Type) constVal.ConstVal {
         var c uint64
         switch t.Size() {
         case 1:
-            c = uint64(curScope.stack[idx])
+            c = uint64(state.curScope.stack[idx])
         case 2:
-            c = uint64(getByteOrder().Uint16(curScope.stack[idx:]))
+            c = uint64(getByteOrder().Uint16(state.curScope.stack[idx:]))
         case 4:
-            c = uint64(getByteOrder().Uint32(curScope.stack[idx:]))
+            c = uint64(getByteOrder().Uint32(state.curScope.stack[idx:]))
         default:
-            c = getByteOrder().Uint64(curScope.stack[idx:])
+            c = getByteOrder().Uint64(state.curScope.stack[idx:])
         }
         return (*constVal.UintConst)(&c)
 
     case types.BoolType:
-        if curScope.stack[idx] == 0 {
+        if state.curScope.stack[idx] == 0 {
             b := constVal.BoolConst(false)
             return &b
         } else {
@@ -173,27 +179,35 @@ func readStack(idx uint, t types.Type) constVal.ConstVal {
         }
 
     case types.CharType:
-        return (*constVal.CharConst)(&curScope.stack[idx])
+        return (*constVal.CharConst)(&state.curScope.stack[idx])
 
     case types.PtrType:
-        offset := getByteOrder().Uint64(curScope.stack[idx:])
+        offset := getByteOrder().Uint64(state.curScope.stack[idx:])
         c := constVal.PtrConst{ Local: true, Addr: addr.Addr{ BaseAddr: "rbp", Offset: int64(offset) } }
         return &c
 
     case types.ArrType:
-        idx := getByteOrder().Uint64(curScope.stack[idx:])
-        return &constVal.ArrConst{ Idx: idx, Elems: array.GetValues(idx), Type: t }
+        idx := getByteOrder().Uint64(state.curScope.stack[idx:])
+        return &constVal.ArrConst{ Idx: idx, Elems: state.array.GetValues(idx), Type: t }
 
     case types.StructType:
         c := constVal.StructConst{ Type: t, Fields: make([]constVal.ConstVal, len(t.Types)) }
         for i,t := range t.Types {
-            c.Fields[i] = readStack(idx, t)
+            c.Fields[i] = state.readStack(idx, t)
             idx += t.Size()
         }
         return &c
 
     case types.EnumType:
-        idVal := readStack(idx, t.IdType)
+        if ptrElem, nullElem, ok := t.NicheElems(); ok {
+            if getByteOrder().Uint64(state.curScope.stack[idx:]) == 0 {
+                return &constVal.EnumConst{ Id: t.GetElemID(nullElem), Type: t }
+            }
+            elemType := t.GetType(ptrElem)
+            return &constVal.EnumConst{ Id: t.GetElemID(ptrElem), Type: t, ElemType: elemType, Elem: state.readStack(idx, elemType) }
+        }
+
+        idVal := state.readStack(idx, t.IdType)
         idx += t.IdType.Size()
 
         id := uint64(0)
@@ -206,7 +220,7 @@ func readStack(idx uint, t types.Type) constVal.ConstVal {
 
         elemType := t.GetTypeWithId(id)
         if elemType  != nil {
-            elem := readStack(idx, elemType)
+            elem := state.readStack(idx, elemType)
             idx += t.Size()
             return &constVal.EnumConst{ Id: id, Type: t, ElemType: elemType, Elem: elem }
         } else {
@@ -214,73 +228,82 @@ func readStack(idx uint, t types.Type) constVal.ConstVal {
         }
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] reading %v from the const stack is not supported yet\n", t)
-        os.Exit(1)
+        state.diag.Errorf("reading %v from the const stack is not supported yet", t)
+        state.diag.Exit()
         return nil
     }
 }
 
-func writeStack(idx uint, typ types.Type, val constVal.ConstVal) {
+func (state *State) writeStack(idx uint, typ types.Type, val constVal.ConstVal) {
     switch c := val.(type) {
     case *constVal.IntConst:
         switch typ.Size() {
         case 1:
-            curScope.stack[idx] = byte(*c)
+            state.curScope.stack[idx] = byte(*c)
         case 2:
-            getByteOrder().PutUint16(curScope.stack[idx:], uint16(*c))
+            getByteOrder().PutUint16(state.curScope.stack[idx:], uint16(*c))
         case 4:
-            getByteOrder().PutUint32(curScope.stack[idx:], uint32(*c))
+            getByteOrder().PutUint32(state.curScope.stack[idx:], uint32(*c))
         default:
-            getByteOrder().PutUint64(curScope.stack[idx:], uint64(*c))
+            getByteOrder().PutUint64(state.curScope.stack[idx:], uint64(*c))
         }
 
     case *constVal.UintConst:
         switch typ.Size() {
         case 1:
-            curScope.stack[idx] = byte(*c)
+            state.curScope.stack[idx] = byte(*c)
         case 2:
-            getByteOrder().PutUint16(curScope.stack[idx:], uint16(*c))
+            getByteOrder().PutUint16(state.curScope.stack[idx:], uint16(*c))
         case 4:
-            getByteOrder().PutUint32(curScope.stack[idx:], uint32(*c))
+            getByteOrder().PutUint32(state.curScope.stack[idx:], uint32(*c))
         default:
-            getByteOrder().PutUint64(curScope.stack[idx:], uint64(*c))
+            getByteOrder().PutUint64(state.curScope.stack[idx:], uint64(*c))
         }
 
     case *constVal.BoolConst:
         if bool(*c) {
-            curScope.stack[idx] = 1
+            state.curScope.stack[idx] = 1
         } else {
-            curScope.stack[idx] = 0
+            state.curScope.stack[idx] = 0
         }
 
     case *constVal.CharConst:
-        curScope.stack[idx] = byte(*c)
+        state.curScope.stack[idx] = byte(*c)
 
     case *constVal.PtrConst:
-        getByteOrder().PutUint64(curScope.stack[idx:], uint64(c.Addr.Offset))
+        getByteOrder().PutUint64(state.curScope.stack[idx:], uint64(c.Addr.Offset))
 
     case *constVal.ArrConst:
-        getByteOrder().PutUint64(curScope.stack[idx:], c.Idx)
+        getByteOrder().PutUint64(state.curScope.stack[idx:], c.Idx)
 
     case *constVal.StructConst:
         for i,field := range c.Fields {
             t := typ.(types.StructType).Types[i]
-            writeStack(idx, t, field)
+            state.writeStack(idx, t, field)
             idx += t.Size()
         }
 
     case *constVal.EnumConst:
+        if c.Type.IsNiche() {
+            if c.Elem == nil {
+                getByteOrder().PutUint64(state.curScope.stack[idx:], 0)
+            } else {
+                state.writeStack(idx, c.ElemType, c.Elem)
+            }
+            break
+        }
+
         id := constVal.UintConst(c.Id)
-        writeStack(idx, c.Type.IdType, &id)
+        state.writeStack(idx, c.Type.IdType, &id)
         idx += c.Type.IdType.Size()
         if c.ElemType != nil {
-            writeStack(idx, c.ElemType, c.Elem)
+            state.writeStack(idx, c.ElemType, c.Elem)
             idx += c.ElemType.Size()
         }
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] writing %v to the const stack is not supported yet\n", reflect.TypeOf(val))
-        os.Exit(1)
+        state.diag.Errorf("writing %v to the const stack is not supported yet", reflect.TypeOf(val))
+        state.diag.Exit()
     }
 }
 
@@ -0,0 +1,24 @@
+package cmpTime
+
+import (
+    "gamma/ast/identObj"
+    "gamma/diag"
+    "gamma/gen/asm/x86_64"
+    "gamma/types/array"
+)
+
+// const funcs and the evaluation stack of one compilation (see gamma/compiler)
+type State struct {
+    funcs map[string]constFunc
+    curScope *scope
+    through bool
+
+    identObj *identObj.State
+    diag *diag.State
+    asm *asm.State
+    array *array.State
+}
+
+func NewState(identObj *identObj.State, diag *diag.State, asm *asm.State, array *array.State) *State {
+    return &State{ funcs: make(map[string]constFunc), identObj: identObj, diag: diag, asm: asm, array: array }
+}
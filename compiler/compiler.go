@@ -0,0 +1,307 @@
+package compiler
+
+import (
+    "io"
+    "os"
+    "strings"
+    "gamma/ast"
+    "gamma/diag"
+    "gamma/token"
+    "gamma/buildin"
+    "gamma/ast/identObj"
+    "gamma/check"
+    "gamma/cmpTime"
+    "gamma/import"
+    "gamma/parser"
+    "gamma/resolver"
+    "gamma/types"
+    "gamma/types/str"
+    "gamma/types/array"
+    "gamma/gen"
+    "gamma/gen/c"
+    "gamma/gen/reach"
+    "gamma/gen/asm/x86_64"
+    "gamma/gen/asm/x86_64/conditions"
+    "gamma/gen/asm/x86_64/loops"
+    "gamma/gen/asm/x86_64/elf"
+    "gamma/gen/asm/x86_64/nasm"
+    "gamma/gen/asm/x86_64/vtable"
+    "gamma/emit"
+    "gamma/warn"
+)
+
+/*
+a Session holds the state of one compilation (scopes, literals, labels, imports, ...)
+  * every package keeps its part in a State (created by NewSession)
+  * the States of the packages a package uses are passed to its NewState
+  * sessions share no state -> they can be used concurrently
+  * Compile writes the output files (output.asm, output.c, output.o, output) to the working dir
+  * CompileSource returns everything as values (no files are written)
+*/
+
+type Session struct {
+    diag *diag.State
+    imprt *imprt.State
+    prs *prs.State
+    resolver *resolver.State
+    check *check.State
+    warn *warn.State
+    gen *gen.State
+    c *c.State
+    nasm *nasm.State
+    elf *elf.State
+    emit *emit.State
+}
+
+type Options struct {
+    ImportDir string
+    OptLevel uint
+    Verbose bool    // report removed unused functions and data
+    ShowAst bool
+    UseC bool       // generate C and compile it with the system cc
+    UseNasm bool    // use nasm and ld instead of the build-in assembler/linker
+    ObjOnly bool    // only generate the object file
+    Tests bool      // run the test blocks instead of main (gamma test)
+    ParseOnly bool  // stop after parsing (CompileSource only)
+    CheckOnly bool  // stop after type checking (CompileSource only)
+    CheckConsts bool    // compare the values of cmpTime with the values computed at runtime (asm only)
+    CheckOverflow bool  // exit with an error if an int/uint op overflows at runtime
+    Emit string     // "tokens", "ast-json" or "symbols": JSON instead of an executable (see gamma/emit)
+    EmitImports bool    // Emit the imported files too (buildin, std, ...)
+    ErrorFormat diag.Format // how errors are written to stderr (Compile only)
+    Color bool      // colored errors (with diag.Text)
+    Warnings []string   // enabled/disabled warnings (see gamma/warn)
+    WarnError bool  // warnings are errors
+    Vet bool        // stop after the type check and run the analyses of gamma vet (see gamma/warn)
+    Analyses []string   // enabled/disabled analyses of Vet
+    Edition uint    // check.Edition2: locals are immutable unless declared with mut (0 is check.Edition1)
+}
+
+type Source struct {
+    Path string                 // path of the main file (used in positions and for relative imports)
+    Text string
+    Files map[string]string     // import path -> contents (used before files in ImportDir)
+}
+
+type Result struct {
+    Ast ast.Ast
+    Diagnostics []diag.Diagnostic
+    Asm string
+    C string        // only with UseC (not compiled)
+    Obj []byte      // relocatable ELF64 object (with ObjOnly)
+    Exe []byte      // static ELF64 executable
+    Emitted string  // JSON (with Emit)
+}
+
+func NewSession() *Session {
+    diag := diag.NewState()
+    types := types.NewState(diag)
+    token := token.NewState(diag)
+    nasm := nasm.NewState(diag)
+    str := str.NewState(diag, nasm)
+    identObj := identObj.NewState(diag, types)
+    asm := asm.NewState(diag, str)
+    buildin := buildin.NewState(identObj, nasm)
+    array := array.NewState(diag, nasm, str)
+    cmpTime := cmpTime.NewState(identObj, diag, asm, array)
+    loops := loops.NewState()
+    vtable := vtable.NewState(nasm)
+    cond := cond.NewState(diag, nasm)
+    reach := reach.NewState(identObj, array, str)
+    gen := gen.NewState(identObj, buildin, cmpTime, diag, asm, cond, loops, nasm, vtable, reach, array, str)
+    imprt := imprt.NewState(diag, token)
+
+    return &Session{
+        diag: diag,
+        imprt: imprt,
+        prs: prs.NewState(identObj, buildin, cmpTime, diag, imprt, token, types, array, str),
+        resolver: resolver.NewState(identObj, diag),
+        check: check.NewState(identObj, cmpTime, diag),
+        warn: warn.NewState(identObj, cmpTime, diag, imprt),
+        gen: gen,
+        c: c.NewState(identObj, cmpTime, diag, gen, array, str),
+        nasm: nasm,
+        elf: elf.NewState(diag),
+        emit: emit.NewState(identObj, diag),
+    }
+}
+
+// the options used by every stage (both Compile and CompileSource)
+func (s *Session) setOptions(path string, o Options) {
+    s.gen.SetOptLevel(o.OptLevel)
+    s.gen.SetCheckConsts(o.CheckConsts)
+    s.gen.SetCheckOverflow(o.CheckOverflow)
+    s.check.SetEdition(o.Edition)
+
+    s.imprt.SetImportDirs(path, o.ImportDir)
+    s.warn.CheckFlags(o.Warnings)
+    s.warn.CheckAnalyses(o.Analyses)
+}
+
+// compiles the source file into an executable (or object file)
+// with Emit the JSON is written to stdout instead (without [INFO] messages)
+func (s *Session) Compile(path string, o Options) (Ast ast.Ast) {
+    if o.Emit != "" {
+        s.diag.Quiet()
+    }
+    s.diag.Render(o.ErrorFormat, o.Color, s.imprt.Source)
+    defer s.diag.Flush()
+
+    s.setOptions(path, o)
+
+    if o.Emit != "" {
+        return s.emitJson(os.Stdout, path, o)
+    }
+
+    Ast = s.parse(path, o)
+    Ast = s.resolver.Resolve(Ast)
+    if o.ShowAst { Ast.ShowAst() }
+
+    s.check.TypeCheck(Ast)
+    s.warn.Check(Ast, o.Warnings, o.WarnError)
+
+    if o.Vet {
+        s.warn.Vet(Ast, o.Analyses)
+        return
+    }
+
+    if o.UseC {
+        s.c.GenC(Ast)
+    } else {
+        s.gen.GenAsm(Ast, o.Verbose)
+    }
+
+    switch {
+    case o.UseC && o.ObjOnly:
+        s.c.GenObj()
+    case o.UseC:
+        s.c.GenExe()
+    case o.UseNasm && o.ObjOnly:
+        s.nasm.GenObj()
+    case o.UseNasm:
+        s.nasm.GenExe()
+    case o.ObjOnly:
+        s.elf.GenObj()
+    default:
+        s.elf.GenExe()
+    }
+
+    return
+}
+
+// stops after the stage needed for the JSON
+func (s *Session) emitJson(w io.Writer, path string, o Options) (Ast ast.Ast) {
+    switch o.Emit {
+    case emit.Tokens:
+        tokens := s.imprt.ImportMain(path)
+        s.emit.WriteTokens(w, tokens.All())
+        return
+
+    case emit.AstJson, emit.Symbols:
+        Ast = s.parse(path, o)
+        Ast = s.resolver.Resolve(Ast)
+        s.check.TypeCheck(Ast)
+
+        if o.Emit == emit.AstJson {
+            s.emit.WriteAst(w, Ast, path, o.EmitImports)
+        } else {
+            s.emit.WriteSymbols(w, path, o.EmitImports)
+        }
+        return
+
+    default:
+        s.diag.Errorf("unknown emit kind \"%s\" (expected %s, %s or %s)", o.Emit, emit.Tokens, emit.AstJson, emit.Symbols)
+        s.diag.Exit()
+        return
+    }
+}
+
+func (s *Session) parse(path string, o Options) ast.Ast {
+    if o.Tests {
+        return s.prs.ParseTests(path)
+    }
+
+    return s.prs.Parse(path)
+}
+
+func (r *Result) Failed() bool {
+    for _,d := range r.Diagnostics {
+        if d.Severity == "error" {
+            return true
+        }
+    }
+    return false
+}
+
+// errors end f and are returned as diagnostics (instead of exiting)
+func (s *Session) capture(f func()) (diags []diag.Diagnostic) {
+    s.diag.Capture(&diags)
+
+    defer s.diag.Flush()
+    defer func() {
+        if r := recover(); r != nil {
+            if _,ok := r.(diag.Abort); !ok {
+                panic(r)
+            }
+        }
+    }()
+
+    f()
+    return diags
+}
+
+// compiles the source without reading or writing files in the working dir
+// (only imports which are not in src.Files are read from ImportDir)
+// errors end the compilation and are returned as diagnostics
+func (s *Session) CompileSource(src Source, o Options) (res Result) {
+    files := make(map[string]string, len(src.Files)+1)
+    for path,text := range src.Files {
+        files[path] = text
+    }
+    files[src.Path] = src.Text
+
+    res.Diagnostics = s.capture(func() {
+        s.imprt.SetFiles(files)
+        s.setOptions(src.Path, o)
+
+        if o.Emit != "" {
+            var json strings.Builder
+            res.Ast = s.emitJson(&json, src.Path, o)
+            res.Emitted = json.String()
+            return
+        }
+
+        res.Ast = s.parse(src.Path, o)
+        if o.ParseOnly {
+            return
+        }
+        res.Ast = s.resolver.Resolve(res.Ast)
+
+        s.check.TypeCheck(res.Ast)
+        s.warn.Check(res.Ast, o.Warnings, o.WarnError)
+
+        if o.Vet {
+            s.warn.Vet(res.Ast, o.Analyses)
+            return
+        }
+
+        if o.CheckOnly {
+            return
+        }
+
+        if o.UseC {
+            res.C = s.c.C(res.Ast)
+            return
+        }
+
+        res.Asm = s.gen.Asm(res.Ast, false)
+
+        if o.ObjOnly {
+            res.Obj = s.elf.Obj(res.Asm)
+        } else {
+            res.Exe = s.elf.Exe(res.Asm)
+        }
+    })
+
+    return
+}
@@ -0,0 +1,147 @@
+package diag
+
+import (
+    "os"
+    "io"
+    "fmt"
+    "strings"
+)
+
+// every part of the compiler reports errors like this:
+//   diag.Errorf("<msg>", args...)
+//   diag.At(pos.At())
+//   diag.Exit()
+// more lines of the msg and secondary positions (e.g. where a name was defined first) follow:
+//   diag.Linef("expected: %v", t)
+//   diag.NoteAt("first defined here", pos.At())
+// the diagnostic is reported when the next one starts (or on Exit/Flush)
+// the state of a session decides where it goes and how the compilation ends
+
+type Diagnostic struct {
+    Severity string  // "error" or "warning"
+    Msg string       // can have more than one line
+    Pos string       // "file:line:col" ("" if unknown)
+    Notes []Note
+}
+
+type Note struct {
+    Msg string
+    Pos string
+}
+
+// compilation stopped after an error (recovered by the compiler package)
+type Abort struct{}
+
+type State struct {
+    stdout io.Writer
+    report func(d Diagnostic)
+    exit func()
+    cur *Diagnostic     // not reported yet
+}
+
+// [INFO] to stdout, errors to stderr, exits the process on errors
+func NewState() *State {
+    return &State{ stdout: os.Stdout, report: writePlain(os.Stderr), exit: func() { os.Exit(1) } }
+}
+
+// no [INFO] messages (stdout is left to the output of the compiler)
+func (state *State) Quiet() {
+    state.stdout = io.Discard
+}
+
+// no [INFO] messages, diagnostics are appended to diags and Exit panics with Abort
+func (state *State) Capture(diags *[]Diagnostic) {
+    state.stdout = io.Discard
+    state.report = func(d Diagnostic) { *diags = append(*diags, d) }
+    state.exit = func() { panic(Abort{}) }
+}
+
+func (state *State) Stdout() io.Writer {
+    return state.stdout
+}
+
+func (state *State) Exit() {
+    state.Flush()
+    state.exit()
+}
+
+// reports the current diagnostic (Exit flushes too)
+func (state *State) Flush() {
+    if state.cur != nil {
+        d := *state.cur
+        state.cur = nil
+        state.report(d)
+    }
+}
+
+func (state *State) Error(msg string) {
+    state.start("error", msg)
+}
+
+func (state *State) Errorf(format string, args ...interface{}) {
+    state.start("error", fmt.Sprintf(format, args...))
+}
+
+func (state *State) Warningf(format string, args ...interface{}) {
+    state.start("warning", fmt.Sprintf(format, args...))
+}
+
+func (state *State) start(severity string, msg string) {
+    state.Flush()
+    state.cur = &Diagnostic{ Severity: severity }
+    state.addLines(msg)
+}
+
+// pos is "at: file:line:col" (like token.Pos.At()) or "file:line:col"
+// the first position is the position of the diagnostic
+func (state *State) At(pos string) {
+    pos = trimAt(pos)
+    if pos == "" {
+        return
+    }
+
+    if state.current().Pos == "" {
+        state.current().Pos = pos
+    } else {
+        state.addLines("at: " + pos)
+    }
+}
+
+// another line of the msg
+func (state *State) Line(s string) {
+    state.addLines(s)
+}
+
+func (state *State) Linef(format string, args ...interface{}) {
+    state.addLines(fmt.Sprintf(format, args...))
+}
+
+// pos can be ""
+func (state *State) NoteAt(msg string, pos string) {
+    state.current().Notes = append(state.current().Notes, Note{ Msg: msg, Pos: trimAt(pos) })
+}
+
+// lines without a diagnostic start an error
+func (state *State) current() *Diagnostic {
+    if state.cur == nil {
+        state.cur = &Diagnostic{ Severity: "error" }
+    }
+    return state.cur
+}
+
+// the lines are trimmed (indentation of the plain output)
+func (state *State) addLines(s string) {
+    d := state.current()
+    for _,line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+        line = strings.TrimSpace(line)
+        if d.Msg == "" {
+            d.Msg = line
+        } else {
+            d.Msg += "\n" + line
+        }
+    }
+}
+
+func trimAt(pos string) string {
+    return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(pos), "at:"))
+}
@@ -0,0 +1,322 @@
+package diag
+
+import (
+    "os"
+    "io"
+    "fmt"
+    "strings"
+    "strconv"
+    "encoding/json"
+)
+
+/*
+rendering of the diagnostics (gamma -error-format=<format>)
+  * plain: "[ERROR] <msg>", "\tat: <pos>" and "\tnote: <msg> at: <pos>" lines
+  * text:  plain + the source lines with a caret under the position (and its notes)
+  * json:  one object per diagnostic and line (for CI annotations)
+*/
+
+type Format int
+
+const (
+    Plain Format = iota
+    Text
+    Json
+)
+
+func ParseFormat(s string) (Format, bool) {
+    switch s {
+    case "plain":
+        return Plain, true
+    case "text":
+        return Text, true
+    case "json":
+        return Json, true
+    }
+
+    return Plain, false
+}
+
+// true if f is a terminal (no colors for pipes and files)
+func IsTerminal(f *os.File) bool {
+    info, err := f.Stat()
+    return err == nil && info.Mode() & os.ModeCharDevice != 0
+}
+
+// renders the diagnostics of the state (colors only with Text)
+// source returns the contents of a loaded file (the source lines of Text)
+func (s *State) Render(format Format, color bool, source func(file string) (string, bool)) {
+    if format == Plain {
+        return
+    }
+
+    r := &renderer{ out: os.Stderr, format: format, color: color, source: source, lines: make(map[string][]string) }
+    s.report = r.render
+}
+
+func writePlain(out io.Writer) func(d Diagnostic) {
+    return func(d Diagnostic) {
+        io.WriteString(out, FormatPlain(d))
+    }
+}
+
+// like written by gamma -error-format=plain
+func FormatPlain(d Diagnostic) string {
+    var res strings.Builder
+
+    lines := strings.Split(d.Msg, "\n")
+    fmt.Fprintf(&res, "[%s] %s\n", strings.ToUpper(d.Severity), lines[0])
+    for _,l := range lines[1:] {
+        res.WriteString("\t" + l + "\n")
+    }
+    if d.Pos != "" {
+        res.WriteString("\tat: " + d.Pos + "\n")
+    }
+    for _,n := range d.Notes {
+        if n.Pos != "" {
+            res.WriteString("\tnote: " + n.Msg + " at: " + n.Pos + "\n")
+        } else {
+            res.WriteString("\tnote: " + n.Msg + "\n")
+        }
+    }
+
+    return res.String()
+}
+
+type renderer struct {
+    out io.Writer
+    format Format
+    color bool
+    source func(file string) (string, bool)
+    lines map[string][]string
+}
+
+func (r *renderer) render(d Diagnostic) {
+    if r.format == Json {
+        r.renderJson(d)
+    } else {
+        r.renderText(d)
+    }
+}
+
+const (
+    colorReset string = "\x1b[0m"
+    colorBold  string = "\x1b[1m"
+    colorRed   string = "\x1b[1;31m"
+    colorYellow string = "\x1b[1;33m"
+    colorBlue  string = "\x1b[1;34m"
+)
+
+func (r *renderer) paint(color string, s string) string {
+    if r.color {
+        return color + s + colorReset
+    }
+    return s
+}
+
+// [ERROR] <msg>
+//   --> file:line:col
+//    |
+//  3 |     x := 4
+//    |     ^
+//    = <more lines of the msg>
+//   ::: file:line:col
+//    |
+//  2 |     x := 3
+//    |     - <note>
+func (r *renderer) renderText(d Diagnostic) {
+    color := colorRed
+    if d.Severity == "warning" {
+        color = colorYellow
+    }
+
+    lines := strings.Split(d.Msg, "\n")
+    fmt.Fprintf(r.out, "%s %s\n", r.paint(color, "[" + strings.ToUpper(d.Severity) + "]"), r.paint(colorBold, lines[0]))
+
+    width := len(lineNum(d.Pos))
+    for _,n := range d.Notes {
+        if w := len(lineNum(n.Pos)); w > width {
+            width = w
+        }
+    }
+    gutter := r.paint(colorBlue, strings.Repeat(" ", width+1) + "|")
+
+    if d.Pos != "" {
+        fmt.Fprintf(r.out, "%s %s\n", r.paint(colorBlue, strings.Repeat(" ", width) + "-->"), d.Pos)
+        r.renderSnippet(d.Pos, width, r.paint(color, "^"), "")
+    }
+
+    for _,l := range lines[1:] {
+        fmt.Fprintf(r.out, "%s %s\n", r.paint(colorBlue, strings.Repeat(" ", width+1) + "="), l)
+    }
+
+    for _,n := range d.Notes {
+        if n.Pos == "" || !r.renderable(n.Pos) {
+            fmt.Fprintf(r.out, "%s note: %s\n", r.paint(colorBlue, strings.Repeat(" ", width+1) + "="), strings.TrimSpace(n.Msg + " " + n.Pos))
+            continue
+        }
+
+        fmt.Fprintf(r.out, "%s %s\n", r.paint(colorBlue, strings.Repeat(" ", width) + ":::"), n.Pos)
+        r.renderSnippet(n.Pos, width, r.paint(colorBlue, "-"), n.Msg)
+    }
+
+    if d.Pos != "" || len(d.Notes) > 0 {
+        fmt.Fprintln(r.out, gutter)
+    }
+}
+
+func (r *renderer) renderable(pos string) bool {
+    file, line, _, ok := splitPos(pos)
+    return ok && line <= len(r.fileLines(file))
+}
+
+// the source line with the marker (repeated for the length of the token) and the label under it
+func (r *renderer) renderSnippet(pos string, width int, marker string, label string) {
+    file, line, col, ok := splitPos(pos)
+    if !ok {
+        return
+    }
+
+    src := r.fileLines(file)
+    if line > len(src) {
+        return
+    }
+
+    s := src[line-1]
+    if col > len(s)+1 {
+        col = len(s)+1
+    }
+
+    // keep tabs so the marker is aligned with the source line
+    indent := []byte(s[:col-1])
+    for i,c := range indent {
+        if c != '\t' {
+            indent[i] = ' '
+        }
+    }
+
+    gutter := r.paint(colorBlue, strings.Repeat(" ", width+1) + "|")
+    fmt.Fprintln(r.out, gutter)
+    fmt.Fprintf(r.out, "%s %s\n", r.paint(colorBlue, fmt.Sprintf("%*d |", width, line)), s)
+
+    res := fmt.Sprintf("%s %s%s", gutter, indent, strings.Repeat(marker, spanLen(s, col)))
+    if label != "" {
+        res += " " + label
+    }
+    fmt.Fprintln(r.out, res)
+}
+
+// lines of the file (nil if it was not loaded)
+func (r *renderer) fileLines(file string) []string {
+    if lines,ok := r.lines[file]; ok {
+        return lines
+    }
+
+    var lines []string
+    if src,ok := r.source(file); ok {
+        lines = strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+    }
+    r.lines[file] = lines
+
+    return lines
+}
+
+// length of the token at col (identifier, number, string/char literal or a single char)
+func spanLen(line string, col int) int {
+    i := col-1
+    if i < 0 || i >= len(line) {
+        return 1
+    }
+
+    switch c := line[i]; {
+    case c == '"' || c == '\'':
+        for end := i+1; end < len(line); end++ {
+            if line[end] == '\\' {
+                end++
+            } else if line[end] == c {
+                return end-i+1
+            }
+        }
+        return len(line)-i
+
+    case isWordChar(c):
+        end := i
+        for end < len(line) && isWordChar(line[end]) {
+            end++
+        }
+        return end-i
+    }
+
+    return 1
+}
+
+func isWordChar(c byte) bool {
+    return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// "file:line:col" (the file can contain ":")
+func splitPos(pos string) (file string, line int, col int, ok bool) {
+    idxCol := strings.LastIndex(pos, ":")
+    if idxCol == -1 {
+        return "", 0, 0, false
+    }
+    idxLine := strings.LastIndex(pos[:idxCol], ":")
+    if idxLine == -1 {
+        return "", 0, 0, false
+    }
+
+    line, errLine := strconv.Atoi(pos[idxLine+1:idxCol])
+    col, errCol := strconv.Atoi(pos[idxCol+1:])
+    if errLine != nil || errCol != nil || line < 1 || col < 1 {
+        return "", 0, 0, false
+    }
+
+    return pos[:idxLine], line, col, true
+}
+
+func lineNum(pos string) string {
+    if _, line, _, ok := splitPos(pos); ok {
+        return strconv.Itoa(line)
+    }
+    return ""
+}
+
+type jsonPos struct {
+    File string `json:"file,omitempty"`
+    Line int    `json:"line,omitempty"`
+    Col int     `json:"col,omitempty"`
+}
+
+type jsonNote struct {
+    Msg string  `json:"message"`
+    jsonPos
+}
+
+type jsonDiag struct {
+    Severity string     `json:"severity"`
+    Msg string          `json:"message"`
+    jsonPos
+    Notes []jsonNote    `json:"notes,omitempty"`
+}
+
+func toJsonPos(pos string) jsonPos {
+    if file, line, col, ok := splitPos(pos); ok {
+        return jsonPos{ File: file, Line: line, Col: col }
+    }
+    return jsonPos{}
+}
+
+func (r *renderer) renderJson(d Diagnostic) {
+    res := jsonDiag{ Severity: d.Severity, Msg: d.Msg, jsonPos: toJsonPos(d.Pos) }
+    for _,n := range d.Notes {
+        res.Notes = append(res.Notes, jsonNote{ Msg: n.Msg, jsonPos: toJsonPos(n.Pos) })
+    }
+
+    b, err := json.Marshal(res)
+    if err != nil {
+        fmt.Fprintf(r.out, "[ERROR] (internal) could not write the diagnostic as JSON (%v)\n", err)
+        return
+    }
+
+    r.out.Write(append(b, '\n'))
+}
@@ -0,0 +1,93 @@
+package diag
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// adds "did you mean ...?" if candidates contains names close to name (an unknown identifier, field, ...)
+func (state *State) Suggest(name string, candidates []string) {
+    if s := Suggestions(name, candidates); len(s) > 0 {
+        state.Linef("did you mean %s?", orList(s))
+    }
+}
+
+// the closest candidates by edit distance (at most 3, nil if none is close enough)
+func Suggestions(name string, candidates []string) []string {
+    // about one typo every 3 chars (no suggestions for single chars)
+    maxDist := (len(name)+1) / 3
+
+    best := maxDist
+    var res []string
+    seen := make(map[string]bool, len(candidates))
+    for _,c := range candidates {
+        if c == name || seen[c] || (strings.HasPrefix(c, "_") && !strings.HasPrefix(name, "_")) {
+            continue
+        }
+        seen[c] = true
+
+        d := editDistance(strings.ToLower(name), strings.ToLower(c))
+        if d > maxDist || d >= len(c) {
+            continue
+        }
+
+        switch {
+        case d < best:
+            best = d
+            res = []string{ c }
+        case d == best:
+            res = append(res, c)
+        }
+    }
+
+    sort.Strings(res)
+    if len(res) > 3 {
+        res = res[:3]
+    }
+
+    return res
+}
+
+// Levenshtein distance (insert, delete or replace a byte)
+func editDistance(a string, b string) int {
+    prev := make([]int, len(b)+1)
+    cur := make([]int, len(b)+1)
+    for j := range prev {
+        prev[j] = j
+    }
+
+    for i := 1; i <= len(a); i++ {
+        cur[0] = i
+        for j := 1; j <= len(b); j++ {
+            cost := 1
+            if a[i-1] == b[j-1] {
+                cost = 0
+            }
+
+            cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+        }
+        prev, cur = cur, prev
+    }
+
+    return prev[len(b)]
+}
+
+func min3(a int, b int, c int) int {
+    if b < a { a = b }
+    if c < a { a = c }
+    return a
+}
+
+// "a", "b" or "c"
+func orList(names []string) string {
+    quoted := make([]string, len(names))
+    for i,n := range names {
+        quoted[i] = fmt.Sprintf("\"%s\"", n)
+    }
+
+    if len(quoted) == 1 {
+        return quoted[0]
+    }
+    return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
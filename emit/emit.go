@@ -0,0 +1,520 @@
+package emit
+
+import (
+    "io"
+    "fmt"
+    "sort"
+    "bytes"
+    "reflect"
+    "strings"
+    "encoding/json"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/ast/identObj/vars"
+)
+
+/*
+compiler output as JSON for tools (gamma -emit=<kind>)
+  * tokens:     tokens of the main file
+  * ast-json:   nodes with kind, position, resolved type and their fields (see node)
+  * symbols:    identObjs with kind, type and position
+positions are "file:line:col", types are written like in gamma
+identObjs in the AST are references ({ "name", "kind", "decl" }) to the symbols
+only the main file is written (the imported files too with imports)
+*/
+
+const (
+    Tokens  string = "tokens"
+    AstJson string = "ast-json"
+    Symbols string = "symbols"
+)
+
+// object with ordered keys
+type object []field
+
+type field struct {
+    key string
+    val interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+    var buf bytes.Buffer
+    buf.WriteByte('{')
+    for i,f := range o {
+        if i > 0 {
+            buf.WriteByte(',')
+        }
+
+        key, err := marshal(f.key)
+        if err != nil {
+            return nil, err
+        }
+        val, err := marshal(f.val)
+        if err != nil {
+            return nil, err
+        }
+
+        buf.Write(key)
+        buf.WriteByte(':')
+        buf.Write(val)
+    }
+    buf.WriteByte('}')
+
+    return buf.Bytes(), nil
+}
+
+// without escaping "<", ">" and "&" (used by types like "fn(i32) -> i32")
+func marshal(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    enc := json.NewEncoder(&buf)
+    enc.SetEscapeHTML(false)
+    if err := enc.Encode(v); err != nil {
+        return nil, err
+    }
+
+    return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+func (state *State) write(w io.Writer, v interface{}) {
+    enc := json.NewEncoder(w)
+    enc.SetEscapeHTML(false)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(v); err != nil {
+        state.diag.Errorf("(internal) could not write JSON (%v)", err)
+        state.diag.Exit()
+    }
+}
+
+func pos(p token.Pos) string {
+    return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+func (state *State) WriteTokens(w io.Writer, tokens []token.Token) {
+    res := make([]object, 0, len(tokens))
+    for _,t := range tokens {
+        res = append(res, object{ { "kind", t.Type.String() }, { "str", t.Str }, { "pos", pos(t.Pos) } })
+    }
+
+    state.write(w, res)
+}
+
+func (state *State) WriteSymbols(w io.Writer, file string, imports bool) {
+    type symbol struct {
+        obj identObj.IdentObj
+        global bool
+    }
+
+    var symbols []symbol
+    state.identObj.Walk(func(obj identObj.IdentObj, global bool) {
+        if imports || obj.GetPos().File == file {
+            symbols = append(symbols, symbol{ obj, global })
+        }
+    })
+
+    // scopes are maps (sorted by position for a stable output)
+    sort.SliceStable(symbols, func(i, j int) bool {
+        if symbols[i].global != symbols[j].global {
+            return symbols[i].global
+        }
+
+        pi, pj := symbols[i].obj.GetPos(), symbols[j].obj.GetPos()
+        if pi.File != pj.File { return pi.File < pj.File }
+        if pi.Line != pj.Line { return pi.Line < pj.Line }
+        if pi.Col  != pj.Col  { return pi.Col  < pj.Col }
+        return symbols[i].obj.GetName() < symbols[j].obj.GetName()
+    })
+
+    res := make([]object, 0, len(symbols))
+    for _,s := range symbols {
+        o := object{ { "name", s.obj.GetName() }, { "kind", objKind(s.obj) } }
+        if t := typeStr(s.obj.GetType()); t != "" {
+            o = append(o, field{ "type", t })
+        }
+        if s.obj.GetPos().File != "" {
+            o = append(o, field{ "pos", pos(s.obj.GetPos()) })
+        }
+        if s.global {
+            o = append(o, field{ "scope", "global" })
+        } else {
+            o = append(o, field{ "scope", "local" })
+        }
+
+        res = append(res, o)
+    }
+
+    state.write(w, res)
+}
+
+func (state *State) WriteAst(w io.Writer, Ast ast.Ast, file string, imports bool) {
+    e := emitter{ imports: imports, state: state }
+
+    decls := make([]interface{}, 0, len(Ast.Decls))
+    for _,d := range Ast.Decls {
+        // like the decls of buildin.gma
+        if !imports && declPos(d).File != file {
+            continue
+        }
+
+        decls = append(decls, e.node(d))
+    }
+
+    state.write(w, object{ { "decls", decls }, { "noMainArg", Ast.NoMainArg }, { "tests", Ast.Tests } })
+}
+
+func objKind(obj identObj.IdentObj) string {
+    switch obj.(type) {
+    case *identObj.Func:
+        return "Func"
+    case *identObj.Const:
+        return "Const"
+    case *vars.GlobalVar:
+        return "GlobalVar"
+    case *vars.LocalVar:
+        return "LocalVar"
+    case *identObj.Struct:
+        return "Struct"
+    case *identObj.Interface:
+        return "Interface"
+    case *identObj.Enum:
+        return "Enum"
+    case *identObj.Generic:
+        return "Generic"
+    default:
+        return "Unknown"
+    }
+}
+
+func typeStr(t types.Type) string {
+    if t == nil || (reflect.ValueOf(t).Kind() == reflect.Ptr && reflect.ValueOf(t).IsNil()) {
+        return ""
+    }
+
+    return t.String()
+}
+
+// "" for positions without a file (like the type of self)
+func trimAt(s string) string {
+    s = strings.TrimPrefix(s, "at: ")
+    if strings.HasPrefix(s, ":") {
+        return ""
+    }
+    return s
+}
+
+type emitter struct {
+    imports bool    // write the decls of imports
+    state *State
+}
+
+// kind, pos, end and the resolved type (exprs) followed by the fields of the node
+func (e *emitter) node(n ast.Node) interface{} {
+    if n == nil || (reflect.ValueOf(n).Kind() == reflect.Ptr && reflect.ValueOf(n).IsNil()) {
+        return nil
+    }
+
+    kind, fields := e.fields(n)
+
+    o := object{ { "kind", kind } }
+    if p := e.pos(n); p != "" {
+        o = append(o, field{ "pos", p })
+    }
+    if p := trimAt(n.End()); p != "" {
+        o = append(o, field{ "end", p })
+    }
+    if ex,ok := n.(ast.Expr); ok {
+        if t := typeStr(ex.GetType()); t != "" {
+            o = append(o, field{ "type", t })
+        }
+    }
+
+    return append(o, compact(fields)...)
+}
+
+// position of the name for declarations of vars and consts (At is the position of ":=" or "::")
+func (e *emitter) pos(n ast.Node) string {
+    if s,ok := n.(*ast.DeclStmt); ok {
+        n = s.Decl
+    }
+
+    if d,ok := n.(ast.Decl); ok {
+        if p := declPos(d); p.File != "" {
+            return pos(p)
+        }
+    }
+
+    return trimAt(n.At())
+}
+
+func declPos(d ast.Decl) token.Pos {
+    switch d := d.(type) {
+    case *ast.DefVar:
+        return d.V.GetPos()
+    case *ast.DefConst:
+        return d.C.GetPos()
+    case *ast.DefFn:
+        return d.Pos
+    case *ast.DefStruct:
+        return d.Pos
+    case *ast.DefInterface:
+        return d.Pos
+    case *ast.DefEnum:
+        return d.Pos
+    case *ast.Impl:
+        return d.Pos
+    case *ast.Import:
+        return d.Pos
+    default:
+        return token.Pos{}
+    }
+}
+
+// without nil values
+func compact(fields []field) object {
+    o := make(object, 0, len(fields))
+    for _,f := range fields {
+        if !isNil(f.val) {
+            o = append(o, f)
+        }
+    }
+    return o
+}
+
+func (e *emitter) fields(n ast.Node) (string, []field) {
+    switch n := n.(type) {
+    case *ast.BadDecl:
+        return "BadDecl", nil
+    case *ast.DecVar:
+        return "DecVar", []field{ { "name", n.V.GetName() }, { "obj", ref(n.V) }, { "varType", typeStr(n.Type) } }
+    case *ast.DecField:
+        return "DecField", []field{ { "name", n.Name.Str }, { "fieldType", typeStr(n.Type) } }
+    case *ast.DefVar:
+        return "DefVar", []field{ { "name", n.V.GetName() }, { "obj", ref(n.V) }, { "varType", typeStr(n.V.GetType()) }, { "value", e.node(n.Value) } }
+    case *ast.DefConst:
+        return "DefConst", []field{ { "name", n.C.GetName() }, { "obj", ref(n.C) }, { "constType", typeStr(n.C.GetType()) }, { "value", e.node(n.Value) } }
+    case *ast.DefFn:
+        return "DefFn", append(e.fnHead(&n.FnHead), field{ "block", e.node(&n.Block) })
+    case *ast.DefStruct:
+        fields := make([]interface{}, 0, len(n.Fields))
+        for i := range n.Fields {
+            fields = append(fields, e.node(&n.Fields[i]))
+        }
+        return "DefStruct", []field{ { "name", n.Name.Str }, { "obj", ref(n.S) }, { "generic", n.Generic.Str }, { "fields", fields } }
+    case *ast.DefInterface:
+        fnHeads := make([]interface{}, 0, len(n.FnHeads))
+        for i := range n.FnHeads {
+            fnHeads = append(fnHeads, compact(e.fnHead(&n.FnHeads[i])))
+        }
+        return "DefInterface", []field{ { "name", n.Name.Str }, { "obj", ref(n.I) }, { "generic", n.Generic.Str }, { "fnHeads", fnHeads } }
+    case *ast.DefEnum:
+        elems := make([]interface{}, 0, len(n.Elems))
+        for _,el := range n.Elems {
+            o := object{ { "name", el.Name.Str }, { "pos", pos(el.Name.Pos) } }
+            if el.Type != nil {
+                o = append(o, field{ "elemType", typeStr(el.Type.Type) })
+            }
+            elems = append(elems, o)
+        }
+        return "DefEnum", []field{ { "name", n.Name.Str }, { "obj", ref(n.E) }, { "generic", n.Generic.Str }, { "idType", typeStr(n.IdType) }, { "elems", elems } }
+    case *ast.Impl:
+        fnDefs := make([]interface{}, 0, len(n.FnDefs))
+        for i := range n.FnDefs {
+            fnDefs = append(fnDefs, e.node(&n.FnDefs[i]))
+        }
+        return "Impl", []field{ { "dstType", typeStr(n.Impl.GetDstType()) }, { "interface", n.Impl.GetInterfaceName() }, { "fnDefs", fnDefs } }
+    case *ast.Import:
+        var decls []interface{}
+        if e.imports {
+            for _,d := range n.Decls {
+                decls = append(decls, e.node(d))
+            }
+        }
+        return "Import", []field{ { "path", strings.Trim(n.Path.Str, "\"") }, { "decls", decls } }
+
+    case *ast.BadExpr:
+        return "BadExpr", nil
+    case *ast.IntLit:
+        return "IntLit", []field{ { "val", n.Val.Str } }
+    case *ast.BoolLit:
+        return "BoolLit", []field{ { "val", n.Val.Str } }
+    case *ast.CharLit:
+        return "CharLit", []field{ { "val", n.Val.Str } }
+    case *ast.PtrLit:
+        return "PtrLit", []field{ { "val", n.Val.Str } }
+    case *ast.StrLit:
+        return "StrLit", []field{ { "val", n.Val.Str } }
+    case *ast.ArrayLit:
+        return "ArrayLit", []field{ { "values", e.exprs(n.Values) } }
+    case *ast.VectorLit:
+        return "VectorLit", []field{ { "cap", e.node(n.Cap) }, { "len", e.node(n.Len) } }
+    case *ast.StructLit:
+        fields := make([]interface{}, 0, len(n.Fields))
+        for i := range n.Fields {
+            fields = append(fields, e.node(&n.Fields[i]))
+        }
+        return "StructLit", []field{ { "fields", fields } }
+    case *ast.FieldLit:
+        return "FieldLit", []field{ { "name", n.Name.Str }, { "value", e.node(n.Value) } }
+    case *ast.EnumLit:
+        var content interface{}
+        if n.Content != nil {
+            content = e.node(n.Content)
+        }
+        return "EnumLit", []field{ { "elem", n.ElemName.Str }, { "content", content } }
+    case *ast.Unwrap:
+        var obj interface{}
+        if n.Obj != nil {
+            obj = ref(n.Obj)
+        }
+        return "Unwrap", []field{ { "expr", e.node(n.SrcExpr) }, { "elem", n.ElemName.Str }, { "obj", obj } }
+    case *ast.FnCall:
+        return "FnCall", []field{ { "name", n.Ident.Name }, { "obj", ref(n.F) }, { "fnSrc", typeStr(n.FnSrc) }, { "insetType", typeStr(n.InsetType) }, { "args", e.exprs(n.Values) } }
+    case *ast.Indexed:
+        return "Indexed", []field{ { "expr", e.node(n.ArrExpr) }, { "index", e.node(n.Index) } }
+    case *ast.Field:
+        return "Field", []field{ { "expr", e.node(n.Obj) }, { "name", n.FieldName.Str } }
+    case *ast.Ident:
+        var obj interface{}
+        if n.Obj != nil {
+            obj = ref(n.Obj)
+        }
+        return "Ident", []field{ { "name", n.Name }, { "obj", obj } }
+    case *ast.Unary:
+        return "Unary", []field{ { "op", n.Operator.Str }, { "operand", e.node(n.Operand) } }
+    case *ast.Binary:
+        return "Binary", []field{ { "op", n.Operator.Str }, { "left", e.node(n.OperandL) }, { "right", e.node(n.OperandR) } }
+    case *ast.Paren:
+        return "Paren", []field{ { "expr", e.node(n.Expr) } }
+    case *ast.XSwitch:
+        cases := make([]interface{}, 0, len(n.Cases))
+        for i := range n.Cases {
+            cases = append(cases, e.node(&n.Cases[i]))
+        }
+        return "XSwitch", []field{ { "cases", cases } }
+    case *ast.XCase:
+        return "XCase", []field{ { "cond", e.node(n.Cond) }, { "expr", e.node(n.Expr) } }
+    case *ast.Cast:
+        return "Cast", []field{ { "expr", e.node(n.Expr) }, { "destType", typeStr(n.DestType) } }
+
+    case *ast.BadStmt:
+        return "BadStmt", nil
+    case *ast.DeclStmt:
+        return "DeclStmt", []field{ { "decl", e.node(n.Decl) } }
+    case *ast.ExprStmt:
+        return "ExprStmt", []field{ { "expr", e.node(n.Expr) } }
+    case *ast.Assign:
+        return "Assign", []field{ { "dest", e.node(n.Dest) }, { "value", e.node(n.Value) } }
+    case *ast.Block:
+        stmts := make([]interface{}, 0, len(n.Stmts))
+        for _,s := range n.Stmts {
+            stmts = append(stmts, e.node(s))
+        }
+        return "Block", []field{ { "stmts", stmts } }
+    case *ast.If:
+        return "If", e.ifFields((*ast.If)(n))
+    case *ast.Elif:
+        return "Elif", e.ifFields((*ast.If)(n))
+    case *ast.Else:
+        return "Else", []field{ { "block", e.node(&n.Block) } }
+    case *ast.Switch:
+        cases := make([]interface{}, 0, len(n.Cases))
+        for i := range n.Cases {
+            cases = append(cases, e.node(&n.Cases[i]))
+        }
+        return "Switch", []field{ { "cases", cases } }
+    case *ast.Case:
+        return "Case", []field{ { "cond", e.node(n.Cond) }, { "stmt", e.node(n.Stmt) } }
+    case *ast.Through:
+        return "Through", nil
+    case *ast.While:
+        var def interface{}
+        if n.Def != nil {
+            def = e.node(n.Def)
+        }
+        return "While", []field{ { "cond", e.node(n.Cond) }, { "def", def }, { "block", e.node(&n.Block) } }
+    case *ast.For:
+        return "For", []field{ { "def", e.node(&n.Def) }, { "limit", e.node(n.Limit) }, { "step", e.node(n.Step) }, { "block", e.node(&n.Block) } }
+    case *ast.Break:
+        return "Break", nil
+    case *ast.Continue:
+        return "Continue", nil
+    case *ast.Ret:
+        return "Ret", []field{ { "expr", e.node(n.RetExpr) } }
+
+    default:
+        e.state.diag.Errorf("(internal) no JSON schema for %s", reflect.TypeOf(n))
+        e.state.diag.Exit()
+        return "", nil
+    }
+}
+
+func (e *emitter) fnHead(h *ast.FnHead) []field {
+    args := make([]interface{}, 0, len(h.Args))
+    for i := range h.Args {
+        args = append(args, e.node(&h.Args[i]))
+    }
+
+    var generic interface{}
+    if h.Generic != nil {
+        generic = h.Generic.GetName()
+    }
+
+    return []field{
+        { "name", h.Name.Str },
+        { "obj", ref(h.F) },
+        { "generic", generic },
+        { "args", args },
+        { "retType", typeStr(h.RetType) },
+        { "isConst", h.IsConst },
+    }
+}
+
+func (e *emitter) ifFields(n *ast.If) []field {
+    var els, elif interface{}
+    if n.Else != nil {
+        els = e.node(n.Else)
+    }
+    if n.Elif != nil {
+        elif = e.node(n.Elif)
+    }
+
+    return []field{ { "cond", e.node(n.Cond) }, { "block", e.node(&n.Block) }, { "else", els }, { "elif", elif } }
+}
+
+func (e *emitter) exprs(exprs []ast.Expr) []interface{} {
+    res := make([]interface{}, 0, len(exprs))
+    for _,ex := range exprs {
+        res = append(res, e.node(ex))
+    }
+    return res
+}
+
+// nil, "", false and empty lists are not written
+func isNil(v interface{}) bool {
+    switch v := v.(type) {
+    case nil:
+        return true
+    case string:
+        return v == ""
+    case bool:
+        return !v
+    case []interface{}:
+        return len(v) == 0
+    case object:
+        return v == nil
+    }
+    return false
+}
+
+func ref(obj identObj.IdentObj) interface{} {
+    if obj == nil || (reflect.ValueOf(obj).Kind() == reflect.Ptr && reflect.ValueOf(obj).IsNil()) {
+        return nil
+    }
+
+    o := object{ { "name", obj.GetName() }, { "kind", objKind(obj) } }
+    if obj.GetPos().File != "" {
+        o = append(o, field{ "decl", pos(obj.GetPos()) })
+    }
+    return o
+}
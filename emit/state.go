@@ -0,0 +1,16 @@
+package emit
+
+import (
+    "gamma/ast/identObj"
+    "gamma/diag"
+)
+
+// the states used to write the JSON (see gamma/compiler)
+type State struct {
+    identObj *identObj.State
+    diag *diag.State
+}
+
+func NewState(identObj *identObj.State, diag *diag.State) *State {
+    return &State{ identObj: identObj, diag: diag }
+}
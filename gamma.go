@@ -5,17 +5,43 @@ import (
     "os/exec"
     "fmt"
     "flag"
-    "gamma/check"
-    "gamma/import"
-    "gamma/parser"
-    "gamma/resolver"
     "gamma/gen"
-    "gamma/gen/asm/x86_64/nasm"
+    "gamma/diag"
+    "gamma/check"
+    "gamma/compiler"
 )
 
 var run bool
 var showAst bool
+var verbose bool
+var useNasm bool
+var objOnly bool
+var useC bool
+var opt0 bool
+var opt1 bool
+var opt2 bool
+var checkConsts bool
+var checkOverflow bool
+var emit string
+var emitImports bool
+var errorFormat string
 var importDir string
+var warnings warnFlags
+var warnError bool
+var analyses warnFlags
+var edition uint
+
+// -W (and -A) can be set more than once
+type warnFlags []string
+
+func (w *warnFlags) String() string {
+    return fmt.Sprint(*w)
+}
+
+func (w *warnFlags) Set(s string) error {
+    *w = append(*w, s)
+    return nil
+}
 
 func runExe() {
     fmt.Printf("[EXEC] ./output\n\n")
@@ -27,13 +53,63 @@ func runExe() {
     }
 }
 
+// runs the test runner and exits with its exit code
+func runTests() {
+    fmt.Printf("[EXEC] ./output\n\n")
+
+    cmd := exec.Command("./output")
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+
+    if err := cmd.Run(); err != nil {
+        if exitErr,ok := err.(*exec.ExitError); ok {
+            os.Exit(exitErr.ExitCode())
+        }
+        fmt.Fprintln(os.Stderr, "[ERROR]", err)
+        os.Exit(1)
+    }
+}
+
+func getOptLevel() uint {
+    switch {
+    case opt0 && !opt1 && !opt2:
+        return gen.O0
+    case opt2 && !opt0 && !opt1:
+        return gen.O2
+    case opt0 || opt2:
+        fmt.Fprintln(os.Stderr, "[ERROR] only one optimization level (-O0, -O1 or -O2) can be set")
+        os.Exit(1)
+    }
+
+    return gen.O1
+}
+
 func init() {
     flag.BoolVar(&run, "r", false, "run the compiled executable")
     flag.BoolVar(&showAst, "ast", false, "show the AST")
+    flag.BoolVar(&verbose, "v", false, "report removed unused functions and data")
     flag.StringVar(&importDir, "I", "./std", "set import dir")
+    flag.BoolVar(&useNasm, "nasm", false, "use nasm and ld instead of the build-in assembler/linker")
+    flag.BoolVar(&objOnly, "c", false, "only generate the object file (output.o)")
+    flag.BoolVar(&useC, "cc", false, "generate C (output.c) and compile it with the system cc")
+    flag.BoolVar(&opt0, "O0", false, "straightforward code for debugging (consts are folded, checks the divisor of / and %)")
+    flag.BoolVar(&opt1, "O1", false, "jump tables and removal of unused functions/data (default)")
+    flag.BoolVar(&opt2, "O2", false, "O1 + peephole optimizations of the asm")
+    flag.StringVar(&emit, "emit", "", "write JSON to stdout instead of compiling (tokens, ast-json or symbols)")
+    flag.BoolVar(&emitImports, "emit-imports", false, "write the imported files too with -emit=ast-json or -emit=symbols")
+    flag.StringVar(&errorFormat, "error-format", "text", "how errors are shown (text: with source lines, plain or json)")
+    flag.Var(&warnings, "W", "enable/disable warnings (all, none, <category> or no-<category>, comma separated)")
+    flag.BoolVar(&warnError, "Werror", false, "report warnings as errors")
+    flag.Var(&analyses, "A", "enable/disable analyses of gamma vet (all, none, <analysis> or no-<analysis>, comma separated)")
+    flag.UintVar(&edition, "edition", check.Edition1, "language edition (2: locals are immutable unless declared with mut)")
+    flag.BoolVar(&checkConsts, "check-consts", false, "compute folded constants at runtime too and report mismatches (on stderr)")
+    flag.BoolVar(&checkOverflow, "check-overflow", false, "exit with an error if +, -, * or unary - of ints/uints overflows at runtime")
 
     flag.Usage = func() {
         fmt.Println("gamma usage:")
+        fmt.Println("  gamma [flags] <file>        compile <file>")
+        fmt.Println("  gamma test [flags] <file>   compile and run the test blocks of <file>")
+        fmt.Println("  gamma vet [flags] <file>    report suspicious code in <file> (exits with 1 if there is any)")
         flag.PrintDefaults()
     }
 
@@ -41,23 +117,56 @@ func init() {
 }
 
 func main() {
+    tests := flag.Arg(0) == "test"
+    vet := flag.Arg(0) == "vet"
+    if tests || vet {
+        flag.CommandLine.Parse(flag.Args()[1:])
+    }
+
     path := flag.Arg(0)
     if path == "" {
         fmt.Fprintln(os.Stderr, "[ERROR] you need to provide a source file to compile")
         os.Exit(1)
     }
 
-    imprt.SetImportDirs(path, importDir)
-
-    Ast := prs.Parse(path)
-    Ast = resolver.Resolve(Ast)
-    if showAst { Ast.ShowAst() }
+    format, ok := diag.ParseFormat(errorFormat)
+    if !ok {
+        fmt.Fprintf(os.Stderr, "[ERROR] unknown error format \"%s\" (expected text, plain or json)\n", errorFormat)
+        os.Exit(1)
+    }
 
-    check.TypeCheck(Ast)
+    if edition != check.Edition1 && edition != check.Edition2 {
+        fmt.Fprintf(os.Stderr, "[ERROR] unknown edition %d (expected 1 or 2)\n", edition)
+        os.Exit(1)
+    }
 
-    // TODO: optimization step
-    gen.GenAsm(Ast)
+    compiler.NewSession().Compile(path, compiler.Options{
+        ImportDir: importDir,
+        OptLevel: getOptLevel(),
+        Verbose: verbose,
+        ShowAst: showAst,
+        UseC: useC,
+        UseNasm: useNasm,
+        ObjOnly: objOnly,
+        Tests: tests,
+        CheckConsts: checkConsts,
+        CheckOverflow: checkOverflow,
+        Emit: emit,
+        EmitImports: emitImports,
+        ErrorFormat: format,
+        Warnings: warnings,
+        WarnError: warnError,
+        Vet: vet,
+        Analyses: analyses,
+        Edition: edition,
+        Color: diag.IsTerminal(os.Stderr) && os.Getenv("NO_COLOR") == "",
+    })
 
-    nasm.GenExe()
-    if run { runExe() }
+    switch {
+    case objOnly, emit != "", vet:
+    case tests:
+        runTests()
+    case run:
+        runExe()
+    }
 }
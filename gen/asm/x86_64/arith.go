@@ -3,6 +3,7 @@ package asm
 import (
     "fmt"
     "bufio"
+    "gamma/types"
 )
 
 func Eql(file *bufio.Writer, lhs string, rhs string) {
@@ -53,8 +54,10 @@ func Div(file *bufio.Writer, src string, size uint, signed bool) {
     if signed {
         if size == 8 {
             file.WriteString("cqo\n") // sign extend rax into rdx (div with 64bit regs -> 128bit div)
-        } else if size == 4 {
-            file.WriteString("cdq\n") // sign extend eax into edx (div with 32bit regs -> 64bit div)
+        } else {
+            signExtend32(file, RegA, size)
+            signExtend32(file, RegB, size)
+            file.WriteString("cdq\n") // sign extend eax into edx (div with 32bit regs -> 64bit div, smaller sizes use 32bit regs too)
         }
         file.WriteString(fmt.Sprintf("idiv %s\n", GetReg(RegB, size)))
     } else {
@@ -72,7 +75,9 @@ func Mod(file *bufio.Writer, src string, size uint, signed bool) {
     if signed {
         if size == 8 {
             file.WriteString("cqo\n")
-        } else if size == 4 {
+        } else {
+            signExtend32(file, RegA, size)
+            signExtend32(file, RegB, size)
             file.WriteString("cdq\n")
         }
         file.WriteString(fmt.Sprintf("idiv %s\n", GetReg(RegB, size)))
@@ -98,8 +103,41 @@ func Xor(file *bufio.Writer, src string, size uint) {
     file.WriteString(fmt.Sprintf("xor %s, %s\n", GetReg(RegA, size), src))
 }
 func Shl(file *bufio.Writer, src string, size uint) {
-    file.WriteString(fmt.Sprintf("shl %s, %s\n", GetReg(RegA, size), src))
+    shift(file, "shl", src, size)
 }
-func Shr(file *bufio.Writer, src string, size uint) {
-    file.WriteString(fmt.Sprintf("shr %s, %s\n", GetReg(RegA, size), src))
+func Shr(file *bufio.Writer, src string, size uint, signed bool) {
+    if signed {
+        signExtend32(file, RegA, size)
+        shift(file, "sar", src, size)
+    } else {
+        shift(file, "shr", src, size)
+    }
+}
+
+// the count of a shift is an immediate or cl
+func shift(file *bufio.Writer, op string, src string, size uint) {
+    if isImm(src) {
+        file.WriteString(fmt.Sprintf("%s %s, %s\n", op, GetReg(RegA, size), src))
+        return
+    }
+
+    PushReg(file, RegC)
+    file.WriteString(fmt.Sprintf("mov %s, %s\n", GetReg(RegC, size), src))
+    file.WriteString(fmt.Sprintf("%s %s, cl\n", op, GetReg(RegA, size)))
+    PopReg(file, RegC)
+}
+
+// i8/i16 are zero extended in the 32bit regs
+func signExtend32(file *bufio.Writer, reg RegGroup, size uint) {
+    if size < types.I32_Size {
+        MovRegRegExtend(file, reg, types.I32_Size, reg, size, true)
+    }
+}
+
+func isImm(s string) bool {
+    if len(s) > 0 && s[0] == '-' {
+        s = s[1:]
+    }
+
+    return len(s) > 0 && s[0] >= '0' && s[0] <= '9'
 }
@@ -1,23 +1,21 @@
 package asm
 
 import (
-    "os"
     "fmt"
     "bufio"
     "gamma/token"
     "gamma/types"
-    "gamma/types/str"
     "gamma/cmpTime/constVal"
 )
 
 // results in A-register
-func BinaryOpStrsLit(file *bufio.Writer, opType token.TokenType, rhsIdx uint64) {
+func (state *State) BinaryOpStrsLit(file *bufio.Writer, opType token.TokenType, rhsIdx uint64) {
     MovRegVal(file, RegB, types.Ptr_Size, fmt.Sprintf("_str%d", rhsIdx))
-    MovRegVal(file, RegC, types.U32_Size, fmt.Sprint(str.GetSize(rhsIdx)))
-    BinaryOpStrs(file, opType)
+    MovRegVal(file, RegC, types.U32_Size, fmt.Sprint(state.str.GetSize(rhsIdx)))
+    state.BinaryOpStrs(file, opType)
 }
 
-func BinaryOpStrs(file *bufio.Writer, opType token.TokenType) {
+func (state *State) BinaryOpStrs(file *bufio.Writer, opType token.TokenType) {
     switch opType {
     case token.Eql:
         file.WriteString("call _str_cmp\n")
@@ -27,12 +25,12 @@ func BinaryOpStrs(file *bufio.Writer, opType token.TokenType) {
     case token.Plus:
         file.WriteString("call _str_concat\n")
     default:
-        fmt.Fprintln(os.Stderr, "[ERROR] unexpected binary operator for str expected (== or !=)")
-        os.Exit(1)
+        state.diag.Error("unexpected binary operator for str expected (== or !=)")
+        state.diag.Exit()
     }
 }
 
-func BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Type) {
+func (state *State) BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Type) {
     switch t.GetKind() {
     case types.Char:
         switch opType {
@@ -41,8 +39,8 @@ func BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Ty
         case token.Neq:
             Neq(file, GetReg(RegA, t.Size()), src)
         default:
-            fmt.Fprintln(os.Stderr, "[ERROR] unexpected binary operator for char expected (== or !=)")
-            os.Exit(1)
+            state.diag.Error("unexpected binary operator for char expected (== or !=)")
+            state.diag.Exit()
         }
 
     case types.Bool:
@@ -60,10 +58,10 @@ func BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Ty
         case token.Geq:
             Geq(file, GetReg(RegA, t.Size()), src)
         default:
-            fmt.Fprintln(os.Stderr, "[ERROR] unexpected binary operator for bool")
+            state.diag.Error("unexpected binary operator for bool")
             // TODO print pos
             // TODO print allowed ops
-            os.Exit(1)
+            state.diag.Exit()
         }
 
     case types.Ptr:
@@ -86,8 +84,8 @@ func BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Ty
         case token.Minus:
             Sub(file, src, t.Size())
         default:
-            fmt.Fprintln(os.Stderr, "[ERROR] unexpected binary operator for ptr")
-            os.Exit(1)
+            state.diag.Error("unexpected binary operator for ptr")
+            state.diag.Exit()
         }
 
 
@@ -120,7 +118,7 @@ func BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Ty
         case token.Shl:
             Shl(file, src, t.Size())
         case token.Shr:
-            Shr(file, src, t.Size())
+            Shr(file, src, t.Size(), t.GetKind() == types.Int)
         case token.Amp:
             And(file, src, t.Size())
         case token.BitOr:
@@ -129,8 +127,8 @@ func BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Ty
             Xor(file, src, t.Size())
 
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] unknown binary operator %v\n", opType)
-            os.Exit(1)
+            state.diag.Errorf("unknown binary operator %v", opType)
+            state.diag.Exit()
         }
 
     case types.Enum:
@@ -142,57 +140,57 @@ func BinaryOp(file *bufio.Writer, opType token.TokenType, src string, t types.Ty
         case token.Neq:
             Neq(file, GetReg(RegA, t.IdType.Size()), src)
         default:
-            fmt.Fprintln(os.Stderr, "[ERROR] unexpected binary operator for char expected (== or !=)")
-            os.Exit(1)
+            state.diag.Error("unexpected binary operator for char expected (== or !=)")
+            state.diag.Exit()
         }
         
         
     case types.Str:
-        fmt.Fprintln(os.Stderr, "[ERROR] (internal) BinaryOpStrs should be called instead of BinaryOp")
-        os.Exit(1)
+        state.diag.Error("(internal) BinaryOpStrs should be called instead of BinaryOp")
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unexpected type for binary operation %v\n", t)
-        os.Exit(1)
+        state.diag.Errorf("unexpected type for binary operation %v", t)
+        state.diag.Exit()
     }
 }
 
-func BinaryOpReg(file *bufio.Writer, opType token.TokenType, reg RegGroup, t types.Type) {
-    BinaryOp(file, opType, GetReg(reg, t.Size()), t)
+func (state *State) BinaryOpReg(file *bufio.Writer, opType token.TokenType, reg RegGroup, t types.Type) {
+    state.BinaryOp(file, opType, GetReg(reg, t.Size()), t)
 }
 
-func BinaryOpEvalStrs(op token.Token, lhsIdx uint64, rhsIdx uint64) constVal.ConstVal {
+func (state *State) BinaryOpEvalStrs(op token.Token, lhsIdx uint64, rhsIdx uint64) constVal.ConstVal {
     switch op.Type {
     case token.Eql:
-        c := constVal.BoolConst(str.CmpStrLits(lhsIdx, rhsIdx))
+        c := constVal.BoolConst(state.str.CmpStrLits(lhsIdx, rhsIdx))
         return &c
     case token.Neq:
-        c := constVal.BoolConst(!str.CmpStrLits(lhsIdx, rhsIdx))
+        c := constVal.BoolConst(!state.str.CmpStrLits(lhsIdx, rhsIdx))
         return &c
     case token.Plus:
-        c := constVal.StrConst(str.ConcatStrLits(op.Pos, lhsIdx, rhsIdx))
+        c := constVal.StrConst(state.str.ConcatStrLits(op.Pos, lhsIdx, rhsIdx))
         return &c
     default:
-        fmt.Fprintln(os.Stderr, "[ERROR] unexpected binary operator for str expected (== or !=)")
-        os.Exit(1)
+        state.diag.Error("unexpected binary operator for str expected (== or !=)")
+        state.diag.Exit()
         return nil
     }
 }
 
-func BinaryOpEvalBools(op token.Token, lhs bool, rhs bool) constVal.ConstVal {
+func (state *State) BinaryOpEvalBools(op token.Token, lhs bool, rhs bool) constVal.ConstVal {
     var b1 int64 = 0
     var b2 int64 = 0
 
     if lhs { b1 = 1 }
     if rhs { b2 = 1 }
 
-    return BinaryOpEvalInts(op, b1, b2)
+    return state.BinaryOpEvalInts(op, b1, b2)
 }
 
-func BinaryOpEvalUints(op token.Token, lhs uint64, rhs uint64) constVal.ConstVal {
-    return BinaryOpEvalInts(op, int64(lhs), int64(rhs))
+func (state *State) BinaryOpEvalUints(op token.Token, lhs uint64, rhs uint64) constVal.ConstVal {
+    return state.BinaryOpEvalInts(op, int64(lhs), int64(rhs))
 }
 
-func BinaryOpEvalInts(op token.Token, lhs int64, rhs int64) constVal.ConstVal {
+func (state *State) BinaryOpEvalInts(op token.Token, lhs int64, rhs int64) constVal.ConstVal {
     switch op.Type {
     case token.Eql:
         c := constVal.BoolConst(lhs == rhs)
@@ -239,19 +237,23 @@ func BinaryOpEvalInts(op token.Token, lhs int64, rhs int64) constVal.ConstVal {
         return &c
 
     case token.Div:
+        state.divByZero(op, rhs)
         c := constVal.IntConst(lhs / rhs)
         return &c
 
     case token.Mod:
+        state.divByZero(op, rhs)
         c := constVal.IntConst(lhs % rhs)
         return &c
 
 
     case token.Shl:
+        state.negShift(op, rhs)
         c := constVal.IntConst(lhs << rhs)
         return &c
 
     case token.Shr:
+        state.negShift(op, rhs)
         c := constVal.IntConst(lhs >> rhs)
         return &c
 
@@ -268,8 +270,25 @@ func BinaryOpEvalInts(op token.Token, lhs int64, rhs int64) constVal.ConstVal {
         return &c
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unknown binary operator %v\n", op)
-        os.Exit(1)
+        state.diag.Errorf("unknown binary operator %v", op)
+        state.diag.Exit()
         return nil
     }
 }
+
+// the type checker reports const operands (this catches the args of const funcs)
+func (state *State) divByZero(op token.Token, rhs int64) {
+    if rhs == 0 {
+        state.diag.Error("division by zero while evaluating at compile time")
+        state.diag.At(op.At())
+        state.diag.Exit()
+    }
+}
+
+func (state *State) negShift(op token.Token, rhs int64) {
+    if rhs < 0 {
+        state.diag.Errorf("negative shift amount %d while evaluating at compile time", rhs)
+        state.diag.At(op.At())
+        state.diag.Exit()
+    }
+}
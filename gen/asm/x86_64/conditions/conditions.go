@@ -6,36 +6,34 @@ import (
     "gamma/types/addr"
 )
 
-var ifCount uint = 0
-
-func ResetCount() {
-    ifCount = 0
-    logCount = 0
-    switchCount = 0
+func (state *State) ResetCount() {
+    state.ifCount = 0
+    state.logCount = 0
+    state.switchCount = 0
 }
 
-func IfVar(file *bufio.Writer, addr addr.Addr, hasElse bool) uint {
-    ifCount++
+func (state *State) IfVar(file *bufio.Writer, addr addr.Addr, hasElse bool) uint {
+    state.ifCount++
 
     file.WriteString(fmt.Sprintf("cmp BYTE [%s], 1\n", addr))
     if hasElse {
-        file.WriteString(fmt.Sprintf("jne .else%d\n", ifCount))
+        file.WriteString(fmt.Sprintf("jne .else%d\n", state.ifCount))
     } else {
-        file.WriteString(fmt.Sprintf("jne .if%dEnd\n", ifCount))
+        file.WriteString(fmt.Sprintf("jne .if%dEnd\n", state.ifCount))
     }
 
-    return ifCount
+    return state.ifCount
 }
 
-func IfExpr(file *bufio.Writer, hasElse bool) uint {
-    ifCount++
+func (state *State) IfExpr(file *bufio.Writer, hasElse bool) uint {
+    state.ifCount++
     file.WriteString("cmp al, 1\n")
     if hasElse {
-        file.WriteString(fmt.Sprintf("jne .else%d\n", ifCount))
+        file.WriteString(fmt.Sprintf("jne .else%d\n", state.ifCount))
     } else {
-        file.WriteString(fmt.Sprintf("jne .if%dEnd\n", ifCount))
+        file.WriteString(fmt.Sprintf("jne .if%dEnd\n", state.ifCount))
     }
-    return ifCount
+    return state.ifCount
 }
 
 func IfEnd(file *bufio.Writer, count uint) {
@@ -1,30 +1,27 @@
 package cond
 
 import (
-    "os"
     "fmt"
     "bufio"
     "gamma/token"
 )
 
-var logCount int = 0
-
-func LogicalOp(file *bufio.Writer, t token.Token) int {
-    logCount++
+func (state *State) LogicalOp(file *bufio.Writer, t token.Token) int {
+    state.logCount++
 
     if t.Type == token.And {
         file.WriteString("cmp al, 0\n")
     } else if t.Type == token.Or {
         file.WriteString("cmp al, 1\n")
     } else {
-        fmt.Fprintf(os.Stderr, "[ERROR] %v is not a valid logical op (expected && or ||)\n", t)
-        fmt.Fprintln(os.Stderr, "\t" + t.At())
-        os.Exit(1)
+        state.diag.Errorf("%v is not a valid logical op (expected && or ||)", t)
+        state.diag.At(t.At())
+        state.diag.Exit()
     }
 
-    file.WriteString(fmt.Sprintf("je .cond%d\n", logCount))
+    file.WriteString(fmt.Sprintf("je .cond%d\n", state.logCount))
 
-    return logCount
+    return state.logCount
 }
 
 func LogicalOpEnd(file *bufio.Writer, count int) {
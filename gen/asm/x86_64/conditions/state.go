@@ -0,0 +1,23 @@
+package cond
+
+import (
+    "gamma/diag"
+    "gamma/gen/asm/x86_64/nasm"
+)
+
+// condition labels of one compilation (see gamma/compiler)
+type State struct {
+    ifCount uint
+    logCount int
+    switchCount uint
+    // jump tables need global labels for the case bodies (not reset per function)
+    dispatchCount uint
+    curSwitch *switch_
+
+    diag *diag.State
+    nasm *nasm.State
+}
+
+func NewState(diag *diag.State, nasm *nasm.State) *State {
+    return &State{ diag: diag, nasm: nasm }
+}
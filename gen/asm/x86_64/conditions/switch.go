@@ -1,7 +1,6 @@
 package cond
 
 import (
-    "os"
     "fmt"
     "bufio"
     "gamma/token"
@@ -13,76 +12,163 @@ type switch_ struct {
     count uint
     caseCount uint
     inLastCase bool
+    dispatch uint       // 0 -> cases are compared one by one
+    lowerCount uint
 }
 
-var switchCount uint = 0
-var curSwitch *switch_ = nil
-
-func InSwitch() bool {
-    return curSwitch != nil
+func (state *State) InSwitch() bool {
+    return state.curSwitch != nil
 }
 
-func StartSwitch() {
-    switchCount++
-    curSwitch = &switch_{ parent: curSwitch, count: switchCount, caseCount: 0, inLastCase: false }
+func (state *State) StartSwitch() {
+    state.switchCount++
+    state.curSwitch = &switch_{ parent: state.curSwitch, count: state.switchCount, caseCount: 0, inLastCase: false }
 }
 
-func EndSwitch(file *bufio.Writer) {
-    file.WriteString(fmt.Sprintf(".switch%dEnd:\n", curSwitch.count))
-    curSwitch = curSwitch.parent
+func (state *State) EndSwitch(file *bufio.Writer) {
+    file.WriteString(fmt.Sprintf(".switch%dEnd:\n", state.curSwitch.count))
+    if state.curSwitch.dispatch != 0 {
+        file.WriteString(state.curSwitch.globalBodyLabel(0) + ":\n")
+    }
+    state.curSwitch = state.curSwitch.parent
 }
 
-func InLastCase() {
-    curSwitch.inLastCase = true
+func (state *State) InLastCase() {
+    state.curSwitch.inLastCase = true
 }
 
-func CaseStart(file *bufio.Writer) {
-    curSwitch.caseCount++
-    file.WriteString(fmt.Sprintf(".case%d%d:\n", curSwitch.count, curSwitch.caseCount))
+func (state *State) CaseStart(file *bufio.Writer) {
+    state.curSwitch.caseCount++
+    file.WriteString(fmt.Sprintf(".case%d%d:\n", state.curSwitch.count, state.curSwitch.caseCount))
 }
 
-func CaseVar(file *bufio.Writer, addr addr.Addr) {
+func (state *State) CaseVar(file *bufio.Writer, addr addr.Addr) {
     file.WriteString(fmt.Sprintf("cmp BYTE [%s], 1\n", addr))
-    if !curSwitch.inLastCase {
-        file.WriteString(fmt.Sprintf("jne .case%d%d\n", curSwitch.count, curSwitch.caseCount+1))
+    if !state.curSwitch.inLastCase {
+        file.WriteString(fmt.Sprintf("jne .case%d%d\n", state.curSwitch.count, state.curSwitch.caseCount+1))
     } else {
-        file.WriteString(fmt.Sprintf("jne .switch%dEnd\n", curSwitch.count))
+        file.WriteString(fmt.Sprintf("jne .switch%dEnd\n", state.curSwitch.count))
     }
 }
 
-func CaseExpr(file *bufio.Writer) {
+func (state *State) CaseExpr(file *bufio.Writer) {
     file.WriteString("cmp al, 1\n")
-    if !curSwitch.inLastCase {
-        file.WriteString(fmt.Sprintf("jne .case%d%d\n", curSwitch.count, curSwitch.caseCount+1))
+    if !state.curSwitch.inLastCase {
+        file.WriteString(fmt.Sprintf("jne .case%d%d\n", state.curSwitch.count, state.curSwitch.caseCount+1))
     } else {
-        file.WriteString(fmt.Sprintf("jne .switch%dEnd\n", curSwitch.count))
+        file.WriteString(fmt.Sprintf("jne .switch%dEnd\n", state.curSwitch.count))
+    }
+}
+
+func (state *State) CaseBody(file *bufio.Writer) {
+    file.WriteString(fmt.Sprintf(".case%d%dBody:\n", state.curSwitch.count, state.curSwitch.caseCount))
+    if state.curSwitch.dispatch != 0 {
+        file.WriteString(state.curSwitch.globalBodyLabel(state.curSwitch.caseCount) + ":\n")
+    }
+}
+
+func (state *State) CaseBodyEnd(file *bufio.Writer) {
+    file.WriteString(fmt.Sprintf("jmp .switch%dEnd\n", state.curSwitch.count))
+}
+
+func (state *State) Break(file *bufio.Writer) {
+    file.WriteString(fmt.Sprintf("jmp .switch%dEnd\n", state.curSwitch.count))
+}
+
+func (state *State) Through(file *bufio.Writer, pos token.Pos) {
+    if state.curSwitch == nil {
+        state.diag.Error("through can only be used inside a switch")
+        state.diag.At(pos.At())
+        state.diag.Exit()
+    }
+
+    if state.curSwitch.inLastCase {
+        state.diag.Error("through cannot be used in the last case")
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
+
+    file.WriteString(fmt.Sprintf("jmp .case%d%dBody\n", state.curSwitch.count , state.curSwitch.caseCount+1))
 }
 
-func CaseBody(file *bufio.Writer) {
-    file.WriteString(fmt.Sprintf(".case%d%dBody:\n", curSwitch.count, curSwitch.caseCount))
+func (s *switch_) bodyLabel(caseIdx uint) string {
+    if caseIdx == 0 {
+        return fmt.Sprintf(".switch%dEnd", s.count)
+    }
+    return fmt.Sprintf(".case%d%dBody", s.count, caseIdx)
 }
 
-func CaseBodyEnd(file *bufio.Writer) {
-    file.WriteString(fmt.Sprintf("jmp .switch%dEnd\n", curSwitch.count))
+// local labels cannot be referenced from .rodata
+// "..@" labels are global but do not interrupt the local labels of the function
+func (s *switch_) globalBodyLabel(caseIdx uint) string {
+    if caseIdx == 0 {
+        return fmt.Sprintf("..@dispatch%dEnd", s.dispatch)
+    }
+    return fmt.Sprintf("..@dispatch%dCase%d", s.dispatch, caseIdx)
+}
+
+// expects the value to switch on in rax (extended to 64bit)
+// targets[i] is the case (starting at 1) for the value min+i (0 -> defaultCase)
+// defaultCase 0 -> no default case (jump to the end of the switch)
+func (state *State) JumpTable(file *bufio.Writer, min int64, targets []uint, defaultCase uint) {
+    state.dispatchCount++
+    state.curSwitch.dispatch = state.dispatchCount
+
+    if min != 0 {
+        raxOpVal(file, "sub", min)
+    }
+    file.WriteString(fmt.Sprintf("cmp rax, %d\n", len(targets)-1))
+    file.WriteString(fmt.Sprintf("ja %s\n", state.curSwitch.bodyLabel(defaultCase)))
+    file.WriteString(fmt.Sprintf("jmp QWORD [_jmptable%d+rax*8]\n", state.curSwitch.dispatch))
+
+    state.nasm.AddRodata("align 8")
+    state.nasm.AddRodata(fmt.Sprintf("_jmptable%d:", state.curSwitch.dispatch))
+    for _,t := range targets {
+        if t == 0 { t = defaultCase }
+        state.nasm.AddRodata(fmt.Sprintf("  dq %s", state.curSwitch.globalBodyLabel(t)))
+    }
 }
 
-func Break(file *bufio.Writer) {
-    file.WriteString(fmt.Sprintf("jmp .switch%dEnd\n", curSwitch.count))
+// expects the value to switch on in rax (extended to 64bit)
+// vals have to be sorted (signed or unsigned)
+// targets[i] is the case (starting at 1) for vals[i]
+// defaultCase 0 -> no default case (jump to the end of the switch)
+func (state *State) BinarySearch(file *bufio.Writer, vals []int64, targets []uint, defaultCase uint, signed bool) {
+    state.binarySearch(file, vals, targets, state.curSwitch.bodyLabel(defaultCase), signed)
 }
 
-func Through(file *bufio.Writer, pos token.Pos) {
-    if curSwitch == nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] through can only be used inside a switch")
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+func (state *State) binarySearch(file *bufio.Writer, vals []int64, targets []uint, defaultLabel string, signed bool) {
+    if len(vals) <= 3 {
+        for i,v := range vals {
+            raxOpVal(file, "cmp", v)
+            file.WriteString(fmt.Sprintf("je %s\n", state.curSwitch.bodyLabel(targets[i])))
+        }
+        file.WriteString(fmt.Sprintf("jmp %s\n", defaultLabel))
+        return
     }
 
-    if curSwitch.inLastCase {
-        fmt.Fprintln(os.Stderr, "[ERROR] through cannot be used in the last case")
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+    mid := len(vals) / 2
+    state.curSwitch.lowerCount++
+    lower := fmt.Sprintf(".switch%dLower%d", state.curSwitch.count, state.curSwitch.lowerCount)
+
+    raxOpVal(file, "cmp", vals[mid])
+    file.WriteString(fmt.Sprintf("je %s\n", state.curSwitch.bodyLabel(targets[mid])))
+    if signed {
+        file.WriteString(fmt.Sprintf("jl %s\n", lower))
+    } else {
+        file.WriteString(fmt.Sprintf("jb %s\n", lower))
     }
 
-    file.WriteString(fmt.Sprintf("jmp .case%d%dBody\n", curSwitch.count , curSwitch.caseCount+1))
+    state.binarySearch(file, vals[mid+1:], targets[mid+1:], defaultLabel, signed)
+    file.WriteString(lower + ":\n")
+    state.binarySearch(file, vals[:mid], targets[:mid], defaultLabel, signed)
+}
+
+// immediates are at most 32bit (sign extended)
+func raxOpVal(file *bufio.Writer, op string, v int64) {
+    if v >= -0x80000000 && v <= 0x7fffffff {
+        file.WriteString(fmt.Sprintf("%s rax, %d\n", op, v))
+    } else {
+        file.WriteString(fmt.Sprintf("mov rcx, %d\n%s rax, rcx\n", v, op))
+    }
 }
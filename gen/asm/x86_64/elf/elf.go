@@ -0,0 +1,473 @@
+package elf
+
+import (
+    "os"
+    "fmt"
+    "strings"
+    "encoding/binary"
+)
+
+// build-in assembler and linker (replaces nasm and ld)
+// generates a static ELF64 executable or a relocatable object file
+
+type fixupKind uint8
+const (
+    fixupAbs64  fixupKind = iota
+    fixupAbs32  fixupKind = iota
+    fixupAbs32S fixupKind = iota
+    fixupRel32  fixupKind = iota
+)
+
+type fixup struct {
+    offset uint64
+    sym string
+    addend int64
+    kind fixupKind
+    lineNum int
+}
+
+type section struct {
+    name string
+    data []byte
+    bssSize uint64
+    fixups []fixup
+    addr uint64
+}
+
+type symbol struct {
+    name string
+    section *section
+    offset uint64
+    global bool
+    lineNum int
+}
+
+type assembler struct {
+    lineNum int
+    scope string        // last non-local label
+    sections []*section
+    cur *section
+    symbols map[string]*symbol
+    symbolOrder []*symbol
+    globals []string
+    state *State
+}
+
+const baseAddr uint64 = 0x400000
+const pageSize uint64 = 0x1000
+
+func (state *State) GenExe() {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generating executable...")
+
+    exe := state.Exe(state.readAsm())
+    if err := os.WriteFile("output", exe, 0755); err != nil {
+        state.diag.Error("could not write \"output\"")
+        state.diag.Exit()
+    }
+
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generated executable")
+}
+
+func (state *State) GenObj() {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generating object file...")
+
+    obj := state.Obj(state.readAsm())
+    if err := os.WriteFile("output.o", obj, 0644); err != nil {
+        state.diag.Error("could not write \"output.o\"")
+        state.diag.Exit()
+    }
+
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generated object file")
+}
+
+// static executable of the asm (without output.asm/output)
+func (state *State) Exe(asm string) []byte {
+    return state.assemble(asm).link()
+}
+
+// relocatable object file of the asm (without output.asm/output.o)
+func (state *State) Obj(asm string) []byte {
+    return state.assemble(asm).object()
+}
+
+func (state *State) readAsm() string {
+    src, err := os.ReadFile("output.asm")
+    if err != nil {
+        state.diag.Error("could not read \"output.asm\"")
+        state.diag.Exit()
+    }
+
+    return string(src)
+}
+
+func (state *State) assemble(src string) *assembler {
+    a := assembler{ symbols: make(map[string]*symbol), state: state }
+    for _,name := range []string{ ".text", ".rodata", ".data", ".bss" } {
+        a.sections = append(a.sections, &section{ name: name })
+    }
+    a.cur = a.sections[0]
+
+    for _,l := range parseLines(src) {
+        a.lineNum = l.num
+
+        if l.label != "" {
+            a.defineLabel(l.label)
+        }
+
+        if l.mnemonic != "" {
+            a.assembleLine(l)
+        }
+    }
+
+    return &a
+}
+
+func (a *assembler) assembleLine(l line) {
+    switch l.mnemonic {
+    case "section", "segment":
+        a.setSection(l.operands)
+
+    case "global":
+        for _,name := range l.operands {
+            a.globals = append(a.globals, name)
+        }
+
+    case "extern":
+        a.err("extern symbols are not supported by the build-in linker (use -nasm)")
+
+    case "align":
+        a.align(l.operands)
+
+    case "db", "dw", "dd", "dq":
+        a.data(l.mnemonic, l.operands)
+
+    case "resb", "resw", "resd", "resq":
+        a.reserve(l.mnemonic, l.operands)
+
+    default:
+        if a.cur.name == ".bss" {
+            a.err("only \"res*\" is allowed in .bss")
+        }
+
+        ops := make([]operand, 0, len(l.operands))
+        for _,o := range l.operands {
+            ops = append(ops, a.parseOperand(o))
+        }
+        a.encode(l.mnemonic, ops)
+    }
+}
+
+func (a *assembler) setSection(operands []string) {
+    if len(operands) != 1 {
+        a.err("expected a section name")
+    }
+
+    for _,s := range a.sections {
+        if s.name == operands[0] {
+            a.cur = s
+            return
+        }
+    }
+
+    a.err("unknown section \"%s\"", operands[0])
+}
+
+func (a *assembler) fullLabelName(name string) string {
+    if len(name) > 1 && name[0] == '$' {   // $ only marks identifiers
+        name = name[1:]
+    }
+
+    if strings.HasPrefix(name, "..") {
+        return name
+    }
+    if name[0] == '.' {
+        return a.scope + name
+    }
+
+    return name
+}
+
+func (a *assembler) defineLabel(label string) {
+    name := a.fullLabelName(label)
+    if label[0] != '.' {
+        a.scope = name
+    }
+
+    if s,ok := a.symbols[name]; ok {
+        a.err("label \"%s\" is already defined at output.asm:%d", name, s.lineNum)
+    }
+
+    s := symbol{ name: name, section: a.cur, offset: a.offset(), lineNum: a.lineNum }
+    a.symbols[name] = &s
+    a.symbolOrder = append(a.symbolOrder, &s)
+}
+
+func (a *assembler) align(operands []string) {
+    if len(operands) != 1 {
+        a.err("\"align\" expects 1 operand")
+    }
+
+    e := a.parseExpr(operands[0])
+    if e.sym != "" || e.val <= 0 || e.val & (e.val-1) != 0 {
+        a.err("alignment has to be a power of 2")
+    }
+
+    pad := (uint64(e.val) - a.offset() % uint64(e.val)) % uint64(e.val)
+    if a.cur.name == ".bss" {
+        a.cur.bssSize += pad
+        return
+    }
+
+    fill := byte(0)
+    if a.cur.name == ".text" {
+        fill = 0x90     // nop
+    }
+    for i := uint64(0); i < pad; i++ {
+        a.emit(fill)
+    }
+}
+
+func (a *assembler) data(directive string, operands []string) {
+    if a.cur.name == ".bss" {
+        a.err("\"%s\" is not allowed in .bss (use \"res*\")", directive)
+    }
+
+    size := map[string]uint8{ "db": 1, "dw": 2, "dd": 4, "dq": 8 }[directive]
+
+    for _,o := range operands {
+        if len(o) >= 2 && o[0] == '"' && o[len(o)-1] == '"' {
+            a.emit([]byte(o[1:len(o)-1])...)
+            // strings get padded to the data size
+            for i := uint64(len(o)-2); i % uint64(size) != 0; i++ {
+                a.emit(0)
+            }
+            continue
+        }
+
+        e := a.parseExpr(o)
+        if e.sym != "" && size < 4 {
+            a.err("symbol \"%s\" does not fit into %d byte(s)", e.sym, size)
+        }
+        a.emitImm(e, size, false)
+    }
+}
+
+func (a *assembler) reserve(directive string, operands []string) {
+    if len(operands) != 1 {
+        a.err("\"%s\" expects 1 operand", directive)
+    }
+
+    e := a.parseExpr(operands[0])
+    if e.sym != "" || e.val < 0 {
+        a.err("\"%s\" expects a positive scalar value", directive)
+    }
+
+    size := map[string]uint64{ "resb": 1, "resw": 2, "resd": 4, "resq": 8 }[directive]
+    if a.cur.name == ".bss" {
+        a.cur.bssSize += uint64(e.val) * size
+    } else {
+        a.emit(make([]byte, uint64(e.val) * size)...)
+    }
+}
+
+func (a *assembler) offset() uint64 {
+    if a.cur.name == ".bss" {
+        return a.cur.bssSize
+    }
+    return uint64(len(a.cur.data))
+}
+
+func (a *assembler) emit(b ...byte) {
+    a.cur.data = append(a.cur.data, b...)
+}
+
+func (a *assembler) addFixup(e expr, kind fixupKind) {
+    a.cur.fixups = append(a.cur.fixups, fixup{ offset: a.offset(), sym: e.sym, addend: e.val, kind: kind, lineNum: a.lineNum })
+}
+
+func (a *assembler) err(format string, args ...interface{}) {
+    a.state.parseErr(a.lineNum, format, args...)
+}
+
+func (a *assembler) warn(format string, args ...interface{}) {
+    a.state.diag.Warningf(format, args...)
+    a.state.diag.At(fmt.Sprintf("output.asm:%d", a.lineNum))
+}
+
+func (a *assembler) getSymbol(f fixup) *symbol {
+    s,ok := a.symbols[f.sym]
+    if !ok {
+        a.state.parseErr(f.lineNum, "undefined symbol \"%s\"", f.sym)
+    }
+    return s
+}
+
+
+// executable: every section gets its own segment (page aligned)
+func (a *assembler) link() []byte {
+    text, rodata, data, bss := a.sections[0], a.sections[1], a.sections[2], a.sections[3]
+
+    fileOffsets := make([]uint64, 3)
+    offset := pageSize
+    for i,s := range []*section{ text, rodata } {
+        fileOffsets[i] = offset
+        s.addr = baseAddr + offset
+        offset = alignUp(offset + uint64(len(s.data)), pageSize)
+    }
+
+    // like ld: the data segment directly follows .rodata in the file
+    // and gets mapped to the next page (with the same page offset)
+    rodataEnd := fileOffsets[1] + uint64(len(rodata.data))
+    fileOffsets[2] = alignUp(rodataEnd, 16)
+    data.addr = baseAddr + alignUp(rodataEnd, pageSize) + fileOffsets[2] % pageSize
+    offset = fileOffsets[2] + uint64(len(data.data))
+    bss.addr = alignUp(data.addr + uint64(len(data.data)), 16)
+
+    for _,s := range a.sections[:3] {
+        for _,f := range s.fixups {
+            a.applyFixup(s, f)
+        }
+    }
+
+    start,ok := a.symbols["_start"]
+    if !ok {
+        a.state.diag.Error("no \"_start\" label defined")
+        a.state.diag.Exit()
+    }
+
+    w := elfWriter{}
+    phdrs := []progHeader{}
+    for _,p := range []progHeader{
+        { flags: pfR | pfX, offset: fileOffsets[0], addr: text.addr, fileSize: uint64(len(text.data)), memSize: uint64(len(text.data)) },
+        { flags: pfR, offset: fileOffsets[1], addr: rodata.addr, fileSize: uint64(len(rodata.data)), memSize: uint64(len(rodata.data)) },
+        { flags: pfR | pfW, offset: fileOffsets[2], addr: data.addr, fileSize: uint64(len(data.data)), memSize: bss.addr + bss.bssSize - data.addr },
+    } {
+        if p.memSize > 0 {
+            phdrs = append(phdrs, p)
+        }
+    }
+
+    w.buf = make([]byte, offset)
+    copy(w.buf[fileOffsets[0]:], text.data)
+    copy(w.buf[fileOffsets[1]:], rodata.data)
+    copy(w.buf[fileOffsets[2]:], data.data)
+
+    shdrs := []sectionHeader{
+        {},
+        { name: ".text", typ: shtProgbits, flags: shfAlloc | shfExec, addr: text.addr, offset: fileOffsets[0], size: uint64(len(text.data)), align: 16 },
+        { name: ".rodata", typ: shtProgbits, flags: shfAlloc, addr: rodata.addr, offset: fileOffsets[1], size: uint64(len(rodata.data)), align: 16 },
+        { name: ".data", typ: shtProgbits, flags: shfAlloc | shfWrite, addr: data.addr, offset: fileOffsets[2], size: uint64(len(data.data)), align: 16 },
+        { name: ".bss", typ: shtNobits, flags: shfAlloc | shfWrite, addr: bss.addr, offset: fileOffsets[2] + bss.addr - data.addr, size: bss.bssSize, align: 16 },
+    }
+    shdrs = append(shdrs, w.symtab(a, len(shdrs), func(s *symbol) uint64 { return s.section.addr + s.offset })...)
+
+    return w.finish(etExec, start.section.addr + start.offset, phdrs, shdrs)
+}
+
+func (a *assembler) applyFixup(s *section, f fixup) {
+    sym := a.getSymbol(f)
+    val := sym.section.addr + sym.offset + uint64(f.addend)
+    p := s.data[f.offset:]
+
+    switch f.kind {
+    case fixupAbs64:
+        binary.LittleEndian.PutUint64(p, val)
+    case fixupAbs32:
+        if val > 0xffffffff {
+            a.state.parseErr(f.lineNum, "address of \"%s\" does not fit into 32bit", f.sym)
+        }
+        binary.LittleEndian.PutUint32(p, uint32(val))
+    case fixupAbs32S:
+        if !fitsInt32(int64(val)) {
+            a.state.parseErr(f.lineNum, "address of \"%s\" does not fit into 32bit", f.sym)
+        }
+        binary.LittleEndian.PutUint32(p, uint32(val))
+    case fixupRel32:
+        rel := int64(val - (s.addr + f.offset))
+        if !fitsInt32(rel) {
+            a.state.parseErr(f.lineNum, "jump to \"%s\" is too far", f.sym)
+        }
+        binary.LittleEndian.PutUint32(p, uint32(rel))
+    }
+}
+
+// relocatable object file (symbols are relocated relative to their section)
+func (a *assembler) object() []byte {
+    // sections start at 0 in object files
+    for _,s := range a.sections {
+        s.addr = 0
+    }
+
+    // intra section jumps get resolved directly
+    relocs := make([][]byte, 3)
+    for i,s := range a.sections[:3] {
+        for _,f := range s.fixups {
+            relocs[i] = append(relocs[i], a.relocation(s, f)...)
+        }
+    }
+
+    w := elfWriter{ buf: make([]byte, elfHeaderSize) }
+
+    shdrs := []sectionHeader{ {} }
+    for _,s := range a.sections {
+        h := sectionHeader{ name: s.name, typ: shtProgbits, flags: shfAlloc, align: 16 }
+        switch s.name {
+        case ".text":
+            h.flags |= shfExec
+        case ".data":
+            h.flags |= shfWrite
+        case ".bss":
+            h.flags |= shfWrite
+            h.typ = shtNobits
+            h.size = s.bssSize
+        }
+
+        if s.name != ".bss" {
+            h.offset, h.size = w.add(s.data, 16), uint64(len(s.data))
+        }
+        shdrs = append(shdrs, h)
+    }
+
+    symtabIdx := len(shdrs)
+    shdrs = append(shdrs, w.symtab(a, symtabIdx, func(s *symbol) uint64 { return s.offset })...)
+
+    for i,s := range a.sections[:3] {
+        if len(relocs[i]) > 0 {
+            offset := w.add(relocs[i], 8)
+            shdrs = append(shdrs, sectionHeader{ name: ".rela" + s.name, typ: shtRela, flags: shfInfoLink,
+                offset: offset, size: uint64(len(relocs[i])), link: uint32(symtabIdx), info: uint32(i+1), align: 8, entSize: 24 })
+        }
+    }
+
+    return w.finish(etRel, 0, nil, shdrs)
+}
+
+// relocations use the section symbols (index = section index)
+func (a *assembler) relocation(s *section, f fixup) []byte {
+    sym := a.getSymbol(f)
+    addend := int64(sym.offset) + f.addend
+
+    if f.kind == fixupRel32 && sym.section == s {
+        binary.LittleEndian.PutUint32(s.data[f.offset:], uint32(addend - int64(f.offset)))
+        return nil
+    }
+
+    symIdx := uint64(0)
+    for i,sec := range a.sections {
+        if sec == sym.section {
+            symIdx = uint64(i+1)
+        }
+    }
+
+    typ := map[fixupKind]uint64{ fixupAbs64: rX86_64_64, fixupAbs32: rX86_64_32, fixupAbs32S: rX86_64_32S, fixupRel32: rX86_64_PC32 }[f.kind]
+
+    rela := make([]byte, 24)
+    binary.LittleEndian.PutUint64(rela[0:], f.offset)
+    binary.LittleEndian.PutUint64(rela[8:], symIdx << 32 | typ)
+    binary.LittleEndian.PutUint64(rela[16:], uint64(addend))
+    return rela
+}
+
+func alignUp(v uint64, align uint64) uint64 {
+    return (v + align-1) & ^(align-1)
+}
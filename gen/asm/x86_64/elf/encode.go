@@ -0,0 +1,603 @@
+package elf
+
+import (
+    "strings"
+)
+
+// x86_64 instruction encoding (only the subset used by gamma)
+
+var aluOps map[string]uint8 = map[string]uint8{
+    "add": 0, "or": 1, "adc": 2, "sbb": 3, "and": 4, "sub": 5, "xor": 6, "cmp": 7,
+}
+
+var unaryOps map[string]uint8 = map[string]uint8{
+    "not": 2, "neg": 3, "mul": 4, "div": 6, "idiv": 7,
+}
+
+var shiftOps map[string]uint8 = map[string]uint8{
+    "rol": 0, "ror": 1, "shl": 4, "sal": 4, "shr": 5, "sar": 7,
+}
+
+var conditions map[string]uint8 = map[string]uint8{
+    "o": 0, "no": 1, "b": 2, "c": 2, "nae": 2, "ae": 3, "nb": 3, "nc": 3,
+    "e": 4, "z": 4, "ne": 5, "nz": 5, "be": 6, "na": 6, "a": 7, "nbe": 7,
+    "s": 8, "ns": 9, "p": 10, "pe": 10, "np": 11, "po": 11,
+    "l": 12, "nge": 12, "ge": 13, "nl": 13, "le": 14, "ng": 14, "g": 15, "nle": 15,
+}
+
+var noOperands map[string][]byte = map[string][]byte{
+    "ret":     { 0xc3 },
+    "leave":   { 0xc9 },
+    "syscall": { 0x0f, 0x05 },
+    "nop":     { 0x90 },
+    "hlt":     { 0xf4 },
+    "int3":    { 0xcc },
+    "cbw":     { 0x66, 0x98 },
+    "cwde":    { 0x98 },
+    "cdqe":    { 0x48, 0x98 },
+    "cwd":     { 0x66, 0x99 },
+    "cdq":     { 0x99 },
+    "cqo":     { 0x48, 0x99 },
+}
+
+func (a *assembler) encode(mnemonic string, ops []operand) {
+    if opcode,ok := noOperands[mnemonic]; ok {
+        a.expectOperands(mnemonic, ops, 0)
+        a.emit(opcode...)
+        return
+    }
+
+    if n,ok := aluOps[mnemonic]; ok {
+        a.encodeAlu(n, ops)
+        return
+    }
+
+    if n,ok := unaryOps[mnemonic]; ok {
+        a.expectOperands(mnemonic, ops, 1)
+        size := a.opSize(ops[0])
+        a.emitRM(size, []byte{ opcode8(size, 0xf6, 0xf7) }, n, ops[0], isRex8(ops[0]))
+        return
+    }
+
+    if n,ok := shiftOps[mnemonic]; ok {
+        a.encodeShift(n, ops)
+        return
+    }
+
+    if strings.HasPrefix(mnemonic, "set") {
+        if cc,ok := conditions[mnemonic[3:]]; ok {
+            a.expectOperands(mnemonic, ops, 1)
+            if a.opSize(ops[0]) != 1 {
+                a.err("\"%s\" expects a byte operand", mnemonic)
+            }
+            a.emitRM(1, []byte{ 0x0f, 0x90 + cc }, 0, ops[0], isRex8(ops[0]))
+            return
+        }
+    }
+
+    if strings.HasPrefix(mnemonic, "cmov") {
+        if cc,ok := conditions[mnemonic[4:]]; ok {
+            a.expectOperands(mnemonic, ops, 2)
+            dst := a.expectReg(ops[0])
+            a.emitRM(dst.size, []byte{ 0x0f, 0x40 + cc }, dst.num, ops[1], false)
+            return
+        }
+    }
+
+    if mnemonic[0] == 'j' && mnemonic != "jmp" {
+        if cc,ok := conditions[mnemonic[1:]]; ok {
+            a.expectOperands(mnemonic, ops, 1)
+            a.emit(0x0f, 0x80 + cc)
+            a.emitRel32(a.expectImm(ops[0]))
+            return
+        }
+    }
+
+    switch mnemonic {
+    case "mov":
+        a.encodeMov(ops)
+
+    case "movzx", "movsx", "movsxd":
+        a.encodeMovExtend(mnemonic, ops)
+
+    case "lea":
+        a.expectOperands(mnemonic, ops, 2)
+        dst := a.expectReg(ops[0])
+        if ops[1].kind != opMem {
+            a.err("\"lea\" expects a memory operand")
+        }
+        a.emitRM(dst.size, []byte{ 0x8d }, dst.num, ops[1], false)
+
+    case "test":
+        a.encodeTest(ops)
+
+    case "inc", "dec":
+        a.expectOperands(mnemonic, ops, 1)
+        n := uint8(0)
+        if mnemonic == "dec" { n = 1 }
+        size := a.opSize(ops[0])
+        a.emitRM(size, []byte{ opcode8(size, 0xfe, 0xff) }, n, ops[0], isRex8(ops[0]))
+
+    case "imul":
+        a.encodeImul(ops)
+
+    case "push":
+        a.expectOperands(mnemonic, ops, 1)
+        switch ops[0].kind {
+        case opReg:
+            r := a.expectReg64(ops[0])
+            a.emitShortReg(0x50, r)
+        case opImm:
+            if ops[0].imm.sym == "" && fitsInt8(ops[0].imm.val) {
+                a.emit(0x6a, byte(ops[0].imm.val))
+            } else {
+                a.emit(0x68)
+                a.emitImm(ops[0].imm, 4, true)
+            }
+        case opMem:
+            a.emitRM(0, []byte{ 0xff }, 6, ops[0], false)
+        }
+
+    case "pop":
+        a.expectOperands(mnemonic, ops, 1)
+        switch ops[0].kind {
+        case opReg:
+            r := a.expectReg64(ops[0])
+            a.emitShortReg(0x58, r)
+        case opMem:
+            a.emitRM(0, []byte{ 0x8f }, 0, ops[0], false)
+        default:
+            a.err("cannot pop into an immediate")
+        }
+
+    case "call", "jmp":
+        a.expectOperands(mnemonic, ops, 1)
+        if ops[0].kind == opImm {
+            if mnemonic == "call" {
+                a.emit(0xe8)
+            } else {
+                a.emit(0xe9)
+            }
+            a.emitRel32(ops[0].imm)
+        } else {
+            n := uint8(2)
+            if mnemonic == "jmp" { n = 4 }
+            if ops[0].kind == opReg { a.expectReg64(ops[0]) }
+            a.emitRM(0, []byte{ 0xff }, n, ops[0], false)
+        }
+
+    default:
+        a.err("unsupported instruction \"%s\" (use -nasm to assemble with nasm)", mnemonic)
+    }
+}
+
+func (a *assembler) encodeMov(ops []operand) {
+    a.expectOperands("mov", ops, 2)
+    dst, src := ops[0], ops[1]
+
+    switch {
+    case dst.kind == opReg && src.kind == opImm:
+        r := dst.reg
+        switch r.size {
+        case 1:
+            a.emitShortReg(0xb0, r)
+            a.emitImm(src.imm, 1, false)
+        case 2:
+            a.emit(0x66)
+            a.emitShortReg(0xb8, r)
+            a.emitImm(src.imm, 2, false)
+        case 4:
+            a.emitShortReg(0xb8, r)
+            a.emitImm(src.imm, 4, false)
+        case 8:
+            switch {
+            case src.imm.sym != "":
+                a.emitRex(true, 0, nil, &r, false)
+                a.emit(0xb8 + r.num & 7)
+                a.emitImm(src.imm, 8, false)
+            case fitsInt32(src.imm.val):
+                a.emitRM(8, []byte{ 0xc7 }, 0, dst, false)
+                a.emitImm(src.imm, 4, true)
+            case uint64(src.imm.val) <= 0xffffffff:     // zero extended
+                r.size = 4
+                a.emitShortReg(0xb8, r)
+                a.emitImm(src.imm, 4, false)
+            default:
+                a.emitRex(true, 0, nil, &r, false)
+                a.emit(0xb8 + r.num & 7)
+                a.emitImm(src.imm, 8, false)
+            }
+        }
+
+    case dst.kind == opMem && src.kind == opImm:
+        size := a.opSize(dst)
+        a.emitRM(size, []byte{ opcode8(size, 0xc6, 0xc7) }, 0, dst, false)
+        a.emitImm(src.imm, min(size, 4), size == 8)
+
+    case src.kind == opReg && dst.kind != opImm:
+        size := a.matchSize(dst, src)
+        a.emitRM(size, []byte{ opcode8(size, 0x88, 0x89) }, src.reg.num, dst, isRex8(src) || isRex8(dst))
+
+    case dst.kind == opReg && src.kind == opMem:
+        size := a.matchSize(dst, src)
+        a.emitRM(size, []byte{ opcode8(size, 0x8a, 0x8b) }, dst.reg.num, src, isRex8(dst))
+
+    default:
+        a.err("invalid operands for \"mov\"")
+    }
+}
+
+func (a *assembler) encodeMovExtend(mnemonic string, ops []operand) {
+    a.expectOperands(mnemonic, ops, 2)
+    dst := a.expectReg(ops[0])
+    srcSize := a.opSize(ops[1])
+
+    if ops[1].kind == opImm {
+        a.err("\"%s\" expects a register or memory source", mnemonic)
+    }
+
+    switch {
+    case mnemonic == "movzx" && srcSize == 1:
+        a.emitRM(dst.size, []byte{ 0x0f, 0xb6 }, dst.num, ops[1], isRex8(ops[1]))
+    case mnemonic == "movzx" && srcSize == 2:
+        a.emitRM(dst.size, []byte{ 0x0f, 0xb7 }, dst.num, ops[1], false)
+    case mnemonic == "movsx" && srcSize == 1:
+        a.emitRM(dst.size, []byte{ 0x0f, 0xbe }, dst.num, ops[1], isRex8(ops[1]))
+    case mnemonic == "movsx" && srcSize == 2:
+        a.emitRM(dst.size, []byte{ 0x0f, 0xbf }, dst.num, ops[1], false)
+    case (mnemonic == "movsx" || mnemonic == "movsxd") && srcSize == 4 && dst.size == 8:
+        a.emitRM(8, []byte{ 0x63 }, dst.num, ops[1], false)
+    default:
+        a.err("invalid operand sizes for \"%s\"", mnemonic)
+    }
+}
+
+func (a *assembler) encodeAlu(n uint8, ops []operand) {
+    a.expectOperands("alu", ops, 2)
+    dst, src := ops[0], ops[1]
+
+    switch {
+    case src.kind == opImm && dst.kind != opImm:
+        size := a.opSize(dst)
+        switch {
+        case size == 1:
+            a.emitRM(1, []byte{ 0x80 }, n, dst, isRex8(dst))
+            a.emitImm(src.imm, 1, false)
+        case src.imm.sym == "" && fitsInt8(truncate(src.imm.val, size)):
+            a.emitRM(size, []byte{ 0x83 }, n, dst, false)
+            a.emitImm(expr{ val: truncate(src.imm.val, size) }, 1, true)
+        default:
+            a.emitRM(size, []byte{ 0x81 }, n, dst, false)
+            a.emitImm(src.imm, min(size, 4), size == 8)
+        }
+
+    case src.kind == opReg && dst.kind != opImm:
+        size := a.matchSize(dst, src)
+        a.emitRM(size, []byte{ n*8 + opcode8(size, 0, 1) }, src.reg.num, dst, isRex8(src) || isRex8(dst))
+
+    case dst.kind == opReg && src.kind == opMem:
+        size := a.matchSize(dst, src)
+        a.emitRM(size, []byte{ n*8 + opcode8(size, 2, 3) }, dst.reg.num, src, isRex8(dst))
+
+    default:
+        a.err("invalid operands")
+    }
+}
+
+func (a *assembler) encodeTest(ops []operand) {
+    a.expectOperands("test", ops, 2)
+    dst, src := ops[0], ops[1]
+    if dst.kind == opReg && src.kind == opMem {
+        dst, src = src, dst
+    }
+
+    switch {
+    case src.kind == opImm && dst.kind != opImm:
+        size := a.opSize(dst)
+        a.emitRM(size, []byte{ opcode8(size, 0xf6, 0xf7) }, 0, dst, isRex8(dst))
+        a.emitImm(src.imm, min(size, 4), size == 8)
+
+    case src.kind == opReg && dst.kind != opImm:
+        size := a.matchSize(dst, src)
+        a.emitRM(size, []byte{ opcode8(size, 0x84, 0x85) }, src.reg.num, dst, isRex8(src) || isRex8(dst))
+
+    default:
+        a.err("invalid operands for \"test\"")
+    }
+}
+
+func (a *assembler) encodeShift(n uint8, ops []operand) {
+    a.expectOperands("shift", ops, 2)
+    dst, src := ops[0], ops[1]
+    size := a.opSize(dst)
+
+    switch {
+    case src.kind == opReg && src.reg.num == 1 && src.reg.size == 1:     // cl
+        a.emitRM(size, []byte{ opcode8(size, 0xd2, 0xd3) }, n, dst, isRex8(dst))
+    case src.kind == opImm && src.imm.sym == "":
+        if src.imm.val == 1 {
+            a.emitRM(size, []byte{ opcode8(size, 0xd0, 0xd1) }, n, dst, isRex8(dst))
+        } else {
+            a.emitRM(size, []byte{ opcode8(size, 0xc0, 0xc1) }, n, dst, isRex8(dst))
+            a.emitImm(src.imm, 1, false)
+        }
+    default:
+        a.err("shifts expect an immediate or \"cl\" as count")
+    }
+}
+
+func (a *assembler) encodeImul(ops []operand) {
+    switch len(ops) {
+    case 1:
+        size := a.opSize(ops[0])
+        a.emitRM(size, []byte{ opcode8(size, 0xf6, 0xf7) }, 5, ops[0], isRex8(ops[0]))
+    case 2:
+        dst := a.expectReg(ops[0])
+        if ops[1].kind == opImm {
+            a.encodeImul([]operand{ ops[0], ops[0], ops[1] })
+            return
+        }
+        a.matchSize(ops[0], ops[1])
+        a.emitRM(dst.size, []byte{ 0x0f, 0xaf }, dst.num, ops[1], false)
+    case 3:
+        dst := a.expectReg(ops[0])
+        imm := a.expectImm(ops[2])
+        if imm.sym == "" && fitsInt8(imm.val) {
+            a.emitRM(dst.size, []byte{ 0x6b }, dst.num, ops[1], false)
+            a.emitImm(imm, 1, true)
+        } else {
+            a.emitRM(dst.size, []byte{ 0x69 }, dst.num, ops[1], false)
+            a.emitImm(imm, min(dst.size, 4), dst.size == 8)
+        }
+    default:
+        a.err("invalid operands for \"imul\"")
+    }
+}
+
+
+// emits [66] [REX] opcode ModRM [SIB] [disp]
+// size 0 -> default operand size (no prefix)
+func (a *assembler) emitRM(size uint8, opcode []byte, regField uint8, rm operand, rex8 bool) {
+    if size == 2 {
+        a.emit(0x66)
+    }
+
+    switch rm.kind {
+    case opReg:
+        a.emitRex(size == 8, regField, nil, &rm.reg, rex8)
+        a.emit(opcode...)
+        a.emit(0xc0 | (regField & 7) << 3 | rm.reg.num & 7)
+
+    case opMem:
+        base, index := rm.base, rm.index
+        // rsp cannot be an index
+        if index != nil && index.num == 4 {
+            if rm.scale != 1 || (base != nil && base.num == 4) {
+                a.err("rsp cannot be used as index")
+            }
+            base, index = index, base
+        }
+        if base == nil && index != nil && rm.scale == 1 {
+            // [reg+disp] is shorter with reg as base
+            base, index = index, nil
+        }
+
+        a.emitRex(size == 8, regField, index, base, rex8)
+        a.emit(opcode...)
+        a.emitMem(regField, base, index, rm.scale, rm.disp)
+
+    default:
+        a.err("expected a register or memory operand")
+    }
+}
+
+func (a *assembler) emitMem(regField uint8, base *reg, index *reg, scale uint8, disp expr) {
+    r := (regField & 7) << 3
+
+    if base == nil {
+        // absolute addressing (disp32 sign extended)
+        idx := uint8(4)     // no index
+        if index != nil {
+            idx = index.num & 7
+        }
+        a.emit(0x04 | r, scaleBits(scale) << 6 | idx << 3 | 5)
+        a.emitImm(disp, 4, true)
+        return
+    }
+
+    mod := uint8(2)
+    if disp.sym == "" {
+        if disp.val == 0 && base.num & 7 != 5 {     // [rbp]/[r13] need a displacement
+            mod = 0
+        } else if fitsInt8(disp.val) {
+            mod = 1
+        }
+    }
+
+    if index != nil || base.num & 7 == 4 {
+        idx := uint8(4)
+        if index != nil {
+            idx = index.num & 7
+        }
+        a.emit(mod << 6 | r | 4, scaleBits(scale) << 6 | idx << 3 | base.num & 7)
+    } else {
+        a.emit(mod << 6 | r | base.num & 7)
+    }
+
+    switch mod {
+    case 1:
+        a.emit(byte(disp.val))
+    case 2:
+        a.emitImm(disp, 4, true)
+    }
+}
+
+func (a *assembler) emitRex(w bool, regField uint8, index *reg, base *reg, rex8 bool) {
+    rex := byte(0)
+    if w { rex |= 0x48 }
+    if regField & 8 != 0 { rex |= 0x44 }
+    if index != nil && index.num & 8 != 0 { rex |= 0x42 }
+    if base != nil && base.num & 8 != 0 { rex |= 0x41 }
+    if rex8 { rex |= 0x40 }
+
+    if rex != 0 {
+        a.emit(rex)
+    }
+}
+
+// opcode+reg (push, pop, mov reg imm)
+func (a *assembler) emitShortReg(opcode byte, r reg) {
+    a.emitRex(false, 0, nil, &r, r.needsRex)
+    a.emit(opcode + r.num & 7)
+}
+
+func (a *assembler) emitImm(e expr, size uint8, signed bool) {
+    if e.sym != "" {
+        switch {
+        case size == 8:
+            a.addFixup(e, fixupAbs64)
+        case size == 4 && signed:
+            a.addFixup(e, fixupAbs32S)
+        case size == 4:
+            a.addFixup(e, fixupAbs32)
+        default:
+            a.err("symbol \"%s\" does not fit into %d byte(s)", e.sym, size)
+        }
+        a.emit(make([]byte, size)...)
+        return
+    }
+
+    if !fitsSize(e.val, size, signed) {
+        a.warn("value %d does not fit into %d byte(s)", e.val, size)
+    }
+
+    for i := uint8(0); i < size; i++ {
+        a.emit(byte(e.val >> (i*8)))
+    }
+}
+
+func (a *assembler) emitRel32(e expr) {
+    if e.sym == "" {
+        a.err("expected a label as jump target")
+    }
+
+    e.val -= 4      // relative to the end of the instruction
+    a.addFixup(e, fixupRel32)
+    a.emit(0, 0, 0, 0)
+}
+
+
+func (a *assembler) expectOperands(mnemonic string, ops []operand, count int) {
+    if len(ops) != count {
+        a.err("\"%s\" expects %d operand(s) (got %d)", mnemonic, count, len(ops))
+    }
+}
+
+func (a *assembler) expectReg(op operand) reg {
+    if op.kind != opReg {
+        a.err("expected a register")
+    }
+    return op.reg
+}
+
+func (a *assembler) expectReg64(op operand) reg {
+    r := a.expectReg(op)
+    if r.size != 8 {
+        a.err("expected a 64bit register")
+    }
+    return r
+}
+
+func (a *assembler) expectImm(op operand) expr {
+    if op.kind != opImm {
+        a.err("expected an immediate value or label")
+    }
+    return op.imm
+}
+
+func (a *assembler) opSize(op operand) uint8 {
+    if op.size == 0 {
+        a.err("operation size not specified")
+    }
+    return op.size
+}
+
+func (a *assembler) matchSize(op1 operand, op2 operand) uint8 {
+    switch {
+    case op1.size == 0:
+        return a.opSize(op2)
+    case op2.size == 0:
+        return op1.size
+    case op1.size != op2.size:
+        a.err("mismatch in operand sizes")
+    }
+    return op1.size
+}
+
+func isRex8(op operand) bool {
+    return op.kind == opReg && op.reg.needsRex
+}
+
+func opcode8(size uint8, opcode8 byte, opcode byte) byte {
+    if size == 1 {
+        return opcode8
+    }
+    return opcode
+}
+
+func scaleBits(scale uint8) uint8 {
+    switch scale {
+    case 2:
+        return 1
+    case 4:
+        return 2
+    case 8:
+        return 3
+    default:
+        return 0
+    }
+}
+
+// value with the bit pattern of the operand size (sign extended)
+func truncate(v int64, size uint8) int64 {
+    switch size {
+    case 1:
+        return int64(int8(v))
+    case 2:
+        return int64(int16(v))
+    case 4:
+        return int64(int32(v))
+    default:
+        return v
+    }
+}
+
+func fitsInt8(v int64) bool {
+    return v >= -0x80 && v <= 0x7f
+}
+
+func fitsInt32(v int64) bool {
+    return v >= -0x80000000 && v <= 0x7fffffff
+}
+
+func fitsSize(v int64, size uint8, signed bool) bool {
+    if size >= 8 {
+        return true
+    }
+
+    bits := uint(size) * 8
+    min := -(int64(1) << (bits-1))
+    max := int64(1) << bits - 1
+    if signed {
+        max = int64(1) << (bits-1) - 1
+    }
+
+    return v >= min && v <= max
+}
+
+func min(a uint8, b uint8) uint8 {
+    if a < b {
+        return a
+    }
+    return b
+}
@@ -0,0 +1,473 @@
+package elf
+
+import (
+    "fmt"
+    "strings"
+    "strconv"
+)
+
+// parses the nasm syntax generated by gamma (and the inline asm in std)
+
+type line struct {
+    num int
+    label string        // can be empty
+    mnemonic string     // can be empty
+    operands []string
+}
+
+type operandKind uint8
+const (
+    opReg operandKind = iota
+    opImm operandKind = iota
+    opMem operandKind = iota
+)
+
+type reg struct {
+    num uint8       // 0-15
+    size uint8
+    needsRex bool   // spl, bpl, sil, dil
+    high bool       // ah, ch, dh, bh
+}
+
+// symbol + value
+type expr struct {
+    sym string      // empty -> scalar
+    val int64
+}
+
+type operand struct {
+    kind operandKind
+    size uint8      // 0 -> not specified
+
+    reg reg         // opReg
+
+    imm expr        // opImm
+
+    // opMem [base + index*scale + disp]
+    base *reg
+    index *reg
+    scale uint8
+    disp expr
+}
+
+var regs map[string]reg = map[string]reg{}
+
+func init() {
+    names := [][]string{
+        { "al", "ax", "eax", "rax" },
+        { "cl", "cx", "ecx", "rcx" },
+        { "dl", "dx", "edx", "rdx" },
+        { "bl", "bx", "ebx", "rbx" },
+        { "spl", "sp", "esp", "rsp" },
+        { "bpl", "bp", "ebp", "rbp" },
+        { "sil", "si", "esi", "rsi" },
+        { "dil", "di", "edi", "rdi" },
+    }
+    for i,n := range names {
+        regs[n[0]] = reg{ num: uint8(i), size: 1, needsRex: i >= 4 }
+        regs[n[1]] = reg{ num: uint8(i), size: 2 }
+        regs[n[2]] = reg{ num: uint8(i), size: 4 }
+        regs[n[3]] = reg{ num: uint8(i), size: 8 }
+    }
+
+    for i := uint8(8); i < 16; i++ {
+        regs[fmt.Sprintf("r%db", i)] = reg{ num: i, size: 1 }
+        regs[fmt.Sprintf("r%dw", i)] = reg{ num: i, size: 2 }
+        regs[fmt.Sprintf("r%dd", i)] = reg{ num: i, size: 4 }
+        regs[fmt.Sprintf("r%d", i)]  = reg{ num: i, size: 8 }
+    }
+
+    for i,n := range []string{ "ah", "ch", "dh", "bh" } {
+        regs[n] = reg{ num: uint8(i+4), size: 1, high: true }
+    }
+}
+
+var sizes map[string]uint8 = map[string]uint8{ "byte": 1, "word": 2, "dword": 4, "qword": 8 }
+
+func (state *State) parseErr(lineNum int, format string, args ...interface{}) {
+    state.diag.Errorf(format, args...)
+    state.diag.At(fmt.Sprintf("output.asm:%d", lineNum))
+    state.diag.Exit()
+}
+
+func parseLines(src string) []line {
+    res := []line{}
+
+    for i,l := range strings.Split(src, "\n") {
+        l = strings.TrimSpace(stripComment(l))
+        if l == "" || l[0] == '[' {     // [BITS 64]
+            continue
+        }
+
+        res = append(res, parseLine(i+1, l))
+    }
+
+    return res
+}
+
+func parseLine(num int, l string) line {
+    res := line{ num: num }
+
+    if label,ok := getLabel(l); ok {
+        res.label = label
+        l = strings.TrimSpace(l[len(label)+1:])
+        if l == "" {
+            return res
+        }
+    }
+
+    mnemonic, rest, _ := cutWhitespace(l)
+    res.mnemonic = strings.ToLower(mnemonic)
+
+    if rest = strings.TrimSpace(rest); rest != "" {
+        res.operands = splitOperands(rest)
+    }
+
+    return res
+}
+
+func cutWhitespace(s string) (string, string, bool) {
+    if i := strings.IndexAny(s, " \t"); i != -1 {
+        return s[:i], s[i+1:], true
+    }
+    return s, "", false
+}
+
+// split at "," (not inside strings)
+func splitOperands(s string) []string {
+    res := []string{}
+    start := 0
+    inStr := false
+
+    for i := 0; i < len(s); i++ {
+        switch s[i] {
+        case '"':
+            inStr = !inStr
+        case ',':
+            if !inStr {
+                res = append(res, strings.TrimSpace(s[start:i]))
+                start = i+1
+            }
+        }
+    }
+
+    return append(res, strings.TrimSpace(s[start:]))
+}
+
+func stripComment(l string) string {
+    inStr := false
+    for i := 0; i < len(l); i++ {
+        switch l[i] {
+        case '"':
+            inStr = !inStr
+        case ';':
+            if !inStr {
+                return l[:i]
+            }
+        }
+    }
+
+    return l
+}
+
+func getLabel(l string) (string, bool) {
+    if l == "" || !isSymbolStart(l[0]) {
+        return "", false
+    }
+
+    end := 1
+    for end < len(l) && isSymbolChar(l[end]) {
+        end++
+    }
+
+    if end < len(l) && l[end] == ':' {
+        return l[:end], true
+    }
+
+    return "", false
+}
+
+func isSymbolStart(c byte) bool {
+    return c == '_' || c == '.' || c == '$' || c == '?' || c == '@' ||
+        (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSymbolChar(c byte) bool {
+    return isSymbolStart(c) || c == '#' || c == '~' || (c >= '0' && c <= '9')
+}
+
+
+func (a *assembler) parseOperand(s string) operand {
+    size := uint8(0)
+    if w,rest,ok := cutWhitespace(s); ok {
+        if sz,ok := sizes[strings.ToLower(w)]; ok {
+            size = sz
+            s = strings.TrimSpace(rest)
+        }
+    }
+
+    if r,ok := regs[strings.ToLower(s)]; ok {
+        return operand{ kind: opReg, size: r.size, reg: r }
+    }
+
+    if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+        op := a.parseMem(s[1:len(s)-1])
+        op.size = size
+        return op
+    }
+
+    return operand{ kind: opImm, size: size, imm: a.parseExpr(s) }
+}
+
+// [base + index*scale + disp]
+func (a *assembler) parseMem(s string) operand {
+    op := operand{ kind: opMem, scale: 1 }
+    dispStr := ""
+
+    for _,term := range splitTerms(s) {
+        sign, t := term[:1], strings.TrimSpace(term[1:])
+
+        if r,ok := regs[strings.ToLower(t)]; ok && sign == "+" {
+            if op.base == nil {
+                op.base = &r
+            } else if op.index == nil {
+                op.index = &r
+            } else {
+                a.state.parseErr(a.lineNum, "too many registers in memory operand \"[%s]\"", s)
+            }
+            continue
+        }
+
+        if i := strings.IndexByte(t, '*'); i != -1 && sign == "+" {
+            r, scale := strings.TrimSpace(t[:i]), strings.TrimSpace(t[i+1:])
+            if _,ok := regs[strings.ToLower(scale)]; ok {
+                r, scale = scale, r
+            }
+
+            if r,ok := regs[strings.ToLower(r)]; ok {
+                sc := a.parseExpr(scale)
+                if op.index != nil || sc.sym != "" || (sc.val != 1 && sc.val != 2 && sc.val != 4 && sc.val != 8) {
+                    a.state.parseErr(a.lineNum, "invalid index in memory operand \"[%s]\"", s)
+                }
+                op.index = &r
+                op.scale = uint8(sc.val)
+                continue
+            }
+        }
+
+        dispStr += sign + t
+    }
+
+    if dispStr != "" {
+        op.disp = a.parseExpr(dispStr)
+    }
+
+    return op
+}
+
+// splits at + and - on the top level (every term starts with its sign)
+func splitTerms(s string) []string {
+    res := []string{}
+    depth, start := 0, 0
+
+    for i := 0; i < len(s); i++ {
+        switch s[i] {
+        case '(':
+            depth++
+        case ')':
+            depth--
+        case '+', '-':
+            prev := strings.TrimSpace(s[start:i])
+            if depth == 0 && prev != "" && prev != "+" && prev != "-" && !strings.ContainsAny(prev[len(prev)-1:], "*/%<>|&^~") {
+                res = append(res, s[start:i])
+                start = i
+            }
+        }
+    }
+    res = append(res, s[start:])
+
+    for i,t := range res {
+        t = strings.TrimSpace(t)
+        if t[0] != '+' && t[0] != '-' {
+            t = "+" + t
+        }
+        res[i] = t
+    }
+
+    return res
+}
+
+
+// simple expression evaluator (symbols are only allowed as symbol + scalar)
+type exprParser struct {
+    a *assembler
+    s string
+    pos int
+}
+
+func (a *assembler) parseExpr(s string) expr {
+    p := exprParser{ a: a, s: s }
+    e := p.parseBinary(0)
+    p.skipSpaces()
+    if p.pos != len(p.s) {
+        a.state.parseErr(a.lineNum, "unexpected \"%s\" in expression \"%s\"", p.s[p.pos:], s)
+    }
+    return e
+}
+
+var precedence map[string]int = map[string]int{
+    "|": 1, "^": 2, "&": 3, "<<": 4, ">>": 4, "+": 5, "-": 5, "*": 6, "/": 6, "%": 6,
+}
+
+func (p *exprParser) skipSpaces() {
+    for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+        p.pos++
+    }
+}
+
+func (p *exprParser) peekOp() string {
+    p.skipSpaces()
+    if p.pos+1 < len(p.s) {
+        if op := p.s[p.pos:p.pos+2]; op == "<<" || op == ">>" {
+            return op
+        }
+    }
+    if p.pos < len(p.s) {
+        if _,ok := precedence[p.s[p.pos:p.pos+1]]; ok {
+            return p.s[p.pos:p.pos+1]
+        }
+    }
+    return ""
+}
+
+func (p *exprParser) parseBinary(minPrec int) expr {
+    lhs := p.parseUnary()
+
+    for {
+        op := p.peekOp()
+        prec,ok := precedence[op]
+        if !ok || prec <= minPrec {
+            return lhs
+        }
+        p.pos += len(op)
+
+        rhs := p.parseBinary(prec)
+        lhs = p.binaryOp(op, lhs, rhs)
+    }
+}
+
+func (p *exprParser) binaryOp(op string, lhs expr, rhs expr) expr {
+    if op == "+" && (lhs.sym == "" || rhs.sym == "") {
+        return expr{ sym: lhs.sym + rhs.sym, val: lhs.val + rhs.val }
+    }
+    if op == "-" && rhs.sym == "" {
+        return expr{ sym: lhs.sym, val: lhs.val - rhs.val }
+    }
+    if lhs.sym != "" || rhs.sym != "" {
+        p.a.state.parseErr(p.a.lineNum, "operator \"%s\" can only be applied to scalar values in \"%s\"", op, p.s)
+    }
+
+    switch op {
+    case "|":  return expr{ val: lhs.val | rhs.val }
+    case "^":  return expr{ val: lhs.val ^ rhs.val }
+    case "&":  return expr{ val: lhs.val & rhs.val }
+    case "<<": return expr{ val: lhs.val << uint64(rhs.val) }
+    case ">>": return expr{ val: int64(uint64(lhs.val) >> uint64(rhs.val)) }
+    case "-":  return expr{ val: lhs.val - rhs.val }
+    case "*":  return expr{ val: lhs.val * rhs.val }
+    case "/", "%":
+        if rhs.val == 0 {
+            p.a.state.parseErr(p.a.lineNum, "division by zero in \"%s\"", p.s)
+        }
+        if op == "/" {
+            return expr{ val: int64(uint64(lhs.val) / uint64(rhs.val)) }
+        }
+        return expr{ val: int64(uint64(lhs.val) % uint64(rhs.val)) }
+    }
+
+    return lhs
+}
+
+func (p *exprParser) parseUnary() expr {
+    p.skipSpaces()
+    if p.pos >= len(p.s) {
+        p.a.state.parseErr(p.a.lineNum, "unexpected end of expression \"%s\"", p.s)
+    }
+
+    switch p.s[p.pos] {
+    case '-':
+        p.pos++
+        e := p.parseUnary()
+        if e.sym != "" {
+            p.a.state.parseErr(p.a.lineNum, "cannot negate symbol \"%s\"", e.sym)
+        }
+        return expr{ val: -e.val }
+    case '+':
+        p.pos++
+        return p.parseUnary()
+    case '~':
+        p.pos++
+        e := p.parseUnary()
+        if e.sym != "" {
+            p.a.state.parseErr(p.a.lineNum, "cannot invert symbol \"%s\"", e.sym)
+        }
+        return expr{ val: ^e.val }
+    case '(':
+        p.pos++
+        e := p.parseBinary(0)
+        p.skipSpaces()
+        if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+            p.a.state.parseErr(p.a.lineNum, "missing \")\" in \"%s\"", p.s)
+        }
+        p.pos++
+        return e
+    }
+
+    start := p.pos
+    if p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+        for p.pos < len(p.s) && (isSymbolChar(p.s[p.pos])) {
+            p.pos++
+        }
+        return expr{ val: p.parseNum(p.s[start:p.pos]) }
+    }
+
+    if p.s[p.pos] == '\'' {
+        end := strings.IndexByte(p.s[p.pos+1:], '\'')
+        if end != 1 {
+            p.a.state.parseErr(p.a.lineNum, "invalid character literal in \"%s\"", p.s)
+        }
+        p.pos += 3
+        return expr{ val: int64(p.s[start+1]) }
+    }
+
+    if isSymbolStart(p.s[p.pos]) {
+        for p.pos < len(p.s) && isSymbolChar(p.s[p.pos]) {
+            p.pos++
+        }
+        return expr{ sym: p.a.fullLabelName(p.s[start:p.pos]) }
+    }
+
+    p.a.state.parseErr(p.a.lineNum, "unexpected \"%c\" in expression \"%s\"", p.s[p.pos], p.s)
+    return expr{}
+}
+
+func (p *exprParser) parseNum(s string) int64 {
+    s = strings.ReplaceAll(strings.ToLower(s), "_", "")
+
+    base := 10
+    switch {
+    case strings.HasPrefix(s, "0x"):
+        base, s = 16, s[2:]
+    case strings.HasPrefix(s, "0b"):
+        base, s = 2, s[2:]
+    case strings.HasSuffix(s, "h"):
+        base, s = 16, s[:len(s)-1]
+    }
+
+    v,err := strconv.ParseUint(s, base, 64)
+    if err != nil {
+        p.a.state.parseErr(p.a.lineNum, "invalid number \"%s\"", s)
+    }
+
+    return int64(v)
+}
@@ -0,0 +1,14 @@
+package elf
+
+import (
+    "gamma/diag"
+)
+
+// the states used by the assembler and linker (see gamma/compiler)
+type State struct {
+    diag *diag.State
+}
+
+func NewState(diag *diag.State) *State {
+    return &State{ diag: diag }
+}
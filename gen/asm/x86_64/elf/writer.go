@@ -0,0 +1,210 @@
+package elf
+
+import (
+    "encoding/binary"
+)
+
+const elfHeaderSize = 64
+const progHeaderSize = 56
+const sectionHeaderSize = 64
+
+const (
+    etRel  uint16 = 1
+    etExec uint16 = 2
+)
+
+const (
+    pfX uint32 = 1
+    pfW uint32 = 2
+    pfR uint32 = 4
+)
+
+const (
+    shtProgbits uint32 = 1
+    shtSymtab   uint32 = 2
+    shtStrtab   uint32 = 3
+    shtRela     uint32 = 4
+    shtNobits   uint32 = 8
+)
+
+const (
+    shfWrite    uint64 = 1
+    shfAlloc    uint64 = 2
+    shfExec     uint64 = 4
+    shfInfoLink uint64 = 0x40
+)
+
+const (
+    rX86_64_64   uint64 = 1
+    rX86_64_PC32 uint64 = 2
+    rX86_64_32   uint64 = 10
+    rX86_64_32S  uint64 = 11
+)
+
+type progHeader struct {
+    flags uint32
+    offset uint64
+    addr uint64
+    fileSize uint64
+    memSize uint64
+}
+
+type sectionHeader struct {
+    name string
+    typ uint32
+    flags uint64
+    addr uint64
+    offset uint64
+    size uint64
+    link uint32
+    info uint32
+    align uint64
+    entSize uint64
+}
+
+type elfWriter struct {
+    buf []byte
+}
+
+// appends data (aligned) and returns its file offset
+func (w *elfWriter) add(data []byte, align uint64) uint64 {
+    for uint64(len(w.buf)) % align != 0 {
+        w.buf = append(w.buf, 0)
+    }
+
+    offset := uint64(len(w.buf))
+    w.buf = append(w.buf, data...)
+    return offset
+}
+
+// adds .symtab and .strtab (section symbols first, then all labels)
+// idx is the section header index of .symtab
+func (w *elfWriter) symtab(a *assembler, idx int, value func(s *symbol) uint64) []sectionHeader {
+    globals := make(map[string]bool, len(a.globals))
+    for _,g := range a.globals {
+        globals[a.fullLabelName(g)] = true
+    }
+
+    strtab := []byte{ 0 }
+    symtab := make([]byte, 24)     // null symbol
+
+    addSym := func(name string, info byte, shndx uint16, value uint64) {
+        sym := make([]byte, 24)
+        if name != "" {
+            binary.LittleEndian.PutUint32(sym[0:], uint32(len(strtab)))
+            strtab = append(append(strtab, name...), 0)
+        }
+        sym[4] = info
+        binary.LittleEndian.PutUint16(sym[6:], shndx)
+        binary.LittleEndian.PutUint64(sym[8:], value)
+        symtab = append(symtab, sym...)
+    }
+
+    for i,s := range a.sections {
+        addSym("", stbLocal << 4 | sttSection, uint16(i+1), s.addr)
+    }
+
+    locals := 1 + len(a.sections)
+    for _,global := range []bool{ false, true } {
+        for _,s := range a.symbolOrder {
+            if globals[s.name] != global {
+                continue
+            }
+
+            info := stbLocal << 4 | sttNotype
+            if global {
+                info = stbGlobal << 4 | sttNotype
+            } else {
+                locals++
+            }
+
+            addSym(s.name, info, uint16(a.sectionIdx(s.section)), value(s))
+        }
+    }
+
+    symOffset := w.add(symtab, 8)
+    strOffset := w.add(strtab, 1)
+
+    return []sectionHeader{
+        { name: ".symtab", typ: shtSymtab, offset: symOffset, size: uint64(len(symtab)), link: uint32(idx+1), info: uint32(locals), align: 8, entSize: 24 },
+        { name: ".strtab", typ: shtStrtab, offset: strOffset, size: uint64(len(strtab)), align: 1 },
+    }
+}
+
+const (
+    stbLocal  byte = 0
+    stbGlobal byte = 1
+    sttNotype  byte = 0
+    sttSection byte = 3
+)
+
+func (a *assembler) sectionIdx(s *section) int {
+    for i,sec := range a.sections {
+        if sec == s {
+            return i+1
+        }
+    }
+    return 0
+}
+
+// writes .shstrtab, the section header table and the elf/program headers
+func (w *elfWriter) finish(typ uint16, entry uint64, phdrs []progHeader, shdrs []sectionHeader) []byte {
+    shstrtab := []byte{ 0 }
+    names := make([]uint32, len(shdrs)+1)
+    for i,h := range append(shdrs, sectionHeader{ name: ".shstrtab" }) {
+        if h.name != "" {
+            names[i] = uint32(len(shstrtab))
+            shstrtab = append(append(shstrtab, h.name...), 0)
+        }
+    }
+    shstrOffset := w.add(shstrtab, 1)
+    shdrs = append(shdrs, sectionHeader{ name: ".shstrtab", typ: shtStrtab, offset: shstrOffset, size: uint64(len(shstrtab)), align: 1 })
+
+    shOffset := w.add(nil, 8)
+    for i,h := range shdrs {
+        sh := make([]byte, sectionHeaderSize)
+        binary.LittleEndian.PutUint32(sh[0:], names[i])
+        binary.LittleEndian.PutUint32(sh[4:], h.typ)
+        binary.LittleEndian.PutUint64(sh[8:], h.flags)
+        binary.LittleEndian.PutUint64(sh[16:], h.addr)
+        binary.LittleEndian.PutUint64(sh[24:], h.offset)
+        binary.LittleEndian.PutUint64(sh[32:], h.size)
+        binary.LittleEndian.PutUint32(sh[40:], h.link)
+        binary.LittleEndian.PutUint32(sh[44:], h.info)
+        binary.LittleEndian.PutUint64(sh[48:], h.align)
+        binary.LittleEndian.PutUint64(sh[56:], h.entSize)
+        w.buf = append(w.buf, sh...)
+    }
+
+    // program headers directly after the elf header
+    for i,p := range phdrs {
+        ph := w.buf[elfHeaderSize + i*progHeaderSize:]
+        binary.LittleEndian.PutUint32(ph[0:], 1)   // PT_LOAD
+        binary.LittleEndian.PutUint32(ph[4:], p.flags)
+        binary.LittleEndian.PutUint64(ph[8:], p.offset)
+        binary.LittleEndian.PutUint64(ph[16:], p.addr)
+        binary.LittleEndian.PutUint64(ph[24:], p.addr)
+        binary.LittleEndian.PutUint64(ph[32:], p.fileSize)
+        binary.LittleEndian.PutUint64(ph[40:], p.memSize)
+        binary.LittleEndian.PutUint64(ph[48:], pageSize)
+    }
+
+    h := w.buf[:elfHeaderSize]
+    copy(h, []byte{ 0x7f, 'E', 'L', 'F', 2, 1, 1, 0 })     // 64bit, little endian, version 1, System V
+    binary.LittleEndian.PutUint16(h[16:], typ)
+    binary.LittleEndian.PutUint16(h[18:], 62)                       // x86_64
+    binary.LittleEndian.PutUint32(h[20:], 1)
+    binary.LittleEndian.PutUint64(h[24:], entry)
+    if len(phdrs) > 0 {
+        binary.LittleEndian.PutUint64(h[32:], elfHeaderSize)
+    }
+    binary.LittleEndian.PutUint64(h[40:], shOffset)
+    binary.LittleEndian.PutUint16(h[52:], elfHeaderSize)
+    binary.LittleEndian.PutUint16(h[54:], progHeaderSize)
+    binary.LittleEndian.PutUint16(h[56:], uint16(len(phdrs)))
+    binary.LittleEndian.PutUint16(h[58:], sectionHeaderSize)
+    binary.LittleEndian.PutUint16(h[60:], uint16(len(shdrs)))
+    binary.LittleEndian.PutUint16(h[62:], uint16(len(shdrs)-1))
+
+    return w.buf
+}
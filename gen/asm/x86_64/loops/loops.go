@@ -6,79 +6,85 @@ import (
     "gamma/types/addr"
 )
 
+// loop labels of one compilation (see gamma/compiler)
+type State struct {
+    whileCount uint
+    forCount uint
 
-var whileCount uint = 0
-var forCount   uint = 0
+    inForLoop bool
+    inWhileLoop bool
+}
 
-var inForLoop bool = false
-var inWhileLoop bool = false
+func NewState() *State {
+    return &State{}
+}
 
-func InLoop() bool {
-    return inForLoop || inWhileLoop
+func (state *State) InLoop() bool {
+    return state.inForLoop || state.inWhileLoop
 }
 
-func ResetCount() {
-    whileCount = 0
-    forCount   = 0
+func (state *State) ResetCount() {
+    state.whileCount = 0
+    state.forCount   = 0
 }
 
-func WhileStart(file *bufio.Writer) uint {
-    inWhileLoop = true
-    whileCount++
-    file.WriteString(fmt.Sprintf(".while%d:\n", whileCount))
-    return whileCount
+func (state *State) WhileStart(file *bufio.Writer) uint {
+    state.inWhileLoop = true
+    state.whileCount++
+    file.WriteString(fmt.Sprintf(".while%d:\n", state.whileCount))
+    return state.whileCount
 }
 
-func WhileVar(file *bufio.Writer, addr addr.Addr) {
+func (state *State) WhileVar(file *bufio.Writer, addr addr.Addr) {
     file.WriteString(fmt.Sprintf("cmp BYTE [%s], 1\n", addr))
-    file.WriteString(fmt.Sprintf("jne .while%dEnd\n", whileCount))
+    file.WriteString(fmt.Sprintf("jne .while%dEnd\n", state.whileCount))
 }
 
-func WhileExpr(file *bufio.Writer) {
-    file.WriteString(fmt.Sprintf("cmp al, 1\njne .while%dEnd\n", whileCount))
+func (state *State) WhileExpr(file *bufio.Writer) {
+    file.WriteString(fmt.Sprintf("cmp al, 1\njne .while%dEnd\n", state.whileCount))
 }
 
-func WhileEnd(file *bufio.Writer, count uint) {
-    inWhileLoop = false
+func (state *State) WhileEnd(file *bufio.Writer, count uint) {
+    state.inWhileLoop = false
     file.WriteString(fmt.Sprintf("jmp .while%d\n", count))
     file.WriteString(fmt.Sprintf(".while%dEnd:\n", count))
 }
 
 
-func ForStart(file *bufio.Writer) uint {
-    inForLoop = true
+func (state *State) ForStart(file *bufio.Writer) uint {
+    state.inForLoop = true
 
-    forCount++
-    file.WriteString(fmt.Sprintf(".for%d:\n", forCount))
-    return forCount
+    state.forCount++
+    file.WriteString(fmt.Sprintf(".for%d:\n", state.forCount))
+    return state.forCount
 }
 
-func ForExpr(file *bufio.Writer) {
-    file.WriteString(fmt.Sprintf("cmp al, 1\njne .for%dEnd\n", forCount))
+func (state *State) ForExpr(file *bufio.Writer) {
+    file.WriteString(fmt.Sprintf("cmp al, 1\njne .for%dEnd\n", state.forCount))
 }
 
 func ForBlockEnd(file *bufio.Writer, count uint) {
     file.WriteString(fmt.Sprintf(".for%dBlockEnd:\n", count))
 }
-func ForEnd(file *bufio.Writer, count uint) {
+func (state *State) ForEnd(file *bufio.Writer, count uint) {
     file.WriteString(fmt.Sprintf("jmp .for%d\n", count))
     file.WriteString(fmt.Sprintf(".for%dEnd:\n", count))
 
-    inForLoop = false
+    state.inForLoop = false
 }
 
-func Break(file *bufio.Writer) {
-    if inForLoop {
-        file.WriteString(fmt.Sprintf("jmp .for%dEnd\n", forCount))
+func (state *State) Break(file *bufio.Writer) {
+    if state.inForLoop {
+        file.WriteString(fmt.Sprintf("jmp .for%dEnd\n", state.forCount))
     } else {
-        file.WriteString(fmt.Sprintf("jmp .while%dEnd\n", whileCount))
+        file.WriteString(fmt.Sprintf("jmp .while%dEnd\n", state.whileCount))
     }
 }
 
-func Continue(file *bufio.Writer) {
-    if inForLoop {
-        file.WriteString(fmt.Sprintf("jmp .for%dBlockEnd\n", forCount))
+func (state *State) Continue(file *bufio.Writer) {
+    if state.inForLoop {
+        file.WriteString(fmt.Sprintf("jmp .for%dBlockEnd\n", state.forCount))
     } else {
-        file.WriteString(fmt.Sprintf("jmp .while%d\n", whileCount))
+        file.WriteString(fmt.Sprintf("jmp .while%d\n", state.whileCount))
     }
 }
@@ -1,44 +1,51 @@
 package nasm
 
 import (
-    "os"
     "os/exec"
     "fmt"
     "bufio"
     "strings"
+    "gamma/diag"
 )
 
-var rodata string
-var data string
-var bss string
+// data sections of one compilation (see gamma/compiler)
+type State struct {
+    rodata string
+    data string
+    bss string
 
-func AddRodata(s string) {
-    rodata += s + "\n"
+    diag *diag.State
 }
-func AddData(s string) {
-    data += s + "\n"
+
+func NewState(diag *diag.State) *State {
+    return &State{ diag: diag }
+}
+
+func (state *State) AddRodata(s string) {
+    state.rodata += s + "\n"
 }
-func AddBss(s string) {
-    bss += s + "\n"
+func (state *State) AddData(s string) {
+    state.data += s + "\n"
+}
+func (state *State) AddBss(s string) {
+    state.bss += s + "\n"
 }
 
-func writeRodata(file *bufio.Writer) {
+func (state *State) writeRodata(file *bufio.Writer) {
     file.WriteString("\nsection .rodata\n")
-    file.WriteString("_true: db \"true\"\n")
-    file.WriteString("_false: db \"false\"\n")
-    file.WriteString(rodata)
+    file.WriteString(state.rodata)
 }
 
-func writeBss(file *bufio.Writer) {
+func (state *State) writeBss(file *bufio.Writer) {
     file.WriteString("\nsection .bss\n")
     file.WriteString("align 16\n")
     file.WriteString("\tresb 1024 * 1024\n_stack_top:\n") // 1MiB
-    file.WriteString(bss)
+    file.WriteString(state.bss)
 }
 
-func writeData(file *bufio.Writer) {
+func (state *State) writeData(file *bufio.Writer) {
     file.WriteString("\nsection .data\n")
-    file.WriteString(data)
+    file.WriteString(state.data)
 }
 
 func Header(file *bufio.Writer) {
@@ -47,7 +54,7 @@ func Header(file *bufio.Writer) {
     file.WriteString("global _start\n")
 }
 
-func Footer(file *bufio.Writer, noMainArg bool) {
+func (state *State) Footer(file *bufio.Writer, entry string, noMainArg bool) {
     file.WriteString("\n_start:\n")
 
     if !noMainArg {
@@ -64,47 +71,47 @@ func Footer(file *bufio.Writer, noMainArg bool) {
     }
 
     file.WriteString(
-        "call main\n" +
+        "call _sig_init\n" +
+        "call " + entry + "\n" +
         "mov rdi, 0\n" +
         "call exit\n")
 
-    writeRodata(file)
-    writeData(file)
-    writeBss(file)
+    writeSigInit(file)
+    state.writeSigHandler(file)
+
+    state.writeRodata(file)
+    state.writeData(file)
+    state.writeBss(file)
 }
 
-func GenExe() {
-    var stderr strings.Builder
+func (state *State) GenObj() {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generating object files...")
 
-    fmt.Println("[INFO] generating object files...")
+    state.run(exec.Command("nasm", "-f", "elf64", "-o", "output.o", "output.asm"))
+}
 
-    cmd := exec.Command("nasm", "-f", "elf64", "-o", "output.o", "output.asm")
-    cmd.Stderr = &stderr
-    err := cmd.Run()
-    if err != nil {
-        s := stderr.String()
-        if s == "" {
-            fmt.Fprintf(os.Stderr, "[ERROR] %v\n", err)
-        } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] %v\n", s)
-        }
-        os.Exit(1)
-    }
+func (state *State) GenExe() {
+    state.GenObj()
+
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] linking object files...")
 
-    fmt.Println("[INFO] linking object files...")
+    state.run(exec.Command("ld", "-o", "output", "output.o"))
+
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generated executable")
+}
+
+func (state *State) run(cmd *exec.Cmd) {
+    var stderr strings.Builder
 
-    cmd = exec.Command("ld", "-o", "output", "output.o")
     cmd.Stderr = &stderr
-    err = cmd.Run()
+    err := cmd.Run()
     if err != nil {
         s := stderr.String()
         if s == "" {
-            fmt.Fprintf(os.Stderr, "[ERROR] %v\n", err)
+            state.diag.Errorf("%v", err)
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] %v\n", s)
+            state.diag.Errorf("%v", s)
         }
-        os.Exit(1)
+        state.diag.Exit()
     }
-
-    fmt.Println("[INFO] generated executable")
 }
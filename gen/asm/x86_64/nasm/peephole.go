@@ -0,0 +1,108 @@
+package nasm
+
+import (
+    "strings"
+)
+
+// jump if the condition is false
+var inverseJmp map[string]string = map[string]string{
+    "sete": "jne",
+    "setne": "je",
+    "setl": "jge",
+    "setle": "jg",
+    "setg": "jle",
+    "setge": "jl",
+    "setb": "jae",
+    "setbe": "ja",
+    "seta": "jbe",
+    "setae": "jb",
+}
+
+// labels of if, else, loop and switch case conditions (al is not used after jumping there)
+// logical ops (.condN) and xswitch ends need the value in al
+var condLabelPrefixes []string = []string{ ".else", ".if", ".while", ".for", ".case" }
+
+// local rewrites of the generated asm (used with -O2):
+//   setCC al; cmp al, 1; jne .label -> jNCC .label
+//   mov QWORD [x], reg; mov reg, QWORD [x] -> mov QWORD [x], reg
+//   jmp .label; .label: -> .label:
+func Peephole(asm string) string {
+    lines := strings.Split(strings.TrimSuffix(asm, "\n"), "\n")
+    res := make([]string, 0, len(lines))
+
+    for i := 0; i < len(lines); i++ {
+        if i+2 < len(lines) {
+            if jmp,ok := fuseCondJmp(lines[i], lines[i+1], lines[i+2]); ok {
+                res = append(res, jmp)
+                i += 2
+                continue
+            }
+        }
+
+        if i+1 < len(lines) {
+            if isReload(lines[i], lines[i+1]) {
+                res = append(res, lines[i])
+                i++
+                continue
+            }
+
+            if isJmpToNext(lines[i], lines[i+1]) {
+                continue
+            }
+        }
+
+        res = append(res, lines[i])
+    }
+
+    return strings.Join(res, "\n") + "\n"
+}
+
+func fuseCondJmp(set string, cmp string, jne string) (string, bool) {
+    op := strings.TrimSuffix(set, " al")
+    inv,ok := inverseJmp[op]
+    if !ok || op == set || cmp != "cmp al, 1" || !strings.HasPrefix(jne, "jne ") {
+        return "", false
+    }
+
+    label := strings.TrimPrefix(jne, "jne ")
+    for _,p := range condLabelPrefixes {
+        if strings.HasPrefix(label, p) {
+            return inv + " " + label, true
+        }
+    }
+
+    return "", false
+}
+
+// only 64bit registers (loading 32bit or smaller values does not keep the upper bits)
+func isReload(store string, load string) bool {
+    dst,src,ok := movOperands(store)
+    if !ok || !strings.HasPrefix(dst, "QWORD [") {
+        return false
+    }
+
+    loadDst,loadSrc,ok := movOperands(load)
+    return ok && loadDst == src && loadSrc == dst && isReg64(src)
+}
+
+// rax, ..., r15 (not r8d, r8w, r8b, ...)
+func isReg64(reg string) bool {
+    return len(reg) > 1 && reg[0] == 'r' && !strings.ContainsAny(reg[len(reg)-1:], "dwb")
+}
+
+func movOperands(line string) (dst string, src string, ok bool) {
+    if !strings.HasPrefix(line, "mov ") {
+        return "", "", false
+    }
+
+    ops := strings.Split(strings.TrimPrefix(line, "mov "), ", ")
+    if len(ops) != 2 {
+        return "", "", false
+    }
+
+    return ops[0], ops[1], true
+}
+
+func isJmpToNext(jmp string, next string) bool {
+    return strings.HasPrefix(jmp, "jmp .") && next == strings.TrimPrefix(jmp, "jmp ") + ":"
+}
@@ -0,0 +1,133 @@
+package nasm
+
+import (
+    "fmt"
+    "bufio"
+    "strings"
+)
+
+/*
+runtime reporting of SIGSEGV, SIGBUS and SIGFPE:
+  * _start calls _sig_init which installs _sig_handler (rt_sigaction)
+    on its own stack (sigaltstack), so a broken rsp can be reported too
+  * _sig_handler looks up the function of the faulting ip in _fn_table
+    and calls _signal (buildin.gma) which prints and exits with 128 + signal
+*/
+
+const (
+    sigBus  = 7
+    sigFpe  = 8
+    sigSegv = 11
+
+    sigStackSize = 64 * 1024
+
+    // SA_SIGINFO | SA_ONSTACK | SA_RESTORER
+    saFlags = 0x4 | 0x08000000 | 0x04000000
+)
+
+func writeSigInit(file *bufio.Writer) {
+    file.WriteString(
+        "\n_sig_init:\n" +
+        "mov rax, 131\n" +      // sigaltstack
+        "mov rdi, _sig_altstack\n" +
+        "mov rsi, 0\n" +
+        "syscall\n")
+
+    for _,sig := range []int{ sigSegv, sigBus, sigFpe } {
+        file.WriteString(fmt.Sprintf(
+            "mov rax, 13\n" +   // rt_sigaction
+            "mov rdi, %d\n" +
+            "mov rsi, _sig_action\n" +
+            "mov rdx, 0\n" +
+            "mov r10, 8\n" +
+            "syscall\n", sig))
+    }
+
+    file.WriteString("ret\n")
+}
+
+// rdi: signal, rsi: *siginfo_t, rdx: *ucontext_t
+func (state *State) writeSigHandler(file *bufio.Writer) {
+    file.WriteString(
+        "\n_sig_handler:\n" +
+        "mov rsi, QWORD [rsi+16]\n" +   // si_addr
+        "mov rdx, QWORD [rdx+168]\n" +  // uc_mcontext.rip
+        "mov rcx, _sig_unknown\n" +
+        "mov r8, 1\n" +
+        "mov r10, _fn_table\n" +
+        "mov r9, QWORD [r10]\n" +
+        "add r10, 8\n" +
+        ".find:\n" +
+        "cmp r9, 0\n" +
+        "je .report\n" +
+        "mov r11, QWORD [r10]\n" +
+        "cmp r11, rdx\n" +
+        "ja .report\n" +
+        "mov rcx, QWORD [r10+8]\n" +
+        "mov r8, QWORD [r10+16]\n" +
+        "add r10, 24\n" +
+        "sub r9, 1\n" +
+        "jmp .find\n" +
+        ".report:\n" +
+        "call _signal\n" +
+        "\n_sig_restorer:\n" +
+        "mov rax, 15\n" +       // rt_sigreturn
+        "syscall\n")
+
+    state.AddRodata("_sig_unknown: db \"?\"")
+    state.AddRodata(fmt.Sprintf("align 8\n_sig_action: dq _sig_handler, %d, _sig_restorer, 0", saFlags))
+    state.AddRodata(fmt.Sprintf("align 8\n_sig_altstack: dq _sig_stack\n\tdd 0, 0\n\tdq %d", sigStackSize))
+    state.AddBss(fmt.Sprintf("align 16\n_sig_stack:\n\tresb %d", sigStackSize))
+}
+
+// appends _fn_table (used by _sig_handler) to the asm
+// it has to be called after generating every function (and after the peephole optimizations)
+//   dq count
+//   dq start, name, name len (ordered by start)
+func AddFnTable(asm string) string {
+    var table, names strings.Builder
+
+    count := 0
+    section := ""
+    for _,line := range strings.Split(asm, "\n") {
+        if strings.HasPrefix(line, "section ") {
+            section = strings.TrimPrefix(line, "section ")
+            continue
+        }
+
+        if label,ok := getLabel(line); ok && section == ".text" {
+            table.WriteString(fmt.Sprintf("\tdq %s, _fn_name%d, %d\n", label, count, len(label)))
+            names.WriteString(fmt.Sprintf("_fn_name%d: db \"%s\"\n", count, label))
+            count++
+        }
+    }
+
+    return asm + fmt.Sprintf("\nsection .rodata\nalign 8\n_fn_table: dq %d\n", count) + table.String() + names.String()
+}
+
+// local labels (starting with ".") belong to the previous label
+func getLabel(line string) (string, bool) {
+    if line == "" || line[0] == '.' || !isSymbolStart(line[0]) {
+        return "", false
+    }
+
+    end := 1
+    for end < len(line) && isSymbolChar(line[end]) {
+        end++
+    }
+
+    if end < len(line) && line[end] == ':' {
+        return line[:end], true
+    }
+
+    return "", false
+}
+
+func isSymbolStart(c byte) bool {
+    return c == '_' || c == '.' || c == '$' || c == '?' || c == '@' ||
+        (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSymbolChar(c byte) bool {
+    return isSymbolStart(c) || c == '#' || c == '~' || (c >= '0' && c <= '9')
+}
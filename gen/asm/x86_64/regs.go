@@ -4,6 +4,8 @@ import (
     "fmt"
     "bufio"
     "gamma/types/addr"
+    "gamma/diag"
+    "gamma/types/str"
 )
 
 var regs [][]string = [][]string{
@@ -24,8 +26,18 @@ var regs [][]string = [][]string{
     { "bpl", "bp", "ebp", "rbp" },
 }
 
-var used []bool = make([]bool, RegCount)
-var preserve []bool = make([]bool, RegCount)
+// used registers of one compilation (see gamma/compiler)
+type State struct {
+    used []bool
+    saved [][]bool      // per SaveReg (innermost last): pushed or not
+
+    diag *diag.State
+    str *str.State
+}
+
+func NewState(diag *diag.State, str *str.State) *State {
+    return &State{ used: make([]bool, RegCount), saved: make([][]bool, RegCount), diag: diag, str: str }
+}
 
 var words     []string = []string{ "BYTE", "WORD", "DWORD", "QWORD" }
 var dataSizes []string = []string{ "db", "dw", "dd", "dq" }
@@ -103,30 +115,35 @@ func RegAsAddr(reg RegGroup) addr.Addr {
     return addr.Addr{ BaseAddr: GetReg(reg, 8) }
 }
 
-func IsUsed(reg RegGroup) bool {
-    return used[reg]
+func (state *State) IsUsed(reg RegGroup) bool {
+    return state.used[reg]
 }
 
-func UseReg(reg RegGroup) {
-    used[reg] = true
+func (state *State) UseReg(reg RegGroup) {
+    state.used[reg] = true
 }
 
-func FreeReg(reg RegGroup) {
-    used[reg] = false
+func (state *State) FreeReg(reg RegGroup) {
+    state.used[reg] = false
 }
 
-func SaveReg(file *bufio.Writer, reg RegGroup) {
-    if used[reg] {
-        preserve[reg] = true
+// SaveReg/RestoreReg can be nested (every RestoreReg pops only what its SaveReg pushed)
+func (state *State) SaveReg(file *bufio.Writer, reg RegGroup) {
+    pushed := state.used[reg]
+    if pushed {
         PushReg(file, reg)
-        used[reg] = false
+        state.used[reg] = false
     }
+    state.saved[reg] = append(state.saved[reg], pushed)
 }
 
-func RestoreReg(file *bufio.Writer, reg RegGroup) {
-    if preserve[reg] {
-        preserve[reg] = false
+func (state *State) RestoreReg(file *bufio.Writer, reg RegGroup) {
+    last := len(state.saved[reg])-1
+    pushed := state.saved[reg][last]
+    state.saved[reg] = state.saved[reg][:last]
+
+    if pushed {
         PopReg(file, reg)
-        used[reg] = true
+        state.used[reg] = true
     }
 }
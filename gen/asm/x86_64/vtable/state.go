@@ -0,0 +1,14 @@
+package vtable
+
+import (
+    "gamma/gen/asm/x86_64/nasm"
+)
+
+// the states used to generate the vtables (see gamma/compiler)
+type State struct {
+    nasm *nasm.State
+}
+
+func NewState(nasm *nasm.State) *State {
+    return &State{ nasm: nasm }
+}
@@ -4,13 +4,12 @@ import (
 	"fmt"
 	"gamma/types"
 	"gamma/gen/asm/x86_64"
-	"gamma/gen/asm/x86_64/nasm"
 )
 
-func Create(implDstType types.Type, interfaceType types.InterfaceType, fnNames []string) {
-    nasm.AddData(GetVTableName(implDstType, interfaceType) + ":")
+func (state *State) Create(implDstType types.Type, interfaceType types.InterfaceType, fnNames []string) {
+    state.nasm.AddData(GetVTableName(implDstType, interfaceType) + ":")
     for _,name := range fnNames {
-        nasm.AddData(fmt.Sprintf("%s %s.%s", asm.GetDataSize(types.Ptr_Size), implDstType.GetMangledName(), name))
+        state.nasm.AddData(fmt.Sprintf("%s %s.%s", asm.GetDataSize(types.Ptr_Size), implDstType.GetMangledName(), name))
     }
 }
 
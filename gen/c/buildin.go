@@ -0,0 +1,264 @@
+package c
+
+import (
+    "fmt"
+    "strings"
+    "gamma/ast"
+    "gamma/token"
+    "gamma/types"
+    "gamma/buildin"
+)
+
+const header =
+`#define _GNU_SOURCE
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+#include <errno.h>
+#include <unistd.h>
+
+#pragma pack(push, 1)
+typedef struct { uint8_t* ptr; uint32_t len; } gma_str;
+typedef struct { void* ptr; uint64_t cap; uint64_t len; } gma_vec;
+typedef void (*gma_fn)(void);
+typedef struct { uint64_t word; const gma_fn* vtable; } gma_iface;
+#pragma pack(pop)
+`
+
+const runtime = `
+static void* gma_alloc(uint64_t size) {
+    void* p = calloc(1, size ? size : 1);
+    if (p == NULL) { _exit(1); }
+    return p;
+}
+
+static gma_vec gma_vec_new(uint64_t cap, uint64_t len, uint64_t elemSize) {
+    if (cap < len) { cap = len; }
+    gma_vec v = { gma_alloc(cap * elemSize), cap, len };
+    return v;
+}
+
+static uint64_t gma_word(const void* p, uint64_t size) {
+    uint64_t w = 0;
+    memcpy(&w, p, size < 8 ? size : 8);
+    return w;
+}
+
+static void gma_write(int fd, gma_str s) {
+    uint32_t written = 0;
+    while (written < s.len) {
+        ssize_t n = write(fd, s.ptr + written, s.len - written);
+        if (n <= 0) { return; }
+        written += n;
+    }
+}
+
+static void gma_print(gma_str s) { gma_write(1, s); }
+static void gma_eprint(gma_str s) { gma_write(2, s); }
+static void gma_println(gma_str s) { gma_write(1, s); gma_write(1, (gma_str){ (uint8_t*)"\n", 1 }); }
+static void gma_eprintln(gma_str s) { gma_write(2, s); gma_write(2, (gma_str){ (uint8_t*)"\n", 1 }); }
+
+static void gma_exit(int32_t code) { _exit(code); }
+
+static gma_str gma_utos(uint64_t v) {
+    uint8_t* end = (uint8_t*)gma_alloc(21) + 21;
+    uint8_t* p = end;
+    do { *--p = '0' + v % 10; v /= 10; } while (v != 0);
+    return (gma_str){ p, (uint32_t)(end - p) };
+}
+
+static gma_str gma_itos(int64_t v) {
+    if (v >= 0) { return gma_utos(v); }
+    gma_str s = gma_utos(-(uint64_t)v);
+    s.ptr[-1] = '-';
+    return (gma_str){ s.ptr - 1, s.len + 1 };
+}
+
+static gma_str gma_btos(uint8_t b) {
+    return b ? (gma_str){ (uint8_t*)"true", 4 } : (gma_str){ (uint8_t*)"false", 5 };
+}
+
+static gma_str gma_ctos(uint8_t c) {
+    uint8_t* p = gma_alloc(1);
+    *p = c;
+    return (gma_str){ p, 1 };
+}
+
+// the length includes the terminating 0 (like in the asm backend)
+static gma_str gma_from_cstr(uint8_t* s) {
+    return (gma_str){ s, (uint32_t)strlen((char*)s) + 1 };
+}
+
+static uint8_t gma_str_eq(gma_str s1, gma_str s2) {
+    return s1.len == s2.len && memcmp(s1.ptr, s2.ptr, s1.len) == 0;
+}
+
+static gma_str gma_str_concat(gma_str s1, gma_str s2) {
+    uint8_t* p = gma_alloc((uint64_t)s1.len + s2.len);
+    memcpy(p, s1.ptr, s1.len);
+    memcpy(p + s1.len, s2.ptr, s2.len);
+    return (gma_str){ p, s1.len + s2.len };
+}
+
+// gamma -check-overflow
+static void gma_overflow(const char* msg) {
+    gma_eprint((gma_str){ (uint8_t*)"[OVERFLOW] ", 11 });
+    gma_eprintln((gma_str){ (uint8_t*)msg, (uint32_t)strlen(msg) });
+    _exit(1);
+}
+
+// debug builds (-O0)
+static void gma_div_zero(const char* msg) {
+    gma_eprint((gma_str){ (uint8_t*)"[DIV BY ZERO] ", 14 });
+    gma_eprintln((gma_str){ (uint8_t*)msg, (uint32_t)strlen(msg) });
+    _exit(1);
+}
+
+// raw syscalls return -errno on failure
+static int64_t gma_syscall(int64_t n, uint64_t a1, uint64_t a2, uint64_t a3, uint64_t a4, uint64_t a5, uint64_t a6) {
+    long res = syscall(n, a1, a2, a3, a4, a5, a6);
+    return res == -1 ? -errno : res;
+}
+`
+
+var buildins map[string]string = map[string]string{
+    "print":     "gma_print",
+    "println":   "gma_println",
+    "eprint":    "gma_eprint",
+    "eprintln":  "gma_eprintln",
+    "exit":      "gma_exit",
+    "itos":      "gma_itos",
+    "utos":      "gma_utos",
+    "btos":      "gma_btos",
+    "ctos":      "gma_ctos",
+    "from_cstr": "gma_from_cstr",
+}
+
+// returns false if e is not a call of a build-in function
+func (state *State) genBuildinCall(e *ast.FnCall) (string, bool) {
+    if e.F == nil || e.F.FnSrc != nil {
+        return "", false
+    }
+
+    switch e.Ident.Name {
+    case "_syscall":
+        return state.genSyscall(e), true
+
+    case "_asm":
+        state.genInlineAsm(e)
+        return "", true
+
+    case "fmt":
+        return state.GenExpr(state.gen.ConvertFmt(e.Values)), true
+
+    case "sizeof":
+        return fmt.Sprintf("((uint64_t)%d)", resolve(e.InsetType).Size()), true
+    }
+
+    if buildin.IsArith(e.Ident.Name) {
+        return state.genArithBuildIn(e), true
+    }
+
+    if name,ok := buildins[e.Ident.Name]; ok && !e.F.IsGeneric() {
+        args := make([]string, 0, len(e.Values))
+        for i,v := range e.Values {
+            args = append(args, state.convert(e.F.GetArgs()[i], v))
+        }
+        return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", ")), true
+    }
+
+    return "", false
+}
+
+// wrapping in uint64_t (no UB for signed overflow), saturating with the builtins of gcc/clang
+func (state *State) genArithBuildIn(e *ast.FnCall) string {
+    t := resolve(e.GetType())
+    bits := t.Size() * 8
+    l, r := state.GenExpr(e.Values[0]), state.GenExpr(e.Values[1])
+
+    var op token.TokenType
+    switch {
+    case strings.HasSuffix(e.Ident.Name, "_add"):
+        op = token.Plus
+    case strings.HasSuffix(e.Ident.Name, "_sub"):
+        op = token.Minus
+    default:
+        op = token.Mul
+    }
+
+    if strings.HasPrefix(e.Ident.Name, "wrapping_") {
+        return fmt.Sprintf("((%s)((uint64_t)%s %s (uint64_t)%s))", state.cType(t), l, binaryOps[op], r)
+    }
+
+    tmp := state.curFn.tmp(t)
+    var sat string
+    switch {
+    case t.GetKind() == types.Int:
+        // the sign of the wrapped result is the opposite of the real one
+        sat = fmt.Sprintf("(%s < 0 ? INT%d_MAX : INT%d_MIN)", tmp, bits, bits)
+    case op == token.Plus:
+        sat = fmt.Sprintf("UINT%d_MAX", bits)
+    default:
+        sat = "0"
+    }
+
+    return fmt.Sprintf("(__builtin_%s_overflow(%s, %s, &%s) ? (%s = %s) : 0, %s)", overflowBuiltins[op], l, r, tmp, tmp, sat, tmp)
+}
+
+// _syscall uses the args of the surrounding function as they were passed in registers
+func (state *State) genSyscall(e *ast.FnCall) string {
+    c := state.cmpTime.ConstEval(e.Values[0])
+    if c == nil {
+        state.diag.Error("_syscall takes only const")
+        state.diag.At(e.Values[0].At())
+        state.diag.Exit()
+    }
+
+    words := make([]string, 0, 6)
+    for _,v := range state.curFn.params {
+        name := state.curFn.varName(v)
+        t := resolve(v.GetType())
+
+        switch t.GetKind() {
+        case types.Str:
+            words = append(words, fmt.Sprintf("(uint64_t)(uintptr_t)%s.ptr", name), fmt.Sprintf("(uint64_t)%s.len", name))
+        case types.Interface:
+            words = append(words, fmt.Sprintf("%s.word", name), fmt.Sprintf("(uint64_t)(uintptr_t)%s.vtable", name))
+        case types.Struct, types.Enum:
+            if types.IsBigStruct(t) {
+                continue
+            }
+            words = append(words, fmt.Sprintf("gma_word(&%s, %d)", name, t.Size()))
+            if t.Size() > 8 {
+                words = append(words, fmt.Sprintf("gma_word((uint8_t*)&%s + 8, %d)", name, t.Size() - 8))
+            }
+        case types.Int:
+            words = append(words, fmt.Sprintf("(uint64_t)(int64_t)%s", name))
+        case types.Ptr, types.Arr:
+            words = append(words, fmt.Sprintf("(uint64_t)(uintptr_t)%s", name))
+        case types.Vec:
+            continue
+        default:
+            words = append(words, fmt.Sprintf("(uint64_t)%s", name))
+        }
+    }
+
+    for len(words) < 6 {
+        words = append(words, "0")
+    }
+
+    return fmt.Sprintf("gma_syscall(%s, %s)", c.GetVal(), strings.Join(words[:6], ", "))
+}
+
+// the only inline asm in use moves the 4th syscall arg to r10 (handled by gma_syscall)
+func (state *State) genInlineAsm(e *ast.FnCall) {
+    if s,ok := e.Values[0].(*ast.StrLit); ok {
+        if strings.HasPrefix(s.Val.Str, "\"mov r10") {
+            return
+        }
+    }
+
+    state.diag.Error("inline assembly is not supported by the C backend")
+    state.diag.At(e.At())
+    state.diag.Exit()
+}
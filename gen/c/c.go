@@ -0,0 +1,138 @@
+package c
+
+import (
+    "os"
+    "fmt"
+    "bufio"
+    "os/exec"
+    "strings"
+    "gamma/ast"
+)
+
+/*
+C99 backend
+  * gamma sizes are kept (all types are packed) so pointer arithmetic and casts behave like in the asm backend
+  * structs -> packed structs, enums -> packed tagged unions { id, union { elems } }
+  * interfaces -> { first 8 bytes of the value, vtable } with a function pointer table per impl
+  * generics are monomorphized the same way as in the asm backend (<name>$<type>)
+  * locals are hoisted to the top of the function (zero initialized)
+*/
+
+func (state *State) GenC(Ast ast.Ast) {
+    err := os.WriteFile("output.c", []byte(state.C(Ast)), 0644)
+    if err != nil {
+        state.diag.Error("could not create \"output.c\"")
+        state.diag.Exit()
+    }
+}
+
+// the C source without writing output.c
+func (state *State) C(Ast ast.Ast) string {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generating C file...")
+
+    state.reset()
+    state.reachable = state.gen.Reachable(Ast)
+
+    var buf strings.Builder
+    writer := bufio.NewWriter(&buf)
+
+    for _,d := range Ast.Decls {
+        state.GenDecl(d)
+    }
+
+    state.genMain(Ast.Entry(), Ast.NoMainArg)
+
+    // static data can still add types
+    var data strings.Builder
+    dataWriter := bufio.NewWriter(&data)
+    state.genStrs(dataWriter)
+    dataWriter.WriteString(state.globalDecls.String())
+    state.genArrs(dataWriter)
+    dataWriter.WriteString(state.globals.String())
+    dataWriter.Flush()
+
+    state.genPendingTypes()
+
+    writer.WriteString(header)
+    writer.WriteString("\n#pragma pack(push, 1)\n")
+    writer.WriteString(state.typeDecls.String())
+    writer.WriteString(state.typeDefs.String())
+    writer.WriteString("#pragma pack(pop)\n")
+
+    writer.WriteString(runtime)
+    writer.WriteString(data.String())
+
+    writer.WriteString("\n")
+    writer.WriteString(state.protos.String())
+    writer.WriteString(state.vtables.String())
+    writer.WriteString(state.funcs.String())
+
+    writer.Flush()
+
+    return buf.String()
+}
+
+func (state *State) reset() {
+    state.funcs.Reset()
+    state.protos.Reset()
+    state.vtables.Reset()
+    state.globals.Reset()
+    state.globalDecls.Reset()
+    state.definedVTables = make(map[string]bool)
+    state.resetTypes()
+}
+
+func (state *State) genMain(entry string, noMainArg bool) {
+    state.funcs.WriteString("int main(int argc, char** argv) {\n")
+    if noMainArg {
+        state.funcs.WriteString(fmt.Sprintf("    f_%s();\n", sanitize(entry)))
+    } else {
+        state.funcs.WriteString("    gma_vec args = { argv, (uint64_t)argc, (uint64_t)argc };\n")
+        state.funcs.WriteString(fmt.Sprintf("    f_%s(args);\n", sanitize(entry)))
+    }
+    state.funcs.WriteString("    return 0;\n}\n")
+}
+
+func (state *State) GenObj() {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] compiling C file...")
+
+    state.run(exec.Command(CC(), append(CCFlags(state.gen.GetOptLevel()), "-c", "-o", "output.o", "output.c")...))
+}
+
+func (state *State) GenExe() {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] compiling C file...")
+
+    state.run(exec.Command(CC(), append(CCFlags(state.gen.GetOptLevel()), "-o", "output", "output.c")...))
+
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generated executable")
+}
+
+// the -O level is passed on to cc
+// (casts reinterpret memory like in the asm backend -> no strict aliasing)
+func CCFlags(optLevel uint) []string {
+    return []string{ "-std=c99", "-fwrapv", "-fno-strict-aliasing", "-w", fmt.Sprintf("-O%d", optLevel) }
+}
+
+// $CC or the system cc
+func CC() string {
+    if cc := os.Getenv("CC"); cc != "" {
+        return cc
+    }
+    return "cc"
+}
+
+func (state *State) run(cmd *exec.Cmd) {
+    var stderr strings.Builder
+
+    cmd.Stderr = &stderr
+    err := cmd.Run()
+    if err != nil {
+        s := stderr.String()
+        if s == "" {
+            state.diag.Errorf("%v", err)
+        } else {
+            state.diag.Errorf("%v", s)
+        }
+        state.diag.Exit()
+    }
+}
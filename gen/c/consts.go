@@ -0,0 +1,248 @@
+package c
+
+import (
+    "fmt"
+    "math"
+    "bufio"
+    "strings"
+    "gamma/ast"
+    "gamma/types"
+    "gamma/cmpTime/constVal"
+)
+
+// ConstEval but without addresses of locals (only known by the asm backend)
+func (state *State) constEval(e ast.Expr) constVal.ConstVal {
+    if _,ok := e.(*ast.Unwrap); ok {
+        return nil      // the unwrapped value has to be assigned
+    }
+
+    // unwraps inside of const funcs grow the stack (expressions are evaluated more than once here)
+    stackSize := state.identObj.GetStackSize()
+    defer state.identObj.SetStackSize(stackSize)
+
+    if c := state.cmpTime.ConstEval(e); c != nil && !hasLocalPtr(c) {
+        return c
+    }
+
+    return nil
+}
+
+func hasLocalPtr(c constVal.ConstVal) bool {
+    switch c := c.(type) {
+    case *constVal.PtrConst:
+        return c.Local
+    case *constVal.StructConst:
+        for _,f := range c.Fields {
+            if hasLocalPtr(f) { return true }
+        }
+    case *constVal.EnumConst:
+        return c.Elem != nil && hasLocalPtr(c.Elem)
+    }
+
+    return false
+}
+
+// C expression of a const value
+func (state *State) constExpr(t types.Type, c constVal.ConstVal) string {
+    t = resolve(t)
+
+    switch c.(type) {
+    case *constVal.StructConst, *constVal.EnumConst:
+        return fmt.Sprintf("((%s)%s)", state.cType(t), state.constInit(t, c))
+    case *constVal.StrConst:
+        if t == nil || t.GetKind() == types.Str {
+            return fmt.Sprintf("((gma_str)%s)", state.constInit(t, c))
+        }
+        return state.constInit(t, c)
+    default:
+        return state.constInit(t, c)
+    }
+}
+
+// C initializer of a const value (usable for static data)
+func (state *State) constInit(t types.Type, c constVal.ConstVal) string {
+    t = resolve(t)
+
+    switch c := c.(type) {
+    case *constVal.IntConst:
+        return state.castConst(t, intLit(int64(*c)))
+    case *constVal.UintConst:
+        return state.castConst(t, fmt.Sprintf("%dULL", uint64(*c)))
+    case *constVal.CharConst:
+        return state.castConst(t, fmt.Sprint(uint8(*c)))
+    case *constVal.BoolConst:
+        return state.castConst(t, c.GetVal())
+
+    case *constVal.StrConst:
+        if t == nil || t.GetKind() == types.Str {
+            return fmt.Sprintf("{ gma_str%d, %d }", uint64(*c), state.str.GetSize(uint64(*c)))
+        }
+        return fmt.Sprintf("((%s)gma_str%d)", state.cType(t), uint64(*c))
+
+    case *constVal.ArrConst:
+        return fmt.Sprintf("((%s)gma_arr%d)", state.cType(t), c.Idx)
+
+    case *constVal.PtrConst:
+        return state.ptrConst(t, c)
+
+    case *constVal.StructConst:
+        st,ok := t.(types.StructType)
+        if !ok {
+            st = c.Type
+        }
+
+        fields := make([]string, len(c.Fields))
+        for i,f := range c.Fields {
+            fields[i] = state.constInit(st.Types[i], f)
+        }
+        return "{ " + strings.Join(fields, ", ") + " }"
+
+    case *constVal.EnumConst:
+        if c.Type.IsNiche() {
+            if c.Elem == nil {
+                return "{ { 0 } }"
+            }
+            return fmt.Sprintf("{ { .%s = %s } }", elemName(enumElemName(c.Type, c.Id)), state.constInit(c.ElemType, c.Elem))
+        }
+        if c.Elem == nil {
+            return fmt.Sprintf("{ %d }", c.Id)
+        }
+        return fmt.Sprintf("{ %d, { .%s = %s } }", c.Id, elemName(enumElemName(c.Type, c.Id)), state.constInit(c.ElemType, c.Elem))
+
+    default:
+        state.diag.Errorf("(internal) unexpected const value %v", c)
+        state.diag.Exit()
+        return ""
+    }
+}
+
+func (state *State) castConst(t types.Type, val string) string {
+    if t == nil {
+        return val
+    }
+
+    switch t.GetKind() {
+    case types.Ptr, types.Arr:
+        return fmt.Sprintf("((%s)(uintptr_t)%s)", state.cType(t), val)
+    case types.Int, types.Uint, types.Char, types.Bool:
+        return fmt.Sprintf("((%s)%s)", state.cType(t), val)
+    default:
+        return val
+    }
+}
+
+func intLit(i int64) string {
+    if i == math.MinInt64 {
+        return "(-9223372036854775807LL-1)"
+    }
+    return fmt.Sprintf("%dLL", i)
+}
+
+// only addresses of globals (or absolute addresses) are const in C
+func (state *State) ptrConst(t types.Type, c *constVal.PtrConst) string {
+    base := c.Addr.BaseAddr
+    if base == "" || (base[0] >= '0' && base[0] <= '9') {
+        return fmt.Sprintf("((%s)(uintptr_t)(%s + %d))", state.cType(t), base, c.Addr.Offset)
+    }
+
+    return fmt.Sprintf("((%s)((uint8_t*)&%s + %d))", state.cType(t), globalName(base), c.Addr.Offset)
+}
+
+func enumElemName(t types.EnumType, id uint64) string {
+    for _,e := range t.GetElems() {
+        if t.GetElemID(e) == id {
+            return e
+        }
+    }
+
+    return ""
+}
+
+func (state *State) genStrs(file *bufio.Writer) {
+    for i := uint64(0); i < state.str.Count(); i++ {
+        if !state.str.IsUsed(i) { continue }
+        file.WriteString(fmt.Sprintf("static uint8_t gma_str%d[] = %s;\n", i, quote(state.str.GetBytes(i))))
+    }
+}
+
+func quote(s []byte) string {
+    var res strings.Builder
+
+    res.WriteByte('"')
+    for _,c := range s {
+        switch {
+        case c == '"' || c == '\\' || c == '?':
+            res.WriteString(fmt.Sprintf("\\%03o", c))
+        case c >= ' ' && c <= '~':
+            res.WriteByte(c)
+        default:
+            res.WriteString(fmt.Sprintf("\\%03o", c))
+        }
+    }
+    res.WriteByte('"')
+
+    return res.String()
+}
+
+// array literals are flat static storage (like in the asm backend)
+func (state *State) genArrs(file *bufio.Writer) {
+    for i := uint64(0); i < state.array.Count(); i++ {
+        if !state.array.IsUsed(i) { continue }
+
+        t := resolve(state.array.GetType(i))
+        arrType,ok := t.(types.ArrType)
+        if !ok { continue }
+
+        baseType := arrBaseType(arrType)
+        l := arrFlatLen(arrType)
+        if l == 0 { l = 1 }
+
+        elems := make([]string, 0, l)
+        state.flatConsts(&elems, baseType, state.array.GetValues(i), arrType)
+
+        if allZero(elems) {
+            file.WriteString(fmt.Sprintf("static %s gma_arr%d[%d];\n", state.cType(baseType), i, l))
+        } else {
+            file.WriteString(fmt.Sprintf("static %s gma_arr%d[%d] = { %s };\n", state.cType(baseType), i, l, strings.Join(elems, ", ")))
+        }
+    }
+}
+
+func (state *State) flatConsts(elems *[]string, baseType types.Type, vals []constVal.ConstVal, t types.ArrType) {
+    for i := uint64(0); i < t.Len; i++ {
+        var c constVal.ConstVal = nil
+        if i < uint64(len(vals)) {
+            c = vals[i]
+        }
+
+        if sub,ok := t.BaseType.(types.ArrType); ok {
+            if arr,ok := c.(*constVal.ArrConst); ok {
+                state.flatConsts(elems, baseType, arr.Elems, sub)
+            } else {
+                state.flatConsts(elems, baseType, nil, sub)
+            }
+        } else if c == nil || hasLocalPtr(c) {
+            *elems = append(*elems, zeroInit(baseType))
+        } else {
+            *elems = append(*elems, state.constInit(baseType, c))
+        }
+    }
+}
+
+func allZero(elems []string) bool {
+    for _,e := range elems {
+        if e != "0" && e != "{ 0 }" {
+            return false
+        }
+    }
+    return true
+}
+
+func zeroInit(t types.Type) string {
+    switch resolve(t).GetKind() {
+    case types.Str, types.Vec, types.Interface, types.Struct, types.Enum:
+        return "{ 0 }"
+    default:
+        return "0"
+    }
+}
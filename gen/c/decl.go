@@ -0,0 +1,350 @@
+package c
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/ast/identObj/vars"
+    "gamma/types"
+)
+
+func (state *State) GenDecl(d ast.Decl) {
+    switch d := d.(type) {
+    case *ast.Import:
+        for _,d := range d.Decls {
+            state.GenDecl(d)
+        }
+
+    case *ast.DefVar:
+        state.genGlobal(d)
+
+    case *ast.DefFn:
+        if !state.reachable.Fn(d.FnHead.F) {
+            return
+        }
+
+        if d.FnHead.F.IsGeneric() {
+            for _,t := range d.FnHead.F.GetUsedInsetTypes() {
+                d.FnHead.F.SetInsetType(t)
+                state.genFn(d)
+            }
+        } else {
+            state.genFn(d)
+        }
+
+    case *ast.Impl:
+        if d.Impl.IsGeneric() {
+            for _,t := range d.Impl.GetGeneric().UsedInsetTypes {
+                d.Impl.SetInsetType(t)
+                state.genImpl(d)
+            }
+        } else {
+            state.genImpl(d)
+        }
+
+    case *ast.DefStruct, *ast.DecVar, *ast.DefConst, *ast.DefInterface, *ast.DefEnum:
+        // nothing to generate
+
+    case *ast.BadDecl:
+        state.diag.Error("bad declaration")
+        state.diag.Exit()
+    default:
+        state.diag.Errorf("GenDecl for %v is not implemente yet", reflect.TypeOf(d))
+        state.diag.Exit()
+    }
+}
+
+func globalName(name string) string {
+    return "g_" + sanitize(name)
+}
+
+func fnName(f *identObj.Func) string {
+    return "f_" + sanitize(f.GetMangledName())
+}
+
+// tentative definitions first so globals can point to each other
+func (state *State) genGlobal(d *ast.DefVar) {
+    c := state.cmpTime.ConstEval(d.Value)
+    if c == nil || hasLocalPtr(c) {
+        state.diag.Error("defining a global variable with a non const expr is not allowed")
+        state.diag.At(d.Value.At())
+        state.diag.Exit()
+    }
+
+    if !state.reachable.Var(d.V) {
+        return
+    }
+
+    t := d.V.GetType()
+    name := globalName(d.V.GetName())
+
+    state.globalDecls.WriteString(fmt.Sprintf("static %s %s;\n", state.cType(t), name))
+    state.globals.WriteString(fmt.Sprintf("static %s %s = %s;\n", state.cType(t), name, state.constInit(t, c)))
+}
+
+func (state *State) genImpl(d *ast.Impl) {
+    if d.Impl.HasInterface() && state.reachable.VTable(&d.Impl) {
+        state.genVTable(d)
+    }
+
+    for i := range d.FnDefs {
+        if state.reachable.Fn(d.FnDefs[i].FnHead.F) {
+            state.genFn(&d.FnDefs[i])
+        }
+    }
+}
+
+func vtableName(dst types.Type, interfaceType types.InterfaceType) string {
+    return fmt.Sprintf("gma_vtable_%s_%s", sanitize(dst.GetMangledName()), sanitize(interfaceType.GetMangledName()))
+}
+
+// every vtable entry is a thunk taking the interface value instead of the dst type
+func (state *State) genVTable(d *ast.Impl) {
+    dst := resolve(d.Impl.GetDstType())
+    name := vtableName(dst, d.Impl.GetInterfaceType())
+    if state.definedVTables[name] { return }
+    state.definedVTables[name] = true
+
+    entries := []string{}
+    for _,fnName := range d.Impl.GetVTableFuncNames() {
+        entries = append(entries, "(gma_fn)" + state.genThunk(name, dst, d.Impl.GetFunc(fnName)))
+    }
+
+    if len(entries) == 0 {
+        state.vtables.WriteString(fmt.Sprintf("static const gma_fn %s[1] = { 0 };\n", name))
+    } else {
+        state.vtables.WriteString(fmt.Sprintf("static const gma_fn %s[] = { %s };\n", name, strings.Join(entries, ", ")))
+    }
+}
+
+func (state *State) genThunk(vtable string, dst types.Type, f *identObj.Func) string {
+    thunk := fmt.Sprintf("%s_%s", vtable, sanitize(f.GetName()))
+    dstType := state.cType(dst)
+
+    params := []string{ "gma_iface self" }
+    args := []string{ "v" }
+    if resolve(f.GetArgs()[0]).GetKind() == types.Ptr {
+        args[0] = "&v"
+    }
+    for i,a := range f.GetArgs()[1:] {
+        params = append(params, fmt.Sprintf("%s a%d", state.cType(a), i))
+        args = append(args, fmt.Sprintf("a%d", i))
+    }
+
+    ret := "return "
+    if f.GetRetType() == nil {
+        ret = ""
+    }
+
+    state.vtables.WriteString(fmt.Sprintf("static %s %s(%s) {\n", state.cType(f.GetRetType()), thunk, strings.Join(params, ", ")))
+    state.vtables.WriteString(fmt.Sprintf("    %s v;\n", dstType))
+    state.vtables.WriteString("    memset(&v, 0, sizeof v);\n")
+    state.vtables.WriteString("    memcpy(&v, &self, sizeof v < sizeof self ? sizeof v : sizeof self);\n")
+    state.vtables.WriteString(fmt.Sprintf("    %s%s(%s);\n", ret, fnName(f), strings.Join(args, ", ")))
+    state.vtables.WriteString("}\n")
+
+    return thunk
+}
+
+type fnCtx struct {
+    state *State
+    f *identObj.Func
+    params []vars.Var
+    names map[vars.Var]string
+    used map[string]bool
+    locals strings.Builder
+    body strings.Builder
+    indent int
+    // params are copied into a packed struct (in asm stack order)
+    framed bool
+    addrTaken bool
+    tmps uint
+    labels uint
+    loops int
+    switches []*switchCtx
+}
+
+func (state *State) newFnCtx(d *ast.DefFn, framed bool) *fnCtx {
+    ctx := &fnCtx{ state: state, f: d.FnHead.F, names: make(map[vars.Var]string), used: make(map[string]bool), indent: 1, framed: framed }
+    for _,a := range d.FnHead.Args {
+        ctx.params = append(ctx.params, a.V)
+    }
+    return ctx
+}
+
+// address taken params are regenerated inside of a frame
+// (std relies on the order of args on the stack, i.e. from_pchar)
+func (state *State) genFn(d *ast.DefFn) {
+    state.layoutFrame(d)
+    state.curFn = state.newFnCtx(d, false)
+    params := state.curFn.genParams()
+    state.genBlock(&d.Block)
+
+    if state.curFn.addrTaken {
+        state.layoutFrame(d)
+        state.curFn = state.newFnCtx(d, true)
+        params = state.curFn.genParams()
+        state.genBlock(&d.Block)
+    }
+
+    state.identObj.ResetStackSize()
+
+    head := fmt.Sprintf("static %s %s(%s)", state.cType(d.FnHead.F.GetRetType()), fnName(d.FnHead.F), params)
+
+    state.protos.WriteString(head + ";\n")
+    state.funcs.WriteString(head + " {\n")
+    state.funcs.WriteString(state.curFn.locals.String())
+    state.funcs.WriteString(state.curFn.body.String())
+    state.funcs.WriteString("}\n")
+
+    state.curFn = nil
+}
+
+// compile time evaluation (const functions) uses the stack layout of the asm backend
+func (state *State) layoutFrame(d *ast.DefFn) {
+    state.identObj.ResetStackSize()
+
+    regIdx := uint(0)
+    argsFromStackOffset := uint(8)
+    regArgsOffset := d.FnHead.F.Scope.GetInnerSize()
+
+    if types.IsBigStruct(resolve(d.FnHead.F.GetRetType())) {
+        regArgsOffset += types.Ptr_Size
+        regIdx++
+    }
+
+    for _,a := range d.FnHead.Args {
+        if v,ok := a.V.(*vars.LocalVar); ok {
+            if t := resolve(v.GetType()); types.IsBigStruct(t) {
+                v.SetOffset(argsFromStackOffset, true)
+                argsFromStackOffset += t.Size()
+            }
+        }
+    }
+
+    for _,a := range d.FnHead.Args {
+        if v,ok := a.V.(*vars.LocalVar); ok {
+            if t := resolve(v.GetType()); !types.IsBigStruct(t) {
+                if needed := types.RegCount(t); regIdx + needed <= 6 {
+                    v.SetOffset(regArgsOffset, false)
+                    regIdx += needed
+                    regArgsOffset += t.Size()
+                } else {
+                    v.SetOffset(argsFromStackOffset, true)
+                    argsFromStackOffset += t.Size()
+                }
+            }
+        }
+    }
+}
+
+func (state *State) setLocalOffset(v vars.Var) {
+    if v,ok := v.(*vars.LocalVar); ok {
+        v.SetOffset(state.identObj.GetStackSize(), false)
+        state.identObj.IncStackSize(v.GetType())
+    }
+}
+
+func (f *fnCtx) genParams() string {
+    if len(f.params) == 0 {
+        return "void"
+    }
+
+    params := make([]string, 0, len(f.params))
+
+    if f.framed {
+        var frame strings.Builder
+        frame.WriteString("    struct {\n")
+        for i := len(f.params)-1; i >= 0; i-- {
+            v := f.params[i]
+            if !types.IsBigStruct(resolve(v.GetType())) {
+                name := f.newName("v_" + sanitize(v.GetName()))
+                f.names[v] = "_args." + name
+                frame.WriteString(fmt.Sprintf("        %s %s;\n", f.state.cType(v.GetType()), name))
+            }
+        }
+        frame.WriteString("    } _args;\n")
+        f.locals.WriteString(frame.String())
+
+        for _,v := range f.params {
+            if name,ok := f.names[v]; ok {
+                p := "p_" + sanitize(v.GetName())
+                params = append(params, fmt.Sprintf("%s %s", f.state.cType(v.GetType()), p))
+                f.locals.WriteString(fmt.Sprintf("    %s = %s;\n", name, p))
+            } else {
+                name := f.newName("v_" + sanitize(v.GetName()))
+                f.names[v] = name
+                params = append(params, fmt.Sprintf("%s %s", f.state.cType(v.GetType()), name))
+            }
+        }
+    } else {
+        for _,v := range f.params {
+            name := f.newName("v_" + sanitize(v.GetName()))
+            f.names[v] = name
+            params = append(params, fmt.Sprintf("%s %s", f.state.cType(v.GetType()), name))
+        }
+    }
+
+    return strings.Join(params, ", ")
+}
+
+func (f *fnCtx) newName(name string) string {
+    if !f.used[name] {
+        f.used[name] = true
+        return name
+    }
+
+    for i := 1;; i++ {
+        n := fmt.Sprintf("%s%d", name, i)
+        if !f.used[n] {
+            f.used[n] = true
+            return n
+        }
+    }
+}
+
+// locals are hoisted (zero initialized)
+func (f *fnCtx) varName(v vars.Var) string {
+    if g,ok := v.(*vars.GlobalVar); ok {
+        return globalName(g.GetName())
+    }
+
+    if name,ok := f.names[v]; ok {
+        return name
+    }
+
+    name := f.newName("v_" + sanitize(v.GetName()))
+    f.names[v] = name
+    f.locals.WriteString(fmt.Sprintf("    %s %s = %s;\n", f.state.cType(v.GetType()), name, zeroInit(v.GetType())))
+
+    return name
+}
+
+func (f *fnCtx) isParam(v vars.Var) bool {
+    for _,p := range f.params {
+        if p == v {
+            return true
+        }
+    }
+    return false
+}
+
+func (f *fnCtx) tmp(t types.Type) string {
+    name := f.newName(fmt.Sprintf("_t%d", f.tmps))
+    f.tmps++
+    f.locals.WriteString(fmt.Sprintf("    %s %s;\n", f.state.cType(t), name))
+    return name
+}
+
+func (f *fnCtx) label(prefix string) string {
+    f.labels++
+    return fmt.Sprintf("%s%d", prefix, f.labels)
+}
+
+func (f *fnCtx) line(format string, a ...interface{}) {
+    f.body.WriteString(strings.Repeat("    ", f.indent))
+    f.body.WriteString(fmt.Sprintf(format, a...))
+    f.body.WriteString("\n")
+}
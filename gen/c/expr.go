@@ -0,0 +1,660 @@
+package c
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/ast/identObj/vars"
+    "gamma/gen"
+)
+
+func (state *State) GenExpr(e ast.Expr) string {
+    if c := state.constEval(e); c != nil {
+        return state.constExpr(e.GetType(), c)
+    }
+
+    return state.genExpr(e)
+}
+
+func (state *State) genExpr(e ast.Expr) string {
+    switch e := e.(type) {
+    case *ast.IntLit, *ast.CharLit, *ast.BoolLit, *ast.StrLit:
+        return state.constExpr(e.GetType(), state.constEval(e))
+    case *ast.PtrLit:
+        return state.genPtrLit(e)
+
+    case *ast.ArrayLit:
+        return state.genArrayLit(e)
+    case *ast.VectorLit:
+        return state.genVectorLit(e)
+    case *ast.StructLit:
+        return state.genStructLit(e)
+    case *ast.EnumLit:
+        return state.genEnumLit(e)
+
+    case *ast.Indexed:
+        return state.genIndexed(e)
+    case *ast.Field:
+        return state.genField(e)
+
+    case *ast.Ident:
+        return state.genIdent(e)
+
+    case *ast.FnCall:
+        return state.genFnCall(e)
+
+    case *ast.Unary:
+        return state.genUnary(e)
+    case *ast.Binary:
+        return state.genBinary(e)
+    case *ast.Paren:
+        return "(" + state.GenExpr(e.Expr) + ")"
+
+    case *ast.XSwitch:
+        return state.genXSwitch(e)
+
+    case *ast.Cast:
+        return state.genCast(e)
+
+    case *ast.Unwrap:
+        return state.genUnwrap(e)
+
+    case *ast.BadExpr:
+        state.diag.Error("bad expression")
+        state.diag.Exit()
+    default:
+        state.diag.Errorf("GenExpr for %v is not implemente yet", reflect.TypeOf(e))
+        state.diag.Exit()
+    }
+
+    return ""
+}
+
+// e as value of type t (interfaces get boxed, scalars casted)
+func (state *State) convert(t types.Type, e ast.Expr) string {
+    t = resolve(t)
+    if t == nil {
+        return state.GenExpr(e)
+    }
+
+    src := resolve(e.GetType())
+
+    if t.GetKind() == types.Interface && src != nil && src.GetKind() != types.Interface {
+        return state.toInterface(t.(types.InterfaceType), src, state.GenExpr(e))
+    }
+
+    if c := state.constEval(e); c != nil {
+        return state.constExpr(t, c)
+    }
+
+    x := state.genExpr(e)
+    if src != nil && isScalar(t) && isScalar(src) && state.cType(t) != state.cType(src) {
+        return state.castScalar(t, src, x)
+    }
+    return x
+}
+
+// the interface holds the first 8 bytes of the value
+func (state *State) toInterface(t types.InterfaceType, src types.Type, x string) string {
+    tmp := state.curFn.tmp(src)
+    return fmt.Sprintf("(%s = %s, (gma_iface){ gma_word(&%s, sizeof %s), %s })", tmp, x, tmp, tmp, vtableName(src, t))
+}
+
+func isScalar(t types.Type) bool {
+    switch t.GetKind() {
+    case types.Int, types.Uint, types.Char, types.Bool, types.Ptr, types.Arr:
+        return true
+    default:
+        return false
+    }
+}
+
+func isPtr(t types.Type) bool {
+    return t.GetKind() == types.Ptr || t.GetKind() == types.Arr
+}
+
+func (state *State) castScalar(dst types.Type, src types.Type, x string) string {
+    if isPtr(dst) || isPtr(src) {
+        return fmt.Sprintf("((%s)(uintptr_t)(%s))", state.cType(dst), x)
+    }
+    return fmt.Sprintf("((%s)(%s))", state.cType(dst), x)
+}
+
+// pointers as integers (for arithmetic)
+func (state *State) num(e ast.Expr) string {
+    x := state.GenExpr(e)
+    if isPtr(resolve(e.GetType())) {
+        return fmt.Sprintf("((uint64_t)(uintptr_t)(%s))", x)
+    }
+    return x
+}
+
+func (state *State) lvalue(e ast.Expr) string {
+    switch e := e.(type) {
+    case *ast.Ident, *ast.Indexed, *ast.Field:
+        return state.genExpr(e)
+    case *ast.Paren:
+        return state.lvalue(e.Expr)
+    case *ast.XSwitch:
+        return "(*" + state.xswitchAddr(e) + ")"
+    case *ast.Unary:
+        if e.Operator.Type == token.Mul {
+            return state.genExpr(e)
+        }
+    }
+
+    state.diag.Errorf("cannot assign to %v", reflect.TypeOf(e))
+    state.diag.At(e.At())
+    state.diag.Exit()
+    return ""
+}
+
+func (state *State) cond(e ast.Expr) string {
+    return state.GenExpr(e)
+}
+
+func (state *State) genPtrLit(e *ast.PtrLit) string {
+    if e.Local {
+        state.diag.Error("addresses of the stack frame are not supported by the C backend")
+        state.diag.At(e.At())
+        state.diag.Exit()
+    }
+
+    return fmt.Sprintf("((%s)(uintptr_t)%s)", state.cType(e.Type), e.Addr)
+}
+
+// only the non const elements are set at runtime (the rest is static data)
+func (state *State) genArrayLit(e *ast.ArrayLit) string {
+    t := resolve(e.Type).(types.ArrType)
+    arr := fmt.Sprintf("gma_arr%d", e.Idx)
+
+    assigns := []string{}
+    state.setArrayLit(&assigns, arr, e, t, 0, true)
+
+    ptr := fmt.Sprintf("((%s)%s)", state.cType(t), arr)
+    if len(assigns) == 0 {
+        return ptr
+    }
+
+    return "(" + strings.Join(assigns, ", ") + ", " + ptr + ")"
+}
+
+func (state *State) setArrayLit(assigns *[]string, arr string, e *ast.ArrayLit, t types.ArrType, offset uint64, static bool) {
+    sub,nested := t.BaseType.(types.ArrType)
+
+    for i,v := range e.Values {
+        if static && state.constEval(v) != nil {
+            continue
+        }
+
+        if nested {
+            off := offset + uint64(i) * arrFlatLen(sub)
+            if lit,ok := v.(*ast.ArrayLit); ok {
+                state.setArrayLit(assigns, arr, lit, sub, off, false)
+            } else {
+                *assigns = append(*assigns, fmt.Sprintf("memcpy(%s + %d, %s, %d)", arr, off, state.GenExpr(v), arrFlatLen(sub) * uint64(arrBaseType(sub).Size())))
+            }
+        } else {
+            *assigns = append(*assigns, fmt.Sprintf("%s[%d] = %s", arr, offset + uint64(i), state.convert(t.BaseType, v)))
+        }
+    }
+}
+
+func (state *State) genVectorLit(e *ast.VectorLit) string {
+    t := resolve(e.Type).(types.VecType)
+    u64 := types.CreateUint(types.U64_Size)
+
+    l, cap := "0", "0"
+    if e.Len != nil {
+        l = state.convert(u64, e.Len)
+    }
+    if e.Cap != nil {
+        cap = state.convert(u64, e.Cap)
+    }
+
+    return fmt.Sprintf("gma_vec_new(%s, %s, %d)", cap, l, resolve(t.BaseType).Size())
+}
+
+func (state *State) genStructLit(e *ast.StructLit) string {
+    t := resolve(e.StructType).(types.StructType)
+
+    if len(e.Fields) == 0 {
+        return fmt.Sprintf("((%s){ 0 })", state.cType(t))
+    }
+
+    fields := make([]string, len(e.Fields))
+    for i,f := range e.Fields {
+        fields[i] = state.convert(t.Types[i], f.Value)
+    }
+
+    return fmt.Sprintf("((%s){ %s })", state.cType(t), strings.Join(fields, ", "))
+}
+
+func (state *State) genEnumLit(e *ast.EnumLit) string {
+    t := resolve(e.Type).(types.EnumType)
+    id := t.GetElemID(e.ElemName.Str)
+
+    if t.IsNiche() {
+        if e.Content == nil {
+            return fmt.Sprintf("((%s){ { 0 } })", state.cType(t))
+        }
+        return fmt.Sprintf("((%s){ { .%s = %s } })", state.cType(t), elemName(e.ElemName.Str), state.convert(t.GetType(e.ElemName.Str), e.Content.Expr))
+    }
+
+    if e.Content == nil {
+        return fmt.Sprintf("((%s){ %d })", state.cType(t), id)
+    }
+
+    content := state.convert(t.GetType(e.ElemName.Str), e.Content.Expr)
+    return fmt.Sprintf("((%s){ %d, { .%s = %s } })", state.cType(t), id, elemName(e.ElemName.Str), content)
+}
+
+// multi dimensional arrays are flat
+func (state *State) genIndexed(e *ast.Indexed) string {
+    switch t := resolve(e.ArrType).(type) {
+    case types.VecType:
+        return fmt.Sprintf("((%s*)(%s).ptr)[%s]", state.cPtrBase(t.BaseType), state.GenExpr(e.ArrExpr), state.GenExpr(e.Index))
+
+    case types.ArrType:
+        var base ast.Expr = e.ArrExpr
+        for {
+            if i,ok := base.(*ast.Indexed); ok && resolve(i.ArrType).GetKind() == types.Arr {
+                base = i.ArrExpr
+            } else {
+                break
+            }
+        }
+
+        idx := state.GenExpr(e.Flatten())
+        if sub,ok := t.BaseType.(types.ArrType); ok {
+            return fmt.Sprintf("(%s + (%s) * %d)", state.GenExpr(base), idx, arrFlatLen(sub))
+        }
+        return fmt.Sprintf("(%s)[%s]", state.GenExpr(base), idx)
+
+    default:
+        state.diag.Errorf("cannot index %v", t)
+        state.diag.At(e.At())
+        state.diag.Exit()
+        return ""
+    }
+}
+
+func (state *State) genField(e *ast.Field) string {
+    switch t := resolve(e.Obj.GetType()).(type) {
+    case types.ArrType:
+        return fmt.Sprintf("((uint64_t)%d)", t.Len)
+
+    case types.VecType:
+        return fmt.Sprintf("(%s).%s", state.GenExpr(e.Obj), e.FieldName.Str)
+
+    case types.StrType:
+        return fmt.Sprintf("(%s).len", state.GenExpr(e.Obj))
+
+    case types.StructType:
+        return fmt.Sprintf("(%s).%s", state.GenExpr(e.Obj), fieldName(e.FieldName.Str))
+
+    default:
+        state.diag.Errorf("%v has no fields", t)
+        state.diag.At(e.At())
+        state.diag.Exit()
+        return ""
+    }
+}
+
+func (state *State) genIdent(e *ast.Ident) string {
+    switch obj := e.Obj.(type) {
+    case vars.Var:
+        return state.curFn.varName(obj)
+
+    case *identObj.Const:
+        return state.constExpr(e.GetType(), obj.GetVal())
+
+    case *identObj.Func:
+        state.diag.Error("functions as values are not supported yet")
+        state.diag.At(e.At())
+        state.diag.Exit()
+    }
+
+    state.diag.Errorf("\"%s\" is not declared", e.Name)
+    state.diag.At(e.Pos.At())
+    state.diag.Exit()
+    return ""
+}
+
+func (state *State) genFnCall(e *ast.FnCall) string {
+    if s,ok := state.genBuildinCall(e); ok {
+        return s
+    }
+
+    f, fnSrc := e.F, e.FnSrc
+    if f.FnSrc != nil && f.FnSrc.GetKind() == types.Interface {
+        for i,a := range f.GetArgs() {
+            if explicitFnSrc := types.SolveInterface(a, e.Values[i].GetType()); explicitFnSrc != nil {
+                fnSrc = explicitFnSrc
+                f = f.ResolveInterface(explicitFnSrc)
+                break
+            }
+        }
+    }
+
+    args := make([]string, len(e.Values))
+    for i,v := range e.Values {
+        args[i] = state.convert(f.GetArgs()[i], v)
+    }
+
+    // args are evaluated from left to right (like in the asm backend)
+    // so every arg up to the last one with side effects is stored in a tmp first
+    hoisted := []string{}
+    if len(args) > 1 {
+        last := -1
+        for i,v := range e.Values {
+            if !gen.NoSideEffects(v) {
+                last = i
+            }
+        }
+
+        for i := 0; i <= last; i++ {
+            if state.cmpTime.ConstEval(e.Values[i]) == nil {
+                tmp := state.curFn.tmp(resolve(f.GetArgs()[i]))
+                hoisted = append(hoisted, fmt.Sprintf("%s = %s", tmp, args[i]))
+                args[i] = tmp
+            }
+        }
+    }
+
+    call := fmt.Sprintf("%s(%s)", fnName(f), strings.Join(args, ", "))
+    if fnSrc != nil && fnSrc.GetKind() == types.Interface && len(args) > 0 && resolve(f.GetArgs()[0]).GetKind() == types.Interface {
+        call = state.genVTableCall(e, f, fnSrc.(types.InterfaceType), args)
+    }
+
+    if len(hoisted) > 0 {
+        return fmt.Sprintf("(%s, %s)", strings.Join(hoisted, ", "), call)
+    }
+    return call
+}
+
+func (state *State) genVTableCall(e *ast.FnCall, f *identObj.Func, interfaceType types.InterfaceType, args []string) string {
+    i,ok := state.identObj.Get(interfaceType.Name).(*identObj.Interface)
+    if !ok {
+        state.diag.Errorf("interface %v is not defined", interfaceType.Name)
+        state.diag.At(e.Ident.Pos.At())
+        state.diag.Exit()
+    }
+    idx := i.GetVTableOffset(f.GetName()) / types.Ptr_Size
+
+    params := make([]string, len(args))
+    for i,a := range f.GetArgs() {
+        params[i] = state.cType(a)
+    }
+
+    self := state.curFn.tmp(f.GetArgs()[0])
+    fnType := fmt.Sprintf("%s (*)(%s)", state.cType(f.GetRetType()), strings.Join(params, ", "))
+
+    call := fmt.Sprintf("((%s)%s.vtable[%d])(%s)", fnType, self, idx, strings.Join(append([]string{ self }, args[1:]...), ", "))
+    return fmt.Sprintf("(%s = %s, %s)", self, args[0], call)
+}
+
+func (state *State) genUnary(e *ast.Unary) string {
+    switch e.Operator.Type {
+    case token.Amp:
+        return state.addrOf(e.Operand)
+
+    case token.Mul:
+        return fmt.Sprintf("(*%s)", state.GenExpr(e.Operand))
+
+    case token.Minus:
+        if t := resolve(e.GetType()); state.checked(t, token.Minus) {
+            return state.checkedOp(t, e.Operator, true, "0", state.GenExpr(e.Operand))
+        }
+        return fmt.Sprintf("((%s)-(%s))", state.cType(e.GetType()), state.GenExpr(e.Operand))
+
+    case token.BitNot:
+        return fmt.Sprintf("((%s)~(%s))", state.cType(e.GetType()), state.GenExpr(e.Operand))
+
+    case token.Not:
+        return fmt.Sprintf("(!(%s))", state.GenExpr(e.Operand))
+
+    default:
+        return state.GenExpr(e.Operand)
+    }
+}
+
+func (state *State) addrOf(e ast.Expr) string {
+    switch e := e.(type) {
+    case *ast.Ident:
+        if v,ok := e.Obj.(vars.Var); ok {
+            if state.curFn.isParam(v) {
+                state.curFn.addrTaken = true
+            }
+            return "(&" + state.curFn.varName(v) + ")"
+        }
+
+    case *ast.Paren:
+        return state.addrOf(e.Expr)
+
+    case *ast.Indexed, *ast.Field:
+        return "(&" + state.genExpr(e) + ")"
+
+    case *ast.Unary:
+        if e.Operator.Type == token.Mul {
+            return state.GenExpr(e.Operand)
+        }
+
+    case *ast.Cast:
+        return fmt.Sprintf("((%s*)%s)", state.cPtrBase(e.DestType), state.addrOf(e.Expr))
+    }
+
+    tmp := state.curFn.tmp(e.GetType())
+    return fmt.Sprintf("(%s = %s, &%s)", tmp, state.GenExpr(e), tmp)
+}
+
+var binaryOps map[token.TokenType]string = map[token.TokenType]string{
+    token.Plus: "+", token.Minus: "-", token.Mul: "*", token.Div: "/", token.Mod: "%",
+    token.Amp: "&", token.BitOr: "|", token.Xor: "^", token.Shl: "<<", token.Shr: ">>",
+    token.Eql: "==", token.Neq: "!=", token.Lss: "<", token.Grt: ">", token.Leq: "<=", token.Geq: ">=",
+    token.And: "&&", token.Or: "||",
+}
+
+func (state *State) genBinary(e *ast.Binary) string {
+    lt := resolve(e.OperandL.GetType())
+    op,ok := binaryOps[e.Operator.Type]
+    if !ok {
+        state.diag.Errorf("unexpected operator %v", e.Operator)
+        state.diag.At(e.At())
+        state.diag.Exit()
+    }
+
+    switch e.Operator.Type {
+    case token.And, token.Or:
+        return fmt.Sprintf("(%s %s %s)", state.cond(e.OperandL), op, state.cond(e.OperandR))
+
+    case token.Eql, token.Neq, token.Lss, token.Grt, token.Leq, token.Geq:
+        switch lt.GetKind() {
+        case types.Str:
+            if e.Operator.Type == token.Neq {
+                return fmt.Sprintf("(!gma_str_eq(%s, %s))", state.GenExpr(e.OperandL), state.GenExpr(e.OperandR))
+            }
+            return fmt.Sprintf("gma_str_eq(%s, %s)", state.GenExpr(e.OperandL), state.GenExpr(e.OperandR))
+
+        case types.Enum:
+            if t := lt.(types.EnumType); t.IsNiche() {
+                ptrElem,_,_ := t.NicheElems()
+                return fmt.Sprintf("(((%s).val.%s == 0) %s ((%s).val.%s == 0))", state.GenExpr(e.OperandL), elemName(ptrElem), op, state.GenExpr(e.OperandR), elemName(ptrElem))
+            }
+            return fmt.Sprintf("((%s).id %s (%s).id)", state.GenExpr(e.OperandL), op, state.GenExpr(e.OperandR))
+
+        default:
+            return fmt.Sprintf("(%s %s %s)", state.num(e.OperandL), op, state.num(e.OperandR))
+        }
+    }
+
+    if lt.GetKind() == types.Str && e.Operator.Type == token.Plus {
+        return fmt.Sprintf("gma_str_concat(%s, %s)", state.GenExpr(e.OperandL), state.GenExpr(e.OperandR))
+    }
+
+    t := resolve(e.GetType())
+    l, r := state.num(e.OperandL), state.num(e.OperandR)
+
+    // >> of signed ints is arithmetic (like in the asm backend), << is done unsigned (no UB for negative ints)
+    if e.Operator.Type == token.Shl && lt.GetKind() == types.Int {
+        l = fmt.Sprintf("(uint%d_t)%s", lt.Size()*8, l)
+    }
+
+    if isPtr(t) {
+        return fmt.Sprintf("((%s)(uintptr_t)(%s %s %s))", state.cType(t), l, op, r)
+    }
+    if state.checked(t, e.Operator.Type) {
+        return state.checkedOp(t, e.Operator, false, l, r)
+    }
+    if state.checkedDivisor(e) {
+        // l is evaluated before r (like in the asm backend)
+        tl, tr := state.curFn.tmp(lt), state.curFn.tmp(resolve(e.OperandR.GetType()))
+        return fmt.Sprintf("(%s = %s, %s = %s, %s == 0 ? gma_div_zero(%s) : (void)0, (%s)(%s %s %s))",
+            tl, l, tr, r, tr, gen.DivZeroMsg(e.Operator), state.cType(t), tl, op, tr)
+    }
+    return fmt.Sprintf("((%s)(%s %s %s))", state.cType(t), l, op, r)
+}
+
+// debug builds check the divisor of / and % (if it is not const)
+func (state *State) checkedDivisor(e *ast.Binary) bool {
+    if state.gen.GetOptLevel() != gen.O0 || state.curFn == nil {
+        return false
+    }
+    if e.Operator.Type != token.Div && e.Operator.Type != token.Mod {
+        return false
+    }
+    return state.constEval(e.OperandR) == nil
+}
+
+// gamma -check-overflow (temps are only available in functions)
+func (state *State) checked(t types.Type, op token.TokenType) bool {
+    if !state.gen.CheckOverflow() || state.curFn == nil {
+        return false
+    }
+    if t.GetKind() != types.Int && t.GetKind() != types.Uint {
+        return false
+    }
+    return op == token.Plus || op == token.Minus || op == token.Mul
+}
+
+var overflowBuiltins map[token.TokenType]string = map[token.TokenType]string{
+    token.Plus: "add", token.Minus: "sub", token.Mul: "mul",
+}
+
+func (state *State) checkedOp(t types.Type, op token.Token, unary bool, l string, r string) string {
+    msg := gen.OverflowMsg(t, op, unary)
+    tmp := state.curFn.tmp(t)
+    return fmt.Sprintf("(__builtin_%s_overflow(%s, %s, &%s) ? gma_overflow(%s) : (void)0, %s)", overflowBuiltins[op.Type], l, r, tmp, msg, tmp)
+}
+
+func (state *State) genXSwitch(e *ast.XSwitch) string {
+    t := resolve(e.GetType())
+
+    res := state.zeroValue(t)
+    for i := len(e.Cases)-1; i >= 0; i-- {
+        c := e.Cases[i]
+
+        if c.Cond == nil {
+            res = state.convert(t, c.Expr)
+        } else if val,ok := state.isConstBool(c.Cond); ok {
+            if val {
+                res = state.convert(t, c.Expr)
+            }
+        } else {
+            res = fmt.Sprintf("(%s ? %s : %s)", state.cond(c.Cond), state.convert(t, c.Expr), res)
+        }
+    }
+
+    return res
+}
+
+// assignments to an xswitch (without default they go nowhere)
+func (state *State) xswitchAddr(e *ast.XSwitch) string {
+    res := ""
+    for i := len(e.Cases)-1; i >= 0; i-- {
+        c := e.Cases[i]
+
+        if c.Cond == nil || state.isConstTrue(c.Cond) {
+            res = state.addrOf(c.Expr)
+        } else if val,ok := state.isConstBool(c.Cond); !ok || val {
+            if res == "" {
+                res = "&" + state.curFn.tmp(e.GetType())
+            }
+            res = fmt.Sprintf("(%s ? %s : %s)", state.cond(c.Cond), state.addrOf(c.Expr), res)
+        }
+    }
+
+    if res == "" {
+        res = "&" + state.curFn.tmp(e.GetType())
+    }
+    return res
+}
+
+func (state *State) zeroValue(t types.Type) string {
+    if isScalar(t) {
+        return fmt.Sprintf("((%s)0)", state.cType(t))
+    }
+    return fmt.Sprintf("((%s){ 0 })", state.cType(t))
+}
+
+func (state *State) genCast(e *ast.Cast) string {
+    dst := resolve(e.DestType)
+    src := resolve(e.Expr.GetType())
+
+    if dst.GetKind() == types.Interface {
+        return state.convert(dst, e.Expr)
+    }
+
+    x := state.GenExpr(e.Expr)
+    if state.cType(dst) == state.cType(src) {
+        return x
+    }
+
+    switch {
+    case (src.GetKind() == types.Str || src.GetKind() == types.Vec) && isScalar(dst):
+        return state.castScalar(dst, types.PtrType{}, fmt.Sprintf("(%s).ptr", x))
+
+    // casts never sign extend (the value is kept as is)
+    case src.GetKind() == types.Int && dst.Size() > src.Size() && !isPtr(dst):
+        return fmt.Sprintf("((%s)(uint%d_t)(%s))", state.cType(dst), src.Size()*8, x)
+
+    case isScalar(src) && isScalar(dst):
+        return state.castScalar(dst, src, x)
+
+    default:
+        // reinterpret the bytes
+        tmp := state.curFn.tmp(src)
+        return fmt.Sprintf("(%s = %s, *(%s*)&%s)", tmp, x, state.cType(dst), tmp)
+    }
+}
+
+func (state *State) genUnwrap(e *ast.Unwrap) string {
+    t := resolve(e.EnumType).(types.EnumType)
+    id := t.GetElemID(e.ElemName.Str)
+    src := state.GenExpr(e.SrcExpr)
+
+    if ptrElem,_,ok := t.NicheElems(); ok {
+        if e.ElemName.Str != ptrElem {
+            return fmt.Sprintf("((%s).val.%s == 0)", src, elemName(ptrElem))
+        }
+
+        if v,ok := e.Obj.(vars.Var); ok && !e.UnusedObj {
+            state.setLocalOffset(v)
+            tmp := state.curFn.tmp(t)
+            return fmt.Sprintf("(%s = %s, %s.val.%s != 0 && (%s = %s.val.%s, 1))", tmp, src, tmp, elemName(ptrElem), state.curFn.varName(v), tmp, elemName(ptrElem))
+        }
+        return fmt.Sprintf("((%s).val.%s != 0)", src, elemName(ptrElem))
+    }
+
+    if v,ok := e.Obj.(vars.Var); ok && !e.UnusedObj {
+        state.setLocalOffset(v)
+        tmp := state.curFn.tmp(t)
+        return fmt.Sprintf("(%s = %s, %s.id == %d && (%s = %s.val.%s, 1))", tmp, src, tmp, id, state.curFn.varName(v), tmp, elemName(e.ElemName.Str))
+    }
+
+    return fmt.Sprintf("((%s).id == %d)", src, id)
+}
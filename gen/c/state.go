@@ -0,0 +1,61 @@
+package c
+
+import (
+    "strings"
+    "gamma/types"
+    "gamma/gen/reach"
+    "gamma/ast/identObj"
+    "gamma/cmpTime"
+    "gamma/diag"
+    "gamma/gen"
+    "gamma/types/array"
+    "gamma/types/str"
+)
+
+// generated C of one compilation (see gamma/compiler)
+type State struct {
+    typeDecls strings.Builder
+    typeDefs strings.Builder
+    // C name -> defined
+    definedTypes map[string]bool
+    // only forward declared (used behind a pointer)
+    pendingTypes []types.Type
+
+    funcs strings.Builder
+    protos strings.Builder
+    vtables strings.Builder
+    globals strings.Builder
+    globalDecls strings.Builder
+    // already generated vtables
+    definedVTables map[string]bool
+
+    curFn *fnCtx
+    reachable *reach.Set
+
+    identObj *identObj.State
+    cmpTime *cmpTime.State
+    diag *diag.State
+    gen *gen.State
+    array *array.State
+    str *str.State
+}
+
+func NewState(
+    identObj *identObj.State,
+    cmpTime *cmpTime.State,
+    diag *diag.State,
+    gen *gen.State,
+    array *array.State,
+    str *str.State,
+) *State {
+    return &State{
+        definedTypes: make(map[string]bool),
+        definedVTables: make(map[string]bool),
+        identObj: identObj,
+        cmpTime: cmpTime,
+        diag: diag,
+        gen: gen,
+        array: array,
+        str: str,
+    }
+}
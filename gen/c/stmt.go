@@ -0,0 +1,306 @@
+package c
+
+import (
+    "fmt"
+    "reflect"
+    "gamma/ast"
+    "gamma/ast/identObj/vars"
+    "gamma/cmpTime/constVal"
+)
+
+// switch bodies are labels (through jumps to the next one)
+type switchCtx struct {
+    end string
+    next string
+}
+
+func (state *State) genStmt(s ast.Stmt) {
+    switch s := s.(type) {
+    case *ast.Assign:
+        state.genAssign(s)
+
+    case *ast.Block:
+        state.curFn.line("{")
+        state.curFn.indent++
+        state.genBlock(s)
+        state.curFn.indent--
+        state.curFn.line("}")
+
+    case *ast.If:
+        state.genIf(s)
+    case *ast.Else:
+        state.genBlock(&s.Block)
+    case *ast.Elif:
+        state.genIf((*ast.If)(s))
+
+    case *ast.Switch:
+        state.genSwitch(s)
+
+    case *ast.Through:
+        state.genThrough(s)
+
+    case *ast.For:
+        state.genFor(s)
+    case *ast.While:
+        state.genWhile(s)
+
+    case *ast.Break:
+        state.genBreak(s)
+    case *ast.Continue:
+        state.curFn.line("continue;")
+    case *ast.Ret:
+        state.genRet(s)
+
+    case *ast.DeclStmt:
+        state.genLocalDecl(s.Decl)
+    case *ast.ExprStmt:
+        if e := state.GenExpr(s.Expr); e != "" {
+            state.curFn.line("%s;", e)
+        }
+
+    case *ast.Case:
+        state.diag.Error("Cases outside of a switch are not allowed")
+        state.diag.At(s.At())
+        state.diag.Exit()
+    case *ast.BadStmt:
+        state.diag.Error("bad statement")
+        state.diag.At(s.At())
+        state.diag.Exit()
+    default:
+        state.diag.Errorf("genStmt for %v is not implemente yet", reflect.TypeOf(s))
+        state.diag.Exit()
+    }
+}
+
+func (state *State) genBlock(s *ast.Block) {
+    for _,stmt := range s.Stmts {
+        state.genStmt(stmt)
+    }
+}
+
+func (state *State) genLocalDecl(d ast.Decl) {
+    switch d := d.(type) {
+    case *ast.DefVar:
+        state.genDefVar(d)
+
+    case *ast.DecVar:
+        state.setLocalOffset(d.V)
+        state.curFn.varName(d.V)
+
+    case *ast.DefConst, *ast.DefStruct, *ast.DefInterface, *ast.DefEnum:
+        // nothing to generate
+
+    default:
+        state.diag.Errorf("local %v is not supported by the C backend", reflect.TypeOf(d))
+        state.diag.Exit()
+    }
+}
+
+func (state *State) genDefVar(d *ast.DefVar) {
+    state.setLocalOffset(d.V)
+    state.curFn.line("%s = %s;", state.curFn.varName(d.V), state.convert(d.V.GetType(), d.Value))
+}
+
+func (state *State) genAssign(s *ast.Assign) {
+    if ident,ok := s.Dest.(*ast.Ident); ok {
+        if _,ok := ident.Obj.(vars.Var); !ok {
+            state.diag.Errorf("expected identifier %s to be a variable but got %v", ident.Name, reflect.TypeOf(ident.Obj))
+            state.diag.At(ident.At())
+            state.diag.Exit()
+        }
+    }
+
+    state.curFn.line("%s = %s;", state.lvalue(s.Dest), state.convert(s.Dest.GetType(), s.Value))
+}
+
+func (state *State) isConstBool(e ast.Expr) (bool, bool) {
+    if b,ok := state.constEval(e).(*constVal.BoolConst); ok {
+        return bool(*b), true
+    }
+    return false, false
+}
+
+func (state *State) isConstTrue(e ast.Expr) bool {
+    val,ok := state.isConstBool(e)
+    return ok && val
+}
+
+func (state *State) genIf(s *ast.If) {
+    if val,ok := state.isConstBool(s.Cond); ok {
+        if val {
+            state.genScope(&s.Block)
+        } else if s.Else != nil {
+            state.genScope(&s.Else.Block)
+        } else if s.Elif != nil {
+            state.genIf((*ast.If)(s.Elif))
+        }
+        return
+    }
+
+    state.curFn.line("if (%s) {", state.cond(s.Cond))
+    state.curFn.indent++
+    state.genBlock(&s.Block)
+    state.curFn.indent--
+
+    if s.Else != nil || s.Elif != nil {
+        state.curFn.line("} else {")
+        state.curFn.indent++
+        if s.Else != nil {
+            state.genBlock(&s.Else.Block)
+        } else {
+            state.genIf((*ast.If)(s.Elif))
+        }
+        state.curFn.indent--
+    }
+    state.curFn.line("}")
+}
+
+func (state *State) genScope(b *ast.Block) {
+    state.curFn.line("{")
+    state.curFn.indent++
+    state.genBlock(b)
+    state.curFn.indent--
+    state.curFn.line("}")
+}
+
+// cases are checked in order (like in the asm backend)
+func (state *State) genSwitch(s *ast.Switch) {
+    sw := &switchCtx{ end: state.curFn.label("sw_end") }
+
+    bodies := []int{}
+    labels := []string{}
+    unconditional := false
+
+    for i,c := range s.Cases {
+        if c.Cond != nil {
+            if val,ok := state.isConstBool(c.Cond); ok && !val {
+                continue
+            }
+        }
+
+        label := state.curFn.label("sw_case")
+        bodies = append(bodies, i)
+        labels = append(labels, label)
+
+        if unconditional {
+            continue    // only reachable with through
+        }
+
+        if c.Cond == nil || state.isConstTrue(c.Cond) {
+            state.curFn.line("goto %s;", label)
+            unconditional = true
+        } else {
+            state.curFn.line("if (%s) goto %s;", state.cond(c.Cond), label)
+        }
+    }
+
+    if !unconditional {
+        state.curFn.line("goto %s;", sw.end)
+    }
+
+    state.curFn.switches = append(state.curFn.switches, sw)
+
+    for i,idx := range bodies {
+        sw.next = ""
+        if i+1 < len(labels) {
+            sw.next = labels[i+1]
+        }
+
+        state.curFn.indent--
+        state.curFn.line("%s:;", labels[i])
+        state.curFn.indent++
+
+        state.curFn.line("{")
+        state.curFn.indent++
+        state.genStmt(s.Cases[idx].Stmt)
+        state.curFn.indent--
+        state.curFn.line("}")
+        state.curFn.line("goto %s;", sw.end)
+    }
+
+    state.curFn.switches = state.curFn.switches[:len(state.curFn.switches)-1]
+
+    state.curFn.indent--
+    state.curFn.line("%s:;", sw.end)
+    state.curFn.indent++
+}
+
+func (state *State) genThrough(s *ast.Through) {
+    if len(state.curFn.switches) == 0 {
+        state.diag.Error("through can only be used inside a switch")
+        state.diag.At(s.At())
+        state.diag.Exit()
+    }
+
+    sw := state.curFn.switches[len(state.curFn.switches)-1]
+    if sw.next == "" {
+        state.diag.Error("cannot use through in the last case")
+        state.diag.At(s.At())
+        state.diag.Exit()
+    }
+
+    state.curFn.line("goto %s;", sw.next)
+}
+
+func (state *State) genWhile(s *ast.While) {
+    if s.Def != nil {
+        state.genDefVar(s.Def)
+    }
+
+    c := "1"
+    if val,ok := state.isConstBool(s.Cond); ok {
+        if !val { return }
+    } else {
+        c = state.cond(s.Cond)
+    }
+
+    state.curFn.line("while (%s) {", c)
+    state.genLoopBody(&s.Block)
+    state.curFn.line("}")
+}
+
+func (state *State) genFor(s *ast.For) {
+    state.genDefVar(&s.Def)
+
+    v := state.curFn.varName(s.Def.V)
+
+    limit := ""
+    if s.Limit != nil {
+        limit = fmt.Sprintf("%s < %s", v, state.GenExpr(s.Limit))
+    }
+
+    state.curFn.line("for (; %s; %s = %s) {", limit, v, state.convert(s.Def.V.GetType(), s.Step))
+    state.genLoopBody(&s.Block)
+    state.curFn.line("}")
+}
+
+func (state *State) genLoopBody(b *ast.Block) {
+    state.curFn.loops++
+    state.curFn.indent++
+
+    state.genBlock(b)
+
+    state.curFn.indent--
+    state.curFn.loops--
+}
+
+// breaks out of loops first (like in the asm backend)
+func (state *State) genBreak(s *ast.Break) {
+    if state.curFn.loops > 0 {
+        state.curFn.line("break;")
+    } else if len(state.curFn.switches) > 0 {
+        state.curFn.line("goto %s;", state.curFn.switches[len(state.curFn.switches)-1].end)
+    } else {
+        state.diag.Error("break can only be used inside of a switch or a loop")
+        state.diag.At(s.At())
+        state.diag.Exit()
+    }
+}
+
+func (state *State) genRet(s *ast.Ret) {
+    if s.RetExpr == nil {
+        state.curFn.line("return;")
+    } else {
+        state.curFn.line("return %s;", state.convert(s.F.GetRetType(), s.RetExpr))
+    }
+}
@@ -0,0 +1,262 @@
+package c
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "gamma/types"
+)
+
+func (state *State) resetTypes() {
+    state.typeDecls.Reset()
+    state.typeDefs.Reset()
+    state.definedTypes = make(map[string]bool)
+    state.pendingTypes = nil
+}
+
+// resolves generics (with the current inset types) and infered types
+func resolve(t types.Type) types.Type {
+    switch t := t.(type) {
+    case types.GenericType:
+        return resolve(types.ResolveGeneric(t))
+    case *types.GenericType:
+        return resolve(types.ResolveGeneric(t))
+
+    case types.InferType:
+        return resolve(t.DefaultType)
+
+    case types.PtrType:
+        t.BaseType = resolve(t.BaseType)
+        return t
+
+    case types.ArrType:
+        t.BaseType = resolve(t.BaseType)
+        return t
+
+    case types.VecType:
+        t.BaseType = resolve(t.BaseType)
+        return t
+
+    case types.StructType:
+        if inset := t.GetInsetType(); inset != nil && types.IsGeneric(inset) {
+            return types.ReplaceGeneric(t, resolve(types.InnerGeneric(inset)))
+        }
+        return t
+
+    case types.EnumType:
+        if inset := t.GetInsetType(); inset != nil && types.IsGeneric(inset) {
+            return types.ReplaceGeneric(t, resolve(types.InnerGeneric(inset)))
+        }
+        return t
+
+    default:
+        return t
+    }
+}
+
+// base type of (multi dimensional) arrays
+func arrBaseType(t types.ArrType) types.Type {
+    if b,ok := t.BaseType.(types.ArrType); ok {
+        return arrBaseType(b)
+    }
+    return t.BaseType
+}
+
+// number of base type elements of (multi dimensional) arrays
+func arrFlatLen(t types.ArrType) uint64 {
+    if b,ok := t.BaseType.(types.ArrType); ok {
+        return t.Len * arrFlatLen(b)
+    }
+    return t.Len
+}
+
+func (state *State) cType(t types.Type) string {
+    t = resolve(t)
+
+    switch t := t.(type) {
+    case types.IntType:
+        return fmt.Sprintf("int%d_t", t.Size()*8)
+    case types.UintType:
+        return fmt.Sprintf("uint%d_t", t.Size()*8)
+    case types.CharType, types.BoolType:
+        return "uint8_t"
+    case types.StrType:
+        return "gma_str"
+    case types.VecType:
+        return "gma_vec"
+    case types.InterfaceType:
+        return "gma_iface"
+    case types.FuncType:
+        return "gma_fn"
+
+    case types.PtrType:
+        if t.BaseType == nil {
+            return "void*"
+        }
+        return state.cPtrBase(t.BaseType) + "*"
+
+    case types.ArrType:
+        return state.cPtrBase(arrBaseType(t)) + "*"
+
+    case types.StructType:
+        name := structName(t)
+        state.defineStruct(name, t)
+        return name
+
+    case types.EnumType:
+        name := enumName(t)
+        state.defineEnum(name, t)
+        return name
+
+    case nil:
+        return "void"
+
+    default:
+        state.diag.Errorf("(internal) type %v is not supported by the C backend", t)
+        state.diag.Exit()
+        return ""
+    }
+}
+
+// structs/enums behind a pointer only need a forward declaration
+func (state *State) cPtrBase(t types.Type) string {
+    t = resolve(t)
+
+    switch t := t.(type) {
+    case types.StructType:
+        name := structName(t)
+        state.declare(name)
+        state.pendingTypes = append(state.pendingTypes, t)
+        return name
+
+    case types.EnumType:
+        name := enumName(t)
+        state.declare(name)
+        state.pendingTypes = append(state.pendingTypes, t)
+        return name
+
+    default:
+        return state.cType(t)
+    }
+}
+
+func (state *State) genPendingTypes() {
+    for len(state.pendingTypes) > 0 {
+        t := state.pendingTypes[0]
+        state.pendingTypes = state.pendingTypes[1:]
+        state.cType(t)
+    }
+}
+
+func structName(t types.StructType) string {
+    return "s_" + sanitize(t.GetMangledName())
+}
+
+func enumName(t types.EnumType) string {
+    return "e_" + sanitize(t.GetMangledName())
+}
+
+func fieldName(name string) string {
+    return "f_" + sanitize(name)
+}
+
+func elemName(name string) string {
+    return "e_" + sanitize(name)
+}
+
+func (state *State) declare(name string) {
+    if _,ok := state.definedTypes[name]; !ok {
+        state.definedTypes[name] = false
+        state.typeDecls.WriteString(fmt.Sprintf("typedef struct %s %s;\n", name, name))
+    }
+}
+
+func (state *State) defineStruct(name string, t types.StructType) {
+    state.declare(name)
+    if state.definedTypes[name] { return }
+    state.definedTypes[name] = true
+
+    var def strings.Builder
+    def.WriteString(fmt.Sprintf("struct %s {\n", name))
+    for i,f := range t.GetFields() {
+        def.WriteString(fmt.Sprintf("    %s %s;\n", state.cType(t.Types[i]), fieldName(f)))
+    }
+    def.WriteString("};\n")
+
+    state.typeDefs.WriteString(def.String())
+    state.sizeCheck(name, t.Size())
+}
+
+// tagged union { id, union { elems } }
+// niche enums (Opt<*T>) have no id (a null pointer is the elem without content)
+func (state *State) defineEnum(name string, t types.EnumType) {
+    state.declare(name)
+    if state.definedTypes[name] { return }
+    state.definedTypes[name] = true
+
+    var def strings.Builder
+    if t.IsNiche() {
+        def.WriteString(fmt.Sprintf("struct %s {\n", name))
+    } else {
+        def.WriteString(fmt.Sprintf("struct %s {\n    %s id;\n", name, state.cType(t.IdType)))
+    }
+
+    elems := enumElems(t)
+    hasPayload := false
+    for _,e := range elems {
+        if t.GetType(e) != nil {
+            hasPayload = true
+        }
+    }
+
+    if hasPayload {
+        def.WriteString("    union {\n")
+        for _,e := range elems {
+            if elemType := t.GetType(e); elemType != nil {
+                def.WriteString(fmt.Sprintf("        %s %s;\n", state.cType(elemType), elemName(e)))
+            }
+        }
+        def.WriteString("    } val;\n")
+    }
+    def.WriteString("};\n")
+
+    state.typeDefs.WriteString(def.String())
+    state.sizeCheck(name, t.Size())
+}
+
+// the layout has to match the asm backend (pointer casts, syscalls)
+func (state *State) sizeCheck(name string, size uint) {
+    state.typeDefs.WriteString(fmt.Sprintf("typedef char gma_size_%s[sizeof(%s) == %d ? 1 : -1];\n", name, name, size))
+}
+
+// sorted by id
+func enumElems(t types.EnumType) []string {
+    elems := t.GetElems()
+    sort.Slice(elems, func(i, j int) bool { return t.GetElemID(elems[i]) < t.GetElemID(elems[j]) })
+    return elems
+}
+
+// mangled gamma names -> C identifiers
+func sanitize(name string) string {
+    var res strings.Builder
+
+    for i := 0; i < len(name); i++ {
+        c := name[i]
+        switch {
+        case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+            res.WriteByte(c)
+        case c == '_':
+            res.WriteString("__")
+        case c == '$':
+            res.WriteString("_S")
+        case c == '.':
+            res.WriteString("_D")
+        case c == '*':
+            res.WriteString("_P")
+        default:
+            res.WriteString(fmt.Sprintf("_X%02x", c))
+        }
+    }
+
+    return res.String()
+}
@@ -0,0 +1,227 @@
+package gen
+
+import (
+    "fmt"
+    "bufio"
+    "strings"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/cmpTime/constVal"
+    "gamma/gen/asm/x86_64"
+)
+
+/*
+differential testing of cmpTime (gamma -check-consts)
+  * every scalar expression folded by cmpTime (cfn calls included) is computed at runtime too
+  * the runtime code is generated without folding (before the statement which contains the expression)
+  * mismatches are reported by _check_const (buildin.gma) on stderr:
+    [MISMATCH] <file>:<line>:<col>: folded <value> but runtime <value>
+*/
+
+func (state *State) SetCheckConsts(check bool) {
+    state.checkConsts = check
+}
+
+// global consts/vars are checked at the start of the entry function
+func (state *State) collectGlobalChecks(decls []ast.Decl) {
+    for _,d := range decls {
+        switch d := d.(type) {
+        case *ast.Import:
+            state.collectGlobalChecks(d.Decls)
+        case *ast.DefConst:
+            state.globalChecks = append(state.globalChecks, d.Value)
+        case *ast.DefVar:
+            state.globalChecks = append(state.globalChecks, d.Value)
+        }
+    }
+}
+
+func (state *State) genGlobalChecks(file *bufio.Writer) {
+    for _,e := range state.globalChecks {
+        state.genConstChecks(file, e)
+    }
+    state.globalChecks = nil
+}
+
+func (state *State) genStmtChecks(file *bufio.Writer, s ast.Stmt) {
+    switch s := s.(type) {
+    case *ast.Assign:
+        state.genConstChecks(file, s.Value)
+
+    case *ast.If:
+        state.genIfChecks(file, s)
+
+    case *ast.Switch:
+        for _,c := range s.Cases {
+            state.genConstChecks(file, c.Cond)
+        }
+
+    case *ast.While:
+        state.genConstChecks(file, s.Cond)
+    case *ast.For:
+        state.genConstChecks(file, s.Def.Value)
+        state.genConstChecks(file, s.Limit)
+        state.genConstChecks(file, s.Step)
+
+    case *ast.Ret:
+        state.genConstChecks(file, s.RetExpr)
+
+    case *ast.DeclStmt:
+        switch d := s.Decl.(type) {
+        case *ast.DefVar:
+            state.genConstChecks(file, d.Value)
+        case *ast.DefConst:
+            state.genConstChecks(file, d.Value)
+        }
+    case *ast.ExprStmt:
+        state.genConstChecks(file, s.Expr)
+    }
+}
+
+func (state *State) genIfChecks(file *bufio.Writer, s *ast.If) {
+    state.genConstChecks(file, s.Cond)
+    if s.Elif != nil {
+        state.genIfChecks(file, (*ast.If)(s.Elif))
+    }
+}
+
+// checks the sub expressions first (the innermost mismatch is reported first)
+func (state *State) genConstChecks(file *bufio.Writer, e ast.Expr) {
+    switch e := e.(type) {
+    case nil:
+        return
+
+    case *ast.Unary:
+        state.genConstChecks(file, e.Operand)
+    case *ast.Binary:
+        state.genConstChecks(file, e.OperandL)
+        state.genConstChecks(file, e.OperandR)
+    case *ast.Paren:
+        state.genConstChecks(file, e.Expr)
+        return
+    case *ast.Cast:
+        state.genConstChecks(file, e.Expr)
+
+    case *ast.FnCall:
+        switch e.Ident.Name {
+        case "_syscall", "_asm", "fmt", "sizeof":
+            return
+        }
+        for _,v := range e.Values {
+            state.genConstChecks(file, v)
+        }
+
+    // fields/elements of consts are not allocated (only their folded values can be generated)
+    case *ast.Indexed:
+        state.genConstChecks(file, e.Index)
+        return
+
+    case *ast.XSwitch:
+        for _,c := range e.Cases {
+            state.genConstChecks(file, c.Cond)
+            state.genConstChecks(file, c.Expr)
+        }
+
+    case *ast.StructLit:
+        for _,f := range e.Fields {
+            state.genConstChecks(file, f.Value)
+        }
+        return
+    case *ast.ArrayLit:
+        for _,v := range e.Values {
+            state.genConstChecks(file, v)
+        }
+        return
+
+    default:
+        return
+    }
+
+    state.genConstCheck(file, e)
+}
+
+func (state *State) genConstCheck(file *bufio.Writer, e ast.Expr) {
+    t := types.ResolveGeneric(e.GetType())
+    if t == nil || t.Size() > types.Ptr_Size {
+        return
+    }
+
+    signed := false
+    switch t.GetKind() {
+    case types.Int:
+        signed = true
+    case types.Uint, types.Bool, types.Char:
+    default:
+        return
+    }
+
+    folded, ok := foldedVal(state.cmpTime.ConstEval(e), t.Size(), signed)
+    if !ok {
+        return
+    }
+
+    f,ok := state.identObj.Get("_check_const").(*identObj.Func)
+    if !ok {
+        return
+    }
+
+    state.asm.SaveReg(file, asm.RegDi)
+    state.asm.SaveReg(file, asm.RegSi)
+    state.asm.SaveReg(file, asm.RegD)
+    state.asm.SaveReg(file, asm.RegC)
+    state.asm.SaveReg(file, asm.RegR8)
+
+    state.runtimeOnly = true
+    state.GenExpr(file, e)
+    state.runtimeOnly = false
+
+    asm.MovRegRegExtend(file, asm.RegC, types.Ptr_Size, asm.RegA, t.Size(), signed)
+    asm.MovRegVal(file, asm.RegD, types.Ptr_Size, folded)
+
+    pos := token.Token{ Type: token.Str, Str: fmt.Sprintf("\"%s\"", strings.TrimPrefix(e.At(), "at: ")) }
+    idx := state.str.Add(pos)
+    asm.MovRegVal(file, asm.RegDi, types.Ptr_Size, fmt.Sprintf("_str%d", idx))
+    asm.MovRegVal(file, asm.RegSi, types.U32_Size, fmt.Sprint(state.str.GetSize(idx)))
+    if signed {
+        asm.MovRegVal(file, asm.RegR8, types.Bool_Size, "1")
+    } else {
+        asm.MovRegVal(file, asm.RegR8, types.Bool_Size, "0")
+    }
+
+    CallFn(file, f)
+
+    state.asm.RestoreReg(file, asm.RegR8)
+    state.asm.RestoreReg(file, asm.RegC)
+    state.asm.RestoreReg(file, asm.RegD)
+    state.asm.RestoreReg(file, asm.RegSi)
+    state.asm.RestoreReg(file, asm.RegDi)
+}
+
+// the folded value as it ends up in a register of the expression's size
+func foldedVal(c constVal.ConstVal, size uint, signed bool) (string, bool) {
+    var v uint64
+    switch c := c.(type) {
+    case *constVal.IntConst:
+        v = uint64(*c)
+    case *constVal.UintConst:
+        v = uint64(*c)
+    case *constVal.CharConst:
+        v = uint64(*c)
+    case *constVal.BoolConst:
+        if bool(*c) { v = 1 }
+    default:
+        return "", false
+    }
+
+    if size < types.Ptr_Size {
+        bits := size * 8
+        v &= (uint64(1) << bits) - 1
+        if signed && v & (uint64(1) << (bits-1)) != 0 {
+            v |= ^uint64(0) << bits
+        }
+    }
+
+    return fmt.Sprint(v), true
+}
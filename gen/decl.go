@@ -1,80 +1,91 @@
 package gen
 
 import (
-    "os"
-    "fmt"
     "bufio"
     "reflect"
     "gamma/ast"
-    "gamma/ast/identObj"
     "gamma/ast/identObj/vars"
-    "gamma/cmpTime"
     "gamma/types"
     "gamma/types/addr"
     "gamma/gen/asm/x86_64"
-    "gamma/gen/asm/x86_64/loops"
-    "gamma/gen/asm/x86_64/vtable"
-    "gamma/gen/asm/x86_64/conditions"
 )
 
-func GenDecl(file *bufio.Writer, d ast.Decl) {
+func (state *State) GenDecl(file *bufio.Writer, d ast.Decl) {
     switch d := d.(type) {
     case *ast.Import:
-        GenImport(file, d)
+        state.GenImport(file, d)
 
     case *ast.DefVar:
-        GenDefVar(file, d)
+        state.GenDefVar(file, d)
 
     case *ast.DefFn:
+        if !state.reachable.Fn(d.FnHead.F) {
+            return
+        }
+
         if d.FnHead.F.IsGeneric() {
-            GenDefGenFn(file, d)
+            state.GenDefGenFn(file, d)
         } else {
-            GenDefFn(file, d)
+            state.GenDefFn(file, d)
         }
 
     case *ast.Impl:
-        GenImpl(file, d)
+        state.GenImpl(file, d)
+
+    case *ast.DecVar:
+        state.GenDecVar(d)
 
-    case *ast.DefStruct, *ast.DecVar, *ast.DefConst, *ast.DefInterface, *ast.DefEnum:
+    case *ast.DefStruct, *ast.DefConst, *ast.DefInterface, *ast.DefEnum:
         // nothing to generate
 
     case *ast.BadDecl:
-        fmt.Fprintln(os.Stderr, "[ERROR] bad declaration")
-        os.Exit(1)
+        state.diag.Error("bad declaration")
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] GenDecl for %v is not implemente yet\n", reflect.TypeOf(d))
-        os.Exit(1)
+        state.diag.Errorf("GenDecl for %v is not implemente yet", reflect.TypeOf(d))
+        state.diag.Exit()
     }
 }
 
-func GenImport(file *bufio.Writer, d *ast.Import) {
+func (state *State) GenImport(file *bufio.Writer, d *ast.Import) {
     for _, d := range d.Decls {
-        GenDecl(file, d)
+        state.GenDecl(file, d)
     }
 }
 
-func GenDefVar(file *bufio.Writer, d *ast.DefVar) {
+func (state *State) GenDefVar(file *bufio.Writer, d *ast.DefVar) {
     if v,ok := d.V.(*vars.LocalVar); ok {
-        v.SetOffset(identObj.GetStackSize(), false)
-        identObj.IncStackSize(v.GetType())
+        v.SetOffset(state.identObj.GetStackSize(), false)
+        state.identObj.IncStackSize(v.GetType())
     }
 
-    if val := cmpTime.ConstEval(d.Value); val != nil {
-        VarDefVal(file, d.V, val)
+    if val := state.cmpTime.ConstEval(d.Value); val != nil {
+        if !state.reachable.Var(d.V) {
+            return
+        }
+        state.VarDefVal(file, d.V, val)
     } else {
-        VarDefExpr(file, d.V, d.Value)
+        state.VarDefExpr(file, d.V, d.Value)
+    }
+}
+
+// only local vars can be declared without a value
+func (state *State) GenDecVar(d *ast.DecVar) {
+    if v,ok := d.V.(*vars.LocalVar); ok {
+        v.SetOffset(state.identObj.GetStackSize(), false)
+        state.identObj.IncStackSize(v.GetType())
     }
 }
 
-func GenDefGenFn(file *bufio.Writer, d *ast.DefFn) {
+func (state *State) GenDefGenFn(file *bufio.Writer, d *ast.DefFn) {
     for _,t := range d.FnHead.F.GetUsedInsetTypes() {
         d.FnHead.F.SetInsetType(t)
-        GenDefFn(file, d)
+        state.GenDefFn(file, d)
     }
 }
 
 
-func GenDefFn(file *bufio.Writer, d *ast.DefFn) {
+func (state *State) GenDefFn(file *bufio.Writer, d *ast.DefFn) {
     argsSize := d.FnHead.F.Scope.ArgsSize()
     innersize := d.FnHead.F.Scope.GetInnerSize()
     framesize := argsSize + innersize
@@ -123,41 +134,50 @@ func GenDefFn(file *bufio.Writer, d *ast.DefFn) {
                 }
             }
         } else {
-            fmt.Fprintln(os.Stderr, "[ERROR] (internal) expected arg to be local var")
-            os.Exit(1)
+            state.diag.Error("(internal) expected arg to be local var")
+            state.diag.Exit()
         }
     }
 
-    GenBlock(file, &d.Block)
+    if state.checkConsts && d.FnHead.F.GetName() == state.checkEntry {
+        state.genGlobalChecks(file)
+    }
+
+    state.GenBlock(file, &d.Block)
 
     if d.FnHead.F.GetRetType() == nil {
         FnEnd(file);
     }
 
-    cond.ResetCount()
-    loops.ResetCount()
-    identObj.ResetStackSize()
+    state.cond.ResetCount()
+    state.loops.ResetCount()
+    state.resetCheckCount()
+    state.identObj.ResetStackSize()
 }
 
-func createVTable(file *bufio.Writer, d *ast.Impl) {
-    vtable.Create(d.Impl.GetDstType(), d.Impl.GetInterfaceType(), d.Impl.GetVTableFuncNames())
+func (state *State) createVTable(file *bufio.Writer, d *ast.Impl) {
+    state.vtable.Create(d.Impl.GetDstType(), d.Impl.GetInterfaceType(), d.Impl.GetVTableFuncNames())
 }
 
-func GenImpl(file *bufio.Writer, d *ast.Impl) {
+func (state *State) GenImpl(file *bufio.Writer, d *ast.Impl) {
     if d.Impl.IsGeneric() {
         generic := d.Impl.GetGeneric()
         for _,t := range generic.UsedInsetTypes {
             d.Impl.SetInsetType(t)
-            genImpl(file, d)
+            state.genImpl(file, d)
         }
     } else {
-        genImpl(file, d)
+        state.genImpl(file, d)
     }
 }
 
-func genImpl(file *bufio.Writer, d *ast.Impl) {
-    createVTable(file, d)
+func (state *State) genImpl(file *bufio.Writer, d *ast.Impl) {
+    if state.reachable.VTable(&d.Impl) {
+        state.createVTable(file, d)
+    }
     for _,f := range d.FnDefs {
-        GenDefFn(file, &f)
+        if state.reachable.Fn(f.FnHead.F) {
+            state.GenDefFn(file, &f)
+        }
     }
 }
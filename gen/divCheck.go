@@ -0,0 +1,46 @@
+package gen
+
+import (
+    "fmt"
+    "bufio"
+    "strings"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/gen/asm/x86_64"
+)
+
+/*
+debug builds (-O0) check the divisor of / and % (const divisors are checked by the type checker)
+  * _div_zero (buildin.gma) reports the position and exits with 1 (instead of SIGFPE):
+    [DIV BY ZERO] <file>:<line>:<col>: divisor of <op> is 0
+*/
+
+// has to be called right before the div (src is the divisor)
+func (state *State) genDivisorCheck(file *bufio.Writer, e *ast.Binary, src string) {
+    if state.optLevel != O0 || (e.Operator.Type != token.Div && e.Operator.Type != token.Mod) {
+        return
+    }
+
+    f,ok := state.identObj.Get("_div_zero").(*identObj.Func)
+    if !ok {
+        return
+    }
+
+    state.checkCount++
+    file.WriteString(fmt.Sprintf("cmp %s, 0\n", src))
+    file.WriteString(fmt.Sprintf("jne .div%d\n", state.checkCount))
+
+    idx := state.str.Add(token.Token{ Type: token.Str, Str: DivZeroMsg(e.Operator) })
+    asm.MovRegVal(file, asm.RegDi, types.Ptr_Size, fmt.Sprintf("_str%d", idx))
+    asm.MovRegVal(file, asm.RegSi, types.U32_Size, fmt.Sprint(state.str.GetSize(idx)))
+    CallFn(file, f)
+
+    file.WriteString(fmt.Sprintf(".div%d:\n", state.checkCount))
+}
+
+// "<file>:<line>:<col>: divisor of <op> is 0" (as str literal)
+func DivZeroMsg(op token.Token) string {
+    return fmt.Sprintf("\"%s: divisor of %s is 0\"", strings.TrimPrefix(op.At(), "at: "), op.Str)
+}
@@ -6,62 +6,60 @@ import (
 	"gamma/ast"
 	"gamma/ast/identObj"
 	"gamma/ast/identObj/vars"
-	"gamma/cmpTime"
+	"gamma/buildin"
 	"gamma/cmpTime/constVal"
 	"gamma/gen/asm/x86_64"
 	"gamma/gen/asm/x86_64/conditions"
 	"gamma/token"
 	"gamma/types"
 	"gamma/types/addr"
-	"gamma/types/str"
-	"os"
 	"reflect"
 )
 
 // TODO vister pattern
-func ExprAddrToReg(file *bufio.Writer, e ast.Expr, reg asm.RegGroup) {
+func (state *State) ExprAddrToReg(file *bufio.Writer, e ast.Expr, reg asm.RegGroup) {
     switch e := e.(type) {
     case *ast.Ident:
         asm.Lea(file, reg, e.Obj.Addr().String(), types.Ptr_Size)
 
     case *ast.FnCall:
-        FnCallAddrToReg(file, e, reg)
+        state.FnCallAddrToReg(file, e, reg)
 
     case *ast.Indexed:
-        IndexedAddrToReg(file, e, reg)
+        state.IndexedAddrToReg(file, e, reg)
 
     case *ast.Field:
-        FieldAddrToReg(file, e, reg)
+        state.FieldAddrToReg(file, e, reg)
 
     case *ast.Unary:
-        UnaryAddrToReg(file, e, reg)
+        state.UnaryAddrToReg(file, e, reg)
 
     case *ast.XSwitch:
-        XSwitchAddrToReg(file, e, reg)
+        state.XSwitchAddrToReg(file, e, reg)
 
     case *ast.Paren:
-        ExprAddrToReg(file, e.Expr, reg)
+        state.ExprAddrToReg(file, e.Expr, reg)
 
     case *ast.Cast:
-        ExprAddrToReg(file, e.Expr, reg)
+        state.ExprAddrToReg(file, e.Expr, reg)
 
     case *ast.IntLit, *ast.CharLit, *ast.BoolLit, *ast.PtrLit, *ast.StrLit, *ast.ArrayLit, *ast.StructLit, *ast.Binary:
-        fmt.Fprintf(os.Stderr, "[ERROR] cannot get address from %v\n", reflect.TypeOf(e))
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("cannot get address from %v", reflect.TypeOf(e))
+        state.diag.At(e.At())
+        state.diag.Exit()
     case *ast.BadExpr:
-        fmt.Fprintln(os.Stderr, "[ERROR] bad expression")
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Error("bad expression")
+        state.diag.At(e.At())
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] ExprAddrToReg for %v is not implemente yet\n", reflect.TypeOf(e))
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("ExprAddrToReg for %v is not implemente yet", reflect.TypeOf(e))
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 }
 
 // TODO to a specific reg
-func GenExpr(file *bufio.Writer, e ast.Expr) {
+func (state *State) GenExpr(file *bufio.Writer, e ast.Expr) {
     switch e := e.(type) {
     case *ast.IntLit:
         GenIntLit(file, e)
@@ -73,57 +71,61 @@ func GenExpr(file *bufio.Writer, e ast.Expr) {
         GenPtrLit(file, e)
 
     case *ast.StrLit:
-        GenStrLit(file, e)
+        state.GenStrLit(file, e)
     case *ast.ArrayLit:
         GenArrayLit(file, e)
     case *ast.StructLit:
-        GenStructLit(file, e)
+        state.GenStructLit(file, e)
     case *ast.EnumLit:
-        GenEnumLit(file, e)
+        state.GenEnumLit(file, e)
 
     case *ast.Indexed:
-        GenIndexed(file, e)
+        state.GenIndexed(file, e)
     case *ast.Field:
-        GenField(file, e)
+        state.GenField(file, e)
 
     case *ast.Ident:
-        GenIdent(file, e, e.GetType())
+        state.GenIdent(file, e, e.GetType())
 
     case *ast.FnCall:
-        asm.SaveReg(file, asm.RegC)
+        state.asm.SaveReg(file, asm.RegC)
         switch e.Ident.Name {
         case "_syscall":
-            GenSyscall(file, e.Values[0])
+            state.GenSyscall(file, e.Values[0])
         case "_asm":
-            GenInlineAsm(file, e.Values[0])
+            state.GenInlineAsm(file, e.Values[0])
         case "fmt":
-            GenFmt(file, e.Values)
+            state.GenFmt(file, e.Values)
         case "sizeof":
             GenSizeof(file, e)
         default:
-            GenFnCall(file, e)
+            if buildin.IsArith(e.Ident.Name) {
+                state.GenArithBuildIn(file, e)
+            } else {
+                state.GenFnCall(file, e)
+            }
         }
-        asm.RestoreReg(file, asm.RegC)
+        state.asm.RestoreReg(file, asm.RegC)
 
     case *ast.Unary:
-        GenUnary(file, e)
+        state.GenUnary(file, e)
     case *ast.Binary:
-        GenBinary(file, e)
+        state.GenBinary(file, e)
     case *ast.Paren:
-        GenParen(file, e)
+        state.GenParen(file, e)
 
     case *ast.XSwitch:
-        GenXSwitch(file, e)
+        state.GenXSwitch(file, e)
 
     case *ast.Cast:
-        GenExpr(file, e.Expr)
+        state.GenExpr(file, e.Expr)
 
     case *ast.BadExpr:
-        fmt.Fprintln(os.Stderr, "[ERROR] bad expression")
-        os.Exit(1)
+        state.diag.Error("bad expression")
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] GenExpr for %v is not implemente yet\n", reflect.TypeOf(e))
-        os.Exit(1)
+        state.diag.Errorf("GenExpr for %v is not implemente yet", reflect.TypeOf(e))
+        state.diag.Exit()
     }
 }
 
@@ -151,31 +153,41 @@ func GenBoolLit(file *bufio.Writer, e *ast.BoolLit) {
     }
 }
 
-func GenStrLit(file *bufio.Writer, e *ast.StrLit) {
+func (state *State) GenStrLit(file *bufio.Writer, e *ast.StrLit) {
     asm.MovRegVal(file, asm.RegA, types.Ptr_Size, fmt.Sprintf("_str%d", e.Idx))
-    asm.MovRegVal(file, asm.RegD, types.I32_Size, fmt.Sprintf("%d", str.GetSize(e.Idx)))
+    asm.MovRegVal(file, asm.RegD, types.I32_Size, fmt.Sprintf("%d", state.str.GetSize(e.Idx)))
 }
 
-func GenStructLit(file *bufio.Writer, e *ast.StructLit) {
+func (state *State) GenStructLit(file *bufio.Writer, e *ast.StructLit) {
     if len(e.StructType.Types) != 0 && !types.IsBigStruct(e.StructType) {
-        if c,ok := cmpTime.ConstEvalStructLit(e).(*constVal.StructConst); ok {
-            vs := PackValues(e.StructType.Types, c.Fields)
+        if c,ok := state.cmpTime.ConstEvalStructLit(e).(*constVal.StructConst); ok {
+            vs := state.PackValues(e.StructType.Types, c.Fields)
             asm.MovRegVal(file, asm.RegA, types.Ptr_Size, vs[0])
             if len(vs) == 2 {
                 asm.MovRegVal(file, asm.RegD, e.StructType.Size() - 8, vs[1])
             }
         } else {
-            PackFields(file, e.StructType, e.Fields)
+            state.PackFields(file, e.StructType, e.Fields)
         }
     }
 }
 
-func GenEnumLit(file *bufio.Writer, e *ast.EnumLit) {
+func (state *State) GenEnumLit(file *bufio.Writer, e *ast.EnumLit) {
+    // niche enums are only the pointer (or 0)
+    if e.Type.IsNiche() {
+        if e.Content == nil {
+            asm.MovRegVal(file, asm.RegA, types.Ptr_Size, "0")
+        } else {
+            state.GenExpr(file, e.Content)
+        }
+        return
+    }
+
     id := e.Type.GetElemID(e.ElemName.Str)
     if e.Content == nil {
         asm.MovRegVal(file, asm.RegA, e.Type.Size(), fmt.Sprint(id))
     } else {
-        GenExpr(file, e.Content)
+        state.GenExpr(file, e.Content)
         asm.MovRegReg(file, asm.RegD, asm.RegA, e.ContentType.Size())
         asm.MovRegVal(file, asm.RegA, e.Type.IdType.Size(), fmt.Sprint(id))
     }
@@ -185,32 +197,32 @@ func GenArrayLit(file *bufio.Writer, e *ast.ArrayLit) {
     asm.MovRegVal(file, asm.RegA, types.Ptr_Size, fmt.Sprintf("_arr%d", e.Idx))
 }
 
-func indexedBaseAddrToReg(file *bufio.Writer, e *ast.Indexed) {
+func (state *State) indexedBaseAddrToReg(file *bufio.Writer, e *ast.Indexed) {
     if indexed,ok := e.ArrExpr.(*ast.Indexed); ok {
-        indexedBaseAddrToReg(file, indexed)
+        state.indexedBaseAddrToReg(file, indexed)
     } else {
-        GenExpr(file, e.ArrExpr)
+        state.GenExpr(file, e.ArrExpr)
     }
 }
 
-func IndexedAddrToReg(file *bufio.Writer, e *ast.Indexed, r asm.RegGroup) {
+func (state *State) IndexedAddrToReg(file *bufio.Writer, e *ast.Indexed, r asm.RegGroup) {
     baseTypeSize := uint64(e.Type.Size())
     idxExpr := e.Index
 
     switch e.ArrType.GetKind() {
     case types.Arr:
-        indexedBaseAddrToReg(file, e)
+        state.indexedBaseAddrToReg(file, e)
         idxExpr = e.Flatten()
 
     case types.Vec:
-        GenExpr(file, e.ArrExpr)
+        state.GenExpr(file, e.ArrExpr)
     }
 
-    if idx,ok := cmpTime.ConstEvalUint(idxExpr); ok {
+    if idx,ok := state.cmpTime.ConstEvalUint(idxExpr); ok {
         file.WriteString(fmt.Sprintf("lea %s, [rax+%d]\n", asm.GetReg(r, types.Ptr_Size), idx * baseTypeSize))
     } else {
         asm.MovRegReg(file, asm.RegD, asm.RegA, types.Ptr_Size)
-        GenExpr(file, idxExpr)
+        state.GenExpr(file, idxExpr)
 
         asm.Mul(file, fmt.Sprint(baseTypeSize), types.Ptr_Size, false)
         asm.Add(file, asm.GetReg(asm.RegD, types.Ptr_Size), types.Ptr_Size)
@@ -221,8 +233,8 @@ func IndexedAddrToReg(file *bufio.Writer, e *ast.Indexed, r asm.RegGroup) {
     }
 }
 
-func GenIndexed(file *bufio.Writer, e *ast.Indexed) {
-    IndexedAddrToReg(file, e, asm.RegA)
+func (state *State) GenIndexed(file *bufio.Writer, e *ast.Indexed) {
+    state.IndexedAddrToReg(file, e, asm.RegA)
     addr := asm.RegAsAddr(asm.RegA)
 
     switch t := e.Type.(type) {
@@ -246,41 +258,41 @@ func GenIndexed(file *bufio.Writer, e *ast.Indexed) {
     }
 }
 
-func FieldAddrToReg(file *bufio.Writer, e *ast.Field, r asm.RegGroup) {
-    fieldAddrToReg(file, e, r, e.ToOffset())
+func (state *State) FieldAddrToReg(file *bufio.Writer, e *ast.Field, r asm.RegGroup) {
+    state.fieldAddrToReg(file, e, r, e.ToOffset())
 }
 
-func fieldAddrToReg(file *bufio.Writer, e *ast.Field, r asm.RegGroup, offset int64) {
+func (state *State) fieldAddrToReg(file *bufio.Writer, e *ast.Field, r asm.RegGroup, offset int64) {
     switch obj := e.Obj.(type) {
     case *ast.Ident:
         asm.Lea(file, r, obj.Obj.Addr().Offseted(offset).String(), types.Ptr_Size)
 
     case *ast.Field:
-        fieldAddrToReg(file, obj, r, offset)
+        state.fieldAddrToReg(file, obj, r, offset)
 
     default:
-        ExprAddrToReg(file, e.Obj, r)
+        state.ExprAddrToReg(file, e.Obj, r)
         if offset != 0 {
             asm.Lea(file, r, asm.RegAsAddr(r).Offseted(offset).String(), types.Ptr_Size)
         }
     }
 }
 
-func GenField(file *bufio.Writer, e *ast.Field) {
+func (state *State) GenField(file *bufio.Writer, e *ast.Field) {
     switch t := e.Obj.GetType().(type) {
     case types.ArrType:
         asm.MovRegVal(file, asm.RegA, types.Ptr_Size, fmt.Sprint(t.Len))
 
     case types.VecType:
-        FieldAddrToReg(file, e, asm.RegA)
+        state.FieldAddrToReg(file, e, asm.RegA)
         asm.MovRegDeref(file, asm.RegA, asm.RegAsAddr(asm.RegA), types.U64_Size, false)
 
     case types.StrType:
-        FieldAddrToReg(file, e, asm.RegA)
+        state.FieldAddrToReg(file, e, asm.RegA)
         asm.MovRegDeref(file, asm.RegA, asm.RegAsAddr(asm.RegA), types.U32_Size, false)
 
     case types.StructType:
-        FieldAddrToReg(file, e, asm.RegA)
+        state.FieldAddrToReg(file, e, asm.RegA)
         addr := asm.RegAsAddr(asm.RegA)
 
         switch t := e.Type.(type) {
@@ -308,15 +320,15 @@ func GenField(file *bufio.Writer, e *ast.Field) {
         }
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] %v has no fields\n", t)
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("%v has no fields", t)
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 }
 
-func GenIdent(file *bufio.Writer, e *ast.Ident, t types.Type) {
+func (state *State) GenIdent(file *bufio.Writer, e *ast.Ident, t types.Type) {
     if c,ok := e.Obj.(*identObj.Const); ok {
-        GenConstVal(file, t, c.GetVal())
+        state.GenConstVal(file, t, c.GetVal())
         return
     }
 
@@ -345,9 +357,9 @@ func GenIdent(file *bufio.Writer, e *ast.Ident, t types.Type) {
             asm.MovRegDeref(file, asm.RegA, v.Addr(), t.Size(), false)
 
         case types.GenericType:
-            GenIdent(file, e, types.ResolveGeneric(t))
+            state.GenIdent(file, e, types.ResolveGeneric(t))
         case *types.GenericType:
-            GenIdent(file, e, types.ResolveGeneric(t))
+            state.GenIdent(file, e, types.ResolveGeneric(t))
 
         default:
             asm.MovRegDeref(file, asm.RegA, v.Addr(), t.Size(), false)
@@ -356,57 +368,63 @@ func GenIdent(file *bufio.Writer, e *ast.Ident, t types.Type) {
     }
 
     if _,ok := e.Obj.(*identObj.Func); ok {
-        fmt.Fprintf(os.Stderr, "[ERROR] TODO: expr.go compile Ident for functions\n")
-        os.Exit(1)
+        state.diag.Error("TODO: expr.go compile Ident for functions")
+        state.diag.Exit()
         return
     }
 
-    fmt.Fprintf(os.Stderr, "[ERROR] \"%s\" is not declared\n", e.Name)
-    fmt.Fprintln(os.Stderr, "\t" + e.Pos.At())
-    os.Exit(1)
+    state.diag.Errorf("\"%s\" is not declared", e.Name)
+    state.diag.At(e.Pos.At())
+    state.diag.Exit()
 }
 
-func GenParen(file *bufio.Writer, e *ast.Paren) {
-    GenExpr(file, e.Expr)
+func (state *State) GenParen(file *bufio.Writer, e *ast.Paren) {
+    state.GenExpr(file, e.Expr)
 }
 
-func UnaryAddrToReg(file *bufio.Writer, e *ast.Unary, reg asm.RegGroup) {
+func (state *State) UnaryAddrToReg(file *bufio.Writer, e *ast.Unary, reg asm.RegGroup) {
     if e.Operator.Type != token.Mul {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"*\" but got \"%v\"\n", e.Operator)
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"*\" but got \"%v\"", e.Operator)
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 
-    GenExpr(file, e.Operand)
+    state.GenExpr(file, e.Operand)
     if reg != asm.RegA {
         asm.MovRegReg(file, reg, asm.RegA, types.Ptr_Size)
     }
 }
 
-func GenUnary(file *bufio.Writer, e *ast.Unary) {
-    if c := cmpTime.ConstEval(e); c != nil {
-        GenConstVal(file, e.Operand.GetType(), c)
+func (state *State) GenUnary(file *bufio.Writer, e *ast.Unary) {
+    if c := state.cmpTime.ConstEval(e); c != nil && !state.runtimeOnly {
+        state.GenConstVal(file, e.Operand.GetType(), c)
         return
     }
 
     switch e.Operator.Type {
     case token.Amp:
-        ExprAddrToReg(file, e.Operand, asm.RegA)
+        state.ExprAddrToReg(file, e.Operand, asm.RegA)
 
     case token.Minus:
-        GenExpr(file, e.Operand)
-        asm.Neg(file, e.Operand.GetType().Size())
+        state.GenExpr(file, e.Operand)
+        t := types.ResolveGeneric(e.Operand.GetType())
+        if state.checkOverflow && isSmallInt(t) {
+            asm.MovRegRegExtend(file, asm.RegA, types.I32_Size, asm.RegA, t.Size(), t.GetKind() == types.Int)
+        }
+        asm.Neg(file, t.Size())
+        state.genOverflowCheck(file, t, e.Operator, true)
 
     case token.BitNot:
-        GenExpr(file, e.Operand)
+        state.GenExpr(file, e.Operand)
         asm.Not(file, e.Operand.GetType().Size())
 
     case token.Mul:
-        GenExpr(file, e.Operand)
+        state.GenExpr(file, e.Operand)
         t := e.GetType()
         if t.Size() > 8 {
-            if t.GetKind() == types.Str {
-                asm.MovRegDeref(file, asm.RegD, asm.RegAsAddr(asm.RegA).Offseted(int64(types.Ptr_Size)), types.U32_Size, false)
+            // the second part of str, struct, ... (not for big structs)
+            if !types.IsBigStruct(t) {
+                asm.MovRegDeref(file, asm.RegD, asm.RegAsAddr(asm.RegA).Offseted(int64(types.Ptr_Size)), t.Size() - 8, false)
             }
             asm.DerefRax(file, types.Ptr_Size, false)
         } else {
@@ -415,57 +433,57 @@ func GenUnary(file *bufio.Writer, e *ast.Unary) {
     }
 }
 
-func GenCmpStrs(file *bufio.Writer, e *ast.Binary) {
-    if c,ok := cmpTime.ConstEval(e.OperandL).(*constVal.StrConst); ok {
-        GenExpr(file, e.OperandR)
-        asm.BinaryOpStrsLit(file, e.Operator.Type, uint64(*c))
+func (state *State) GenCmpStrs(file *bufio.Writer, e *ast.Binary) {
+    if c,ok := state.cmpTime.ConstEval(e.OperandL).(*constVal.StrConst); ok {
+        state.GenExpr(file, e.OperandR)
+        state.asm.BinaryOpStrsLit(file, e.Operator.Type, uint64(*c))
 
-    } else if c,ok := cmpTime.ConstEval(e.OperandR).(*constVal.StrConst); ok {
-        GenExpr(file, e.OperandL)
-        asm.BinaryOpStrsLit(file, e.Operator.Type, uint64(*c))
+    } else if c,ok := state.cmpTime.ConstEval(e.OperandR).(*constVal.StrConst); ok {
+        state.GenExpr(file, e.OperandL)
+        state.asm.BinaryOpStrsLit(file, e.Operator.Type, uint64(*c))
 
     } else {
-        GenExpr(file, e.OperandR)
+        state.GenExpr(file, e.OperandR)
         asm.MovRegReg(file, asm.RegB, asm.RegA, types.Ptr_Size)
         asm.MovRegReg(file, asm.RegC, asm.RegD, types.U32_Size)
 
-        GenExpr(file, e.OperandL)
-        asm.BinaryOpStrs(file, e.Operator.Type)
+        state.GenExpr(file, e.OperandL)
+        state.asm.BinaryOpStrs(file, e.Operator.Type)
     }
 }
 
-func GenConcatStrs(file *bufio.Writer, e *ast.Binary) {
-    if c,ok := cmpTime.ConstEval(e.OperandL).(*constVal.StrConst); ok {
-        GenExpr(file, e.OperandR)
+func (state *State) GenConcatStrs(file *bufio.Writer, e *ast.Binary) {
+    if c,ok := state.cmpTime.ConstEval(e.OperandL).(*constVal.StrConst); ok {
+        state.GenExpr(file, e.OperandR)
         asm.MovRegReg(file, asm.RegB, asm.RegA, types.Ptr_Size)
         asm.MovRegReg(file, asm.RegC, asm.RegD, types.U32_Size)
 
         asm.MovRegVal(file, asm.RegA, types.Ptr_Size, fmt.Sprintf("_str%d", uint64(*c)))
-        asm.MovRegVal(file, asm.RegD, types.U32_Size, fmt.Sprint(str.GetSize(uint64(*c))))
+        asm.MovRegVal(file, asm.RegD, types.U32_Size, fmt.Sprint(state.str.GetSize(uint64(*c))))
 
-        asm.BinaryOpStrs(file, token.Plus)
+        state.asm.BinaryOpStrs(file, token.Plus)
 
-    } else if c,ok := cmpTime.ConstEval(e.OperandR).(*constVal.StrConst); ok {
-        GenExpr(file, e.OperandL)
-        asm.BinaryOpStrsLit(file, e.Operator.Type, uint64(*c))
+    } else if c,ok := state.cmpTime.ConstEval(e.OperandR).(*constVal.StrConst); ok {
+        state.GenExpr(file, e.OperandL)
+        state.asm.BinaryOpStrsLit(file, e.Operator.Type, uint64(*c))
 
     } else {
-        GenExpr(file, e.OperandL)
+        state.GenExpr(file, e.OperandL)
 
         asm.PushReg(file, asm.RegA)
         asm.PushReg(file, asm.RegD)
-        GenExpr(file, e.OperandR)
+        state.GenExpr(file, e.OperandR)
         asm.MovRegReg(file, asm.RegB, asm.RegA, types.Ptr_Size)
         asm.MovRegReg(file, asm.RegC, asm.RegD, types.U32_Size)
         asm.PopReg(file, asm.RegD)
         asm.PopReg(file, asm.RegA)
 
-        asm.BinaryOpStrs(file, token.Plus)
+        state.asm.BinaryOpStrs(file, token.Plus)
     }
 }
 
-func GenLogical(file *bufio.Writer, e *ast.Binary) {
-    if b,ok := cmpTime.ConstEval(e.OperandL).(*constVal.BoolConst); ok {
+func (state *State) GenLogical(file *bufio.Writer, e *ast.Binary) {
+    if b,ok := state.cmpTime.ConstEval(e.OperandL).(*constVal.BoolConst); ok {
         if e.Operator.Type == token.And && !bool(*b) {
             asm.MovRegVal(file, asm.RegA, types.Bool_Size, "0")
             return
@@ -475,26 +493,37 @@ func GenLogical(file *bufio.Writer, e *ast.Binary) {
             return
         }
 
-        GenExpr(file, e.OperandR)
+        state.GenExpr(file, e.OperandR)
     } else {
-        GenExpr(file, e.OperandL)
+        state.GenExpr(file, e.OperandL)
 
-        count := cond.LogicalOp(file, e.Operator)
-        GenExpr(file, e.OperandR)
+        count := state.cond.LogicalOp(file, e.Operator)
+        state.GenExpr(file, e.OperandR)
         cond.LogicalOpEnd(file, count)
     }
 }
 
-func GenArith(file *bufio.Writer, e *ast.Binary) {
-    if c := cmpTime.ConstEval(e.OperandL); c != nil {
-        GenConstVal(file, e.OperandR.GetType(), c)
+func (state *State) GenArith(file *bufio.Writer, e *ast.Binary) {
+    state.genArith(file, e, state.checkOverflow && isOverflowOp(e.Operator.Type))
+}
+
+// exact: 8/16bit operands are extended to 32bit (the result is exact in eax, see genOverflowCheck)
+func (state *State) genArith(file *bufio.Writer, e *ast.Binary, exact bool) {
+    t := types.ResolveGeneric(e.GetType())
+    exact = exact && isSmallInt(t)
+
+    if c := state.cmpTime.ConstEval(e.OperandL); c != nil {
+        state.GenConstVal(file, e.OperandR.GetType(), c)
     } else {
-        GenExpr(file, e.OperandL)
+        state.GenExpr(file, e.OperandL)
+    }
+    if exact {
+        asm.MovRegRegExtend(file, asm.RegA, types.I32_Size, asm.RegA, t.Size(), t.GetKind() == types.Int)
+    }
 
-        if c := cmpTime.ConstEval(e.OperandR); c != nil {
-            asm.BinaryOp(file, e.Operator.Type, c.GetVal(), e.OperandL.GetType())
-            return
-        }
+    if c := state.cmpTime.ConstEval(e.OperandR); c != nil {
+        state.asm.BinaryOp(file, e.Operator.Type, c.GetVal(), e.OperandL.GetType())
+        return
     }
 
     if ident,ok := e.OperandR.(*ast.Ident); ok {
@@ -502,72 +531,103 @@ func GenArith(file *bufio.Writer, e *ast.Binary) {
             t := v.GetType()
             if t.Size() < types.I32_Size {
                 asm.MovRegDerefExtend(file, asm.RegB, types.I32_Size, v.Addr(), t.Size(), t.GetKind() == types.Int)
-                asm.BinaryOpReg(file, e.Operator.Type, asm.RegB, t)
+                state.genDivisorCheck(file, e, asm.GetReg(asm.RegB, t.Size()))
+                state.asm.BinaryOpReg(file, e.Operator.Type, asm.RegB, t)
             } else {
-                asm.BinaryOp(file, e.Operator.Type, fmt.Sprintf("%s [%s]", asm.GetWord(t.Size()), v.Addr().String()), t)
+                src := fmt.Sprintf("%s [%s]", asm.GetWord(t.Size()), v.Addr().String())
+                state.genDivisorCheck(file, e, src)
+                state.asm.BinaryOp(file, e.Operator.Type, src, t)
             }
         }
     } else {
         asm.PushReg(file, asm.RegA)
 
-        GenExpr(file, e.OperandR)
-        asm.MovRegReg(file, asm.RegB, asm.RegA, e.OperandR.GetType().Size())
+        state.GenExpr(file, e.OperandR)
+        if exact {
+            asm.MovRegRegExtend(file, asm.RegB, types.I32_Size, asm.RegA, t.Size(), t.GetKind() == types.Int)
+        } else {
+            asm.MovRegReg(file, asm.RegB, asm.RegA, e.OperandR.GetType().Size())
+        }
 
         asm.PopReg(file, asm.RegA)
-        asm.BinaryOpReg(file, e.Operator.Type, asm.RegB, e.OperandR.GetType())
+        state.genDivisorCheck(file, e, asm.GetReg(asm.RegB, e.OperandR.GetType().Size()))
+        state.asm.BinaryOpReg(file, e.Operator.Type, asm.RegB, e.OperandR.GetType())
     }
 }
 
-func GenBinary(file *bufio.Writer, e *ast.Binary) {
-    if c := cmpTime.ConstEval(e); c != nil {
-        GenConstVal(file, e.GetType(), c)
+func (state *State) GenBinary(file *bufio.Writer, e *ast.Binary) {
+    if c := state.cmpTime.ConstEval(e); c != nil && !state.runtimeOnly {
+        state.GenConstVal(file, e.GetType(), c)
         return
     }
 
     if e.OperandL.GetType().GetKind() == types.Str {
         if e.Operator.Type == token.Plus {
-            GenConcatStrs(file, e)
+            state.GenConcatStrs(file, e)
         } else {
-            GenCmpStrs(file, e)
+            state.GenCmpStrs(file, e)
         }
+    } else if t,ok := types.ResolveGeneric(e.OperandL.GetType()).(types.EnumType); ok && t.IsNiche() {
+        state.genCmpNiche(file, e)
     } else {
         if e.Operator.Type == token.And || e.Operator.Type == token.Or {
-            GenLogical(file, e)
+            state.GenLogical(file, e)
         } else {
-            GenArith(file, e)
+            state.GenArith(file, e)
+            if isOverflowOp(e.Operator.Type) {
+                state.genOverflowCheck(file, e.GetType(), e.Operator, false)
+            }
         }
     }
 }
 
-func getVtableOffset(fnSrc types.Type, pos token.Pos, funcName string) uint {
+// compares the ids of niche enums (pointer == 0 on both sides, not the pointers)
+func (state *State) genCmpNiche(file *bufio.Writer, e *ast.Binary) {
+    state.GenExpr(file, e.OperandL)
+    asm.Eql(file, asm.GetReg(asm.RegA, types.Ptr_Size), "0")
+    asm.PushReg(file, asm.RegA)
+
+    state.GenExpr(file, e.OperandR)
+    asm.Eql(file, asm.GetReg(asm.RegA, types.Ptr_Size), "0")
+    asm.MovRegReg(file, asm.RegB, asm.RegA, types.Bool_Size)
+    asm.PopReg(file, asm.RegA)
+
+    if e.Operator.Type == token.Eql {
+        asm.Eql(file, asm.GetAnyReg(asm.RegA, types.Bool_Size), asm.GetAnyReg(asm.RegB, types.Bool_Size))
+    } else {
+        asm.Neq(file, asm.GetAnyReg(asm.RegA, types.Bool_Size), asm.GetAnyReg(asm.RegB, types.Bool_Size))
+    }
+}
+
+func (state *State) getVtableOffset(fnSrc types.Type, pos token.Pos, funcName string) uint {
     if interfaceType,ok := fnSrc.(types.InterfaceType); ok {
-        if i,ok := identObj.Get(interfaceType.Name).(*identObj.Interface); ok {
+        if i,ok := state.identObj.Get(interfaceType.Name).(*identObj.Interface); ok {
             return i.GetVTableOffset(funcName)
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] interface %v is not defined\n", interfaceType.Name)
-            fmt.Fprintln(os.Stderr, "\t" + pos.At())
-            os.Exit(1)
+            state.diag.Errorf("interface %v is not defined", interfaceType.Name)
+            state.diag.At(pos.At())
+            state.diag.Exit()
         }
 
     } else {
-        fmt.Fprintf(os.Stderr, "[ERROR] (internal) expected interface type but got %v\n", reflect.TypeOf(fnSrc))
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+        state.diag.Errorf("(internal) expected interface type but got %v", reflect.TypeOf(fnSrc))
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
     return 0
 }
 
-func FnCallAddrToReg(file *bufio.Writer, e *ast.FnCall, reg asm.RegGroup) {
+func (state *State) FnCallAddrToReg(file *bufio.Writer, e *ast.FnCall, reg asm.RegGroup) {
     if types.IsBigStruct(e.GetType()) {
-        identObj.AllocReservedSpaceIfNeeded(e.GetType(), e.ResvSpace)
+        state.identObj.AllocReservedSpaceIfNeeded(e.GetType(), e.ResvSpace)
 
         asm.Lea(file, asm.RegDi, e.ResvSpace.String(), types.Ptr_Size)
-        GenExpr(file, e)
+        state.GenExpr(file, e)
         asm.Lea(file, reg, e.ResvSpace.String(), types.Ptr_Size)
     } else {
-        fmt.Fprintln(os.Stderr, "[ERROR] TODO in work (expr.go FnCallAddrToReg)")
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Error("TODO in work (expr.go FnCallAddrToReg)")
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 }
 
@@ -586,10 +646,10 @@ func resolveInterfaceFnSrc(e *ast.FnCall) *ast.FnCall {
     return e
 }
 
-func GenFnCall(file *bufio.Writer, e *ast.FnCall) {
+func (state *State) GenFnCall(file *bufio.Writer, e *ast.FnCall) {
     e = resolveInterfaceFnSrc(e)
 
-    passArgs := createPassArgs(e.F, e.Values)
+    passArgs := state.createPassArgs(e.F, e.Values)
 
     passArgs.genAlignStack(file)
 
@@ -598,8 +658,8 @@ func GenFnCall(file *bufio.Writer, e *ast.FnCall) {
     passArgs.genPassArgsReg(file)
 
     if e.FnSrc != nil && e.FnSrc.GetKind() == types.Interface && passArgs.regArgs[0].typ.GetKind() == types.Interface {
-        offset := getVtableOffset(e.FnSrc, e.Ident.Pos, e.F.GetName())
-        GenExpr(file, passArgs.regArgs[0].value)
+        offset := state.getVtableOffset(e.FnSrc, e.Ident.Pos, e.F.GetName())
+        state.GenExpr(file, passArgs.regArgs[0].value)
         CallVTableFn(file, offset)
     } else {
         CallFn(file, e.F)
@@ -608,60 +668,67 @@ func GenFnCall(file *bufio.Writer, e *ast.FnCall) {
     passArgs.genClearStack(file)
 }
 
-func GenXCase(file *bufio.Writer, e *ast.XCase) {
+func (state *State) GenXCase(file *bufio.Writer, e *ast.XCase) {
     if e.Cond == nil {
-        cond.CaseStart(file)
-        cond.CaseBody(file)
-        GenExpr(file, e.Expr)
+        state.cond.CaseStart(file)
+        state.cond.CaseBody(file)
+        state.GenExpr(file, e.Expr)
         return
     }
 
-    if val,ok := cmpTime.ConstEval(e.Cond).(*constVal.BoolConst); ok {
+    if val,ok := state.cmpTime.ConstEval(e.Cond).(*constVal.BoolConst); ok {
         if bool(*val) {
-            cond.CaseStart(file)
-            cond.CaseBody(file)
-            GenExpr(file, e.Expr)
-            cond.CaseBodyEnd(file)
+            state.cond.CaseStart(file)
+            state.cond.CaseBody(file)
+            state.GenExpr(file, e.Expr)
+            state.cond.CaseBodyEnd(file)
         }
 
         return
     }
 
-    GenCaseCond(file, e.Cond)
+    state.GenCaseCond(file, e.Cond)
 
-    cond.CaseBody(file)
-    GenExpr(file, e.Expr)
-    cond.CaseBodyEnd(file)
+    state.cond.CaseBody(file)
+    state.GenExpr(file, e.Expr)
+    state.cond.CaseBodyEnd(file)
 }
 
-func GenXSwitch(file *bufio.Writer, e *ast.XSwitch) {
-    if c := cmpTime.ConstEval(e); c != nil {
-        GenConstVal(file, e.GetType(), c)
+func (state *State) GenXSwitch(file *bufio.Writer, e *ast.XSwitch) {
+    if c := state.cmpTime.ConstEval(e); c != nil && !state.runtimeOnly {
+        state.GenConstVal(file, e.GetType(), c)
         return
     }
 
-    cond.StartSwitch()
+    state.cond.StartSwitch()
+
+    if d := state.getDispatch(xcasesConds(e.Cases)); d != nil {
+        state.genDispatch(file, d)
+        state.genDispatchedCases(file, len(e.Cases), func(i int) { state.GenExpr(file, e.Cases[i].Expr) })
+        state.cond.EndSwitch(file)
+        return
+    }
 
     for i := 0; i < len(e.Cases)-1; i++ {
-        GenXCase(file, &e.Cases[i])
+        state.GenXCase(file, &e.Cases[i])
     }
-    cond.InLastCase()
-    GenXCase(file, &e.Cases[len(e.Cases)-1])
+    state.cond.InLastCase()
+    state.GenXCase(file, &e.Cases[len(e.Cases)-1])
 
-    cond.EndSwitch(file)
+    state.cond.EndSwitch(file)
 }
 
 
 
-func DerefSetBigStruct(file *bufio.Writer, address addr.Addr, e ast.Expr) {
+func (state *State) DerefSetBigStruct(file *bufio.Writer, address addr.Addr, e ast.Expr) {
     switch e := e.(type) {
     case *ast.StructLit:
         a := addr.Addr{ BaseAddr: address.BaseAddr, Offset: address.Offset }
         for i,f := range e.Fields {
-            if c := cmpTime.ConstEval(f.Value); c != nil {
-                DerefSetVal(file, a, e.StructType.Types[i], c)
+            if c := state.cmpTime.ConstEval(f.Value); c != nil {
+                state.DerefSetVal(file, a, e.StructType.Types[i], c)
             } else {
-                DerefSetExpr(file, a, e.StructType.Types[i], f.Value)
+                state.DerefSetExpr(file, a, e.StructType.Types[i], f.Value)
             }
             a.Offset += int64(e.StructType.Types[i].Size())
         }
@@ -669,19 +736,19 @@ func DerefSetBigStruct(file *bufio.Writer, address addr.Addr, e ast.Expr) {
     case *ast.EnumLit:
         asm.MovDerefVal(file, address, e.Type.IdType.Size(), fmt.Sprint(e.Type.GetElemID(e.ElemName.Str)))
         if e.Content != nil {
-            if c := cmpTime.ConstEval(e.Content); c != nil {
-                DerefSetVal(file, address.Offseted(int64(e.Type.IdType.Size())), e.ContentType, c)
+            if c := state.cmpTime.ConstEval(e.Content); c != nil {
+                state.DerefSetVal(file, address.Offseted(int64(e.Type.IdType.Size())), e.ContentType, c)
             } else {
-                DerefSetExpr(file, address.Offseted(int64(e.Type.IdType.Size())), e.ContentType, e.Content)
+                state.DerefSetExpr(file, address.Offseted(int64(e.Type.IdType.Size())), e.ContentType, e.Content)
             }
         }
 
     case *ast.VectorLit:
         if e.Len != nil {
-            if c := cmpTime.ConstEval(e.Len); c != nil {
-                DerefSetVal(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), c)
+            if c := state.cmpTime.ConstEval(e.Len); c != nil {
+                state.DerefSetVal(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), c)
             } else {
-                DerefSetExpr(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), e.Len)
+                state.DerefSetExpr(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), e.Len)
             }
         } else {
             asm.MovDerefVal(file, address.Offseted(int64(2*types.Ptr_Size)), types.U64_Size, "0")
@@ -691,184 +758,202 @@ func DerefSetBigStruct(file *bufio.Writer, address addr.Addr, e ast.Expr) {
             asm.MovRegDeref(file, asm.RegDi, address.Offseted(int64(2*types.Ptr_Size)), types.U64_Size, false)
             asm.Lea(file, asm.RegDi, fmt.Sprintf("%s*%d", asm.GetReg(asm.RegDi, types.Ptr_Size), e.Type.BaseType.Size()), types.Ptr_Size)
         } else {
-            if c := cmpTime.ConstEval(e.Cap); c != nil {
+            if c := state.cmpTime.ConstEval(e.Cap); c != nil {
                 asm.MovDerefVal(file, address.Offseted(int64(types.Ptr_Size)), types.U64_Size, c.GetVal())
                 asm.MovRegVal(file, asm.RegDi, types.U64_Size, fmt.Sprintf("%s*%d", c.GetVal(), e.Type.BaseType.Size()))
             } else {
-                GenExpr(file, e.Cap)
+                state.GenExpr(file, e.Cap)
                 asm.MovDerefReg(file, address.Offseted(int64(types.Ptr_Size)), types.U64_Size, asm.RegA)
                 asm.Lea(file, asm.RegDi, fmt.Sprintf("%s*%d", asm.GetReg(asm.RegA, types.Ptr_Size), e.Type.BaseType.Size()), types.Ptr_Size)
             }
         }
 
-        asm.SaveReg(file, asm.RegC)
+        state.asm.SaveReg(file, asm.RegC)
         file.WriteString("call malloc\n")
-        asm.RestoreReg(file, asm.RegC)
+        state.asm.RestoreReg(file, asm.RegC)
         asm.MovDerefReg(file, address, types.Ptr_Size, asm.RegA)
 
     case *ast.Indexed:
-        IndexedAddrToReg(file, e, asm.RegA)
-        DerefSetDeref(file, address, e.GetType(), asm.RegAsAddr(asm.RegA))
+        state.IndexedAddrToReg(file, e, asm.RegA)
+        state.DerefSetDeref(file, address, e.GetType(), asm.RegAsAddr(asm.RegA))
 
     case *ast.Field:
-        FieldAddrToReg(file, e, asm.RegA)
-        DerefSetDeref(file, address, e.GetType(), asm.RegAsAddr(asm.RegA))
+        state.FieldAddrToReg(file, e, asm.RegA)
+        state.DerefSetDeref(file, address, e.GetType(), asm.RegAsAddr(asm.RegA))
 
     case *ast.Ident:
         if v,ok := e.Obj.(vars.Var); ok {
-            DerefSetVar(file, address, v)
+            state.DerefSetVar(file, address, v)
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected identifier %s to be a variable but got %v\n", e.Name, reflect.TypeOf(e.Obj))
-            fmt.Fprintln(os.Stderr, "\t" + e.At())
-            os.Exit(1)
+            state.diag.Errorf("expected identifier %s to be a variable but got %v", e.Name, reflect.TypeOf(e.Obj))
+            state.diag.At(e.At())
+            state.diag.Exit()
         }
 
     case *ast.Unary:
-        GenExpr(file, e.Operand)
-        DerefSetDeref(file, address, e.GetType(), asm.RegAsAddr(asm.RegA))
+        state.GenExpr(file, e.Operand)
+        state.DerefSetDeref(file, address, e.GetType(), asm.RegAsAddr(asm.RegA))
 
     case *ast.FnCall:
         asm.Lea(file, asm.RegDi, address.String(), types.Ptr_Size)
-        GenExpr(file, e)
+        state.GenExpr(file, e)
 
     case *ast.Paren:
-        DerefSetBigStruct(file, address, e.Expr)
+        state.DerefSetBigStruct(file, address, e.Expr)
 
     case *ast.XSwitch:
-        bigStructXSwitchToStack(file, address, e)
+        state.bigStructXSwitchToStack(file, address, e)
 
     case *ast.BadExpr:
-        fmt.Fprintln(os.Stderr, "[ERROR] bad expression")
-        os.Exit(1)
+        state.diag.Error("bad expression")
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] DerefSetBigStruct for %v is not implemente yet\n", reflect.TypeOf(e))
-        os.Exit(1)
+        state.diag.Errorf("DerefSetBigStruct for %v is not implemente yet", reflect.TypeOf(e))
+        state.diag.Exit()
     }
 }
 
-func XCaseAddrToReg(file *bufio.Writer, e *ast.XCase, reg asm.RegGroup) {
-    cond.CaseStart(file)
+func (state *State) XCaseAddrToReg(file *bufio.Writer, e *ast.XCase, reg asm.RegGroup) {
+    state.cond.CaseStart(file)
 
     if e.Cond == nil {
-        cond.CaseBody(file)
-        ExprAddrToReg(file, e.Expr, reg)
+        state.cond.CaseBody(file)
+        state.ExprAddrToReg(file, e.Expr, reg)
         return
     }
 
-    if val,ok := cmpTime.ConstEval(e.Cond).(*constVal.BoolConst); ok {
+    if val,ok := state.cmpTime.ConstEval(e.Cond).(*constVal.BoolConst); ok {
         if bool(*val) {
-            cond.CaseBody(file)
-            ExprAddrToReg(file, e.Expr, reg)
-            cond.CaseBodyEnd(file)
+            state.cond.CaseBody(file)
+            state.ExprAddrToReg(file, e.Expr, reg)
+            state.cond.CaseBodyEnd(file)
         }
 
         return
     }
 
     if i,ok := e.Cond.(*ast.Ident); ok {
-        cond.CaseVar(file, i.Obj.Addr())
+        state.cond.CaseVar(file, i.Obj.Addr())
     } else {
-        GenExpr(file, e.Cond)
-        cond.CaseExpr(file)
+        state.GenExpr(file, e.Cond)
+        state.cond.CaseExpr(file)
     }
 
-    cond.CaseBody(file)
-    ExprAddrToReg(file, e.Expr, reg)
-    cond.CaseBodyEnd(file)
+    state.cond.CaseBody(file)
+    state.ExprAddrToReg(file, e.Expr, reg)
+    state.cond.CaseBodyEnd(file)
 }
 
-func XSwitchAddrToReg(file *bufio.Writer, e *ast.XSwitch, reg asm.RegGroup) {
-    cond.StartSwitch()
+func (state *State) XSwitchAddrToReg(file *bufio.Writer, e *ast.XSwitch, reg asm.RegGroup) {
+    state.cond.StartSwitch()
+
+    if d := state.getDispatch(xcasesConds(e.Cases)); d != nil {
+        state.genDispatch(file, d)
+        state.genDispatchedCases(file, len(e.Cases), func(i int) { state.ExprAddrToReg(file, e.Cases[i].Expr, reg) })
+        state.cond.EndSwitch(file)
+        return
+    }
 
     for i := 0; i < len(e.Cases)-1; i++ {
-        XCaseAddrToReg(file, &e.Cases[i], reg)
+        state.XCaseAddrToReg(file, &e.Cases[i], reg)
     }
-    cond.InLastCase()
-    XCaseAddrToReg(file, &e.Cases[len(e.Cases)-1], reg)
+    state.cond.InLastCase()
+    state.XCaseAddrToReg(file, &e.Cases[len(e.Cases)-1], reg)
 
-    cond.EndSwitch(file)
+    state.cond.EndSwitch(file)
 }
 
-func bigStructXSwitchToStack(file *bufio.Writer, addr addr.Addr, e *ast.XSwitch) {
-    if c := cmpTime.ConstEval(e); c != nil {
-        GenConstVal(file, e.GetType(), c)
+func (state *State) bigStructXSwitchToStack(file *bufio.Writer, addr addr.Addr, e *ast.XSwitch) {
+    if c := state.cmpTime.ConstEval(e); c != nil && !state.runtimeOnly {
+        state.GenConstVal(file, e.GetType(), c)
         return
     }
 
-    cond.StartSwitch()
+    state.cond.StartSwitch()
+
+    if d := state.getDispatch(xcasesConds(e.Cases)); d != nil {
+        state.genDispatch(file, d)
+        state.genDispatchedCases(file, len(e.Cases), func(i int) { state.DerefSetBigStruct(file, addr, e.Cases[i].Expr) })
+        state.cond.EndSwitch(file)
+        return
+    }
 
     for i := 0; i < len(e.Cases)-1; i++ {
-        bigStructXCaseToStack(file, addr, &e.Cases[i])
+        state.bigStructXCaseToStack(file, addr, &e.Cases[i])
     }
-    cond.InLastCase()
-    bigStructXCaseToStack(file, addr, &e.Cases[len(e.Cases)-1])
+    state.cond.InLastCase()
+    state.bigStructXCaseToStack(file, addr, &e.Cases[len(e.Cases)-1])
 
-    cond.EndSwitch(file)
+    state.cond.EndSwitch(file)
 }
 
-func bigStructXCaseToStack(file *bufio.Writer, addr addr.Addr, e *ast.XCase) {
-    cond.CaseStart(file)
+func (state *State) bigStructXCaseToStack(file *bufio.Writer, addr addr.Addr, e *ast.XCase) {
+    state.cond.CaseStart(file)
 
     if e.Cond == nil {
-        cond.CaseBody(file)
-        DerefSetBigStruct(file, addr, e.Expr)
+        state.cond.CaseBody(file)
+        state.DerefSetBigStruct(file, addr, e.Expr)
         return
     }
 
-    if val,ok := cmpTime.ConstEval(e.Cond).(*constVal.BoolConst); ok {
+    if val,ok := state.cmpTime.ConstEval(e.Cond).(*constVal.BoolConst); ok {
         if bool(*val) {
-            cond.CaseBody(file)
-            DerefSetBigStruct(file, addr, e.Expr)
-            cond.CaseBodyEnd(file)
+            state.cond.CaseBody(file)
+            state.DerefSetBigStruct(file, addr, e.Expr)
+            state.cond.CaseBodyEnd(file)
         }
 
         return
     }
 
     if i,ok := e.Cond.(*ast.Ident); ok {
-        cond.CaseVar(file, i.Obj.Addr())
+        state.cond.CaseVar(file, i.Obj.Addr())
     } else {
-        GenExpr(file, e.Cond)
-        cond.CaseExpr(file)
+        state.GenExpr(file, e.Cond)
+        state.cond.CaseExpr(file)
     }
 
-    cond.CaseBody(file)
-    DerefSetBigStruct(file, addr, e.Expr)
-    cond.CaseBodyEnd(file)
+    state.cond.CaseBody(file)
+    state.DerefSetBigStruct(file, addr, e.Expr)
+    state.cond.CaseBodyEnd(file)
 }
 
-func GenSyscall(file *bufio.Writer, val ast.Expr) {
-    if v := cmpTime.ConstEval(val); v != nil {
+func (state *State) GenSyscall(file *bufio.Writer, val ast.Expr) {
+    if v := state.cmpTime.ConstEval(val); v != nil {
         asm.MovRegVal(file, asm.RegA, types.Ptr_Size, v.GetVal())
     } else {
-        fmt.Fprintln(os.Stderr, "[ERROR] _syscall takes only const")
-        fmt.Fprintln(os.Stderr, "\t" + val.At())
-        os.Exit(1)
+        state.diag.Error("_syscall takes only const")
+        state.diag.At(val.At())
+        state.diag.Exit()
     }
 
     file.WriteString("syscall\n")
 }
 
-func GenInlineAsm(file *bufio.Writer, val ast.Expr) {
+func (state *State) GenInlineAsm(file *bufio.Writer, val ast.Expr) {
     if str,ok := val.(*ast.StrLit); ok {
         file.WriteString(str.Val.Str[1:len(str.Val.Str)-1] + "\n")
     } else {
-        fmt.Fprintln(os.Stderr, "[ERROR] _asm takes only a string literal")
-        fmt.Fprintln(os.Stderr, "\t" + val.At())
-        os.Exit(1)
+        state.diag.Error("_asm takes only a string literal")
+        state.diag.At(val.At())
+        state.diag.Exit()
     }
 }
 
-func GenFmt(file *bufio.Writer, values []ast.Expr) {
-    if fmtStr,ok := values[0].(*ast.StrLit); ok {
-        args := convertFmtArgs(values[1:])
-        expr := convertFmt(fmtStr.Val, args)
+func (state *State) GenFmt(file *bufio.Writer, values []ast.Expr) {
+    state.GenExpr(file, state.ConvertFmt(values))
+}
 
-        GenExpr(file, expr)
+// desugars fmt(...) to str concatenations
+func (state *State) ConvertFmt(values []ast.Expr) ast.Expr {
+    if fmtStr,ok := values[0].(*ast.StrLit); ok {
+        args := state.convertFmtArgs(values[1:])
+        return state.convertFmt(fmtStr.Val, args)
     } else {
-        fmt.Fprintf(os.Stderr, "[ERROR] (internal) expected string literal but got %s (%s)\n", fmtStr.Val, reflect.TypeOf(fmtStr))
-        fmt.Fprintln(os.Stderr, "\t" + fmtStr.At())
-        os.Exit(1)
+        state.diag.Errorf("(internal) expected string literal but got %s (%s)", fmtStr.Val, reflect.TypeOf(fmtStr))
+        state.diag.At(fmtStr.At())
+        state.diag.Exit()
+        return nil
     }
 }
 
@@ -876,36 +961,36 @@ func GenSizeof(file *bufio.Writer, e *ast.FnCall) {
     asm.MovRegVal(file, asm.RegA, types.Ptr_Size, fmt.Sprint(e.InsetType.Size()))
 }
 
-func createStrLit(fmtStr token.Token, startIdx int, endIdx int) *ast.StrLit {
+func (state *State) createStrLit(fmtStr token.Token, startIdx int, endIdx int) *ast.StrLit {
     if startIdx == 0 { startIdx += 1 }
     if endIdx == len(fmtStr.Str)-1 { endIdx -= 1 }
 
     fmtStr.Str = "\"" + fmtStr.Str[startIdx:endIdx-1] + "\""
-    idx := str.Add(fmtStr)
+    idx := state.str.Add(fmtStr)
     return &ast.StrLit{ Idx: idx, Val: fmtStr }
 }
 
-func convertFmtArgs(args []ast.Expr) []ast.Expr {
+func (state *State) convertFmtArgs(args []ast.Expr) []ast.Expr {
     res := make([]ast.Expr, 0, len(args))
     for _,a := range args {
-        res = append(res, convertFmtArg(a)) 
+        res = append(res, state.convertFmtArg(a)) 
     }
     return res
 }
 
-func convertFmtArg(arg ast.Expr) ast.Expr {
+func (state *State) convertFmtArg(arg ast.Expr) ast.Expr {
     if (arg.GetType().GetKind() == types.Str) { return arg }
 
     funcName := "to_str"
     fnSrc := arg.GetType()
 
-    f := identObj.GetFnFromFnSrc(fnSrc, funcName)
+    f := state.identObj.GetFnFromFnSrc(fnSrc, funcName)
 
     ident := ast.Ident{ Name: funcName, Obj: f }
     return &ast.FnCall{ F: f, FnSrc: fnSrc, Ident: ident, Values: []ast.Expr{ arg } }
 }
 
-func convertFmt(fmtStr token.Token, values []ast.Expr) ast.Expr {
+func (state *State) convertFmt(fmtStr token.Token, values []ast.Expr) ast.Expr {
     if fmtStr.Str == "{}" {
         return values[0]
     } else {
@@ -927,7 +1012,7 @@ func convertFmt(fmtStr token.Token, values []ast.Expr) ast.Expr {
                         Type: types.StrType{},
                         OperandL: *cur,
                         Operator: token.Token{ Pos: fmtStr.Pos, Str: "+", Type: token.Plus },
-                        OperandR: createStrLit(fmtStr, startIdx, i),
+                        OperandR: state.createStrLit(fmtStr, startIdx, i),
                     }
                     *cur = &binOp
                     cur = &binOp.OperandR
@@ -957,7 +1042,7 @@ func convertFmt(fmtStr token.Token, values []ast.Expr) ast.Expr {
                 Type: types.StrType{},
                 OperandL: *cur,
                 Operator: token.Token{ Pos: fmtStr.Pos, Str: "+", Type: token.Plus },
-                OperandR: createStrLit(fmtStr, startIdx, len(fmtStr.Str)),
+                OperandR: state.createStrLit(fmtStr, startIdx, len(fmtStr.Str)),
             }
 
             *cur = &binOp
@@ -965,10 +1050,10 @@ func convertFmt(fmtStr token.Token, values []ast.Expr) ast.Expr {
         }
 
         if len(values) != valIdx {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected %d args for fmt but got %d\n", valIdx, len(values))
-            fmt.Fprintln(os.Stderr, "\tfmt string: " + fmtStr.Str)
-            fmt.Fprintln(os.Stderr, "\t" + fmtStr.At())
-            os.Exit(1)
+            state.diag.Errorf("expected %d args for fmt but got %d", valIdx, len(values))
+            state.diag.Line("fmt string: " + fmtStr.Str)
+            state.diag.At(fmtStr.At())
+            state.diag.Exit()
         }
 
         if binOp,ok := res.OperandR.(*ast.Binary); ok {
@@ -979,15 +1064,22 @@ func convertFmt(fmtStr token.Token, values []ast.Expr) ast.Expr {
     }
 }
 
-func GenConstVal(file *bufio.Writer, t types.Type, val constVal.ConstVal) {
+func (state *State) GenConstVal(file *bufio.Writer, t types.Type, val constVal.ConstVal) {
     switch c := val.(type) {
     case *constVal.StrConst:
         asm.MovRegVal(file, asm.RegA, types.Ptr_Size, fmt.Sprintf("_str%d", uint64(*c)))
-        asm.MovRegVal(file, asm.RegD, types.I32_Size, fmt.Sprintf("%d", str.GetSize(uint64(*c))))
+        asm.MovRegVal(file, asm.RegD, types.I32_Size, fmt.Sprintf("%d", state.str.GetSize(uint64(*c))))
 
     case *constVal.PtrConst:
         PtrConstToReg(file, *c, asm.RegA)
 
+    case *constVal.EnumConst:
+        if c.Type.IsNiche() && c.Elem != nil {
+            state.GenConstVal(file, c.ElemType, c.Elem)
+        } else {
+            asm.MovRegVal(file, asm.RegA, t.Size(), c.GetVal())
+        }
+
     default:
         asm.MovRegVal(file, asm.RegA, t.Size(), c.GetVal())
     }
@@ -1017,6 +1109,7 @@ type passArgs struct {
     regArgs []arg
     regsCount uint
     stackSize uint
+    state *State
 }
 
 type arg struct {
@@ -1024,7 +1117,7 @@ type arg struct {
     value ast.Expr
 }
 
-func createPassArgs(f *identObj.Func, values []ast.Expr) passArgs {
+func (state *State) createPassArgs(f *identObj.Func, values []ast.Expr) passArgs {
     stackArgs := make([]arg, 0, len(f.GetArgs()))
     bigStructArgs := make([]arg, 0, len(f.GetArgs()))
     regArgs := make([]arg, 0, len(f.GetArgs()))
@@ -1051,7 +1144,7 @@ func createPassArgs(f *identObj.Func, values []ast.Expr) passArgs {
     }
 
     return passArgs{ stackArgs: stackArgs, bigStructArgs: bigStructArgs, 
-        regArgs: regArgs, regsCount: regsCount, stackSize: stackSize }
+        regArgs: regArgs, regsCount: regsCount, stackSize: stackSize, state: state }
 }
 
 func (args *passArgs) genAlignStack(file *bufio.Writer) {
@@ -1063,14 +1156,14 @@ func (args *passArgs) genAlignStack(file *bufio.Writer) {
 
 func (args *passArgs) genPassArgsStack(file *bufio.Writer) {
     for _, arg := range args.stackArgs {
-        if v := cmpTime.ConstEval(arg.value); v != nil {
-            PassValStack(file, v, arg.typ)
+        if v := args.state.cmpTime.ConstEval(arg.value); v != nil {
+            args.state.PassValStack(file, v, arg.typ)
 
         } else if ident,ok := arg.value.(*ast.Ident); ok {
             PassVarStack(file, ident.Obj.(vars.Var))
 
         } else {
-            GenExpr(file, arg.value)
+            args.state.GenExpr(file, arg.value)
             PassRegStack(file, arg.typ)
         }
     }
@@ -1083,51 +1176,92 @@ func (args *passArgs) genPassArgsBigStruct(file *bufio.Writer) {
         asm.SubSp(file, int64(size))
         asm.MovRegReg(file, asm.RegC, asm.RegSp, types.Ptr_Size)
 
-        asm.UseReg(asm.RegC)
+        args.state.asm.UseReg(asm.RegC)
         
         switch t := arg.typ.(type) {
         case types.StructType:
-            if v := cmpTime.ConstEval(arg.value); v != nil {
-                PassBigStructLit(file, t, *v.(*constVal.StructConst))
+            if v := args.state.cmpTime.ConstEval(arg.value); v != nil {
+                args.state.PassBigStructLit(file, t, *v.(*constVal.StructConst))
 
             } else if ident,ok := arg.value.(*ast.Ident); ok {
-                PassBigStructVar(file, t, ident.Obj.(vars.Var), 0)
+                args.state.PassBigStructVar(file, t, ident.Obj.(vars.Var), 0)
 
             } else {
-                PassBigStructReg(file, asm.RegAsAddr(asm.RegC), arg.value)
+                args.state.PassBigStructReg(file, asm.RegAsAddr(asm.RegC), arg.value)
             }
 
         case types.VecType, types.EnumType:
             // TODO: Lit and Var
-            PassBigStructReg(file, asm.RegAsAddr(asm.RegC), arg.value)
+            args.state.PassBigStructReg(file, asm.RegAsAddr(asm.RegC), arg.value)
 
         default:
-            fmt.Fprintln(os.Stderr, "[ERROR] (internal) unreachable genPassArgsBigStruct")
-            os.Exit(1)
+            args.state.diag.Error("(internal) unreachable genPassArgsBigStruct")
+            args.state.diag.Exit()
         }
 
-        asm.FreeReg(asm.RegC)
+        args.state.asm.FreeReg(asm.RegC)
     }
 }
 
+// args are evaluated from left to right (after the stack and big struct args)
+// (evaluating an expr, like a function call, can overwrite the registers already passed
+// so the args before the last expr are pushed until it is evaluated)
 func (args *passArgs) genPassArgsReg(file *bufio.Writer) {
-    for _,arg := range args.regArgs {
+    regIdx := make([]uint, len(args.regArgs))
+    consts := make([]constVal.ConstVal, len(args.regArgs))
+
+    // regArgs are in reverse order (see createPassArgs)
+    lastExpr := -1
+    for i,arg := range args.regArgs {
         args.regsCount -= types.RegCount(arg.typ)
+        regIdx[i] = args.regsCount
+        consts[i] = args.state.cmpTime.ConstEval(arg.value)
+
+        if _,ok := arg.value.(*ast.Ident); !ok && consts[i] == nil && lastExpr == -1 {
+            lastExpr = i
+        }
+    }
 
-        if v := cmpTime.ConstEval(arg.value); v != nil {
-            PassVal(file, args.regsCount, v, arg.typ)
+    if lastExpr != -1 {
+        for i := len(args.regArgs)-1; i > lastExpr; i-- {
+            if consts[i] == nil {
+                args.passReg(file, i, regIdx[i])
+                asm.PushReg(file, regs[regIdx[i]])
+                if types.RegCount(args.regArgs[i].typ) == 2 {
+                    asm.PushReg(file, regs[regIdx[i]+1])
+                }
+            }
+        }
 
-        } else if ident,ok := arg.value.(*ast.Ident); ok {
-            PassVar(file, args.regsCount, arg.typ, ident.Obj.(vars.Var))
+        args.passReg(file, lastExpr, regIdx[lastExpr])
 
-        } else {
-            if args.regsCount <= uint(asm.RegC) {
-                asm.UseReg(asm.RegC)
+        for i := lastExpr+1; i < len(args.regArgs); i++ {
+            if consts[i] == nil {
+                if types.RegCount(args.regArgs[i].typ) == 2 {
+                    asm.PopReg(file, regs[regIdx[i]+1])
+                }
+                asm.PopReg(file, regs[regIdx[i]])
             }
-            PassExpr(file, args.regsCount, arg.typ, arg.value.GetType().Size(), arg.value)
-            asm.FreeReg(asm.RegC)
         }
     }
+
+    // consts and the vars after the last expr
+    for i,arg := range args.regArgs {
+        if consts[i] != nil {
+            args.state.PassVal(file, regIdx[i], consts[i], arg.typ)
+        } else if i < lastExpr || lastExpr == -1 {
+            args.passReg(file, i, regIdx[i])
+        }
+    }
+}
+
+func (args *passArgs) passReg(file *bufio.Writer, i int, regIdx uint) {
+    arg := args.regArgs[i]
+    if ident,ok := arg.value.(*ast.Ident); ok {
+        PassVar(file, regIdx, arg.typ, ident.Obj.(vars.Var))
+    } else {
+        args.state.PassExpr(file, regIdx, arg.typ, arg.value.GetType().Size(), arg.value)
+    }
 }
 
 func (args *passArgs) genClearStack(file *bufio.Writer) {
@@ -1,18 +1,14 @@
 package gen
 
 import (
-    "os"
     "fmt"
     "bufio"
     "reflect"
     "gamma/types"
-    "gamma/types/str"
     "gamma/types/addr"
-    "gamma/types/array"
     "gamma/ast"
     "gamma/ast/identObj"
     "gamma/ast/identObj/vars"
-    "gamma/cmpTime"
     "gamma/cmpTime/constVal"
     "gamma/gen/asm/x86_64"
     "gamma/gen/asm/x86_64/vtable"
@@ -98,12 +94,12 @@ func DefArg(file *bufio.Writer, regIdx uint, v vars.Var, t types.Type) {
 }
 
 
-func PassVal(file *bufio.Writer, regIdx uint, value constVal.ConstVal, valtype types.Type) {
+func (state *State) PassVal(file *bufio.Writer, regIdx uint, value constVal.ConstVal, valtype types.Type) {
     switch v := value.(type) {
     case *constVal.StrConst:
         asm.MovRegVal(file, regs[regIdx], types.Ptr_Size, fmt.Sprintf("_str%d", uint64(*v)))
         if valtype.GetKind() == types.Str { // check for *char cast
-            asm.MovRegVal(file, regs[regIdx+1], types.I32_Size, fmt.Sprint(str.GetSize(uint64(*v))))
+            asm.MovRegVal(file, regs[regIdx+1], types.I32_Size, fmt.Sprint(state.str.GetSize(uint64(*v))))
         }
 
     case *constVal.StructConst:
@@ -112,7 +108,7 @@ func PassVal(file *bufio.Writer, regIdx uint, value constVal.ConstVal, valtype t
         if len(t.Types) == 1 && t.Types[0].GetKind() != types.Str {
             asm.MovRegVal(file, regs[regIdx], t.Size(), v.Fields[0].GetVal())
         } else {
-            vs := PackValues(t.Types, v.Fields)
+            vs := state.PackValues(t.Types, v.Fields)
             asm.MovRegVal(file, regs[regIdx], types.Ptr_Size, vs[0])
             if len(vs) == 2 {
                 asm.MovRegVal(file, regs[regIdx+1], t.Size() - types.Ptr_Size, vs[1])
@@ -120,11 +116,17 @@ func PassVal(file *bufio.Writer, regIdx uint, value constVal.ConstVal, valtype t
         }
 
     case *constVal.EnumConst:
-        if v.Elem == nil {
+        if v.Type.IsNiche() {
+            if v.Elem == nil {
+                asm.MovRegVal(file, regs[regIdx], types.Ptr_Size, v.GetVal())
+            } else {
+                state.PassVal(file, regIdx, v.Elem, v.ElemType)
+            }
+        } else if v.Elem == nil {
             asm.MovRegVal(file, regs[regIdx], v.Type.IdType.Size(), fmt.Sprint(v.Id))
         } else {
             idConst := constVal.UintConst(v.Id)
-            vs := PackValues([]types.Type{ v.Type.IdType, v.ElemType }, []constVal.ConstVal{ &idConst, v.Elem })
+            vs := state.PackValues([]types.Type{ v.Type.IdType, v.ElemType }, []constVal.ConstVal{ &idConst, v.Elem })
             asm.MovRegVal(file, regs[regIdx], types.Ptr_Size, vs[0])
             if len(vs) == 2 {
                 asm.MovRegVal(file, regs[regIdx+1], v.Type.Size() - types.Ptr_Size, vs[1])
@@ -138,8 +140,8 @@ func PassVal(file *bufio.Writer, regIdx uint, value constVal.ConstVal, valtype t
         PtrConstToReg(file, *v, regs[regIdx])
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] cannot pass %v yet\n", reflect.TypeOf(value))
-        os.Exit(1)
+        state.diag.Errorf("cannot pass %v yet", reflect.TypeOf(value))
+        state.diag.Exit()
     }
 }
 
@@ -180,15 +182,15 @@ func PassVar(file *bufio.Writer, regIdx uint, t types.Type, otherVar vars.Var) {
     }
 }
 
-func PassExpr(file *bufio.Writer, regIdx uint, argType types.Type, srcSize uint, expr ast.Expr) {
+func (state *State) PassExpr(file *bufio.Writer, regIdx uint, argType types.Type, srcSize uint, expr ast.Expr) {
     switch t := argType.(type) {
     case types.StrType:
-        GenExpr(file, expr)
+        state.GenExpr(file, expr)
         asm.MovRegReg(file, regs[regIdx],   asm.RegGroup(0), types.Ptr_Size)
         asm.MovRegReg(file, regs[regIdx+1], asm.RegGroup(1), types.U32_Size)
 
     case types.StructType, types.EnumType:
-        GenExpr(file, expr)
+        state.GenExpr(file, expr)
         if t.Size() > uint(8) {
             asm.MovRegReg(file, regs[regIdx], asm.RegGroup(0), types.Ptr_Size)
             asm.MovRegReg(file, regs[regIdx+1], asm.RegGroup(1), t.Size() - 8)
@@ -197,50 +199,50 @@ func PassExpr(file *bufio.Writer, regIdx uint, argType types.Type, srcSize uint,
         }
 
     case types.InterfaceType:
-        GenExpr(file, expr)
+        state.GenExpr(file, expr)
         asm.MovRegReg(file, regs[regIdx], asm.RegGroup(0), types.Ptr_Size)
         asm.MovRegReg(file, regs[regIdx+1], asm.RegGroup(1), t.Size() - 8)
 
     case types.IntType:
-        GenExpr(file, expr)
+        state.GenExpr(file, expr)
         asm.MovRegRegExtend(file, regs[regIdx], t.Size(), asm.RegGroup(0), srcSize, true)
 
     case types.ArrType:
         if lit,ok := expr.(*ast.ArrayLit); ok {
             arrAddr := addr.Addr{ BaseAddr: fmt.Sprintf("_arr%d", lit.Idx) }
-            for i, v := range array.GetValues(lit.Idx) {
+            for i, v := range state.array.GetValues(lit.Idx) {
                 if v == nil {
-                    DerefSetExpr(file, arrAddr.Offseted(int64(i) * int64(t.BaseType.Size())), t.BaseType, lit.Values[i])
+                    state.DerefSetExpr(file, arrAddr.Offseted(int64(i) * int64(t.BaseType.Size())), t.BaseType, lit.Values[i])
                 }
             }
             asm.MovRegVal(file, regs[regIdx], srcSize, fmt.Sprint(arrAddr))
         } else {
-            GenExpr(file, expr)
+            state.GenExpr(file, expr)
             asm.MovRegRegExtend(file, regs[regIdx], t.Size(), asm.RegGroup(0), srcSize, false)
         }
 
     case types.GenericType:
-        PassExpr(file, regIdx, types.ResolveGeneric(t), srcSize, expr)
+        state.PassExpr(file, regIdx, types.ResolveGeneric(t), srcSize, expr)
     case *types.GenericType:
-        PassExpr(file, regIdx, types.ResolveGeneric(t), srcSize, expr)
+        state.PassExpr(file, regIdx, types.ResolveGeneric(t), srcSize, expr)
 
     default:
-        GenExpr(file, expr)
+        state.GenExpr(file, expr)
         asm.MovRegRegExtend(file, regs[regIdx], t.Size(), asm.RegGroup(0), srcSize, false)
     }
 }
 
-func PassValStack(file *bufio.Writer, value constVal.ConstVal, valtype types.Type) {
+func (state *State) PassValStack(file *bufio.Writer, value constVal.ConstVal, valtype types.Type) {
     switch v := value.(type) {
     case *constVal.StrConst:
-        asm.PushVal(file, fmt.Sprint(str.GetSize(uint64(*v))))
+        asm.PushVal(file, fmt.Sprint(state.str.GetSize(uint64(*v))))
         asm.PushVal(file, fmt.Sprintf("_str%d", uint64(*v)))
 
     case *constVal.StructConst:
         if len(v.Type.Types) == 1 {
-            PassValStack(file, v.Fields[0], v.Type.Types[0])
+            state.PassValStack(file, v.Fields[0], v.Type.Types[0])
         } else {
-            vs := PackValues(v.Type.Types, v.Fields)
+            vs := state.PackValues(v.Type.Types, v.Fields)
             asm.PushVal(file, vs[0])
             if len(vs) == 2 {
                 asm.PushVal(file, vs[1])
@@ -298,82 +300,91 @@ func PassRegStack(file *bufio.Writer, argType types.Type) {
     }
 }
 
-func passBigStructLit(file *bufio.Writer, t types.StructType, value constVal.StructConst, dstAddr addr.Addr) {
+func (state *State) passBigStructLit(file *bufio.Writer, t types.StructType, value constVal.StructConst, dstAddr addr.Addr) {
     for i,f := range value.Fields {
-        passConst(file, t.Types[i], f, dstAddr)
+        state.passConst(file, t.Types[i], f, dstAddr)
         dstAddr.Offset += int64(t.Types[i].Size())
     }
 }
 
-func passConst(file *bufio.Writer, t types.Type, value constVal.ConstVal, dstAddr addr.Addr) {
+func (state *State) passConst(file *bufio.Writer, t types.Type, value constVal.ConstVal, dstAddr addr.Addr) {
     switch value := value.(type) {
     case *constVal.StrConst:
         asm.MovDerefVal(file, dstAddr, types.Ptr_Size, fmt.Sprintf("_str%d", uint64(*value)))
-        asm.MovDerefVal(file, dstAddr.Offseted(int64(types.Ptr_Size)), types.I32_Size, fmt.Sprint(str.GetSize(uint64(*value))))
+        asm.MovDerefVal(file, dstAddr.Offseted(int64(types.Ptr_Size)), types.I32_Size, fmt.Sprint(state.str.GetSize(uint64(*value))))
 
     case *constVal.StructConst:
-        passBigStructLit(file, t.(types.StructType), *value, dstAddr)
+        state.passBigStructLit(file, t.(types.StructType), *value, dstAddr)
         
     case *constVal.EnumConst:
-        passEnumLit(file, *value, dstAddr)
+        state.passEnumLit(file, *value, dstAddr)
 
     default:
         asm.MovDerefVal(file, dstAddr, t.Size(), value.GetVal())
     }
 }
 
-func passEnumLit(file *bufio.Writer, value constVal.EnumConst, dstAddr addr.Addr) {
+func (state *State) passEnumLit(file *bufio.Writer, value constVal.EnumConst, dstAddr addr.Addr) {
+    if value.Type.IsNiche() {
+        if value.Elem == nil {
+            asm.MovDerefVal(file, dstAddr, types.Ptr_Size, value.GetVal())
+        } else {
+            state.passConst(file, value.ElemType, value.Elem, dstAddr)
+        }
+        return
+    }
+
     asm.MovDerefVal(file, dstAddr, value.Type.IdType.Size(), fmt.Sprint(value.Id))
     if value.Elem != nil {
-        passConst(file, value.ElemType, value.Elem, dstAddr.Offseted(int64(value.Type.IdType.Size())))
+        state.passConst(file, value.ElemType, value.Elem, dstAddr.Offseted(int64(value.Type.IdType.Size())))
     }
 }
 
-func PassBigStructLit(file *bufio.Writer, t types.StructType, value constVal.StructConst) {
-    passBigStructLit(file, t, value, asm.RegAsAddr(asm.RegC))
+func (state *State) PassBigStructLit(file *bufio.Writer, t types.StructType, value constVal.StructConst) {
+    state.passBigStructLit(file, t, value, asm.RegAsAddr(asm.RegC))
 }
 
-func PassBigStructVar(file *bufio.Writer, t types.StructType, v vars.Var, offset int64) {
+func (state *State) PassBigStructVar(file *bufio.Writer, t types.StructType, v vars.Var, offset int64) {
     dstAddr := asm.RegAsAddr(asm.RegC).Offseted(offset)
     srcAddr := v.Addr().Offseted(offset)
-    DerefSetDeref(file, dstAddr, t, srcAddr)
+    state.DerefSetDeref(file, dstAddr, t, srcAddr)
 }
 
-func PassBigStructReg(file *bufio.Writer, addr addr.Addr, e ast.Expr) {
-    DerefSetBigStruct(file, addr, e)
+func (state *State) PassBigStructReg(file *bufio.Writer, addr addr.Addr, e ast.Expr) {
+    state.DerefSetBigStruct(file, addr, e)
 }
 
-func RetBigStructLit(file *bufio.Writer, t types.StructType, val constVal.StructConst) {
-    PassBigStructLit(file, t, val)
+func (state *State) RetBigStructLit(file *bufio.Writer, t types.StructType, val constVal.StructConst) {
+    state.PassBigStructLit(file, t, val)
 }
 
-func RetBigStructVar(file *bufio.Writer, t types.StructType, v vars.Var) {
-    PassBigStructVar(file, t, v, 0)
+func (state *State) RetBigStructVar(file *bufio.Writer, t types.StructType, v vars.Var) {
+    state.PassBigStructVar(file, t, v, 0)
 }
 
-func RetBigStructExpr(file *bufio.Writer, address addr.Addr, e ast.Expr) {
+func (state *State) RetBigStructExpr(file *bufio.Writer, address addr.Addr, e ast.Expr) {
     if types.IsBigStruct(e.GetType()) {
         switch lit := e.(type) {
         case *ast.StructLit:
             a := addr.Addr{ BaseAddr: address.BaseAddr, Offset: address.Offset }
             for i,f := range lit.Fields {
-                if c := cmpTime.ConstEval(f.Value); c != nil {
-                    DerefSetVal(file, a, lit.StructType.Types[i], c)
+                if c := state.cmpTime.ConstEval(f.Value); c != nil {
+                    state.DerefSetVal(file, a, lit.StructType.Types[i], c)
                 } else {
-                    asm.UseReg(asm.RegC)
-                    DerefSetExpr(file, a, lit.StructType.Types[i], f.Value)
-                    asm.FreeReg(asm.RegC)
+                    state.asm.UseReg(asm.RegC)
+                    state.DerefSetExpr(file, a, lit.StructType.Types[i], f.Value)
+                    state.asm.FreeReg(asm.RegC)
                 }
                 a.Offset += int64(lit.StructType.Types[i].Size())
             }
         case *ast.VectorLit:
             if lit.Len != nil {
-                if c := cmpTime.ConstEval(lit.Len); c != nil {
-                    DerefSetVal(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), c)
+                if c := state.cmpTime.ConstEval(lit.Len); c != nil {
+                    state.DerefSetVal(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), c)
                 } else {
-                    asm.UseReg(asm.RegC)
-                    DerefSetExpr(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), lit.Len)
-                    asm.FreeReg(asm.RegC)
+                    state.asm.UseReg(asm.RegC)
+                    state.DerefSetExpr(file, address.Offseted(int64(2*types.Ptr_Size)), types.CreateUint(types.U64_Size), lit.Len)
+                    state.asm.FreeReg(asm.RegC)
                 }
             } else {
                 asm.MovDerefVal(file, address.Offseted(int64(2*types.Ptr_Size)), types.U64_Size, "0")
@@ -385,38 +396,38 @@ func RetBigStructExpr(file *bufio.Writer, address addr.Addr, e ast.Expr) {
                 asm.MovRegDeref(file, asm.RegDi, address.Offseted(int64(2*types.Ptr_Size)), types.U64_Size, false)
                 asm.Lea(file, asm.RegDi, fmt.Sprintf("%s*%d", asm.GetReg(asm.RegDi, types.Ptr_Size), baseTypeSize), types.Ptr_Size)
             } else {
-                if c := cmpTime.ConstEval(lit.Cap); c != nil {
+                if c := state.cmpTime.ConstEval(lit.Cap); c != nil {
                     asm.MovDerefVal(file, address.Offseted(int64(types.Ptr_Size)), types.U64_Size, c.GetVal())
                     asm.MovRegVal(file, asm.RegDi, types.U64_Size, fmt.Sprintf("%s*%d", c.GetVal(), baseTypeSize))
                 } else {
-                    asm.UseReg(asm.RegC)
-                    GenExpr(file, lit.Cap)
-                    asm.FreeReg(asm.RegC)
+                    state.asm.UseReg(asm.RegC)
+                    state.GenExpr(file, lit.Cap)
+                    state.asm.FreeReg(asm.RegC)
                     asm.MovDerefReg(file, address.Offseted(int64(types.Ptr_Size)), types.U64_Size, asm.RegGroup(0))
                     asm.Lea(file, asm.RegDi, fmt.Sprintf("%s*%d", asm.GetReg(asm.RegA, types.Ptr_Size), baseTypeSize), types.Ptr_Size)
                 }
             }
 
-            asm.SaveReg(file, asm.RegC)
+            state.asm.SaveReg(file, asm.RegC)
             file.WriteString("call malloc\n")
-            asm.RestoreReg(file, asm.RegC)
+            state.asm.RestoreReg(file, asm.RegC)
             asm.MovDerefReg(file, address, types.Ptr_Size, asm.RegGroup(0))
 
         default:
-            PassBigStructReg(file, address, e)
+            state.PassBigStructReg(file, address, e)
         }
     } else {
-        PassBigStructReg(file, address, e)
+        state.PassBigStructReg(file, address, e)
     }
 }
 
 
 
-func PackValues(types []types.Type, values []constVal.ConstVal) []string {
-    return packValues(types, values, nil, 0)
+func (state *State) PackValues(types []types.Type, values []constVal.ConstVal) []string {
+    return state.packValues(types, values, nil, 0)
 }
 
-func PackFields(file *bufio.Writer, typ types.StructType, fields []ast.FieldLit) {
+func (state *State) PackFields(file *bufio.Writer, typ types.StructType, fields []ast.FieldLit) {
     if len(fields) > 1 {
         addr := addr.Addr{ BaseAddr: "rsp", Offset: -8 }
         if typ.Size() > 8 {
@@ -428,13 +439,13 @@ func PackFields(file *bufio.Writer, typ types.StructType, fields []ast.FieldLit)
 
             switch t.GetKind() {
             case types.Str:
-                GenExpr(file, f.Value)
+                state.GenExpr(file, f.Value)
                 asm.MovDerefReg(file, addr.Offseted(int64(types.Ptr_Size)), types.Ptr_Size, asm.RegA)
                 asm.MovDerefReg(file, addr, types.U32_Size, asm.RegD)
                 addr.Offset += int64(types.U32_Size)
 
             case types.Struct:
-                GenExpr(file, f.Value)
+                state.GenExpr(file, f.Value)
                 if t.Size() > 8 {
                     asm.MovDerefReg(file, addr.Offseted(int64(types.Ptr_Size)), t.Size(), asm.RegA)
                     asm.MovDerefReg(file, addr, t.Size() - 8, asm.RegD)
@@ -445,7 +456,7 @@ func PackFields(file *bufio.Writer, typ types.StructType, fields []ast.FieldLit)
                 }
 
             default:
-                GenExpr(file, f.Value)
+                state.GenExpr(file, f.Value)
                 asm.MovDerefReg(file, addr, t.Size(), asm.RegA)
                 addr.Offset += int64(t.Size())
             }
@@ -458,22 +469,22 @@ func PackFields(file *bufio.Writer, typ types.StructType, fields []ast.FieldLit)
             asm.MovRegDeref(file, asm.RegGroup(1), addr, types.Ptr_Size, false)
         }
     } else {
-        GenExpr(file, fields[0].Value)
+        state.GenExpr(file, fields[0].Value)
     }
 }
 
-func packValues(valtypes []types.Type, values []constVal.ConstVal, packed []string, offset uint) []string {
+func (state *State) packValues(valtypes []types.Type, values []constVal.ConstVal, packed []string, offset uint) []string {
     for i,v := range values {
         switch v := v.(type) {
         case *constVal.StrConst:
             packed = append(packed, fmt.Sprintf("_str%d", uint64(*v)))
             if valtypes[i].GetKind() == types.Str { // check for *char cast
-                packed = append(packed, fmt.Sprint(str.GetSize(uint64(*v))))
+                packed = append(packed, fmt.Sprint(state.str.GetSize(uint64(*v))))
                 offset += types.I32_Size
             }
 
         case *constVal.StructConst:
-            packed = packValues(valtypes[i].(types.StructType).Types, v.Fields, packed, offset)
+            packed = state.packValues(valtypes[i].(types.StructType).Types, v.Fields, packed, offset)
             offset += valtypes[i].Size() % 8
 
         case *constVal.ArrConst, *constVal.PtrConst:
@@ -485,8 +496,8 @@ func packValues(valtypes []types.Type, values []constVal.ConstVal, packed []stri
             offset += valtypes[i].Size()
 
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] cannot pack value of type %v yet\n", reflect.TypeOf(valtypes[i]))
-            os.Exit(1)
+            state.diag.Errorf("cannot pack value of type %v yet", reflect.TypeOf(valtypes[i]))
+            state.diag.Exit()
         }
 
         if offset > 8 {
@@ -4,36 +4,62 @@ import (
     "os"
     "fmt"
     "bufio"
+    "strings"
     "gamma/ast"
-    "gamma/buildin"
-    "gamma/types/str"
-    "gamma/types/array"
     "gamma/gen/asm/x86_64/nasm"
 )
 
-func GenAsm(Ast ast.Ast) {
-    fmt.Println("[INFO] generating asm x86_64 file...")
+func (state *State) GenAsm(Ast ast.Ast, verbose bool) {
+    res := state.Asm(Ast, verbose)
 
     asm, err := os.Create("output.asm")
     if err != nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] could not create \"output.asm\"")
-        os.Exit(1)
+        state.diag.Error("could not create \"output.asm\"")
+        state.diag.Exit()
     }
-    writer := bufio.NewWriter(asm)
+
+    asm.WriteString(res)
+    asm.Close()
+}
+
+// the asm without writing output.asm
+func (state *State) Asm(Ast ast.Ast, verbose bool) string {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] generating asm x86_64 file...")
+
+    var buf strings.Builder
+    writer := bufio.NewWriter(&buf)
 
     nasm.Header(writer)
 
-    buildin.Define(writer)
+    if state.checkConsts {
+        state.checkEntry = Ast.Entry()
+        state.collectGlobalChecks(Ast.Decls)
+    }
+
+    state.reachable = state.Reachable(Ast)
+    state.buildin.Define(writer, state.reachable.BuildIn)
 
     for _,d := range Ast.Decls {
-        GenDecl(writer, d)
+        state.GenDecl(writer, d)
     }
 
-    str.Gen()
-    array.Gen()
+    state.str.Gen()
+    state.array.Gen()
 
-    nasm.Footer(writer, Ast.NoMainArg)
+    state.nasm.Footer(writer, Ast.Entry(), Ast.NoMainArg)
 
     writer.Flush()
-    asm.Close()
+
+    if verbose {
+        for _,s := range state.reachable.Unused() {
+            fmt.Fprintf(state.diag.Stdout(), "[INFO] removed unused %s\n", s)
+        }
+    }
+
+    res := buf.String()
+    if state.optLevel >= O2 {
+        res = nasm.Peephole(res)
+    }
+
+    return nasm.AddFnTable(res)
 }
@@ -0,0 +1,45 @@
+package gen
+
+import (
+    "gamma/ast"
+    "gamma/gen/reach"
+)
+
+// optimization levels (-O0, -O1, -O2)
+// consts are folded at every level (there is no inlining or register allocation yet)
+const (
+    O0 uint = iota  // straightforward code (for debugging, checks the divisor of / and %)
+    O1              // jump tables and removal of unused functions/data
+    O2              // O1 + peephole optimizations of the asm
+)
+
+func (state *State) SetOptLevel(level uint) {
+    state.optLevel = level
+}
+
+func (state *State) GetOptLevel() uint {
+    return state.optLevel
+}
+
+// funcs called by the generated code (besides the entry)
+func (state *State) reachRoots() []string {
+    roots := []string{ "malloc", "exit", "_signal" }
+    if state.checkConsts {
+        roots = append(roots, "_check_const")
+    }
+    if state.checkOverflow {
+        roots = append(roots, "_overflow")
+    }
+    return roots
+}
+
+// unreachable decls are not generated with -O1 and -O2 (nil reaches everything)
+func (state *State) Reachable(Ast ast.Ast) *reach.Set {
+    if state.optLevel < O1 {
+        state.str.SetUsed(nil)
+        state.array.SetUsed(nil)
+        return nil
+    }
+
+    return state.reach.Reachable(Ast, state.reachRoots())
+}
@@ -0,0 +1,157 @@
+package gen
+
+import (
+    "fmt"
+    "bufio"
+    "strings"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/gen/asm/x86_64"
+)
+
+/*
+checked arithmetic (gamma -check-overflow)
+  * +, -, * and unary - of ints/uints jump over a call of _overflow (buildin.gma) if OF/CF is not set
+  * _overflow reports the position and exits with 1:
+    [OVERFLOW] <file>:<line>:<col>: <type> <op> overflowed
+  * wrapping_add/sub/mul are never checked, saturating_add/sub clamp to the range of the type
+*/
+
+func (state *State) SetCheckOverflow(check bool) {
+    state.checkOverflow = check
+}
+
+func (state *State) CheckOverflow() bool {
+    return state.checkOverflow
+}
+
+func (state *State) resetCheckCount() {
+    state.checkCount = 0
+}
+
+func isOverflowOp(op token.TokenType) bool {
+    return op == token.Plus || op == token.Minus || op == token.Mul
+}
+
+// 8/16bit ints are computed in 32bit regs (the flags do not tell about overflows)
+func isSmallInt(t types.Type) bool {
+    return t != nil && (t.GetKind() == types.Int || t.GetKind() == types.Uint) && t.Size() < types.I32_Size
+}
+
+// jumps to label if the op before did not overflow
+// (small ints: the exact result in eax has to be equal to its extended low bits)
+func jmpNoOverflow(file *bufio.Writer, t types.Type, label string) {
+    switch {
+    case isSmallInt(t):
+        asm.MovRegRegExtend(file, asm.RegB, types.I32_Size, asm.RegA, t.Size(), t.GetKind() == types.Int)
+        file.WriteString(fmt.Sprintf("cmp %s, %s\n", asm.GetReg(asm.RegA, types.I32_Size), asm.GetReg(asm.RegB, types.I32_Size)))
+        file.WriteString(fmt.Sprintf("je %s\n", label))
+    case t.GetKind() == types.Int:
+        file.WriteString(fmt.Sprintf("jno %s\n", label))
+    default:
+        file.WriteString(fmt.Sprintf("jnc %s\n", label))
+    }
+}
+
+// has to directly follow the arith instruction (flags)
+func (state *State) genOverflowCheck(file *bufio.Writer, t types.Type, op token.Token, unary bool) {
+    t = types.ResolveGeneric(t)
+    if !state.checkOverflow || t == nil || (t.GetKind() != types.Int && t.GetKind() != types.Uint) {
+        return
+    }
+
+    f,ok := state.identObj.Get("_overflow").(*identObj.Func)
+    if !ok {
+        return
+    }
+
+    state.checkCount++
+    jmpNoOverflow(file, t, fmt.Sprintf(".ovf%d", state.checkCount))
+
+    idx := state.str.Add(token.Token{ Type: token.Str, Str: OverflowMsg(t, op, unary) })
+    asm.MovRegVal(file, asm.RegDi, types.Ptr_Size, fmt.Sprintf("_str%d", idx))
+    asm.MovRegVal(file, asm.RegSi, types.U32_Size, fmt.Sprint(state.str.GetSize(idx)))
+    CallFn(file, f)
+
+    file.WriteString(fmt.Sprintf(".ovf%d:\n", state.checkCount))
+}
+
+// "<file>:<line>:<col>: <type> <op> overflowed" (as str literal)
+func OverflowMsg(t types.Type, op token.Token, unary bool) string {
+    what := "multiplication"
+    switch {
+    case unary:
+        what = "negation"
+    case op.Type == token.Plus:
+        what = "addition"
+    case op.Type == token.Minus:
+        what = "subtraction"
+    }
+
+    return fmt.Sprintf("\"%s: %v %s overflowed\"", strings.TrimPrefix(op.At(), "at: "), t, what)
+}
+
+// wrapping_add(a, b), saturating_sub(a, b), ...
+func (state *State) GenArithBuildIn(file *bufio.Writer, e *ast.FnCall) {
+    t := types.ResolveGeneric(e.GetType())
+    saturating := strings.HasPrefix(e.Ident.Name, "saturating_")
+
+    var op token.Token
+    switch strings.TrimPrefix(strings.TrimPrefix(e.Ident.Name, "wrapping_"), "saturating_") {
+    case "add":
+        op = token.Token{ Type: token.Plus, Str: "+", Pos: e.Ident.Pos }
+    case "sub":
+        op = token.Token{ Type: token.Minus, Str: "-", Pos: e.Ident.Pos }
+    case "mul":
+        op = token.Token{ Type: token.Mul, Str: "*", Pos: e.Ident.Pos }
+    }
+
+    state.genArith(file, &ast.Binary{ Operator: op, OperandL: e.Values[0], OperandR: e.Values[1], Type: t }, saturating)
+
+    if saturating {
+        state.genSaturate(file, t, op.Type)
+    }
+}
+
+// clamps rax to the min/max of t if the op before overflowed
+func (state *State) genSaturate(file *bufio.Writer, t types.Type, op token.TokenType) {
+    state.checkCount++
+    end := fmt.Sprintf(".ovf%d", state.checkCount)
+    jmpNoOverflow(file, t, end)
+
+    bits := t.Size() * 8
+    max := ^uint64(0) >> (64-bits)
+    if t.GetKind() == types.Int {
+        max >>= 1
+    }
+
+    switch {
+    case isSmallInt(t):
+        // the exact result is in eax (above max or below min)
+        min := "0"
+        if t.GetKind() == types.Int {
+            min = fmt.Sprint(-int64(max)-1)
+        }
+        file.WriteString(fmt.Sprintf("cmp eax, %d\n", max))
+        asm.MovRegVal(file, asm.RegA, types.I32_Size, fmt.Sprint(max))
+        file.WriteString(fmt.Sprintf("jg %s\n", end))
+        asm.MovRegVal(file, asm.RegA, types.I32_Size, min)
+
+    case t.GetKind() == types.Int:
+        // the sign of the wrapped result is the opposite of the real one
+        reg := asm.GetReg(asm.RegA, t.Size())
+        file.WriteString(fmt.Sprintf("test %s, %s\n", reg, reg))
+        asm.MovRegVal(file, asm.RegA, t.Size(), fmt.Sprint(max))
+        file.WriteString(fmt.Sprintf("js %s\n", end))
+        asm.MovRegVal(file, asm.RegA, t.Size(), fmt.Sprint(max+1))
+
+    case op == token.Plus:
+        asm.MovRegVal(file, asm.RegA, t.Size(), fmt.Sprint(max))
+    default:
+        asm.MovRegVal(file, asm.RegA, t.Size(), "0")
+    }
+
+    file.WriteString(end + ":\n")
+}
@@ -0,0 +1,371 @@
+package reach
+
+import (
+    "fmt"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/ast/identObj/vars"
+    "gamma/cmpTime/constVal"
+    "gamma/buildin"
+    "gamma/token"
+    "gamma/types"
+)
+
+/*
+reachability of the declarations (gen and gen/c skip the unreachable ones with -O1 and -O2)
+  * starts at the entry function and the funcs called by the generated code (malloc, exit, _signal, ...)
+  * funcs, global vars, consts, strs and arrays used in a reachable func/var/const are reachable
+  * the vtable and the vtable funcs of an impl are reachable if a value is passed as the interface
+  * a call on an interface or generic type reaches every impl func with that name
+    (the impl is only known while generating)
+*/
+
+type Set struct {
+    fns map[token.Pos]bool
+    buildIns map[string]bool    // asm build-ins (no declaration)
+    vars map[token.Pos]bool
+    consts map[token.Pos]bool
+    interfaces map[string]bool
+
+    fnDecls map[token.Pos]*ast.DefFn
+    varDecls map[token.Pos]*ast.DefVar
+    constDecls map[token.Pos]*ast.DefConst
+    topFns map[string]*ast.DefFn    // not in an impl
+    implFns map[string][]*ast.DefFn
+    impls map[string][]*ast.Impl    // interface name -> impls
+    order []ast.Decl                // every declaration (in source order)
+
+    strs map[uint64]bool
+    arrs map[uint64]bool
+    state *State
+}
+
+// a nil *Set reaches everything (-O0)
+func (state *State) Reachable(a ast.Ast, roots []string) *Set {
+    s := &Set{
+        fns: make(map[token.Pos]bool),
+        buildIns: make(map[string]bool),
+        vars: make(map[token.Pos]bool),
+        consts: make(map[token.Pos]bool),
+        interfaces: make(map[string]bool),
+        fnDecls: make(map[token.Pos]*ast.DefFn),
+        varDecls: make(map[token.Pos]*ast.DefVar),
+        constDecls: make(map[token.Pos]*ast.DefConst),
+        topFns: make(map[string]*ast.DefFn),
+        implFns: make(map[string][]*ast.DefFn),
+        impls: make(map[string][]*ast.Impl),
+        strs: make(map[uint64]bool),
+        arrs: make(map[uint64]bool),
+        state: state,
+    }
+
+    s.index(a.Decls)
+
+    s.markFnName(a.Entry())
+    for _,name := range roots {
+        s.markFnName(name)
+    }
+
+    // literals added while generating are always used
+    state.str.SetUsed(s.strs)
+    state.array.SetUsed(s.arrs)
+
+    return s
+}
+
+func (s *Set) Fn(f *identObj.Func) bool {
+    return s == nil || s.fns[f.GetPos()]
+}
+
+func (s *Set) BuildIn(name string) bool {
+    return s == nil || s.buildIns[name]
+}
+
+// local vars are reachable with their func
+func (s *Set) Var(v vars.Var) bool {
+    if _,ok := v.(*vars.GlobalVar); !ok {
+        return true
+    }
+
+    return s == nil || s.vars[v.GetPos()]
+}
+
+// the vtable of the impl
+func (s *Set) VTable(i *identObj.Impl) bool {
+    return s == nil || s.interfaces[i.GetInterfaceName()]
+}
+
+// the skipped funcs, global vars and vtables (for -v)
+func (s *Set) Unused() (res []string) {
+    if s == nil {
+        return nil
+    }
+
+    for _,d := range s.order {
+        switch d := d.(type) {
+        case *ast.DefFn:
+            if !s.Fn(d.FnHead.F) {
+                res = append(res, fmt.Sprintf("fn %s (%s)", d.FnHead.F.GetMangledName(), d.FnHead.Name.Pos.At()))
+            }
+        case *ast.DefVar:
+            if !s.Var(d.V) {
+                res = append(res, fmt.Sprintf("global %s (%s)", d.V.GetName(), d.V.GetPos().At()))
+            }
+        case *ast.Impl:
+            if d.Impl.HasInterface() && !s.VTable(&d.Impl) {
+                res = append(res, fmt.Sprintf("vtable %s of %v (%s)", d.Impl.GetInterfaceName(), d.Impl.GetDstType(), d.Pos.At()))
+            }
+        }
+    }
+
+    for i := uint64(0); i < s.state.str.Count(); i++ {
+        if !s.state.str.IsUsed(i) {
+            res = append(res, fmt.Sprintf("str _str%d", i))
+        }
+    }
+    for i := uint64(0); i < s.state.array.Count(); i++ {
+        if !s.state.array.IsUsed(i) {
+            res = append(res, fmt.Sprintf("array _arr%d", i))
+        }
+    }
+
+    return res
+}
+
+func (s *Set) index(decls []ast.Decl) {
+    for _,d := range decls {
+        switch d := d.(type) {
+        case *ast.Import:
+            s.index(d.Decls)
+            continue
+
+        case *ast.DefFn:
+            s.fnDecls[d.FnHead.F.GetPos()] = d
+            s.topFns[d.FnHead.F.GetName()] = d
+
+        case *ast.Impl:
+            for i := range d.FnDefs {
+                f := &d.FnDefs[i]
+                s.fnDecls[f.FnHead.F.GetPos()] = f
+                s.implFns[f.FnHead.F.GetName()] = append(s.implFns[f.FnHead.F.GetName()], f)
+            }
+            if d.Impl.HasInterface() {
+                s.impls[d.Impl.GetInterfaceName()] = append(s.impls[d.Impl.GetInterfaceName()], d)
+            }
+
+        case *ast.DefVar:
+            s.varDecls[d.V.GetPos()] = d
+
+        case *ast.DefConst:
+            s.constDecls[d.C.GetPos()] = d
+        }
+
+        s.order = append(s.order, d)
+    }
+}
+
+func (s *Set) markFnName(name string) {
+    if d,ok := s.topFns[name]; ok {
+        s.markFn(d.FnHead.F)
+    } else {
+        s.markBuildIn(name)
+    }
+}
+
+func (s *Set) markFn(f *identObj.Func) {
+    if f.GetPos() == (token.Pos{}) {
+        s.markBuildIn(f.GetName())
+        return
+    }
+
+    if s.fns[f.GetPos()] {
+        return
+    }
+    s.fns[f.GetPos()] = true
+
+    if d,ok := s.fnDecls[f.GetPos()]; ok {
+        s.walk(&d.Block)
+    }
+}
+
+func (s *Set) markBuildIn(name string) {
+    if s.buildIns[name] {
+        return
+    }
+    s.buildIns[name] = true
+
+    for _,dep := range buildin.Deps[name] {
+        s.markFnName(dep)
+    }
+}
+
+func (s *Set) markImplFns(name string) {
+    for _,d := range s.implFns[name] {
+        s.markFn(d.FnHead.F)
+    }
+}
+
+func (s *Set) markInterface(name string) {
+    if s.interfaces[name] {
+        return
+    }
+    s.interfaces[name] = true
+
+    for _,d := range s.impls[name] {
+        for _,fnName := range d.Impl.GetVTableFuncNames() {
+            for i := range d.FnDefs {
+                if d.FnDefs[i].FnHead.F.GetName() == fnName {
+                    s.markFn(d.FnDefs[i].FnHead.F)
+                }
+            }
+        }
+    }
+}
+
+func (s *Set) walk(n ast.Node) {
+    ast.Inspect(n, func(n ast.Node) bool {
+        switch n := n.(type) {
+        case *ast.Ident:
+            s.markObj(n.Obj)
+
+        case *ast.FnCall:
+            s.markCall(n)
+
+            // the str literal of fmt and _asm is not generated as data
+            switch n.Ident.Name {
+            case "fmt":
+                for _,v := range n.Values[1:] {
+                    s.walk(v)
+                }
+                return false
+            case "_asm":
+                return false
+            }
+
+        case *ast.StrLit:
+            s.strs[n.Idx] = true
+
+        case *ast.ArrayLit:
+            if n.Idx != ^uint64(0) {
+                s.markArr(n.Idx)
+            }
+
+        case *ast.Binary:
+            if n.OperandR != nil && n.OperandL.GetType() != nil && n.OperandL.GetType().GetKind() == types.Str {
+                if n.Operator.Type == token.Plus {
+                    s.markBuildIn("_str_concat")
+                } else {
+                    s.markBuildIn("_str_cmp")
+                }
+            }
+        }
+
+        return true
+    })
+}
+
+func (s *Set) markObj(obj identObj.IdentObj) {
+    switch obj := obj.(type) {
+    case *identObj.Func:
+        s.markFn(obj)
+
+    case *vars.GlobalVar:
+        if !s.vars[obj.GetPos()] {
+            s.vars[obj.GetPos()] = true
+            if d,ok := s.varDecls[obj.GetPos()]; ok {
+                s.walk(d)
+            }
+        }
+
+    case *identObj.Const:
+        if !s.consts[obj.GetPos()] {
+            s.consts[obj.GetPos()] = true
+            s.markVal(obj.GetVal())
+            if d,ok := s.constDecls[obj.GetPos()]; ok {
+                s.walk(d)
+            }
+        }
+    }
+}
+
+// the strs and arrays of a value folded while parsing ("a" + "b" is a new str)
+func (s *Set) markVal(v constVal.ConstVal) {
+    switch v := v.(type) {
+    case *constVal.StrConst:
+        s.strs[uint64(*v)] = true
+
+    case *constVal.ArrConst:
+        if v.Idx == ^uint64(0) {     // inner literal of a nested array
+            for _,e := range v.Elems {
+                s.markVal(e)
+            }
+        } else {
+            s.markArr(v.Idx)
+        }
+
+    case *constVal.StructConst:
+        for _,f := range v.Fields {
+            s.markVal(f)
+        }
+
+    case *constVal.EnumConst:
+        s.markVal(v.Elem)
+    }
+}
+
+func (s *Set) markArr(idx uint64) {
+    if !s.arrs[idx] {
+        s.arrs[idx] = true
+        for _,v := range s.state.array.GetValues(idx) {
+            s.markVal(v)
+        }
+    }
+}
+
+func (s *Set) markCall(e *ast.FnCall) {
+    s.markFn(e.F)
+
+    if e.F.FnSrc != nil {
+        if k := e.F.FnSrc.GetKind(); k == types.Interface || k == types.Generic {
+            s.markImplFns(e.F.GetName())
+        }
+    }
+
+    // fmt(...) is converted to str concatenations with to_str
+    if e.Ident.Name == "fmt" {
+        s.markBuildIn("_str_concat")
+        for _,v := range e.Values[1:] {
+            s.markToStr(v.GetType())
+        }
+    }
+
+    // values passed as interface (vtable)
+    args := e.F.GetArgs()
+    for i,v := range e.Values {
+        if i >= len(args) || args[i] == nil || v.GetType() == nil {
+            break
+        }
+
+        if t,ok := args[i].(types.InterfaceType); ok && v.GetType().GetKind() != types.Interface {
+            s.markInterface(t.Name)
+        }
+    }
+}
+
+// the to_str used by fmt for a value of type t (see gen.ConvertFmt)
+func (s *Set) markToStr(t types.Type) {
+    if t == nil || t.GetKind() == types.Str {
+        return
+    }
+
+    if t.GetKind() == types.Generic || t.GetKind() == types.Interface {
+        s.markImplFns("to_str")
+        return
+    }
+
+    if f := s.state.identObj.GetFnFromFnSrc(t, "to_str"); f != nil {
+        s.markFn(f)
+    } else {
+        s.markImplFns("to_str")
+    }
+}
@@ -0,0 +1,18 @@
+package reach
+
+import (
+    "gamma/ast/identObj"
+    "gamma/types/array"
+    "gamma/types/str"
+)
+
+// the states used to find the reachable decls (see gamma/compiler)
+type State struct {
+    identObj *identObj.State
+    array *array.State
+    str *str.State
+}
+
+func NewState(identObj *identObj.State, array *array.State, str *str.State) *State {
+    return &State{ identObj: identObj, array: array, str: str }
+}
@@ -0,0 +1,75 @@
+package gen
+
+import (
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/buildin"
+    "gamma/cmpTime"
+    "gamma/diag"
+    "gamma/gen/asm/x86_64"
+    "gamma/gen/asm/x86_64/conditions"
+    "gamma/gen/asm/x86_64/loops"
+    "gamma/gen/asm/x86_64/nasm"
+    "gamma/gen/asm/x86_64/vtable"
+    "gamma/gen/reach"
+    "gamma/types/array"
+    "gamma/types/str"
+)
+
+// options and the generated checks of one compilation (see gamma/compiler)
+type State struct {
+    optLevel uint
+    reachable *reach.Set
+
+    checkConsts bool
+    runtimeOnly bool    // no folding (runtime code of a checked expression)
+    checkEntry string
+    globalChecks []ast.Expr
+
+    checkOverflow bool
+    checkCount uint     // labels of the checks in the current function (see divCheck.go too)
+
+    identObj *identObj.State
+    buildin *buildin.State
+    cmpTime *cmpTime.State
+    diag *diag.State
+    asm *asm.State
+    cond *cond.State
+    loops *loops.State
+    nasm *nasm.State
+    vtable *vtable.State
+    reach *reach.State
+    array *array.State
+    str *str.State
+}
+
+func NewState(
+    identObj *identObj.State,
+    buildin *buildin.State,
+    cmpTime *cmpTime.State,
+    diag *diag.State,
+    asm *asm.State,
+    cond *cond.State,
+    loops *loops.State,
+    nasm *nasm.State,
+    vtable *vtable.State,
+    reach *reach.State,
+    array *array.State,
+    str *str.State,
+) *State {
+    return &State{
+        optLevel: O1,
+        identObj: identObj,
+        buildin: buildin,
+        cmpTime: cmpTime,
+        diag: diag,
+        asm: asm,
+        cond: cond,
+        loops: loops,
+        nasm: nasm,
+        vtable: vtable,
+        reach: reach,
+        array: array,
+        str: str,
+    }
+}
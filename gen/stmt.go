@@ -1,76 +1,77 @@
 package gen
 
 import (
-    "os"
     "fmt"
     "bufio"
     "reflect"
     "gamma/token"
     "gamma/types"
     "gamma/types/addr"
-    "gamma/cmpTime"
     "gamma/cmpTime/constVal"
     "gamma/ast"
-    "gamma/ast/identObj"
     "gamma/ast/identObj/vars"
     "gamma/gen/asm/x86_64"
     "gamma/gen/asm/x86_64/loops"
     "gamma/gen/asm/x86_64/conditions"
 )
 
-func GenStmt(file *bufio.Writer, s ast.Stmt) {
+func (state *State) GenStmt(file *bufio.Writer, s ast.Stmt) {
+    if state.checkConsts {
+        state.genStmtChecks(file, s)
+    }
+
     switch s := s.(type) {
     case *ast.Assign:
-        GenAssign(file, s)
+        state.GenAssign(file, s)
 
     case *ast.Block:
-        GenBlock(file, s)
+        state.GenBlock(file, s)
 
     case *ast.If:
-        GenIf(file, s)
+        state.GenIf(file, s)
     case *ast.Else:
-        GenElse(file, s)
+        state.GenElse(file, s)
     case *ast.Elif:
-        GenElif(file, s)
+        state.GenElif(file, s)
 
     case *ast.Switch:
-        GenSwitch(file, s)
+        state.GenSwitch(file, s)
 
     case *ast.Through:
-        GenThrough(file, s)
+        state.GenThrough(file, s)
 
     case *ast.For:
-        GenFor(file, s)
+        state.GenFor(file, s)
     case *ast.While:
-        GenWhile(file, s)
+        state.GenWhile(file, s)
 
     case *ast.Break:
-        GenBreak(file, s)
+        state.GenBreak(file, s)
     case *ast.Continue:
-        GenContinue(file, s)
+        state.GenContinue(file, s)
     case *ast.Ret:
-        GenRet(file, s)
+        state.GenRet(file, s)
 
     case *ast.DeclStmt:
-        GenDecl(file, s.Decl)
+        state.GenDecl(file, s.Decl)
     case *ast.ExprStmt:
-        GenExpr(file, s.Expr)
+        state.GenExpr(file, s.Expr)
 
     case *ast.Case:
-        fmt.Fprintln(os.Stderr, "[ERROR] Cases outside of a switch are not allowed")
-        fmt.Fprintln(os.Stderr, "\t" + s.At())
-        os.Exit(1)
+        state.diag.Error("Cases outside of a switch are not allowed")
+        state.diag.At(s.At())
+        state.diag.Exit()
     case *ast.BadStmt:
-        fmt.Fprintln(os.Stderr, "[ERROR] bad statement")
-        fmt.Fprintln(os.Stderr, "\t" + s.At())
-        os.Exit(1)
+        state.diag.Error("bad statement")
+        state.diag.At(s.At())
+        state.diag.Exit()
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] GenStmt for %v is not implemente yet\n", reflect.TypeOf(s))
-        os.Exit(1)
+        state.diag.Errorf("GenStmt for %v is not implemente yet", reflect.TypeOf(s))
+        state.diag.Exit()
     }
 }
 
-func GenAssign(file *bufio.Writer, s *ast.Assign) {
+func (state *State) GenAssign(file *bufio.Writer, s *ast.Assign) {
     t := s.Dest.GetType()
     var addr addr.Addr
 
@@ -78,76 +79,102 @@ func GenAssign(file *bufio.Writer, s *ast.Assign) {
         if v,ok := ident.Obj.(vars.Var); ok {
             addr = v.Addr()
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected identifier %s to be a variable but got %v\n", ident.Name, reflect.TypeOf(ident.Obj))
-            fmt.Fprintln(os.Stderr, "\t" + ident.At())
-            os.Exit(1)
+            state.diag.Errorf("expected identifier %s to be a variable but got %v", ident.Name, reflect.TypeOf(ident.Obj))
+            state.diag.At(ident.At())
+            state.diag.Exit()
         }
     } else {
-        ExprAddrToReg(file, s.Dest, asm.RegC)
+        state.ExprAddrToReg(file, s.Dest, asm.RegC)
         addr = asm.RegAsAddr(asm.RegC)
     }
 
-    if c := cmpTime.ConstEval(s.Value); c != nil {
-        DerefSetVal(file, addr, t, c)
+    if c := state.cmpTime.ConstEval(s.Value); c != nil {
+        state.DerefSetVal(file, addr, t, c)
     } else if ident,ok := s.Value.(*ast.Ident); ok {
         if v,ok := ident.Obj.(vars.Var); ok {
-            DerefSetVar(file, addr, v)
+            state.DerefSetVar(file, addr, v)
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected identifier %s to be a variable but got %v\n", ident.Name, reflect.TypeOf(ident.Obj))
-            fmt.Fprintln(os.Stderr, "\t" + ident.At())
-            os.Exit(1)
+            state.diag.Errorf("expected identifier %s to be a variable but got %v", ident.Name, reflect.TypeOf(ident.Obj))
+            state.diag.At(ident.At())
+            state.diag.Exit()
         }
     } else {
-        DerefSetExpr(file, addr, t, s.Value)
+        state.DerefSetExpr(file, addr, t, s.Value)
     }
 }
 
-func GenBlock(file *bufio.Writer, s *ast.Block) {
+func (state *State) GenBlock(file *bufio.Writer, s *ast.Block) {
     for _,stmt := range s.Stmts {
-        GenStmt(file, stmt)
+        state.GenStmt(file, stmt)
     }
 }
 
-func GenIfCond(file *bufio.Writer, e ast.Expr, hasElse bool) uint {
+func (state *State) GenIfCond(file *bufio.Writer, e ast.Expr, hasElse bool) uint {
     switch e := e.(type) {
     case *ast.Ident:
-        return cond.IfVar(file, e.Obj.Addr(), hasElse)
+        return state.cond.IfVar(file, e.Obj.Addr(), hasElse)
 
     case *ast.Unwrap:
-        idType := e.EnumType.IdType
-        id := e.EnumType.GetElemID(e.ElemName.Str)
+        if e.EnumType.IsNiche() {
+            state.genUnwrapNiche(file, e)
+            return state.cond.IfExpr(file, hasElse)
+        }
 
-        stackSize := identObj.GetStackSize()
-        ExprAddrToReg(file, e.SrcExpr, asm.RegD)
-        reuseableSpace := stackSize < identObj.GetStackSize()
+        stackSize := state.identObj.GetStackSize()
+        state.ExprAddrToReg(file, e.SrcExpr, asm.RegD)
+        reuseableSpace := stackSize < state.identObj.GetStackSize()
 
-        asm.MovRegDeref(file, asm.RegA, asm.RegAsAddr(asm.RegD), idType.Size(), false)
-        asm.Eql(file, asm.GetAnyReg(asm.RegA, idType.Size()), fmt.Sprint(id))
+        genUnwrapCmp(file, e.EnumType, e.ElemName.Str)
 
-        count := cond.IfExpr(file, hasElse)
+        count := state.cond.IfExpr(file, hasElse)
 
         if v,ok := e.Obj.(*vars.LocalVar); ok {
             v.SetOffset(stackSize, false)
             if !reuseableSpace {
-                identObj.IncStackSize(v.GetType())
-                DerefSetDeref(file, v.Addr(), v.GetType(), asm.RegAsAddr(asm.RegD).Offseted(int64(idType.Size())))
+                state.identObj.IncStackSize(v.GetType())
+                state.DerefSetDeref(file, v.Addr(), v.GetType(), asm.RegAsAddr(asm.RegD).Offseted(int64(e.EnumType.ContentOffset())))
             }
         }
 
         return count
 
     default:
-        GenExpr(file, e)
-        return cond.IfExpr(file, hasElse)
+        state.GenExpr(file, e)
+        return state.cond.IfExpr(file, hasElse)
+    }
+}
+
+// al = 1 if the enum at RegD is elem
+func genUnwrapCmp(file *bufio.Writer, t types.EnumType, elem string) {
+    asm.MovRegDeref(file, asm.RegA, asm.RegAsAddr(asm.RegD), t.IdType.Size(), false)
+    asm.Eql(file, asm.GetAnyReg(asm.RegA, t.IdType.Size()), fmt.Sprint(t.GetElemID(elem)))
+}
+
+// niche enums are only the pointer (no address needed, 0 is the elem without content)
+func (state *State) genUnwrapNiche(file *bufio.Writer, e *ast.Unwrap) {
+    state.GenExpr(file, e.SrcExpr)
+
+    if v,ok := e.Obj.(*vars.LocalVar); ok {
+        v.SetOffset(state.identObj.GetStackSize(), false)
+        state.identObj.IncStackSize(v.GetType())
+        asm.MovDerefReg(file, v.Addr(), types.Ptr_Size, asm.RegA)
+    }
+
+    if ptrElem,_,_ := e.EnumType.NicheElems(); e.ElemName.Str == ptrElem {
+        asm.Neq(file, asm.GetReg(asm.RegA, types.Ptr_Size), "0")
+    } else {
+        asm.Eql(file, asm.GetReg(asm.RegA, types.Ptr_Size), "0")
     }
 }
 
-func GenIf(file *bufio.Writer, s *ast.If) {
-    if val,ok := cmpTime.ConstEval(s.Cond).(*constVal.BoolConst); ok {
+func (state *State) GenIf(file *bufio.Writer, s *ast.If) {
+    if val,ok := state.cmpTime.ConstEval(s.Cond).(*constVal.BoolConst); ok {
         if bool(*val) {
-            GenBlock(file, &s.Block)
+            state.GenBlock(file, &s.Block)
         } else if s.Else != nil {
-            GenBlock(file, &s.Else.Block)
+            state.GenBlock(file, &s.Else.Block)
+        } else if s.Elif != nil {
+            state.GenElif(file, s.Elif)
         }
 
         return
@@ -155,17 +182,17 @@ func GenIf(file *bufio.Writer, s *ast.If) {
 
     hasElse := s.Else != nil || s.Elif != nil
 
-    count := GenIfCond(file, s.Cond, hasElse)
+    count := state.GenIfCond(file, s.Cond, hasElse)
 
-    GenBlock(file, &s.Block)
+    state.GenBlock(file, &s.Block)
 
     if hasElse {
         cond.ElseStart(file, count)
 
         if s.Else != nil {
-            GenElse(file, s.Else)
+            state.GenElse(file, s.Else)
         } else {
-            GenElif(file, s.Elif)
+            state.GenElif(file, s.Elif)
         }
 
         cond.ElseEnd(file, count)
@@ -174,119 +201,128 @@ func GenIf(file *bufio.Writer, s *ast.If) {
     cond.IfEnd(file, count)
 }
 
-func GenElif(file *bufio.Writer, s *ast.Elif) {
-    GenIf(file, (*ast.If)(s))
+func (state *State) GenElif(file *bufio.Writer, s *ast.Elif) {
+    state.GenIf(file, (*ast.If)(s))
 }
 
-func GenElse(file *bufio.Writer, s *ast.Else) {
-    GenBlock(file, &s.Block)
+func (state *State) GenElse(file *bufio.Writer, s *ast.Else) {
+    state.GenBlock(file, &s.Block)
 }
 
-func GenCaseCond(file *bufio.Writer, condExpr ast.Expr) {
-    cond.CaseStart(file)
+func (state *State) GenCaseCond(file *bufio.Writer, condExpr ast.Expr) {
+    state.cond.CaseStart(file)
 
     switch e := condExpr.(type) {
     case *ast.Ident:
-        cond.CaseVar(file, e.Obj.Addr())
+        state.cond.CaseVar(file, e.Obj.Addr())
 
     case *ast.Unwrap:
-        idType := e.EnumType.IdType
-        id := e.EnumType.GetElemID(e.ElemName.Str)
+        if e.EnumType.IsNiche() {
+            state.genUnwrapNiche(file, e)
+            state.cond.CaseExpr(file)
+            break
+        }
 
-        ExprAddrToReg(file, e.SrcExpr, asm.RegD)
-        asm.MovRegDeref(file, asm.RegA, asm.RegAsAddr(asm.RegD), idType.Size(), false)
-        asm.Eql(file, asm.GetAnyReg(asm.RegA, idType.Size()), fmt.Sprint(id))
+        state.ExprAddrToReg(file, e.SrcExpr, asm.RegD)
+        genUnwrapCmp(file, e.EnumType, e.ElemName.Str)
 
-        cond.CaseExpr(file)
+        state.cond.CaseExpr(file)
 
         if v,ok := e.Obj.(*vars.LocalVar); ok {
-            v.SetOffset(identObj.GetStackSize(), false)
-            identObj.IncStackSize(v.GetType())
-            DerefSetDeref(file, v.Addr(), v.GetType(), asm.RegAsAddr(asm.RegD).Offseted(int64(idType.Size())))
+            v.SetOffset(state.identObj.GetStackSize(), false)
+            state.identObj.IncStackSize(v.GetType())
+            state.DerefSetDeref(file, v.Addr(), v.GetType(), asm.RegAsAddr(asm.RegD).Offseted(int64(e.EnumType.ContentOffset())))
         }
 
     default:
-        GenExpr(file, e)
-        cond.CaseExpr(file)
+        state.GenExpr(file, e)
+        state.cond.CaseExpr(file)
     }
 }
 
-func GenCase(file *bufio.Writer, s *ast.Case) {
+func (state *State) GenCase(file *bufio.Writer, s *ast.Case) {
     if s.Cond == nil {
-        cond.CaseStart(file)
-        cond.CaseBody(file)
-        GenStmt(file, s.Stmt)
+        state.cond.CaseStart(file)
+        state.cond.CaseBody(file)
+        state.GenStmt(file, s.Stmt)
         return
     }
 
-    if val,ok := cmpTime.ConstEval(s.Cond).(*constVal.BoolConst); ok {
+    if val,ok := state.cmpTime.ConstEval(s.Cond).(*constVal.BoolConst); ok {
         if bool(*val) {
-            cond.CaseStart(file)
-            cond.CaseBody(file)
-            GenStmt(file, s.Stmt)
-            cond.CaseBodyEnd(file)
+            state.cond.CaseStart(file)
+            state.cond.CaseBody(file)
+            state.GenStmt(file, s.Stmt)
+            state.cond.CaseBodyEnd(file)
         }
 
         return
     }
 
-    GenCaseCond(file, s.Cond)
+    state.GenCaseCond(file, s.Cond)
 
-    cond.CaseBody(file)
-    GenStmt(file, s.Stmt)
-    cond.CaseBodyEnd(file)
+    state.cond.CaseBody(file)
+    state.GenStmt(file, s.Stmt)
+    state.cond.CaseBodyEnd(file)
 }
 
-func GenSwitch(file *bufio.Writer, s *ast.Switch) {
-    cond.StartSwitch()
+func (state *State) GenSwitch(file *bufio.Writer, s *ast.Switch) {
+    state.cond.StartSwitch()
+
+    if d := state.getDispatch(casesConds(s.Cases)); d != nil {
+        state.genDispatch(file, d)
+        state.genDispatchedCases(file, len(s.Cases), func(i int) { state.GenStmt(file, s.Cases[i].Stmt) })
+        state.cond.EndSwitch(file)
+        return
+    }
 
     // TODO: detect unreachable code and throw error
     // * a1 < but case 420 before 86
     // * cases with same cond
     for i := 0; i < len(s.Cases)-1; i++ {
-        GenCase(file, &s.Cases[i])
+        state.GenCase(file, &s.Cases[i])
     }
-    cond.InLastCase()
-    GenCase(file, &s.Cases[len(s.Cases)-1])
+    state.cond.InLastCase()
+    state.GenCase(file, &s.Cases[len(s.Cases)-1])
 
-    cond.EndSwitch(file)
+    state.cond.EndSwitch(file)
 }
 
-func GenThrough(file *bufio.Writer, s *ast.Through) {
-    cond.Through(file, s.Pos)
+func (state *State) GenThrough(file *bufio.Writer, s *ast.Through) {
+    state.cond.Through(file, s.Pos)
 }
 
-func GenWhile(file *bufio.Writer, s *ast.While) {
+func (state *State) GenWhile(file *bufio.Writer, s *ast.While) {
     if s.Def != nil {
-        GenDefVar(file, s.Def)
+        state.GenDefVar(file, s.Def)
     }
 
-    if val,ok := cmpTime.ConstEval(s.Cond).(*constVal.BoolConst); ok {
+    if val,ok := state.cmpTime.ConstEval(s.Cond).(*constVal.BoolConst); ok {
         if bool(*val) {
-            count := loops.WhileStart(file)
-            GenBlock(file, &s.Block)
-            loops.WhileEnd(file, count)
+            count := state.loops.WhileStart(file)
+            state.GenBlock(file, &s.Block)
+            state.loops.WhileEnd(file, count)
         }
 
         return
     }
 
-    count := loops.WhileStart(file)
+    count := state.loops.WhileStart(file)
     if e,ok := s.Cond.(*ast.Ident); ok {
-        loops.WhileVar(file, e.Obj.Addr())
+        state.loops.WhileVar(file, e.Obj.Addr())
     } else {
-        GenExpr(file, s.Cond)
-        loops.WhileExpr(file)
+        state.GenExpr(file, s.Cond)
+        state.loops.WhileExpr(file)
     }
 
-    GenBlock(file, &s.Block)
-    loops.WhileEnd(file, count)
+    state.GenBlock(file, &s.Block)
+    state.loops.WhileEnd(file, count)
 }
 
-func GenFor(file *bufio.Writer, s *ast.For) {
-    GenDefVar(file, &s.Def)
+func (state *State) GenFor(file *bufio.Writer, s *ast.For) {
+    state.GenDefVar(file, &s.Def)
 
-    count := loops.ForStart(file)
+    count := state.loops.ForStart(file)
     if s.Limit != nil {
         cond := ast.Binary{
             Operator: token.Token{ Type: token.Lss },
@@ -294,38 +330,38 @@ func GenFor(file *bufio.Writer, s *ast.For) {
             OperandR: s.Limit,
             Type: types.BoolType{},
         }
-        GenBinary(file, &cond)
-        loops.ForExpr(file)
+        state.GenBinary(file, &cond)
+        state.loops.ForExpr(file)
     }
 
-    GenBlock(file, &s.Block)
+    state.GenBlock(file, &s.Block)
     loops.ForBlockEnd(file, count)
 
     step := ast.Assign{
         Dest: &ast.Ident{ Obj: s.Def.V, Name: s.Def.V.GetName(), Pos: s.Def.V.GetPos() },
         Value: s.Step,
     }
-    GenAssign(file, &step)
-    loops.ForEnd(file, count)
+    state.GenAssign(file, &step)
+    state.loops.ForEnd(file, count)
 }
 
-func GenBreak(file *bufio.Writer, s *ast.Break) {
-    if loops.InLoop() {
-        loops.Break(file)
-    } else if cond.InSwitch() {
-        cond.Break(file)
+func (state *State) GenBreak(file *bufio.Writer, s *ast.Break) {
+    if state.loops.InLoop() {
+        state.loops.Break(file)
+    } else if state.cond.InSwitch() {
+        state.cond.Break(file)
     } else {
-        fmt.Fprintln(os.Stderr, "[ERROR] break can only be used inside of a switch or a loop")
-        fmt.Fprintln(os.Stderr, "\t" + s.At())
-        os.Exit(1)
+        state.diag.Error("break can only be used inside of a switch or a loop")
+        state.diag.At(s.At())
+        state.diag.Exit()
     }
 }
 
-func GenContinue(file *bufio.Writer, s *ast.Continue) {
-    loops.Continue(file)
+func (state *State) GenContinue(file *bufio.Writer, s *ast.Continue) {
+    state.loops.Continue(file)
 }
 
-func GenRet(file *bufio.Writer, s *ast.Ret) {
+func (state *State) GenRet(file *bufio.Writer, s *ast.Ret) {
     if s.RetExpr != nil {
         t := s.F.GetRetType() 
         if s.F.IsGeneric() {
@@ -339,24 +375,24 @@ func GenRet(file *bufio.Writer, s *ast.Ret) {
 
             switch t := t.(type) {
             case types.StructType:
-                if val := cmpTime.ConstEval(s.RetExpr); val != nil {
-                    RetBigStructLit(file, t, *val.(*constVal.StructConst))
+                if val := state.cmpTime.ConstEval(s.RetExpr); val != nil {
+                    state.RetBigStructLit(file, t, *val.(*constVal.StructConst))
                 } else if ident,ok := s.RetExpr.(*ast.Ident); ok {
-                    RetBigStructVar(file, t, ident.Obj.(vars.Var))
+                    state.RetBigStructVar(file, t, ident.Obj.(vars.Var))
                 } else {
-                    RetBigStructExpr(file, asm.RegAsAddr(asm.RegC), s.RetExpr)
+                    state.RetBigStructExpr(file, asm.RegAsAddr(asm.RegC), s.RetExpr)
                 }
             case types.VecType, types.EnumType:
                 // TODO: Lit and Var
-                RetBigStructExpr(file, asm.RegAsAddr(asm.RegC), s.RetExpr)
+                state.RetBigStructExpr(file, asm.RegAsAddr(asm.RegC), s.RetExpr)
             default:
-                fmt.Fprintln(os.Stderr, "[ERROR] (internal) unreachable GenRet")
-                os.Exit(1)
+                state.diag.Error("(internal) unreachable GenRet")
+                state.diag.Exit()
             }
 
             asm.MovRegReg(file, asm.RegA, asm.RegC, types.Ptr_Size)
         } else {
-            GenExpr(file, s.RetExpr)
+            state.GenExpr(file, s.RetExpr)
         }
     }
     FnEnd(file)
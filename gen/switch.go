@@ -0,0 +1,243 @@
+package gen
+
+import (
+    "sort"
+    "bufio"
+    "gamma/token"
+    "gamma/types"
+    "gamma/cmpTime/constVal"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/gen/asm/x86_64"
+)
+
+// switches with less cases get compared one by one
+const minDispatchCases = 4
+// max ratio of jump table entries to case values
+const maxJumpTableSpread = 3
+
+type caseVal struct {
+    val int64       // uint64 values are stored as their bit pattern
+    caseIdx uint    // starting at 1
+}
+
+type dispatch struct {
+    val ast.Expr
+    signed bool
+    vals []caseVal
+    defaultCase uint    // 0 -> no default case
+    state *State
+}
+
+// switches like "if x == { 1: ...; 2, 3: ...; _: ... }"
+// over int, uint, char or enum id constants
+func (state *State) getDispatch(conds []ast.Expr) *dispatch {
+    if state.optLevel < O1 {
+        return nil
+    }
+
+    d := dispatch{ state: state }
+    seen := make(map[int64]bool)
+
+    for i,c := range conds {
+        if c == nil {
+            d.defaultCase = uint(i+1)
+            continue
+        }
+
+        if !d.addCaseVals(c, uint(i+1), seen) {
+            return nil
+        }
+    }
+
+    if d.val == nil || len(d.vals) < minDispatchCases {
+        return nil
+    }
+
+    if state.cmpTime.ConstEval(d.val) != nil {
+        return nil
+    }
+
+    // the linear compare chain evaluates the value once per case
+    // (f() in "if f() == { ... }" has to be called the same number of times)
+    if !NoSideEffects(d.val) {
+        return nil
+    }
+
+    switch t := d.val.GetType().(type) {
+    case types.IntType:
+        d.signed = true
+    case types.UintType, types.CharType:
+    case types.EnumType:
+        if types.IsBigStruct(t) || t.IsNiche() {
+            return nil
+        }
+    default:
+        return nil
+    }
+
+    sort.SliceStable(d.vals, func(i, j int) bool {
+        if d.signed {
+            return d.vals[i].val < d.vals[j].val
+        }
+        return uint64(d.vals[i].val) < uint64(d.vals[j].val)
+    })
+
+    return &d
+}
+
+func (d *dispatch) addCaseVals(cond ast.Expr, caseIdx uint, seen map[int64]bool) bool {
+    b,ok := cond.(*ast.Binary)
+    if !ok {
+        return false
+    }
+
+    switch b.Operator.Type {
+    case token.Or:
+        return d.addCaseVals(b.OperandL, caseIdx, seen) && d.addCaseVals(b.OperandR, caseIdx, seen)
+
+    case token.Eql:
+        if d.val == nil {
+            d.val = b.OperandL
+        } else if !sameSwitchVal(d.val, b.OperandL) {
+            return false
+        }
+
+        var val int64
+        switch c := d.state.cmpTime.ConstEval(b.OperandR).(type) {
+        case *constVal.IntConst:
+            val = int64(*c)
+        case *constVal.UintConst:
+            val = int64(*c)
+        case *constVal.CharConst:
+            val = int64(*c)
+        case *constVal.EnumConst:
+            val = int64(c.Id)
+        default:
+            return false
+        }
+
+        // first case with the value wins
+        if !seen[val] {
+            seen[val] = true
+            d.vals = append(d.vals, caseVal{ val: val, caseIdx: caseIdx })
+        }
+        return true
+
+    default:
+        return false
+    }
+}
+
+func sameSwitchVal(e1 ast.Expr, e2 ast.Expr) bool {
+    if e1 == e2 {
+        return true
+    }
+
+    if i1,ok := e1.(*ast.Ident); ok {
+        if i2,ok := e2.(*ast.Ident); ok {
+            if _,ok := i1.Obj.(*identObj.Const); ok {
+                return false
+            }
+            return i1.Obj != nil && i1.Obj == i2.Obj
+        }
+    }
+
+    return false
+}
+
+func NoSideEffects(e ast.Expr) bool {
+    switch e := e.(type) {
+    case *ast.Ident, *ast.IntLit, *ast.CharLit, *ast.BoolLit:
+        return true
+    case *ast.Paren:
+        return NoSideEffects(e.Expr)
+    case *ast.Cast:
+        return NoSideEffects(e.Expr)
+    case *ast.Field:
+        return NoSideEffects(e.Obj)
+    case *ast.Indexed:
+        return NoSideEffects(e.ArrExpr) && NoSideEffects(e.Index)
+    case *ast.Unary:
+        return NoSideEffects(e.Operand)
+    case *ast.Binary:
+        return NoSideEffects(e.OperandL) && NoSideEffects(e.OperandR)
+    default:
+        return false
+    }
+}
+
+func (d *dispatch) isDense() bool {
+    first := d.vals[0].val
+    last := d.vals[len(d.vals)-1].val
+
+    span := uint64(last - first)
+    return span < uint64(len(d.vals) * maxJumpTableSpread)
+}
+
+// evaluates the switch value once and jumps directly to the case body
+func (state *State) genDispatch(file *bufio.Writer, d *dispatch) {
+    t := d.val.GetType()
+    size := t.Size()
+    if e,ok := t.(types.EnumType); ok {
+        size = e.IdType.Size()
+    }
+
+    state.GenExpr(file, d.val)
+    if size == types.I32_Size && d.signed {
+        file.WriteString("movsxd rax, eax\n")
+    } else if size < types.Ptr_Size {
+        asm.MovRegRegExtend(file, asm.RegA, types.Ptr_Size, asm.RegA, size, d.signed)
+    }
+
+    if d.isDense() {
+        first := d.vals[0].val
+        last := d.vals[len(d.vals)-1].val
+
+        targets := make([]uint, uint64(last - first) + 1)
+        for _,v := range d.vals {
+            targets[uint64(v.val - first)] = v.caseIdx
+        }
+
+        state.cond.JumpTable(file, first, targets, d.defaultCase)
+    } else {
+        vals := make([]int64, 0, len(d.vals))
+        targets := make([]uint, 0, len(d.vals))
+        for _,v := range d.vals {
+            vals = append(vals, v.val)
+            targets = append(targets, v.caseIdx)
+        }
+
+        state.cond.BinarySearch(file, vals, targets, d.defaultCase, d.signed)
+    }
+}
+
+// cases get entered only by the dispatch (no conditions in between)
+func (state *State) genDispatchedCases(file *bufio.Writer, caseCount int, genBody func(i int)) {
+    for i := 0; i < caseCount; i++ {
+        if i == caseCount-1 {
+            state.cond.InLastCase()
+        }
+
+        state.cond.CaseStart(file)
+        state.cond.CaseBody(file)
+        genBody(i)
+        state.cond.CaseBodyEnd(file)
+    }
+}
+
+func casesConds(cases []ast.Case) []ast.Expr {
+    conds := make([]ast.Expr, 0, len(cases))
+    for _,c := range cases {
+        conds = append(conds, c.Cond)
+    }
+    return conds
+}
+
+func xcasesConds(cases []ast.XCase) []ast.Expr {
+    conds := make([]ast.Expr, 0, len(cases))
+    for _,c := range cases {
+        conds = append(conds, c.Cond)
+    }
+    return conds
+}
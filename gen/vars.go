@@ -5,100 +5,105 @@ import (
 	"fmt"
 	"gamma/ast"
 	"gamma/ast/identObj/vars"
-	"gamma/cmpTime"
 	"gamma/cmpTime/constVal"
 	"gamma/gen/asm/x86_64"
-	"gamma/gen/asm/x86_64/nasm"
 	"gamma/token"
 	"gamma/types"
 	"gamma/types/addr"
-	"gamma/types/str"
-	"os"
 	"reflect"
 )
 
 // Define variable ----------------------------------------------------------
 
-func VarDefVal(file *bufio.Writer, v vars.Var, val constVal.ConstVal) {
+func (state *State) VarDefVal(file *bufio.Writer, v vars.Var, val constVal.ConstVal) {
     switch v := v.(type) {
     case *vars.GlobalVar:
-        globalVarDefVal(v, val)
+        state.globalVarDefVal(v, val)
 
     case *vars.LocalVar:
-        DerefSetVal(file, v.Addr(), v.GetType(), val)
+        state.DerefSetVal(file, v.Addr(), v.GetType(), val)
 
     default:
-        fmt.Fprintln(os.Stderr, "[ERROR] (unreachable) DefVarVal: v is neigther GlobalVar nor LocalVar")
-        os.Exit(1)
+        state.diag.Error("(unreachable) DefVarVal: v is neigther GlobalVar nor LocalVar")
+        state.diag.Exit()
     }
 }
 
-func VarDefExpr(file *bufio.Writer, v vars.Var, e ast.Expr) {
+func (state *State) VarDefExpr(file *bufio.Writer, v vars.Var, e ast.Expr) {
     if _,ok := v.(*vars.GlobalVar); ok {
-        fmt.Fprintln(os.Stderr, "[ERROR] defining a global variable with a non const expr is not allowed")
-        fmt.Fprintln(os.Stderr, "\t" + v.GetPos().At())
-        os.Exit(1)
+        state.diag.Error("defining a global variable with a non const expr is not allowed")
+        state.diag.At(v.GetPos().At())
+        state.diag.Exit()
     }
 
-    DerefSetExpr(file, v.Addr(), v.GetType(), e)
+    state.DerefSetExpr(file, v.Addr(), v.GetType(), e)
 }
 
-func globalVarDefVal(v *vars.GlobalVar, val constVal.ConstVal) {
-    nasm.AddData(fmt.Sprintf("%s:", v.GetName()))
-    defVal(v.GetType(), val, v.GetPos())
+func (state *State) globalVarDefVal(v *vars.GlobalVar, val constVal.ConstVal) {
+    state.nasm.AddData(fmt.Sprintf("%s:", v.GetName()))
+    state.defVal(v.GetType(), val, v.GetPos())
 }
 
-func defVal(t types.Type, val constVal.ConstVal, pos token.Pos) {
+func (state *State) defVal(t types.Type, val constVal.ConstVal, pos token.Pos) {
     switch c := val.(type) {
     case *constVal.StrConst:
-        defStr(c)
+        state.defStr(c)
 
     case *constVal.StructConst:
-        defStruct(c, pos)
+        state.defStruct(c, pos)
 
     case *constVal.EnumConst:
-        defEnum(c, pos)
+        state.defEnum(c, pos)
 
     case *constVal.ArrConst, *constVal.PtrConst, *constVal.BoolConst, *constVal.IntConst, *constVal.UintConst:
-        defBasic(val.GetVal(), t.Size())
+        state.defBasic(val.GetVal(), t.Size())
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] define global var of typ %v is not supported yet\n", t)
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+        state.diag.Errorf("define global var of typ %v is not supported yet", t)
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 }
 
-func defEnum(val *constVal.EnumConst, pos token.Pos) {
-    defBasic(fmt.Sprint(val.Id), val.Type.IdType.Size())
-    defVal(val.ElemType, val.Elem, pos)
+func (state *State) defEnum(val *constVal.EnumConst, pos token.Pos) {
+    if val.Type.IsNiche() {
+        if val.Elem == nil {
+            state.defBasic(val.GetVal(), types.Ptr_Size)
+        } else {
+            state.defVal(val.ElemType, val.Elem, pos)
+        }
+        return
+    }
+
+    state.defBasic(fmt.Sprint(val.Id), val.Type.IdType.Size())
+    state.defVal(val.ElemType, val.Elem, pos)
 }
 
-func defStruct(val *constVal.StructConst, pos token.Pos) {
+func (state *State) defStruct(val *constVal.StructConst, pos token.Pos) {
     for i,v := range val.Fields {
-        defVal(val.Type.Types[i], v, pos)
+        state.defVal(val.Type.Types[i], v, pos)
     }
 }
 
-func defBasic(val string, size uint) {
-    nasm.AddData(fmt.Sprintf("  %s %s", asm.GetDataSize(size), val))
+func (state *State) defBasic(val string, size uint) {
+    state.nasm.AddData(fmt.Sprintf("  %s %s", asm.GetDataSize(size), val))
 }
 
-func defStr(val *constVal.StrConst) {
-    nasm.AddData(fmt.Sprintf("  %s _str%d\n  %s %d",
+func (state *State) defStr(val *constVal.StrConst) {
+    state.nasm.AddData(fmt.Sprintf("  %s _str%d\n  %s %d",
         asm.GetDataSize(types.Ptr_Size),
         uint64(*val),
         asm.GetDataSize(types.I32_Size),
-        str.GetSize(uint64(*val))))
+        state.str.GetSize(uint64(*val))))
 }
 
 
 // Deref -------------------------------------------------------------------
-func DerefSetVar(file *bufio.Writer, addr addr.Addr, other vars.Var) {
-    DerefSetDeref(file, addr, other.GetType(), other.Addr())
+func (state *State) DerefSetVar(file *bufio.Writer, addr addr.Addr, other vars.Var) {
+    state.DerefSetDeref(file, addr, other.GetType(), other.Addr())
 }
 
-func DerefSetDeref(file *bufio.Writer, addr addr.Addr, t types.Type, otherAddr addr.Addr) {
+func (state *State) DerefSetDeref(file *bufio.Writer, addr addr.Addr, t types.Type, otherAddr addr.Addr) {
     t = types.ResolveGeneric(t)
 
     switch t := t.(type) {
@@ -143,25 +148,25 @@ func DerefSetDeref(file *bufio.Writer, addr addr.Addr, t types.Type, otherAddr a
         asm.MovDerefDeref(file, addr, otherAddr, t.Size(), asm.RegB, false)
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] %v is not supported yet (DerefSetVar)\n", t)
-        os.Exit(1)
+        state.diag.Errorf("%v is not supported yet (DerefSetVar)", t)
+        state.diag.Exit()
     }
 }
 
-func DerefSetExpr(file *bufio.Writer, dst addr.Addr, t types.Type, val ast.Expr) {
+func (state *State) DerefSetExpr(file *bufio.Writer, dst addr.Addr, t types.Type, val ast.Expr) {
     t = types.ResolveGeneric(t)
 
     switch t := t.(type) {
     case types.StrType:
-        GenExpr(file, val)
+        state.GenExpr(file, val)
         asm.MovDerefReg(file, dst, types.Ptr_Size, asm.RegGroup(0))
         asm.MovDerefReg(file, dst.Offseted(int64(types.Ptr_Size)), types.I32_Size, asm.RegGroup(1))
 
     case types.StructType, types.EnumType:
         if types.IsBigStruct(t) {
-            DerefSetBigStruct(file, dst, val)
+            state.DerefSetBigStruct(file, dst, val)
         } else {
-            GenExpr(file, val)
+            state.GenExpr(file, val)
             size := t.Size() 
             reg := asm.RegGroup(0)
 
@@ -179,30 +184,30 @@ func DerefSetExpr(file *bufio.Writer, dst addr.Addr, t types.Type, val ast.Expr)
                     asm.MovDerefReg(file, dst, sz, reg)
                     if size > 0 {
                         dst = dst.Offseted(int64(sz))
-                        asm.Shr(file, fmt.Sprint(sz*8), types.Ptr_Size)
+                        asm.Shr(file, fmt.Sprint(sz*8), types.Ptr_Size, false)
                     }
                 }
             }
         }
 
     case types.IntType, types.UintType, types.BoolType, types.PtrType, types.CharType:
-        GenExpr(file, val)
+        state.GenExpr(file, val)
         asm.MovDerefReg(file, dst, t.Size(), asm.RegGroup(0))
 
     case types.ArrType:
         if lit,ok := val.(*ast.ArrayLit); ok {
-            derefSetArrLit(file, dst, t, lit)
+            state.derefSetArrLit(file, dst, t, lit)
         } else {
-            GenExpr(file, val)
+            state.GenExpr(file, val)
             asm.MovDerefReg(file, dst, t.Size(), asm.RegGroup(0))
         }
 
     case types.VecType:
-        DerefSetBigStruct(file, dst, val)
+        state.DerefSetBigStruct(file, dst, val)
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] %v is not supported yet (DerefSetExpr)\n", reflect.TypeOf(t))
-        os.Exit(1)
+        state.diag.Errorf("%v is not supported yet (DerefSetExpr)", reflect.TypeOf(t))
+        state.diag.Exit()
     }
 }
 
@@ -214,31 +219,31 @@ func getActualArrBaseSize(t types.Type) uint64 {
     return uint64(t.Size())
 }
 
-func derefSetArrLit(file *bufio.Writer, dst addr.Addr, t types.ArrType, lit *ast.ArrayLit) {
+func (state *State) derefSetArrLit(file *bufio.Writer, dst addr.Addr, t types.ArrType, lit *ast.ArrayLit) {
     if lit.Idx != ^uint64(0) {
         arrAddr := addr.Addr{ BaseAddr: fmt.Sprintf("_arr%d", lit.Idx) }
         for i, v := range lit.Values {
-            DerefSetExpr(file, arrAddr.Offseted(int64(i) * int64(getActualArrBaseSize(t.BaseType))), t.BaseType, v)
+            state.DerefSetExpr(file, arrAddr.Offseted(int64(i) * int64(getActualArrBaseSize(t.BaseType))), t.BaseType, v)
         }
         asm.MovDerefVal(file, dst, lit.Type.Size(), arrAddr.BaseAddr)
     } else {
         for i, v := range lit.Values {
-            if cmpTime.ConstEval(v) == nil {
-                DerefSetExpr(file, dst.Offseted(int64(i) * int64(getActualArrBaseSize(t.BaseType))), t.BaseType, v)
+            if state.cmpTime.ConstEval(v) == nil {
+                state.DerefSetExpr(file, dst.Offseted(int64(i) * int64(getActualArrBaseSize(t.BaseType))), t.BaseType, v)
             }
         }
     }
 }
 
-func DerefSetVal(file *bufio.Writer, addr addr.Addr, typ types.Type, val constVal.ConstVal) {
+func (state *State) DerefSetVal(file *bufio.Writer, addr addr.Addr, typ types.Type, val constVal.ConstVal) {
     typ = types.ResolveGeneric(typ)
 
     switch val := val.(type) {
     case *constVal.StrConst:
-        derefSetStrVal(file, addr, 0, val, typ)
+        state.derefSetStrVal(file, addr, 0, val, typ)
 
     case *constVal.StructConst:
-        derefSetStructVal(file, typ.(types.StructType), addr, 0, val)
+        state.derefSetStructVal(file, typ.(types.StructType), addr, 0, val)
 
     case *constVal.ArrConst, *constVal.IntConst, *constVal.UintConst, *constVal.BoolConst, *constVal.CharConst:
         derefSetBasicVal(file, addr, 0, typ.Size(), val.GetVal())
@@ -247,11 +252,11 @@ func DerefSetVal(file *bufio.Writer, addr addr.Addr, typ types.Type, val constVa
         derefSetPtrVal(file, addr, 0, val)
 
     case *constVal.EnumConst:
-        derefSetEnumVal(file, typ.(types.EnumType), addr, 0, val)
+        state.derefSetEnumVal(file, typ.(types.EnumType), addr, 0, val)
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] %v is not supported yet (DerefSetVal)\n", reflect.TypeOf(val))
-        os.Exit(1)
+        state.diag.Errorf("%v is not supported yet (DerefSetVal)", reflect.TypeOf(val))
+        state.diag.Exit()
     }
 }
 
@@ -263,28 +268,37 @@ func derefSetPtrVal(file *bufio.Writer, addr addr.Addr, offset int, val *constVa
     PtrConstToAddr(file, *val, addr.Offseted(int64(offset)))
 }
 
-func derefSetStrVal(file *bufio.Writer, addr addr.Addr, offset int, val *constVal.StrConst, t types.Type) {
+func (state *State) derefSetStrVal(file *bufio.Writer, addr addr.Addr, offset int, val *constVal.StrConst, t types.Type) {
     asm.MovDerefVal(file, addr.Offseted(int64(offset)), types.Ptr_Size, fmt.Sprintf("_str%d", uint64(*val)))
     if t.GetKind() == types.Str {
-        asm.MovDerefVal(file, addr.Offseted(int64(offset) + int64(types.Ptr_Size)), types.I32_Size, fmt.Sprint(str.GetSize(uint64(*val))))
+        asm.MovDerefVal(file, addr.Offseted(int64(offset) + int64(types.Ptr_Size)), types.I32_Size, fmt.Sprint(state.str.GetSize(uint64(*val))))
     }
 }
 
-func derefSetEnumVal(file *bufio.Writer, t types.EnumType, addr addr.Addr, offset int, val *constVal.EnumConst) {
+func (state *State) derefSetEnumVal(file *bufio.Writer, t types.EnumType, addr addr.Addr, offset int, val *constVal.EnumConst) {
+    if t.IsNiche() {
+        if val.Elem == nil {
+            asm.MovDerefVal(file, addr.Offseted(int64(offset)), types.Ptr_Size, val.GetVal())
+        } else {
+            state.DerefSetVal(file, addr.Offseted(int64(offset)), val.ElemType, val.Elem)
+        }
+        return
+    }
+
     asm.MovDerefVal(file, addr.Offseted(int64(offset)), t.IdType.Size(), fmt.Sprint(val.Id))
     if val.Elem != nil {
-        DerefSetVal(file, addr.Offseted(int64(offset) + int64(t.IdType.Size())), val.ElemType, val.Elem)
+        state.DerefSetVal(file, addr.Offseted(int64(offset) + int64(t.IdType.Size())), val.ElemType, val.Elem)
     }
 }
 
-func derefSetStructVal(file *bufio.Writer, t types.StructType, addr addr.Addr, offset int, val *constVal.StructConst) {
+func (state *State) derefSetStructVal(file *bufio.Writer, t types.StructType, addr addr.Addr, offset int, val *constVal.StructConst) {
     for i,val := range val.Fields {
         switch val := val.(type) {
         case *constVal.StrConst:
-            derefSetStrVal(file, addr, offset, val, t.Types[i])
+            state.derefSetStrVal(file, addr, offset, val, t.Types[i])
 
         case *constVal.StructConst:
-            derefSetStructVal(file, t.Types[i].(types.StructType), addr, offset, val)
+            state.derefSetStructVal(file, t.Types[i].(types.StructType), addr, offset, val)
 
         case *constVal.ArrConst, *constVal.IntConst, *constVal.UintConst, *constVal.BoolConst, *constVal.CharConst:
             derefSetBasicVal(file, addr, offset, t.Types[i].Size(), val.GetVal())
@@ -293,11 +307,11 @@ func derefSetStructVal(file *bufio.Writer, t types.StructType, addr addr.Addr, o
             derefSetPtrVal(file, addr, offset, val)
 
         case *constVal.EnumConst:
-            derefSetEnumVal(file, t.Types[i].(types.EnumType), addr, offset, val)
+            state.derefSetEnumVal(file, t.Types[i].(types.EnumType), addr, offset, val)
 
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] %v is not supported yet (derefSetStructVal)\n", reflect.TypeOf(val))
-            os.Exit(1)
+            state.diag.Errorf("%v is not supported yet (derefSetStructVal)", reflect.TypeOf(val))
+            state.diag.Exit()
         }
 
         offset += int(t.Types[i].Size())
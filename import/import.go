@@ -2,82 +2,138 @@ package imprt
 
 import (
     "os"
-    "fmt"
+    "bytes"
+    "strings"
     "gamma/token"
     "path/filepath"
+    "gamma/diag"
+    "gamma/buildin"
 )
 
 // TODO: no .gma file extension
 // TODO: <file> for importDir / "file" for projectDir
 
 const buildinDir string = "../buildin/buildin.gma"
-var projectDir string
-var importDir string
 
-var imported map[string]bool = make(map[string]bool)
-// true: fully imported
-// false: not fully import -> import cycle if imported again
+// import state of one compilation (see gamma/compiler)
+type State struct {
+    projectDir string
+    importDir string
+    imported map[string]bool
+    // true: fully imported
+    // false: not fully import -> import cycle if imported again
+    order []string              // imported paths in import order
+    files map[string]string     // in-memory sources (path -> contents)
+    loaded map[string]string    // contents of every tokenized file (source lines of the diagnostics)
+
+    diag *diag.State
+    token *token.State
+}
 
-func ImportMain(path string) token.Tokens {
-    return ImportFile(path)
+func NewState(diag *diag.State, token *token.State) *State {
+    return &State{ imported: make(map[string]bool), loaded: make(map[string]string), diag: diag, token: token }
 }
 
-func ImportBuildin() token.Tokens {
-    return ImportFile(preparePath(buildinDir))
+// contents of a file of the compilation (false if it was not loaded)
+func (s *State) Source(path string) (string, bool) {
+    src,ok := s.loaded[path]
+    return src, ok
 }
 
-func ImportFile(path string) token.Tokens {
-    file, err := os.Open(path)
-    if err != nil {
-        fmt.Fprintln(os.Stderr, "[ERROR]", err)
-        os.Exit(1)
-    }
+func (state *State) ImportMain(path string) token.Tokens {
+    return state.ImportFile(path)
+}
 
-    addImport(path)
+// the build-in file next to the import dir (or the one compiled into gamma)
+func (state *State) ImportBuildin() token.Tokens {
+    path := state.preparePath(buildinDir)
+    if _,ok := state.files[path]; !ok {
+        if _,err := os.Stat(path); err != nil {
+            state.addImport("buildin.gma")
+            state.loaded["buildin.gma"] = buildin.Src
+            return state.token.Tokenize("buildin.gma", strings.NewReader(buildin.Src))
+        }
+    }
 
-    return token.Tokenize(path, file)
+    return state.ImportFile(path)
 }
 
-func Import(importPath token.Token) (*token.Tokens, bool) {
-    path := preparePath(extractPath(importPath))
+func (state *State) ImportFile(path string) token.Tokens {
+    src := state.readFile(path)
+    state.addImport(path)
 
-    if addImport(path) {
-        file, err := os.Open(path)
-        if err != nil {
-            fmt.Fprintln(os.Stderr, "[ERROR]", err)
-            os.Exit(1)
-        }
+    return state.token.Tokenize(path, src)
+}
+
+func (state *State) Import(importPath token.Token) (*token.Tokens, bool) {
+    path := state.preparePath(extractPath(importPath))
 
-        tokens := token.Tokenize(path, file)
+    if state.addImport(path) {
+        tokens := state.token.Tokenize(path, state.readFile(path))
         return &tokens, true
     }
 
     return nil, false
 }
 
-func EndImport(path string) {
-    imported[path] = true
+// in-memory sources are used before files on disk
+func (state *State) SetFiles(files map[string]string) {
+    state.files = files
 }
 
-func SetImportDirs(filePath string, path string) {
-    importDir = path
-    projectDir = filepath.Dir(filePath)
+func (state *State) readFile(path string) *bytes.Reader {
+    if src,ok := state.files[path]; ok {
+        state.loaded[path] = src
+        return bytes.NewReader([]byte(src))
+    }
+
+    src, err := os.ReadFile(path)
+    if err != nil {
+        state.diag.Error(err.Error())
+        state.diag.Exit()
+    }
+
+    state.loaded[path] = string(src)
+    return bytes.NewReader(src)
+}
+
+func (state *State) EndImport(path string) {
+    state.imported[path] = true
+}
+
+func (state *State) SetImportDirs(filePath string, path string) {
+    state.importDir = path
+    state.projectDir = filepath.Dir(filePath)
+}
+
+// the build-in file, the test runner and files in the import dir (not written by the user)
+func (state *State) IsLibrary(path string) bool {
+    if path == "buildin.gma" || path == "<test runner>" || path == state.preparePath(buildinDir) {
+        return true
+    }
+
+    if state.importDir == "" {
+        return false
+    }
+    rel, err := filepath.Rel(state.importDir, path)
+    return err == nil && rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator))
 }
 
-func addImport(path string) (newImport bool) {
-    if importable, notNew := imported[path]; !notNew {
-        imported[path] = false
+func (state *State) addImport(path string) (newImport bool) {
+    if importable, notNew := state.imported[path]; !notNew {
+        state.imported[path] = false
+        state.order = append(state.order, path)
         newImport = true
     } else {
         if !importable {
-            fmt.Fprintln(os.Stderr, "[ERROR] import cycle detected:")
-            for path, importable := range imported {
-                if !importable {
-                    fmt.Fprintln(os.Stderr, "\t", path)
+            state.diag.Error("import cycle detected:")
+            for _,path := range state.order {
+                if !state.imported[path] {
+                    state.diag.Line(path)
                 }
             }
-            fmt.Fprintln(os.Stderr, "\t", path)
-            os.Exit(1)
+            state.diag.Line(path)
+            state.diag.Exit()
         }
     }
 
@@ -88,15 +144,19 @@ func extractPath(path token.Token) string {
     return path.Str[1:len(path.Str)-1]
 }
 
-func preparePath(path string) string {
+func (state *State) preparePath(path string) string {
+    if _,ok := state.files[path]; ok {
+        return path
+    }
+
     // relative path
     if !filepath.IsAbs(path) {
         // project path (main file dir (file passed as arg to compiler))
         // import path (default ./std)
-        std := filepath.Join(filepath.Join(importDir, path))
+        std := filepath.Join(filepath.Join(state.importDir, path))
 
         if _, err := os.Stat(std); os.IsNotExist(err) {
-            return filepath.Join(projectDir, path)
+            return filepath.Join(state.projectDir, path)
         } else {
             return std
         }
@@ -4,148 +4,222 @@ import (
 	"fmt"
 	"gamma/ast"
 	"gamma/ast/identObj"
-	"gamma/cmpTime"
-	"gamma/import"
+	"gamma/ast/identObj/vars"
 	"gamma/token"
 	"gamma/types"
-	"os"
 )
 
-func prsDecl(tokens *token.Tokens) ast.Decl {
+func (state *State) prsDecl(tokens *token.Tokens) ast.Decl {
     switch t := tokens.Next(); t.Type {
     case token.Import:
         if !tokens.IsFileStart() {
-            fmt.Fprintln(os.Stderr, "[ERROR] importing is only allowed at the beginning of a file")
-            fmt.Fprintln(os.Stderr, "\t" + t.At())
-            os.Exit(1)
+            state.diag.Error("importing is only allowed at the beginning of a file")
+            state.diag.At(t.At())
+            state.diag.Exit()
         }
 
-        d := prsImport(tokens)
+        d := state.prsImport(tokens)
         return &d
 
     case token.Fn, token.ConstFn:
-        d := prsDefFn(tokens, false)
+        d := state.prsDefFn(tokens, false)
         return &d
 
     case token.Struct:
-        d := prsStruct(tokens)
+        d := state.prsStruct(tokens)
         return &d
 
     case token.Enum:
-        return prsEnum(tokens)
+        return state.prsEnum(tokens)
 
     case token.Interface:
-        return prsInterface(tokens)
+        return state.prsInterface(tokens)
 
     case token.Impl:
-        return prsImpl(tokens)
+        return state.prsImpl(tokens)
 
     case token.Name:
-        d := prsDefine(tokens)
+        if t.Str == "test" && tokens.Peek().Type == token.Str {
+            d := state.prsTest(tokens)
+            return &d
+        }
+
+        if isMut(tokens) {
+            state.diag.Error("mut is only allowed for local vars (global vars are always mutable)")
+            state.diag.At(t.At())
+            state.diag.Exit()
+        }
+
+        d := state.prsDefine(tokens)
+        if _,ok := d.(*ast.DecVar); ok {
+            state.diag.Error("declaring without initializing is not allowed")
+            state.diag.At(d.At())
+            state.diag.Exit()
+        }
         if _,ok := d.(*ast.BadDecl); ok {
-            fmt.Fprintln(os.Stderr, "[ERROR] declaring without initializing is not allowed")
-            fmt.Fprintln(os.Stderr, "\t" + d.At())
-            os.Exit(1)
+            state.diag.Error("declaring without initializing is not allowed")
+            state.diag.At(d.At())
+            state.diag.Exit()
         }
         return d
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unknown word \"%s\"\n", t.Str)
-        fmt.Fprintln(os.Stderr, "\t" + t.At())
-        os.Exit(1)
+        state.diag.Errorf("unknown word \"%s\"", t.Str)
+        state.diag.At(t.At())
+        state.diag.Exit()
 
         return &ast.BadDecl{}
     }
 }
 
-func createSelfType(tokens *token.Tokens) types.Type {
-    if identObj.CurSelfType == nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] Self used outside of impl and interface")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+func (state *State) createSelfType(tokens *token.Tokens) types.Type {
+    if state.identObj.GetCurSelfType() == nil {
+        state.diag.Error("Self used outside of impl and interface")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return nil
     }
 
-    return identObj.CurSelfType
+    return state.identObj.GetCurSelfType()
 }
 
-func prsVecType(tokens *token.Tokens) types.VecType {
+func (state *State) prsVecType(tokens *token.Tokens) types.VecType {
     if tokens.Cur().Type != token.BrackL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"[\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"[\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
     if tokens.Next().Type != token.XSwitch {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"$\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"$\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
     if tokens.Next().Type != token.BrackR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"]\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"]\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
     tokens.Next()
-    return types.VecType{ BaseType: prsType(tokens) }
+    return types.VecType{ BaseType: state.prsType(tokens) }
 }
 
-func prsArrType(tokens *token.Tokens) types.ArrType {
+func (state *State) prsArrType(tokens *token.Tokens) types.ArrType {
     if tokens.Cur().Type != token.BrackL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected %v but got %v\n", token.BrackL, tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected %v but got %v", token.BrackL, tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     pos := tokens.Next().Pos
-    expr := prsExpr(tokens)
+    expr := state.prsExpr(tokens)
 
     Len := uint64(0)
-    if length,ok := cmpTime.ConstEvalUint(expr); ok {
+    if length,ok := state.cmpTime.ConstEvalUint(expr); ok {
         Len = length
     } else {
-        fmt.Fprintln(os.Stderr, "[ERROR] length of an array has to a const/eval at compile time")
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+        state.diag.Error("length of an array has to a const/eval at compile time")
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
     if tokens.Next().Type != token.BrackR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected %v but got %v\n", token.BrackR, tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected %v but got %v", token.BrackR, tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
+    }
+
+    tokens.Next()
+
+    return types.ArrType{ BaseType: state.prsType(tokens), Len: Len }
+}
+
+// mut is only a keyword in front of the name it declares
+// (mut := 3, println(mut) and fn f(mut S) use a var called mut)
+func isMut(tokens *token.Tokens) bool {
+    if tokens.Cur().Type != token.Name || tokens.Cur().Str != "mut" {
+        return false
+    }
+
+    switch tokens.Peek().Type {
+    case token.Self:
+        return true
+    case token.Name:
+        next := tokens.Peek2().Type
+        return next != token.Comma && next != token.ParenR
+    }
+
+    return false
+}
+
+// optional "mut" before a local var (mut x := 1, fn f(mut a i32), for mut i u64, 3, ...)
+func prsMut(tokens *token.Tokens) bool {
+    if !isMut(tokens) {
+        return false
+    }
+
+    tokens.Next()
+    return true
+}
+
+func setMut(v vars.Var, mut bool) {
+    if l,ok := v.(*vars.LocalVar); ok && mut {
+        l.SetMut()
     }
+}
 
+// mut x := 1, mut x i32 := 1 or mut x i32
+func (state *State) prsMutDefine(tokens *token.Tokens) ast.Decl {
+    mutPos := tokens.Cur().Pos
     tokens.Next()
 
-    return types.ArrType{ BaseType: prsType(tokens), Len: Len }
+    if tokens.Cur().Type != token.Name || !(state.isDec(tokens) || isDefInfer(tokens)) {
+        state.diag.Errorf("expected a var definition after mut but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
+    }
+
+    d := state.prsDefine(tokens)
+    switch d := d.(type) {
+    case *ast.DefVar:
+        setMut(d.V, true)
+    case *ast.DecVar:
+        setMut(d.V, true)
+    case *ast.DefConst:
+        state.diag.Errorf("const %s cannot be mut", d.C.GetName())
+        state.diag.At(mutPos.At())
+        state.diag.Exit()
+    }
+
+    return d
 }
 
-func prsDecVar(tokens *token.Tokens) ast.DecVar {
-    name, t := prsNameType(tokens)
+func (state *State) prsDecVar(tokens *token.Tokens) ast.DecVar {
+    name, t := state.prsNameType(tokens)
     end := tokens.Cur().Pos
 
-    return ast.DecVar{ V: identObj.DecVar(name, t), Type: t, TypePos: end }
+    return ast.DecVar{ V: state.identObj.DecVar(name, t), Type: t, TypePos: end }
 }
 
-func prsNameType(tokens *token.Tokens) (name token.Token, typ types.Type) {
+func (state *State) prsNameType(tokens *token.Tokens) (name token.Token, typ types.Type) {
     name = tokens.Cur()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Last().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", tokens.Cur())
+        state.diag.At(tokens.Last().At())
+        state.diag.Exit()
     }
 
     tokens.Next()
-    typ = prsType(tokens)
+    typ = state.prsType(tokens)
 
     return
 }
 
-func isDec(tokens *token.Tokens) bool {
+func (state *State) isDec(tokens *token.Tokens) bool {
     if tokens.Cur().Type != token.Name {
         return false
     }
 
-    return isNextType(tokens)
+    return state.isNextType(tokens)
 }
 func isDefInfer(tokens *token.Tokens) bool {
     if tokens.Cur().Type != token.Name && tokens.Cur().Type != token.UndScr {
@@ -166,40 +240,46 @@ func isStruct(obj identObj.IdentObj) bool {
     _,ok := obj.(*identObj.Struct)
     return ok
 }
-func isEnum(token token.Token) bool {
-    _,ok := identObj.Get(token.Str).(*identObj.Enum)
+func (state *State) isEnum(token token.Token) bool {
+    _,ok := state.identObj.Get(token.Str).(*identObj.Enum)
     return ok
 }
 func isEnumLit(enumType types.EnumType, elemName string) bool {
     return enumType.HasElem(elemName)
 }
-func isGenericFunc(name string) bool {
-    if f,ok := identObj.Get(name).(*identObj.Func); ok {
+func (state *State) isGenericFunc(name string) bool {
+    if f,ok := state.identObj.Get(name).(*identObj.Func); ok {
         return f.IsGeneric()
     }
 
     return false
 }
 
-func isType(tokens *token.Tokens) bool {
+func (state *State) isType(tokens *token.Tokens) bool {
     savedIdx := tokens.SaveIdx()
     defer tokens.ResetIdx(savedIdx)
-    return isType_(tokens)
+    return state.isType_(tokens)
 }
-func isType_(tokens *token.Tokens) bool {
+func (state *State) isType_(tokens *token.Tokens) bool {
     switch tokens.Cur().Type {
     case token.Typename, token.SelfType:
         return true
 
     case token.Mul:
         tokens.Next()
-        return isType_(tokens)
+        return state.isType_(tokens)
 
     case token.BrackL:
         tokens.Next()
 
         if tokens.Cur().Type != token.XSwitch {
-            idxKind := prsExpr(tokens).GetType().GetKind()
+            // void (nil) is not a valid len
+            idxType := state.prsExpr(tokens).GetType()
+            if idxType == nil {
+                return false
+            }
+
+            idxKind := idxType.GetKind()
             if idxKind != types.Int && idxKind != types.Uint && idxKind != types.Infer {
                 return false
             }
@@ -210,10 +290,10 @@ func isType_(tokens *token.Tokens) bool {
         }
 
         tokens.Next()
-        return isType_(tokens)
+        return state.isType_(tokens)
 
     case token.Name:
-        if obj := identObj.Get(tokens.Cur().Str); obj != nil {
+        if obj := state.identObj.Get(tokens.Cur().Str); obj != nil {
             if _,ok := obj.(*identObj.Struct); ok {
                 return true
             }
@@ -237,31 +317,31 @@ func isType_(tokens *token.Tokens) bool {
         return false
     }
 }
-func isNextType(tokens *token.Tokens) bool {
+func (state *State) isNextType(tokens *token.Tokens) bool {
     savedIdx := tokens.SaveIdx()
     defer tokens.ResetIdx(savedIdx)
     tokens.Next()
-    return isType_(tokens)
+    return state.isType_(tokens)
 }
 
-func prsType(tokens *token.Tokens) types.Type {
+func (state *State) prsType(tokens *token.Tokens) types.Type {
     switch tokens.Cur().Type {
     case token.Mul:
         tokens.Next()
-        return types.PtrType{ BaseType: prsType(tokens) }
+        return types.PtrType{ BaseType: state.prsType(tokens) }
 
     case token.BrackL:
         if tokens.Peek().Type == token.XSwitch {
-            return prsVecType(tokens)
+            return state.prsVecType(tokens)
         } else {
-            return prsArrType(tokens)
+            return state.prsArrType(tokens)
         }
 
     case token.SelfType:
-        return createSelfType(tokens)
+        return state.createSelfType(tokens)
 
     case token.Name:
-        if obj := identObj.Get(tokens.Cur().Str); obj != nil {
+        if obj := state.identObj.Get(tokens.Cur().Str); obj != nil {
             var t types.Type = nil
             if strct,ok := obj.(*identObj.Struct); ok {
                 t = strct.GetType()
@@ -279,49 +359,57 @@ func prsType(tokens *token.Tokens) types.Type {
                 t = gen.GetType()
             }
 
+            if t == nil {
+                state.diag.Errorf("%s is not a type", tokens.Cur().Str)
+                state.diag.Suggest(tokens.Cur().Str, state.identObj.VisibleNames(identObj.IsType))
+                state.diag.At(tokens.Cur().At())
+                state.diag.Exit()
+            }
+
             if tokens.Peek().Type == token.Lss {
                 tokens.Next()
                 tokens.Next()
-                t = types.ReplaceGeneric(t, prsType(tokens))
+                t = types.ReplaceGeneric(t, state.prsType(tokens))
                 if tokens.Next().Type != token.Grt {
-                    fmt.Fprintf(os.Stderr, "[ERROR] expected \">\" but got %s\n", tokens.Cur().Str)
-                    fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-                    os.Exit(1)
+                    state.diag.Errorf("expected \">\" but got %s", tokens.Cur().Str)
+                    state.diag.At(tokens.Cur().At())
+                    state.diag.Exit()
                 }
             }
 
             return t
         }
 
-        fmt.Fprintf(os.Stderr, "[ERROR] type \"%s\" is not defined\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("type \"%s\" is not defined", tokens.Cur().Str)
+        state.diag.Suggest(tokens.Cur().Str, state.identObj.VisibleNames(identObj.IsType))
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return nil
 
     default:
         t := types.ToBaseType(tokens.Cur().Str)
         if t == nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] %s is not a valid type\n", tokens.Cur().Str)
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Errorf("%s is not a valid type", tokens.Cur().Str)
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
         return t
     }
 }
 
-func prsInterfaceType(tokens *token.Tokens) *types.InterfaceType {
-    if obj := identObj.Get(tokens.Cur().Str); obj != nil {
+func (state *State) prsInterfaceType(tokens *token.Tokens) *types.InterfaceType {
+    if obj := state.identObj.Get(tokens.Cur().Str); obj != nil {
         if interfc,ok := obj.(*identObj.Interface); ok {
             t := interfc.GetType().(types.InterfaceType)
 
             if tokens.Peek().Type == token.Lss {
                 tokens.Next()
                 tokens.Next()
-                t.Generic.SetType = prsType(tokens)
+                t.Generic.SetType = state.prsType(tokens)
                 if tokens.Next().Type != token.Grt {
-                    fmt.Fprintf(os.Stderr, "[ERROR] expected \">\" but got %s\n", tokens.Cur().Str)
-                    fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-                    os.Exit(1)
+                    state.diag.Errorf("expected \">\" but got %s", tokens.Cur().Str)
+                    state.diag.At(tokens.Cur().At())
+                    state.diag.Exit()
                 }
             }
 
@@ -332,83 +420,88 @@ func prsInterfaceType(tokens *token.Tokens) *types.InterfaceType {
     return nil
 }
 
-func prsDefVar(tokens *token.Tokens, name token.Token, t types.Type) ast.DefVar {
+func (state *State) prsDefVar(tokens *token.Tokens, name token.Token, t types.Type) ast.DefVar {
     pos := tokens.Cur().Pos
     tokens.Next()
-    val := prsExpr(tokens)
+    val := state.prsExpr(tokens)
 
-    v := identObj.DecVar(name, t)
+    v := state.identObj.DecVar(name, t)
     return ast.DefVar{ V: v, Type: t, ColPos: pos, Value: val }
 }
 
-func prsDefConst(tokens *token.Tokens, name token.Token, t types.Type) ast.DefConst {
+func (state *State) prsDefConst(tokens *token.Tokens, name token.Token, t types.Type) ast.DefConst {
     pos := tokens.Cur().Pos
     tokens.Next()
-    val := prsExpr(tokens)
+    val := state.prsExpr(tokens)
 
-    v := cmpTime.ConstEval(val)
+    v := state.cmpTime.ConstEval(val)
     if v == nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] expected a const expr")
-        fmt.Fprintln(os.Stderr, "\t" + val.At())
-        os.Exit(1)
+        state.diag.Error("expected a const expr")
+        state.diag.At(val.At())
+        state.diag.Exit()
     }
 
-    return ast.DefConst{ C: identObj.DecConst(name, t, v), Type: t, ColPos: pos, Value: val }
+    return ast.DefConst{ C: state.identObj.DecConst(name, t, v), Type: t, ColPos: pos, Value: val }
 }
 
-func prsDefVarInfer(tokens *token.Tokens, name token.Token) ast.DefVar {
+func (state *State) prsDefVarInfer(tokens *token.Tokens, name token.Token) ast.DefVar {
     pos := tokens.Cur().Pos
     tokens.Next()
-    val := prsExpr(tokens)
+    val := state.prsExpr(tokens)
 
     t := val.GetType()
-    v := identObj.DecVar(name, t)
+    v := state.identObj.DecVar(name, t)
     return ast.DefVar{ V: v, Type: t, ColPos: pos, Value: val }
 }
 
-func prsDefConstInfer(tokens *token.Tokens, name token.Token) ast.DefConst {
+func (state *State) prsDefConstInfer(tokens *token.Tokens, name token.Token) ast.DefConst {
     pos := tokens.Cur().Pos
     tokens.Next()
-    val := prsExpr(tokens)
+    val := state.prsExpr(tokens)
 
     t := val.GetType()
-    v := cmpTime.ConstEval(val)
+    v := state.cmpTime.ConstEval(val)
     if v == nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] expected a const expr")
-        fmt.Fprintln(os.Stderr, "\t" + val.At())
-        os.Exit(1)
+        state.diag.Error("expected a const expr")
+        state.diag.At(val.At())
+        state.diag.Exit()
     }
 
-    return ast.DefConst{ C: identObj.DecConst(name, t, v), Type: t, ColPos: pos, Value: val }
+    return ast.DefConst{ C: state.identObj.DecConst(name, t, v), Type: t, ColPos: pos, Value: val }
 }
 
-func prsDefine(tokens *token.Tokens) ast.Decl {
+func (state *State) prsDefine(tokens *token.Tokens) ast.Decl {
     name := tokens.Cur()
 
     var t types.Type = nil
-    if isNextType(tokens) {
+    if state.isNextType(tokens) {
         tokens.Next()
-        t = prsType(tokens)
+        t = state.prsType(tokens)
+
+        // declared without a value (assigned later, see check/assign.go)
+        if next := tokens.Peek().Type; next != token.DefVar && next != token.DefConst {
+            return &ast.DecVar{ V: state.identObj.DecVar(name, t), Type: t, TypePos: tokens.Cur().Pos }
+        }
     }
 
     tokens.Next()
 
     if t == nil {       // infer the type with the value
         if tokens.Cur().Type == token.DefVar {
-            d := prsDefVarInfer(tokens, name)
+            d := state.prsDefVarInfer(tokens, name)
             return &d
         }
         if tokens.Cur().Type == token.DefConst {
-            d := prsDefConstInfer(tokens, name)
+            d := state.prsDefConstInfer(tokens, name)
             return &d
         }
     } else {            // type is given
         if tokens.Cur().Type == token.DefVar {
-            d := prsDefVar(tokens, name, t)
+            d := state.prsDefVar(tokens, name, t)
             return &d
         }
         if tokens.Cur().Type == token.DefConst {
-            d := prsDefConst(tokens, name, t)
+            d := state.prsDefConst(tokens, name, t)
             return &d
         }
     }
@@ -416,32 +509,32 @@ func prsDefine(tokens *token.Tokens) ast.Decl {
     return &ast.BadDecl{}
 }
 
-func prsStruct(tokens *token.Tokens) ast.DefStruct {
+func (state *State) prsStruct(tokens *token.Tokens) ast.DefStruct {
     pos := tokens.Cur().Pos
 
-    if !identObj.InGlobalScope() {
-        fmt.Fprintln(os.Stderr, "[ERROR] you can only declare a struct in the global scope")
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+    if !state.identObj.InGlobalScope() {
+        state.diag.Error("you can only declare a struct in the global scope")
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
-    identObj.StartScope()
-    defer identObj.EndScope()
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     name := tokens.Next()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
 
     tokens.Next()
-    generic := prsGeneric(tokens)
+    generic := state.prsGeneric(tokens)
 
-    s := identObj.DecStruct(name, generic)
+    s := state.identObj.DecStruct(name, generic)
 
     braceLPos := tokens.Cur().Pos
-    fields := prsDecFields(tokens)
+    fields := state.prsDecFields(tokens)
     braceRPos := tokens.Cur().Pos
 
     var names []string
@@ -450,88 +543,88 @@ func prsStruct(tokens *token.Tokens) ast.DefStruct {
         names = append(names, f.Name.Str)
         ts = append(ts, f.Type)
     }
-    s.SetFields(names, ts)
+    s.SetFields(state.types, names, ts)
 
     return ast.DefStruct{ S: s, Pos: pos, Name: name, BraceLPos: braceLPos, Fields: fields, BraceRPos: braceRPos }
 }
 
-func prsInterface(tokens *token.Tokens) ast.Decl {
+func (state *State) prsInterface(tokens *token.Tokens) ast.Decl {
     pos := tokens.Cur().Pos
 
-    if !identObj.InGlobalScope() {
-        fmt.Fprintln(os.Stderr, "[ERROR] you can only declare an interface in the global scope")
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+    if !state.identObj.InGlobalScope() {
+        state.diag.Error("you can only declare an interface in the global scope")
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
-    identObj.StartScope()
-    defer identObj.EndScope()
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     tokens.Next()
-    generic := prsGeneric(tokens)
+    generic := state.prsGeneric(tokens)
 
     name := tokens.Cur()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
 
     braceLPos := tokens.Next().Pos
-    I := identObj.DecInterface(name, generic)
-    identObj.CurSelfType = I.GetType()
+    I := state.identObj.DecInterface(name, generic)
+    state.identObj.SetCurSelfType(I.GetType())
 
     heads := make([]ast.FnHead, 0)
 
     for tokens.Next().Type != token.BraceR {
-        identObj.StartScope()
-        fnHead := prsFnHead(tokens, true)
-        identObj.EndScope()
+        state.identObj.StartScope()
+        fnHead := state.prsFnHead(tokens, true)
+        state.identObj.EndScope()
 
         heads = append(heads, fnHead)
         I.AddFunc(fnHead.F)
     }
 
     braceRPos := tokens.Cur().Pos
-    identObj.CurSelfType = nil
+    state.identObj.SetCurSelfType(nil)
 
     return &ast.DefInterface{ Pos: pos, Name: name, I: I, BraceLPos: braceLPos, BraceRPos: braceRPos, FnHeads: heads }
 }
 
-func prsEnum(tokens *token.Tokens) ast.Decl {
+func (state *State) prsEnum(tokens *token.Tokens) ast.Decl {
     pos := tokens.Cur().Pos
 
-    if !identObj.InGlobalScope() {
-        fmt.Fprintln(os.Stderr, "[ERROR] you can only declare an enum in the global scope")
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+    if !state.identObj.InGlobalScope() {
+        state.diag.Error("you can only declare an enum in the global scope")
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
-    identObj.StartScope()
-    defer identObj.EndScope()
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     name := tokens.Next()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
 
     tokens.Next()
-    generic := prsGeneric(tokens)
+    generic := state.prsGeneric(tokens)
 
     var idTyp types.Type = nil
     if tokens.Cur().Type != token.BraceL {
-        idTyp = prsType(tokens)
+        idTyp = state.prsType(tokens)
         tokens.Next()
     } else {
         idTyp = types.CreateUint(types.Ptr_Size)
     }
 
-    e := identObj.DecEnum(name, generic)
+    e := state.identObj.DecEnum(name, generic)
 
     braceLPos := tokens.Cur().Pos
-    elems := prsEnumElems(tokens)
+    elems := state.prsEnumElems(tokens)
     braceRPos := tokens.Cur().Pos
 
     var names []string
@@ -544,47 +637,47 @@ func prsEnum(tokens *token.Tokens) ast.Decl {
             ts = append(ts, e.Type.Type)
         }
     }
-    e.SetElems(idTyp, names, ts)
+    e.SetElems(state.types, idTyp, names, ts)
 
     return &ast.DefEnum{ E: e, Pos: pos, IdType: idTyp, Name: name, BraceLPos: braceRPos, Elems: elems, BraceRPos: braceLPos }
 }
-func prsEnumElems(tokens *token.Tokens) []ast.EnumElem {
+func (state *State) prsEnumElems(tokens *token.Tokens) []ast.EnumElem {
     res := make([]ast.EnumElem, 0, 3)
 
     if tokens.Next().Type != token.BraceR {
-        res = append(res, prsEnumElem(tokens))
+        res = append(res, state.prsEnumElem(tokens))
 
         for tokens.Next().Type == token.Comma {
             tokens.Next()
-            res = append(res, prsEnumElem(tokens))
+            res = append(res, state.prsEnumElem(tokens))
         }
     }
 
     if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"}\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"}\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return res
 }
-func prsEnumElem(tokens *token.Tokens) ast.EnumElem {
+func (state *State) prsEnumElem(tokens *token.Tokens) ast.EnumElem {
     name := tokens.Cur()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
 
-    t := prsEnumElemType(tokens)
+    t := state.prsEnumElemType(tokens)
 
     return ast.EnumElem{ Name: name, Type: t }
 }
-func prsEnumElemType(tokens *token.Tokens) *ast.EnumElemType {
+func (state *State) prsEnumElemType(tokens *token.Tokens) *ast.EnumElemType {
     if tokens.Peek().Type == token.ParenL {
         posL := tokens.Next().Pos
         tokens.Next()
-        typ := prsType(tokens)
+        typ := state.prsType(tokens)
         posR := tokens.Next().Pos
         return &ast.EnumElemType{ ParenL: posL, Type: typ, ParenR: posR }
     }
@@ -592,47 +685,47 @@ func prsEnumElemType(tokens *token.Tokens) *ast.EnumElemType {
     return nil
 }
 
-func prsImpl(tokens *token.Tokens) ast.Decl {
+func (state *State) prsImpl(tokens *token.Tokens) ast.Decl {
     pos := tokens.Cur().Pos
 
-    if !identObj.InGlobalScope() {
-        fmt.Fprintln(os.Stderr, "[ERROR] you can only declare an impl in the global scope")
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+    if !state.identObj.InGlobalScope() {
+        state.diag.Error("you can only declare an impl in the global scope")
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
-    identObj.StartScope()
-    defer identObj.EndScope()
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     tokens.Next()
-    generic := prsGeneric(tokens)
-    dstType := prsType(tokens)
+    generic := state.prsGeneric(tokens)
+    dstType := state.prsType(tokens)
 
     if dstType.GetKind() == types.Func {
-        fmt.Fprintln(os.Stderr, "[ERROR] functions are not implementable")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("functions are not implementable")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     var interfaceType *types.InterfaceType = nil
     if tokens.Peek().Type == token.DefConst {
         tokens.Next()
         tokens.Next()
-        interfaceType = prsInterfaceType(tokens)
+        interfaceType = state.prsInterfaceType(tokens)
     }
 
-    implObj := identObj.GetImplementable(dstType, true)
+    implObj := state.identObj.GetImplementable(dstType, true)
 
-    identObj.CurSelfType = dstType
+    state.identObj.SetCurSelfType(dstType)
 
     braceLPos := tokens.Next().Pos
     if tokens.Cur().Type != token.BraceL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a \"{\" but got %v\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a \"{\" but got %v", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
-    impl := identObj.CreateImpl(pos, interfaceType, dstType, generic)
+    impl := state.identObj.CreateImpl(pos, interfaceType, dstType, generic)
     implObj.AddImpl(impl)
 
     funcsReservedLen := 5
@@ -641,274 +734,310 @@ func prsImpl(tokens *token.Tokens) ast.Decl {
 
     for tokens.Next().Type != token.BraceR {
         if tokens.Cur().Type != token.Fn && tokens.Cur().Type != token.ConstFn {
-            fmt.Fprintf(os.Stderr, "[ERROR] you can only define funcs in impl (unexpected token %v)\n", tokens.Cur().Str)
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Errorf("you can only define funcs in impl (unexpected token %v)", tokens.Cur().Str)
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
 
-        funcs = append(funcs, prsDefFn(tokens, true))
+        funcs = append(funcs, state.prsDefFn(tokens, true))
     }
 
     braceRPos := tokens.Cur().Pos
     if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a \"}\" but got %v\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a \"}\" but got %v", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
-    identObj.CurSelfType = nil
+    state.identObj.SetCurSelfType(nil)
 
     return &ast.Impl{ Pos: pos, Impl: impl, BraceLPos: braceLPos, BraceRPos: braceRPos, FnDefs: funcs }
 }
 
-func prsFnHead(tokens *token.Tokens, isInterfaceFn bool) ast.FnHead {
+func (state *State) prsFnHead(tokens *token.Tokens, isInterfaceFn bool) ast.FnHead {
     fn := tokens.Cur()
     if fn.Type != token.Fn && fn.Type != token.ConstFn {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected fn or cfn but got %v\n", fn.Str)
-        fmt.Fprintln(os.Stderr, "\t" + fn.At())
-        os.Exit(1)
+        state.diag.Errorf("expected fn or cfn but got %v", fn.Str)
+        state.diag.At(fn.At())
+        state.diag.Exit()
     }
 
     isConst := fn.Type == token.ConstFn
 
     name := tokens.Next()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
 
     tokens.Next()
-    generic := prsGeneric(tokens)
-    f := identObj.DecFunc(name, isConst, identObj.CurSelfType, generic)
+    generic := state.prsGeneric(tokens)
+    f := state.identObj.DecFunc(name, isConst, state.identObj.GetCurSelfType(), generic)
 
-    argNames, argTypes := prsArgs(tokens, isInterfaceFn)
+    argNames, argTypes, argMuts := state.prsArgs(tokens, isInterfaceFn)
     f.SetArgs(argTypes)
 
     if name.Str == "main" {
-        isMainDefined = true
-        noMainArg = len(argNames) == 0
+        state.isMainDefined = true
+        state.noMainArg = len(argNames) == 0
     }
 
     var retType types.Type = nil
     if tokens.Peek().Type == token.Arrow {
         tokens.Next()
         tokens.Next()
-        retType = prsType(tokens)
+        retType = state.prsType(tokens)
     }
     f.SetRetType(retType)
 
     var argDecs []ast.DecVar
     for i,t := range argTypes {
-        a := ast.DecVar{ Type: t, V: identObj.DecVar(argNames[i], t) }
+        a := ast.DecVar{ Type: t, V: state.identObj.DecVar(argNames[i], t) }
+        setMut(a.V, argMuts[i])
         argDecs = append(argDecs, a)
     }
 
     return ast.FnHead{ Name: name, F: f, Generic: generic, Args: argDecs, RetType: retType, IsConst: isConst }
 }
 
-func prsDefFn(tokens *token.Tokens, isInterfaceFn bool) ast.DefFn {
+func (state *State) prsDefFn(tokens *token.Tokens, isInterfaceFn bool) ast.DefFn {
     pos := tokens.Cur().Pos
 
-    identObj.StartScope()
-    fnHead := prsFnHead(tokens, isInterfaceFn)
+    state.identObj.StartScope()
+    fnHead := state.prsFnHead(tokens, isInterfaceFn)
 
     if tokens.Next().Type != token.BraceL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"{\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"{\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
-    block := prsBlock(tokens)
+    block := state.prsBlock(tokens)
 
-    identObj.EndScope()
+    state.identObj.EndScope()
 
     def := ast.DefFn{ Pos: pos, FnHead: fnHead, Block: block }
 
     if fnHead.IsConst {
-        cmpTime.AddConstFunc(def)
+        state.cmpTime.AddConstFunc(def)
     }
 
     return def
 }
 
-func prsGeneric(tokens *token.Tokens) *identObj.Generic {
+// test "name" { ... } is parsed as a function without args
+// (only called by the test runner of "gamma test")
+func (state *State) prsTest(tokens *token.Tokens) ast.DefFn {
+    pos := tokens.Cur().Pos
+    testName := tokens.Next()
+
+    name := token.Token{ Type: token.Name, Str: fmt.Sprintf("_test%d", state.testFns), Pos: pos }
+    state.testFns++
+
+    if tokens.GetPath() == state.mainPath {
+        state.tests = append(state.tests, test{ name: testName, fn: name.Str })
+    }
+
+    state.identObj.StartScope()
+    state.identObj.AllowReserved(true)
+    f := state.identObj.DecFunc(name, false, nil, nil)
+    state.identObj.AllowReserved(false)
+
+    if tokens.Next().Type != token.BraceL {
+        state.diag.Errorf("expected \"{\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
+    }
+
+    block := state.prsBlock(tokens)
+
+    state.identObj.EndScope()
+
+    return ast.DefFn{ Pos: pos, FnHead: ast.FnHead{ Name: name, F: f }, Block: block }
+}
+
+func (state *State) prsGeneric(tokens *token.Tokens) *identObj.Generic {
     if tokens.Cur().Type == token.Lss {
         name := tokens.Next()
 
         if name.Type != token.Name {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", tokens.Cur())
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Last().At())
-            os.Exit(1)
+            state.diag.Errorf("expected a Name but got %v", tokens.Cur())
+            state.diag.At(tokens.Last().At())
+            state.diag.Exit()
         }
 
         var guardType types.InterfaceType
         if tokens.Peek().Type == token.Colon {
             tokens.Next()
             interfaceName := tokens.Next()
-            interfaceType := prsInterfaceType(tokens)
+            interfaceType := state.prsInterfaceType(tokens)
             if interfaceType == nil {
-                fmt.Fprintf(os.Stderr, "[ERROR] %s is not an interface\n", interfaceName.Str)
-                fmt.Fprintln(os.Stderr, "\t" + interfaceName.At())
-                os.Exit(1)
+                state.diag.Errorf("%s is not an interface", interfaceName.Str)
+                state.diag.At(interfaceName.At())
+                state.diag.Exit()
             }
             guardType = *interfaceType
         }
 
         if tokens.Next().Type != token.Grt {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected \">\" but got %v\n", tokens.Cur())
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Errorf("expected \">\" but got %v", tokens.Cur())
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
 
         tokens.Next()
-        return identObj.DecGeneric(name, guardType)
+        return state.identObj.DecGeneric(name, guardType)
     }
 
     return nil
 }
 
-func prsDecField(tokens *token.Tokens) ast.DecField {
-    name,t := prsNameType(tokens)
+func (state *State) prsDecField(tokens *token.Tokens) ast.DecField {
+    name,t := state.prsNameType(tokens)
     return ast.DecField{ Name: name, Type: t, TypePos: tokens.Cur().Pos }
 }
 
-func prsDecFields(tokens *token.Tokens) (fields []ast.DecField) {
+func (state *State) prsDecFields(tokens *token.Tokens) (fields []ast.DecField) {
     if tokens.Cur().Type != token.BraceL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"{\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"{\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
     if tokens.Peek().Type == token.BraceR { tokens.Next(); return }    // empty struct
 
     if tokens.Next().Type != token.ParenR {
-        fields = append(fields, prsDecField(tokens))
+        fields = append(fields, state.prsDecField(tokens))
 
         for tokens.Next().Type == token.Comma {
             tokens.Next()
-            fields = append(fields, prsDecField(tokens))
+            fields = append(fields, state.prsDecField(tokens))
         }
     }
 
     if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"}\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"}\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return
 }
 
-func prsOptionalSelfType(tokens *token.Tokens) types.Type {
+func (state *State) prsOptionalSelfType(tokens *token.Tokens) types.Type {
     if tokens.Peek().Type == token.SelfType {
         tokens.Next()
-        return createSelfType(tokens)
+        return state.createSelfType(tokens)
     }
 
     if tokens.Peek().Type == token.Mul && tokens.Peek2().Type == token.SelfType {
         tokens.Next()
         tokens.Next()
-        return types.PtrType{ BaseType: createSelfType(tokens) } 
+        return types.PtrType{ BaseType: state.createSelfType(tokens) } 
     }
 
     // explicitly used StructName
-    if identObj.CurSelfType != nil {
-        if tokens.Peek().Type == token.Name && tokens.Peek().Str == identObj.CurSelfType.String() {
+    if state.identObj.GetCurSelfType() != nil {
+        if tokens.Peek().Type == token.Name && tokens.Peek().Str == state.identObj.GetCurSelfType().String() {
             tokens.Next()
-            return identObj.CurSelfType
+            return state.identObj.GetCurSelfType()
 
-        } else if tokens.Peek().Type == token.Mul && tokens.Peek2().Type == token.Name && tokens.Peek2().Str == identObj.CurSelfType.String() {
+        } else if tokens.Peek().Type == token.Mul && tokens.Peek2().Type == token.Name && tokens.Peek2().Str == state.identObj.GetCurSelfType().String() {
             tokens.Next()
             tokens.Next()
-            return types.PtrType{ BaseType: identObj.CurSelfType } 
+            return types.PtrType{ BaseType: state.identObj.GetCurSelfType() } 
         }
     }
 
     return nil
 }
 
-func prsSelf(tokens *token.Tokens) (name token.Token, typ types.Type) {
+func (state *State) prsSelf(tokens *token.Tokens) (name token.Token, typ types.Type) {
     if tokens.Cur().Type == token.Mul && tokens.Peek().Type == token.Self {
-        return tokens.Next(), types.PtrType{ BaseType: createSelfType(tokens) } 
+        return tokens.Next(), types.PtrType{ BaseType: state.createSelfType(tokens) } 
     }
 
     if tokens.Cur().Type == token.Self {
         name = tokens.Cur()
-        typ = prsOptionalSelfType(tokens)
+        typ = state.prsOptionalSelfType(tokens)
         if typ == nil {
-            typ = createSelfType(tokens)
+            typ = state.createSelfType(tokens)
         }
         return
     }
 
     name = tokens.Cur()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
-    typ = prsOptionalSelfType(tokens)
+    typ = state.prsOptionalSelfType(tokens)
 
     return
 }
 
-func prsArgs(tokens *token.Tokens, isInterfaceFn bool) (names []token.Token, types []types.Type) {
+func (state *State) prsArgs(tokens *token.Tokens, isInterfaceFn bool) (names []token.Token, types []types.Type, muts []bool) {
     if tokens.Cur().Type != token.ParenL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"(\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"(\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     if tokens.Next().Type != token.ParenR {
-        name, t := prsSelf(tokens)
+        mut := prsMut(tokens)
+        name, t := state.prsSelf(tokens)
 
         if t == nil {
-            name,t = prsNameType(tokens)
+            name,t = state.prsNameType(tokens)
         } else if !isInterfaceFn {
-            fmt.Fprintln(os.Stderr, "[ERROR] Self can only be used for interface funcs (inside interface / impl)")
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Error("Self can only be used for interface funcs (inside interface / impl)")
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
 
         names = append(names, name)
         types = append(types, t)
+        muts = append(muts, mut)
 
         for tokens.Next().Type == token.Comma {
             tokens.Next()
-            name,t := prsNameType(tokens)
+            mut := prsMut(tokens)
+            name,t := state.prsNameType(tokens)
             names = append(names, name)
             types = append(types, t)
+            muts = append(muts, mut)
         }
     }
 
     if tokens.Cur().Type != token.ParenR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \")\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \")\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return
 }
 
-func prsImport(tokens *token.Tokens) ast.Import {
+func (state *State) prsImport(tokens *token.Tokens) ast.Import {
     pos := tokens.Cur().Pos
     path := tokens.Next()
 
     if path.Type != token.Str {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a path as string but got %v\n", path)
-        fmt.Fprintln(os.Stderr, "\t" + path.At())
-        os.Exit(1)
+        state.diag.Errorf("expected a path as string but got %v", path)
+        state.diag.At(path.At())
+        state.diag.Exit()
     }
 
     d := ast.Import{ Pos: pos, Path: path }
 
-    if tokens, isNew := imprt.Import(path); isNew {
+    if tokens, isNew := state.imprt.Import(path); isNew {
         for tokens.Peek().Type != token.EOF {
             tokens.SetLastImport()
-            d.Decls = append(d.Decls, prsDecl(tokens))
+            d.Decls = append(d.Decls, state.prsDecl(tokens))
         }
 
-        imprt.EndImport(tokens.GetPath())
+        state.imprt.EndImport(tokens.GetPath())
     }
 
     return d
@@ -4,14 +4,10 @@ import (
 	"fmt"
 	"gamma/ast"
 	"gamma/ast/identObj"
-	"gamma/cmpTime"
 	"gamma/cmpTime/constVal"
 	"gamma/token"
 	"gamma/types"
-	"gamma/types/array"
 	"gamma/types/char"
-	"gamma/types/str"
-	"os"
 	"reflect"
 	"strconv"
 )
@@ -28,81 +24,81 @@ const (
 )
 
 
-func prsExpr(tokens *token.Tokens) ast.Expr {
-    return prsExprWithPrecedence(tokens, 0)
+func (state *State) prsExpr(tokens *token.Tokens) ast.Expr {
+    return state.prsExprWithPrecedence(tokens, 0)
 }
 
-func prsExprWithPrecedence(tokens *token.Tokens, precedence precedence) ast.Expr {
+func (state *State) prsExprWithPrecedence(tokens *token.Tokens, precedence precedence) ast.Expr {
     var expr ast.Expr
     switch tokens.Cur().Type {
     case token.Mul:
-        if isNextType(tokens) { 
+        if state.isNextType(tokens) { 
             typePos := tokens.Cur().Pos
-            t := prsType(tokens)
-            expr = prsPostType(tokens, t, typePos)
+            t := state.prsType(tokens)
+            expr = state.prsPostType(tokens, t, typePos)
         } else {
-            expr = prsUnaryExpr(tokens)
+            expr = state.prsUnaryExpr(tokens)
         }
 
     case token.Name:
-        if isType(tokens) { 
+        if state.isType(tokens) { 
             typePos := tokens.Cur().Pos
-            t := prsType(tokens)
-            expr = prsPostType(tokens, t, typePos)
+            t := state.prsType(tokens)
+            expr = state.prsPostType(tokens, t, typePos)
         } else {
-            ident := prsIdentExpr(tokens)
-            expr = prsPostNameExpr(tokens, ident, nil)
+            ident := state.prsIdentExpr(tokens)
+            expr = state.prsPostNameExpr(tokens, ident, nil)
         }
 
     case token.Typename, token.SelfType, token.BrackL:
         typePos := tokens.Cur().Pos
-        t := prsType(tokens)
-        expr = prsPostType(tokens, t, typePos)
+        t := state.prsType(tokens)
+        expr = state.prsPostType(tokens, t, typePos)
 
     case token.Plus, token.Minus, token.Amp, token.BitNot:
-        expr = prsUnaryExpr(tokens)
+        expr = state.prsUnaryExpr(tokens)
 
     case token.Self:
-        ident := prsIdentExpr(tokens)
-        expr = prsPostNameExpr(tokens, ident, nil)
+        ident := state.prsIdentExpr(tokens)
+        expr = state.prsPostNameExpr(tokens, ident, nil)
 
     case token.Number, token.Boolean, token.Char:
-        expr = prsBasicLit(tokens)
+        expr = state.prsBasicLit(tokens)
 
     case token.Str:
-        expr = prsStrLit(tokens)
+        expr = state.prsStrLit(tokens)
 
     case token.XSwitch:
-        expr = prsXSwitch(tokens)
+        expr = state.prsXSwitch(tokens)
 
     case token.UndScr:
-        expr = prsIdentExpr(tokens)
+        expr = state.prsIdentExpr(tokens)
 
     case token.ParenL:
-        expr = prsParenExpr(tokens)
+        expr = state.prsParenExpr(tokens)
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] no valid expression (got \"%v\")\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("no valid expression (got \"%v\")", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
 
         return &ast.BadExpr{}
     }
 
     for {
         if isBinaryExpr(tokens) {
-            expr = prsBinary(tokens, expr, precedence)
+            expr = state.prsBinary(tokens, expr, precedence)
         }
 
         if tokens.Peek().Type == token.BrackL {
             tokens.Next()
-            expr = prsIndexExpr(tokens, expr)
+            expr = state.prsIndexExpr(tokens, expr)
         } else if tokens.Peek().Type == token.Dot {
             tokens.Next()
-            expr = prsDotExpr(tokens, expr, nil)
+            expr = state.prsDotExpr(tokens, expr, nil)
         } else if tokens.Peek().Type == token.As && CAST_PRECEDENCE >= precedence {
             tokens.Next()
-            expr = prsCast(tokens, expr)
+            expr = state.prsCast(tokens, expr)
         } else {
             break
         }
@@ -167,118 +163,158 @@ func getPrecedence(tokens *token.Tokens) precedence {
     }
 }
 
-func prsName(tokens *token.Tokens) token.Token {
+func (state *State) prsName(tokens *token.Tokens) token.Token {
     name := tokens.Cur()
     if name.Type == token.Self {
-        if identObj.CurSelfType == nil {
-            fmt.Fprintln(os.Stderr, "[ERROR] self used outside of impl and interface")
-            fmt.Fprintln(os.Stderr, "\t" + name.At())
-            os.Exit(1)
+        if state.identObj.GetCurSelfType() == nil {
+            state.diag.Error("self used outside of impl and interface")
+            state.diag.At(name.At())
+            state.diag.Exit()
         }
 
         name.Type = token.Name
     }
 
     if name.Type != token.Name && name.Type != token.UndScr && name.Type != token.Typename {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
 
     return name
 }
 
-func checkDefined(ident *ast.Ident) {
+func (state *State) checkDefined(ident *ast.Ident) {
     if ident.Obj == nil && ident.Name == "_" {
-        fmt.Fprintf(os.Stderr, "[ERROR] %v is not defined\n", ident.Name)
-        fmt.Fprintln(os.Stderr, "\t" + ident.At())
-        os.Exit(1)
+        state.diag.Errorf("%v is not defined", ident.Name)
+        state.diag.At(ident.At())
+        state.diag.Exit()
     }
 }
 
-func prsPostNameExpr(tokens *token.Tokens, ident *ast.Ident, insetType types.Type) ast.Expr {
+func (state *State) prsPostNameExpr(tokens *token.Tokens, ident *ast.Ident, insetType types.Type) ast.Expr {
     switch tokens.Peek().Type {
     case token.ParenL:
         tokens.Next()
-        return prsCallFn(tokens, ident, insetType)
+        return state.prsCallFn(tokens, ident, insetType)
 
     case token.Dot:
+        state.checkObjDefined(ident)
         tokens.Next()
-        return prsDotExpr(tokens, ident, insetType)
+        return state.prsDotExpr(tokens, ident, insetType)
 
     case token.DefConst:
         tokens.Next()
-        insetType := prsInsetType(tokens)
-        return prsPostNameExpr(tokens, ident, insetType)
+        insetType := state.prsInsetType(tokens)
+        return state.prsPostNameExpr(tokens, ident, insetType)
     }
 
+    state.checkObjDefined(ident)
+    return ident
+}
+
+func (state *State) checkObjDefined(ident *ast.Ident) {
     if ident.Obj == nil {
-        fmt.Fprintf(os.Stderr, "[ERROR] %s is not defined\n", ident.Name)
-        fmt.Fprintln(os.Stderr, "\t" + ident.At())
-        os.Exit(1)
+        state.diag.Errorf("%s is not defined", ident.Name)
+        state.diag.Suggest(ident.Name, state.identObj.VisibleNames(nil))
+        state.diag.At(ident.At())
+        state.diag.Exit()
+    }
+}
+
+// the ret type of a func defined later is only known after resolving
+func (state *State) checkTypeKnown(e ast.Expr) {
+    if e.GetType() == nil {
+        state.diag.Error("void value cannot be indexed or accessed with \".\"")
+        state.diag.At(e.At())
+        state.diag.Exit()
+    }
+
+    if t,ok := e.GetType().(types.InferType); ok && t.DefaultType == nil {
+        state.diag.Error("the type of this expression is not known yet (define the called func before this use)")
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
-    
-    return ident
 }
 
-func prsPostType(tokens *token.Tokens, t types.Type, typePos token.Pos) ast.Expr {
+func (state *State) prsPostType(tokens *token.Tokens, t types.Type, typePos token.Pos) ast.Expr {
     tokens.Next()
 
     switch tokens.Cur().Type {
     case token.BraceL:
         switch t := t.(type) {
         case types.VecType:
-            return prsVecLit(tokens, t, typePos)
+            return state.prsVecLit(tokens, t, typePos)
 
         case types.ArrType:
-            return prsArrayLit(tokens, t, typePos)
+            return state.prsArrayLit(tokens, t, typePos)
 
         case types.StructType:
-            return prsStructLit(tokens, t, typePos)
+            return state.prsStructLit(tokens, t, typePos)
 
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] expected an array or vec type before \"{\" but got %v\n", t)
-            os.Exit(1)
+            state.diag.Errorf("expected an array or vec type before \"{\" but got %v", t)
+            state.diag.Exit()
             return &ast.BadExpr{}
         }
 
     case token.Dot:
         if t,ok := t.(types.EnumType); ok {
             if isEnumLit(t, tokens.Peek().Str) {
-                return prsEnumLit(tokens, t, typePos)
+                return state.prsEnumLit(tokens, t, typePos)
+            }
+
+            if name := tokens.Peek(); !state.identObj.HasFunc(t, name.Str) {
+                state.diag.Errorf("enum %s has no element or function called %s", t.Name, name.Str)
+                state.diag.Linef("elems: %v", t.GetElems())
+                state.diag.Suggest(name.Str, append(t.GetElems(), state.identObj.FuncNames(t)...))
+                state.diag.At(name.At())
+                state.diag.Exit()
             }
         }
 
-        return prsCallFromFnSrc(tokens, t, typePos, nil)
+        return state.prsCallFromFnSrc(tokens, t, typePos, nil)
 
     case token.DefConst:
-        insetType := prsInsetType(tokens)
+        insetType := state.prsInsetType(tokens)
         t = types.ReplaceGeneric(t, insetType)
-        return prsPostType(tokens, t, typePos)
+        return state.prsPostType(tokens, t, typePos)
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unexpected \"%s\" after type %v\n", tokens.Cur().Str, t)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("unexpected \"%s\" after type %v", tokens.Cur().Str, t)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadExpr{}
     }
 }
 
-func prsIdentExpr(tokens *token.Tokens) *ast.Ident {
+func (state *State) prsIdentExpr(tokens *token.Tokens) *ast.Ident {
     // if wildcard ("_")
     if tokens.Cur().Type == token.UndScr {
         return &ast.Ident{ Name: tokens.Cur().Str, Pos: tokens.Cur().Pos, Obj: nil }
     }
 
-    ident := prsName(tokens)
-    obj := identObj.Get(ident.Str)
+    ident := state.prsName(tokens)
+    obj := state.identObj.Get(ident.Str)
 
     return &ast.Ident{ Name: ident.Str, Pos: ident.Pos, Obj: obj }
 }
 
-func prsBasicLit(tokens *token.Tokens) ast.Expr {
+func (state *State) prsDefinedIdent(tokens *token.Tokens) *ast.Ident {
+    ident := state.prsIdentExpr(tokens)
+    state.checkObjDefined(ident)
+    return ident
+}
+
+func (state *State) prsBasicLit(tokens *token.Tokens) ast.Expr {
     val := tokens.Cur()
-    t := types.TypeOfVal(val.Str)
+    t := state.types.TypeOfVal(val.Str)
+    if t == nil {
+        state.diag.Errorf("expected a literal but got %v", val)
+        state.diag.At(val.At())
+        state.diag.Exit()
+        return &ast.BadExpr{}
+    }
 
     switch t.GetKind() {
     case types.Bool:
@@ -290,8 +326,8 @@ func prsBasicLit(tokens *token.Tokens) ast.Expr {
             var ok bool
             repr,ok = char.EscapeByte(val.Str[2])
             if !ok {
-                fmt.Fprintf(os.Stderr, "[ERROR] unexpected escape sequence %s\n", val.Str)
-                os.Exit(1)
+                state.diag.Errorf("unexpected escape sequence %s", val.Str)
+                state.diag.Exit()
             }
         } else {
             repr = uint8(val.Str[1])
@@ -308,42 +344,42 @@ func prsBasicLit(tokens *token.Tokens) ast.Expr {
     }
 }
 
-func prsStrLit(tokens *token.Tokens) *ast.StrLit {
+func (state *State) prsStrLit(tokens *token.Tokens) *ast.StrLit {
     val := tokens.Cur()
 
-    idx := str.Add(val)
+    idx := state.str.Add(val)
     return &ast.StrLit{ Idx: uint64(idx), Val: val }
 }
 
-func prsArrayLit(tokens *token.Tokens, arrType types.ArrType, typePos token.Pos) *ast.ArrayLit {
+func (state *State) prsArrayLit(tokens *token.Tokens, arrType types.ArrType, typePos token.Pos) *ast.ArrayLit {
     braceLPos := tokens.Cur().Pos
-    lit := prsArrayLitExprs(tokens, arrType)
+    lit := state.prsArrayLitExprs(tokens, arrType)
     braceRPos := tokens.Cur().Pos
 
     lit.BraceLPos = braceLPos
     lit.BraceRPos = braceRPos
     lit.Pos = typePos
-    lit.Idx = array.Add(arrType, constEvalExprs(lit.Values))
+    lit.Idx = state.array.Add(arrType, state.constEvalExprs(lit.Values))
     return &lit
 }
 
-func prsVecLit(tokens *token.Tokens, vecType types.VecType, typePos token.Pos) *ast.VectorLit {
+func (state *State) prsVecLit(tokens *token.Tokens, vecType types.VecType, typePos token.Pos) *ast.VectorLit {
     lit := ast.VectorLit{ Pos: typePos, Type: vecType }
 
     lit.BraceLPos = tokens.Cur().Pos
     if tokens.Cur().Type != token.BraceL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"{\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"{\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     tokens.Next()
     if tokens.Cur().Type == token.Name && tokens.Peek().Type == token.Colon {
-        prsVecLitField(tokens, &lit)
+        state.prsVecLitField(tokens, &lit)
         if tokens.Peek().Type == token.Comma {
             tokens.Next()
             tokens.Next()
-            prsVecLitField(tokens, &lit)
+            state.prsVecLitField(tokens, &lit)
         }
 
         if lit.Cap == nil {
@@ -359,43 +395,43 @@ func prsVecLit(tokens *token.Tokens, vecType types.VecType, typePos token.Pos) *
             }
         }
     } else if tokens.Cur().Type != token.BraceR {
-        lit.Cap = prsExpr(tokens)
+        lit.Cap = state.prsExpr(tokens)
     }
 
     lit.BraceRPos = tokens.Next().Pos
     if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"}\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"}\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
     return &lit
 }
 
-func prsVecLitField(tokens *token.Tokens, lit *ast.VectorLit) {
+func (state *State) prsVecLitField(tokens *token.Tokens, lit *ast.VectorLit) {
     switch tokens.Cur().Str {
     case "cap":
         tokens.Next()
         tokens.Next()
-        lit.Cap = prsExpr(tokens)
+        lit.Cap = state.prsExpr(tokens)
     case "len":
         tokens.Next()
         tokens.Next()
-        lit.Len = prsExpr(tokens)
+        lit.Len = state.prsExpr(tokens)
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] vec has no field \"%s\" (only len and cap)\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("vec has no field \"%s\" (only len and cap)", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 }
 
-func prsStructLit(tokens *token.Tokens, t types.StructType, typePos token.Pos) *ast.StructLit {
-    s := identObj.Get(t.Name).(*identObj.Struct)
+func (state *State) prsStructLit(tokens *token.Tokens, t types.StructType, typePos token.Pos) *ast.StructLit {
+    s := state.identObj.Get(t.Name).(*identObj.Struct)
 
     braceL := tokens.Cur()
     if braceL.Type != token.BraceL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"{\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"{\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
     if tokens.Peek().Type == token.BraceR {
         return &ast.StructLit{
@@ -411,24 +447,43 @@ func prsStructLit(tokens *token.Tokens, t types.StructType, typePos token.Pos) *
 
     var fields []ast.FieldLit
     if tokens.Next().Type != token.BraceR {
-        f := prsFieldLit(tokens, omitNames)
+        f := state.prsFieldLit(tokens, omitNames)
         fields = append(fields, f)
 
         for tokens.Next().Type == token.Comma {
             tokens.Next()
-            f := prsFieldLit(tokens, omitNames)
+            f := state.prsFieldLit(tokens, omitNames)
             fields = append(fields, f)
         }
     }
 
+    if tokens.Cur().Type != token.BraceR {
+        state.diag.Errorf("expected \"}\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
+    }
+
+    if len(fields) != len(t.Types) {
+        state.diag.Errorf("expected %d fields for struct \"%s\" but got %d", len(t.Types), t.Name, len(fields))
+        state.diag.Linef("expected: %v", t.Types)
+        state.diag.Linef("got:      %v", fieldsToTypes(fields))
+        state.diag.At(braceL.Pos.At())
+        state.diag.Exit()
+    }
+
     if !omitNames {
         orderedFields := make([]ast.FieldLit, len(fields))
         for _,f := range fields {
             if idx := t.GetFieldNum(f.Name.Str); idx == -1 {
-                fmt.Fprintf(os.Stderr, "[ERROR] struct \"%s\" has no field called \"%s\"\n", t, f.Name.Str)
-                fmt.Fprintf(os.Stderr, "\tfields: %v\n", s.GetFieldNames())
-                fmt.Fprintln(os.Stderr, "\t" + f.At())
-                os.Exit(1)
+                state.diag.Errorf("struct \"%s\" has no field called \"%s\"", t, f.Name.Str)
+                state.diag.Linef("fields: %v", s.GetFieldNames())
+                state.diag.Suggest(f.Name.Str, s.GetFieldNames())
+                state.diag.At(f.At())
+                state.diag.Exit()
+            } else if orderedFields[idx].Value != nil {
+                state.diag.Errorf("field \"%s\" of struct \"%s\" is set more than once", f.Name.Str, t)
+                state.diag.At(f.At())
+                state.diag.Exit()
             } else {
                 orderedFields[idx] = f
             }
@@ -436,20 +491,6 @@ func prsStructLit(tokens *token.Tokens, t types.StructType, typePos token.Pos) *
         fields = orderedFields
     }
 
-    if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"}\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
-    }
-
-    if len(fields) != len(t.Types) {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected %d fields for struct \"%s\" but got %d\n", len(t.Types), t.Name, len(fields))
-        fmt.Fprintf(os.Stderr, "\texpected: %v\n", t.Types)
-        fmt.Fprintf(os.Stderr, "\tgot:      %v\n", fieldsToTypes(fields))
-        fmt.Fprintln(os.Stderr, "\t" + braceL.Pos.At())
-        os.Exit(1)
-    }
-
     return &ast.StructLit{
         Pos: typePos,
         StructType: t,
@@ -472,17 +513,17 @@ func fieldsToTypes(fields []ast.FieldLit) []types.Type {
     return res
 }
 
-func prsFieldLit(tokens *token.Tokens, omitNames bool) ast.FieldLit {
+func (state *State) prsFieldLit(tokens *token.Tokens, omitNames bool) ast.FieldLit {
     var name token.Token
     var pos token.Pos
 
     if !omitNames {
-        name = prsName(tokens)
+        name = state.prsName(tokens)
 
         if tokens.Next().Type != token.Colon {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a \":\" but got %v\n", tokens.Cur())
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Errorf("expected a \":\" but got %v", tokens.Cur())
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
         pos = name.Pos
 
@@ -491,24 +532,24 @@ func prsFieldLit(tokens *token.Tokens, omitNames bool) ast.FieldLit {
         pos = tokens.Cur().Pos
     }
 
-    return ast.FieldLit{ Name: name, Pos: pos, Value: prsExpr(tokens) }
+    return ast.FieldLit{ Name: name, Pos: pos, Value: state.prsExpr(tokens) }
 }
 
-func constEvalExprs(values []ast.Expr) []constVal.ConstVal {
+func (state *State) constEvalExprs(values []ast.Expr) []constVal.ConstVal {
     res := make([]constVal.ConstVal, 0, len(values))
 
     for _,v := range values {
-        res = append(res, cmpTime.ConstEvalArrWithNils(v))
+        res = append(res, state.cmpTime.ConstEvalArrWithNils(v))
     }
 
     return res
 }
 
-func prsArrayLitExprs(tokens *token.Tokens, t types.ArrType) ast.ArrayLit {
+func (state *State) prsArrayLitExprs(tokens *token.Tokens, t types.ArrType) ast.ArrayLit {
     if tokens.Cur().Type != token.BraceL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"{\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"{\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     exprs := []ast.Expr{}
@@ -519,53 +560,54 @@ func prsArrayLitExprs(tokens *token.Tokens, t types.ArrType) ast.ArrayLit {
 
     parsedLen := uint64(1)
     if baseType,ok := t.BaseType.(types.ArrType); ok {
-        es := prsArrayLitExprs(tokens, baseType)
+        es := state.prsArrayLitExprs(tokens, baseType)
         exprs = append(exprs, &es)
 
         for tokens.Next().Type == token.Comma {
             if tokens.Next().Type == token.BraceR { break } // trailing comma
-            es := prsArrayLitExprs(tokens, baseType)
+            es := state.prsArrayLitExprs(tokens, baseType)
             exprs = append(exprs, &es)
             parsedLen++
         }
     } else {
-        exprs = append(exprs, prsExpr(tokens))
+        exprs = append(exprs, state.prsExpr(tokens))
 
         for tokens.Next().Type == token.Comma {
             if tokens.Next().Type == token.BraceR { break } // trailing comma
-            exprs = append(exprs, prsExpr(tokens))
+            exprs = append(exprs, state.prsExpr(tokens))
             parsedLen++
         }
     }
 
     // check missing ,
     if parsedLen < t.Len && tokens.Cur().Type != token.Comma && tokens.Cur().Type != token.BraceR {
-        fmt.Fprintln(os.Stderr, "[ERROR] missing \",\"")
-        fmt.Fprintf(os.Stderr, "\tarray type: %v\n", t)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Last().At())
-        os.Exit(1)
+        state.diag.Error("missing \",\"")
+        state.diag.Linef("array type: %v", t)
+        state.diag.At(tokens.Last().At())
+        state.diag.Exit()
     }
 
     if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"}\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"}\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return ast.ArrayLit{ Values: exprs, Type: t, Idx: ^uint64(0) }
 }
 
-func prsIndexExpr(tokens *token.Tokens, e ast.Expr) *ast.Indexed {
+func (state *State) prsIndexExpr(tokens *token.Tokens, e ast.Expr) *ast.Indexed {
+    state.checkTypeKnown(e)
     res := ast.Indexed{ ArrExpr: e, BrackLPos: tokens.Cur().Pos, ArrType: e.GetType() }
 
     tokens.Next()
-    res.Index = prsExpr(tokens)
+    res.Index = state.prsExpr(tokens)
 
     posR := tokens.Next()
     if posR.Type != token.BrackR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"]\" but got %v\n", posR)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"]\" but got %v", posR)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     switch t := res.ArrType.(type) {
@@ -574,23 +616,23 @@ func prsIndexExpr(tokens *token.Tokens, e ast.Expr) *ast.Indexed {
     case types.VecType:
         res.Type = t.BaseType
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] you cannot index %v", t)
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("you cannot index %v", t)
+        state.diag.At(e.At())
+        state.diag.Exit()
     }
 
     return &res
 }
 
-func getStructFromExpr(expr ast.Expr) *identObj.Struct {
+func (state *State) getStructFromExpr(expr ast.Expr) *identObj.Struct {
     typ := expr.GetType()
 
     if t,ok := typ.(types.StructType); ok {
-        if s,ok := identObj.Get(t.Name).(*identObj.Struct); ok {
+        if s,ok := state.identObj.Get(t.Name).(*identObj.Struct); ok {
             return s           
         }
     } else if _,ok := typ.(*types.StructType); ok {
-        if s,ok := identObj.Get(t.Name).(*identObj.Struct); ok {
+        if s,ok := state.identObj.Get(t.Name).(*identObj.Struct); ok {
             return s           
         }
     }
@@ -598,17 +640,17 @@ func getStructFromExpr(expr ast.Expr) *identObj.Struct {
     return nil
 }
 
-func prsDotCallFn(tokens *token.Tokens, obj ast.Expr, dotPos token.Pos, typ types.Type, name token.Token, f *identObj.Func) ast.Expr {
+func (state *State) prsDotCallFn(tokens *token.Tokens, obj ast.Expr, dotPos token.Pos, typ types.Type, name token.Token, f *identObj.Func) ast.Expr {
     tokens.Next()
-    insetType := prsInsetType(tokens)
+    insetType := state.prsInsetType(tokens)
 
     posL := tokens.Cur().Pos
-    vals := prsPassArgs(tokens)
+    vals := state.prsPassArgs(tokens)
     posR := tokens.Cur().Pos
 
-    vals = addSelfArg(vals, f, obj)
+    vals = state.addSelfArg(vals, f, obj)
 
-    f = resolveGeneric(f, name.Pos, &insetType, vals)
+    f = state.resolveGeneric(f, name.Pos, &insetType, vals)
 
     ident := ast.Ident{ Name: name.Str, Pos: name.Pos, Obj: f }
     return &ast.FnCall{ 
@@ -617,17 +659,17 @@ func prsDotCallFn(tokens *token.Tokens, obj ast.Expr, dotPos token.Pos, typ type
     }
 }
 
-func prsDotField(tokens *token.Tokens, t types.Type, obj ast.Expr, dotPos token.Pos, name token.Token) *ast.Field {
+func (state *State) prsDotField(tokens *token.Tokens, t types.Type, obj ast.Expr, dotPos token.Pos, name token.Token) *ast.Field {
     switch typ := t.(type) {
     case *types.StructType:
         field := &ast.Field{ Obj: obj, DotPos: dotPos, FieldName: name }
         field.StructType = *typ
-        field.Type = field.StructType.GetType(field.FieldName.Str)
+        field.Type = state.structFieldType(field)
         return field
     case types.StructType:
         field := &ast.Field{ Obj: obj, DotPos: dotPos, FieldName: name }
         field.StructType = typ
-        field.Type = field.StructType.GetType(field.FieldName.Str)
+        field.Type = state.structFieldType(field)
         return field
 
     case types.ArrType:
@@ -646,54 +688,69 @@ func prsDotField(tokens *token.Tokens, t types.Type, obj ast.Expr, dotPos token.
         return field
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] type %s has no field/function called %s\n", typ, name.Str)
-        fmt.Fprintln(os.Stderr, "\t" + obj.At())
-        os.Exit(1)
+        state.diag.Errorf("type %s has no field/function called %s", typ, name.Str)
+        state.diag.Suggest(name.Str, state.identObj.FuncNames(typ))
+        state.diag.At(obj.At())
+        state.diag.Exit()
         return nil
     }
 }
 
-func prsDotExpr(tokens *token.Tokens, obj ast.Expr, insetType types.Type) ast.Expr {
+// the field type is needed by the following dots (a.b.c)
+func (state *State) structFieldType(field *ast.Field) types.Type {
+    t := field.StructType.GetType(field.FieldName.Str)
+    if t == nil {
+        state.diag.Errorf("struct %s has no %s field", field.StructType.Name, field.FieldName.Str)
+        state.diag.Linef("fields: %v", field.StructType.GetFields())
+        state.diag.Suggest(field.FieldName.Str, append(field.StructType.GetFields(), state.identObj.FuncNames(field.StructType)...))
+        state.diag.At(field.At())
+        state.diag.Exit()
+    }
+    return t
+}
+
+func (state *State) prsDotExpr(tokens *token.Tokens, obj ast.Expr, insetType types.Type) ast.Expr {
     dot := tokens.Cur()
     if dot.Type != token.Dot {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \".\" but got %v\n", dot)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \".\" but got %v", dot)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     name := tokens.Next()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
+    state.checkTypeKnown(obj)
     t := obj.GetType()
-    obj, t = autoDeref(obj, name, t)
+    obj, t = state.autoDeref(obj, name, t)
 
-    if f := getInterfaceFunc(t, name.Str); f != nil {
-        return prsDotCallFn(tokens, obj, dot.Pos, t, name, f)
+    if f := state.getInterfaceFunc(t, name.Str); f != nil {
+        return state.prsDotCallFn(tokens, obj, dot.Pos, t, name, f)
     } else {
-        return prsDotField(tokens, t, obj, dot.Pos, name)
+        return state.prsDotField(tokens, t, obj, dot.Pos, name)
     }
 }
 
-func getInterfaceFunc(t types.Type, name string) *identObj.Func {
+func (state *State) getInterfaceFunc(t types.Type, name string) *identObj.Func {
     // TODO: replace generic with guard
 
-    if impl := identObj.GetImplementable(t, false); impl != nil {
+    if impl := state.identObj.GetImplementable(t, false); impl != nil {
         return impl.GetFunc(name)
     }
 
-    if I,ok := identObj.Get(t.String()).(*identObj.Interface); ok {
+    if I,ok := state.identObj.Get(t.String()).(*identObj.Interface); ok {
         return I.GetFunc(name)
     }
 
     return nil
 }
 
-func autoDeref(obj ast.Expr, field token.Token, t types.Type) (derefedObj ast.Expr, baseType types.Type)  {
-    if identObj.HasFunc(t, field.Str) {
+func (state *State) autoDeref(obj ast.Expr, field token.Token, t types.Type) (derefedObj ast.Expr, baseType types.Type)  {
+    if state.identObj.HasFunc(t, field.Str) {
         return obj, t
     }
 
@@ -705,53 +762,53 @@ func autoDeref(obj ast.Expr, field token.Token, t types.Type) (derefedObj ast.Ex
             Operand: obj,
         }
 
-        return autoDeref(derefedObj, field, typ.BaseType)
+        return state.autoDeref(derefedObj, field, typ.BaseType)
     } else {
         return obj, t
     }
 }
 
-func prsEnumLit(tokens *token.Tokens, t types.EnumType, typePos token.Pos) *ast.EnumLit {
+func (state *State) prsEnumLit(tokens *token.Tokens, t types.EnumType, typePos token.Pos) *ast.EnumLit {
     if tokens.Cur().Type != token.Dot {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a \".\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a \".\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     elemName := tokens.Next()
     if elemName.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", elemName)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", elemName)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     var content *ast.Paren = nil
     if tokens.Peek().Type == token.ParenL {
         tokens.Next()
-        content = prsParenExpr(tokens)
+        content = state.prsParenExpr(tokens)
     }
 
     contentType := t.GetType(elemName.Str)
     return &ast.EnumLit{ Pos: typePos, Type: t, ElemName: elemName, ContentType: contentType, Content: content }
 }
 
-func prsUnwrapElem(tokens *token.Tokens, unwrap *ast.Unwrap) *ast.Unwrap {
+func (state *State) prsUnwrapElem(tokens *token.Tokens, unwrap *ast.Unwrap) *ast.Unwrap {
     if unwrap.ElemName.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", unwrap.ElemName)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", unwrap.ElemName)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     if tokens.Peek().Type == token.ParenL {
         parenLPos := tokens.Next().Pos
 
         tokens.Next()
-        ident := prsName(tokens)
+        ident := state.prsName(tokens)
 
         if tokens.Next().Type != token.ParenR {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected \")\" but got %v\n", tokens.Cur())
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Errorf("expected \")\" but got %v", tokens.Cur())
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
         parenRPos := tokens.Cur().Pos
 
@@ -760,12 +817,12 @@ func prsUnwrapElem(tokens *token.Tokens, unwrap *ast.Unwrap) *ast.Unwrap {
 
         var obj identObj.IdentObj = nil
         if !ununsedObj {
-            if c := cmpTime.ConstEval(unwrap.SrcExpr); c != nil {
+            if c := state.cmpTime.ConstEval(unwrap.SrcExpr); c != nil {
                 if c,ok := c.(*constVal.EnumConst); ok {
-                    obj = identObj.DecConst(ident, t, c.Elem)
+                    obj = state.identObj.DecConst(ident, t, c.Elem)
                 }
             } else {
-                obj = identObj.DecVar(ident, t) 
+                obj = state.identObj.DecVar(ident, t) 
             }
         }
 
@@ -778,60 +835,68 @@ func prsUnwrapElem(tokens *token.Tokens, unwrap *ast.Unwrap) *ast.Unwrap {
     return unwrap
 }
 
-func prsUnwrapHead(tokens *token.Tokens, srcExpr ast.Expr) *ast.Unwrap {
+func (state *State) prsUnwrapHead(tokens *token.Tokens, srcExpr ast.Expr) *ast.Unwrap {
     colonPos := tokens.Next().Pos
 
     name := tokens.Next()
     if name.Type != token.Name {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a Name but got %v\n", name)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a Name but got %v", name)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     var insetType types.Type = nil
     if tokens.Peek2().Type == token.Lss {
         tokens.Next()
-        insetType = prsInsetType(tokens)
+        insetType = state.prsInsetType(tokens)
     }
 
     if tokens.Next().Type != token.Dot {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected a \".\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected a \".\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     var enum *identObj.Enum = nil
-    if obj := identObj.Get(name.Str); obj != nil {
+    if obj := state.identObj.Get(name.Str); obj != nil {
         if e,ok := obj.(*identObj.Enum); ok {
             enum = e
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] \"%s\" is not an enum (got %v)\n", name.Str, reflect.TypeOf(obj))
-            fmt.Fprintln(os.Stderr, "\t" + name.At())
-            os.Exit(1)
+            state.diag.Errorf("\"%s\" is not an enum (got %v)", name.Str, reflect.TypeOf(obj))
+            state.diag.At(name.At())
+            state.diag.Exit()
         }
     } else {
-        fmt.Fprintf(os.Stderr, "[ERROR] enum \"%s\" is not defined\n", name.Str)
-        fmt.Fprintln(os.Stderr, "\t" + name.At())
-        os.Exit(1)
+        state.diag.Errorf("enum \"%s\" is not defined", name.Str)
+        state.diag.Suggest(name.Str, state.identObj.VisibleNames(identObj.IsEnum))
+        state.diag.At(name.At())
+        state.diag.Exit()
     }
     enumType := types.ReplaceGeneric(enum.GetType(), insetType).(types.EnumType)
 
     return &ast.Unwrap{ SrcExpr: srcExpr, ColonPos: colonPos, EnumType: enumType }
 }
 
-func prsUnwrap(tokens *token.Tokens, srcExpr ast.Expr) *ast.Unwrap {
-    unwrap := prsUnwrapHead(tokens, srcExpr)
+func (state *State) prsUnwrap(tokens *token.Tokens, srcExpr ast.Expr) *ast.Unwrap {
+    unwrap := state.prsUnwrapHead(tokens, srcExpr)
 
     elemName := tokens.Next()
     if elemName.Type == token.BraceL {
         return unwrap
     } else {
         unwrap.ElemName = elemName
-        return prsUnwrapElem(tokens, unwrap)
+        return state.prsUnwrapElem(tokens, unwrap)
     }
 }
 
-func addSelfArg(values []ast.Expr, f *identObj.Func, obj ast.Expr) []ast.Expr {
+func (state *State) addSelfArg(values []ast.Expr, f *identObj.Func, obj ast.Expr) []ast.Expr {
+    if len(f.GetArgs()) == 0 {
+        state.diag.Errorf("%s has no self arg (call it on the type instead)", f.GetName())
+        state.diag.At(obj.At())
+        state.diag.Exit()
+        return values
+    }
+
     values = append(values, nil)
     copy(values[1:], values)
 
@@ -850,121 +915,121 @@ func addSelfArg(values []ast.Expr, f *identObj.Func, obj ast.Expr) []ast.Expr {
     return values
 }
 
-func prsParenExpr(tokens *token.Tokens) *ast.Paren {
+func (state *State) prsParenExpr(tokens *token.Tokens) *ast.Paren {
     expr := ast.Paren{ ParenLPos: tokens.Cur().Pos }
 
     tokens.Next()
-    expr.Expr = prsExpr(tokens)
+    expr.Expr = state.prsExpr(tokens)
 
     expr.ParenRPos = tokens.Next().Pos
 
     if tokens.Cur().Type != token.ParenR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \")\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \")\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return &expr
 }
 
-func prsUnaryExpr(tokens *token.Tokens) *ast.Unary {
+func (state *State) prsUnaryExpr(tokens *token.Tokens) *ast.Unary {
     expr := ast.Unary{ Operator: tokens.Cur() }
 
     switch expr.Operator.Type {
     case token.Mul:
         tokens.Next()
         if tokens.Cur().Type == token.ParenL {
-            expr.Operand = prsParenExpr(tokens)
+            expr.Operand = state.prsParenExpr(tokens)
         } else if tokens.Cur().Type == token.Mul {
-            expr.Operand = prsUnaryExpr(tokens)
+            expr.Operand = state.prsUnaryExpr(tokens)
         } else {
-            expr.Operand = prsIdentExpr(tokens)
+            expr.Operand = state.prsDefinedIdent(tokens)
         }
     case token.Amp:
         tokens.Next()
-        expr.Operand = prsIdentExpr(tokens)
+        expr.Operand = state.prsDefinedIdent(tokens)
         // TODO: in work
         if tokens.Peek().Type == token.Dot {
-            expr.Operand = prsDotExpr(tokens, expr.Operand, nil)
+            expr.Operand = state.prsDotExpr(tokens, expr.Operand, nil)
             for tokens.Peek().Type == token.Dot {
-                expr.Operand = prsDotExpr(tokens, expr.Operand, nil)
+                expr.Operand = state.prsDotExpr(tokens, expr.Operand, nil)
             }
         }
     case token.BitNot:
         tokens.Next()
-        expr.Operand = prsExpr(tokens)
+        expr.Operand = state.prsExpr(tokens)
     default:
         switch tokens.Next().Type {
         case token.Name:
-            expr.Operand = prsIdentExpr(tokens)
+            expr.Operand = state.prsDefinedIdent(tokens)
         case token.ParenL:
-            expr.Operand = prsParenExpr(tokens)
+            expr.Operand = state.prsParenExpr(tokens)
         default:
-            expr.Operand = prsBasicLit(tokens)
+            expr.Operand = state.prsBasicLit(tokens)
         }
     }
 
-    expr.Type = getTypeUnary(&expr)
+    expr.Type = state.getTypeUnary(&expr)
     return &expr
 }
 
-func prsCaseCond(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) (conds ast.Expr, colonPos token.Pos) {
+func (state *State) prsCaseCond(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) (conds ast.Expr, colonPos token.Pos) {
     if tokens.Cur().Type == token.Colon {
         if tokens.Last().Pos.Line == tokens.Cur().Pos.Line {
-            fmt.Fprintln(os.Stderr, "[ERROR] missing case body for this case")
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Last2().Pos.At())
+            state.diag.Error("missing case body for this case")
+            state.diag.At(tokens.Last2().Pos.At())
         } else {
-            fmt.Fprintln(os.Stderr, "[ERROR] invalid case condition: nothing before \":\"")
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
+            state.diag.Error("invalid case condition: nothing before \":\"")
+            state.diag.At(tokens.Cur().At())
         }
-        os.Exit(1)
+        state.diag.Exit()
     }
     if tokens.Cur().Type == token.Comma {
-        fmt.Fprintln(os.Stderr, "[ERROR] invalid case condition: nothing before \",\"")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("invalid case condition: nothing before \",\"")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
     if tokens.Last().Pos.Line == tokens.Cur().Pos.Line && tokens.Last().Type != token.SemiCol && tokens.Last().Type != token.BraceL {
-        fmt.Fprintln(os.Stderr, "[ERROR] cases should always start in a new line or after a \";\"")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("cases should always start in a new line or after a \";\"")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
-    cond := prsExpr(tokens)
-    conds = completeCond(placeholder, condBase, cond, conds)
+    cond := state.prsExpr(tokens)
+    conds = state.completeCond(placeholder, condBase, cond, conds)
 
     for tokens.Next().Type == token.Comma {
         if tokens.Peek().Type == token.Colon || tokens.Peek().Type == token.Comma {
-            fmt.Fprintln(os.Stderr, "[ERROR] invalid case condition: no expr after \",\"")
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Error("invalid case condition: no expr after \",\"")
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
 
         tokens.Next()
-        cond = prsExpr(tokens)
-        conds = completeCond(placeholder, condBase, cond, conds)
+        cond = state.prsExpr(tokens)
+        conds = state.completeCond(placeholder, condBase, cond, conds)
     }
 
     if tokens.Cur().Type != token.Colon {
-        fmt.Fprintln(os.Stderr, "[ERROR] missing \":\" at the end of case condition")
-        fmt.Fprintln(os.Stderr, "\t" + conds.End())
-        os.Exit(1)
+        state.diag.Error("missing \":\" at the end of case condition")
+        state.diag.At(cond.End())
+        state.diag.Exit()
     }
     colonPos = tokens.Cur().Pos
 
     return
 }
 
-func prsXCaseUnwrap(tokens *token.Tokens, condBase ast.Expr) ast.XCase {
-    cond, colonPos := prsUnwrapCaseCond(tokens, condBase)
+func (state *State) prsXCaseUnwrap(tokens *token.Tokens, condBase ast.Expr) ast.XCase {
+    cond, colonPos := state.prsUnwrapCaseCond(tokens, condBase)
 
     tokens.Next()
-    expr := prsExpr(tokens)
+    expr := state.prsExpr(tokens)
 
     if colonPos.Line == tokens.Peek().Pos.Line && tokens.Peek().Type != token.SemiCol && tokens.Peek().Type != token.BraceR {
-        fmt.Fprintln(os.Stderr, "[ERROR] multiple cases in a line should be separated with a \";\"")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Peek().At())
-        os.Exit(1)
+        state.diag.Error("multiple cases in a line should be separated with a \";\"")
+        state.diag.At(tokens.Peek().At())
+        state.diag.Exit()
     }
 
     if tokens.Peek().Type == token.SemiCol { tokens.Next() }
@@ -972,16 +1037,16 @@ func prsXCaseUnwrap(tokens *token.Tokens, condBase ast.Expr) ast.XCase {
     return ast.XCase{ Cond: cond, ColonPos: colonPos, Expr: expr }
 }
 
-func prsXCase(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) ast.XCase {
-    cond, colonPos := prsCaseCond(tokens, condBase, placeholder)
+func (state *State) prsXCase(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) ast.XCase {
+    cond, colonPos := state.prsCaseCond(tokens, condBase, placeholder)
 
     tokens.Next()
-    expr := prsExpr(tokens)
+    expr := state.prsExpr(tokens)
 
     if colonPos.Line == tokens.Peek().Pos.Line && tokens.Peek().Type != token.SemiCol && tokens.Peek().Type != token.BraceR {
-        fmt.Fprintln(os.Stderr, "[ERROR] multiple cases in a line should be separated with a \";\"")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Peek().At())
-        os.Exit(1)
+        state.diag.Error("multiple cases in a line should be separated with a \";\"")
+        state.diag.At(tokens.Peek().At())
+        state.diag.Exit()
     }
 
     if tokens.Peek().Type == token.SemiCol { tokens.Next() }
@@ -989,63 +1054,72 @@ func prsXCase(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) as
     return ast.XCase{ Cond: cond, ColonPos: colonPos, Expr: expr }
 }
 
-func prsXCases(tokens *token.Tokens, condBase ast.Expr) (cases []ast.XCase) {
+func (state *State) prsXCases(tokens *token.Tokens, condBase ast.Expr) (cases []ast.XCase) {
     if tokens.Cur().Type != token.BraceL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"{\" at the end of conditon for the xswitch (got \"%s\")\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"{\" at the end of conditon for the xswitch (got \"%s\")", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     if _,ok := condBase.(*ast.Unwrap); ok { 
         for tokens.Next().Type != token.BraceR {
-            cases = append(cases, prsXCaseUnwrap(tokens, condBase))
+            cases = append(cases, state.prsXCaseUnwrap(tokens, condBase))
         }
     } else {
-        placeholder := getPlaceholder(condBase)
+        placeholder := state.getPlaceholder(condBase)
         for tokens.Next().Type != token.BraceR {
-            cases = append(cases, prsXCase(tokens, condBase, placeholder))
+            cases = append(cases, state.prsXCase(tokens, condBase, placeholder))
         }
     }
 
     if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"}\" at the end of the switch (got \"%s\")\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"}\" at the end of the switch (got \"%s\")", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return
 }
 
-func prsXSwitch(tokens *token.Tokens) *ast.XSwitch {
+func (state *State) prsXSwitch(tokens *token.Tokens) *ast.XSwitch {
     switchExpr := ast.XSwitch{ Pos: tokens.Cur().Pos }
 
     var condBase ast.Expr = nil
     if tokens.Next().Type != token.BraceL {
-        condBase = prsExpr(tokens)
+        condBase = state.prsCondBase(tokens)
     }
 
     if tokens.Peek().Type == token.BraceR {
-        fmt.Fprintln(os.Stderr, "[ERROR] empty switch")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("empty switch")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     if tokens.Peek().Type == token.Colon {
-        condBase = prsUnwrapHead(tokens, condBase)
+        condBase = state.prsUnwrapHead(tokens, condBase)
         tokens.Next()
     }
 
-    identObj.StartScope()
+    state.identObj.StartScope()
     switchExpr.BraceLPos = tokens.Cur().Pos
-    switchExpr.Cases = prsXCases(tokens, condBase)
+    switchExpr.Cases = state.prsXCases(tokens, condBase)
     switchExpr.BraceRPos = tokens.Cur().Pos
-    identObj.EndScope()
+    state.identObj.EndScope()
 
     switchExpr.Type = switchExpr.Cases[0].GetType()
     return &switchExpr
 }
 
-func prsBinary(tokens *token.Tokens, expr ast.Expr, min_precedence precedence) ast.Expr {
+// only the condBase of a switch can end with an operator (x == { ... })
+func (state *State) prsCondBase(tokens *token.Tokens) ast.Expr {
+    prev := state.condBase
+    state.condBase = true
+    defer func() { state.condBase = prev }()
+
+    return state.prsExpr(tokens)
+}
+
+func (state *State) prsBinary(tokens *token.Tokens, expr ast.Expr, min_precedence precedence) ast.Expr {
     for isBinaryExpr(tokens) && getPrecedence(tokens) >= min_precedence {
         var b ast.Binary
         b.OperandL = expr
@@ -1057,12 +1131,18 @@ func prsBinary(tokens *token.Tokens, expr ast.Expr, min_precedence precedence) a
 
         // switch/xswitch
         if tokens.Cur().Type == token.BraceL {
+            if !state.condBase {
+                state.diag.Errorf("expected an expression after \"%s\" but got \"{\"", b.Operator.Str)
+                state.diag.At(tokens.Cur().At())
+                state.diag.Exit()
+            }
+
             b.Type = types.BoolType{}
             return &b
         }
 
-        b.OperandR = prsExprWithPrecedence(tokens, precedence+1)
-        b.Type = getTypeBinary(&b)
+        b.OperandR = state.prsExprWithPrecedence(tokens, precedence+1)
+        b.Type = state.getTypeBinary(&b)
 
         expr = &b
     }
@@ -1070,21 +1150,21 @@ func prsBinary(tokens *token.Tokens, expr ast.Expr, min_precedence precedence) a
     return expr
 }
 
-func prsInsetType(tokens *token.Tokens) types.Type {
+func (state *State) prsInsetType(tokens *token.Tokens) types.Type {
     if tokens.Cur().Type == token.DefConst {
         if tokens.Next().Type != token.Lss {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected \"<\" but got %v\n", tokens.Cur())
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Errorf("expected \"<\" but got %v", tokens.Cur())
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
 
         tokens.Next()
-        typ := prsType(tokens)
+        typ := state.prsType(tokens)
 
         if tokens.Next().Type != token.Grt {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected \">\" but got %v\n", tokens.Cur())
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Errorf("expected \">\" but got %v", tokens.Cur())
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
 
         return typ
@@ -1093,20 +1173,23 @@ func prsInsetType(tokens *token.Tokens) types.Type {
     return nil
 }
 
-func inferInsetType(f *identObj.Func, pos token.Pos, args []ast.Expr) (insetType types.Type) {
+// all generic args have to be of the same type
+// untyped literals (larger(a, 250)) take the type of the other args
+func (state *State) inferInsetType(f *identObj.Func, pos token.Pos, args []ast.Expr) (insetType types.Type) {
     for i,a := range f.GetArgs() {
         if types.IsGeneric(a) {
             t := types.SolveGeneric(a, args[i].GetType())
 
             if insetType != nil {
-                if !types.Equal(insetType, t) || insetType.GetKind() != types.Uint || insetType.GetKind() != types.Int {
-                    fmt.Fprintf(os.Stderr, "[ERROR] cannot infer inset type for %s (conflicting types %s and %s)\n", f.GetName(), insetType, t)
-                    fmt.Fprintln(os.Stderr, "\t" + pos.At())
-                    os.Exit(1)
+                // untyped literals take the type of the other args
+                if types.IsResolvable(t) {
+                    continue
                 }
 
-                if t.Size() > insetType.Size() {
-                    insetType = t
+                if !types.IsResolvable(insetType) && !types.Equal(insetType, t) {
+                    state.diag.Errorf("cannot infer inset type for %s (conflicting types %s and %s)", f.GetName(), insetType, t)
+                    state.diag.At(pos.At())
+                    state.diag.Exit()
                 }
             }
 
@@ -1115,9 +1198,9 @@ func inferInsetType(f *identObj.Func, pos token.Pos, args []ast.Expr) (insetType
     }
 
     if insetType == nil {
-        fmt.Fprintf(os.Stderr, "[ERROR] cannot infer inset type of generic function %s\n", f.GetName())
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+        state.diag.Errorf("cannot infer inset type of generic function %s", f.GetName())
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
     return insetType
@@ -1131,47 +1214,51 @@ func resolveFnSrc(src types.Type, fnName token.Token, args []ast.Expr) types.Typ
     return src
 }
 
-func resolveGeneric(f *identObj.Func, pos token.Pos, insetType *types.Type, args []ast.Expr) *identObj.Func {
+func (state *State) resolveGeneric(f *identObj.Func, pos token.Pos, insetType *types.Type, args []ast.Expr) *identObj.Func {
     if f.IsGeneric() {
         if *insetType == nil {
-            *insetType = inferInsetType(f, pos, args)
+            *insetType = state.inferInsetType(f, pos, args)
         }
 
         return f.ResolveGeneric(*insetType)
     } else if *insetType != nil {
-        fmt.Fprintf(os.Stderr, "[ERROR] function %s is not generic\n", f.GetName())
-        fmt.Fprintln(os.Stderr, "\t" + pos.At())
-        os.Exit(1)
+        state.diag.Errorf("function %s is not generic", f.GetName())
+        state.diag.At(pos.At())
+        state.diag.Exit()
     }
 
     return f
 }
 
-func prsCallFromFnSrc(tokens *token.Tokens, fnSrc types.Type, fnSrcPos token.Pos, insetType types.Type) *ast.FnCall {
+func (state *State) prsCallFromFnSrc(tokens *token.Tokens, fnSrc types.Type, fnSrcPos token.Pos, insetType types.Type) *ast.FnCall {
     if tokens.Cur().Type != token.Dot {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \".\" but got %s\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \".\" but got %s", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     fnName := tokens.Next()
 
     posL := tokens.Next().Pos
-    vals := prsPassArgs(tokens)
+    vals := state.prsPassArgs(tokens)
     posR := tokens.Cur().Pos
 
     fnSrc = resolveFnSrc(fnSrc, fnName, vals)
 
-    f := identObj.GetFnFromFnSrc(fnSrc, fnName.Str)
+    f := state.identObj.GetFnFromFnSrc(fnSrc, fnName.Str)
     if f == nil {
-        fmt.Fprintf(os.Stderr, "[ERROR] %s does not implement function %s\n", fnSrc, fnName.Str)
-        fmt.Fprintln(os.Stderr, "\t" + fnName.At())
-        os.Exit(1)
+        state.diag.Errorf("%s does not implement function %s", fnSrc, fnName.Str)
+        state.diag.Suggest(fnName.Str, state.identObj.FuncNames(fnSrc))
+        state.diag.At(fnName.At())
+        if interfaceType,ok := fnSrc.(types.InterfaceType); ok {
+            state.identObj.NoteInterfaceDecl(interfaceType.Name)
+        }
+        state.diag.Exit()
     }
 
-    f = resolveGeneric(f, fnName.Pos, &insetType, vals)
+    f = state.resolveGeneric(f, fnName.Pos, &insetType, vals)
 
-    resvSpace := identObj.ReserveSpace(f.GetRetType())
+    resvSpace := state.identObj.ReserveSpace(f.GetRetType())
     ident := ast.Ident{ Name: fnName.Str, Pos: fnName.Pos, Obj: f }
 
     return &ast.FnCall{ 
@@ -1186,34 +1273,56 @@ func prsCallFromFnSrc(tokens *token.Tokens, fnSrc types.Type, fnSrcPos token.Pos
     }
 }
 
-func prsCallFn(tokens *token.Tokens, ident *ast.Ident, insetType types.Type) *ast.FnCall {
+func (state *State) prsCallFn(tokens *token.Tokens, ident *ast.Ident, insetType types.Type) *ast.FnCall {
     posL := tokens.Cur().Pos
-    vals := prsPassArgs(tokens)
+    vals := state.prsPassArgs(tokens)
     posR := tokens.Cur().Pos
 
     if ident.Obj == nil {
-        f := identObj.CreateUnresolvedFunc(ident.Name)
+        f := state.identObj.CreateUnresolvedFunc(ident.Name)
         return &ast.FnCall{ Ident: *ident, F: &f, Values: vals, ParenLPos: posL, ParenRPos: posR }
     }
 
     f,ok := ident.Obj.(*identObj.Func)
     if !ok {
-        fmt.Fprintf(os.Stderr, "[ERROR] you can only call a function (%s is not a function)\n", ident.Name)
-        fmt.Fprintln(os.Stderr, "\t" + ident.At())
-        os.Exit(1)
+        state.diag.Errorf("you can only call a function (%s is not a function)", ident.Name)
+        state.diag.At(ident.At())
+        state.diag.Exit()
     }
 
-    f = resolveGeneric(f, ident.Pos, &insetType, vals)
+    if f.GetName() == "assert" {
+        return state.prsAssert(ident, vals, posL, posR)
+    }
+
+    f = state.resolveGeneric(f, ident.Pos, &insetType, vals)
 
-    resvSpace := identObj.ReserveSpace(f.GetRetType())
+    resvSpace := state.identObj.ReserveSpace(f.GetRetType())
     return &ast.FnCall{ Ident: *ident, F: f, ResvSpace: resvSpace, InsetType: insetType, Values: vals, ParenLPos: posL, ParenRPos: posR }
 }
 
-func prsPassArgs(tokens *token.Tokens) []ast.Expr {
+// assert(cond, msg) -> _assert(cond, msg, "file:line:col")
+func (state *State) prsAssert(ident *ast.Ident, vals []ast.Expr, posL token.Pos, posR token.Pos) *ast.FnCall {
+    if len(vals) != 2 {
+        state.diag.Errorf("expected 2 args for assert (cond bool, msg str) but got %d", len(vals))
+        state.diag.At(ident.At())
+        state.diag.Exit()
+    }
+
+    pos := token.Token{ Type: token.Str, Str: fmt.Sprintf("\"%s:%d:%d\"", ident.Pos.File, ident.Pos.Line, ident.Pos.Col), Pos: ident.Pos }
+    vals = append(vals, &ast.StrLit{ Idx: uint64(state.str.Add(pos)), Val: pos })
+
+    f := state.identObj.Get("_assert").(*identObj.Func)
+    assert := ast.Ident{ Name: "_assert", Pos: ident.Pos, Obj: f }
+
+    resvSpace := state.identObj.ReserveSpace(f.GetRetType())
+    return &ast.FnCall{ Ident: assert, F: f, ResvSpace: resvSpace, Values: vals, ParenLPos: posL, ParenRPos: posR }
+}
+
+func (state *State) prsPassArgs(tokens *token.Tokens) []ast.Expr {
     if tokens.Cur().Type != token.ParenL {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"(\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"(\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     var values []ast.Expr
@@ -1222,26 +1331,26 @@ func prsPassArgs(tokens *token.Tokens) []ast.Expr {
         return values
     }
 
-    values = append(values, prsExpr(tokens))
+    values = append(values, state.prsExpr(tokens))
     for tokens.Next().Type == token.Comma {
         tokens.Next()
-        values = append(values, prsExpr(tokens))
+        values = append(values, state.prsExpr(tokens))
     }
 
     if tokens.Cur().Type != token.ParenR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \")\" but got %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \")\" but got %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return values
 }
 
-func prsCast(tokens *token.Tokens, e ast.Expr) *ast.Cast {
+func (state *State) prsCast(tokens *token.Tokens, e ast.Expr) *ast.Cast {
     c := ast.Cast{ Expr: e, AsPos: tokens.Cur().Pos }
 
     tokens.Next()
-    c.DestType = prsType(tokens)
+    c.DestType = state.prsType(tokens)
 
     return &c
 }
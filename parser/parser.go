@@ -1,47 +1,124 @@
 package prs
 
 import (
-    "os"
     "fmt"
+    "strings"
     "gamma/ast"
+    "gamma/ast/identObj"
     "gamma/token"
     "gamma/import"
     "gamma/buildin"
+    "gamma/diag"
+    "gamma/cmpTime"
+    "gamma/types"
+    "gamma/types/array"
+    "gamma/types/str"
 )
 
-var isMainDefined bool = false
-var noMainArg bool = true
+// parser state of one compilation (see gamma/compiler)
+type State struct {
+    isMainDefined bool
+    noMainArg bool
+    testMode bool       // main is not required
+    mainPath string
+    testFns uint        // test blocks parsed (in every file)
+    tests []test        // test blocks of the main file
+    condBase bool       // a binary expr can end before "{" (x == { 1: ... })
 
-func Parse(path string) (ast ast.Ast) {
-    fmt.Println("[INFO] parsing...")
+    identObj *identObj.State
+    buildin *buildin.State
+    cmpTime *cmpTime.State
+    diag *diag.State
+    imprt *imprt.State
+    token *token.State
+    types *types.State
+    array *array.State
+    str *str.State
+}
+
+type test struct {
+    name token.Token    // string literal
+    fn string           // test block as function
+}
+
+func NewState(identObj *identObj.State, buildin *buildin.State, cmpTime *cmpTime.State, diag *diag.State, imprt *imprt.State, token *token.State, types *types.State, array *array.State, str *str.State) *State {
+    return &State{ noMainArg: true, identObj: identObj, buildin: buildin, cmpTime: cmpTime, diag: diag, imprt: imprt, token: token, types: types, array: array, str: str }
+}
+
+func (state *State) Parse(path string) (ast ast.Ast) {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] parsing...")
 
-    parseBuildin(&ast)
-    parseMain(path, &ast)
+    state.parseBuildin(&ast)
+    state.parseMain(path, &ast)
 
     return
 }
 
-func parseBuildin(ast *ast.Ast) {
-    buildin.Declare()
+func (state *State) parseBuildin(ast *ast.Ast) {
+    state.buildin.Declare()
+
+    state.identObj.AllowReserved(true)
+    defer state.identObj.AllowReserved(false)
+
+    tokens := state.imprt.ImportBuildin()
+    for tokens.Peek().Type != token.EOF {
+        ast.Decls = append(ast.Decls, state.prsDecl(&tokens))
+    }
+}
+
+// the test blocks of the main file are called by a generated test runner (instead of main)
+func (state *State) ParseTests(path string) (ast ast.Ast) {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] parsing...")
+
+    state.testMode = true
+    state.parseBuildin(&ast)
+    state.parseMain(path, &ast)
 
-    tokens := imprt.ImportBuildin()
+    state.identObj.AllowReserved(true)
+    tokens := state.token.Tokenize("<test runner>", strings.NewReader(state.testRunner()))
     for tokens.Peek().Type != token.EOF {
-        ast.Decls = append(ast.Decls, prsDecl(&tokens))
+        tokens.SetLastImport()
+        ast.Decls = append(ast.Decls, state.prsDecl(&tokens))
     }
+    state.identObj.AllowReserved(false)
+
+    ast.Tests = true
+    ast.NoMainArg = true
+
+    return
+}
+
+// every test runs in a child process (a failed assert or a crash only ends its test)
+func (state *State) testRunner() string {
+    var runner strings.Builder
+
+    runner.WriteString("import \"testing.gma\"\n\n")
+    runner.WriteString("fn _test_main() {\n")
+    runner.WriteString("    mut passed := 0\n")
+    runner.WriteString("    mut failed := 0\n")
+    for _,t := range state.tests {
+        runner.WriteString(fmt.Sprintf("    if fork() == 0 { %s() exit(0) }\n", t.fn))
+        runner.WriteString(fmt.Sprintf("    if test_wait(%s) { passed = passed + 1 } else { failed = failed + 1 }\n", t.name.Str))
+    }
+    runner.WriteString("    test_summary(passed, failed)\n")
+    runner.WriteString("}\n")
+
+    return runner.String()
 }
 
-func parseMain(path string, ast *ast.Ast) {
-    tokens := imprt.ImportMain(path)
+func (state *State) parseMain(path string, ast *ast.Ast) {
+    tokens := state.imprt.ImportMain(path)
+    state.mainPath = tokens.GetPath()
 
     for tokens.Peek().Type != token.EOF {
         tokens.SetLastImport()
-        ast.Decls = append(ast.Decls, prsDecl(&tokens))
+        ast.Decls = append(ast.Decls, state.prsDecl(&tokens))
     }
 
-    if !isMainDefined {
-        fmt.Fprintln(os.Stderr, "[ERROR] no \"main\" function was defined")
-        os.Exit(1)
+    if !state.isMainDefined && !state.testMode {
+        state.diag.Error("no \"main\" function was defined")
+        state.diag.Exit()
     }
 
-    ast.NoMainArg = noMainArg
+    ast.NoMainArg = state.noMainArg
 }
@@ -1,25 +1,22 @@
 package prs
 
 import (
-    "os"
-    "fmt"
     "gamma/token"
     "gamma/types"
     "gamma/ast"
-    "gamma/ast/identObj"
 )
 
-func prsStmt(tokens *token.Tokens) ast.Stmt {
+func (state *State) prsStmt(tokens *token.Tokens) ast.Stmt {
     switch t := tokens.Next(); t.Type {
     case token.BraceL:
-        b := prsBlock(tokens)
+        b := state.prsBlock(tokens)
         return &b
 
     case token.If:
-        ifStmt := prsIfStmt(tokens)
+        ifStmt := state.prsIfStmt(tokens)
 
         if tokens.Cur().Type == token.BraceL {
-            switchStmt := prsSwitch(tokens, ifStmt.Pos, ifStmt.Cond)
+            switchStmt := state.prsSwitch(tokens, ifStmt.Pos, ifStmt.Cond)
             return &switchStmt
         }
 
@@ -30,11 +27,11 @@ func prsStmt(tokens *token.Tokens) ast.Stmt {
         return &t
 
     case token.While:
-        w := prsWhileStmt(tokens)
+        w := state.prsWhileStmt(tokens)
         return &w
 
     case token.For:
-        f := prsForStmt(tokens)
+        f := state.prsForStmt(tokens)
         return &f
 
     case token.Break:
@@ -46,111 +43,120 @@ func prsStmt(tokens *token.Tokens) ast.Stmt {
         return &c
 
     case token.Ret:
-        r := prsRet(tokens)
+        r := state.prsRet(tokens)
         return &r
 
     case token.Number, token.Str, token.Char, token.Boolean, token.ParenL:
-        return &ast.ExprStmt{ Expr: prsExpr(tokens) }
+        return &ast.ExprStmt{ Expr: state.prsExpr(tokens) }
 
     case token.UndScr:
-        return &ast.DeclStmt{ Decl: prsDefine(tokens) }
+        return &ast.DeclStmt{ Decl: state.prsDefine(tokens) }
 
     case token.Name:
-        if isDec(tokens) || isDefInfer(tokens) {
-            return &ast.DeclStmt{ Decl: prsDefine(tokens) }
+        if isMut(tokens) {
+            return &ast.DeclStmt{ Decl: state.prsMutDefine(tokens) }
+        }
+        if state.isDec(tokens) || isDefInfer(tokens) {
+            return &ast.DeclStmt{ Decl: state.prsDefine(tokens) }
         }
         fallthrough
 
     case token.XSwitch, token.Plus, token.Minus, token.Mul, token.Amp, token.Self:
-        e := prsExpr(tokens)
+        e := state.prsExpr(tokens)
 
         switch tokens.Peek().Type {
         case token.Assign:
-            a := prsAssignVar(tokens, e)
+            a := state.prsAssignVar(tokens, e)
             return &a
 
         case token.PlusEq, token.MinusEq, token.MulEq, token.DivEq, token.ModEq, token.ShlEq,
             token.ShrEq, token.BitAndEq, token.BitOrEq, token.XorEq:
-            return prsBinOpAssign(tokens, e)
+            return state.prsBinOpAssign(tokens, e)
 
         default:
             return &ast.ExprStmt{ Expr: e }
         }
 
     case token.Typename:
-        return &ast.ExprStmt{ Expr: prsExpr(tokens) }
+        return &ast.ExprStmt{ Expr: state.prsExpr(tokens) }
 
     case token.PlusEq, token.MinusEq, token.MulEq, token.DivEq, token.ModEq, token.ShlEq, token.ShrEq, token.BitAndEq, token.BitOrEq, token.XorEq:
-        fmt.Fprintf(os.Stderr, "[ERROR] no destination for %s\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("no destination for %s", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadStmt{}
 
     case token.Elif:
-        fmt.Fprintf(os.Stderr, "[ERROR] missing if (elif without an if before)\n")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("missing if (elif without an if before)")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadStmt{}
 
     case token.Else:
-        fmt.Fprintf(os.Stderr, "[ERROR] missing if (else without an if before)\n")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("missing if (else without an if before)")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadStmt{}
 
     case token.Assign:
-        fmt.Fprintf(os.Stderr, "[ERROR] no destination for assignment\n")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("no destination for assignment")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadStmt{}
 
     case token.Fn:
-        fmt.Fprintln(os.Stderr, "[ERROR] you are not allowed to define functions inside a function")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("you are not allowed to define functions inside a function")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadStmt{}
 
     case token.Import:
-        fmt.Fprintln(os.Stderr, "[ERROR] importing is only allowed at the beginning of a file")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("importing is only allowed at the beginning of a file")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadStmt{}
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unexpected token %v\n", tokens.Cur())
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("unexpected token %v", tokens.Cur())
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
         return &ast.BadStmt{}
     }
 }
 
-func prsBlock(tokens *token.Tokens) ast.Block {
-    identObj.StartScope()
+func (state *State) prsBlock(tokens *token.Tokens) ast.Block {
+    state.identObj.StartScope()
 
     block := ast.Block{ BraceLPos: tokens.Cur().Pos }
 
     for tokens.Peek().Type != token.BraceR {
-        block.Stmts = append(block.Stmts, prsStmt(tokens))
+        block.Stmts = append(block.Stmts, state.prsStmt(tokens))
     }
 
     block.BraceRPos = tokens.Next().Pos
 
-    identObj.EndScope()
+    state.identObj.EndScope()
     return block
 }
 
-func prsAssignVar(tokens *token.Tokens, dest ast.Expr) ast.Assign {
+func (state *State) prsAssignVar(tokens *token.Tokens, dest ast.Expr) ast.Assign {
     pos := tokens.Next().Pos
     tokens.Next()
-    val := prsExpr(tokens)
+    val := state.prsExpr(tokens)
 
     return ast.Assign{ Pos: pos, Dest: dest, Value: val }
 }
 
-func prsBinOpAssign(tokens *token.Tokens, dest ast.Expr) ast.Stmt {
+func (state *State) prsBinOpAssign(tokens *token.Tokens, dest ast.Expr) ast.Stmt {
     binOpAssign := tokens.Next()
     binOpStr := binOpAssign.Str[0:len(binOpAssign.Str)-1]
-    binOp := token.Token{ Pos: binOpAssign.Pos, Str: binOpStr, Type: token.ToTokenType(binOpStr, binOpAssign.Pos) }
+    binOp := token.Token{ Pos: binOpAssign.Pos, Str: binOpStr, Type: state.token.ToTokenType(binOpStr, binOpAssign.Pos) }
+
+    if dest.GetType() == nil {
+        state.diag.Error("left operand has no type")
+        state.diag.At(dest.At())
+        state.diag.Exit()
+    }
 
     tokens.Next()
     val := &ast.Binary{ 
@@ -158,15 +164,15 @@ func prsBinOpAssign(tokens *token.Tokens, dest ast.Expr) ast.Stmt {
         Type: dest.GetType(),
         OperandL: dest,
         Operator: binOp,
-        OperandR: prsExpr(tokens),
+        OperandR: state.prsExpr(tokens),
     }
 
     return &ast.Assign{ Pos: binOp.Pos, Dest: dest, Value: val }
 }
 
-func prsIfStmt(tokens *token.Tokens) ast.If {
-    identObj.StartScope()
-    defer identObj.EndScope()
+func (state *State) prsIfStmt(tokens *token.Tokens) ast.If {
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     pos := tokens.Cur().Pos
 
@@ -175,11 +181,11 @@ func prsIfStmt(tokens *token.Tokens) ast.If {
         return ast.If{ Pos: pos }
     }
 
-    cond := prsExpr(tokens)
+    cond := state.prsCondBase(tokens)
 
     // unwrap condition
     if tokens.Peek().Type == token.Colon {
-        cond = prsUnwrap(tokens, cond)
+        cond = state.prsUnwrap(tokens, cond)
     }
 
     // cond-switch with condBase
@@ -189,61 +195,62 @@ func prsIfStmt(tokens *token.Tokens) ast.If {
 
     // normal if
     tokens.Next()
-    block := prsBlock(tokens)
+    block := state.prsBlock(tokens)
 
     ifStmt := ast.If{ Pos: pos, Cond: cond, Block: block }
 
     if tokens.Peek().Type == token.Else {
         tokens.Next()
-        elseStmt := prsElse(tokens)
+        elseStmt := state.prsElse(tokens)
         ifStmt.Else = &elseStmt
     } else if tokens.Peek().Type == token.Elif {
         tokens.Next()
-        elifStmt := prsElif(tokens)
+        elifStmt := state.prsElif(tokens)
         ifStmt.Elif = &elifStmt
     }
 
     return ifStmt
 }
 
-func prsElif(tokens *token.Tokens) ast.Elif {
-    return ast.Elif(prsIfStmt(tokens))
+func (state *State) prsElif(tokens *token.Tokens) ast.Elif {
+    return ast.Elif(state.prsIfStmt(tokens))
 }
 
-func prsElse(tokens *token.Tokens) ast.Else {
-    identObj.StartScope()
-    defer identObj.EndScope()
+func (state *State) prsElse(tokens *token.Tokens) ast.Else {
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     pos := tokens.Cur().Pos
     tokens.Next()
-    block := prsBlock(tokens)
+    block := state.prsBlock(tokens)
 
     return ast.Else{ ElsePos: pos, Block: block }
 }
 
-func prsWhileStmt(tokens *token.Tokens) ast.While {
-    identObj.StartScope()
-    defer identObj.EndScope()
+func (state *State) prsWhileStmt(tokens *token.Tokens) ast.While {
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     var op ast.While = ast.While{ WhilePos: tokens.Cur().Pos, Def: nil }
 
     tokens.Next()
-    if isDec(tokens) {
-        dec := prsDecVar(tokens)
+    if mut := prsMut(tokens); mut || state.isDec(tokens) {
+        dec := state.prsDecVar(tokens)
+        setMut(dec.V, mut)
         op.Def = &ast.DefVar{ V: dec.V, Type: dec.Type }
 
         if tokens.Next().Type != token.Comma {
-            fmt.Fprintln(os.Stderr, "[ERROR] missing \",\"")
-            fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-            os.Exit(1)
+            state.diag.Error("missing \",\"")
+            state.diag.At(tokens.Cur().At())
+            state.diag.Exit()
         }
 
         tokens.Next()
-        expr := prsExpr(tokens)
+        expr := state.prsExpr(tokens)
 
         if tokens.Next().Type == token.Comma {
             tokens.Next()
-            op.Cond = prsExpr(tokens)
+            op.Cond = state.prsExpr(tokens)
             op.Def.Value = expr
             tokens.Next()
         } else {
@@ -251,36 +258,38 @@ func prsWhileStmt(tokens *token.Tokens) ast.While {
             op.Cond = expr
         }
     } else {
-        op.Cond = prsExpr(tokens)
+        op.Cond = state.prsExpr(tokens)
         tokens.Next()
     }
 
-    op.Block = prsBlock(tokens)
+    op.Block = state.prsBlock(tokens)
 
     return op
 }
 
-func prsForStmt(tokens *token.Tokens) ast.For {
-    identObj.StartScope()
-    defer identObj.EndScope()
+func (state *State) prsForStmt(tokens *token.Tokens) ast.For {
+    state.identObj.StartScope()
+    defer state.identObj.EndScope()
 
     var op ast.For = ast.For{ ForPos: tokens.Cur().Pos, Limit: nil }
 
     tokens.Next()
-    dec := prsDecVar(tokens)
+    mut := prsMut(tokens)
+    dec := state.prsDecVar(tokens)
+    setMut(dec.V, mut)
     op.Def = ast.DefVar{ V: dec.V, Type: dec.Type }
 
     if tokens.Next().Type == token.Comma {
         tokens.Next()
-        op.Limit = prsExpr(tokens)
+        op.Limit = state.prsExpr(tokens)
 
         if tokens.Next().Type == token.Comma {
             tokens.Next()
-            op.Def.Value = prsExpr(tokens)
+            op.Def.Value = state.prsExpr(tokens)
 
             if tokens.Next().Type == token.Comma {
                 tokens.Next()
-                op.Step = prsExpr(tokens)
+                op.Step = state.prsExpr(tokens)
                 tokens.Next()
             }
         }
@@ -309,7 +318,7 @@ func prsForStmt(tokens *token.Tokens) ast.For {
         }
     }
 
-    op.Block = prsBlock(tokens)
+    op.Block = state.prsBlock(tokens)
 
     return op
 }
@@ -322,27 +331,27 @@ func prsContinue(tokens *token.Tokens) ast.Continue {
     return ast.Continue{ Pos: tokens.Cur().Pos }
 }
 
-func prsRet(tokens *token.Tokens) ast.Ret {
-    r := ast.Ret{ Pos: tokens.Cur().Pos, F: identObj.GetCurFunc() }
+func (state *State) prsRet(tokens *token.Tokens) ast.Ret {
+    r := ast.Ret{ Pos: tokens.Cur().Pos, F: state.identObj.GetCurFunc() }
 
     if tokens.Peek().Pos.Line == r.Pos.Line && tokens.Peek().Type != token.BraceR {
         tokens.Next()
-        r.RetExpr = prsExpr(tokens)
+        r.RetExpr = state.prsExpr(tokens)
     }
 
     return r
 }
 
-func getPlaceholder(cond ast.Expr) (expr *ast.Expr) {
+func (state *State) getPlaceholder(cond ast.Expr) (expr *ast.Expr) {
     if cond == nil {
         return nil
     }
 
     for {
         if b, ok := cond.(*ast.Binary); !ok {
-            fmt.Fprintln(os.Stderr, "[ERROR] expected condition to be a BinaryExpr")
-            fmt.Fprintln(os.Stderr, "\t" + cond.At())
-            os.Exit(1)
+            state.diag.Error("expected condition to be a BinaryExpr")
+            state.diag.At(cond.At())
+            state.diag.Exit()
             return nil
         } else {
             if b.Operator.Type == token.Eql || b.Operator.Type == token.Neq ||
@@ -358,7 +367,7 @@ func getPlaceholder(cond ast.Expr) (expr *ast.Expr) {
 
 // replace placeholder in condBase with expr1
 // if expr2 is set they get combined with logical or
-func completeCond(placeholder *ast.Expr, condBase ast.Expr, expr1 ast.Expr, expr2 ast.Expr) ast.Expr {
+func (state *State) completeCond(placeholder *ast.Expr, condBase ast.Expr, expr1 ast.Expr, expr2 ast.Expr) ast.Expr {
     if ident, ok := expr1.(*ast.Ident); ok {
         if ident.Obj == nil && ident.Name == "_" {
             return nil
@@ -394,45 +403,45 @@ func completeCond(placeholder *ast.Expr, condBase ast.Expr, expr1 ast.Expr, expr
             return &condCopy
         }
     } else {
-        fmt.Fprintln(os.Stderr, "[ERROR] expected condition to be a BinaryExpr")
-        fmt.Fprintln(os.Stderr, "\t" + condBase.At())
-        os.Exit(1)
+        state.diag.Error("expected condition to be a BinaryExpr")
+        state.diag.At(condBase.At())
+        state.diag.Exit()
         return nil
     }
 }
 
-func copyUnwrap(unwrapExpr ast.Expr, newElemName token.Token) *ast.Unwrap {
+func (state *State) copyUnwrap(unwrapExpr ast.Expr, newElemName token.Token) *ast.Unwrap {
     if unwrap, ok := unwrapExpr.(*ast.Unwrap); ok {
         unwrapCopy := *unwrap
         unwrapCopy.ElemName = newElemName
         return &unwrapCopy
     } else {
-        fmt.Fprintln(os.Stderr, "[ERROR] (internal) expected condition to be an Unwrap")
-        fmt.Fprintln(os.Stderr, "\t" + unwrapExpr.At())
-        os.Exit(1)
+        state.diag.Error("(internal) expected condition to be an Unwrap")
+        state.diag.At(unwrapExpr.At())
+        state.diag.Exit()
         return nil
     }
 }
 
-func prsUnwrapCaseCond(tokens *token.Tokens, condBase ast.Expr) (cond ast.Expr, colonPos token.Pos) {
+func (state *State) prsUnwrapCaseCond(tokens *token.Tokens, condBase ast.Expr) (cond ast.Expr, colonPos token.Pos) {
     elemName := tokens.Cur()
     if elemName.Type != token.UndScr {
-        cond = prsUnwrapElem(tokens, copyUnwrap(condBase, elemName))
+        cond = state.prsUnwrapElem(tokens, state.copyUnwrap(condBase, elemName))
     }
     colonPos = tokens.Next().Pos
 
     return
 }
 
-func prsUnwrapCase(tokens *token.Tokens, condBase ast.Expr) ast.Case {
-    cond, colonPos := prsUnwrapCaseCond(tokens, condBase)
+func (state *State) prsUnwrapCase(tokens *token.Tokens, condBase ast.Expr) ast.Case {
+    cond, colonPos := state.prsUnwrapCaseCond(tokens, condBase)
 
-    stmt := prsStmt(tokens)
+    stmt := state.prsStmt(tokens)
 
     if colonPos.Line == tokens.Peek().Pos.Line && tokens.Peek().Type != token.SemiCol && tokens.Peek().Type != token.BraceR {
-        fmt.Fprintln(os.Stderr, "[ERROR] multiple cases in a line should be separated with a \";\"")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Peek().At())
-        os.Exit(1)
+        state.diag.Error("multiple cases in a line should be separated with a \";\"")
+        state.diag.At(tokens.Peek().At())
+        state.diag.Exit()
     }
 
     if tokens.Peek().Type == token.SemiCol { tokens.Next() }
@@ -440,15 +449,15 @@ func prsUnwrapCase(tokens *token.Tokens, condBase ast.Expr) ast.Case {
     return ast.Case{ Cond: cond, ColonPos: colonPos, Stmt: stmt }
 }
 
-func prsCase(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) ast.Case {
-    cond, colonPos := prsCaseCond(tokens, condBase, placeholder)
+func (state *State) prsCase(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) ast.Case {
+    cond, colonPos := state.prsCaseCond(tokens, condBase, placeholder)
 
-    stmt := prsStmt(tokens)
+    stmt := state.prsStmt(tokens)
 
     if colonPos.Line == tokens.Peek().Pos.Line && tokens.Peek().Type != token.SemiCol && tokens.Peek().Type != token.BraceR {
-        fmt.Fprintln(os.Stderr, "[ERROR] multiple cases in a line should be separated with a \";\"")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Peek().At())
-        os.Exit(1)
+        state.diag.Error("multiple cases in a line should be separated with a \";\"")
+        state.diag.At(tokens.Peek().At())
+        state.diag.Exit()
     }
 
     if tokens.Peek().Type == token.SemiCol { tokens.Next() }
@@ -456,39 +465,39 @@ func prsCase(tokens *token.Tokens, condBase ast.Expr, placeholder *ast.Expr) ast
     return ast.Case{ Cond: cond, ColonPos: colonPos, Stmt: stmt }
 }
 
-func prsCases(tokens *token.Tokens, condBase ast.Expr) (cases []ast.Case) {
+func (state *State) prsCases(tokens *token.Tokens, condBase ast.Expr) (cases []ast.Case) {
     if _,ok := condBase.(*ast.Unwrap); ok {
         for tokens.Next().Type != token.BraceR {
-            cases = append(cases, prsUnwrapCase(tokens, condBase))
+            cases = append(cases, state.prsUnwrapCase(tokens, condBase))
         }
     } else {
-        placeholder := getPlaceholder(condBase)
+        placeholder := state.getPlaceholder(condBase)
         for tokens.Next().Type != token.BraceR {
-            cases = append(cases, prsCase(tokens, condBase, placeholder))
+            cases = append(cases, state.prsCase(tokens, condBase, placeholder))
         }
     }
 
     if tokens.Cur().Type != token.BraceR {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected \"}\" at the end of the switch (got \"%s\")\n", tokens.Cur().Str)
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Errorf("expected \"}\" at the end of the switch (got \"%s\")", tokens.Cur().Str)
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
     return
 }
 
-func prsSwitch(tokens *token.Tokens, pos token.Pos, condBase ast.Expr) ast.Switch {
+func (state *State) prsSwitch(tokens *token.Tokens, pos token.Pos, condBase ast.Expr) ast.Switch {
     switchStmt := ast.Switch{ BraceLPos: pos }
 
     if tokens.Peek().Type == token.BraceR {
-        fmt.Fprintln(os.Stderr, "[ERROR] empty switch")
-        fmt.Fprintln(os.Stderr, "\t" + tokens.Cur().At())
-        os.Exit(1)
+        state.diag.Error("empty switch")
+        state.diag.At(tokens.Cur().At())
+        state.diag.Exit()
     }
 
-    identObj.StartScope()
-    switchStmt.Cases = prsCases(tokens, condBase)
-    identObj.EndScope()
+    state.identObj.StartScope()
+    switchStmt.Cases = state.prsCases(tokens, condBase)
+    state.identObj.EndScope()
     switchStmt.BraceRPos = tokens.Cur().Pos
 
     return switchStmt
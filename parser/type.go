@@ -1,15 +1,13 @@
 package prs
 
 import (
-    "os"
-    "fmt"
     "reflect"
     "gamma/ast"
     "gamma/token"
     "gamma/types"
 )
 
-func getTypeUnary(e *ast.Unary) types.Type {
+func (state *State) getTypeUnary(e *ast.Unary) types.Type {
     if e.Operator.Type == token.Amp {
         return types.PtrType{ BaseType: e.Operand.GetType() }
     }
@@ -18,16 +16,16 @@ func getTypeUnary(e *ast.Unary) types.Type {
         if ptr, ok := e.Operand.GetType().(types.PtrType); ok {
             return ptr.BaseType
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] expected a pointer to deref but got %s\n", e.Operand.GetType())
-            fmt.Fprintln(os.Stderr, "\t" + e.Operand.At())
-            os.Exit(1)
+            state.diag.Errorf("expected a pointer to deref but got %s", e.Operand.GetType())
+            state.diag.At(e.Operand.At())
+            state.diag.Exit()
         }
     }
 
     return e.Operand.GetType()
 }
 
-func getTypeBinary(e *ast.Binary) types.Type {
+func (state *State) getTypeBinary(e *ast.Binary) types.Type {
     // bool
     if  e.Operator.Type == token.Eql || e.Operator.Type == token.Neq ||
         e.Operator.Type == token.Grt || e.Operator.Type == token.Lss ||
@@ -41,22 +39,22 @@ func getTypeBinary(e *ast.Binary) types.Type {
     t2 := e.OperandR.GetType()
 
     if t1 == nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] left operand has no type")
-        fmt.Fprintln(os.Stderr, "\t" + e.OperandL.At())
-        os.Exit(1)
+        state.diag.Error("left operand has no type")
+        state.diag.At(e.OperandL.At())
+        state.diag.Exit()
     }
 
     if t2 == nil {
-        fmt.Fprintln(os.Stderr, "[ERROR] right operand has no type")
-        fmt.Fprintln(os.Stderr, "\t" + e.OperandR.At())
-        os.Exit(1)
+        state.diag.Error("right operand has no type")
+        state.diag.At(e.OperandR.At())
+        state.diag.Exit()
     }
 
     if t1.GetKind() == types.Str && t2.GetKind() == types.Str {
         if e.Operator.Type != token.Plus {
-            fmt.Fprintln(os.Stderr, "[ERROR] you can only concat two strs")
-            fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-            os.Exit(1)
+            state.diag.Error("you can only concat two strs")
+            state.diag.At(e.Operator.At())
+            state.diag.Exit()
         }
 
         return types.StrType{}
@@ -65,9 +63,9 @@ func getTypeBinary(e *ast.Binary) types.Type {
 
     if t1.GetKind() == types.Ptr && t2.GetKind() == types.Ptr {
         if e.Operator.Type != token.Minus {
-            fmt.Fprintln(os.Stderr, "[ERROR] you can only subtract two pointer")
-            fmt.Fprintln(os.Stderr, "\t" + e.Operator.At())
-            os.Exit(1)
+            state.diag.Error("you can only subtract two pointer")
+            state.diag.At(e.Operator.At())
+            state.diag.Exit()
         }
 
         return types.CreateUint(types.Ptr_Size)
@@ -82,15 +80,15 @@ func getTypeBinary(e *ast.Binary) types.Type {
     return t1
 }
 
-func getTypeIndexed(e ast.Expr) types.ArrType {
+func (state *State) getTypeIndexed(e ast.Expr) types.ArrType {
     t := e.GetType()
 
     if arrType,ok := t.(types.ArrType); ok {
         return arrType
     } else {
-        fmt.Fprintf(os.Stderr, "[ERROR] expected an array type but got %v\n", reflect.TypeOf(t))
-        fmt.Fprintln(os.Stderr, "\t" + e.At())
-        os.Exit(1)
+        state.diag.Errorf("expected an array type but got %v", reflect.TypeOf(t))
+        state.diag.At(e.At())
+        state.diag.Exit()
         return types.ArrType{}
     }
 }
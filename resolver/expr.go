@@ -1,28 +1,26 @@
 package resolver
 
 import (
-	"fmt"
 	"gamma/ast"
 	"gamma/ast/identObj"
 	"gamma/ast/identObj/vars"
 	"gamma/token"
 	"gamma/types"
-	"os"
 	"reflect"
 )
 
-func resolveForwardExpr(e ast.Expr, t types.Type) {
+func (state *State) resolveForwardExpr(e ast.Expr, t types.Type) {
     if e == nil { return }
 
     switch e := e.(type) {
     case *ast.ArrayLit:
         for _,val := range e.Values {
-            resolveForwardExpr(val, e.Type.BaseType)
+            state.resolveForwardExpr(val, e.Type.BaseType)
         }
 
     case *ast.VectorLit:
-        resolveForwardExpr(e.Cap, types.CreateUint(types.Ptr_Size))
-        resolveForwardExpr(e.Len, types.CreateUint(types.Ptr_Size))
+        state.resolveForwardExpr(e.Cap, types.CreateUint(types.Ptr_Size))
+        state.resolveForwardExpr(e.Len, types.CreateUint(types.Ptr_Size))
 
     case *ast.StructLit:
         for i,field := range e.Fields {
@@ -30,35 +28,35 @@ func resolveForwardExpr(e ast.Expr, t types.Type) {
             if t == nil {
                 t = e.StructType.Types[i]
             }
-            addResolved(field.Value.GetType(), t)
-            resolveForwardExpr(field.Value, t)
+            state.addResolved(field.Value.GetType(), t)
+            state.resolveForwardExpr(field.Value, t)
         }
 
     case *ast.EnumLit:
         if e.Content != nil {
-            resolveForwardExpr(e.Content.Expr, e.ContentType)
+            state.resolveForwardExpr(e.Content.Expr, e.ContentType)
         }
 
     case *ast.Indexed:
-        resolveForwardExpr(e.ArrExpr, e.ArrType)
-        resolveForwardExpr(e.Index, types.CreateUint(types.Ptr_Size))
-        addResolved(e.Type, t)
-        e.Type = getResolvedForwardType(e.Type)
+        state.resolveForwardExpr(e.ArrExpr, e.ArrType)
+        state.resolveForwardExpr(e.Index, types.CreateUint(types.Ptr_Size))
+        state.addResolved(e.Type, t)
+        e.Type = state.getResolvedForwardType(e.Type)
 
     case *ast.Unary:
         switch e.Operator.Type {
         case token.Amp:
             if t,ok := t.(types.PtrType); ok {
-                resolveForwardExpr(e.Operand, t.BaseType)
+                state.resolveForwardExpr(e.Operand, t.BaseType)
             }
         case token.Mul:
-            resolveForwardExpr(e.Operand, types.PtrType{ BaseType: t })
+            state.resolveForwardExpr(e.Operand, types.PtrType{ BaseType: t })
         default:
-            resolveForwardExpr(e.Operand, t)
+            state.resolveForwardExpr(e.Operand, t)
         }
 
-        addResolved(e.Type, t)
-        e.Type = getResolvedForwardType(e.Type)
+        state.addResolved(e.Type, t)
+        e.Type = state.getResolvedForwardType(e.Type)
 
     case *ast.Binary:
         if e.GetType().GetKind() == types.Ptr {
@@ -71,13 +69,13 @@ func resolveForwardExpr(e ast.Expr, t types.Type) {
             }
         }
 
-        addResolved(e.Type, t)
-        e.Type = getResolvedForwardType(e.Type)
-        resolveForwardExpr(e.OperandL, t)
-        resolveForwardExpr(e.OperandR, t)
+        state.addResolved(e.Type, t)
+        e.Type = state.getResolvedForwardType(e.Type)
+        state.resolveForwardExpr(e.OperandL, t)
+        state.resolveForwardExpr(e.OperandR, t)
 
     case *ast.Paren:
-        resolveForwardExpr(e.Expr, t)
+        state.resolveForwardExpr(e.Expr, t)
 
     case *ast.XSwitch:
         if t != nil && t.GetKind() == types.Infer {
@@ -88,172 +86,174 @@ func resolveForwardExpr(e ast.Expr, t types.Type) {
             }
         }
 
-        addResolved(e.Type, t)
-        e.Type = getResolvedForwardType(e.Type)
+        state.addResolved(e.Type, t)
+        e.Type = state.getResolvedForwardType(e.Type)
         for _,c := range e.Cases {
-            resolveForwardExpr(c.Cond, nil)
-            resolveForwardExpr(c.Expr, e.Type)
+            state.resolveForwardExpr(c.Cond, nil)
+            state.resolveForwardExpr(c.Expr, e.Type)
         }
 
     case *ast.FnCall:
-        resolveFuncIdent(e)
+        state.resolveFuncIdent(e)
 
         if types.IsResolvable(e.InsetType) {
-            e.F = e.F.ResolveInferedTypes(getResolvedForwardType(e.InsetType))
+            e.F = e.F.ResolveInferedTypes(state.getResolvedForwardType(e.InsetType))
         }
 
         if e.F.GetName() == "fmt" {
             for _,arg := range e.Values {
-                resolveForwardExpr(arg, nil)
+                state.resolveForwardExpr(arg, nil)
             }
         } else {
                                                                         // resolving from interface not supported
             if e.FnSrc != nil && types.IsResolvable(e.F.GetSrcObj()) && e.FnSrc.GetKind() != types.Interface {
                 fnSrcObj := e.F.GetSrcObj()
-                addResolved(fnSrcObj, e.FnSrc)
-                e.F.ResolveFnSrc(getResolvedForwardType(fnSrcObj))
+                state.addResolved(fnSrcObj, e.FnSrc)
+                e.F.ResolveFnSrc(state.getResolvedForwardType(fnSrcObj))
             }
 
             for i,arg := range e.Values {
                 if i < len(e.F.GetArgs()) {
                     t := e.F.GetArgs()[i]
-                    addResolved(arg.GetType(), t)
-                    resolveForwardExpr(arg, t)
+                    state.addResolved(arg.GetType(), t)
+                    state.resolveForwardExpr(arg, t)
                 }
             }
         }
 
     case *ast.Ident:
         if e.Obj == nil {
-            fmt.Fprintf(os.Stderr, "[ERROR] %s is not defined\n", e.Name)
-            fmt.Fprintln(os.Stderr, "\t" + e.At())
-            os.Exit(1)
+            state.diag.Errorf("%s is not defined", e.Name)
+            state.diag.Suggest(e.Name, state.identObj.VisibleNames(nil))
+            state.diag.At(e.At())
+            state.diag.Exit()
         }
         
         if e.GetType() == nil { return }
 
-        addResolved(e.GetType(), t)
+        state.addResolved(e.GetType(), t)
         switch o := e.Obj.(type) {
         case *identObj.Const:
-            o.ResolveType(getResolvedForwardType(e.GetType()))
+            o.ResolveType(state.getResolvedForwardType(e.GetType()))
         case vars.Var:
-            o.ResolveType(getResolvedForwardType(e.GetType()))
+            o.ResolveType(state.getResolvedForwardType(e.GetType()))
         }
 
     case *ast.Cast:
         if e.DestType.GetKind() == types.Ptr {
             t = types.CreateUint(types.Ptr_Size)
         }
-        resolveForwardExpr(e.Expr, t)
+        state.resolveForwardExpr(e.Expr, t)
 
     case *ast.IntLit:
-        addResolved(e.Type, t)
-        e.Type = getResolvedForwardType(e.Type)
+        state.addResolved(e.Type, t)
+        e.Type = state.getResolvedForwardType(e.Type)
 
     case *ast.CharLit, *ast.BoolLit, *ast.PtrLit, *ast.StrLit, *ast.Field, *ast.Unwrap:
         // nothing to do
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] resolveInferExpr for %v is not implemente yet\n", reflect.TypeOf(e))
-        os.Exit(1)
+        state.diag.Errorf("resolveInferExpr for %v is not implemente yet", reflect.TypeOf(e))
+        state.diag.Exit()
     }
 }
 
-func resolveBackwardExpr(e ast.Expr) {
+func (state *State) resolveBackwardExpr(e ast.Expr) {
     if e == nil { return }
 
     switch e := e.(type) {
     case *ast.ArrayLit:
         for _,e := range e.Values {
-            resolveBackwardExpr(e)
+            state.resolveBackwardExpr(e)
         }
 
     case *ast.VectorLit:
-        resolveBackwardExpr(e.Cap)
-        resolveBackwardExpr(e.Len)
+        state.resolveBackwardExpr(e.Cap)
+        state.resolveBackwardExpr(e.Len)
 
     case *ast.StructLit:
         for _,e := range e.Fields {
-            resolveBackwardExpr(e.Value)
+            state.resolveBackwardExpr(e.Value)
         }
 
     case *ast.EnumLit:
         if e.Content != nil {
-            resolveBackwardExpr(e.Content.Expr)
+            state.resolveBackwardExpr(e.Content.Expr)
         }
 
     case *ast.Indexed:
-        resolveBackwardExpr(e.ArrExpr)
-        resolveBackwardExpr(e.Index)
-        e.Type = getResolvedBackwardType(e.GetType())
+        state.resolveBackwardExpr(e.ArrExpr)
+        state.resolveBackwardExpr(e.Index)
+        e.Type = state.getResolvedBackwardType(e.GetType())
 
     case *ast.Unary:
-        resolveBackwardExpr(e.Operand)
-        e.Type = getResolvedBackwardType(e.GetType())
+        state.resolveBackwardExpr(e.Operand)
+        e.Type = state.getResolvedBackwardType(e.GetType())
 
     case *ast.Binary:
-        e.Type = getResolvedBackwardType(e.Type)
-        resolveBackwardExpr(e.OperandL)
-        resolveBackwardExpr(e.OperandR)
+        e.Type = state.getResolvedBackwardType(e.Type)
+        state.resolveBackwardExpr(e.OperandL)
+        state.resolveBackwardExpr(e.OperandR)
 
     case *ast.Paren:
-        resolveBackwardExpr(e.Expr)
+        state.resolveBackwardExpr(e.Expr)
 
     case *ast.XSwitch:
-        e.Type = getResolvedBackwardType(e.Type)
+        e.Type = state.getResolvedBackwardType(e.Type)
         for _,e := range e.Cases {
-            resolveBackwardExpr(e.Cond)
-            resolveBackwardExpr(e.Expr)
+            state.resolveBackwardExpr(e.Cond)
+            state.resolveBackwardExpr(e.Expr)
         }
 
     case *ast.FnCall:
         if types.IsResolvable(e.InsetType) {
-            e.F = e.F.ResolveInferedTypes(getResolvedBackwardType(e.InsetType))
+            e.F = e.F.ResolveInferedTypes(state.getResolvedBackwardType(e.InsetType))
         }
 
         if e.FnSrc != nil && types.IsResolvable(e.F.GetSrcObj()) {
-            e.F.ResolveFnSrc(getResolvedBackwardType(e.F.GetSrcObj()))
+            e.F.ResolveFnSrc(state.getResolvedBackwardType(e.F.GetSrcObj()))
         }
 
         for _,e := range e.Values {
-            resolveBackwardExpr(e)
+            state.resolveBackwardExpr(e)
         }
 
     case *ast.Cast:
-        resolveBackwardExpr(e.Expr)
+        state.resolveBackwardExpr(e.Expr)
 
     case *ast.IntLit:
-        e.Type = getResolvedBackwardType(e.GetType())
+        e.Type = state.getResolvedBackwardType(e.GetType())
 
     case *ast.Field:
-        resolveBackwardExpr(e.Obj)
+        state.resolveBackwardExpr(e.Obj)
 
     case *ast.CharLit, *ast.BoolLit, *ast.PtrLit, *ast.StrLit, *ast.Ident, *ast.Unwrap:
         // nothing to do
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] resolveInferExpr for %v is not implemente yet\n", reflect.TypeOf(e))
-        os.Exit(1)
+        state.diag.Errorf("resolveInferExpr for %v is not implemente yet", reflect.TypeOf(e))
+        state.diag.Exit()
     }
 }
 
-func resolveFuncIdent(e *ast.FnCall) {
+func (state *State) resolveFuncIdent(e *ast.FnCall) {
     if e.F.IsUnresolved() {
-        if obj := identObj.Get(e.Ident.Name); obj != nil {
+        if obj := state.identObj.Get(e.Ident.Name); obj != nil {
             if f,ok := obj.(*identObj.Func); ok {
-                addResolved(e.F.GetRetType(), f.GetRetType())
+                state.addResolved(e.F.GetRetType(), f.GetRetType())
 
                 e.F = f
                 e.Ident.Obj = obj
             } else {
-                fmt.Fprintf(os.Stderr, "[ERROR] %s is not a function\n", e.Ident.Name)
-                fmt.Fprintln(os.Stderr, "\t" + e.At())
-                os.Exit(1)
+                state.diag.Errorf("%s is not a function", e.Ident.Name)
+                state.diag.At(e.At())
+                state.diag.Exit()
             }
         } else {
-            fmt.Fprintf(os.Stderr, "[ERROR] %s is not defined\n", e.Ident.Name)
-            fmt.Fprintln(os.Stderr, "\t" + e.At())
-            os.Exit(1)
+            state.diag.Errorf("%s is not defined", e.Ident.Name)
+            state.diag.Suggest(e.Ident.Name, state.identObj.VisibleNames(identObj.IsFunc))
+            state.diag.At(e.At())
+            state.diag.Exit()
         }
     }
 }
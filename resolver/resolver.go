@@ -4,30 +4,42 @@ import (
     "fmt"
     "gamma/ast"
     "gamma/types"
+    "gamma/diag"
+    "gamma/ast/identObj"
 )
 
-var resolvedInfers map[uint64]types.Type = make(map[uint64]types.Type)
+// resolved infer types of one compilation (see gamma/compiler)
+type State struct {
+    resolvedInfers map[uint64]types.Type
 
-func Resolve(a ast.Ast) ast.Ast {
-    fmt.Println("[INFO] resolve types/names...")
+    identObj *identObj.State
+    diag *diag.State
+}
+
+func NewState(identObj *identObj.State, diag *diag.State) *State {
+    return &State{ resolvedInfers: make(map[uint64]types.Type), identObj: identObj, diag: diag }
+}
+
+func (state *State) Resolve(a ast.Ast) ast.Ast {
+    fmt.Fprintln(state.diag.Stdout(), "[INFO] resolve types/names...")
     for _,d := range a.Decls {
-        resolveForwardDecl(d)
+        state.resolveForwardDecl(d)
     }
 
     for _,d := range a.Decls {
-        resolveBackwardDecl(d)
+        state.resolveBackwardDecl(d)
     }
 
     return a
 }
 
-func getResolvedForwardType(t types.Type) types.Type {
+func (state *State) getResolvedForwardType(t types.Type) types.Type {
     if ptr,ok := t.(types.PtrType); ok {
-        return types.PtrType{ BaseType: getResolvedForwardType(ptr.BaseType) }
+        return types.PtrType{ BaseType: state.getResolvedForwardType(ptr.BaseType) }
     }
 
     if inferType,ok := t.(types.InferType); ok {
-        if resolvedType := resolvedInfers[inferType.Idx]; resolvedType != nil {
+        if resolvedType := state.resolvedInfers[inferType.Idx]; resolvedType != nil {
             return resolvedType
         }
     }
@@ -35,16 +47,16 @@ func getResolvedForwardType(t types.Type) types.Type {
     return t
 }
 
-func getResolvedBackwardType(t types.Type) types.Type {
+func (state *State) getResolvedBackwardType(t types.Type) types.Type {
     if ptr,ok := t.(types.PtrType); ok {
-        return types.PtrType{ BaseType: getResolvedBackwardType(ptr.BaseType) }
+        return types.PtrType{ BaseType: state.getResolvedBackwardType(ptr.BaseType) }
     }
 
     if inferType,ok := t.(types.InferType); ok {
-        if resolvedType,ok := resolvedInfers[inferType.Idx]; ok {
+        if resolvedType,ok := state.resolvedInfers[inferType.Idx]; ok {
             if t,ok := resolvedType.(types.InferType); ok {
                 if t.Idx != inferType.Idx {
-                    return getResolvedBackwardType(t)
+                    return state.getResolvedBackwardType(t)
                 } else {
                     return t.DefaultType
                 }
@@ -57,20 +69,20 @@ func getResolvedBackwardType(t types.Type) types.Type {
     return t
 }
 
-func addResolved(dstType types.Type, t types.Type) {
+func (state *State) addResolved(dstType types.Type, t types.Type) {
     if t == nil { return }
 
     if ptr,ok := t.(types.PtrType); ok {
         if dstPtr,ok := dstType.(types.PtrType); ok {
-            addResolved(dstPtr.BaseType, ptr.BaseType)
+            state.addResolved(dstPtr.BaseType, ptr.BaseType)
             return
         }
     }
 
     if dstType,ok := dstType.(types.InferType); ok {
-        resolvedType := resolvedInfers[dstType.Idx]
+        resolvedType := state.resolvedInfers[dstType.Idx]
         if resolvedType == nil || resolvedType.GetKind() == types.Infer {
-            resolvedInfers[dstType.Idx] = t
+            state.resolvedInfers[dstType.Idx] = t
         }
     }
 }
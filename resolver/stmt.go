@@ -1,14 +1,12 @@
 package resolver
 
 import (
-    "os"
-    "fmt"
     "reflect"
     "gamma/ast"
     "gamma/types"
 )
 
-func resolveForwardStmt(s ast.Stmt) {
+func (state *State) resolveForwardStmt(s ast.Stmt) {
     switch s := s.(type) {
     case *ast.Assign:
         t := s.Dest.GetType()
@@ -16,124 +14,124 @@ func resolveForwardStmt(s ast.Stmt) {
             t = s.Value.GetType()
         }
 
-        addResolved(s.Value.GetType(), t)
-        resolveForwardExpr(s.Value, t)
-        resolveForwardExpr(s.Dest, t)
+        state.addResolved(s.Value.GetType(), t)
+        state.resolveForwardExpr(s.Value, t)
+        state.resolveForwardExpr(s.Dest, t)
 
     case *ast.Block:
         for _,s := range s.Stmts {
-            resolveForwardStmt(s)
+            state.resolveForwardStmt(s)
         }
 
     case *ast.If:
-        resolveForwardExpr(s.Cond, nil)
-        resolveForwardStmt(&s.Block)
-        if s.Else != nil { resolveForwardStmt(s.Else) }
-        if s.Elif != nil { resolveForwardStmt(s.Elif) }
+        state.resolveForwardExpr(s.Cond, nil)
+        state.resolveForwardStmt(&s.Block)
+        if s.Else != nil { state.resolveForwardStmt(s.Else) }
+        if s.Elif != nil { state.resolveForwardStmt(s.Elif) }
 
     case *ast.Else:
-        resolveForwardStmt(&s.Block)
+        state.resolveForwardStmt(&s.Block)
 
     case *ast.Elif:
-        resolveForwardStmt((*ast.If)(s))
+        state.resolveForwardStmt((*ast.If)(s))
 
     case *ast.Switch:
         for _,s := range s.Cases {
-            resolveForwardStmt(&s)
+            state.resolveForwardStmt(&s)
         }
     case *ast.Case:
         if s.Cond != nil {
-            resolveForwardExpr(s.Cond, nil)
+            state.resolveForwardExpr(s.Cond, nil)
         }
-        resolveForwardStmt(s.Stmt)
+        state.resolveForwardStmt(s.Stmt)
 
     case *ast.For:
-        resolveForwardDecl(&s.Def)
-        resolveForwardExpr(s.Limit, s.Def.Type)
-        resolveForwardExpr(s.Step, s.Def.Type)
-        resolveForwardStmt(&s.Block)
+        state.resolveForwardDecl(&s.Def)
+        state.resolveForwardExpr(s.Limit, s.Def.Type)
+        state.resolveForwardExpr(s.Step, s.Def.Type)
+        state.resolveForwardStmt(&s.Block)
 
     case *ast.While:
-        resolveForwardExpr(s.Cond, nil)
-        if s.Def != nil { resolveForwardDecl(s.Def) }
-        resolveForwardStmt(&s.Block)
+        state.resolveForwardExpr(s.Cond, nil)
+        if s.Def != nil { state.resolveForwardDecl(s.Def) }
+        state.resolveForwardStmt(&s.Block)
 
     case *ast.Ret:
-        resolveForwardExpr(s.RetExpr, s.F.GetRetType())
+        state.resolveForwardExpr(s.RetExpr, s.F.GetRetType())
 
     case *ast.DeclStmt:
-        resolveForwardDecl(s.Decl)
+        state.resolveForwardDecl(s.Decl)
 
     case *ast.ExprStmt:
-        resolveForwardExpr(s.Expr, nil)
+        state.resolveForwardExpr(s.Expr, nil)
 
     case *ast.Through, *ast.Break, *ast.Continue:
         // nothing to do
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] addUnresolvedStmt for %v is not implemente yet\n", reflect.TypeOf(s))
-        os.Exit(1)
+        state.diag.Errorf("addUnresolvedStmt for %v is not implemente yet", reflect.TypeOf(s))
+        state.diag.Exit()
     }
 }
 
-func resolveBackwardStmt(s ast.Stmt) {
+func (state *State) resolveBackwardStmt(s ast.Stmt) {
     switch s := s.(type) {
     case *ast.Assign:
-        resolveBackwardExpr(s.Value)
-        resolveBackwardExpr(s.Dest)
+        state.resolveBackwardExpr(s.Value)
+        state.resolveBackwardExpr(s.Dest)
 
     case *ast.Block:
         for _,s := range s.Stmts {
-            resolveBackwardStmt(s)
+            state.resolveBackwardStmt(s)
         }
 
     case *ast.If:
-        resolveBackwardExpr(s.Cond)
-        resolveBackwardStmt(&s.Block)
-        if s.Elif != nil { resolveBackwardStmt(s.Elif) }
-        if s.Else != nil { resolveBackwardStmt(s.Else) }
+        state.resolveBackwardExpr(s.Cond)
+        state.resolveBackwardStmt(&s.Block)
+        if s.Elif != nil { state.resolveBackwardStmt(s.Elif) }
+        if s.Else != nil { state.resolveBackwardStmt(s.Else) }
 
     case *ast.Else:
-        resolveBackwardStmt(&s.Block)
+        state.resolveBackwardStmt(&s.Block)
 
     case *ast.Elif:
-        resolveBackwardStmt((*ast.If)(s))
+        state.resolveBackwardStmt((*ast.If)(s))
 
     case *ast.Switch:
         for _,s := range s.Cases {
-            resolveBackwardStmt(&s)
+            state.resolveBackwardStmt(&s)
         }
     case *ast.Case:
         if s.Cond != nil {
-            resolveBackwardExpr(s.Cond)
+            state.resolveBackwardExpr(s.Cond)
         }
-        resolveBackwardStmt(s.Stmt)
+        state.resolveBackwardStmt(s.Stmt)
 
     case *ast.For:
-        resolveBackwardDecl(&s.Def)
-        resolveBackwardExpr(s.Limit)
-        resolveBackwardExpr(s.Step)
-        resolveBackwardStmt(&s.Block)
+        state.resolveBackwardDecl(&s.Def)
+        state.resolveBackwardExpr(s.Limit)
+        state.resolveBackwardExpr(s.Step)
+        state.resolveBackwardStmt(&s.Block)
 
     case *ast.While:
-        resolveBackwardExpr(s.Cond)
-        if s.Def != nil { resolveBackwardDecl(s.Def) }
-        resolveBackwardStmt(&s.Block)
+        state.resolveBackwardExpr(s.Cond)
+        if s.Def != nil { state.resolveBackwardDecl(s.Def) }
+        state.resolveBackwardStmt(&s.Block)
 
     case *ast.Ret:
-        resolveBackwardExpr(s.RetExpr)
+        state.resolveBackwardExpr(s.RetExpr)
 
     case *ast.DeclStmt:
-        resolveBackwardDecl(s.Decl)
+        state.resolveBackwardDecl(s.Decl)
 
     case *ast.ExprStmt:
-        resolveBackwardExpr(s.Expr)
+        state.resolveBackwardExpr(s.Expr)
 
     case *ast.Through, *ast.Break, *ast.Continue:
         // nothing to do
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] resolveInferStmt for %v is not implemente yet\n", reflect.TypeOf(s))
-        os.Exit(1)
+        state.diag.Errorf("resolveInferStmt for %v is not implemente yet", reflect.TypeOf(s))
+        state.diag.Exit()
     }
 }
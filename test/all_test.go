@@ -4,51 +4,89 @@ import (
     "os"
     "fmt"
     "flag"
+    "sync"
+    "errors"
+    "syscall"
     "os/exec"
     "strings"
     "testing"
+    "regexp"
     "io/ioutil"
+    "encoding/json"
     "path/filepath"
+    "gamma/ast"
+    "gamma/gen"
+    "gamma/gen/c"
+    "gamma/diag"
+    "gamma/check"
+    "gamma/compiler"
 )
 
-var rec bool
+/*
+every .gma file is a subtest (go test ./test -run 'TestRun/rule110')
+  * the files are compiled in-process (gamma/compiler) and run in a temp dir of their own
+  * the results are compared with recs/<kind>/<name>.rec (recorded with -update, only for the selected tests)
+  * files without expect directives need a rec (a missing rec fails the test)
+*/
+
+var update bool
 var keepAsm bool
 
-var failed bool = false
+// standalone gamma executable (built once for the tests comparing with it)
+var gammaDir string
+var gammaBin string
+var buildGamma sync.Once
+var buildErr error
 
-func record(t *testing.T, path string, name string, stdout string, stderr string) {
-    os.MkdirAll(path, 0644)
+func init() {
+    flag.BoolVar(&update, "update", false, "record the results of the selected tests")
+    flag.BoolVar(&keepAsm, "asm", false, "keep the assembly files generated (<name>.gma.asm)")
+}
 
-    output := []byte(stdout + "\n" + stderr)
-    file := path + "/" + name + ".rec"
+func TestMain(m *testing.M) {
+    flag.Parse()
 
-    err := ioutil.WriteFile(file, output, 0644)
+    dir, err := ioutil.TempDir("", "gamma")
     if err != nil {
-        t.Fatalf("[ERROR] could not record results\n\t%v\n", err)
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
     }
+    gammaDir = dir
+    gammaBin = filepath.Join(dir, "gamma")
+
+    code := m.Run()
 
-    fmt.Println("[RECORDED]")
+    os.RemoveAll(dir)
+    os.Exit(code)
 }
 
-func check(path string, name string, stdout string, stderr string) {
-    result := stdout + "\n" + stderr
-    file := path + "/" + name + ".rec"
+func checkRec(t *testing.T, recDir string, name string, result string) {
+    file := filepath.Join(recDir, filepath.Base(name) + ".rec")
+
+    if update {
+        if err := os.MkdirAll(recDir, 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := ioutil.WriteFile(file, []byte(result), 0644); err != nil {
+            t.Fatalf("could not record results\n\t%v", err)
+        }
+        return
+    }
 
     expected, err := ioutil.ReadFile(file)
+    if os.IsNotExist(err) {
+        t.Fatalf("no recorded results in %s (record them with -update)", file)
+    }
     if err != nil {
-        fmt.Printf("[ERROR] could not compare with recorded results\n\t%v\n", err)
-        return
+        t.Fatal(err)
     }
 
-    if string(expected) == result {
-        fmt.Println("[PASSED]")
-    } else {
-        fmt.Println("[FAILED]")
-        fmt.Println(diff(string(expected), result))
-        failed = true
+    if string(expected) != result {
+        t.Errorf("result differs from %s\n%s", file, diff(string(expected), result))
     }
 }
 
+
 // https://en.wikipedia.org/wiki/Longest_common_subsequence_problem
 func diff(expected string, res string) string {
     expLines := strings.Split(expected, "\n")
@@ -93,84 +131,962 @@ func getDiff(LCS_Table [][]int, a []string, b []string, i int, j int) string {
     }
 }
 
-// removes executable, object and assembly files
-// if 'srcname' != "" -> the assembly file will be renamed instead
-func clearBuilds(t *testing.T, path string, srcname string) {
-    err := os.Remove(path + "output")
-    if err != nil && !os.IsNotExist(err) {
-        t.Fatalf("[ERROR] could not remove output\n%v", err)
+func gmaFiles(t *testing.T, dir string) []string {
+    files, err := filepath.Glob(filepath.Join(dir, "*.gma"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return files
+}
+
+func compile(t *testing.T, file string, o compiler.Options) compiler.Result {
+    src, err := ioutil.ReadFile(file)
+    if err != nil {
+        t.Fatal(err)
     }
 
-    err = os.Remove(path + "output.o")
-    if err != nil && !os.IsNotExist(err) {
-        t.Fatalf("[ERROR] could not remove output.o\n%v", err)
+    if o.ImportDir == "" {
+        o.ImportDir = "../std"
     }
+    o = fileFlags(t, file, o)
+    res := compiler.NewSession().CompileSource(compiler.Source{ Path: file, Text: string(src) }, o)
 
-    if len(srcname) == 0 {
-        err = os.Remove(path + "output.asm")
-        if err != nil && !os.IsNotExist(err)  {
-            t.Fatalf("[ERROR] could not remove output.asm\n%v", err)
+    if keepAsm && res.Asm != "" {
+        if err := ioutil.WriteFile(file + ".asm", []byte(res.Asm), 0644); err != nil {
+            t.Fatal(err)
         }
-    } else {
-        err = os.Rename(path + "output.asm", srcname + ".asm")
-        if err != nil && !os.IsNotExist(err) {
-            t.Fatalf("[ERROR] could not rename output.asm\n%v", err)
+    }
+
+    return res
+}
+
+// -W (and -A) can be set more than once
+type listFlag []string
+
+func (l *listFlag) String() string {
+    return fmt.Sprint(*l)
+}
+
+func (l *listFlag) Set(s string) error {
+    *l = append(*l, s)
+    return nil
+}
+
+// "// expect-flags: [vet] <gamma flags>" (nil if the file has none)
+func flagArgs(t *testing.T, file string) (args []string, line int) {
+    src, err := ioutil.ReadFile(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for i,l := range strings.Split(string(src), "\n") {
+        if idx := strings.Index(l, "// expect-flags:"); idx != -1 {
+            return strings.Fields(l[idx+len("// expect-flags:"):]), i+1
         }
     }
+    return nil, 0
 }
 
-func init() {
-    flag.BoolVar(&rec, "rec", false, "record the stdout and stderr results")
-    flag.BoolVar(&keepAsm, "asm", false, "keep the assembly files generated")
+// the file is always compiled with its expect-flags
+func fileFlags(t *testing.T, file string, o compiler.Options) compiler.Options {
+    args, line := flagArgs(t, file)
+    if len(args) == 0 {
+        return o
+    }
+
+    if args[0] == "vet" {
+        o.Vet = true
+        args = args[1:]
+    }
+
+    flags := flag.NewFlagSet("expect-flags", flag.ContinueOnError)
+    flags.SetOutput(ioutil.Discard)
+    opt0 := flags.Bool("O0", false, "")
+    opt1 := flags.Bool("O1", false, "")
+    opt2 := flags.Bool("O2", false, "")
+    checkOverflow := flags.Bool("check-overflow", false, "")
+    edition := flags.Uint("edition", check.Edition1, "")
+    warnError := flags.Bool("Werror", false, "")
+    var warnings, analyses listFlag
+    flags.Var(&warnings, "W", "")
+    flags.Var(&analyses, "A", "")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+        t.Fatalf("%s:%d: unexpected flags %q (%v)", file, line, args, err)
+    }
+
+    switch {
+    case *opt0:
+        o.OptLevel = gen.O0
+    case *opt1:
+        o.OptLevel = gen.O1
+    case *opt2:
+        o.OptLevel = gen.O2
+    }
+    o.CheckOverflow = o.CheckOverflow || *checkOverflow
+    o.Edition = *edition
+    o.WarnError = *warnError
+    o.Warnings = warnings
+    o.Analyses = analyses
+
+    return o
 }
 
-func test(t *testing.T, flagStr string, importDir string, recDir string, path string) {
-    flag.Parse()
+// like printed by gamma
+func formatDiags(diags []diag.Diagnostic) string {
+    var res strings.Builder
+    for _,d := range diags {
+        res.WriteString(diag.FormatPlain(d))
+    }
+    return res.String()
+}
+
+func writeExe(t *testing.T, dir string, exe []byte) string {
+    path := filepath.Join(dir, "output")
+    if err := ioutil.WriteFile(path, exe, 0755); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+type execResult struct {
+    stdout string
+    stderr string
+    exitCode int
+    err error       // set if the executable did not exit normally
+}
+
+// recorded output (stdout, stderr and how the executable failed)
+func (r execResult) String() string {
+    res := r.stdout + r.stderr
+    if r.err != nil {
+        res += "[ERROR] " + r.err.Error() + "\n"
+    }
+    return res
+}
+
+// runs the executable in its dir (the dir is replaced with $TMP in the output)
+func execute(t *testing.T, path string) execResult {
+    dir := filepath.Dir(path)
+
+    for {
+        var stdout, stderr strings.Builder
+        cmd := exec.Command(path)
+        cmd.Dir = dir
+        cmd.Stdout = &stdout
+        cmd.Stderr = &stderr
+        err := cmd.Run()
+
+        // the executable can still be open in a process forked by a parallel test
+        if errors.Is(err, syscall.ETXTBSY) {
+            continue
+        }
+
+        var exitErr *exec.ExitError
+        if err != nil && !errors.As(err, &exitErr) {
+            t.Fatal(err)
+        }
+
+        // programs printing the dir (like files.gma) pad it with '\0' (the length of the dir differs)
+        clean := func(s string) string {
+            return strings.ReplaceAll(strings.ReplaceAll(s, dir, "$TMP"), "\x00", "")
+        }
+
+        return execResult{ stdout: clean(stdout.String()), stderr: clean(stderr.String()), exitCode: cmd.ProcessState.ExitCode(), err: err }
+    }
+}
+
+func runExe(t *testing.T, path string) string {
+    return execute(t, path).String()
+}
+
+// the diagnostics if the file does not compile (otherwise the output of the executable)
+func result(t *testing.T, file string, o compiler.Options) string {
+    res := compile(t, file, o)
+    if res.Failed() {
+        return formatDiags(res.Diagnostics)
+    }
+
+    return runExe(t, writeExe(t, t.TempDir(), res.Exe))
+}
+
+/*
+inline expectations (comments in the test file, used instead of the rec):
+  * // expect-stdout: <line>        one line of stdout (every line of stdout needs one)
+  * // expect-stderr: <line>        one line of stderr (every line of stderr needs one)
+  * // expect-stderr-match: <re>    one line of stderr matching the regexp (for addresses)
+  * // expect-exit: <code>          exit code of the executable
+  * // expect-error: <msg> at L:C   first line of an error and its position in the test file
+                                    ("at <file>:L:C" for other files, no "at" for errors without a position)
+  * // expect-warning: <msg> at L:C like expect-error for warnings (and the findings of gamma vet)
+  * // expect-line: <line>          next line of the error/warning expected before
+  * // expect-flags: [vet] <flags>  gamma flags the file is compiled with (see fileFlags)
+every error has to be expected (in the same order), warnings only if the file expects one
+*/
+type expectations struct {
+    stdout []string
+    stderr []stderrLine
+    exitCode *int
+    errors []diag.Diagnostic
+    warnings []diag.Diagnostic
+}
+
+type stderrLine struct {
+    text string
+    match *regexp.Regexp    // nil for expect-stderr
+}
+
+func (l stderrLine) String() string {
+    if l.match != nil {
+        return l.match.String()
+    }
+    return l.text
+}
+
+func (l stderrLine) matches(s string) bool {
+    if l.match != nil {
+        return l.match.MatchString(s)
+    }
+    return l.text == s
+}
+
+// "<msg> at L:C"
+func expectedDiag(file string, severity string, val string) diag.Diagnostic {
+    d := diag.Diagnostic{ Severity: severity, Msg: strings.TrimSpace(val) }
+    if at := strings.LastIndex(d.Msg, " at "); at != -1 {
+        d.Pos = d.Msg[at+len(" at "):]
+        d.Msg = d.Msg[:at]
 
-    files, err := ioutil.ReadDir(path)
+        // L:C (in the test file)
+        if strings.Count(d.Pos, ":") == 1 {
+            d.Pos = file + ":" + d.Pos
+        }
+    }
+    return d
+}
+
+func parseExpectations(t *testing.T, file string) (e expectations, ok bool) {
+    src, err := ioutil.ReadFile(file)
     if err != nil {
-        fmt.Fprintln(os.Stderr, err)
+        t.Fatal(err)
     }
 
-    for _, f := range files {
-        if filepath.Ext(f.Name()) == ".gma" {
-            fmt.Print(f.Name())
-            cmd := exec.Command("go", "run", "gamma", "-I", importDir, flagStr, filepath.Join(path, f.Name()))
+    var last *diag.Diagnostic
+    for i,line := range strings.Split(string(src), "\n") {
+        idx := strings.Index(line, "// expect-")
+        if idx == -1 {
+            continue
+        }
 
-            var stdout, stderr strings.Builder
-            cmd.Stdout = &stdout
-            cmd.Stderr = &stderr
+        directive := line[idx+len("// expect-"):]
+        colon := strings.Index(directive, ":")
+        if colon == -1 {
+            t.Fatalf("%s:%d: missing \":\" after the expect directive", file, i+1)
+        }
+        val := strings.TrimPrefix(directive[colon+1:], " ")
 
-            cmd.Run()
+        switch directive[:colon] {
+        case "stdout":
+            e.stdout = append(e.stdout, val)
 
-            stdoutStr := stdout.String()
-            stderrStr := stderr.String()
+        case "stderr":
+            e.stderr = append(e.stderr, stderrLine{ text: val })
 
-            if rec {
-                record(t, recDir, f.Name(), stdoutStr, stderrStr)
-            } else {
-                check(recDir, f.Name(), stdoutStr, stderrStr)
+        case "stderr-match":
+            re, err := regexp.Compile("^" + val + "$")
+            if err != nil {
+                t.Fatalf("%s:%d: %v", file, i+1, err)
             }
+            e.stderr = append(e.stderr, stderrLine{ match: re })
 
-            if keepAsm {
-                clearBuilds(t, path, f.Name())
-            } else {
-                clearBuilds(t, path, "")
+        case "exit":
+            var code int
+            if _,err := fmt.Sscanf(val, "%d", &code); err != nil {
+                t.Fatalf("%s:%d: expected an exit code but got %q", file, i+1, val)
             }
+            e.exitCode = &code
+
+        case "error":
+            e.errors = append(e.errors, expectedDiag(file, "error", val))
+            last = &e.errors[len(e.errors)-1]
+
+        case "warning":
+            e.warnings = append(e.warnings, expectedDiag(file, "warning", val))
+            last = &e.warnings[len(e.warnings)-1]
+
+        case "line":
+            if last == nil {
+                t.Fatalf("%s:%d: expect-line without an expect-error or expect-warning before it", file, i+1)
+            }
+            last.Msg += "\n" + val
+
+        case "flags":
+            // see fileFlags
+
+        default:
+            t.Fatalf("%s:%d: unknown directive \"expect-%s\" (expected stdout, stderr, stderr-match, exit, error, warning, line or flags)", file, i+1, directive[:colon])
         }
+
+        ok = true
+    }
+
+    return e, ok
+}
+
+// the first line of every diagnostic of the severity (all lines if the expected one has more)
+func compareDiags(t *testing.T, severity string, diags []diag.Diagnostic, expected []diag.Diagnostic) {
+    got := []diag.Diagnostic{}
+    for _,d := range diags {
+        if d.Severity == severity {
+            got = append(got, d)
+        }
+    }
+
+    for i := 0; i < len(got) || i < len(expected); i++ {
+        switch {
+        case i >= len(got):
+            t.Errorf("expected %s %q at %s", severity, expected[i].Msg, expected[i].Pos)
+        case i >= len(expected):
+            t.Errorf("unexpected %s %q at %s", severity, got[i].Msg, got[i].Pos)
+        default:
+            msg := got[i].Msg
+            if !strings.Contains(expected[i].Msg, "\n") {
+                msg = strings.Split(msg, "\n")[0]
+            }
+            if msg != expected[i].Msg || got[i].Pos != expected[i].Pos {
+                t.Errorf("expected %s %q at %s\nbut got %q at %s", severity, expected[i].Msg, expected[i].Pos, msg, got[i].Pos)
+            }
+        }
+    }
+}
+
+func checkExpectations(t *testing.T, file string, e expectations, o compiler.Options) {
+    res := compile(t, file, o)
+
+    compareDiags(t, "error", res.Diagnostics, e.errors)
+    if len(e.warnings) > 0 {
+        compareDiags(t, "warning", res.Diagnostics, e.warnings)
+    }
+
+    // gamma vet stops after the checks
+    if res.Failed() || len(res.Exe) == 0 {
+        return
+    }
+
+    r := execute(t, writeExe(t, t.TempDir(), res.Exe))
+
+    if e.stdout != nil {
+        expected := strings.Join(e.stdout, "\n") + "\n"
+        if r.stdout != expected {
+            t.Errorf("stdout differs from the expect-stdout directives\n%s", diff(expected, r.stdout))
+        }
+    }
+
+    if e.stderr != nil {
+        lines := strings.Split(strings.TrimSuffix(r.stderr, "\n"), "\n")
+        for i := 0; i < len(lines) || i < len(e.stderr); i++ {
+            switch {
+            case i >= len(lines):
+                t.Errorf("expected the stderr line %q", e.stderr[i])
+            case i >= len(e.stderr):
+                t.Errorf("unexpected stderr line %q", lines[i])
+            case !e.stderr[i].matches(lines[i]):
+                t.Errorf("expected the stderr line %q but got %q", e.stderr[i], lines[i])
+            }
+        }
+    }
+
+    if e.exitCode != nil && r.exitCode != *e.exitCode {
+        t.Errorf("expected exit code %d but got %d\n%s", *e.exitCode, r.exitCode, r.stderr)
+    }
+}
+
+// the expectations in the file if there are any (otherwise the rec)
+func checkResult(t *testing.T, recDir string, file string, o compiler.Options) {
+    if e,ok := parseExpectations(t, file); ok {
+        checkExpectations(t, file, e, o)
+    } else {
+        checkRec(t, recDir, file, result(t, file, o))
+    }
+}
+
+var optLevels []uint = []uint{ gen.O0, gen.O1, gen.O2 }
+
+// recorded once (TestOptLevels compares the other levels with -O0)
+func TestRun(t *testing.T) {
+    for _,f := range gmaFiles(t, ".") {
+        f := f
+        t.Run(f, func(t *testing.T) {
+            t.Parallel()
+            checkResult(t, "recs/run", f, compiler.Options{ OptLevel: gen.O1 })
+        })
     }
 }
 
 func TestError(t *testing.T) {
-    test(t, "-r", "../std", "recs/err", "errTests/")
+    for _,f := range gmaFiles(t, "errTests") {
+        f := f
+        t.Run(filepath.Base(f), func(t *testing.T) {
+            t.Parallel()
+            checkResult(t, "recs/err", f, compiler.Options{ OptLevel: gen.O1 })
+        })
+    }
 }
 
 func TestAst(t *testing.T) {
-    test(t, "-ast", "../std", "recs/ast", "./")
+    for _,f := range gmaFiles(t, ".") {
+        f := f
+        t.Run(f, func(t *testing.T) {
+            t.Parallel()
+
+            res := compile(t, f, compiler.Options{ OptLevel: gen.O1 })
+            if res.Failed() {
+                checkRec(t, "recs/ast", f, formatDiags(res.Diagnostics))
+            } else {
+                checkRec(t, "recs/ast", f, fileAst(res.Ast, f))
+            }
+        })
+    }
 }
 
-func TestRun(t *testing.T) {
-    test(t, "-r", "../std", "recs/run", "./")
+// only the decls of the file itself (imported files are recorded by their path)
+func fileAst(a ast.Ast, path string) string {
+    var res strings.Builder
+    for _,d := range a.Decls {
+        if !strings.HasPrefix(d.At(), "at: " + path + ":") {
+            continue
+        }
+
+        if i,ok := d.(*ast.Import); ok {
+            res.WriteString(fmt.Sprintf("IMPORT: %s\n", i.Path.Str))
+        } else {
+            res.WriteString(d.Readable(0))
+        }
+    }
+    return res.String()
+}
+
+// programs printing addresses cannot match
+var printsAddrs map[string]bool = map[string]bool{
+    "arrayUnsafe.gma": true,
+    "cast.gma": true,
+    "fmt.gma": true,
+    "ptrArith.gma": true,
+    "sigfpe.gma": true,
+    "sigsegv.gma": true,
+    "stackOverflow.gma": true,
+}
+
+// programs which overflow on purpose (without wrapping_mul, ...)
+var overflows map[string]bool = map[string]bool{
+    "types.gma": true,
+}
+
+// every optimization level should produce the same program output as -O0
+func TestOptLevels(t *testing.T) {
+    for _,f := range gmaFiles(t, ".") {
+        if printsAddrs[f] { continue }
+
+        f := f
+        t.Run(f, func(t *testing.T) {
+            t.Parallel()
+
+            expected := result(t, f, compiler.Options{ OptLevel: optLevels[0] })
+            for _,o := range optLevels[1:] {
+                if res := result(t, f, compiler.Options{ OptLevel: o }); res != expected {
+                    t.Errorf("output differs between -O%d and -O%d\n%s", optLevels[0], o, diff(expected, res))
+                }
+            }
+        })
+    }
+}
+
+// cmpTime and the generated code should agree on every folded constant (cfn calls included)
+func TestConstFolding(t *testing.T) {
+    for _,f := range gmaFiles(t, ".") {
+        f := f
+        t.Run(f, func(t *testing.T) {
+            t.Parallel()
+
+            res := compile(t, f, compiler.Options{ OptLevel: gen.O1 })
+            if res.Failed() {
+                t.Skip("does not compile")
+            }
+            expected := execute(t, writeExe(t, t.TempDir(), res.Exe))
 
-    if failed { os.Exit(1) }
+            res = compile(t, f, compiler.Options{ OptLevel: gen.O1, CheckConsts: true })
+            if res.Failed() {
+                t.Fatalf("does not compile with CheckConsts\n%s", formatDiags(res.Diagnostics))
+            }
+            out := execute(t, writeExe(t, t.TempDir(), res.Exe))
+
+            var stderr strings.Builder
+            for _,l := range strings.SplitAfter(out.stderr, "\n") {
+                if strings.HasPrefix(l, "[MISMATCH] ") {
+                    t.Error(strings.TrimSpace(strings.TrimPrefix(l, "[MISMATCH] ")))
+                } else {
+                    stderr.WriteString(l)
+                }
+            }
+            out.stderr = stderr.String()
+
+            // the checks should not change the program
+            if !printsAddrs[f] && out.String() != expected.String() {
+                t.Errorf("output differs with CheckConsts\n%s", diff(expected.String(), out.String()))
+            }
+        })
+    }
+}
+
+// the test programs do not overflow (intended overflows use wrapping_add, ...)
+// and overflows exit with the position of the op (asm and C backend)
+func TestCheckOverflow(t *testing.T) {
+    for _,f := range gmaFiles(t, ".") {
+        if printsAddrs[f] || overflows[f] { continue }
+
+        f := f
+        t.Run(f, func(t *testing.T) {
+            t.Parallel()
+
+            expected := result(t, f, compiler.Options{ OptLevel: gen.O1 })
+            if out := result(t, f, compiler.Options{ OptLevel: gen.O1, CheckOverflow: true }); out != expected {
+                t.Errorf("output differs with CheckOverflow\n%s", diff(expected, out))
+            }
+        })
+    }
+}
+
+// consts are folded at every level (-O0 only disables jump tables, removal of unused code and peephole optimizations)
+func TestFoldingO0(t *testing.T) {
+    text := "fn main() {\n    x := 123456 * 1000\n    println(itos(x))\n}\n"
+    res := compiler.NewSession().CompileSource(compiler.Source{ Path: "main.gma", Text: text }, compiler.Options{ ImportDir: "../std", OptLevel: gen.O0 })
+    if res.Failed() {
+        t.Fatalf("does not compile\n%s", formatDiags(res.Diagnostics))
+    }
+
+    if !strings.Contains(res.Asm, "123456000") {
+        t.Errorf("expected 123456 * 1000 to be folded at -O0")
+    }
+}
+
+// unreachable funcs, globals and literals are not generated with -O1
+func TestRemoveUnused(t *testing.T) {
+    text := "g u64 := 42\n\nfn unused() {\n    println(utos(g))\n    println(\"unused str\")\n}\n\nfn main() {\n    println(\"used str\")\n}\n"
+
+    for _,useC := range []bool{ false, true } {
+        res := compiler.NewSession().CompileSource(compiler.Source{ Path: "main.gma", Text: text }, compiler.Options{ ImportDir: "../std", OptLevel: gen.O1, UseC: useC })
+        if res.Failed() {
+            t.Fatalf("does not compile\n%s", formatDiags(res.Diagnostics))
+        }
+
+        out := res.Asm
+        if useC { out = res.C }
+
+        if !strings.Contains(out, "used str") {
+            t.Errorf("expected \"used str\" to be generated (C: %v)", useC)
+        }
+        removed := []string{ "unused", "42" }
+        // the C prelude is static (cc drops its unused functions)
+        if !useC { removed = append(removed, "utos") }
+
+        for _,name := range removed {
+            if strings.Contains(out, name) {
+                t.Errorf("expected %q to be removed (C: %v)", name, useC)
+            }
+        }
+    }
+}
+
+// the build-in assembler/linker and nasm/ld should produce the same program output
+func TestBackends(t *testing.T) {
+    if _,err := exec.LookPath("nasm"); err != nil {
+        t.Skip("nasm not found")
+    }
+    if _,err := exec.LookPath("ld"); err != nil {
+        t.Skip("ld not found")
+    }
+
+    for _,f := range gmaFiles(t, ".") {
+        f := f
+        t.Run(f, func(t *testing.T) {
+            t.Parallel()
+
+            res := compile(t, f, compiler.Options{ OptLevel: gen.O1 })
+            if res.Failed() {
+                t.Fatalf("does not compile\n%s", formatDiags(res.Diagnostics))
+            }
+
+            dir := t.TempDir()
+            if err := ioutil.WriteFile(filepath.Join(dir, "output.asm"), []byte(res.Asm), 0644); err != nil {
+                t.Fatal(err)
+            }
+            for _,args := range [][]string{ { "nasm", "-f", "elf64", "-o", "output.o", "output.asm" }, { "ld", "-o", "output", "output.o" } } {
+                cmd := exec.Command(args[0], args[1:]...)
+                cmd.Dir = dir
+                if out, err := cmd.CombinedOutput(); err != nil {
+                    t.Fatalf("%s failed: %v\n%s", args[0], err, out)
+                }
+            }
+
+            expected := runExe(t, writeExe(t, t.TempDir(), res.Exe))
+            if out := runExe(t, filepath.Join(dir, "output")); out != expected {
+                t.Errorf("output differs between nasm/ld and the build-in assembler/linker\n%s", diff(expected, out))
+            }
+        })
+    }
+}
+
+// the C backend should produce the same program output as the asm backend
+func TestC(t *testing.T) {
+    if _,err := exec.LookPath(c.CC()); err != nil {
+        t.Skip("cc not found")
+    }
+
+    for _,f := range gmaFiles(t, ".") {
+        if printsAddrs[f] { continue }
+
+        f := f
+        t.Run(f, func(t *testing.T) {
+            t.Parallel()
+
+            expected := result(t, f, compiler.Options{ OptLevel: gen.O1 })
+
+            res := compile(t, f, compiler.Options{ OptLevel: gen.O1, UseC: true })
+            if res.Failed() {
+                if out := formatDiags(res.Diagnostics); out != expected {
+                    t.Errorf("diagnostics differ between the asm and the C backend\n%s", diff(expected, out))
+                }
+                return
+            }
+
+            dir := t.TempDir()
+            if err := ioutil.WriteFile(filepath.Join(dir, "output.c"), []byte(res.C), 0644); err != nil {
+                t.Fatal(err)
+            }
+            cmd := exec.Command(c.CC(), append(c.CCFlags(gen.O1), "-o", "output", "output.c")...)
+            cmd.Dir = dir
+            if out, err := cmd.CombinedOutput(); err != nil {
+                t.Fatalf("cc failed: %v\n%s", err, out)
+            }
+
+            if out := runExe(t, filepath.Join(dir, "output")); out != expected {
+                t.Errorf("output differs between the asm and the C backend\n%s", diff(expected, out))
+            }
+        })
+    }
+}
+
+func buildGammaBin(t *testing.T) {
+    buildGamma.Do(func() {
+        if out, err := exec.Command("go", "build", "-o", gammaBin, "gamma").CombinedOutput(); err != nil {
+            buildErr = fmt.Errorf("%v\n%s", err, out)
+        }
+    })
+
+    if buildErr != nil {
+        t.Fatalf("could not build gamma\n%v", buildErr)
+    }
+}
+
+// asm and error output of the standalone compiler ("" if the file does not compile)
+func standalone(t *testing.T, file string) (asm string, stderr string) {
+    buildGammaBin(t)
+
+    std := absStd(t)
+
+    // "vet" has to be the first arg
+    args := []string{ "-I", std, "-error-format=plain", "-c" }
+    if flags,_ := flagArgs(t, file); len(flags) > 0 {
+        if flags[0] == "vet" {
+            args = append([]string{ "vet" }, append(args, flags[1:]...)...)
+        } else {
+            args = append(args, flags...)
+        }
+    }
+
+    dir := t.TempDir()
+    cmd := exec.Command(gammaBin, append(args, file)...)
+    cmd.Dir = dir
+
+    var errOut strings.Builder
+    cmd.Stderr = &errOut
+    if err := cmd.Run(); err != nil {
+        return "", errOut.String()
+    }
+
+    // warnings are written to stderr too
+    res, err := ioutil.ReadFile(filepath.Join(dir, "output.asm"))
+    if err != nil {
+        return "", errOut.String()
+    }
+
+    return string(res), errOut.String()
+}
+
+func absStd(t *testing.T) string {
+    std, err := filepath.Abs("../std")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return std
+}
+
+func absGmaFiles(t *testing.T, dir string) []string {
+    files := gmaFiles(t, dir)
+    for i,f := range files {
+        abs, err := filepath.Abs(f)
+        if err != nil {
+            t.Fatal(err)
+        }
+        files[i] = abs
+    }
+    return files
+}
+
+// several compilations in one process should produce the same asm as separate processes
+func TestSessions(t *testing.T) {
+    expected := make(map[string]string)
+    for _,f := range absGmaFiles(t, ".") {
+        // compile errors are tested by TestSourceErrors
+        if asm,_ := standalone(t, f); asm != "" {
+            expected[f] = asm
+        }
+    }
+
+    // same import dir as gamma (-check-overflow puts the paths of the std files into the asm)
+    std := absStd(t)
+    for f,asm := range expected {
+        if res := compile(t, f, compiler.Options{ ImportDir: std, OptLevel: gen.O1 }); res.Asm != asm {
+            t.Errorf("%s: generated asm differs in a session\n%s", f, diff(asm, res.Asm))
+        }
+    }
+
+    var wg sync.WaitGroup
+    var mutex sync.Mutex
+    differs := []string{}
+    for f,asm := range expected {
+        wg.Add(1)
+        go func(f string, asm string) {
+            defer wg.Done()
+            src, _ := ioutil.ReadFile(f)
+            res := compiler.NewSession().CompileSource(compiler.Source{ Path: f, Text: string(src) }, fileFlags(t, f, compiler.Options{ ImportDir: std, OptLevel: gen.O1 }))
+            if res.Asm != asm {
+                mutex.Lock()
+                differs = append(differs, f)
+                mutex.Unlock()
+            }
+        }(f, asm)
+    }
+    wg.Wait()
+
+    for _,f := range differs {
+        t.Errorf("%s: generated asm differs in concurrent sessions", f)
+    }
+}
+
+// compile errors should be returned as diagnostics (the same as printed by gamma)
+func TestSourceErrors(t *testing.T) {
+    for _,f := range absGmaFiles(t, "errTests") {
+        f := f
+        t.Run(filepath.Base(f), func(t *testing.T) {
+            t.Parallel()
+
+            _,expected := standalone(t, f)
+            // same import dir as gamma (the path of buildin.gma is part of some errors)
+            if res := compile(t, f, compiler.Options{ ImportDir: absStd(t), OptLevel: gen.O1 }); formatDiags(res.Diagnostics) != expected {
+                t.Errorf("expected diagnostics\n%sbut got\n%s", expected, formatDiags(res.Diagnostics))
+            }
+        })
+    }
+}
+
+// imports from in-memory files
+func TestSourceFiles(t *testing.T) {
+    files := map[string]string{
+        "lib.gma": "fn answer() -> i32 {\n    ret 42\n}\n",
+    }
+
+    src := compiler.Source{ Path: "main.gma", Text: "import \"lib.gma\"\n\nfn main() {\n    println(itos(answer()))\n}\n", Files: files }
+    res := compiler.NewSession().CompileSource(src, compiler.Options{ ImportDir: "../std", OptLevel: gen.O1, ObjOnly: true })
+    if res.Failed() || len(res.Obj) == 0 || !strings.Contains(res.Asm, "answer") {
+        t.Errorf("expected main.gma to compile\n%v", res.Diagnostics)
+    }
+
+    src.Text = "import \"lib.gma\"\n\nfn main() {\n    println(itos(answr()))\n}\n"
+    res = compiler.NewSession().CompileSource(src, compiler.Options{ ImportDir: "../std", OptLevel: gen.O1 })
+    if !res.Failed() || len(res.Diagnostics) != 1 || !strings.HasPrefix(res.Diagnostics[0].Pos, "main.gma:4:") {
+        t.Errorf("expected an error in main.gma:4 but got %v", res.Diagnostics)
+    }
+
+    if _,err := os.Stat("output.asm"); err == nil {
+        t.Error("in-memory compilation should not write output.asm")
+    }
+}
+
+// test blocks are run by the test runner (in their own process) instead of main
+func TestTestBlocks(t *testing.T) {
+    src := compiler.Source{ Path: "tests.gma", Text: `fn add(a i64, b i64) -> i64 {
+    ret a + b
+}
+
+test "add" {
+    assert(add(1, 2) == 3, "1 + 2 should be 3")
+}
+
+test "failing add" {
+    assert(add(2, 2) == 5, "2 + 2 should be 5")
+    println("not reached")
+}
+
+test "crash" {
+    // null at runtime (only const 0 cannot be cast into a pointer)
+    z := 0
+    p := z as *i64
+    println(itos(*p))
+}
+
+fn main() {
+    println("main")
+}
+` }
+
+    // the generated runner has to compile in every edition
+    for _,edition := range []uint{ check.Edition1, check.Edition2 } {
+        t.Run(fmt.Sprintf("edition%d", edition), func(t *testing.T) {
+            res := compiler.NewSession().CompileSource(src, compiler.Options{ ImportDir: "../std", OptLevel: gen.O1, Tests: true, Edition: edition })
+            if res.Failed() {
+                t.Fatalf("expected tests.gma to compile\n%s", formatDiags(res.Diagnostics))
+            }
+
+            r := execute(t, writeExe(t, t.TempDir(), res.Exe))
+
+            expected := "[PASS] add\n[FAIL] failing add (exit code 1)\n[FAIL] crash (exit code 139)\n\n1 passed, 2 failed\n"
+            if r.stdout != expected {
+                t.Errorf("unexpected output of the test runner\n%s", diff(expected, r.stdout))
+            }
+            // the crash is reported by the signal handler (the ip differs between builds)
+            if expected := "[ASSERT] tests.gma:10:5: 2 + 2 should be 5\n[SIGSEGV] invalid memory access at 0x0 (in _test2, ip 0x"; !strings.HasPrefix(r.stderr, expected) {
+                t.Errorf("expected the failed assert and the crash %q but got %q", expected, r.stderr)
+            }
+            if r.exitCode != 1 {
+                t.Errorf("expected exit code 1 (failed tests) but got %d", r.exitCode)
+            }
+        })
+    }
+}
+
+// -emit writes valid JSON with positions, resolved types and references to the declarations
+func TestEmit(t *testing.T) {
+    src := compiler.Source{ Path: "main.gma", Text: "N :: 3\n\nfn main() {\n    x := N as i64\n    println(itos(x))\n}\n" }
+
+    expected := map[string][]string{
+        "tokens":   { `"str": "x"`, `"pos": "main.gma:4:5"` },
+        "ast-json": { `"kind": "DefVar"`, `"type": "i64"`, `"decl": "main.gma:4:5"`, "\"kind\": \"DefConst\",\n      \"pos\": \"main.gma:1:1\"" },
+        "symbols":  { `"name": "x"`, `"kind": "LocalVar"`, `"scope": "local"` },
+    }
+    for kind,strs := range expected {
+        res := compiler.NewSession().CompileSource(src, compiler.Options{ ImportDir: "../std", Emit: kind })
+        if res.Failed() {
+            t.Fatalf("expected -emit=%s to succeed\n%s", kind, formatDiags(res.Diagnostics))
+        }
+        if !json.Valid([]byte(res.Emitted)) {
+            t.Fatalf("-emit=%s wrote invalid JSON\n%s", kind, res.Emitted)
+        }
+        for _,s := range strs {
+            if !strings.Contains(res.Emitted, s) {
+                t.Errorf("expected %s in the output of -emit=%s", s, kind)
+            }
+        }
+    }
+
+    // only the main file unless EmitImports is set
+    for _,kind := range []string{ "ast-json", "symbols" } {
+        for _,imports := range []bool{ false, true } {
+            res := compiler.NewSession().CompileSource(src, compiler.Options{ ImportDir: "../std", Emit: kind, EmitImports: imports })
+            if strings.Contains(res.Emitted, "buildin.gma") != imports {
+                t.Errorf("-emit=%s with EmitImports %v: expected buildin.gma in the output to be %v", kind, imports, imports)
+            }
+        }
+    }
+
+    if res := compiler.NewSession().CompileSource(src, compiler.Options{ ImportDir: "../std", Emit: "asm" }); !res.Failed() {
+        t.Error("expected an error for -emit=asm")
+    }
+}
+
+// errors of gamma with source lines (text) or as JSON lines (json)
+func TestErrorFormats(t *testing.T) {
+    buildGammaBin(t)
+
+    file, err := filepath.Abs("errTests/nameTaken.gma")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    stderr := func(format string) string {
+        cmd := exec.Command(gammaBin, "-I", absStd(t), "-error-format=" + format, "-c", file)
+        cmd.Dir = t.TempDir()
+
+        var errOut strings.Builder
+        cmd.Stderr = &errOut
+        if err := cmd.Run(); err == nil {
+            t.Fatalf("expected %s to fail", file)
+        }
+        return errOut.String()
+    }
+
+    expected := "[ERROR] name \"x\" is already taken in this scope\n" +
+        " --> " + file + ":3:5\n" +
+        "  |\n" +
+        "3 |     x := 4\n" +
+        "  |     ^\n" +
+        " ::: " + file + ":2:5\n" +
+        "  |\n" +
+        "2 |     x := 3\n" +
+        "  |     - first defined here\n" +
+        "  |\n"
+    if res := stderr("text"); res != expected {
+        t.Errorf("unexpected text output\n%s", diff(expected, res))
+    }
+
+    var d struct {
+        Severity string
+        Message string
+        File string
+        Line, Col int
+        Notes []struct{ Message string; Line, Col int }
+    }
+    res := stderr("json")
+    if err := json.Unmarshal([]byte(res), &d); err != nil {
+        t.Fatalf("expected one JSON object but got %q (%v)", res, err)
+    }
+    if d.Severity != "error" || d.File != file || d.Line != 3 || d.Col != 5 ||
+        len(d.Notes) != 1 || d.Notes[0].Message != "first defined here" || d.Notes[0].Line != 2 {
+        t.Errorf("unexpected diagnostic %+v", d)
+    }
+}
+
+// locals are immutable unless declared with mut (only in edition 2)
+func TestEdition(t *testing.T) {
+    for _,o := range []compiler.Options{ { OptLevel: gen.O1 }, { OptLevel: gen.O1, Edition: check.Edition2 } } {
+        if out := result(t, "mut.gma", o); out != "4\n6\n7\n" {
+            t.Errorf("unexpected output of mut.gma (edition %d)\n%s", o.Edition, out)
+        }
+    }
+
+    // errTests/immutable*.gma are errors only in edition 2 (see their expect-flags)
+    files, err := filepath.Glob("errTests/immutable*.gma")
+    if err != nil || len(files) == 0 {
+        t.Fatalf("no errTests/immutable*.gma (%v)", err)
+    }
+    for _,f := range files {
+        src, err := ioutil.ReadFile(f)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        res := compiler.NewSession().CompileSource(compiler.Source{ Path: f, Text: string(src) }, compiler.Options{ ImportDir: "../std", CheckOnly: true, Edition: check.Edition1 })
+        if res.Failed() {
+            t.Errorf("expected no error in edition 1 but got\n%s", formatDiags(res.Diagnostics))
+        }
+    }
 }
@@ -0,0 +1,113 @@
+package test
+
+import (
+    "fmt"
+    "time"
+    "regexp"
+    "runtime/debug"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "gamma/gen"
+    "gamma/diag"
+    "gamma/emit"
+    "gamma/compiler"
+)
+
+/*
+fuzz targets for the front-end (go test ./test -fuzz FuzzParse)
+  * every input has to end with success or with a diagnostic (no panic, no hang)
+  * the .gma files in test/ and test/errTests are the seed corpus
+*/
+
+const fuzzPath string = "fuzz.gma"
+const fuzzTimeout time.Duration = 10*time.Second
+
+// reading /dev/zero (or any file outside of the test dirs) is not part of the front-end
+var fuzzImport *regexp.Regexp = regexp.MustCompile(`import\s*"(/|\.\.)`)
+
+func addSeeds(f *testing.F) {
+    for _,dir := range []string{ ".", "errTests" } {
+        files, err := filepath.Glob(filepath.Join(dir, "*.gma"))
+        if err != nil {
+            f.Fatal(err)
+        }
+
+        for _,file := range files {
+            src, err := ioutil.ReadFile(file)
+            if err != nil {
+                f.Fatal(err)
+            }
+            f.Add(string(src))
+        }
+    }
+}
+
+// fails if the stage panics (not with a diagnostic) or does not finish
+func fuzzStage(t *testing.T, src string, stage func(s *compiler.Session) []diag.Diagnostic) {
+    if fuzzImport.MatchString(src) {
+        t.Skip("imports outside of the test dirs")
+    }
+
+    // buffered: after a timeout nobody receives the result anymore
+    done := make(chan string, 1)
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                done <- fmt.Sprintf("panic: %v\n%s", r, debug.Stack())
+            }
+            close(done)
+        }()
+
+        for _,d := range stage(compiler.NewSession()) {
+            if d.Severity != "error" && d.Severity != "warning" {
+                done <- fmt.Sprintf("unexpected diagnostic %v", d)
+                return
+            }
+        }
+    }()
+
+    select {
+    case r := <-done:
+        if r != "" {
+            t.Fatalf("%s\ninput: %q", r, src)
+        }
+    case <-time.After(fuzzTimeout):
+        // the session cannot be interrupted, its goroutine is left behind (every input gets its own session)
+        t.Fatalf("no result after %v\ninput: %q", fuzzTimeout, src)
+    }
+}
+
+func FuzzTokenize(f *testing.F) {
+    addSeeds(f)
+
+    f.Fuzz(func(t *testing.T, src string) {
+        fuzzStage(t, src, func(s *compiler.Session) []diag.Diagnostic {
+            res := s.CompileSource(compiler.Source{ Path: fuzzPath, Text: src }, compiler.Options{ ImportDir: "../std", Emit: emit.Tokens })
+            return res.Diagnostics
+        })
+    })
+}
+
+func FuzzParse(f *testing.F) {
+    addSeeds(f)
+
+    f.Fuzz(func(t *testing.T, src string) {
+        fuzzStage(t, src, func(s *compiler.Session) []diag.Diagnostic {
+            res := s.CompileSource(compiler.Source{ Path: fuzzPath, Text: src }, compiler.Options{ ImportDir: "../std", ParseOnly: true })
+            return res.Diagnostics
+        })
+    })
+}
+
+// resolving names/types and type checking
+func FuzzCheck(f *testing.F) {
+    addSeeds(f)
+
+    f.Fuzz(func(t *testing.T, src string) {
+        fuzzStage(t, src, func(s *compiler.Session) []diag.Diagnostic {
+            res := s.CompileSource(compiler.Source{ Path: fuzzPath, Text: src }, compiler.Options{ ImportDir: "../std", OptLevel: gen.O1, CheckOnly: true })
+            return res.Diagnostics
+        })
+    })
+}
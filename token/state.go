@@ -0,0 +1,14 @@
+package token
+
+import (
+    "gamma/diag"
+)
+
+// the states used by the tokenizer (see gamma/compiler)
+type State struct {
+    diag *diag.State
+}
+
+func NewState(diag *diag.State) *State {
+    return &State{ diag: diag }
+}
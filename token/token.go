@@ -4,7 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"gamma/types"
-	"os"
+	"io"
 	"strconv"
 )
 
@@ -102,7 +102,7 @@ const (
     TokenTypeCount uint = iota
 )
 
-func ToTokenType(s string, p Pos) TokenType {
+func (state *State) ToTokenType(s string, p Pos) TokenType {
     switch s {
     case "true", "false":
         return Boolean
@@ -264,9 +264,9 @@ func ToTokenType(s string, p Pos) TokenType {
                     return Number
                 } else {
                     if e,ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
-                        fmt.Fprintf(os.Stderr, "[ERROR] %s is too big (out of u64 range)\n", s)
-                        fmt.Fprintln(os.Stderr, "\t" + p.At())
-                        os.Exit(1);
+                        state.diag.Errorf("%s is too big (out of u64 range)", s)
+                        state.diag.At(p.At())
+                        state.diag.Exit();
                     }
                 }
             }
@@ -471,12 +471,13 @@ type Tokens struct {
     idx int
     path string
     lastImport bool
+    state *State
 }
 
 func (t *Tokens) split(s string, start int, end int, line int, file string) {
     if start != end {
         s := s[start:end]
-        typ := ToTokenType(s, Pos{line, start+1, file})
+        typ := t.state.ToTokenType(s, Pos{line, start+1, file})
 
         t.tokens = append(t.tokens, Token{typ, s, Pos{line, start+1, file} })
     }
@@ -496,10 +497,11 @@ func (t *Tokens) SetLastImport() {
     }
 }
 
-func Tokenize(path string, src *os.File) (tokens Tokens) {
+func (state *State) Tokenize(path string, src io.Reader) (tokens Tokens) {
     tokens.idx = -1
     tokens.path = path
     tokens.lastImport = true
+    tokens.state = state
 
     scanner := bufio.NewScanner(src)
 
@@ -554,12 +556,19 @@ func Tokenize(path string, src *os.File) (tokens Tokens) {
 
             // char literal
             case '\'':
-                if line[start+1] == '\\' {
-                    i++
+                end := i+3
+                if i+1 < len(line) && line[i+1] == '\\' {
+                    end++
+                }
+                if end > len(line) || line[end-1] != '\'' {
+                    state.diag.Error("char literal not terminated (missing \"'\")")
+                    state.diag.At(Pos{lineNum, i+1, path}.At())
+                    state.diag.Exit()
                 }
-                tokens.split(line, start, i+3, lineNum, path)
-                start = i+3
-                i += 2
+
+                tokens.split(line, start, end, lineNum, path)
+                start = end
+                i = end-1
 
             // split at space
             case ' ', '\t':
@@ -573,7 +582,7 @@ func Tokenize(path string, src *os.File) (tokens Tokens) {
                     switch s {
                     case "<<=", ">>=":
                         tokens.split(line, start, i, lineNum, path)
-                        tokens.tokens = append(tokens.tokens, Token{ ToTokenType(s, Pos{lineNum, i+1, path}), s, Pos{lineNum, i+1, path} })
+                        tokens.tokens = append(tokens.tokens, Token{ state.ToTokenType(s, Pos{lineNum, i+1, path}), s, Pos{lineNum, i+1, path} })
                         start = i+3
                         i+=2
                         continue
@@ -602,7 +611,7 @@ func Tokenize(path string, src *os.File) (tokens Tokens) {
 
                     case "&&", "||", ":=", "::", "!=", "==", "<=", ">=", "->", "<<", ">>", "+=", "-=", "*=", "/=", "&=", "|=", "%=", "^=":
                         tokens.split(line, start, i, lineNum, path)
-                        tokens.tokens = append(tokens.tokens, Token{ ToTokenType(s, Pos{lineNum, i+1, path}), s, Pos{lineNum, i+1, path} })
+                        tokens.tokens = append(tokens.tokens, Token{ state.ToTokenType(s, Pos{lineNum, i+1, path}), s, Pos{lineNum, i+1, path} })
                         start = i+2
                         i++
                         continue
@@ -614,7 +623,7 @@ func Tokenize(path string, src *os.File) (tokens Tokens) {
             // split at non space char (and keep char)
             case '(', ')', '{', '}', '[', ']', '.', ',', ';', '$', '~':
                 tokens.split(line, start, i, lineNum, path)
-                tokens.tokens = append(tokens.tokens, Token{ ToTokenType(string(line[i]), Pos{lineNum, i+1, path}), string(line[i]), Pos{lineNum, i+1, path} })
+                tokens.tokens = append(tokens.tokens, Token{ state.ToTokenType(string(line[i]), Pos{lineNum, i+1, path}), string(line[i]), Pos{lineNum, i+1, path} })
                 start = i+1
             }
         }
@@ -624,20 +633,30 @@ func Tokenize(path string, src *os.File) (tokens Tokens) {
         }
     }
 
+    if err := scanner.Err(); err != nil {
+        state.diag.Errorf("could not read %s (%v)", path, err)
+        state.diag.At(Pos{lineNum, 1, path}.At())
+        state.diag.Exit()
+    }
+
     tokens.tokens = append(tokens.tokens, Token{EOF, "EOF", Pos{ Line: lineNum, Col: len(line), File: path }})
 
     if strLit {
-        fmt.Fprintln(os.Stderr, "string literal not terminated (missing '\"')")
-        os.Exit(1)
+        state.diag.Error("string literal not terminated (missing '\"')")
+        state.diag.Exit()
     }
     if mlComment {
-        fmt.Fprintln(os.Stderr, "comment not terminated (missing \"*/\")")
-        os.Exit(1)
+        state.diag.Error("comment not terminated (missing \"*/\")")
+        state.diag.Exit()
     }
 
     return
 }
 
+func (t *Tokens) All() []Token {
+    return t.tokens
+}
+
 func (t *Tokens) Cur() Token {
     return t.tokens[t.idx]
 }
@@ -646,8 +665,8 @@ func (t *Tokens) Next() Token {
     t.idx++
 
     if t.idx >= len(t.tokens) {
-        fmt.Fprintln(os.Stderr, "[ERROR] unexpected end of file")
-        os.Exit(1)
+        t.state.diag.Error("unexpected end of file")
+        t.state.diag.Exit()
     }
 
     return t.tokens[t.idx]
@@ -655,8 +674,8 @@ func (t *Tokens) Next() Token {
 
 func (t *Tokens) Peek() Token {
     if t.idx+1 >= len(t.tokens) {
-        fmt.Fprintln(os.Stderr, "[ERROR] unexpected end of file")
-        os.Exit(1)
+        t.state.diag.Error("unexpected end of file")
+        t.state.diag.Exit()
     }
 
     return t.tokens[t.idx+1]
@@ -664,8 +683,8 @@ func (t *Tokens) Peek() Token {
 
 func (t *Tokens) Peek2() Token {
     if t.idx+2 >= len(t.tokens) {
-        fmt.Fprintln(os.Stderr, "[ERROR] unexpected end of file")
-        os.Exit(1)
+        t.state.diag.Error("unexpected end of file")
+        t.state.diag.Exit()
     }
 
     return t.tokens[t.idx+2]
@@ -673,8 +692,8 @@ func (t *Tokens) Peek2() Token {
 
 func (t *Tokens) Last() Token {
     if t.idx < 1 {
-        fmt.Fprintln(os.Stderr, "[ERROR] unexpected beginning of file (expected 1 word more at the start of the file)")
-        os.Exit(1)
+        t.state.diag.Error("unexpected beginning of file (expected 1 word more at the start of the file)")
+        t.state.diag.Exit()
     }
 
     return t.tokens[t.idx-1]
@@ -682,8 +701,8 @@ func (t *Tokens) Last() Token {
 
 func (t *Tokens) Last2() Token {
     if t.idx < 2 {
-        fmt.Fprintf(os.Stderr, "[ERROR] unexpected beginning of file (expected %d words more at the start of the file)\n", 2-t.idx)
-        os.Exit(1)
+        t.state.diag.Errorf("unexpected beginning of file (expected %d words more at the start of the file)", 2-t.idx)
+        t.state.diag.Exit()
     }
 
     return t.tokens[t.idx-2]
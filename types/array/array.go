@@ -1,35 +1,67 @@
 package array
 
 import (
-    "os"
     "fmt"
     "gamma/types"
     "gamma/types/str"
     "gamma/cmpTime/constVal"
     "gamma/gen/asm/x86_64"
     "gamma/gen/asm/x86_64/nasm"
+    "gamma/diag"
 )
 
-var arrayData []constVal.ArrConst
+// array literals of one compilation (see gamma/compiler)
+type State struct {
+    arrayData []constVal.ArrConst
+    used map[uint64]bool    // nil -> every literal is generated
 
-func SetElem(arrIdx uint64, idx uint64, val constVal.ConstVal) {
-    if len(arrayData[arrIdx].Elems) == 0 {
-        arrayData[arrIdx].Elems = make([]constVal.ConstVal, arrayData[arrIdx].Type.Len)
+    diag *diag.State
+    nasm *nasm.State
+    str *str.State
+}
+
+func NewState(diag *diag.State, nasm *nasm.State, str *str.State) *State {
+    return &State{ diag: diag, nasm: nasm, str: str }
+}
+
+func (state *State) SetElem(arrIdx uint64, idx uint64, val constVal.ConstVal) {
+    if len(state.arrayData[arrIdx].Elems) == 0 {
+        state.arrayData[arrIdx].Elems = make([]constVal.ConstVal, state.arrayData[arrIdx].Type.Len)
     }
 
-    arrayData[arrIdx].Elems[idx] = val
+    state.arrayData[arrIdx].Elems[idx] = val
+}
+
+func (state *State) GetValues(arrIdx uint64) []constVal.ConstVal {
+    return state.arrayData[arrIdx].Elems
 }
 
-func GetValues(arrIdx uint64) []constVal.ConstVal {
-    return arrayData[arrIdx].Elems
+func (state *State) Count() uint64 {
+    return uint64(len(state.arrayData))
 }
 
-func Add(t types.ArrType, elems []constVal.ConstVal) uint64 {
-    arr := constVal.ArrConst{ Idx: uint64(len(arrayData)), Type: t, Elems: elems }
-    arrayData = append(arrayData, arr)
+func (state *State) GetType(arrIdx uint64) types.ArrType {
+    return state.arrayData[arrIdx].Type
+}
+
+func (state *State) Add(t types.ArrType, elems []constVal.ConstVal) uint64 {
+    arr := constVal.ArrConst{ Idx: uint64(len(state.arrayData)), Type: t, Elems: elems }
+    state.arrayData = append(state.arrayData, arr)
+    if state.used != nil {
+        state.used[arr.Idx] = true
+    }
     return arr.Idx
 }
 
+// only the used literals are generated (see gamma/gen/reach)
+func (state *State) SetUsed(used map[uint64]bool) {
+    state.used = used
+}
+
+func (state *State) IsUsed(idx uint64) bool {
+    return state.used == nil || state.used[idx]
+}
+
 func getBaseAndLength(t types.ArrType) (baseType types.Type, lenght uint64) {
     if t,ok := t.BaseType.(types.ArrType); ok {
         b,l := getBaseAndLength(t)
@@ -39,123 +71,142 @@ func getBaseAndLength(t types.ArrType) (baseType types.Type, lenght uint64) {
     return t.BaseType, t.Len
 }
 
-func Gen() {
-    for i,arr := range arrayData {
+func (state *State) Gen() {
+    for i,arr := range state.arrayData {
+        if !state.IsUsed(uint64(i)) {
+            continue
+        }
+
         if len(arr.Elems) == 0 {
             baseType, lenSum := getBaseAndLength(arr.Type)
-            nasm.AddBss(fmt.Sprintf("_arr%d: %s %d", i, asm.GetBssSize(baseType.Size()), lenSum))
+            state.nasm.AddBss(fmt.Sprintf("_arr%d: %s %d", i, asm.GetBssSize(baseType.Size()), lenSum))
         } else {
-            nasm.AddData(fmt.Sprintf("_arr%d:", i))
-            addArr(&arr)
+            state.nasm.AddData(fmt.Sprintf("_arr%d:", i))
+            state.addArr(&arr)
         }
     }
 }
 
-func addBasic(size uint, val constVal.ConstVal) {
-    nasm.AddData(fmt.Sprintf("  %s %s", asm.GetDataSize(size), val.GetVal()))
+func (state *State) addBasic(size uint, val constVal.ConstVal) {
+    state.nasm.AddData(fmt.Sprintf("  %s %s", asm.GetDataSize(size), val.GetVal()))
 }
 
-func addStr(val *constVal.StrConst) {
-    nasm.AddData(fmt.Sprintf("  %s _str%d", asm.GetDataSize(types.Ptr_Size), uint64(*val)))
-    nasm.AddData(fmt.Sprintf("  %s %d", asm.GetDataSize(types.I32_Size), str.GetSize(uint64(*val))))
+func (state *State) addStr(val *constVal.StrConst) {
+    state.nasm.AddData(fmt.Sprintf("  %s _str%d", asm.GetDataSize(types.Ptr_Size), uint64(*val)))
+    state.nasm.AddData(fmt.Sprintf("  %s %d", asm.GetDataSize(types.I32_Size), state.str.GetSize(uint64(*val))))
 }
 
-func addStrPtr(val *constVal.StrConst) {
-    nasm.AddData(fmt.Sprintf("  %s _str%d", asm.GetDataSize(types.Ptr_Size), uint64(*val)))
+func (state *State) addStrPtr(val *constVal.StrConst) {
+    state.nasm.AddData(fmt.Sprintf("  %s _str%d", asm.GetDataSize(types.Ptr_Size), uint64(*val)))
 }
 
-func addDefault(t types.Type) {
+func (state *State) addDefault(t types.Type) {
     switch t := t.(type) {
     case types.StrType:
-        nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(types.Ptr_Size)))
-        nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(types.U32_Size)))
+        state.nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(types.Ptr_Size)))
+        state.nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(types.U32_Size)))
 
     case types.StructType:
         for _,t := range t.Types {
-            addDefault(t)
+            state.addDefault(t)
         }
 
     case types.ArrType:
         baseType, lenSum := getBaseAndLength(t)
         for i := uint64(0); i < lenSum; i++ {
-            nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(baseType.Size())))
+            state.nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(baseType.Size())))
         }
 
     default:
-        nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(t.Size())))
+        state.nasm.AddData(fmt.Sprintf("  %s 0", asm.GetDataSize(t.Size())))
     }
 }
 
-func addArr(arr *constVal.ArrConst) {
+func (state *State) addArr(arr *constVal.ArrConst) {
     switch t := arr.Type.BaseType.(type) {
     case types.StrType:
         for _, v := range arr.Elems {
             if v == nil {
-                addDefault(t)
+                state.addDefault(t)
             } else {
-                addStr(v.(*constVal.StrConst))
+                state.addStr(v.(*constVal.StrConst))
             }
         }
 
     case types.StructType:
         for _, v := range arr.Elems {
             if v == nil {
-                addDefault(t)
+                state.addDefault(t)
             } else {
-                addStruct(t, v.(*constVal.StructConst))
+                state.addStruct(t, v.(*constVal.StructConst))
             }
         }
 
     case types.ArrType:
         for _, v := range arr.Elems {
             if v == nil {
-                addDefault(t)
+                state.addDefault(t)
             } else {
-                addArr(v.(*constVal.ArrConst))
+                state.addArr(v.(*constVal.ArrConst))
             }
         }
 
     case types.IntType, types.UintType, types.BoolType, types.CharType, types.PtrType:
         for _, v := range arr.Elems {
             if v == nil {
-                addDefault(t)
+                state.addDefault(t)
+            } else {
+                state.addBasic(t.Size(), v)
+            }
+        }
+
+    // niche enums (like Opt<*T>) are only the pointer (or 0)
+    case types.EnumType:
+        if !t.IsNiche() {
+            state.diag.Errorf("%v is not supported yet (in work)", arr.Type.BaseType)
+            state.diag.Exit()
+        }
+
+        for _, v := range arr.Elems {
+            if v == nil {
+                state.addDefault(t)
             } else {
-                addBasic(t.Size(), v)
+                state.addBasic(types.Ptr_Size, v)
             }
         }
 
 
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] %v is not supported yet (in work)\n", arr.Type.BaseType)
-        os.Exit(1)
+        state.diag.Errorf("%v is not supported yet (in work)", arr.Type.BaseType)
+        state.diag.Exit()
     }
 }
 
-func addStruct(t types.StructType, val *constVal.StructConst) {
+func (state *State) addStruct(t types.StructType, val *constVal.StructConst) {
     for i,v := range val.Fields {
         switch v := v.(type) {
         case *constVal.StrConst:
             if t.Types[i].GetKind() == types.Str {
-                addStr(v)
+                state.addStr(v)
             } else {        // *char cast
-                addStrPtr(v)
+                state.addStrPtr(v)
             }
 
         case *constVal.StructConst:
-            addStruct(t.Types[i].(types.StructType), v)
+            state.addStruct(t.Types[i].(types.StructType), v)
 
         case *constVal.IntConst, *constVal.UintConst, *constVal.BoolConst, *constVal.CharConst, *constVal.PtrConst:
-            addBasic(t.Types[i].Size(), v)
+            state.addBasic(t.Types[i].Size(), v)
 
         case *constVal.ArrConst:
-            addArr(v)
+            state.addArr(v)
 
         case nil:
-            addDefault(t)
+            state.addDefault(t)
 
         default:
-            fmt.Fprintf(os.Stderr, "[ERROR] %v is not supported yet (in work)\n", t)
-            os.Exit(1)
+            state.diag.Errorf("%v is not supported yet (in work)", t)
+            state.diag.Exit()
         }
     }
 }
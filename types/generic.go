@@ -1,10 +1,7 @@
 package types
 
-var genericInsetTypes []Type = make([]Type, 0, 20)
-
 func CreateGeneric(name string, guardType InterfaceType) GenericType {
-    genericInsetTypes = append(genericInsetTypes, nil)
-    return GenericType{ Name: name, Idx: uint64(len(genericInsetTypes)-1), Guard: guardType }
+    return GenericType{ Name: name, Guard: guardType, curInset: new(Type) }
 }
 
 func UpdateInsetType(t Type) {
@@ -39,12 +36,12 @@ func SetCurInsetType(t Type, insetType Type) {
         SetCurInsetType(t.BaseType, insetType)
 
     case GenericType:
-        if t.Idx < uint64(len(genericInsetTypes)) {
-            genericInsetTypes[t.Idx] = insetType 
+        if t.curInset != nil {
+            *t.curInset = insetType
         }
     case *GenericType:
-        if t.Idx < uint64(len(genericInsetTypes)) {
-            genericInsetTypes[t.Idx] = insetType 
+        if t.curInset != nil {
+            *t.curInset = insetType
         }
     }
 }
@@ -68,8 +65,8 @@ func ResolveGeneric(t Type) Type {
             return t.SetType
         }
         
-        if t.Idx < uint64(len(genericInsetTypes)) && genericInsetTypes[t.Idx] != nil {
-            return genericInsetTypes[t.Idx]
+        if t.curInset != nil && *t.curInset != nil {
+            return *t.curInset
         }
 
         return nil
@@ -78,8 +75,8 @@ func ResolveGeneric(t Type) Type {
             return t.SetType
         }
 
-        if t.Idx < uint64(len(genericInsetTypes)) && genericInsetTypes[t.Idx] != nil {
-            return genericInsetTypes[t.Idx]
+        if t.curInset != nil && *t.curInset != nil {
+            return *t.curInset
         }
 
         return nil
@@ -87,3 +84,28 @@ func ResolveGeneric(t Type) Type {
 
     return t
 }
+
+// the generic in t (T of *T, [$]T, Opt<*T>, ...) or nil
+func InnerGeneric(t Type) Type {
+    switch t := t.(type) {
+    case PtrType:
+        return InnerGeneric(t.BaseType)
+
+    case ArrType:
+        return InnerGeneric(t.BaseType)
+
+    case VecType:
+        return InnerGeneric(t.BaseType)
+
+    case StructType:
+        return InnerGeneric(t.insetType)
+
+    case EnumType:
+        return InnerGeneric(t.insetType)
+
+    case GenericType, *GenericType:
+        return t
+    }
+
+    return nil
+}
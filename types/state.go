@@ -0,0 +1,17 @@
+package types
+
+import (
+    "gamma/diag"
+)
+
+// type indices of one compilation (see gamma/compiler)
+type State struct {
+    inferIdx uint64
+    implIdx uint64
+
+    diag *diag.State
+}
+
+func NewState(diag *diag.State) *State {
+    return &State{ implIdx: 17, diag: diag }
+}
@@ -1,12 +1,12 @@
 package str
 
 import (
-    "os"
     "fmt"
     "strings"
     "gamma/token"
     "gamma/types/char"
     "gamma/gen/asm/x86_64/nasm"
+    "gamma/diag"
 )
 
 
@@ -15,25 +15,82 @@ type strLit struct {
     size uint
 }
 
-var strLits []strLit
-var strs map[string]uint64 = make(map[string]uint64)
+// string literals of one compilation (see gamma/compiler)
+type State struct {
+    strLits []strLit
+    strs map[string]uint64
+    used map[uint64]bool    // nil -> every literal is generated
 
+    diag *diag.State
+    nasm *nasm.State
+}
+
+func NewState(diag *diag.State, nasm *nasm.State) *State {
+    return &State{ strs: make(map[string]uint64), diag: diag, nasm: nasm }
+}
+
+
+func (state *State) GetSize(idx uint64) uint {
+    return state.strLits[idx].size
+}
+
+func (state *State) Count() uint64 {
+    return uint64(len(state.strLits))
+}
+
+// decodes the nasm repr ("abc",10,"def") into the raw bytes
+func (state *State) GetBytes(idx uint64) []byte {
+    repr := state.strLits[idx].repr
+    res := make([]byte, 0, state.strLits[idx].size)
+
+    for i := 0; i < len(repr); i++ {
+        switch {
+        case repr[i] == '"':
+            end := strings.IndexByte(repr[i+1:], '"') + i+1
+            res = append(res, repr[i+1:end]...)
+            i = end
+
+        case repr[i] >= '0' && repr[i] <= '9':
+            n := 0
+            for ; i < len(repr) && repr[i] >= '0' && repr[i] <= '9'; i++ {
+                n = n*10 + int(repr[i] - '0')
+            }
+            res = append(res, byte(n))
+        }
+    }
+
+    return res
+}
+
+func (state *State) Add(s token.Token) uint64 {
+    return state.addStrLit(state.escape(s))
+}
 
-func GetSize(idx uint64) uint {
-    return strLits[idx].size
+// only the used literals are generated (see gamma/gen/reach)
+// literals added later are used (added while generating)
+func (state *State) SetUsed(used map[uint64]bool) {
+    state.used = used
 }
 
-func Add(s token.Token) uint64 {
-    return addStrLit(escape(s))
+func (state *State) IsUsed(idx uint64) bool {
+    return state.used == nil || state.used[idx]
 }
 
-func Gen() {
-    for idx,lit := range strLits {
-        nasm.AddRodata(fmt.Sprintf("_str%d: db %s", idx, lit.repr))
+func (state *State) markUsed(idx uint64) {
+    if state.used != nil {
+        state.used[idx] = true
+    }
+}
+
+func (state *State) Gen() {
+    for idx,lit := range state.strLits {
+        if state.IsUsed(uint64(idx)) {
+            state.nasm.AddRodata(fmt.Sprintf("_str%d: db %s", idx, lit.repr))
+        }
     }
 }
 
-func escape(s token.Token) strLit {
+func (state *State) escape(s token.Token) strLit {
     size := uint(0)
     escape := false
     for _,r := range s.Str {
@@ -49,9 +106,9 @@ func escape(s token.Token) strLit {
             } else {
                 s.Pos.Col += int(size)
 
-                fmt.Fprintf(os.Stderr, "[ERROR] unknown escape sequence \"\\%c\"\n", r)
-                fmt.Fprintln(os.Stderr, "\t" + s.At())
-                os.Exit(1)
+                state.diag.Errorf("unknown escape sequence \"\\%c\"", r)
+                state.diag.At(s.At())
+                state.diag.Exit()
             }
         }
 
@@ -66,36 +123,38 @@ func escape(s token.Token) strLit {
     return strLit{ s.Str, size }
 }
 
-func CmpStrLits(idx1 uint64, idx2 uint64) bool {
+func (state *State) CmpStrLits(idx1 uint64, idx2 uint64) bool {
     if idx1 == idx2 {
         return true
     }
 
-    return strLits[idx1].repr == strLits[idx2].repr
+    return state.strLits[idx1].repr == state.strLits[idx2].repr
 }
 
-func ConcatStrLits(pos token.Pos, idx1 uint64, idx2 uint64) uint64 {
-    s1 := strLits[idx1].repr
-    s2 := strLits[idx2].repr
+func (state *State) ConcatStrLits(pos token.Pos, idx1 uint64, idx2 uint64) uint64 {
+    s1 := state.strLits[idx1].repr
+    s2 := state.strLits[idx2].repr
 
-    strLit := strLit{ size: strLits[idx1].size + strLits[idx2].size }
+    strLit := strLit{ size: state.strLits[idx1].size + state.strLits[idx2].size }
     if s1[len(s1)-1] == '"' && s2[0] == '"' {
         strLit.repr = s1[:len(s1)-1] + s2[1:]
     } else {
         strLit.repr = s1 + "," + s2
     }
 
-    return addStrLit(strLit)
+    return state.addStrLit(strLit)
 }
 
-func addStrLit(s strLit) uint64 {
-    if idx,ok := strs[s.repr]; ok {
+func (state *State) addStrLit(s strLit) uint64 {
+    if idx,ok := state.strs[s.repr]; ok {
+        state.markUsed(idx)
         return idx
     }
 
-    idx := uint64(len(strLits))
-    strLits = append(strLits, s)
-    strs[s.repr] = idx
+    idx := uint64(len(state.strLits))
+    state.strLits = append(state.strLits, s)
+    state.strs[s.repr] = idx
+    state.markUsed(idx)
 
     return idx
 }
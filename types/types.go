@@ -2,7 +2,7 @@ package types
 
 import (
 	"fmt"
-	"os"
+	"sort"
 	"strconv"
 )
 
@@ -96,7 +96,7 @@ type GenericType struct {
     Name string
     Guard Type
     SetType Type
-    Idx uint64
+    curInset *Type  // shared by all copies of the generic (see SetCurInsetType)
 }
 type InterfaceType struct {
     ImplId uint64
@@ -110,23 +110,20 @@ type InferType struct {
 }
 
 
-var inferIdx uint64 = 0
-var implIdx uint64 = 17
-
-func nextInferIdx() uint64 {
-    i := inferIdx
-    inferIdx++
+func (state *State) nextInferIdx() uint64 {
+    i := state.inferIdx
+    state.inferIdx++
     return i
 }
 
-func nextImplIdx() uint64 {
-    i := implIdx
-    implIdx++
+func (state *State) nextImplIdx() uint64 {
+    i := state.implIdx
+    state.implIdx++
     return i
 }
 
-func GetCurImplIdx() uint64 {
-    return implIdx
+func (state *State) GetCurImplIdx() uint64 {
+    return state.implIdx
 }
 
 func isAligned(types []Type, size uint) (aligned bool, rest uint)  {
@@ -178,7 +175,7 @@ func CreateUint(uintSize uint) UintType {
 func CreateEmptyStructType(name string) StructType {
     return StructType{ Name: name }
 }
-func CreateStructType(name string, types []Type, names []string, genericName string) StructType {
+func (state *State) CreateStructType(name string, types []Type, names []string, genericName string) StructType {
     ns := map[string]int{}
     for i, n := range names {
         ns[n] = i
@@ -196,7 +193,7 @@ func CreateStructType(name string, types []Type, names []string, genericName str
     }
 
     return StructType{ 
-        ImplId: nextImplIdx(),
+        ImplId: state.nextImplIdx(),
         Name: name,
         Types: types,
         isBigStruct: isBigStruct,
@@ -206,7 +203,7 @@ func CreateStructType(name string, types []Type, names []string, genericName str
     }
 }
 
-func CreateEnumType(name string, idType Type, names []string, types []Type, genericName string) EnumType {
+func (state *State) CreateEnumType(name string, idType Type, names []string, types []Type, genericName string) EnumType {
     size := uint(0)
     isBigStruct := false
     for _,t := range types {
@@ -221,8 +218,8 @@ func CreateEnumType(name string, idType Type, names []string, types []Type, gene
     size += idType.Size()
 
     if len(names) != len(types) {
-        fmt.Fprintln(os.Stderr, "[ERROR] (internal) CreateEnumType len names and types is not equal")
-        os.Exit(1)
+        state.diag.Error("(internal) CreateEnumType len names and types is not equal")
+        state.diag.Exit()
     }
 
     ts := make(map[string]Type)
@@ -233,7 +230,7 @@ func CreateEnumType(name string, idType Type, names []string, types []Type, gene
     }
 
     return EnumType{ 
-        ImplId: nextImplIdx(),
+        ImplId: state.nextImplIdx(),
         Name: name,
         IdType: idType,
         types: ts,
@@ -244,20 +241,20 @@ func CreateEnumType(name string, idType Type, names []string, types []Type, gene
     }
 }
 
-func CreateInferType(defaultType Type) InferType {
-    return InferType{ DefaultType: defaultType, Idx: nextInferIdx() }
+func (state *State) CreateInferType(defaultType Type) InferType {
+    return InferType{ DefaultType: defaultType, Idx: state.nextInferIdx() }
 }
 
-func CreateInterfaceType(name string) InterfaceType {
-    return InterfaceType{ ImplId: nextImplIdx(), Name: name }
+func (state *State) CreateInterfaceType(name string) InterfaceType {
+    return InterfaceType{ ImplId: state.nextImplIdx(), Name: name }
 }
 
 func CreateFuncType(name string, generic GenericType) FuncType {
     return FuncType{ Name: name, Generic: generic }
 }
 
-func CreateUnresolvedFuncType() FuncType {
-    return FuncType{ Ret: CreateInferType(nil) }
+func (state *State) CreateUnresolvedFuncType() FuncType {
+    return FuncType{ Ret: state.CreateInferType(nil) }
 }
 
 func (t *StructType) GetOffset(field string) (offset int64) {
@@ -324,6 +321,7 @@ func (t *EnumType) HasElem(name string) bool {
     return ok
 }
 
+// ordered by id
 func (t *EnumType) GetElems() []string {
     res := make([]string, 0, len(t.types))
 
@@ -331,6 +329,8 @@ func (t *EnumType) GetElems() []string {
         res = append(res, name)
     }
 
+    sort.Slice(res, func(i, j int) bool { return t.ids[res[i]] < t.ids[res[j]] })
+
     return res
 }
 
@@ -338,6 +338,37 @@ func (t *EnumType) GetElemID(name string) uint64 {
     return t.ids[name]
 }
 
+// enums like Opt<*T> (one elem with a pointer, one without content) have no id in memory
+// they are stored as the pointer and 0 is the elem without content (pointers are never null)
+func (t *EnumType) NicheElems() (ptrElem string, nullElem string, ok bool) {
+    if len(t.types) != 2 {
+        return "", "", false
+    }
+
+    for name,elemType := range t.types {
+        if elemType == nil {
+            nullElem = name
+        } else if _,isPtr := ResolveGeneric(elemType).(PtrType); isPtr {
+            ptrElem = name
+        }
+    }
+
+    return ptrElem, nullElem, ptrElem != "" && nullElem != ""
+}
+
+func (t *EnumType) IsNiche() bool {
+    _,_,ok := t.NicheElems()
+    return ok
+}
+
+// offset of the content (0 for niche enums)
+func (t *EnumType) ContentOffset() uint {
+    if t.IsNiche() {
+        return 0
+    }
+    return t.IdType.Size()
+}
+
 func (t *InterfaceType) GetFunc(name string) *FuncType {
     for _,f := range t.Funcs {
         if f.Name == name {
@@ -365,7 +396,7 @@ func ResolveFnSrc(src Type, fnName string, firstArgType Type) Type {
     switch t := src.(type) {
     case InterfaceType:
         f := t.GetFunc(fnName)
-        if len(f.Args) > 0 && IsSelfType(f.Args[0], t) {
+        if f != nil && len(f.Args) > 0 && IsSelfType(f.Args[0], t) {
             return firstArgType
         }
     case GenericType:
@@ -384,7 +415,7 @@ func IsBigStruct(t Type) bool {
     case StructType:
         return t.isBigStruct
     case EnumType:
-        return t.isBigStruct
+        return t.isBigStruct && !t.IsNiche()
     case *GenericType:
         if ResolveGeneric(t) != nil {
             return IsBigStruct(ResolveGeneric(t))
@@ -556,22 +587,35 @@ func ReplaceGeneric(t Type, insetType Type) Type {
 
     case EnumType:
         if t.insetType == nil || IsGeneric(t.insetType) {
-            t.insetType = insetType
+            // Opt<*T> in a generic func gets *T replaced (not T)
+            if t.insetType == nil {
+                t.insetType = insetType
+            } else {
+                t.insetType = ReplaceGeneric(t.insetType, insetType)
+            }
 
             ts := make(map[string]Type)
+            size := uint(0)
             for name, elemType := range t.types {
                 ts[name] = ReplaceGeneric(elemType, insetType)
+                if ts[name] != nil && ts[name].Size() > size {
+                    size = ts[name].Size()
+                }
             }
 
             t.types = ts
-            t.size = t.IdType.Size() + insetType.Size()
+            t.size = t.IdType.Size() + size
         }
 
         return t
 
     case StructType:
         if t.insetType == nil || IsGeneric(t.insetType) {
-            t.insetType = insetType
+            if t.insetType == nil {
+                t.insetType = insetType
+            } else {
+                t.insetType = ReplaceGeneric(t.insetType, insetType)
+            }
 
             ts := make([]Type, len(t.Types))
             size := uint(0)
@@ -658,13 +702,16 @@ func (t PtrType)        Size() uint { return Ptr_Size }
 func (t ArrType)        Size() uint { return Arr_Size }
 func (t VecType)        Size() uint { return Vec_Size }
 func (t StructType)     Size() uint { return t.size }
-func (t EnumType)       Size() uint { return t.size }
+func (t EnumType)       Size() uint {
+    if t.IsNiche() {
+        return Ptr_Size
+    }
+    return t.size
+}
 func (t InterfaceType)  Size() uint { return Interface_Size }
 func (t FuncType)       Size() uint { return Func_Size }
 func (t InferType)      Size() uint { 
-    fmt.Fprintln(os.Stderr, "[ERROR] (internal) InferType Size() should never get called")
-    os.Exit(1)
-    return 0 
+    panic("(internal) InferType Size() should never get called")
 }
 func (t GenericType) Size() uint {
     if ResolveGeneric(t) != nil {
@@ -685,9 +732,7 @@ func (t IntType) String() string {
     case I64_Size:
         return "i64"
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unexpected int size %d", t.size)
-        os.Exit(1)
-        return ""
+        panic(fmt.Sprintf("(internal) unexpected int size %d", t.size))
     }
 }
 func (t UintType) String() string {
@@ -701,9 +746,7 @@ func (t UintType) String() string {
     case U64_Size:
         return "u64"
     default:
-        fmt.Fprintf(os.Stderr, "[ERROR] unexpected uint size %d", t.size)
-        os.Exit(1)
-        return ""
+        panic(fmt.Sprintf("(internal) unexpected uint size %d", t.size))
     }
 }
 func (t CharType) String() string { return "char" }
@@ -897,7 +940,7 @@ func ToBaseType(s string) Type {
     }
 }
 
-func TypeOfVal(val string) Type {
+func (state *State) TypeOfVal(val string) Type {
     switch {
     case val[0] == '"' && val[len(val) - 1] == '"':
         return StrType{}
@@ -907,17 +950,17 @@ func TypeOfVal(val string) Type {
         return BoolType{}
     case len(val) > 2 && val[:2] == "0x":
         if _, err := strconv.ParseUint(val, 0, 64); err == nil {
-            return CreateInferType(UintType{ size: U64_Size })
+            return state.CreateInferType(UintType{ size: U64_Size })
         }
     default:
         if _, err := strconv.ParseInt(val, 10, 32); err == nil {
-            return CreateInferType(IntType{ size: I32_Size })
+            return state.CreateInferType(IntType{ size: I32_Size })
         }
         if _, err := strconv.ParseInt(val, 10, 64); err == nil {
-            return CreateInferType(IntType{ size: I64_Size })
+            return state.CreateInferType(IntType{ size: I64_Size })
         }
         if _, err := strconv.ParseUint(val, 0, 64); err == nil {
-            return CreateInferType(UintType{ size: U64_Size })
+            return state.CreateInferType(UintType{ size: U64_Size })
         }
     }
 
@@ -0,0 +1,20 @@
+package warn
+
+import (
+    "gamma/ast/identObj"
+    "gamma/cmpTime"
+    "gamma/diag"
+    "gamma/import"
+)
+
+// the states used by the warnings and analyses (see gamma/compiler)
+type State struct {
+    identObj *identObj.State
+    cmpTime *cmpTime.State
+    diag *diag.State
+    imprt *imprt.State
+}
+
+func NewState(identObj *identObj.State, cmpTime *cmpTime.State, diag *diag.State, imprt *imprt.State) *State {
+    return &State{ identObj: identObj, cmpTime: cmpTime, diag: diag, imprt: imprt }
+}
@@ -0,0 +1,316 @@
+package warn
+
+import (
+    "fmt"
+    "math/big"
+    "strings"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/ast/identObj/vars"
+    "gamma/cmpTime/constVal"
+)
+
+/*
+analyses of gamma vet (after the type check, only for the files of the user):
+  * unsigned-cmp:    comparisons of uints which are always true/false (x < 0, x <= 255 for u8, ...)
+  * self-assign:     x = x, s.a = s.a, ...
+  * shadow:          vars/consts which shadow a var/const of a scope around them
+  * truncating-cast: const casts to an int/uint which change the value (300 as u8)
+  * const-cond:      if/elif conditions which are const
+  * ptr-arith:       + and - on pointers to types bigger than a byte (the offset is in bytes)
+analyses are enabled/disabled with flags like the warnings (gamma vet -A none,shadow)
+findings are reported as warnings, vet exits with 1 if there are any
+*/
+
+const (
+    UnsignedCmp    string = "unsigned-cmp"
+    SelfAssign     string = "self-assign"
+    Shadow         string = "shadow"
+    TruncatingCast string = "truncating-cast"
+    ConstCond      string = "const-cond"
+    PtrArith       string = "ptr-arith"
+)
+
+var analyses []string = []string{ UnsignedCmp, SelfAssign, Shadow, TruncatingCast, ConstCond, PtrArith }
+
+func (state *State) Vet(Ast ast.Ast, flags []string) {
+    c := checker{ state: state, enabled: state.parseFlags(flags, analyses, "analysis") }
+
+    c.vetDecls(Ast.Decls)
+    c.vetShadowed()
+
+    c.report(false)
+    if len(c.warnings) > 0 {
+        state.diag.Exit()
+    }
+}
+
+// reports unknown analyses before the file is compiled
+func (state *State) CheckAnalyses(flags []string) {
+    state.parseFlags(flags, analyses, "analysis")
+}
+
+func (c *checker) vetDecls(decls []ast.Decl) {
+    for _,d := range decls {
+        if imp,ok := d.(*ast.Import); ok {
+            c.vetDecls(imp.Decls)
+            continue
+        }
+
+        if !c.state.isUserFile(declFile(d)) {
+            continue
+        }
+
+        ast.Inspect(d, func(n ast.Node) bool {
+            switch n := n.(type) {
+            case *ast.Binary:
+                c.vetUnsignedCmp(n)
+                c.vetPtrArith(n)
+            case *ast.Assign:
+                c.vetSelfAssign(n)
+            case *ast.Cast:
+                c.vetTruncatingCast(n)
+            case *ast.If:
+                c.vetConstCond("if", n.Cond)
+            case *ast.Elif:
+                c.vetConstCond("elif", n.Cond)
+            }
+
+            return true
+        })
+    }
+}
+
+func isCmp(op token.TokenType) bool {
+    switch op {
+    case token.Eql, token.Neq, token.Lss, token.Grt, token.Leq, token.Geq:
+        return true
+    }
+    return false
+}
+
+// c < x -> x > c
+func flipCmp(op token.TokenType) token.TokenType {
+    switch op {
+    case token.Lss:
+        return token.Grt
+    case token.Grt:
+        return token.Lss
+    case token.Leq:
+        return token.Geq
+    case token.Geq:
+        return token.Leq
+    }
+    return op
+}
+
+func bigConst(c constVal.ConstVal) (*big.Int, bool) {
+    switch c := c.(type) {
+    case *constVal.IntConst:
+        return big.NewInt(int64(*c)), true
+    case *constVal.UintConst:
+        return new(big.Int).SetUint64(uint64(*c)), true
+    case *constVal.CharConst:
+        return big.NewInt(int64(*c)), true
+    }
+    return nil, false
+}
+
+// range of an int/uint/char type (ok is false for other types)
+func intRange(t types.Type) (min *big.Int, max *big.Int, ok bool) {
+    bits := t.Size() * 8
+    switch t.GetKind() {
+    case types.Int:
+        max = new(big.Int).Lsh(big.NewInt(1), bits-1)
+        min = new(big.Int).Neg(max)
+        max.Sub(max, big.NewInt(1))
+    case types.Uint, types.Char:
+        max = new(big.Int).Lsh(big.NewInt(1), bits)
+        max.Sub(max, big.NewInt(1))
+        min = big.NewInt(0)
+    default:
+        return nil, nil, false
+    }
+    return min, max, true
+}
+
+func (c *checker) vetUnsignedCmp(e *ast.Binary) {
+    if !isCmp(e.Operator.Type) {
+        return
+    }
+
+    x, val, op := e.OperandL, c.state.cmpTime.ConstEval(e.OperandR), e.Operator
+    if c.state.cmpTime.ConstEval(x) != nil {
+        x, val, op.Type = e.OperandR, c.state.cmpTime.ConstEval(e.OperandL), flipCmp(op.Type)
+        if c.state.cmpTime.ConstEval(x) != nil {
+            return
+        }
+    }
+
+    t := types.ResolveGeneric(x.GetType())
+    if t == nil || t.GetKind() != types.Uint {
+        return
+    }
+    v, ok := bigConst(val)
+    if !ok {
+        return
+    }
+    min, max, _ := intRange(t)
+
+    // x is in [min, max]
+    var always, decided bool
+    switch op.Type {
+    case token.Lss:
+        always, decided = max.Cmp(v) < 0, max.Cmp(v) < 0 || min.Cmp(v) >= 0
+    case token.Leq:
+        always, decided = max.Cmp(v) <= 0, max.Cmp(v) <= 0 || min.Cmp(v) > 0
+    case token.Grt:
+        always, decided = min.Cmp(v) > 0, min.Cmp(v) > 0 || max.Cmp(v) <= 0
+    case token.Geq:
+        always, decided = min.Cmp(v) >= 0, min.Cmp(v) >= 0 || max.Cmp(v) < 0
+    case token.Eql:
+        always, decided = false, v.Cmp(min) < 0 || v.Cmp(max) > 0
+    case token.Neq:
+        always, decided = true, v.Cmp(min) < 0 || v.Cmp(max) > 0
+    }
+
+    if decided {
+        c.warn(UnsignedCmp, e.Operator.At(), "comparison %v %s %s is always %v (range %s to %s)", t, cmpStr(op.Type), v, always, min, max)
+    }
+}
+
+func cmpStr(op token.TokenType) string {
+    switch op {
+    case token.Eql:
+        return "=="
+    case token.Neq:
+        return "!="
+    case token.Lss:
+        return "<"
+    case token.Grt:
+        return ">"
+    case token.Leq:
+        return "<="
+    }
+    return ">="
+}
+
+func (c *checker) vetPtrArith(e *ast.Binary) {
+    if e.Operator.Type != token.Plus && e.Operator.Type != token.Minus {
+        return
+    }
+
+    for _,operand := range []ast.Expr{ e.OperandL, e.OperandR } {
+        if ptr,ok := types.ResolveGeneric(operand.GetType()).(types.PtrType); ok && ptr.BaseType != nil && ptr.BaseType.Size() != 1 {
+            c.warn(PtrArith, e.Operator.At(), "pointer arithmetic on %v is in bytes (not in elements of %d bytes)", ptr, ptr.BaseType.Size())
+            return
+        }
+    }
+}
+
+func (c *checker) vetSelfAssign(a *ast.Assign) {
+    dest, destObj, ok := c.state.accessPath(a.Dest)
+    if !ok {
+        return
+    }
+
+    if val, valObj, ok := c.state.accessPath(a.Value); ok && val == dest && valObj == destObj {
+        c.warn(SelfAssign, a.Dest.At(), "self-assignment of %s", dest)
+    }
+}
+
+// x, x.y, *x, x[1], ... (ok is false for everything else)
+func (state *State) accessPath(e ast.Expr) (path string, root identObj.IdentObj, ok bool) {
+    switch e := e.(type) {
+    case *ast.Ident:
+        return e.Name, e.Obj, e.Obj != nil
+    case *ast.Paren:
+        return state.accessPath(e.Expr)
+    case *ast.Field:
+        if path, root, ok = state.accessPath(e.Obj); ok {
+            return path + "." + e.FieldName.Str, root, true
+        }
+    case *ast.Unary:
+        if e.Operator.Type == token.Mul {
+            if path, root, ok = state.accessPath(e.Operand); ok {
+                return "*" + path, root, true
+            }
+        }
+    case *ast.Indexed:
+        if idx := state.cmpTime.ConstEval(e.Index); idx != nil {
+            if path, root, ok = state.accessPath(e.ArrExpr); ok {
+                return fmt.Sprintf("%s[%s]", path, idx.GetVal()), root, true
+            }
+        }
+    }
+
+    return "", nil, false
+}
+
+func (c *checker) vetTruncatingCast(e *ast.Cast) {
+    t := types.ResolveGeneric(e.DestType)
+    if t == nil {
+        return
+    }
+    v, ok := bigConst(c.state.cmpTime.ConstEval(e.Expr))
+    if !ok {
+        return
+    }
+    min, max, ok := intRange(t)
+    if !ok || (v.Cmp(min) >= 0 && v.Cmp(max) <= 0) {
+        return
+    }
+
+    // two's complement of the low bits
+    res := new(big.Int).And(v, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), t.Size() * 8), big.NewInt(1)))
+    if res.Cmp(max) > 0 {
+        res.Sub(res, new(big.Int).Lsh(big.NewInt(1), t.Size() * 8))
+    }
+
+    c.warn(TruncatingCast, e.AsPos.At(), "cast of %s to %v changes the value to %s", v, t, res)
+}
+
+func (c *checker) vetConstCond(what string, cond ast.Expr) {
+    if b,ok := c.state.cmpTime.ConstEval(cond).(*constVal.BoolConst); ok {
+        c.warn(ConstCond, cond.At(), "%s condition is always %v", what, bool(*b))
+    }
+}
+
+func (c *checker) vetShadowed() {
+    reported := make(map[string]bool)
+
+    c.state.identObj.WalkShadowed(func(obj identObj.IdentObj, shadowed identObj.IdentObj) {
+        kind, shadowedKind := varKind(obj), varKind(shadowed)
+        if kind == "" || shadowedKind == "" || strings.HasPrefix(obj.GetName(), "_") || !c.state.isUserFile(obj.GetPos().File) {
+            return
+        }
+
+        // locals declared after the inner scope are not visible in it
+        pos, shadowedPos := obj.GetPos(), shadowed.GetPos()
+        if _,global := shadowed.(*vars.GlobalVar); !global && pos.File == shadowedPos.File &&
+            (shadowedPos.Line > pos.Line || (shadowedPos.Line == pos.Line && shadowedPos.Col > pos.Col)) {
+            return
+        }
+
+        // the same code can be in more than one scope (generic functions)
+        at := pos.At()
+        if reported[at] {
+            return
+        }
+        reported[at] = true
+
+        c.warn(Shadow, at, "%s %s shadows the %s %s declared at %s", kind, obj.GetName(), shadowedKind, shadowed.GetName(), strings.TrimPrefix(shadowedPos.At(), "at: "))
+    })
+}
+
+func varKind(obj identObj.IdentObj) string {
+    switch obj.(type) {
+    case *vars.LocalVar, *vars.GlobalVar:
+        return "var"
+    case *identObj.Const:
+        return "const"
+    }
+    return ""
+}
@@ -0,0 +1,448 @@
+package warn
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "strconv"
+    "gamma/token"
+    "gamma/types"
+    "gamma/ast"
+    "gamma/ast/identObj"
+    "gamma/ast/identObj/vars"
+    "gamma/cmpTime/constVal"
+)
+
+/*
+warnings (after the type check, only for the files of the user):
+  * unused-var:     local vars/consts which are never referenced
+  * unused-param:   args which are never referenced (not for functions of impls)
+  * unused-import:  imports whose declarations are never referenced
+  * unused-result:  discarded results of function calls (discard them with "_ := f()")
+  * unreachable:    statements after ret, break, continue or through
+  * loop-escape:    address of a var of a loop stored in a var outside of the loop (the space is reused)
+  * duplicate-case: int/char/bool/enum case constants of a switch which are compared before (the case is never taken)
+categories are enabled/disabled with flags (gamma -W no-unused-param -W none,unused-var)
+with asErrors (-Werror) every warning is an error
+*/
+
+const (
+    UnusedVar    string = "unused-var"
+    UnusedParam  string = "unused-param"
+    UnusedImport string = "unused-import"
+    UnusedResult string = "unused-result"
+    Unreachable  string = "unreachable"
+    LoopEscape   string = "loop-escape"
+    DuplicateCase string = "duplicate-case"
+)
+
+var categories []string = []string{ UnusedVar, UnusedParam, UnusedImport, UnusedResult, Unreachable, LoopEscape, DuplicateCase }
+
+type warning struct {
+    category string
+    msg string
+    at string   // "at: file:line:col"
+}
+
+type checker struct {
+    enabled map[string]bool
+    warnings []warning
+    notLocals map[identObj.IdentObj]bool   // args and iterators of loops (not reported as unused vars)
+    loopEscapes map[*ast.Unary]bool         // already reported (nested loops)
+    state *State
+}
+
+func (state *State) Check(Ast ast.Ast, flags []string, asErrors bool) {
+    c := checker{ state: state, enabled: state.parseFlags(flags, categories, "warning"), notLocals: make(map[identObj.IdentObj]bool), loopEscapes: make(map[*ast.Unary]bool) }
+
+    c.checkDecls(Ast.Decls)
+    c.checkLocals()
+
+    c.report(asErrors)
+}
+
+// reports unknown warnings before the file is compiled
+func (state *State) CheckFlags(flags []string) {
+    state.parseFlags(flags, categories, "warning")
+}
+
+// "all", "none", "<category>" or "no-<category>" (comma separated, applied in order)
+// what names the categories in errors ("warning" or "analysis")
+func (state *State) parseFlags(flags []string, categories []string, what string) map[string]bool {
+    enabled := make(map[string]bool, len(categories))
+    setAll := func(b bool) {
+        for _,c := range categories {
+            enabled[c] = b
+        }
+    }
+    setAll(true)
+
+    for _,flag := range flags {
+        for _,f := range strings.Split(flag, ",") {
+            switch f = strings.TrimSpace(f); {
+            case f == "":
+            case f == "all":
+                setAll(true)
+            case f == "none":
+                setAll(false)
+            case isCategory(categories, strings.TrimPrefix(f, "no-")):
+                enabled[strings.TrimPrefix(f, "no-")] = !strings.HasPrefix(f, "no-")
+            default:
+                state.diag.Errorf("unknown %s \"%s\" (expected all, none, <category> or no-<category>)", what, f)
+                state.diag.Linef("categories: %s", strings.Join(categories, ", "))
+                state.diag.Exit()
+            }
+        }
+    }
+
+    return enabled
+}
+
+func isCategory(categories []string, s string) bool {
+    for _,c := range categories {
+        if c == s {
+            return true
+        }
+    }
+    return false
+}
+
+func (c *checker) warn(category string, at string, format string, args ...interface{}) {
+    if c.enabled[category] {
+        c.warnings = append(c.warnings, warning{ category: category, msg: fmt.Sprintf(format, args...), at: at })
+    }
+}
+
+func (c *checker) report(asErrors bool) {
+    sort.SliceStable(c.warnings, func(i, j int) bool {
+        fi, li, ci := splitAt(c.warnings[i].at)
+        fj, lj, cj := splitAt(c.warnings[j].at)
+        if fi != fj { return fi < fj }
+        if li != lj { return li < lj }
+        return ci < cj
+    })
+
+    for _,w := range c.warnings {
+        if asErrors {
+            c.state.diag.Errorf("%s [-Werror=%s]", w.msg, w.category)
+        } else {
+            c.state.diag.Warningf("%s [%s]", w.msg, w.category)
+        }
+        c.state.diag.At(w.at)
+    }
+
+    if asErrors && len(c.warnings) > 0 {
+        c.state.diag.Exit()
+    }
+}
+
+// "at: file:line:col" (the file can contain ":")
+func splitAt(at string) (file string, line int, col int) {
+    pos := strings.TrimPrefix(at, "at: ")
+
+    idxCol := strings.LastIndex(pos, ":")
+    if idxCol == -1 { return pos, 0, 0 }
+    idxLine := strings.LastIndex(pos[:idxCol], ":")
+    if idxLine == -1 { return pos, 0, 0 }
+
+    line,_ = strconv.Atoi(pos[idxLine+1:idxCol])
+    col,_ = strconv.Atoi(pos[idxCol+1:])
+    return pos[:idxLine], line, col
+}
+
+func (state *State) isUserFile(file string) bool {
+    return file != "" && !state.imprt.IsLibrary(file)
+}
+
+func declFile(d ast.Decl) string {
+    switch d := d.(type) {
+    case *ast.DefFn:
+        return d.FnHead.Name.Pos.File
+    case *ast.Impl:
+        return d.Pos.File
+    case *ast.Import:
+        return d.Pos.File
+    case *ast.DefVar:
+        return d.V.GetPos().File
+    case *ast.DefConst:
+        return d.C.GetPos().File
+    case *ast.DefInterface:
+        return d.Pos.File
+    }
+
+    return ""
+}
+
+func (c *checker) checkDecls(decls []ast.Decl) {
+    for _,d := range decls {
+        if imp,ok := d.(*ast.Import); ok {
+            if c.state.isUserFile(imp.Pos.File) && len(imp.Decls) > 0 && !c.state.importUsed(imp.Decls) {
+                c.warn(UnusedImport, imp.At(), "import %s is never used", imp.Path.Str)
+            }
+            c.checkDecls(imp.Decls)
+            continue
+        }
+
+        if !c.state.isUserFile(declFile(d)) {
+            // args/iterators of libraries are skipped by checkLocals too
+            continue
+        }
+
+        switch d := d.(type) {
+        case *ast.DefFn:
+            c.checkFn(d, true)
+        case *ast.Impl:
+            for i := range d.FnDefs {
+                c.checkFn(&d.FnDefs[i], false)
+            }
+        case *ast.DefInterface:
+            // args of declarations only name the params
+            for _,h := range d.FnHeads {
+                for _,a := range h.Args {
+                    c.notLocals[a.V] = true
+                }
+            }
+        }
+    }
+}
+
+func (c *checker) checkFn(d *ast.DefFn, checkParams bool) {
+    for _,a := range d.FnHead.Args {
+        c.notLocals[a.V] = true
+        if checkParams && !c.state.identObj.IsUsed(a.V) {
+            c.warn(UnusedParam, a.V.GetPos().At(), "parameter %s of %s is never used", a.V.GetName(), d.FnHead.Name.Str)
+        }
+    }
+
+    ast.Inspect(&d.Block, func(n ast.Node) bool {
+        switch n := n.(type) {
+        case *ast.For:
+            c.notLocals[n.Def.V] = true
+            c.checkLoopEscapes(&n.Def, &n.Block)
+        case *ast.While:
+            if n.Def != nil {
+                c.notLocals[n.Def.V] = true
+            }
+            c.checkLoopEscapes(n.Def, &n.Block)
+
+        case *ast.Block:
+            c.checkUnreachable(n.Stmts)
+
+        case *ast.Switch:
+            conds := make([]ast.Expr, 0, len(n.Cases))
+            for _,cs := range n.Cases {
+                conds = append(conds, cs.Cond)
+            }
+            c.checkDuplicateCases(conds)
+        case *ast.XSwitch:
+            conds := make([]ast.Expr, 0, len(n.Cases))
+            for _,cs := range n.Cases {
+                conds = append(conds, cs.Cond)
+            }
+            c.checkDuplicateCases(conds)
+
+        case *ast.ExprStmt:
+            if call,ok := n.Expr.(*ast.FnCall); ok && call.F != nil && call.F.GetRetType() != nil && !strings.HasPrefix(call.Ident.Name, "_") {
+                c.warn(UnusedResult, call.At(), "result of %s (%v) is not used (discard it with \"_ := %s(...)\")", call.Ident.Name, call.F.GetRetType(), call.Ident.Name)
+            }
+        }
+
+        return true
+    })
+}
+
+func (c *checker) checkUnreachable(stmts []ast.Stmt) {
+    for i := 0; i+1 < len(stmts); i++ {
+        var after string
+        switch stmts[i].(type) {
+        case *ast.Ret:
+            after = "ret"
+        case *ast.Break:
+            after = "break"
+        case *ast.Continue:
+            after = "continue"
+        case *ast.Through:
+            after = "through"
+        default:
+            continue
+        }
+
+        c.warn(Unreachable, stmts[i+1].At(), "unreachable statement after %s", after)
+        return
+    }
+}
+
+// "x == { 1: ...; 2, 1: ... }" (the second 1 is never taken, same for the other compares)
+func (c *checker) checkDuplicateCases(conds []ast.Expr) {
+    var base ast.Expr
+    var op token.TokenType
+    first := make(map[string]string)
+
+    for _,cond := range conds {
+        for _,b := range ast.FlattenOr(cond) {
+            if base == nil {
+                base, op = b.OperandL, b.Operator.Type
+            } else if b.OperandL != base || b.Operator.Type != op {
+                // not a switch with a base cond
+                return
+            }
+
+            var val string
+            if e,ok := b.OperandR.(*ast.EnumLit); ok {
+                if e.Content != nil {
+                    continue
+                }
+                val = fmt.Sprintf("%s.%s", e.Type.Name, e.ElemName.Str)
+            } else {
+                switch v := c.state.cmpTime.ConstEval(b.OperandR).(type) {
+                case *constVal.IntConst, *constVal.UintConst:
+                    val = v.GetVal()
+                case *constVal.CharConst:
+                    val = fmt.Sprintf("'%c'", rune(*v))
+                case *constVal.BoolConst:
+                    val = fmt.Sprint(bool(*v))
+                default:
+                    continue
+                }
+            }
+
+            if at,ok := first[val]; ok {
+                c.warn(DuplicateCase, b.OperandR.At(), "duplicate case %s (first case at %s)", val, strings.TrimPrefix(at, "at: "))
+            } else {
+                first[val] = b.OperandR.At()
+            }
+        }
+    }
+}
+
+// &v (v declared in the loop) assigned to a var declared outside of the loop
+func (c *checker) checkLoopEscapes(def *ast.DefVar, block *ast.Block) {
+    inLoop := make(map[identObj.IdentObj]bool)
+    if def != nil {
+        inLoop[def.V] = true
+    }
+    ast.Inspect(block, func(n ast.Node) bool {
+        switch n := n.(type) {
+        case *ast.DefVar:
+            inLoop[n.V] = true
+        case *ast.DecVar:
+            inLoop[n.V] = true
+        }
+        return true
+    })
+
+    ast.Inspect(block, func(n ast.Node) bool {
+        a,ok := n.(*ast.Assign)
+        if !ok {
+            return true
+        }
+
+        dest := rootIdent(a.Dest)
+        if dest == nil || inLoop[dest.Obj] {
+            return true
+        }
+        if _,ok := dest.Obj.(*vars.LocalVar); !ok {
+            return true
+        }
+
+        for _,part := range ast.ValueParts(a.Value) {
+            if u,ok := part.(*ast.Unary); ok && u.Operator.Type == token.Amp && !c.loopEscapes[u] {
+                if v := rootIdent(u.Operand); v != nil && inLoop[v.Obj] {
+                    c.loopEscapes[u] = true
+                    c.warn(LoopEscape, u.At(), "address of %s (declared in the loop) is stored in %s (declared outside of the loop)", v.Name, dest.Name)
+                }
+            }
+        }
+
+        return true
+    })
+}
+
+// the var of x, x.y, (x), ... (nil for derefs, fields of pointers, ...)
+func rootIdent(e ast.Expr) *ast.Ident {
+    switch e := e.(type) {
+    case *ast.Ident:
+        return e
+    case *ast.Field:
+        if _,isPtr := e.Obj.GetType().(types.PtrType); !isPtr {
+            return rootIdent(e.Obj)
+        }
+    case *ast.Paren:
+        return rootIdent(e.Expr)
+    }
+
+    return nil
+}
+
+// local vars/consts in the scopes of the user files
+func (c *checker) checkLocals() {
+    reported := make(map[string]bool)
+
+    c.state.identObj.Walk(func(obj identObj.IdentObj, global bool) {
+        // names starting with "_" are generated by the compiler
+        if global || c.notLocals[obj] || c.state.identObj.IsUsed(obj) || strings.HasPrefix(obj.GetName(), "_") {
+            return
+        }
+
+        kind := ""
+        switch obj.(type) {
+        case *vars.LocalVar:
+            kind = "var"
+        case *identObj.Const:
+            kind = "const"
+        default:
+            return
+        }
+
+        // args are locals too (args of libraries are not in notLocals)
+        if !c.state.isUserFile(obj.GetPos().File) {
+            return
+        }
+
+        // the same code can be in more than one scope (generic functions)
+        at := obj.GetPos().At()
+        if reported[at] {
+            return
+        }
+        reported[at] = true
+
+        c.warn(UnusedVar, at, "%s %s is declared but never used", kind, obj.GetName())
+    })
+}
+
+// true if one of the declarations (or of the nested imports) is referenced
+// (impls extend types declared somewhere else, they count as used)
+func (state *State) importUsed(decls []ast.Decl) bool {
+    for _,d := range decls {
+        var obj identObj.IdentObj
+        switch d := d.(type) {
+        case *ast.Import:
+            if state.importUsed(d.Decls) {
+                return true
+            }
+            continue
+        case *ast.Impl:
+            return true
+        case *ast.DefFn:
+            obj = d.FnHead.F
+        case *ast.DefVar:
+            obj = d.V
+        case *ast.DefConst:
+            obj = d.C
+        case *ast.DefStruct:
+            obj = d.S
+        case *ast.DefInterface:
+            obj = d.I
+        case *ast.DefEnum:
+            obj = d.E
+        default:
+            continue
+        }
+
+        if state.identObj.IsUsed(obj) {
+            return true
+        }
+    }
+
+    return false
+}